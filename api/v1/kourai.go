@@ -0,0 +1,369 @@
+// Package kourai is the stable API of kourai: parsing media from paths,
+// naming their targets, and linking them into a library.
+//
+// It follows semantic versioning. The identifiers of this package are kept
+// compatible for as long as its import path ends in v1; breaking changes get
+// a new package, api/v2. The packages it is built on, such as
+// github.com/alzabo/kourai/pkg, are the implementation of the kourai
+// command and may change in any release.
+package kourai
+
+import (
+	"context"
+	"io/fs"
+	"time"
+
+	impl "github.com/alzabo/kourai/pkg"
+)
+
+// Media types
+const (
+	TypeMovie   = "movie"
+	TypeEpisode = "episode"
+)
+
+// Media is a movie or episode parsed from its path
+type Media struct {
+	// Type is TypeMovie or TypeEpisode
+	Type string
+	// Path is the path the media was parsed from
+	Path string
+	// Title is the movie title, or the episode title when known
+	Title string
+	// Series is the name of the series of episodes, empty for movies
+	Series string
+	// Year is the release year, or 0 when unknown
+	Year int
+	// Season and Episode number episodes, 0 for movies
+	Season  int
+	Episode int
+	// TMDBID is the TMDB ID of the movie or series, or 0 when unknown
+	TMDBID int
+
+	l impl.Linkable
+}
+
+func newMedia(l impl.Linkable) Media {
+	if l == nil {
+		return Media{}
+	}
+	f := impl.Fields(l)
+	return Media{
+		Type:    f.Type,
+		Path:    l.Path(),
+		Title:   f.Title,
+		Series:  f.Series,
+		Year:    f.Year,
+		Season:  f.Season,
+		Episode: f.Episode,
+		TMDBID:  f.TMDBID,
+		l:       l,
+	}
+}
+
+// Parse parses the movie or episode at path, without looking it up. Paths
+// naming a season and episode, e.g. "Show.S01E02.mkv", are episodes, and
+// others movies. The file isn't accessed.
+func Parse(path string) (Media, error) {
+	l, err := impl.NewLinkable(path)
+	if err != nil {
+		return Media{}, err
+	}
+	return newMedia(l), nil
+}
+
+// Target returns the path of m relative to the library, in the default
+// layout or the one of the target templates set with WithTargetTemplates.
+func (m Media) Target() string {
+	if m.l == nil {
+		return ""
+	}
+	return m.l.Target()
+}
+
+// DetectType returns the type of the media at path, TypeMovie or
+// TypeEpisode, as Parse tells them apart, without parsing the rest of its
+// name.
+func DetectType(path string) string {
+	return impl.DetectType(path)
+}
+
+// SeriesFolder is the series, and maybe the season, of a folder. Season is
+// -1 for the folder of a whole series, and 0 for specials.
+type SeriesFolder = impl.SeriesFolder
+
+// ParseSeriesFolder parses the series and season of the folder at path,
+// e.g. "The Wire (2002)", "The Wire (2002)/Season 2" or the season pack
+// "The.Wire.S02.1080p.BluRay-GROUP". The folder isn't accessed.
+func ParseSeriesFolder(path string) (SeriesFolder, error) {
+	return impl.ParseSeriesFolder(path)
+}
+
+// EpisodeID is the season and episode numbered by the name of an episode
+type EpisodeID = impl.EpisodeID
+
+// ParseEpisodeID parses the season and episode numbered by name, the name
+// of an episode without its extension, e.g. "Show.S01E02.Pilot",
+// "Show.1x02", "Show.2024.05.01" or "[Group] Show - 02", or only its ID,
+// e.g. "S01E02" or "2024.05.01".
+func ParseEpisodeID(name string) (EpisodeID, error) {
+	return impl.ParseEpisodeID(name)
+}
+
+// CleanTitle returns the movie title or series name of name, a release name
+// without its extension, e.g. "Heat" for "Heat.1995.1080p.BluRay-GROUP", or
+// "" when it has none.
+func CleanTitle(name string) string {
+	return impl.CleanTitle(name)
+}
+
+// Option configures parsing, lookups and linking. Options apply to the
+// whole process, and accumulate over calls of Plan.
+type Option = impl.Option
+
+// LinkMode is how a target is created from its source
+type LinkMode = impl.LinkMode
+
+const (
+	// ModeHardlink hard links the source, leaving it in place
+	ModeHardlink = impl.ModeHardlink
+	// ModeCopy copies the source, leaving it in place
+	ModeCopy = impl.ModeCopy
+	// ModeMove moves the source to the target
+	ModeMove = impl.ModeMove
+)
+
+// TargetTemplate renders the paths of targets, see ParseTargetTemplate
+type TargetTemplate = impl.TargetTemplate
+
+// TargetFields are the values available to target templates
+type TargetFields = impl.TargetFields
+
+// ParseTargetTemplate parses a text/template of the path of targets
+// relative to the library, rendered with TargetFields, e.g.
+// "Films/{{.Title}} ({{.Year}}){{.Ext}}".
+func ParseTargetTemplate(s string) (*TargetTemplate, error) {
+	return impl.ParseTargetTemplate(s)
+}
+
+// WithSources finds media below the given directories.
+func WithSources(dirs ...string) Option {
+	return impl.WithSources(dirs)
+}
+
+// WithDestination links media into the library at dir.
+func WithDestination(dir string) Option {
+	return impl.WithDestination(dir)
+}
+
+// WithFileExtensions only finds files with the given extensions, compared
+// without case, e.g. "mkv".
+func WithFileExtensions(exts ...string) Option {
+	return impl.WithFileExtensions(exts)
+}
+
+// ExtensionPolicy is how files with an extension are handled
+type ExtensionPolicy = impl.ExtensionPolicy
+
+const (
+	// PolicyLink links files as media, e.g. whole .iso disc images
+	PolicyLink = impl.PolicyLink
+	// PolicyEpisode links files only when they're episodes by their names
+	// or folders
+	PolicyEpisode = impl.PolicyEpisode
+	// PolicySkip skips files with a report
+	PolicySkip = impl.PolicySkip
+	// PolicyIgnore skips files silently
+	PolicyIgnore = impl.PolicyIgnore
+)
+
+// WithExtensionPolicies handles files by the policy of their extension,
+// e.g. {"iso": PolicyLink}, rather than by WithFileExtensions.
+func WithExtensionPolicies(policies map[string]ExtensionPolicy) Option {
+	return impl.WithExtensionPolicies(policies)
+}
+
+// WithExcludePatterns skips files and directories matching any of the
+// regular expressions.
+func WithExcludePatterns(patterns ...string) Option {
+	return impl.WithExcludePatterns(patterns)
+}
+
+// WithMinFileSize skips files smaller than size bytes, e.g. sample clips
+// whose names don't say so.
+func WithMinFileSize(size int64) Option {
+	return impl.WithMinFileSize(size)
+}
+
+// WithTMDBAPIKey looks media up on TMDB with key. Without it, media are
+// named after their paths.
+func WithTMDBAPIKey(key string) Option {
+	return impl.WithTMDBApiKey(key)
+}
+
+// WithTargetTemplates names the targets of movies and episodes with the
+// given templates, or with the default layout where they're nil.
+func WithTargetTemplates(movie, episode *TargetTemplate) Option {
+	return impl.WithTargetTemplates(movie, episode)
+}
+
+// WithLinkMode creates targets with mode, ModeHardlink by default.
+func WithLinkMode(mode LinkMode) Option {
+	return impl.WithLinkMode(mode)
+}
+
+// WithoutMovies skips movies.
+func WithoutMovies() Option {
+	return impl.WithExcludeTypes(true, false)
+}
+
+// WithoutEpisodes skips episodes.
+func WithoutEpisodes() Option {
+	return impl.WithExcludeTypes(false, true)
+}
+
+// WithSettleTime only links files whose size and modification time are
+// unchanged for d, so that files still being written aren't linked.
+func WithSettleTime(d time.Duration) Option {
+	return impl.WithSettleTime(d)
+}
+
+// WithProbe probes the duration, resolution and codecs of videos with
+// ffprobe, for target templates and selectors, skipping those it can't
+// read or without a duration.
+func WithProbe(enabled bool) Option {
+	return impl.WithProbe(enabled)
+}
+
+// WithFileYear keeps the years of movie names that are one year off the
+// release year of their match, which are corrected by default.
+func WithFileYear(keep bool) Option {
+	return impl.WithFileYear(keep)
+}
+
+// CasePolicy is the case of the paths of targets
+type CasePolicy = impl.CasePolicy
+
+const (
+	// CasePreserve keeps the case of titles and of the layout
+	CasePreserve = impl.CasePreserve
+	// CaseLower lower cases targets
+	CaseLower = impl.CaseLower
+	// CaseUpper upper cases targets
+	CaseUpper = impl.CaseUpper
+)
+
+// WithTargetCase changes the case of targets to that of p. Existing folders
+// whose names only differ in case are linked into.
+func WithTargetCase(p CasePolicy) Option {
+	return impl.WithTargetCase(p)
+}
+
+// WithSubtitles also links the subtitles next to each video and named
+// after it, keeping their language suffixes, e.g. "Heat (1995).en.srt".
+func WithSubtitles(enabled bool) Option {
+	return impl.WithSubtitles(enabled)
+}
+
+// Clock tells the time to the checks of source files, e.g. their settle
+// time, see WithClock
+type Clock = impl.Clock
+
+// FileSystem is the file system sources are found and checked in, see
+// WithFileSystem
+type FileSystem = impl.FileSystem
+
+// WithClock tells the time with c instead of the system clock, which nil
+// restores, e.g. to simulate the settle time of files in tests.
+func WithClock(c Clock) Option {
+	return impl.WithClock(c)
+}
+
+// WithFileSystem finds the source files in fsys instead of the operating
+// system's file system, which nil restores. Targets are always created on
+// the operating system's file system.
+func WithFileSystem(fsys FileSystem) Option {
+	return impl.WithFileSystem(fsys)
+}
+
+// MountFS returns the FileSystem of fsys, e.g. a testing/fstest.MapFS, as
+// if it were mounted at the absolute path root.
+func MountFS(root string, fsys fs.FS) FileSystem {
+	return impl.MountFS(root, fsys)
+}
+
+// Link is the target planned for a source
+type Link struct {
+	// Media is the media of the source, as looked up
+	Media Media
+	// Src is the path of the source
+	Src string
+	// Target is the path the source is linked to
+	Target string
+
+	ln impl.Link
+}
+
+// Events are callbacks of the stages of a run, e.g. to notify a chat of
+// each target created. They're called from several workers at once, and nil
+// ones are skipped.
+type Events struct {
+	// OnItemParsed is called with the media parsed from the name of a
+	// source file, before it's looked up
+	OnItemParsed func(Media)
+	// OnItemMatched is called with the link of media looked up, before its
+	// target is created
+	OnItemMatched func(Link)
+	// OnLinkCreated is called with each target created
+	OnLinkCreated func(Link)
+	// OnError is called with the errors that don't stop a run, by the path
+	// of the source they concern, e.g. failed lookups and creates
+	OnError func(path string, err error)
+}
+
+// WithEvents calls the callbacks of e as runs progress, in place of those
+// of earlier calls.
+func WithEvents(e Events) Option {
+	var events impl.Events
+	if e.OnItemParsed != nil {
+		events.OnItemParsed = func(l impl.Linkable) { e.OnItemParsed(newMedia(l)) }
+	}
+	if e.OnItemMatched != nil {
+		events.OnItemMatched = func(ln impl.Link) { e.OnItemMatched(newLink(ln)) }
+	}
+	if e.OnLinkCreated != nil {
+		events.OnLinkCreated = func(ln impl.Link) { e.OnLinkCreated(newLink(ln)) }
+	}
+	events.OnError = e.OnError
+	return impl.WithEvents(events)
+}
+
+// newLink returns the Link of ln
+func newLink(ln impl.Link) Link {
+	return Link{Media: newMedia(ln.Media()), Src: ln.Src, Target: ln.Target, ln: ln}
+}
+
+// Plan finds the media in the sources, looks them up, and returns the links
+// to create. Nothing is written. When ctx is cancelled, the links planned so
+// far are returned with ctx.Err().
+func Plan(ctx context.Context, opts ...Option) ([]Link, error) {
+	linkc, errc := impl.LinkFromFiles(ctx, opts...)
+	var links []Link
+	for ln := range linkc {
+		links = append(links, newLink(ln))
+	}
+	if err := <-errc; err != nil {
+		return links, err
+	}
+	return links, ctx.Err()
+}
+
+// Exists reports whether the target of l exists.
+func (l Link) Exists() bool {
+	return l.ln.Exists()
+}
+
+// Create creates the target of l, and its folders.
+func (l Link) Create() error {
+	return l.ln.Create()
+}
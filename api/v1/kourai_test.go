@@ -0,0 +1,120 @@
+package kourai_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	kourai "github.com/alzabo/kourai/api/v1"
+	"github.com/alzabo/kourai/kouraitest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   kourai.Media
+		target string
+	}{
+		{
+			"/dl/Heat.1995.1080p.mkv",
+			kourai.Media{Type: kourai.TypeMovie, Path: "/dl/Heat.1995.1080p.mkv", Title: "Heat", Year: 1995},
+			"movies/Heat (1995)/Heat.1995.1080p.mkv",
+		},
+		{
+			"/dl/Breaking.Bad.S01E02.mkv",
+			kourai.Media{Type: kourai.TypeEpisode, Path: "/dl/Breaking.Bad.S01E02.mkv", Series: "Breaking Bad", Season: 1, Episode: 2},
+			"tv/Breaking Bad/Season 1/Breaking Bad - S01E02.mkv",
+		},
+	}
+	for _, tt := range tests {
+		got, err := kourai.Parse(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreUnexported(kourai.Media{})); diff != "" {
+			t.Errorf("Parse(%s) mismatch (-want +got):\n%s", tt.path, diff)
+		}
+		if target := got.Target(); target != tt.target {
+			t.Errorf("Parse(%s).Target() = %s, want %s", tt.path, target, tt.target)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	fake := kouraitest.NewTMDB(t)
+	src := kouraitest.Tree(t, "dl/the.matrix.mkv", "dl/notes.txt")
+	dest := t.TempDir()
+	links, err := kourai.Plan(context.Background(),
+		kourai.WithTMDBAPIKey(kouraitest.APIKey),
+		kourai.WithSources(src),
+		kourai.WithDestination(dest),
+		kourai.WithFileExtensions("mkv"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 {
+		t.Fatalf("Plan() = %d links, want 1", len(links))
+	}
+	ln := links[0]
+	if ln.Media.Title != "The Matrix" || ln.Media.Year != 1999 || ln.Media.TMDBID != 603 {
+		t.Errorf("Plan() media = %+v", ln.Media)
+	}
+	if want := filepath.Join(dest, "movies", "The Matrix (1999)", "the.matrix.mkv"); ln.Target != want {
+		t.Errorf("Plan() target = %s, want %s", ln.Target, want)
+	}
+	if ln.Exists() {
+		t.Error("Plan() created the target")
+	}
+	if err := ln.Create(); err != nil || !ln.Exists() {
+		t.Errorf("Create() = %v, target exists: %v", err, ln.Exists())
+	}
+	if len(fake.Requests()) == 0 {
+		t.Error("no requests were sent to the fake TMDB")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	kouraitest.NewTMDB(t)
+	src := kouraitest.Tree(t, "dl/the.matrix.mkv")
+	dest := t.TempDir()
+	var mu sync.Mutex
+	var events []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, s)
+	}
+	links, err := kourai.Plan(context.Background(),
+		kourai.WithTMDBAPIKey(kouraitest.APIKey),
+		kourai.WithSources(src),
+		kourai.WithDestination(dest),
+		kourai.WithFileExtensions("mkv"),
+		kourai.WithEvents(kourai.Events{
+			OnItemParsed:  func(m kourai.Media) { record("parsed " + m.Title) },
+			OnItemMatched: func(l kourai.Link) { record("matched " + l.Media.Title) },
+			OnLinkCreated: func(l kourai.Link) { record("created " + filepath.Base(l.Target)) },
+			OnError:       func(path string, err error) { record("error " + filepath.Base(path)) },
+		}),
+	)
+	// Options apply to the process, so the events are reset by a run
+	// stopped right away
+	defer func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		kourai.Plan(ctx, kourai.WithEvents(kourai.Events{}))
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		links[0].Create()
+	}
+	want := []string{"parsed The Matrix", "matched The Matrix", "created the.matrix.mkv", "error the.matrix.mkv"}
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
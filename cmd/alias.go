@@ -0,0 +1,150 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	aliasDBPath string
+	aliasYear   int
+	arrURL      string
+	arrAPIKey   string
+)
+
+// openAliasDB opens the alias database file given by --aliases, or keeps
+// aliases in store.
+func openAliasDB(store kourai.Store) (*kourai.AliasDB, error) {
+	if aliasDBPath != "" {
+		return kourai.OpenAliasDB(aliasDBPath)
+	}
+	return kourai.NewStoreAliasDB(store), nil
+}
+
+// withAliasDB runs fn with the alias database, closing the store it's kept
+// in afterwards.
+func withAliasDB(fn func(db *kourai.AliasDB) error) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	db, err := openAliasDB(store)
+	if err != nil {
+		return err
+	}
+	return fn(db)
+}
+
+// aliasCmd represents the alias command
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage titles mapped to a fixed TMDB ID",
+	Long: `Aliases map a movie or series title, as parsed from file names, to the
+TMDB ID that should be used for it. They're consulted before searching
+TMDB, so that a wrong match only needs to be corrected once. The repair
+command records aliases for the titles it fixes.
+
+Titles are compared ignoring case and punctuation. An alias recorded with
+a year only applies to files with the same year.`,
+}
+
+var aliasAddCmd = &cobra.Command{
+	Use:   "add <movie|series> <title> <tmdb-id>",
+	Short: "Map a title to a TMDB ID",
+	Args:  cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid TMDB ID %q", args[2])
+		}
+		return withAliasDB(func(db *kourai.AliasDB) error {
+			return db.Record(kourai.Alias{Type: args[0], Title: args[1], Year: aliasYear, ID: id})
+		})
+	},
+}
+
+var aliasRemoveCmd = &cobra.Command{
+	Use:   "rm <movie|series> <title>",
+	Short: "Remove the alias of a title",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAliasDB(func(db *kourai.AliasDB) error {
+			return db.Remove(args[0], args[1], aliasYear)
+		})
+	},
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List aliases",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withAliasDB(func(db *kourai.AliasDB) error {
+			aliases, err := db.List()
+			if err != nil {
+				return err
+			}
+			for _, a := range aliases {
+				title := a.Title
+				if a.Year > 0 {
+					title = fmt.Sprintf("%s (%d)", a.Title, a.Year)
+				}
+				fmt.Printf("%s\t%s\t%d\n", a.Type, title, a.ID)
+			}
+			return nil
+		})
+	},
+}
+
+var aliasImportCmd = &cobra.Command{
+	Use:   "import <sonarr|radarr>",
+	Short: "Seed aliases from a Sonarr or Radarr library",
+	Long: `Read the series or movies of a Sonarr or Radarr instance through its API,
+and record aliases for the TMDB IDs confirmed there. Titles, folder names
+and, for movies, the titles parsed from file names are mapped, so that
+files already organized by those applications match the same entries.
+
+Sonarr only knows TMDB IDs from version 4; series without one are skipped.
+The API key is found under Settings > General.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{kourai.ArrSonarr, kourai.ArrRadarr},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		aliases, err := kourai.ArrAliases(cmd.Context(), args[0], arrURL, arrAPIKey)
+		if err != nil {
+			return err
+		}
+		for _, a := range aliases {
+			fmt.Printf("%s\t%s\t%d\n", a.Type, a.Title, a.ID)
+		}
+		if dryRun {
+			return nil
+		}
+		return withAliasDB(func(db *kourai.AliasDB) error {
+			return db.Record(aliases...)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasAddCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+	aliasCmd.AddCommand(aliasImportCmd)
+
+	aliasAddCmd.Flags().IntVar(&aliasYear, "year", 0, "Only apply the alias to files with this year")
+	aliasRemoveCmd.Flags().IntVar(&aliasYear, "year", 0, "Year the alias was recorded with")
+
+	aliasImportCmd.Flags().StringVar(&arrURL, "url", "", "Base URL of the application, e.g. http://localhost:7878")
+	aliasImportCmd.Flags().StringVar(&arrAPIKey, "arr-api-key", "", "API key of the application")
+	aliasImportCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "List the aliases without recording them")
+	aliasImportCmd.MarkFlagRequired("url")
+	aliasImportCmd.MarkFlagRequired("arr-api-key")
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverURL     string
+	serverToken   string
+	serverPathMap string
+)
+
+// backdateCmd represents the backdate command
+var backdateCmd = &cobra.Command{
+	Use:   "backdate <plex|jellyfin> <dir>...",
+	Short: "Backdate when a media server added the files of a library",
+	Long: `Set the date a Plex or Jellyfin server added the movies and episodes below
+the given directories to the modification time of their files, so that a
+bulk import of an old collection doesn't flood "Recently Added". Hard links
+share the modification time of their source, and copies keep it.
+
+Run this once the server has scanned the imported files. Items it added
+before the modification time of their file are left alone. When the server
+sees the library at another path, e.g. in a container, map the local path
+to the server's with --path-map. Jellyfin 10.9 or later is required.`,
+	Args:      cobra.MinimumNArgs(2),
+	ValidArgs: []string{kourai.ServerPlex, kourai.ServerJellyfin},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var pathMap kourai.PathMap
+		if serverPathMap != "" {
+			m, err := kourai.ParsePathMap(serverPathMap)
+			if err != nil {
+				return fmt.Errorf("--path-map: %w", err)
+			}
+			// Files are keyed by their absolute paths
+			if m.Local, err = filepath.Abs(m.Local); err != nil {
+				return err
+			}
+			pathMap = m
+		}
+
+		added := map[string]time.Time{}
+		for _, dir := range args[1:] {
+			dir, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || !d.Type().IsRegular() {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				added[p] = info.ModTime()
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		n, err := kourai.BackdateAdded(cmd.Context(), args[0], serverURL, serverToken, pathMap, added)
+		fmt.Printf("backdated %d items\n", n)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backdateCmd)
+
+	backdateCmd.Flags().StringVar(&serverURL, "url", "", "Base URL of the media server, e.g. http://localhost:32400")
+	backdateCmd.Flags().StringVar(&serverToken, "token", "", "Plex token or Jellyfin API key")
+	backdateCmd.Flags().StringVar(&serverPathMap, "path-map", "", "Path of the library on this host and on the server, e.g. /mnt/media=/media")
+	backdateCmd.MarkFlagRequired("url")
+	backdateCmd.MarkFlagRequired("token")
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var changelogJSON bool
+
+// writeChangelog updates the snapshot of dest and appends the changes made
+// since snapshot to path, unless nothing changed
+func writeChangelog(dest string, snapshot kourai.Snapshot, path string) error {
+	changes, err := kourai.UpdateSnapshot(dest, snapshot)
+	if err != nil || changes.Empty() {
+		return err
+	}
+	return kourai.AppendChangelog(path, changes)
+}
+
+// changelogCmd represents the changelog command
+var changelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "Print the media added, removed and renamed in the library",
+	Long: `Compare the media files of the destination with the snapshot taken by
+the last changelog, e.g. of "kourai link --changelog", and print what was
+added, removed and renamed since as Markdown, or JSON with --json, e.g. to
+post to a Discord channel. The snapshot is updated, so that the next
+changelog starts from now; the first one only takes the snapshot.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		opts, store, err := pipelineOptions("", nil)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		lease, err := lockDestination(cmd.Context(), dest)
+		if err != nil {
+			return err
+		}
+		defer releaseDestination(lease)
+		snapshot, err := kourai.PreviousSnapshot(dest, opts...)
+		if err != nil {
+			return err
+		}
+		changes, err := kourai.UpdateSnapshot(dest, snapshot)
+		if err != nil {
+			return err
+		}
+		if changelogJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(changes)
+		}
+		return changes.WriteMarkdown(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(changelogCmd)
+
+	changelogCmd.Flags().StringP("dest", "d", "", "Destination directory")
+	changelogCmd.MarkFlagRequired("dest")
+	changelogCmd.Flags().BoolVar(&changelogJSON, "json", false, "Print the changes as JSON")
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var discHint string
+
+// discCmd represents the disc command
+var discCmd = &cobra.Command{
+	Use:   "disc <folder>",
+	Short: "Link the titles ripped from a TV disc as the episodes they are",
+	Long: `Link the titles ripped from a TV disc into a folder, named like
+title_t00.mkv to title_t05.mkv, as the episodes of a season.
+
+The series and season are taken from --hint, e.g. "The Office S02", or else
+from the name of the folder, e.g. "The.Office.S02.D1". The duration of each
+title, given by ffprobe, which must be installed, is matched to the runtimes
+of the episodes of the season on TMDB, keeping the order of the titles;
+titles too short or too long for any episode, e.g. extras or a title playing
+every episode, aren't linked.
+
+With --interactive, the episode of each title is asked for, suggesting the
+one its duration matched.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		dir := args[0]
+		if discHint == "" {
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			discHint = filepath.Base(abs)
+		}
+		hint, err := kourai.ParseDiscHint(discHint)
+		if err != nil {
+			return err
+		}
+		mode, err := kourai.ParseLinkMode(linkMode)
+		if err != nil {
+			return err
+		}
+
+		perms, err := permissionsFromProfile(permissionProfile)
+		if err != nil {
+			return err
+		}
+		opts, store, err := pipelineOptions(key, perms)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		opts = append(opts,
+			kourai.WithDestination(dest),
+			kourai.WithLinkMode(mode),
+			kourai.WithCrossDeviceFallback(crossDevice),
+		)
+
+		titles, episodes, err := kourai.MapDiscTitles(cmd.Context(), dir, hint, opts...)
+		if titles == nil {
+			return err
+		}
+		if err != nil {
+			fmt.Println("encountered error:", err)
+		}
+		if interactive {
+			promptDiscEpisodes(os.Stdin, os.Stdout, titles, episodes)
+		} else {
+			for _, t := range titles {
+				fmt.Println(discTitleLine(t, hint.Season))
+			}
+		}
+
+		links := kourai.DiscLinks(cmd.Context(), titles, hint)
+		if dryRun {
+			for _, l := range links {
+				fmt.Printf("%v\t%v\n", l.Src, l.Target)
+			}
+			return nil
+		}
+		lease, err := lockDestination(cmd.Context(), dest)
+		if err != nil {
+			return err
+		}
+		defer releaseDestination(lease)
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		journal, err := kourai.OpenJournal(filepath.Join(dest, kourai.JournalName))
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+		for _, l := range links {
+			if err := l.Create(); err != nil {
+				if errors.Is(err, kourai.ErrLeaseLost) {
+					return err
+				}
+				fmt.Println(err)
+				continue
+			}
+			if err := journal.Record(string(mode), l); err != nil {
+				fmt.Println("failed to record link in journal:", err)
+			}
+		}
+		return nil
+	},
+}
+
+// discTitleLine describes t and the episode of season it's mapped to
+func discTitleLine(t kourai.DiscTitle, season int) string {
+	line := fmt.Sprintf("%s  %s", filepath.Base(t.Path), t.Duration.Round(time.Second))
+	if t.Episode == 0 {
+		return line + "  not an episode"
+	}
+	return fmt.Sprintf("%s  S%02dE%02d %s (%s)", line, season, t.Episode, t.Name, t.Runtime)
+}
+
+// promptDiscEpisodes asks on out for the episode of each of titles,
+// reading the answers from in. An empty answer keeps the episode its
+// duration matched, 0 links the title as none, and the end of in keeps the
+// matched episodes of the remaining titles.
+func promptDiscEpisodes(in io.Reader, out io.Writer, titles []kourai.DiscTitle, episodes []kourai.DiscEpisode) {
+	fmt.Fprintln(out, "Episodes:")
+	byNumber := map[int]kourai.DiscEpisode{}
+	for _, e := range episodes {
+		byNumber[e.Number] = e
+		fmt.Fprintf(out, "  %2d) %s (%s)\n", e.Number, e.Name, e.Runtime)
+	}
+	r := bufio.NewReader(in)
+	for i := range titles {
+		t := &titles[i]
+		fmt.Fprintf(out, "\n%s  %s\n", filepath.Base(t.Path), t.Duration.Round(time.Second))
+		for {
+			fmt.Fprintf(out, "episode [%d]: ", t.Episode)
+			line, err := r.ReadString('\n')
+			line = strings.TrimSpace(line)
+			if line == "" {
+				if err != nil {
+					return
+				}
+				break
+			}
+			n, convErr := strconv.Atoi(line)
+			if e, ok := byNumber[n]; convErr == nil && (ok || n == 0) {
+				t.Episode, t.Name, t.Runtime = n, e.Name, e.Runtime
+				break
+			}
+			fmt.Fprintln(out, "enter the number of an episode, or 0 for none")
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(discCmd)
+
+	discCmd.Flags().StringP("dest", "d", "", "Destination directory")
+	discCmd.MarkFlagRequired("dest")
+	discCmd.Flags().StringVar(&discHint, "hint", "", "Series and season of the disc, e.g. 'The Office S02'; the folder name by default")
+	discCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Ask for the episode of each title, suggesting the one its duration matched")
+	discCmd.Flags().StringVar(&linkMode, "mode", string(kourai.ModeHardlink), "How targets are created from titles: hardlink, copy or move")
+	discCmd.Flags().BoolVar(&crossDevice, "copy-across-devices", false, "Copy titles that can't be hard linked because the destination is on another filesystem")
+	discCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Run without making any changes to files")
+}
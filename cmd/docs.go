@@ -0,0 +1,101 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// docsCmd represents the docs command
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate documentation",
+	Long: `Generate documentation from the command tree, so that the usage of
+kourai and its help topics can be read offline.`,
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man [dir]",
+	Short: "Generate man pages",
+	Long: `Generate a man page for every command in section 1, and one for every
+help topic in section 7, written to the given directory (default ./man).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "man"
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		header := &doc.GenManHeader{Title: "KOURAI", Section: "1"}
+		if err := doc.GenManTree(rootCmd, header, dir); err != nil {
+			return err
+		}
+
+		for _, t := range helpTopics {
+			name := fmt.Sprintf("%s-%s.7", rootCmd.Name(), t.Name())
+			f, err := os.Create(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			topicHeader := &doc.GenManHeader{Title: "KOURAI", Section: "7"}
+			err = doc.GenMan(t, topicHeader, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var docsTopicsCmd = &cobra.Command{
+	Use:   "topics [dir]",
+	Short: "Generate long-form help topics as markdown",
+	Long: `Generate a markdown document for every help topic. Documents are
+written to the given directory, or to standard output if no directory
+is given.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			for _, t := range helpTopics {
+				if err := doc.GenMarkdown(t, cmd.OutOrStdout()); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		dir := args[0]
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for _, t := range helpTopics {
+			name := fmt.Sprintf("%s_%s.md", rootCmd.Name(), t.Name())
+			f, err := os.Create(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			err = doc.GenMarkdown(t, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(docsCmd)
+	docsCmd.AddCommand(docsManCmd)
+	docsCmd.AddCommand(docsTopicsCmd)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var fsckFix bool
+
+// fsckCmd represents the fsck command
+var fsckCmd = &cobra.Command{
+	Use:   "fsck <dest>",
+	Short: "Check a destination against the naming rules",
+	Long: `Check the entries of a destination against the naming rules, catching
+manual edits that drifted from the layout described in "kourai help naming":
+
+  * entries other than the movies and tv folders at the top level
+  * files outside of movie, series and season folders
+  * years not formatted as "(2001)", or implausible years
+  * season folders not named "Season <N>" or "Specials"
+  * episodes filed in the folder of another season
+  * episode file names not starting with the series folder
+  * empty directories
+
+When target templates are set, only the depth of media files and empty
+directories are checked.
+
+Pass --fix to rename misnamed folders, move misfiled episodes and remove
+empty directories. Other issues are only reported.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dest := args[0]
+		opts, store, err := pipelineOptions("", nil)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		issues, err := kourai.Fsck(dest, opts...)
+		if err != nil {
+			return err
+		}
+		for _, i := range issues {
+			fixable := ""
+			if i.Fixable() {
+				fixable = "\t(fixable)"
+			}
+			fmt.Printf("%v\t%v%v\n", i.Path, i.Problem, fixable)
+		}
+		if !fsckFix {
+			if len(issues) > 0 {
+				return fmt.Errorf("found %d issues", len(issues))
+			}
+			return nil
+		}
+
+		lease, err := lockDestination(cmd.Context(), dest)
+		if err != nil {
+			return err
+		}
+		defer releaseDestination(lease)
+
+		// Deeper entries are fixed first, so that renaming a folder doesn't
+		// invalidate the paths of the issues found inside it
+		var errs []error
+		for n := len(issues) - 1; n >= 0; n-- {
+			i := issues[n]
+			if i.Fix == nil {
+				continue
+			}
+			if err := i.Apply(); err != nil {
+				errs = append(errs, err)
+				if errors.Is(err, kourai.ErrLeaseLost) {
+					break
+				}
+				continue
+			}
+			fmt.Printf("fixed %v\n", i.Path)
+		}
+		if err := kourai.RemoveEmptyDirs(dest); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+
+	fsckCmd.Flags().BoolVar(&fsckFix, "fix", false, "Fix the issues that can be fixed automatically")
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ignoreFor    time.Duration
+	ignoreReason string
+)
+
+// withStateDB runs fn with the state database given by --state, closing it
+// afterwards.
+func withStateDB(fn func(db *kourai.StateDB) error) error {
+	db, err := kourai.OpenStateDB(statePath)
+	if err != nil {
+		return fmt.Errorf("failed to open state database %s with error %w", statePath, err)
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+// ignoreCmd represents the ignore command
+var ignoreCmd = &cobra.Command{
+	Use:   "ignore",
+	Short: "Manage source files that are never linked",
+	Long: `Ignores silence source files that would otherwise be linked, e.g. false
+positive matches, without growing the --exclude patterns of the config file.
+They're kept in the state database, and apply to the commands given the same
+--state, e.g. "kourai link --state". --ignore ignores files for one run.
+
+An ignore is a path when it's absolute or exists, ignoring the file or the
+files below the folder, or else a regular expression matched against file
+and directory names, as --exclude patterns. Ignores may expire, e.g. to
+skip a release until a better one arrives.`,
+}
+
+var ignoreAddCmd = &cobra.Command{
+	Use:   "add <path|pattern>...",
+	Short: "Ignore source files",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ignoreFor < 0 {
+			return fmt.Errorf("invalid --for %s, it must be positive", ignoreFor)
+		}
+		var ignores []kourai.Ignore
+		for _, arg := range args {
+			ig, err := kourai.ParseIgnore(arg)
+			if err != nil {
+				return err
+			}
+			ig.Reason = ignoreReason
+			if ignoreFor > 0 {
+				ig.Expires = time.Now().Add(ignoreFor).UTC()
+			}
+			ignores = append(ignores, ig)
+		}
+		return withStateDB(func(db *kourai.StateDB) error {
+			for _, ig := range ignores {
+				if err := db.AddIgnore(ig); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	},
+}
+
+var ignoreRemoveCmd = &cobra.Command{
+	Use:   "rm <path|pattern>...",
+	Short: "Stop ignoring source files",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStateDB(func(db *kourai.StateDB) error {
+			for _, arg := range args {
+				ig, err := kourai.ParseIgnore(arg)
+				if err != nil {
+					return err
+				}
+				if err := db.RemoveIgnore(ig); err != nil {
+					return fmt.Errorf("failed to remove ignore %s: %w", ig, err)
+				}
+			}
+			return nil
+		})
+	},
+}
+
+var ignoreListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List ignores",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withStateDB(func(db *kourai.StateDB) error {
+			ignores, err := db.Ignores()
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, ig := range ignores {
+				expires := "never"
+				if ig.Expired(now) {
+					expires = "expired"
+				} else if !ig.Expires.IsZero() {
+					expires = ig.Expires.Local().Format(time.DateTime)
+				}
+				fmt.Printf("%s\t%s\t%s\n", ig, expires, ig.Reason)
+			}
+			return nil
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ignoreCmd)
+	ignoreCmd.AddCommand(ignoreAddCmd)
+	ignoreCmd.AddCommand(ignoreRemoveCmd)
+	ignoreCmd.AddCommand(ignoreListCmd)
+
+	ignoreCmd.PersistentFlags().StringVar(&statePath, "state", "", "SQLite database the ignores are kept in, see \"kourai link --state\"")
+	ignoreCmd.MarkPersistentFlagRequired("state")
+	ignoreAddCmd.Flags().DurationVar(&ignoreFor, "for", 0, "Stop ignoring after this long, e.g. 720h, instead of never")
+	ignoreAddCmd.Flags().StringVar(&ignoreReason, "reason", "", "Why the files are ignored, shown by \"kourai ignore list\"")
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var inodesAll bool
+
+// inodesCmd represents the inodes command
+var inodesCmd = &cobra.Command{
+	Use:   "inodes <dir>...",
+	Short: "Report which files share storage through hard links",
+	Long: `Group the files below the given directories by device and inode, and
+list the paths sharing each inode: library entries with their sources, and
+with each other. Pass libraries and source directories together to see
+both sides of each link.
+
+The summary compares the apparent size of all files with the space they
+actually use, counting every inode only once. The link count shows when
+an inode has further links outside of the given directories.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := kourai.NewInodeReport(args...)
+		if err != nil {
+			fmt.Println("encountered error:", err)
+		}
+
+		for _, g := range report.Groups {
+			if len(g.Paths) < 2 && !inodesAll {
+				continue
+			}
+			fmt.Printf("%d:%d\t%s\tlinks %d\n", g.Dev, g.Ino, humanBytes(g.Size), g.Nlink)
+			for _, p := range g.Paths {
+				fmt.Printf("\t%s\n", p)
+			}
+		}
+		fmt.Printf("%d files, %d inodes: %s apparent, %s unique\n",
+			report.Files, len(report.Groups), humanBytes(report.ApparentBytes), humanBytes(report.UniqueBytes))
+		return nil
+	},
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for i := n / unit; i >= unit; i /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	rootCmd.AddCommand(inodesCmd)
+
+	inodesCmd.Flags().BoolVarP(&inodesAll, "all", "a", false, "Also list files that are not linked anywhere else")
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+)
+
+var (
+	lockWait time.Duration
+	lockTTL  time.Duration
+)
+
+// lockDestination acquires the lease on dest, waiting up to --lock-wait for
+// another writer to finish.
+func lockDestination(ctx context.Context, dest string) (*kourai.Lease, error) {
+	if lockTTL <= 0 {
+		return nil, fmt.Errorf("invalid --lock-ttl %s, it must be positive", lockTTL)
+	}
+	ctx, cancel := context.WithTimeout(ctx, lockWait)
+	defer cancel()
+	lease, err := kourai.AcquireLease(ctx, dest, lockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", dest, err)
+	}
+	return lease, nil
+}
+
+// releaseDestination releases lease, reporting whether it was lost during
+// the run, in which case nothing was written to the destination from then
+// on, since another writer may be changing it.
+func releaseDestination(lease *kourai.Lease) {
+	if err := lease.Err(); err != nil {
+		fmt.Println("warning: the destination lock was lost during the run:", err)
+	}
+	if err := lease.Release(); err != nil {
+		fmt.Println("failed to release the destination lock:", err)
+	}
+}
+
+// lockDestinations acquires the leases on the libraries links are created
+// in, the destination and those of the routes, in a fixed order so that
+// runs sharing some of them don't wait on each other. When one can't be
+// acquired, those that were are released.
+func lockDestinations(ctx context.Context) ([]*kourai.Lease, error) {
+	dests := slices.Clone(kourai.Destinations())
+	slices.Sort(dests)
+	leases := []*kourai.Lease{}
+	for _, dest := range dests {
+		lease, err := lockDestination(ctx, dest)
+		if err != nil {
+			releaseDestinations(leases)
+			return nil, err
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// releaseDestinations releases each of leases, see releaseDestination.
+func releaseDestinations(leases []*kourai.Lease) {
+	for _, lease := range leases {
+		releaseDestination(lease)
+	}
+}
@@ -4,21 +4,76 @@ Copyright © 2023 Ryan White
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
 
 	kourai "github.com/alzabo/kourai/pkg"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
 	srcsDefault    []string = []string{"./"}
 	dryRun         bool
 	skipTitleCaser bool
+	checksums      string
+	checksumXattrs bool
+	crossDevice    bool
+	linkMode       string
+	artwork        bool
+	trailers       bool
+	themes         bool
+	collectionSets bool
+	collectionDirs bool
+	nfo            bool
+	nfoRating      string
+	omdbAPIKey     string
+	actorThumbs    bool
+	reportPath     string
+	interactive    bool
+	atomic         bool
+	maxFailures    float64
+	maxIOErrors    int
+	review         bool
+	statePath      string
+	skipLinked     bool
+	verifyLinked   bool
+	metricsPath    string
+	changelogPath  string
+	plexURL        string
+	plexToken      string
+	plexPathMap    string
 )
 
+// linkHooks returns the hooks enabled with --trailers and --themes. The
+// commands are taken from hooks.trailer and hooks.theme in the config file,
+// when set, or default to yt-dlp.
+func linkHooks() (trailer, theme *kourai.Hook, err error) {
+	parse := func(enabled bool, key string, def []string) (*kourai.Hook, error) {
+		if !enabled {
+			return nil, nil
+		}
+		args := viper.GetStringSlice(key)
+		if len(args) == 0 {
+			args = def
+		}
+		return kourai.ParseHook(args)
+	}
+	if trailer, err = parse(trailers, "hooks.trailer", kourai.DefaultTrailerHook); err != nil {
+		return nil, nil, err
+	}
+	theme, err = parse(themes, "hooks.theme", kourai.DefaultThemeHook)
+	return trailer, theme, err
+}
+
 // linkCmd represents the link command
 var linkCmd = &cobra.Command{
 	Use:   "link",
@@ -29,7 +84,7 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		key := cmd.Flags().Lookup("api-key").Value.String()
 		dest := cmd.Flags().Lookup("dest").Value.String()
 
@@ -37,7 +92,7 @@ to quickly create a Cobra application.`,
 		if cpuprofile != "" {
 			f, err := os.Create(cpuprofile)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			pprof.StartCPUProfile(f)
 			defer pprof.StopCPUProfile()
@@ -49,38 +104,377 @@ to quickly create a Cobra application.`,
 			args = srcsDefault
 		}
 
-		linkc, errc := kourai.LinkFromFiles(
+		mode, err := kourai.ParseLinkMode(linkMode)
+		if err != nil {
+			return err
+		}
+
+		perms, err := permissionsFromProfile(permissionProfile)
+		if err != nil {
+			return err
+		}
+
+		if len(finderTags) > 0 && !kourai.FinderTagsSupported {
+			return errors.New("--finder-tags is only supported on macOS")
+		}
+		warnSELinux(dest, perms)
+
+		opts, store, err := pipelineOptions(key, perms)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		trailerHook, themeHook, err := linkHooks()
+		if err != nil {
+			return err
+		}
+		ratings, err := kourai.ParseRatingSource(nfoRating)
+		if err != nil {
+			return err
+		}
+		if nfo && ratings == kourai.RatingIMDb && omdbAPIKey == "" {
+			return errors.New("--omdb-api-key is required for IMDb ratings")
+		}
+		opts = append(opts,
 			kourai.WithDestination(dest),
 			kourai.WithSources(args),
-			kourai.WithFileExtensions(extensions),
-			kourai.WithFileModificationFilter(after, before),
-			kourai.WithExcludePatterns(excludes),
-			kourai.WithTMDBApiKey(key),
-			kourai.WithoutTitleCaseModification(skipTitleCaser),
-			kourai.WithExcludeTypes(excludeMovies, excludeTv),
-			kourai.WithCountryFilter(excludeCountries),
+			kourai.WithCrossDeviceFallback(crossDevice),
+			kourai.WithLinkMode(mode),
+			kourai.WithArtwork(artwork),
+			kourai.WithHooks(trailerHook, themeHook),
+			kourai.WithCollectionSets(collectionSets),
+			kourai.WithCollectionFolders(collectionDirs),
+			kourai.WithNFO(nfo, ratings, omdbAPIKey),
+			kourai.WithActorThumbs(nfo && actorThumbs),
+			kourai.WithStateDB(statePath),
+			kourai.WithSkipLinked(skipLinked || verifyLinked, verifyLinked),
+			kourai.WithMaxIOErrors(maxIOErrors),
 		)
+		if interactive {
+			opts = append(opts, kourai.WithChooser(promptChoice(os.Stdin, os.Stdout)))
+		}
+		var report *kourai.Report
+		var metrics *kourai.Metrics
+		var skipped []func(kourai.SkippedFile)
+		if reportPath != "" {
+			report = kourai.NewReport()
+			skipped = append(skipped, report.Skipped)
+		}
+		if metricsPath != "" {
+			metrics = kourai.NewMetrics("link")
+			skipped = append(skipped, metrics.Skipped)
+		}
+		if len(skipped) > 0 {
+			opts = append(opts, kourai.WithSkipReport(func(s kourai.SkippedFile) {
+				for _, f := range skipped {
+					f(s)
+				}
+			}))
+		}
+		// Metrics are written at the end of runs that got to linking
+		writeMetrics := func(completed bool) {
+			if metrics == nil {
+				return
+			}
+			if err := metrics.WriteTextfile(metricsPath, completed); err != nil {
+				fmt.Println("failed to write metrics:", err)
+			}
+		}
+		if review && dryRun {
+			return errors.New("--review can't be combined with --dry-run")
+		}
+		if maxFailures < 0 || maxFailures > 100 {
+			return errors.New("--max-failures must be a percentage from 0 to 100")
+		}
+		if checksumXattrs && !kourai.XattrsSupported {
+			return errors.New("--checksum-xattrs is not supported on this platform")
+		}
+		linkc, errc := kourai.LinkFromFiles(cmd.Context(), opts...)
 		if err := <-errc; err != nil {
-			fmt.Println("encountered error:", err)
-			os.Exit(1)
+			return err
+		}
+
+		// Routed media are linked into other libraries, which get their own
+		// manifests and leases
+		sums := map[string]*kourai.ChecksumWriter{}
+		if checksums != "" && !dryRun {
+			for _, d := range kourai.Destinations() {
+				w, err := kourai.NewChecksumWriter(d, checksums, checksumXattrs)
+				if err != nil {
+					return err
+				}
+				sums[d] = w
+			}
+		}
+		var journal *kourai.Journal
+		if !dryRun {
+			leases, err := lockDestinations(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer releaseDestinations(leases)
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			if journal, err = kourai.OpenJournal(filepath.Join(dest, kourai.JournalName)); err != nil {
+				return err
+			}
+			defer journal.Close()
+		}
+		var snapshot kourai.Snapshot
+		if changelogPath != "" && !dryRun {
+			var err error
+			if snapshot, err = kourai.PreviousSnapshot(dest); err != nil {
+				return err
+			}
+		}
+		// Artwork, NFOs and collection sets are downloaded by their own
+		// workers, so that creating targets isn't held up by the network
+		decorate := make(chan kourai.Link)
+		var wg sync.WaitGroup
+		for i := 0; i < max(networkWorkers(), 1); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for l := range decorate {
+					if err := l.Artwork(cmd.Context()); err != nil {
+						fmt.Println("failed to place artwork:", err)
+					}
+					if err := l.NFO(cmd.Context()); err != nil {
+						fmt.Println("failed to write NFO:", err)
+					}
+					if err := l.CollectionSet(cmd.Context()); err != nil {
+						fmt.Println("failed to write collection set:", err)
+					}
+				}
+			}()
+		}
+		// Hooks download extras, so they run once all targets are created
+		var enrich []kourai.Link
+		var targets []string
+		created := func(l kourai.Link) {
+			metrics.Created(l)
+			targets = append(targets, l.Target)
+			if w := sums[l.Destination()]; w != nil {
+				if err := w.Add(l); err != nil {
+					fmt.Println("failed to record checksum:", err)
+				}
+			}
+			decorate <- l
+			if trailerHook != nil || themeHook != nil {
+				enrich = append(enrich, l)
+			}
+		}
+		// Once the lock of the destination is lost, another writer may be
+		// changing it, so nothing more is created
+		var lost error
+		create := func(l kourai.Link) {
+			if lost != nil {
+				return
+			}
+			if err := l.Create(); err != nil {
+				fmt.Println(err)
+				metrics.Failed(1)
+				if errors.Is(err, kourai.ErrLeaseLost) {
+					lost = err
+				}
+				return
+			}
+			if err := journal.Record(string(mode), l); err != nil {
+				fmt.Println("failed to record link in journal:", err)
+			}
+			created(l)
 		}
-		//wg := sync.WaitGroup{}
+		// Atomic and reviewed runs plan every link before creating any, and
+		// atomic runs only decorate targets once the run is kept. Runs with
+		// source priorities plan them to drop the duplicates of lower ones.
+		prioritized := kourai.SourcePriorities()
+		var plan []kourai.Link
 		for l := range linkc {
-			l := l
-			//	wg.Add(1)
-			//	go func() {
-			if dryRun {
+			if report != nil {
+				report.Add(l)
+			}
+			metrics.Planned(l)
+			switch {
+			case dryRun && !prioritized:
 				fmt.Printf("%v\t%v\n", l.Src, l.Target)
-			} else {
-				l.Create()
+			case atomic || review || prioritized:
+				plan = append(plan, l)
+			default:
+				create(l)
+			}
+		}
+		// Runs that couldn't read too much of the sources fail, without
+		// creating the links they planned
+		unreadable, ioErr := kourai.IOErrors()
+		if ioErr != nil {
+			plan = nil
+		}
+		if prioritized {
+			var dropped []kourai.Link
+			plan, dropped = kourai.DedupeLinks(plan)
+			for _, l := range dropped {
+				fmt.Printf("skipping %v, another source of %v takes priority\n", l.Src, l.Target)
+			}
+			if dryRun {
+				for _, l := range plan {
+					fmt.Printf("%v\t%v\n", l.Src, l.Target)
+				}
+				plan = nil
+			}
+		}
+		if review {
+			var err error
+			if plan, err = reviewLinks(cmd.Context(), plan); err != nil {
+				fmt.Println(err)
+				plan = nil
+			}
+		}
+		if !atomic {
+			for _, l := range plan {
+				create(l)
+			}
+		} else if !dryRun {
+			links, err := kourai.ApplyAtomic(cmd.Context(), plan, journal, maxFailures/100)
+			metrics.Failed(len(plan) - len(links))
+			if errors.Is(err, kourai.ErrRolledBack) {
+				close(decorate)
+				wg.Wait()
+				writeMetrics(false)
+				return err
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+			for _, l := range links {
+				created(l)
+			}
+		}
+		close(decorate)
+		wg.Wait()
+		kourai.EnrichLinks(cmd.Context(), enrich, networkWorkers(), func(l kourai.Link, err error) {
+			fmt.Println("failed to fetch extras:", err)
+		})
+		if err := cmd.Context().Err(); err != nil {
+			fmt.Println("stopped before all sources were linked:", err)
+		}
+		if len(targets) > 0 {
+			refreshPlex(cmd, targets)
+		}
+		if changelogPath != "" && !dryRun {
+			if err := writeChangelog(dest, snapshot, changelogPath); err != nil {
+				fmt.Println("failed to write changelog:", err)
 			}
-			//wg.Done()
-			//	}()
 		}
-		//wg.Wait()
+		for _, e := range unreadable {
+			fmt.Printf("could not read %v: %v\n", e.Path, e.Err)
+		}
+		writeMetrics(cmd.Context().Err() == nil && ioErr == nil)
+		if report != nil {
+			if err := writeReport(reportPath, report); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+		}
+		if lost != nil {
+			return lost
+		}
+		return ioErr
 	},
 }
 
+// refreshPlex scans the folders of targets on the Plex server of --plex-url,
+// or plex.url in the config file, when set, reporting failures, which don't
+// fail the run
+func refreshPlex(cmd *cobra.Command, targets []string) {
+	if plexURL == "" {
+		plexURL = viper.GetString("plex.url")
+	}
+	if plexURL == "" {
+		return
+	}
+	if plexToken == "" {
+		plexToken = viper.GetString("plex.token")
+	}
+	var pathMap kourai.PathMap
+	if plexPathMap != "" {
+		m, err := kourai.ParsePathMap(plexPathMap)
+		if err != nil {
+			fmt.Println("failed to refresh Plex: --plex-path-map:", err)
+			return
+		}
+		pathMap = m
+	}
+	n, err := kourai.RefreshPlex(cmd.Context(), plexURL, plexToken, pathMap, targets)
+	if err != nil {
+		fmt.Println("failed to refresh Plex:", err)
+		return
+	}
+	logger.Info("refreshed Plex", "folders", n)
+}
+
+// promptChoice returns a chooser asking which candidate is right on out,
+// reading the answer from in. Lookups run concurrently, so prompts are
+// asked one at a time. An empty answer takes the best candidate, 0 none of
+// them, and the end of in takes the best candidate of every later choice.
+func promptChoice(in io.Reader, out io.Writer) func(kourai.Choice) int {
+	var mu sync.Mutex
+	r := bufio.NewReader(in)
+	eof := false
+	return func(c kourai.Choice) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if eof {
+			return 0
+		}
+		query := c.Query
+		if c.Year != 0 {
+			query = fmt.Sprintf("%s (%d)", query, c.Year)
+		}
+		fmt.Fprintf(out, "\n%s\nWhich %s is %q?\n", c.Path, c.Type, query)
+		for i, cand := range c.Candidates {
+			name := cand.Title
+			if cand.Year != 0 {
+				name = fmt.Sprintf("%s (%d)", name, cand.Year)
+			}
+			fmt.Fprintf(out, "  %d) %s  [tmdb-%d, confidence %.2f]\n", i+1, name, cand.TMDBID, cand.Confidence)
+		}
+		fmt.Fprintln(out, "  0) none, keep the name parsed from the path")
+		for {
+			fmt.Fprint(out, "choice [1]: ")
+			line, err := r.ReadString('\n')
+			line = strings.TrimSpace(line)
+			if line == "" {
+				if err != nil {
+					eof = true
+				}
+				return 0
+			}
+			n, convErr := strconv.Atoi(line)
+			if convErr == nil && n >= 0 && n <= len(c.Candidates) {
+				return n - 1
+			}
+			fmt.Fprintf(out, "enter a number from 0 to %d\n", len(c.Candidates))
+			if err != nil {
+				eof = true
+				return 0
+			}
+		}
+	}
+}
+
+// writeReport writes report as HTML to path
+func writeReport(path string, report *kourai.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteHTML(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func init() {
 	rootCmd.AddCommand(linkCmd)
 
@@ -96,5 +490,32 @@ func init() {
 	linkCmd.MarkFlagRequired("dest")
 
 	linkCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Run without making any changes to files")
+	linkCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Ask which TMDB match is right when several match about as well, or the best one is doubtful, and remember the answer as an alias")
+	linkCmd.Flags().StringVar(&plexURL, "plex-url", "", "Scan the folders of the targets created on the Plex server at this URL, e.g. http://localhost:32400, once the run is done; defaults to plex.url in the config file")
+	linkCmd.Flags().StringVar(&plexToken, "plex-token", "", "Plex token with --plex-url, defaults to plex.token in the config file")
+	linkCmd.Flags().StringVar(&plexPathMap, "plex-path-map", "", "Path of the destination on this host and on the Plex server, e.g. /mnt/media=/media")
+	linkCmd.Flags().StringVar(&changelogPath, "changelog", "", "Append the media added, removed and renamed in the destination since the last run to the given file, as Markdown, or JSON lines when it ends in .json or .jsonl")
+	linkCmd.Flags().StringVar(&metricsPath, "metrics-textfile", "", "Write Prometheus metrics of the run to the given file at its end, for the node exporter's textfile collector, e.g. /var/lib/node_exporter/kourai.prom")
+	linkCmd.Flags().StringVar(&reportPath, "report", "", "Write an HTML report of the links, collisions, low-confidence matches and skipped files to the given file, e.g. with --dry-run to review a run")
+	linkCmd.Flags().BoolVar(&review, "review", false, "Review every link on a full-screen list before anything is written, approving, skipping or searching again for each")
+	linkCmd.Flags().BoolVar(&atomic, "atomic", false, "Plan every link before creating any, and roll back all targets of the run if more than --max-failures of them fail")
+	linkCmd.Flags().Float64Var(&maxFailures, "max-failures", 0, "With --atomic, the percentage of links that may fail, e.g. 5, before the run is rolled back")
+	linkCmd.Flags().IntVar(&maxIOErrors, "max-io-errors", -1, "Fail the run, without creating the links left, when more files or directories of the sources than this can't be read, e.g. for lack of permission; -1 for no limit")
+	linkCmd.Flags().StringVar(&statePath, "state", "", "SQLite database of the sources linked, skipped by later runs while they're unchanged and their target exists, e.g. ~/.cache/kourai/sources.db")
+	linkCmd.Flags().BoolVar(&skipLinked, "skip-linked", false, "Skip sources that are hard linked elsewhere, as linked by an earlier run, without looking them up")
+	linkCmd.Flags().BoolVar(&verifyLinked, "verify-linked", false, "Like --skip-linked, but only skip sources with a hard link in the destination, e.g. when a torrent client also links them")
 	linkCmd.Flags().BoolVarP(&skipTitleCaser, "keep-title-case", "k", false, "Don't alter title case")
+	linkCmd.Flags().StringVar(&linkMode, "mode", string(kourai.ModeHardlink), "How targets are created from sources: hardlink, copy (cloned on APFS) or move")
+	linkCmd.Flags().BoolVar(&crossDevice, "copy-across-devices", false, "Copy files that can't be hard linked because the destination is on another filesystem")
+	linkCmd.Flags().BoolVar(&artwork, "artwork", false, "Download posters and fanart from TMDB into movie, series and season folders")
+	linkCmd.Flags().BoolVar(&trailers, "trailers", false, "Download a trailer into each movie folder with yt-dlp, or the hooks.trailer command of the config file")
+	linkCmd.Flags().BoolVar(&themes, "themes", false, "Download theme music into each series folder with yt-dlp, or the hooks.theme command of the config file")
+	linkCmd.Flags().BoolVar(&collectionSets, "collection-sets", false, "Write set.nfo and artwork of the TMDB collections of movies into "+kourai.SetsDir+"/<collection>, for Kodi's movie set information folder")
+	linkCmd.Flags().BoolVar(&collectionDirs, "collection-folders", false, "Nest movies of a TMDB collection under a folder of the collection, e.g. movies/James Bond Collection/Goldfinger (1964)")
+	linkCmd.Flags().BoolVar(&nfo, "nfo", false, "Write a Kodi NFO with the TMDB metadata next to each target, and a tvshow.nfo into each series folder")
+	linkCmd.Flags().StringVar(&nfoRating, "nfo-rating", string(kourai.RatingTMDB), "Rating written to NFOs: tmdb, imdb (needs --omdb-api-key) or none")
+	linkCmd.Flags().BoolVar(&actorThumbs, "actor-thumbs", false, "With --nfo, place cast thumbnails in Kodi "+kourai.ActorsDir+" folders next to movies and in series folders")
+	linkCmd.Flags().StringVar(&omdbAPIKey, "omdb-api-key", "", "OMDb API key, used to look up IMDb ratings")
+	linkCmd.Flags().StringVar(&checksums, "checksums", "", "Write a checksum manifest in each movie and series folder (sha256, xxhash or sfv)")
+	linkCmd.Flags().BoolVar(&checksumXattrs, "checksum-xattrs", false, "With --checksums, also store the checksum of each file in an extended attribute")
 }
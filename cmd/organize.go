@@ -0,0 +1,147 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inPlace  bool
+	undoLast bool
+)
+
+// organizeCmd represents the organize command
+var organizeCmd = &cobra.Command{
+	Use:   "organize <library>",
+	Short: "Move a flat collection of media files into the structured layout",
+	Long: `Move the media files found in a library into the structured layout.
+Files are moved with rename(), so moves are instant but the source and
+destination must be on the same filesystem.
+
+Every move is recorded in a journal kept in the destination directory
+(` + kourai.JournalName + `). Pass --undo to move the files of the most
+recent run back to where they came from, or see "kourai undo".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		library := args[0]
+
+		if inPlace {
+			dest = library
+		}
+		if dest == "" {
+			return errors.New("either --in-place or --dest must be given")
+		}
+		journalPath := filepath.Join(dest, kourai.JournalName)
+
+		if undoLast {
+			lease, err := lockDestination(cmd.Context(), dest)
+			if err != nil {
+				return err
+			}
+			defer releaseDestination(lease)
+			undone, err := kourai.UndoLastRun(journalPath)
+			for _, e := range undone {
+				fmt.Printf("%v\t%v\n", e.Target, e.Src)
+			}
+			return err
+		}
+
+		return organize(cmd, key, library, dest)
+	},
+}
+
+// organize moves the media files found in library into the layout below
+// dest, journaling the moves. Organizing a library into itself removes the
+// directories it leaves empty.
+func organize(cmd *cobra.Command, key, library, dest string) error {
+	perms, err := permissionsFromProfile(permissionProfile)
+	if err != nil {
+		return err
+	}
+
+	if len(finderTags) > 0 && !kourai.FinderTagsSupported {
+		return errors.New("--finder-tags is only supported on macOS")
+	}
+	warnSELinux(dest, perms)
+
+	opts, store, err := pipelineOptions(key, perms)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	opts = append(opts,
+		kourai.WithDestination(dest),
+		kourai.WithSources([]string{library}),
+	)
+	linkc, errc := kourai.LinkFromFiles(cmd.Context(), opts...)
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	// Moves are collected before being applied so the library is not
+	// modified while it is still being walked
+	links := []kourai.Link{}
+	for l := range linkc {
+		links = append(links, l)
+	}
+	// Don't apply a partial scan
+	if err := cmd.Context().Err(); err != nil {
+		return err
+	}
+	if dryRun {
+		for _, l := range links {
+			fmt.Printf("%v\t%v\n", l.Src, l.Target)
+		}
+		return nil
+	}
+
+	leases, err := lockDestinations(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer releaseDestinations(leases)
+	journal, err := kourai.OpenJournal(filepath.Join(dest, kourai.JournalName))
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	for _, l := range links {
+		if err := l.Rename(); err != nil {
+			if errors.Is(err, kourai.ErrLeaseLost) {
+				return err
+			}
+			fmt.Println(err)
+			continue
+		}
+		if err := journal.Record(string(kourai.ModeMove), l); err != nil {
+			fmt.Println("failed to record move in journal:", err)
+		}
+	}
+	if dest == library {
+		if err := kourai.RemoveEmptyDirs(library); err != nil {
+			fmt.Println("encountered error removing empty directories:", err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(organizeCmd)
+
+	organizeCmd.Flags().StringP("dest", "d", "", "Destination directory, on the same filesystem as the library")
+	organizeCmd.Flags().BoolVar(&inPlace, "in-place", false, "Organize the library into itself")
+	organizeCmd.Flags().BoolVar(&undoLast, "undo", false, "Revert the moves made by the most recent run")
+	organizeCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Run without making any changes to files")
+	organizeCmd.Flags().BoolVarP(&skipTitleCaser, "keep-title-case", "k", false, "Don't alter title case")
+	organizeCmd.MarkFlagsMutuallyExclusive("dest", "in-place")
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/viper"
+)
+
+var (
+	permissionProfile string
+	selinuxContext    string
+)
+
+// permissionsFromProfile looks up a permission profile in the config file,
+// e.g.
+//
+//	profiles:
+//	  plex:
+//	    owner: plex
+//	    group: media
+//	    dir_mode: "0775"
+//	    file_mode: "0664"
+//	    setgid: true
+//	    selinux: restorecon
+//
+// The --selinux-context flag takes precedence over the profile's context.
+func permissionsFromProfile(name string) (*kourai.Permissions, error) {
+	if name == "" && selinuxContext == "" {
+		return nil, nil
+	}
+	key := "profiles." + name
+	if name != "" && !viper.IsSet(key) {
+		return nil, fmt.Errorf("permission profile %q is not defined in the config file", name)
+	}
+	perms, err := kourai.NewPermissions(
+		viper.GetString(key+".owner"),
+		viper.GetString(key+".group"),
+		viper.GetString(key+".dir_mode"),
+		viper.GetString(key+".file_mode"),
+		viper.GetBool(key+".setgid"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	perms.SELinuxContext = viper.GetString(key + ".selinux")
+	if selinuxContext != "" {
+		perms.SELinuxContext = selinuxContext
+	}
+	return perms, nil
+}
+
+// warnSELinux points out destinations that media servers won't be able to
+// read under SELinux, unless created files are labeled explicitly.
+func warnSELinux(dest string, perms *kourai.Permissions) {
+	if perms != nil && perms.SELinuxContext != "" {
+		return
+	}
+	if w := kourai.SELinuxWarning(dest); w != "" {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+}
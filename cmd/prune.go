@@ -0,0 +1,63 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var minLinks uint64
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune <dest>",
+	Short: "Remove the targets of deleted sources and empty folders",
+	Long: `Remove the media files of a destination whose sources were deleted, along
+with their subtitles, NFOs and other files named after them, then the
+folders left empty, e.g. Season folders.
+
+A hard link whose source was deleted is the last link to its inode, so
+files with fewer than --min-links links are removed. Raise it when sources
+are also linked elsewhere, e.g. to 3 when seeding from a second folder.
+Only the files the journal records as hard links are considered: targets
+made with --mode copy or move, and files kourai has no record of, are
+never removed.
+
+Their entries are dropped from the journal (` + kourai.JournalName + `). See
+"kourai verify" to review the links before removing anything.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dest := args[0]
+		if minLinks < 1 {
+			return fmt.Errorf("invalid --min-links %d, it must be at least 1", minLinks)
+		}
+		opts, store, err := pipelineOptions("", nil)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if !dryRun {
+			lease, err := lockDestination(cmd.Context(), dest)
+			if err != nil {
+				return err
+			}
+			defer releaseDestination(lease)
+		}
+		pruned, err := kourai.Prune(dest, minLinks, dryRun, opts...)
+		for _, p := range pruned {
+			fmt.Fprintln(cmd.OutOrStdout(), p)
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().Uint64Var(&minLinks, "min-links", 2, "Remove media files with fewer hard links than this")
+	pruneCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "List the files to remove without removing them")
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	qbtURL        string
+	qbtUsername   string
+	qbtPassword   string
+	qbtCategories []string
+	qbtTag        string
+	qbtPathMaps   []string
+)
+
+// qbittorrentCmd represents the qbittorrent command
+var qbittorrentCmd = &cobra.Command{
+	Use:     "qbittorrent",
+	Aliases: []string{"qbt"},
+	Short:   "Link the completed torrents of qBittorrent",
+	Long: `Connect to the Web API of qBittorrent, list its completed torrents,
+optionally only those of --category, and link the media of their content
+paths, as "kourai link" would.
+
+With --tag, torrents whose media were all linked are tagged, e.g. with
+"kourai", and torrents tagged already are skipped, so that repeat runs only
+link new torrents.
+
+When qBittorrent runs in a container or on another host, its paths are
+mapped to local ones with --path-map, given as the local path and that of
+qBittorrent, e.g. /mnt/torrents=/downloads.
+
+The URL, username and password may be set as qbittorrent.url,
+qbittorrent.username and qbittorrent.password in the config file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		for flag, v := range map[string]*string{"url": &qbtURL, "username": &qbtUsername, "password": &qbtPassword} {
+			if *v == "" {
+				*v = viper.GetString("qbittorrent." + flag)
+			}
+		}
+		if qbtURL == "" {
+			return fmt.Errorf("--url or qbittorrent.url in the config file is required")
+		}
+		var pathMaps []kourai.PathMap
+		for _, s := range qbtPathMaps {
+			m, err := kourai.ParsePathMap(s)
+			if err != nil {
+				return err
+			}
+			pathMaps = append(pathMaps, m)
+		}
+		mode, err := kourai.ParseLinkMode(linkMode)
+		if err != nil {
+			return err
+		}
+
+		qbt, err := kourai.NewQBittorrent(cmd.Context(), qbtURL, qbtUsername, qbtPassword, pathMaps)
+		if err != nil {
+			return err
+		}
+		completed, err := qbt.Completed(cmd.Context(), qbtCategories)
+		if err != nil {
+			return err
+		}
+		var torrents []kourai.Torrent
+		for _, t := range completed {
+			if qbtTag == "" || !t.Tagged(qbtTag) {
+				torrents = append(torrents, t)
+			}
+		}
+		logger.Info("found completed torrents", "count", len(completed), "new", len(torrents))
+
+		perms, err := permissionsFromProfile(permissionProfile)
+		if err != nil {
+			return err
+		}
+		opts, store, err := pipelineOptions(key, perms)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		opts = append(opts,
+			kourai.WithDestination(dest),
+			kourai.WithLinkMode(mode),
+			kourai.WithCrossDeviceFallback(crossDevice),
+			kourai.WithStateDB(statePath),
+		)
+		results, err := kourai.LinkTorrents(cmd.Context(), torrents, opts...)
+		if err != nil && len(results) == 0 {
+			return err
+		}
+
+		var journal *kourai.Journal
+		if !dryRun {
+			lease, err := lockDestination(cmd.Context(), dest)
+			if err != nil {
+				return err
+			}
+			defer releaseDestination(lease)
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			if journal, err = kourai.OpenJournal(filepath.Join(dest, kourai.JournalName)); err != nil {
+				return err
+			}
+			defer journal.Close()
+		}
+		var organized []string
+		for _, r := range results {
+			if r.Err != nil {
+				fmt.Printf("failed to link torrent %s: %v\n", r.Torrent.Name, r.Err)
+				continue
+			}
+			ok := true
+			for _, l := range r.Links {
+				if dryRun {
+					fmt.Printf("%v\t%v\n", l.Src, l.Target)
+					continue
+				}
+				if err := l.Create(); err != nil {
+					if errors.Is(err, kourai.ErrLeaseLost) {
+						return err
+					}
+					fmt.Println(err)
+					ok = false
+					continue
+				}
+				fmt.Printf("%v\t%v\n", l.Src, l.Target)
+				if err := journal.Record(string(mode), l); err != nil {
+					fmt.Println("failed to record link in journal:", err)
+				}
+			}
+			if ok {
+				organized = append(organized, r.Torrent.Hash)
+			}
+		}
+		if qbtTag != "" && !dryRun {
+			if err := qbt.AddTags(cmd.Context(), organized, qbtTag); err != nil {
+				return fmt.Errorf("failed to tag organized torrents: %w", err)
+			}
+		}
+		if err != nil {
+			fmt.Println("stopped before all torrents were linked:", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(qbittorrentCmd)
+
+	qbittorrentCmd.Flags().StringP("dest", "d", "", "Destination directory")
+	qbittorrentCmd.MarkFlagRequired("dest")
+	qbittorrentCmd.Flags().StringVar(&qbtURL, "url", "", "URL of the qBittorrent Web UI, e.g. http://localhost:8080")
+	qbittorrentCmd.Flags().StringVar(&qbtUsername, "username", "", "Username of the qBittorrent Web UI")
+	qbittorrentCmd.Flags().StringVar(&qbtPassword, "password", "", "Password of the qBittorrent Web UI")
+	qbittorrentCmd.Flags().StringSliceVar(&qbtCategories, "category", []string{}, "Only link torrents of these categories")
+	qbittorrentCmd.Flags().StringVar(&qbtTag, "tag", "", "Tag torrents whose media were all linked, and skip torrents with the tag")
+	qbittorrentCmd.Flags().StringArrayVar(&qbtPathMaps, "path-map", []string{}, "Path of the downloads on this host and in qBittorrent, e.g. /mnt/torrents=/downloads")
+	qbittorrentCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "List the links without creating them or tagging torrents")
+	qbittorrentCmd.Flags().StringVar(&linkMode, "mode", string(kourai.ModeHardlink), "How targets are created from sources: hardlink, copy (cloned on APFS) or move")
+	qbittorrentCmd.Flags().BoolVar(&crossDevice, "copy-across-devices", false, "Copy files that can't be hard linked because the destination is on another filesystem")
+	qbittorrentCmd.Flags().StringVar(&statePath, "state", "", "SQLite database of the sources linked, see \"kourai link --state\"")
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rematchBelow float64
+	rematchAll   bool
+	rematchYes   bool
+)
+
+// rematchCmd represents the rematch command
+var rematchCmd = &cobra.Command{
+	Use:   "rematch",
+	Short: "Look up the entries of a destination again and rename those that changed",
+	Long: `Look the entries of a destination up again from the names of their sources,
+e.g. after upgrading kourai, and rename those that would now be named
+otherwise, within the destination so that they remain hard links.
+
+Entries are found in the journal (` + kourai.JournalName + `) of the
+destination. Only those matched by a search with a confidence below --below
+are looked up again, or every entry with --all, including those found by ID
+or linked before confidences were journaled.
+
+Each rename is shown as the current name and the new one, and applied once
+approved; answer a to approve the rest, q to stop. --yes approves every
+rename, --dry-run only shows them.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		below := rematchBelow
+		if rematchAll {
+			below = math.Inf(1)
+		}
+
+		perms, err := permissionsFromProfile(permissionProfile)
+		if err != nil {
+			return err
+		}
+		opts, store, err := pipelineOptions(key, perms)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		opts = append(opts, kourai.WithDestination(dest))
+		if !dryRun {
+			lease, err := lockDestination(cmd.Context(), dest)
+			if err != nil {
+				return err
+			}
+			defer releaseDestination(lease)
+		}
+
+		links, err := kourai.Rematch(cmd.Context(), dest, below, opts...)
+		if err != nil {
+			fmt.Println("encountered error:", err)
+		}
+		if dryRun {
+			for _, l := range links {
+				fmt.Printf("%v\t%v\n", l.Src, l.Target)
+			}
+			return nil
+		}
+		if !rematchYes {
+			links = promptRenames(os.Stdin, os.Stdout, links)
+		}
+
+		journal, err := kourai.OpenJournal(filepath.Join(dest, kourai.JournalName))
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+		for _, l := range links {
+			if err := l.Rename(); err != nil {
+				if errors.Is(err, kourai.ErrLeaseLost) {
+					return err
+				}
+				fmt.Println(err)
+				continue
+			}
+			if err := journal.Record(string(kourai.ModeMove), l); err != nil {
+				fmt.Println("failed to record rename in journal:", err)
+			}
+			kourai.RemoveEmptyParents(filepath.Dir(l.Src), dest)
+		}
+		return nil
+	},
+}
+
+// promptRenames shows each rename of links on out and returns those
+// approved, reading the answers from in. The end of in approves nothing
+// more.
+func promptRenames(in io.Reader, out io.Writer, links []kourai.Link) []kourai.Link {
+	r := bufio.NewReader(in)
+	approved := []kourai.Link{}
+	for i, l := range links {
+		fmt.Fprintf(out, "\n- %s\n+ %s\n", l.Src, l.Target)
+		for {
+			fmt.Fprint(out, "rename? [y/N/a/q]: ")
+			line, err := r.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				approved = append(approved, l)
+			case "a", "all":
+				return append(approved, links[i:]...)
+			case "q", "quit":
+				return approved
+			case "", "n", "no":
+			default:
+				fmt.Fprintln(out, "answer y, n, a or q")
+				if err == nil {
+					continue
+				}
+			}
+			if err != nil {
+				return approved
+			}
+			break
+		}
+	}
+	return approved
+}
+
+func init() {
+	rootCmd.AddCommand(rematchCmd)
+
+	rematchCmd.Flags().StringP("dest", "d", "", "Destination directory")
+	rematchCmd.MarkFlagRequired("dest")
+	rematchCmd.Flags().Float64Var(&rematchBelow, "below", 0.8, "Look up entries matched with a confidence below this again, from 0 to 1")
+	rematchCmd.Flags().BoolVar(&rematchAll, "all", false, "Look up every entry again, whatever its confidence")
+	rematchCmd.Flags().BoolVarP(&rematchYes, "yes", "y", false, "Apply every rename without asking")
+	rematchCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Show the renames without applying them")
+}
@@ -0,0 +1,33 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// renameCmd represents the rename command
+var renameCmd = &cobra.Command{
+	Use:   "rename <dir>",
+	Short: "Rename files in place to the canonical layout",
+	Long: `Rename the media files found in a directory to the same layout used by
+the link command, using the directory itself as the destination. Unlike
+link, no separate tree is created: files are moved, and directories left
+empty by the renames are removed. This is "kourai organize --in-place",
+so renames are journaled and can be reverted with "kourai undo".
+
+See "kourai help naming" for the resulting layout.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		return organize(cmd, key, args[0], args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renameCmd)
+
+	renameCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Run without making any changes to files")
+	renameCmd.Flags().BoolVarP(&skipTitleCaser, "keep-title-case", "k", false, "Don't alter title case")
+}
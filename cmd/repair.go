@@ -0,0 +1,102 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var repairTMDBID int
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair <series or movie>",
+	Short: "Fix a movie or series that was matched to the wrong TMDB entry",
+	Long: `Rename every destination entry of a movie or series to the names of the
+TMDB entry with the given ID, in one step. Folders are matched by name, with
+or without the year, e.g. "The Office" matches "tv/The Office (2001)".
+
+Entries are renamed within the destination, so they remain hard links of
+their sources. Pass --no-movies or --no-tv when a title exists as both.
+
+The correction is recorded as an alias of the titles parsed from the
+sources of the entries, as found in the journal of the destination, see
+"kourai alias".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		if repairTMDBID <= 0 {
+			return errors.New("--tmdb-id is required")
+		}
+
+		perms, err := permissionsFromProfile(permissionProfile)
+		if err != nil {
+			return err
+		}
+		opts, store, err := pipelineOptions(key, perms)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		opts = append(opts, kourai.WithDestination(dest))
+		if dryRun {
+			// Corrections are only learned when they're applied
+			opts = append(opts, kourai.WithAliasDB(nil))
+		} else {
+			lease, err := lockDestination(cmd.Context(), dest)
+			if err != nil {
+				return err
+			}
+			defer releaseDestination(lease)
+		}
+
+		links, err := kourai.RepairTitle(cmd.Context(), args[0], repairTMDBID, opts...)
+		if err != nil {
+			fmt.Println("encountered error:", err)
+		}
+		if dryRun {
+			for _, l := range links {
+				fmt.Printf("%v\t%v\n", l.Src, l.Target)
+			}
+			return nil
+		}
+
+		// Renames are journaled so that later repairs can still find the
+		// sources of renamed entries
+		journal, err := kourai.OpenJournal(filepath.Join(dest, kourai.JournalName))
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+		for _, l := range links {
+			if err := l.Rename(); err != nil {
+				if errors.Is(err, kourai.ErrLeaseLost) {
+					return err
+				}
+				fmt.Println(err)
+				continue
+			}
+			if err := journal.Record(string(kourai.ModeMove), l); err != nil {
+				fmt.Println("failed to record rename in journal:", err)
+			}
+			kourai.RemoveEmptyParents(filepath.Dir(l.Src), dest)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+
+	repairCmd.Flags().StringP("dest", "d", "", "Destination directory")
+	repairCmd.MarkFlagRequired("dest")
+	repairCmd.Flags().IntVar(&repairTMDBID, "tmdb-id", 0, "TMDB ID of the correct movie or series")
+	repairCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Run without making any changes to files")
+}
@@ -0,0 +1,263 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// reviewStatus is the decision taken about a pending link
+type reviewStatus int
+
+const (
+	reviewPending reviewStatus = iota
+	reviewApproved
+	reviewSkipped
+)
+
+// errReviewAborted is returned by reviewLinks when the review was quit
+// without applying it
+var errReviewAborted = errors.New("review aborted, nothing was linked")
+
+// reviewItem is a pending link and the decision taken about it
+type reviewItem struct {
+	link   kourai.Link
+	status reviewStatus
+}
+
+// researchedMsg is the result of searching for the media of an item again
+type researchedMsg struct {
+	index int
+	link  kourai.Link
+	err   error
+}
+
+// reviewModel is the review screen of link --review: a list of pending
+// links above the metadata of the selected one, and a prompt while it's
+// searched for again.
+type reviewModel struct {
+	ctx    context.Context
+	items  []reviewItem
+	cursor int
+	height int
+	// query is the search typed by the user, while searching is set
+	query     string
+	searching bool
+	busy      bool
+	message   string
+	applied   bool
+}
+
+func newReviewModel(ctx context.Context, links []kourai.Link) reviewModel {
+	items := make([]reviewItem, len(links))
+	for i, l := range links {
+		items[i] = reviewItem{link: l}
+	}
+	return reviewModel{ctx: ctx, items: items, height: 24}
+}
+
+func (m reviewModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m reviewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case researchedMsg:
+		m.busy = false
+		if msg.err != nil {
+			m.message = msg.err.Error()
+			break
+		}
+		m.items[msg.index] = reviewItem{link: msg.link, status: reviewApproved}
+		m.message = "found " + mediaName(msg.link)
+	case tea.KeyMsg:
+		if m.searching {
+			return m.updateQuery(msg)
+		}
+		return m.updateList(msg)
+	}
+	return m, nil
+}
+
+// updateQuery edits the search for the selected item
+func (m reviewModel) updateQuery(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.searching = false
+	case tea.KeyEnter:
+		m.searching = false
+		if strings.TrimSpace(m.query) == "" {
+			break
+		}
+		m.busy = true
+		m.message = fmt.Sprintf("searching for %q…", m.query)
+		i, l, query, ctx := m.cursor, m.items[m.cursor].link, m.query, m.ctx
+		return m, func() tea.Msg {
+			found, err := l.Research(ctx, query)
+			return researchedMsg{index: i, link: found, err: err}
+		}
+	case tea.KeyBackspace:
+		if r := []rune(m.query); len(r) > 0 {
+			m.query = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.query += string(msg.Runes)
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// updateList moves through the items and decides about them
+func (m reviewModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.message = ""
+	switch msg.String() {
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, len(m.items)-1)
+	case "a":
+		m.decide(reviewApproved)
+	case "s":
+		m.decide(reviewSkipped)
+	case "A":
+		for i := range m.items {
+			if m.items[i].status == reviewPending {
+				m.items[i].status = reviewApproved
+			}
+		}
+	case "/", "r":
+		if m.busy {
+			m.message = "still searching"
+			break
+		}
+		m.searching = true
+		m.query = ""
+	case "w":
+		if m.busy {
+			m.message = "still searching"
+			break
+		}
+		m.applied = true
+		return m, tea.Quit
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// decide sets the status of the selected item and moves to the next one
+func (m *reviewModel) decide(s reviewStatus) {
+	if len(m.items) == 0 {
+		return
+	}
+	m.items[m.cursor].status = s
+	m.cursor = min(m.cursor+1, len(m.items)-1)
+}
+
+// mediaName names the media of l, e.g. "Alien (1979)" or "The Office (2005)
+// S01E01 Pilot"
+func mediaName(l kourai.Link) string {
+	f := kourai.Fields(l.Media())
+	name := f.Title
+	if f.Type == "episode" {
+		name = f.Series
+	}
+	if f.Year != 0 {
+		name = fmt.Sprintf("%s (%d)", name, f.Year)
+	}
+	if f.Type == "episode" {
+		name = strings.TrimSpace(fmt.Sprintf("%s %s %s", name, f.EpisodeID, f.Title))
+	}
+	return name
+}
+
+func (m reviewModel) View() string {
+	var b strings.Builder
+	approved, skipped := 0, 0
+	for _, it := range m.items {
+		switch it.status {
+		case reviewApproved:
+			approved++
+		case reviewSkipped:
+			skipped++
+		}
+	}
+	fmt.Fprintf(&b, "Review %d links: %d approved, %d skipped, %d pending\n\n", len(m.items), approved, skipped, len(m.items)-approved-skipped)
+
+	// The list takes the screen but for the header, details and help
+	rows := max(m.height-12, 3)
+	first := min(max(m.cursor-rows/2, 0), max(len(m.items)-rows, 0))
+	for i := first; i < len(m.items) && i < first+rows; i++ {
+		it := m.items[i]
+		cursor := " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		mark := map[reviewStatus]string{reviewPending: " ", reviewApproved: "✓", reviewSkipped: "✗"}[it.status]
+		fmt.Fprintf(&b, "%s [%s] %s → %s\n", cursor, mark, it.link.Src, it.link.Target)
+	}
+
+	if len(m.items) > 0 {
+		l := m.items[m.cursor].link
+		f := kourai.Fields(l.Media())
+		confidence := "not searched"
+		if c := kourai.Confidence(l.Media()); c > 0 {
+			confidence = fmt.Sprintf("%.2f", c)
+		}
+		tmdbID := "unknown"
+		if f.TMDBID != 0 {
+			tmdbID = fmt.Sprint(f.TMDBID)
+		}
+		fmt.Fprintf(&b, "\n%s: %s\n", f.Type, mediaName(l))
+		fmt.Fprintf(&b, "TMDB ID %s, confidence %s", tmdbID, confidence)
+		if f.Quality != "" {
+			fmt.Fprintf(&b, ", %s", f.Quality)
+		}
+		if f.Edition != "" {
+			fmt.Fprintf(&b, ", %s", f.Edition)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	switch {
+	case m.searching:
+		fmt.Fprintf(&b, "search for: %s█\n(enter to search, esc to cancel)", m.query)
+	default:
+		if m.message != "" {
+			b.WriteString(m.message + "\n")
+		}
+		b.WriteString("a approve  s skip  A approve the rest  / search again  w write approved  q quit")
+	}
+	return b.String()
+}
+
+// reviewLinks shows links on the review screen and returns those approved,
+// in the order given, or errReviewAborted when the review was quit.
+func reviewLinks(ctx context.Context, links []kourai.Link) ([]kourai.Link, error) {
+	final, err := tea.NewProgram(newReviewModel(ctx, links), tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	if err != nil {
+		return nil, err
+	}
+	m := final.(reviewModel)
+	if !m.applied {
+		return nil, errReviewAborted
+	}
+	approved := []kourai.Link{}
+	for _, it := range m.items {
+		if it.status == reviewApproved {
+			approved = append(approved, it.link)
+		}
+	}
+	return approved, nil
+}
@@ -4,25 +4,80 @@ Copyright © 2023 Ryan White
 package cmd
 
 import (
+	"context"
 	goflag "flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
 	"time"
 
+	kourai "github.com/alzabo/kourai/pkg"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/text/language"
 )
 
 var (
 	cfgFile           string
 	extensions        []string
 	extensionsDefault []string = []string{"avi", "mkv", "mp4"}
+	extensionPolicies []string
 	excludes          []string
+	ignores           []string
 	before            *time.Time
 	after             *time.Time
 	excludeTv         bool
 	excludeMovies     bool
 	excludeCountries  []string
+	excludeCompanies  []string
+	includeCompanies  []string
+	excludeNetworks   []string
+	includeNetworks   []string
+	routes            []string
+	titleExceptions   []string
+	sourcePriority    []string
+	skipWatched       string
+	watchedURL        string
+	watchedToken      string
+	traktClientID     string
+	finderTags        []string
+	episodePadding    int
+	only              []string
+	storeURI          string
+	cacheTTL          time.Duration
+	noCache           bool
+	movieTemplate     string
+	episodeTemplate   string
+	logLevel          string
+	logFormat         string
+	logger            *slog.Logger
+	concurrency       int
+	ioConcurrency     int
+	settleTime        time.Duration
+	minConfidence     float64
+	sharded           bool
+	skipUnsure        bool
+	netConcurrency    int
+	rateLimit         string
+	copyRate          string
+	downloadRate      string
+	lowPriority       bool
+	provider          string
+	readNFO           bool
+	subtitles         bool
+	tvdbAPIKey        string
+	tvdbPIN           string
+	tmdbRetries       int
+	tmdbBackoff       time.Duration
+	tmdbJitter        float64
+	tmdbSearchPages   int
+	metadataLanguage  string
+	minSize           string
+	targetCase        string
+	probe             bool
+	keepFileYear      bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -38,12 +93,46 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := initLogger(); err != nil {
+			return err
+		}
+		if lowPriority {
+			if err := kourai.LowerPriority(); err != nil {
+				logger.Warn("failed to lower the priority", "error", err)
+			}
+		}
+		return nil
+	},
+}
+
+// initLogger sets up the logger given by --log-level and --log-format. Logs
+// are written to stderr, leaving stdout to the output of commands.
+func initLogger() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", logLevel)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch logFormat {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(os.Stderr, opts))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", logFormat)
+	}
+	slog.SetDefault(logger)
+	return nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// An interrupt cancels the command's context, stopping scans and lookups.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
@@ -68,6 +157,215 @@ func timeFlagHelper(v string) (*time.Time, error) {
 	return &t, err
 }
 
+// networkWorkers returns the number of workers of network bound work
+func networkWorkers() int {
+	if netConcurrency > 0 {
+		return netConcurrency
+	}
+	return concurrency
+}
+
+// pipelineOptions returns the options shared by every command that parses
+// and names media, configured from the persistent flags, and the store they
+// use, which the caller closes when it's done.
+func pipelineOptions(key string, perms *kourai.Permissions) ([]kourai.Option, kourai.Store, error) {
+	selectors := []kourai.Selector{}
+	for _, o := range only {
+		s, err := kourai.ParseSelector(o)
+		if err != nil {
+			return nil, nil, err
+		}
+		selectors = append(selectors, s)
+	}
+	if metadataLanguage != "" {
+		if _, err := language.Parse(metadataLanguage); err != nil {
+			return nil, nil, fmt.Errorf("invalid --language %q: %w", metadataLanguage, err)
+		}
+	}
+
+	var rates [3]int64
+	for i, flag := range [...]struct{ name, value string }{{"rate-limit", rateLimit}, {"copy-rate", copyRate}, {"download-rate", downloadRate}} {
+		r, err := kourai.ParseRate(flag.value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--%s: %w", flag.name, err)
+		}
+		rates[i] = r
+	}
+	minFileSize, err := kourai.ParseSize(minSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("--min-size: %w", err)
+	}
+	casePolicy, err := kourai.ParseCasePolicy(targetCase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("--target-case: %w", err)
+	}
+
+	// Routes are taken from the config file unless given as flags
+	routeFlags := routes
+	if len(routeFlags) == 0 {
+		routeFlags = viper.GetStringSlice("routes")
+	}
+	var libraries []kourai.Route
+	for _, r := range routeFlags {
+		route, err := kourai.ParseRoute(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		libraries = append(libraries, route)
+	}
+
+	// Source priorities are taken from the config file unless given as flags
+	priorities := sourcePriority
+	if len(priorities) == 0 {
+		priorities = viper.GetStringSlice("source_priority")
+	}
+
+	// Extension policies of the config file are overridden by those given
+	// as flags
+	policies := map[string]kourai.ExtensionPolicy{}
+	for _, p := range append(viper.GetStringSlice("extension_policies"), extensionPolicies...) {
+		parsed, err := kourai.ParseExtensionPolicy(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--extension-policy: %w", err)
+		}
+		for ext, policy := range parsed {
+			policies[ext] = policy
+		}
+	}
+
+	var runIgnores []kourai.Ignore
+	for _, i := range ignores {
+		ig, err := kourai.ParseIgnore(i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--ignore: %w", err)
+		}
+		runIgnores = append(runIgnores, ig)
+	}
+
+	// Title exceptions of the config file are added to those given as flags
+	exceptions := append(slices.Clone(titleExceptions), viper.GetStringSlice("title_exceptions")...)
+
+	var metadataProvider kourai.MetadataProvider
+	var localProviders []kourai.LocalProvider
+	if readNFO {
+		localProviders = append(localProviders, kourai.NFOProvider{})
+	}
+	switch provider {
+	case kourai.ProviderTMDB:
+	case kourai.ProviderTVDB:
+		if tvdbAPIKey == "" {
+			return nil, nil, fmt.Errorf("--tvdb-api-key is required with --provider %s", provider)
+		}
+		metadataProvider = kourai.NewTVDBProvider(tvdbAPIKey, tvdbPIN)
+	default:
+		return nil, nil, fmt.Errorf("unsupported provider %q, expected %s or %s", provider, kourai.ProviderTMDB, kourai.ProviderTVDB)
+	}
+
+	var history *kourai.WatchHistory
+	if skipWatched != "" {
+		var err error
+		history, err = kourai.FetchWatchHistory(rootCmd.Context(), skipWatched, watchedURL, watchedToken, traktClientID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch the watch history: %w", err)
+		}
+		movies, episodes := history.Len()
+		logger.Info("skipping watched media", "source", skipWatched, "movies", movies, "episodes", episodes)
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	aliases, err := openAliasDB(store)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+
+	// Flags take precedence over the templates section of the config file
+	templates := map[string]*kourai.TargetTemplate{}
+	for kind, flag := range map[string]string{"movie": movieTemplate, "episode": episodeTemplate} {
+		if flag == "" {
+			flag = viper.GetString("templates." + kind)
+		}
+		if flag == "" {
+			continue
+		}
+		t, err := kourai.ParseTargetTemplate(flag)
+		if err != nil {
+			store.Close()
+			return nil, nil, fmt.Errorf("%s %w", kind, err)
+		}
+		templates[kind] = t
+	}
+
+	cache := store
+	if noCache {
+		cache = nil
+	}
+
+	opts := []kourai.Option{
+		kourai.WithFileExtensions(extensions),
+		kourai.WithExtensionPolicies(policies),
+		kourai.WithFileModificationFilter(after, before),
+		kourai.WithExcludePatterns(excludes),
+		kourai.WithMinFileSize(minFileSize),
+		kourai.WithProbe(probe),
+		kourai.WithFileYear(keepFileYear),
+		kourai.WithSubtitles(subtitles),
+		kourai.WithIgnores(runIgnores),
+		kourai.WithTMDBApiKey(key),
+		kourai.WithMetadataProvider(metadataProvider),
+		kourai.WithLocalProviders(localProviders...),
+		kourai.WithMetadataLanguage(metadataLanguage),
+		kourai.WithoutTitleCaseModification(skipTitleCaser),
+		kourai.WithTitleExceptions(exceptions),
+		kourai.WithExcludeTypes(excludeMovies, excludeTv),
+		kourai.WithCountryFilter(excludeCountries),
+		kourai.WithCompanyFilter(excludeCompanies, includeCompanies),
+		kourai.WithNetworkFilter(excludeNetworks, includeNetworks),
+		kourai.WithRoutes(libraries),
+		kourai.WithSourcePriority(priorities),
+		kourai.WithWatchHistory(history),
+		kourai.WithPermissions(perms),
+		kourai.WithFinderTags(finderTags),
+		kourai.WithEpisodePadding(episodePadding),
+		kourai.WithOnly(selectors),
+		kourai.WithAliasDB(aliases),
+		kourai.WithStore(cache, cacheTTL),
+		kourai.WithTargetTemplates(templates["movie"], templates["episode"]),
+		kourai.WithShardedLayout(sharded),
+		kourai.WithTargetCase(casePolicy),
+		kourai.WithLogger(logger),
+		kourai.WithConcurrency(concurrency),
+		kourai.WithIOConcurrency(ioConcurrency),
+		kourai.WithSettleTime(settleTime),
+		kourai.WithMinConfidence(minConfidence, skipUnsure),
+		kourai.WithNetworkConcurrency(netConcurrency),
+		kourai.WithBandwidth(rates[0], rates[1], rates[2]),
+		kourai.WithLowPriority(lowPriority),
+		kourai.WithTMDBRetries(tmdbRetries, tmdbBackoff, tmdbJitter),
+		kourai.WithTMDBSearchPages(tmdbSearchPages),
+	}
+	return opts, store, nil
+}
+
+// openStore opens the store given by --store, or the SQLite database in the
+// user's cache directory. Without a cache directory, e.g. when HOME isn't
+// set, state is only kept for the run.
+func openStore() (kourai.Store, error) {
+	uri := storeURI
+	if uri == "" {
+		path, err := kourai.DefaultStorePath()
+		if err != nil {
+			slog.Warn("no cache directory, aliases and TMDB responses are only kept for this run", "error", err)
+			return kourai.NewMemoryStore(), nil
+		}
+		uri = "sqlite:" + path
+	}
+	return kourai.OpenStore(uri)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -92,11 +390,64 @@ func init() {
 	rootCmd.PersistentFlags().String("cpuprofile", "", "Write CPU profile to file")
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.kourai.yaml)")
 	rootCmd.PersistentFlags().StringSliceVarP(&extensions, "extensions", "e", extensionsDefault, "File extensions to consider (case-insensitive)")
+	rootCmd.PersistentFlags().StringArrayVar(&extensionPolicies, "extension-policy", []string{}, "Handle files by extension instead of by --extensions, e.g. 'iso=link' to link disc images whole, 'ts,m2ts=episode' to link them only as episodes, or 'flac,mp3=ignore'; policies are link, episode, skip (reported) and ignore")
 	rootCmd.PersistentFlags().StringSliceVarP(&excludes, "exclude", "x", []string{}, "Patterns to Exclude")
+	rootCmd.PersistentFlags().StringVar(&minSize, "min-size", "", "Exclude files smaller than the given size, e.g. 100MB, such as samples that aren't named sample")
+	rootCmd.PersistentFlags().BoolVar(&probe, "probe", false, "Probe the duration, resolution and codecs of videos with ffprobe, skipping corrupt ones, for templates and selectors, see \"kourai help filters\"")
+	rootCmd.PersistentFlags().StringArrayVar(&ignores, "ignore", []string{}, "Ignore a source path, or names matching a pattern, for this run, see \"kourai ignore\"")
+	rootCmd.PersistentFlags().StringArrayVar(&only, "only", []string{}, "Only process media matching a selector, e.g. 'series=Breaking Bad' or 'title~=Dune'")
 	rootCmd.PersistentFlags().StringSliceVar(&excludeCountries, "exclude-countries", []string{}, "Origin countries to Exclude")
+	rootCmd.PersistentFlags().StringArrayVar(&routes, "route", []string{}, "Link media released in the given decades into another library, e.g. '-1960s=/media/classics' or '1980s-1990s=/media/retro'; the first matching route applies")
+	rootCmd.PersistentFlags().StringSliceVar(&sourcePriority, "source-priority", []string{}, "Source directories by priority, e.g. /data/remux,/data/web; of media with the same target, that of the earliest is linked, whatever its quality")
+	rootCmd.PersistentFlags().StringVar(&skipWatched, "skip-watched", "", "Skip media already watched according to the history of a Plex server (plex) or Trakt user (trakt)")
+	rootCmd.PersistentFlags().StringVar(&watchedURL, "watched-url", "", "URL of the Plex server with --skip-watched plex")
+	rootCmd.PersistentFlags().StringVar(&watchedToken, "watched-token", "", "Plex token, or Trakt OAuth access token, with --skip-watched")
+	rootCmd.PersistentFlags().StringVar(&traktClientID, "trakt-client-id", "", "Client ID of the Trakt app, with --skip-watched trakt")
+	rootCmd.PersistentFlags().StringArrayVar(&excludeCompanies, "exclude-company", []string{}, "Exclude media made by a TMDB production company, given by name or TMDB ID")
+	rootCmd.PersistentFlags().StringArrayVar(&includeCompanies, "include-company", []string{}, "Only include media made by a TMDB production company, given by name or TMDB ID")
+	rootCmd.PersistentFlags().StringArrayVar(&excludeNetworks, "exclude-network", []string{}, "Exclude series aired by a TV network, given by name or TMDB ID")
+	rootCmd.PersistentFlags().StringArrayVar(&includeNetworks, "include-network", []string{}, "Only include series aired by a TV network, given by name or TMDB ID; movies are kept")
 	rootCmd.PersistentFlags().String("api-key", "", "TMDB API Key")
+	rootCmd.PersistentFlags().Float64Var(&minConfidence, "min-confidence", 0, "Reject search results matching media with a confidence below this, from 0 to 1, e.g. 0.6; rejected media keep the names parsed from their paths")
+	rootCmd.PersistentFlags().BoolVar(&skipUnsure, "skip-unsure", false, "Skip media whose search results were rejected by --min-confidence instead of linking them")
+	rootCmd.PersistentFlags().StringVar(&provider, "provider", kourai.ProviderTMDB, "Provider media is named after: tmdb, or tvdb (needs --tvdb-api-key); artwork and NFOs still come from TMDB")
+	rootCmd.PersistentFlags().BoolVar(&subtitles, "subtitles", false, "Also link the subtitles next to each video and named after it, e.g. Heat.1995.en.srt, keeping their language and forced suffixes")
+	rootCmd.PersistentFlags().BoolVar(&readNFO, "read-nfo", true, "Name media after the Kodi NFOs next to them, e.g. movie.nfo or tvshow.nfo, before looking them up online")
+	rootCmd.PersistentFlags().StringVar(&tvdbAPIKey, "tvdb-api-key", "", "TheTVDB project API key")
+	rootCmd.PersistentFlags().StringVar(&tvdbPIN, "tvdb-pin", "", "TheTVDB subscriber PIN, for user-supported API keys")
 	rootCmd.PersistentFlags().BoolVar(&excludeTv, "no-tv", false, "Exclude TV files and results")
 	rootCmd.PersistentFlags().BoolVar(&excludeMovies, "no-movies", false, "Exclude Movie files and results")
+	rootCmd.PersistentFlags().StringArrayVar(&titleExceptions, "title-exception", []string{}, "Word written as given in titles parsed from paths, e.g. 'ALF' or 'DuckTales', in addition to known acronyms and roman numerals")
+	rootCmd.PersistentFlags().IntVar(&episodePadding, "episode-padding", 2, "Minimum number of digits in episode numbers, e.g. 3 for S01E007")
+	rootCmd.PersistentFlags().StringVar(&aliasDBPath, "aliases", "", "Alias database file, instead of keeping aliases in the store")
+	rootCmd.PersistentFlags().StringVar(&movieTemplate, "movie-template", "", "Template of movie targets, see \"kourai help naming\"")
+	rootCmd.PersistentFlags().StringVar(&episodeTemplate, "episode-template", "", "Template of episode targets, see \"kourai help naming\"")
+	rootCmd.PersistentFlags().BoolVar(&sharded, "shard", false, "File movie and series folders under a folder of their first letter, e.g. movies/A/Alien (1979), see \"kourai help naming\"")
+	rootCmd.PersistentFlags().BoolVar(&keepFileYear, "keep-file-year", false, "Keep the year of movie names one year off the release year of their match, e.g. of a festival premiere, rather than correcting it")
+	rootCmd.PersistentFlags().StringVar(&targetCase, "target-case", string(kourai.CasePreserve), "Case of target paths: preserve, lower (e.g. for rclone crypt remotes) or upper, see \"kourai help naming\"")
+	rootCmd.PersistentFlags().DurationVar(&lockWait, "lock-wait", 0, "How long to wait for another writer to release the destination")
+	rootCmd.PersistentFlags().DurationVar(&lockTTL, "lock-ttl", 2*time.Minute, "Time after which the destination lock of a writer that stopped is taken over")
+	rootCmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "j", 8, "Number of files processed, looked up on TMDB, or enriched by hooks at the same time")
+	rootCmd.PersistentFlags().DurationVar(&settleTime, "settle", 0, "Only link files whose size and modification time are unchanged for this long, e.g. 30s, skipping files still being unpacked or transferred")
+	rootCmd.PersistentFlags().IntVar(&ioConcurrency, "io-concurrency", 0, "Number of files filtered and parsed at the same time, bound by the disks; 0 uses --concurrency")
+	rootCmd.PersistentFlags().IntVar(&netConcurrency, "network-concurrency", 0, "Number of files looked up on TMDB, given artwork and NFOs, or enriched by hooks at the same time; 0 uses --concurrency")
+	rootCmd.PersistentFlags().IntVar(&tmdbRetries, "tmdb-retries", 5, "Attempts of TMDB requests that were rate limited or failed with a server error")
+	rootCmd.PersistentFlags().DurationVar(&tmdbBackoff, "tmdb-backoff", time.Second, "Delay before retrying a TMDB request, doubled after each attempt, unless TMDB says how long to wait")
+	rootCmd.PersistentFlags().Float64Var(&tmdbJitter, "tmdb-jitter", 0.5, "Largest fraction of the delay before retrying a TMDB request added to it at random, from 0 to 1")
+	rootCmd.PersistentFlags().IntVar(&tmdbSearchPages, "tmdb-search-pages", 0, "Pages of TMDB search results, of 20 each, matched against; 0 reads all of them")
+	rootCmd.PersistentFlags().StringVar(&rateLimit, "rate-limit", "", "Bandwidth of copies and artwork downloads combined, e.g. 50MB/s or 5MiB/s; unlimited by default")
+	rootCmd.PersistentFlags().StringVar(&copyRate, "copy-rate", "", "Bandwidth of copies, including moves across filesystems, e.g. 50MB/s")
+	rootCmd.PersistentFlags().StringVar(&downloadRate, "download-rate", "", "Bandwidth of artwork downloads, e.g. 5MB/s")
+	rootCmd.PersistentFlags().BoolVar(&lowPriority, "low-priority", false, "Run at the lowest CPU and, on Linux, idle disk priority, parse files one at a time and copy at up to 50MB/s unless --copy-rate or --rate-limit is given")
+	rootCmd.PersistentFlags().StringVar(&metadataLanguage, "language", "", "Language of titles looked up on TMDB, e.g. de-DE; untranslated titles keep their original language")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Minimum level of logged messages: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of logged messages: text or json")
+	rootCmd.PersistentFlags().StringVar(&storeURI, "store", "", "Store for aliases and cached TMDB responses: memory, sqlite:<path>, postgres://<host>/<db> or redis://<host>/<db> to share state between machines, or dir:<path> (default is kourai/state.db in the user cache directory)")
+	rootCmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", 7*24*time.Hour, "How long cached TMDB responses are used, or 0 to keep them")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Don't read or write cached TMDB responses")
+	rootCmd.PersistentFlags().StringVar(&permissionProfile, "profile", "", "Permission profile from the config file applied to created files and directories")
+	rootCmd.PersistentFlags().StringSliceVar(&finderTags, "finder-tags", []string{}, "Finder tags applied to created files (macOS only)")
+	rootCmd.PersistentFlags().StringVar(&selinuxContext, "selinux-context", "", "SELinux context for created files and directories, or \"restorecon\" to apply the policy default")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInitLogger(t *testing.T) {
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	defer func(level, format string) { logLevel, logFormat = level, format }(logLevel, logFormat)
+
+	tests := []struct {
+		level   string
+		format  string
+		handler string
+		enabled []slog.Level
+		err     bool
+	}{
+		{"info", "text", "*slog.TextHandler", []slog.Level{slog.LevelInfo, slog.LevelWarn, slog.LevelError}, false},
+		{"debug", "json", "*slog.JSONHandler", []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}, false},
+		{"WARN", "text", "*slog.TextHandler", []slog.Level{slog.LevelWarn, slog.LevelError}, false},
+		{"error", "json", "*slog.JSONHandler", []slog.Level{slog.LevelError}, false},
+		{"verbose", "text", "", nil, true},
+		{"info", "xml", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level+"/"+tt.format, func(t *testing.T) {
+			logger = nil
+			logLevel, logFormat = tt.level, tt.format
+			err := initLogger()
+			if (err != nil) != tt.err {
+				t.Fatalf("initLogger() returned %v, want error %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			if got := fmt.Sprintf("%T", logger.Handler()); got != tt.handler {
+				t.Errorf("handler = %s, want %s", got, tt.handler)
+			}
+			if slog.Default() != logger {
+				t.Error("the logger was not made the default")
+			}
+			var enabled []slog.Level
+			for _, l := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+				if logger.Enabled(context.Background(), l) {
+					enabled = append(enabled, l)
+				}
+			}
+			if diff := cmp.Diff(tt.enabled, enabled); diff != "" {
+				t.Errorf("enabled levels mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOpenStoreWithoutCacheDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the cache directory is only derived from the environment on Linux")
+	}
+	defer func(uri string) { storeURI = uri }(storeURI)
+	storeURI = ""
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("HOME", "")
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatalf("openStore() without a cache directory returned %v", err)
+	}
+	defer store.Close()
+	if _, ok := store.(*kourai.MemoryStore); !ok {
+		t.Errorf("openStore() without a cache directory returned a %T, want a memory store", store)
+	}
+}
+
+func TestPromptChoice(t *testing.T) {
+	c := kourai.Choice{
+		Path:  "/dl/Crash.mkv",
+		Type:  kourai.AliasMovie,
+		Query: "Crash",
+		Candidates: []kourai.Candidate{
+			{Title: "Crash", Year: 2004, TMDBID: 1, Confidence: 0.8},
+			{Title: "Crash", Year: 1996, TMDBID: 2, Confidence: 0.79},
+		},
+	}
+	var out strings.Builder
+	choose := promptChoice(strings.NewReader("7\n2\n\n0\n"), &out)
+	for _, want := range []int{1, 0, -1, 0} {
+		if got := choose(c); got != want {
+			t.Errorf("promptChoice() = %d, want %d", got, want)
+		}
+	}
+	if !strings.Contains(out.String(), "2) Crash (1996)  [tmdb-2, confidence 0.79]") || !strings.Contains(out.String(), "enter a number from 0 to 2") {
+		t.Errorf("promptChoice() wrote:\n%s", out.String())
+	}
+}
+
+func TestReviewModel(t *testing.T) {
+	links := []kourai.Link{
+		{Src: "/dl/a.mkv", Target: "/lib/movies/A (2001)/a.mkv"},
+		{Src: "/dl/b.mkv", Target: "/lib/movies/B (2002)/b.mkv"},
+		{Src: "/dl/c.mkv", Target: "/lib/movies/C (2003)/c.mkv"},
+	}
+	var m tea.Model = newReviewModel(context.Background(), links)
+	for _, k := range []string{"a", "s", "j", "k", "/", "x", "q"} {
+		// Typing a search doesn't decide about the item
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("w")})
+	if cmd == nil {
+		t.Fatal("w didn't quit the review")
+	}
+	rm := m.(reviewModel)
+	got := []reviewStatus{}
+	for _, it := range rm.items {
+		got = append(got, it.status)
+	}
+	if diff := cmp.Diff([]reviewStatus{reviewApproved, reviewSkipped, reviewPending}, got); diff != "" || !rm.applied {
+		t.Errorf("review statuses mismatch, applied %v (-want +got):\n%s", rm.applied, diff)
+	}
+	if v := rm.View(); !strings.Contains(v, "1 approved, 1 skipped, 1 pending") {
+		t.Errorf("View() = %s", v)
+	}
+}
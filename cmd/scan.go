@@ -0,0 +1,134 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var scanJSON string
+
+// scanCmd represents the scan command
+var scanCmd = &cobra.Command{
+	Use:   "scan [sources...]",
+	Short: "Report how the media files of sources would be identified",
+	Long: `Walk the sources, parse and look up every media file as link would, and
+report the movies and episodes identified, the files that weren't matched
+by TMDB or only doubtfully, and the files that would be skipped, with the
+reason. Nothing is linked and no destination is needed, so a scan is safe
+to run on any collection before linking it.
+
+Files having the same target as another are reported as skipped
+duplicates, but for the first of them by path.
+
+Pass --json to write the report as JSON instead, to a file or to standard
+output with "-". Each file is an object with its path, type, the names it
+was identified by, the target it would be linked to relative to the
+destination, whether it was matched, and why not. Two codes let scripts
+triage files without parsing reasons: matched_by is how a matched file was
+found, one of tmdb-search, id-tag, nfo or cache (an alias), and
+skipped_because why a file would be skipped, e.g. extension, regexp,
+duplicate or low-confidence. Movies whose year was corrected to the
+release year of their match have the year of their name as file_year.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		if len(args) == 0 {
+			args = srcsDefault
+		}
+		opts, store, err := pipelineOptions(key, nil)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		opts = append(opts, kourai.WithSources(args))
+
+		resultc, errc := kourai.Scan(cmd.Context(), opts...)
+		if err := <-errc; err != nil {
+			return err
+		}
+		results := []kourai.ScanResult{}
+		for r := range resultc {
+			results = append(results, r)
+		}
+		sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+		kourai.MarkDuplicates(results)
+		if err := cmd.Context().Err(); err != nil {
+			return fmt.Errorf("stopped before all sources were scanned: %w", err)
+		}
+
+		switch scanJSON {
+		case "":
+			writeScan(cmd.OutOrStdout(), results)
+			return nil
+		case "-":
+			return writeScanJSON(cmd.OutOrStdout(), results)
+		}
+		f, err := os.Create(scanJSON)
+		if err != nil {
+			return err
+		}
+		if err := writeScanJSON(f, results); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	},
+}
+
+// writeScan writes results as text, in sections of movies, episodes,
+// unmatched and skipped files
+func writeScan(w io.Writer, results []kourai.ScanResult) {
+	var movies, episodes, unmatched, skipped []kourai.ScanResult
+	for _, r := range results {
+		switch {
+		case r.SkippedBecause != "" || r.Type == "":
+			skipped = append(skipped, r)
+		case !r.Matched:
+			unmatched = append(unmatched, r)
+		case r.Type == "movie":
+			movies = append(movies, r)
+		default:
+			episodes = append(episodes, r)
+		}
+	}
+	fmt.Fprintf(w, "%d movies, %d episodes, %d unmatched, %d skipped\n", len(movies), len(episodes), len(unmatched), len(skipped))
+	section := func(title string, rs []kourai.ScanResult, line func(kourai.ScanResult) string) {
+		if len(rs) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s\n", title)
+		for _, r := range rs {
+			fmt.Fprintf(w, "%s\t%s\n", r.Path, line(r))
+		}
+	}
+	section("Movies", movies, func(r kourai.ScanResult) string {
+		if r.FileYear != 0 {
+			return fmt.Sprintf("%s\tyear corrected from %d", r.Target, r.FileYear)
+		}
+		return r.Target
+	})
+	section("Episodes", episodes, func(r kourai.ScanResult) string { return r.Target })
+	section("Unmatched", unmatched, func(r kourai.ScanResult) string { return r.Target + "\t" + r.Reason })
+	section("Skipped", skipped, func(r kourai.ScanResult) string { return r.Reason })
+}
+
+// writeScanJSON writes results as an indented JSON array
+func writeScanJSON(w io.Writer, results []kourai.ScanResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+
+	scanCmd.Flags().StringVar(&scanJSON, "json", "", "Write the report as JSON to the given file, or to standard output with \"-\"")
+}
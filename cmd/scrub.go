@@ -0,0 +1,118 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scrubSample float64
+	scrubEvery  time.Duration
+	scrubXattrs bool
+	scrubWatch  bool
+)
+
+// scrubCmd represents the scrub command
+var scrubCmd = &cobra.Command{
+	Use:   "scrub <dest>",
+	Short: "Verify destination files against their checksum manifests",
+	Long: `Re-hash the files listed in the checksum manifests written by
+"kourai link --checksums" and report files that are missing or whose
+contents no longer match, e.g. because of bit-rot or accidental edits.
+
+Files written with "kourai link --checksum-xattrs" also carry their
+checksum in an extended attribute. Pass --xattrs to verify files that are
+not listed in a manifest against it.
+
+Use --sample to verify a random fraction of the files on each pass, and
+--every to keep running and scrub again on a schedule. With --watch,
+files are verified as soon as they are modified, catching accidental
+edits without waiting for the next pass.
+
+--watch only sees files that are written to. Bit-rot changes contents
+without any modification event, so it is only caught by full passes:
+combine --watch with --every, e.g. --every 168h, to catch both.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := cmd.Context()
+		dest := args[0]
+		if scrubXattrs && !kourai.XattrsSupported {
+			fmt.Println("encountered error: --xattrs is not supported on this platform")
+			os.Exit(1)
+		}
+		if scrubWatch {
+			go func() {
+				err := kourai.ScrubWatch(ctx, dest, scrubXattrs, 2*time.Second, printScrubResult)
+				if err != nil && !errors.Is(err, context.Canceled) {
+					fmt.Println("encountered error:", err)
+					os.Exit(1)
+				}
+			}()
+		}
+		for {
+			failed := scrub(dest)
+			if scrubEvery <= 0 && !scrubWatch {
+				if failed {
+					os.Exit(1)
+				}
+				return
+			}
+			var next <-chan time.Time
+			if scrubEvery > 0 {
+				next = time.After(scrubEvery)
+			}
+			select {
+			case <-next:
+			case <-ctx.Done():
+				return
+			}
+		}
+	},
+}
+
+// printScrubResult prints results of files that failed verification
+func printScrubResult(r kourai.ScrubResult) {
+	switch r.Status {
+	case kourai.ScrubMismatch:
+		fmt.Printf("%s\t%s\twant %s, got %s\n", r.Status, r.Path, r.Want, r.Got)
+	case kourai.ScrubMissing, kourai.ScrubError:
+		fmt.Printf("%s\t%s\t%v\n", r.Status, r.Path, r.Err)
+	}
+}
+
+// scrub runs a single pass over dest and reports whether any file failed
+// verification.
+func scrub(dest string) bool {
+	results, err := kourai.Scrub(dest, scrubSample, scrubXattrs)
+	if err != nil {
+		fmt.Println("encountered error:", err)
+	}
+
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+		printScrubResult(r)
+	}
+	fmt.Printf("%s scrubbed %d files: %d ok, %d mismatched, %d missing, %d errors\n",
+		time.Now().Format(time.RFC3339), len(results), counts[kourai.ScrubOK],
+		counts[kourai.ScrubMismatch], counts[kourai.ScrubMissing], counts[kourai.ScrubError])
+	return err != nil || len(results) != counts[kourai.ScrubOK]
+}
+
+func init() {
+	rootCmd.AddCommand(scrubCmd)
+
+	scrubCmd.Flags().Float64Var(&scrubSample, "sample", 1, "Fraction of files to verify on each pass, between 0 and 1")
+	scrubCmd.Flags().DurationVar(&scrubEvery, "every", 0, "Repeat the scrub at this interval instead of exiting")
+	scrubCmd.Flags().BoolVar(&scrubXattrs, "xattrs", false, "Also verify files against checksums stored in extended attributes")
+	scrubCmd.Flags().BoolVar(&scrubWatch, "watch", false, "Keep running and verify files as they are modified; bit-rot is only caught by the passes of --every")
+}
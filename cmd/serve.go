@@ -0,0 +1,150 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	serveListen string
+	serveToken  string
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve [sources...]",
+	Short: "Serve a webhook linking the downloads of download clients",
+	Long: `Serve an HTTP endpoint that download clients call when a download
+completes, linking just the media of the path given, a file or folder, and
+responding with the targets created as JSON.
+
+The path is POSTed to / as the path value, or the dir and name values, in
+the query or a form, or as a JSON body like {"path": "/data/dl/Heat.1995"}.
+It must be below one of the sources. For example, in qBittorrent's "Run
+external program on torrent finished":
+
+  curl -fsS -XPOST -H "Authorization: Bearer $TOKEN" --data-urlencode "path=%F" http://localhost:8787/
+
+Transmission and SABnzbd run scripts instead, which may call curl with
+TR_TORRENT_DIR and TR_TORRENT_NAME, or SAB_COMPLETE_DIR, as the path.
+
+Requests must carry the --token, or the hook_token config key, when set, as
+a bearer token or the token query value. The destination is locked while
+the targets of each request are created.
+
+Prometheus metrics of the files scanned, the links created, TMDB requests
+and hook requests are served on /metrics, without a token.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		if len(args) == 0 {
+			args = srcsDefault
+		}
+		if serveToken == "" {
+			serveToken = viper.GetString("hook_token")
+		}
+		mode, err := kourai.ParseLinkMode(linkMode)
+		if err != nil {
+			return err
+		}
+
+		perms, err := permissionsFromProfile(permissionProfile)
+		if err != nil {
+			return err
+		}
+		opts, store, err := pipelineOptions(key, perms)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		metrics := kourai.NewServiceMetrics()
+		opts = append(opts,
+			kourai.WithServiceMetrics(metrics),
+			kourai.WithDestination(dest),
+			kourai.WithSources(args),
+			kourai.WithLinkMode(mode),
+			kourai.WithCrossDeviceFallback(crossDevice),
+			kourai.WithStateDB(statePath),
+		)
+
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		journal, err := kourai.OpenJournal(filepath.Join(dest, kourai.JournalName))
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+
+		// The journal is written by one request at a time
+		var mu sync.Mutex
+		create := func(l kourai.Link) error {
+			lease, err := lockDestination(cmd.Context(), dest)
+			if err != nil {
+				return err
+			}
+			defer releaseDestination(lease)
+			if err := l.Create(); err != nil {
+				fmt.Println(err)
+				metrics.Failed(l)
+				return err
+			}
+			metrics.Created(l)
+			fmt.Printf("%v\t%v\n", l.Src, l.Target)
+			mu.Lock()
+			defer mu.Unlock()
+			if err := journal.Record(string(mode), l); err != nil {
+				fmt.Println("failed to record link in journal:", err)
+			}
+			return nil
+		}
+		handler, err := kourai.HookHandler(serveToken, create, opts...)
+		if err != nil {
+			return err
+		}
+		if serveToken == "" {
+			logger.Warn("serving without a token, anyone who can reach the server can link the sources")
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		mux.Handle("/", metrics.Instrument(handler))
+		srv := &http.Server{Addr: serveListen, Handler: mux}
+		go func() {
+			<-cmd.Context().Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			srv.Shutdown(ctx)
+		}()
+		logger.Info("serving hooks", "addr", serveListen, "sources", args, "dest", dest)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringP("dest", "d", "", "Destination directory")
+	serveCmd.MarkFlagRequired("dest")
+	serveCmd.Flags().StringVar(&serveListen, "listen", "localhost:8787", "Address the webhook is served on")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "Token requests must carry, defaults to the hook_token config key")
+	serveCmd.Flags().StringVar(&linkMode, "mode", string(kourai.ModeHardlink), "How targets are created from sources: hardlink, copy (cloned on APFS) or move")
+	serveCmd.Flags().BoolVar(&crossDevice, "copy-across-devices", false, "Copy files that can't be hard linked because the destination is on another filesystem")
+	serveCmd.Flags().StringVar(&statePath, "state", "", "SQLite database of the sources linked, see \"kourai link --state\"")
+}
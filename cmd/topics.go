@@ -0,0 +1,290 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// helpTopics are commands without a Run function. Cobra lists them under
+// "Additional help topics" and they are readable with `kourai help <topic>`.
+var helpTopics = []*cobra.Command{namingTopic, filtersTopic}
+
+var namingTopic = &cobra.Command{
+	Use:   "naming",
+	Short: "How destination paths are named",
+	Long: `Every source file is parsed as either a TV episode or a movie, and linked
+into the destination directory using the layouts below, unless templates
+are given.
+
+Episodes are detected by an SxxEyy or NxNN identifier, e.g. S01E05 or
+1x05, anywhere in the file name. They are placed under:
+
+  tv/<Series> (<Year>)/Season <N>/<Series> (<Year>) - SxxEyy - <Title>.<ext>
+
+  * The year is omitted when the file name does not contain one.
+  * Season 0 is placed in a "Specials" folder instead of "Season 0".
+  * The episode title is omitted when none can be determined.
+  * Files containing several episodes (S01E01E02E03) are named with the
+    first and last episode, e.g. S01E01-E03. With a TMDB API key, the
+    title joins the titles of each episode, as for anthology shows with
+    several stories per file: "Title A + Title B".
+  * Slashes in titles are replaced with "-", and titles longer than 150
+    bytes are shortened and end with "…".
+  * Episode numbers are zero padded to two digits regardless of how the
+    source file was named. Use --episode-padding to change the width,
+    e.g. 3 for S01E007.
+
+Fansubbed anime numbered absolutely, e.g.
+"[SubGroup] Series Name - 013 [1080p][ABCD1234].mkv", are episodes too.
+With a TMDB API key, the absolute number is mapped to the season and
+episode it counts to, specials excepted; without one, it is numbered as an
+episode of season 1. Release group prefixes and CRCs are removed from all
+names.
+
+Daily shows, such as talk shows and news, are named by air date instead,
+e.g. Show.2024.05.01.Guest.mkv. They are filed by year, in Plex's format:
+
+  tv/<Series>/Season <Year>/<Series> - 2024-05-01 - <Title>.<ext>
+
+With a TMDB API key, the title is that of the episode that aired on the
+date.
+
+Anything else is treated as a movie, using the file name or its parent
+directory, whichever yields a title and a plausible year. Years in
+parentheses are preferred, then the last year before release tags such
+as 1080p. Years starting a name are part of the title, as in
+"2001 A Space Odyssey (1968)" or "1923", and resolutions such as
+1920x1080, release groups such as x264-2000 and years in the future aren't
+taken as years. Movies keep their original file name:
+
+  movies/<Title> (<Year>)/<original file name>
+
+Editions named in the file or directory name, e.g. Directors.Cut,
+Extended, Theatrical or Remastered, are kept out of the title and given
+in Plex's format instead:
+
+  movies/<Title> (<Year>) {edition-Director's Cut}/<original file name>
+
+Large libraries can be sharded with --shard, filing movie and series
+folders under a folder of their first letter, ignoring leading articles
+and accents, or 0-9 and # for names starting with a digit or a symbol:
+
+  movies/A/Alien (1979)/<original file name>
+  tv/O/The Office (2005)/Season 1/The Office (2005) - S01E01 - Pilot.mkv
+
+Give --shard to fsck and repair too; fsck moves folders filed under the
+wrong letter, or outside of the letter folders, with --fix.
+
+Titles are normalized by replacing "." and "_" with spaces and converting
+to title case. Pass --keep-title-case to leave the casing untouched. Common
+acronyms, e.g. FBI or NCIS, roman numerals and a few stylized names, e.g.
+M*A*S*H or WALL·E, are written as they should be; add others with
+--title-exception, or in the config file:
+
+  title_exceptions: ["ALF", "DuckTales"]
+
+When a TMDB API key is given, series, episode and movie titles are replaced
+with the ones returned by TMDB, exactly as TMDB writes them. Movie years
+one year off the release year on TMDB, as those of festival premieres
+often are, are corrected too, and reported by scan; pass --keep-file-year
+to keep the years of names.
+
+Search results are scored from 0 to 1 by how closely their title matches,
+how near their year is, and their popularity, and the best of the first
+results is used. With --min-confidence, e.g. 0.6, results scoring lower are
+rejected: the media keep the names parsed from their paths and are flagged
+in --report, or are skipped altogether with --skip-unsure.
+
+With link --interactive, ambiguous searches are asked about instead: when
+several results score about as well as the best one, or the best one scores
+below --min-confidence or 0.6, the candidates are listed to choose from.
+Choices are recorded as aliases, so the same title isn't asked about again.
+
+Templates
+
+The layouts can be replaced with Go text/template templates, given with
+--movie-template and --episode-template, or in the config file:
+
+  templates:
+    movie: "Films/{{.Title}}{{if .Year}} ({{.Year}}){{end}}/{{.Title}}{{.Ext}}"
+    episode: "TV/{{.Series}}/{{.SeasonFolder}}/{{.Series}} {{.EpisodeID}}{{.Ext}}"
+
+Templates render a path relative to the destination, using "/" as the
+separator. The fields are:
+
+  {{.Type}}          movie or episode
+  {{.Title}}         movie title, or episode title
+  {{.Series}}        series name
+  {{.Year}}          year of the movie or series, 0 when unknown
+  {{.Season}}        season number
+  {{.SeasonFolder}}  "Season <N>", or "Specials" for season 0
+  {{.Episode}}       episode number
+  {{.EpisodeID}}     episode identifier, e.g. S01E02 or S01E01-E02, or the
+                     air date of daily shows
+  {{.AirDate}}       air date of daily shows, e.g. 2024-05-01, or empty
+  {{.TMDBID}}        TMDB ID, 0 when unknown
+  {{.Edition}}       edition of the movie, e.g. Director's Cut, or empty
+  {{.Decade}}        decade of release or first air date, e.g. 1970s
+  {{.Resolution}}    resolution tagged in the name, e.g. 1080p, or empty
+  {{.Source}}        source tagged in the name, e.g. BluRay or WEB-DL
+  {{.Codec}}         video codec tagged in the name, e.g. H.264
+  {{.Group}}         release group, e.g. SPARKS, or empty
+  {{.Quality}}       resolution and source, e.g. "1080p BluRay"
+  {{.Ext}}           extension of the source, including the dot
+  {{.Filename}}      file name of the source
+
+With --probe, videos are probed with ffprobe, and these are set too:
+
+  {{.Duration}}      duration, e.g. 1h42m3s; {{.Duration.Minutes}} gives
+                     the minutes
+  {{.Width}}         width of the video, e.g. 1920
+  {{.Height}}        height of the video, e.g. 1080
+  {{.VideoCodec}}    video codec named by ffprobe, e.g. hevc
+  {{.AudioCodec}}    audio codec named by ffprobe, e.g. eac3
+
+The probed resolution and codec also stand in for those missing from the
+name in {{.Resolution}}, {{.Codec}} and {{.Quality}}.
+
+Templates can shard folders like --shard with the shard function, e.g.
+"TV/{{shard .Series}}/{{.Series}}/..." files "The Office" under "O".
+
+Paths, whether rendered by the layouts or by templates, can be lower or
+upper cased with --target-case, e.g. lower for rclone crypt remotes:
+
+  movies/alien (1979)/alien.1979.1080p.mkv
+
+Existing folders whose names only differ in case are linked into rather
+than created again, so that a library keeps its folders when the case
+changes. Give --target-case to fsck and repair too.
+
+Routes
+
+Media can be linked into other libraries than the destination by the
+decade they were released in, with --route <decades>=<dir>, or in the
+config file:
+
+  routes:
+    - "-1960s=/media/classics"
+    - "1980s-1990s=/media/retro"
+
+Decades are a single decade, e.g. 1970s, or a range that may be open on
+either side. The first matching route applies. Release years are the TMDB
+release dates of movies and first air dates of series, and only come from
+file names when media are not looked up.
+
+Commands working on an existing destination, e.g. repair, expect the
+default layout, sharded with --shard or not.`,
+}
+
+var filtersTopic = &cobra.Command{
+	Use:   "filters",
+	Short: "How source files are selected",
+	Long: `Filters decide which files found in the source directories are linked.
+File filters are evaluated while walking the sources; a directory excluded
+by a filter is skipped along with everything below it.
+
+  --extensions, -e    Comma separated list of file extensions to consider.
+                      Matching is case-insensitive. (default avi,mkv,mp4)
+
+  --exclude, -x       Regular expressions matched against file and directory
+                      names, not full paths. Files matching (?i)\bsample\b
+                      are always excluded.
+
+  --ignore <path|pattern>
+                      Ignore a source file, the files below a folder, or
+                      names matching a pattern, for the run. Ignores kept
+                      with "kourai ignore add" apply to every run given the
+                      same --state.
+
+  --since <date>      Only consider files modified after the given date.
+  --before <date>     Only consider files modified before the given date.
+                      Dates are given as 2006-01-02, 1/2, 1-2 or 01/02. When
+                      the year is omitted, the current year is assumed.
+  --settle <duration> Skip files whose size or modification time change
+                      within the given time, e.g. 30s, as they're still
+                      being unpacked or transferred. Recently modified
+                      files are waited for; older ones are checked again
+                      without waiting.
+
+Media filters are evaluated after a file has been parsed, and after it has
+been looked up on TMDB.
+
+  --no-movies         Exclude movies.
+  --no-tv             Exclude TV episodes.
+  --exclude-countries Origin or production countries to exclude, as ISO
+                      3166-1 codes.
+
+  --exclude-company <name>
+  --include-company <name>
+                      Exclude media made by a TMDB production company, or
+                      only include media made by one of the given
+                      companies. Companies are given by name, ignoring
+                      case, or by TMDB ID. Repeat to give several.
+
+  --exclude-network <name>
+  --include-network <name>
+                      Like the company filters, for the TV networks that
+                      air series, e.g. --exclude-network Netflix. Movies
+                      are not filtered by network.
+
+                      Countries, companies and networks are looked up on
+                      TMDB. Media that can't be looked up are only
+                      excluded by the --include filters.
+
+  --skip-watched <plex|trakt>
+                      Skip movies and episodes that were watched already,
+                      according to the history of a Plex server, given
+                      with --watched-url and --watched-token, or of a Trakt
+                      user, given with --watched-token (an OAuth access
+                      token) and --trakt-client-id. This is useful to only
+                      organize unwatched downloads into a temporary
+                      library.
+
+  --only <selector>   Only process media matching the selector. Selectors
+                      take the form <field><op><value>, where field is one
+                      of type, series, title, year, season, episode,
+                      resolution, source, codec or group, or with --probe
+                      vcodec, acodec or height, and op is one of:
+
+                        =   equal, ignoring case and punctuation
+                        !=  not equal, ignoring case and punctuation
+                        ~=  matching a regular expression, ignoring case
+
+                      Selectors are matched against the names parsed from
+                      file names, before anything is looked up on TMDB.
+                      Repeat --only to combine selectors. Selectors on the
+                      same field are alternatives, all others must match:
+
+                        --only 'series=Breaking Bad' --only season=2
+                        --only 'title~=^dune' --only type=movie
+                        --only 'series=Andor' --only 'series=Severance'
+
+  --probe             Probe videos with ffprobe, which must be installed,
+                      skipping those it can't read or without a duration,
+                      such as truncated downloads, as corrupt. The probed
+                      resolution and codecs are matched by selectors, e.g.
+                      --only vcodec=hevc or --only resolution=2160p for
+                      files whose names don't tell, and are available to
+                      templates, see "kourai help naming".
+
+Duplicates
+
+Only one file can be linked to a target. When media of several sources
+have the same target, the one found first is linked, unless the sources
+are ranked with --source-priority, or in the config file:
+
+  source_priority:
+    - /data/remux
+    - /data/web
+
+The media of the earliest source directory is then linked, whatever the
+quality tagged in the names, and sources in none of them rank last.`,
+}
+
+func init() {
+	for _, t := range helpTopics {
+		rootCmd.AddCommand(t)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	trackEvery  time.Duration
+	trackNotify bool
+)
+
+// trackCmd represents the track command
+var trackCmd = &cobra.Command{
+	Use:   "track <dest>",
+	Short: "Report newly aired episodes of the series in a library",
+	Long: `Record the series of the library at dest in the store, along with the
+latest episode of each, then ask TMDB for the episodes that aired after it
+and report them as aired but not in the library.
+
+Series are looked up by the {tmdb-<id>} tag of their folder, the TMDB ID
+they were recorded with before, or by name. Specials are ignored.
+
+Pass --notify to run the command set as hooks.new_episode in the config
+file for each new episode, e.g. to send a notification. Its arguments are
+templates of {{.Series}}, {{.Title}}, {{.Season}}, {{.Episode}} and
+{{.TMDBID}}, e.g.
+
+  hooks:
+    new_episode: ["notify-send", "{{.Series}} s{{.Season}}e{{.Episode}} aired"]
+
+Use --every to keep running and check again on a schedule.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		if key == "" {
+			return fmt.Errorf("--api-key is required to look up new episodes")
+		}
+		var hook *kourai.Hook
+		if trackNotify {
+			hookArgs := viper.GetStringSlice("hooks.new_episode")
+			if len(hookArgs) == 0 {
+				return fmt.Errorf("--notify needs a command set as hooks.new_episode in the config file")
+			}
+			h, err := kourai.ParseHook(hookArgs)
+			if err != nil {
+				return err
+			}
+			hook = h
+		}
+		opts, store, err := pipelineOptions(key, nil)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		for {
+			shows, err := kourai.TrackShows(ctx, store, args[0], opts...)
+			if err != nil {
+				logger.Warn("failed to track some series", "error", err)
+			}
+			missing, err := kourai.NewEpisodes(ctx, shows, time.Now())
+			if err != nil {
+				logger.Warn("failed to look up some series", "error", err)
+			}
+			for _, m := range missing {
+				fmt.Printf("%s\ts%02de%02d\t%s\taired %s\n", m.Series, m.Season, m.Episode, m.Title, m.AirDate.Format(time.DateOnly))
+			}
+			fmt.Printf("%s tracked %d series: %d new episodes not in the library\n", time.Now().Format(time.RFC3339), len(shows), len(missing))
+			if hook != nil {
+				if err := kourai.NotifyNewEpisodes(ctx, hook, missing); err != nil {
+					logger.Warn("failed to notify of new episodes", "error", err)
+				}
+			}
+			if trackEvery <= 0 {
+				return nil
+			}
+			select {
+			case <-time.After(trackEvery):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trackCmd)
+
+	trackCmd.Flags().DurationVar(&trackEvery, "every", 0, "Check again at this interval instead of exiting, e.g. 24h")
+	trackCmd.Flags().BoolVar(&trackNotify, "notify", false, "Run the hooks.new_episode command of the config file for each new episode")
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undoRun  string
+	listRuns bool
+)
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo <dest>",
+	Short: "Revert the changes made by a previous link or organize run",
+	Long: `Every file created by link, or moved by organize, is recorded in a journal
+kept in the destination directory (` + kourai.JournalName + `). Undo reverts
+the most recent run, or the run given with --run, newest change first:
+links and copies are removed and moved files are moved back. Directories
+left empty are removed.
+
+Links and copies are only removed while their source still exists and
+they still match it, so that nothing replaced since a run is lost.
+Entries that can't be reverted are kept in the journal.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		journalPath := filepath.Join(args[0], kourai.JournalName)
+
+		if listRuns {
+			entries, err := kourai.ReadJournal(journalPath)
+			if err != nil {
+				return err
+			}
+			runs, counts := kourai.JournalRuns(entries)
+			for _, r := range runs {
+				fmt.Printf("%v\t%d\n", r, counts[r])
+			}
+			return nil
+		}
+
+		lease, err := lockDestination(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		defer releaseDestination(lease)
+
+		undone, err := kourai.UndoRun(journalPath, undoRun)
+		for _, e := range undone {
+			fmt.Printf("%v\t%v\t%v\n", e.Mode, e.Src, e.Target)
+		}
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().StringVar(&undoRun, "run", "", "Run to revert, as shown by --list (default is the most recent run)")
+	undoCmd.Flags().BoolVar(&listRuns, "list", false, "List the runs recorded in the journal")
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"fmt"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <dest>",
+	Short: "Audit the links of a destination against their sources",
+	Long: `Walk a destination and report the entries that no longer hold up:
+
+  * stale: entries of the journal (` + kourai.JournalName + `) whose
+    target was removed
+  * broken: hard links whose source was deleted or replaced, so that they
+    no longer share its inode, and, without a journal entry, hard links
+    not linked to any other file
+  * misnamed: files that would be named otherwise by the current layout or
+    target templates, e.g. after changing them
+  * duplicate: files sharing an inode or a source with another entry
+
+Pass the --mode, --copy-across-devices and --collection-folders the
+destination was linked with, so that entries are judged as link made them.
+
+Nothing is changed, see "kourai fsck" to check the layout itself and fix
+misfiled entries, and "kourai repair" to rename a wrongly matched title.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mode, err := kourai.ParseLinkMode(linkMode)
+		if err != nil {
+			return err
+		}
+		opts, store, err := pipelineOptions("", nil)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		opts = append(opts,
+			kourai.WithLinkMode(mode),
+			kourai.WithCrossDeviceFallback(crossDevice),
+			kourai.WithCollectionFolders(collectionDirs),
+		)
+		issues, err := kourai.Verify(args[0], opts...)
+		for _, i := range issues {
+			fmt.Fprintf(cmd.OutOrStdout(), "%v\t%v\t%v\n", i.Path, i.Kind, i.Problem)
+		}
+		if err != nil {
+			return err
+		}
+		if len(issues) > 0 {
+			return fmt.Errorf("found %d issues", len(issues))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVar(&linkMode, "mode", string(kourai.ModeHardlink), "How targets were created from sources: hardlink, copy or move")
+	verifyCmd.Flags().BoolVar(&crossDevice, "copy-across-devices", false, "Accept copies of sources on another filesystem in place of hard links")
+	verifyCmd.Flags().BoolVar(&collectionDirs, "collection-folders", false, "Movies were nested under folders of their TMDB collection")
+}
@@ -0,0 +1,210 @@
+/*
+Copyright © 2023 Ryan White
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	watchQuiet       time.Duration
+	watchMetrics     string
+	watchDigest      bool
+	watchDigestEvery time.Duration
+	watchReviewBelow float64
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch [sources...]",
+	Short: "Link media files as they arrive in the sources",
+	Long: `Watch the source directories and link each media file that arrives in
+them, e.g. as a torrent client finishes a download, until interrupted, so
+that kourai can run as a service next to the client.
+
+Files are linked once they were left alone for --quiet, so that files still
+being written aren't linked half done; see --settle to also check their
+size. Folders moved into the sources are linked too. Files already in the
+sources aren't: link them with "kourai link" before watching.
+
+The destination is locked while each target is created, so that other
+writers can run in between.
+
+With --metrics-listen, Prometheus metrics of the files scanned, the links
+created and TMDB requests are served on /metrics of the address given.
+
+Pass --digest to send a digest of the imports every --digest-every, a week
+by default, rather than following them one file at a time: the targets
+added, the sources that failed, and the targets matched with a confidence
+below --review-below, to check with "kourai rematch". It runs the command
+set as hooks.digest in the config file, whose arguments are templates of
+{{.Summary}}, the digest as Markdown, {{.Added}}, {{.Failed}},
+{{.Review}}, {{.From}} and {{.To}}, e.g.
+
+  hooks:
+    digest: ["apprise", "-t", "kourai: {{.Added}} imported", "-b", "{{.Summary}}"]
+
+The digest of the imports so far is sent when watching stops.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := cmd.Flags().Lookup("api-key").Value.String()
+		dest := cmd.Flags().Lookup("dest").Value.String()
+		if len(args) == 0 {
+			args = srcsDefault
+		}
+		mode, err := kourai.ParseLinkMode(linkMode)
+		if err != nil {
+			return err
+		}
+
+		var digestHook *kourai.Hook
+		if watchDigest {
+			hookArgs := viper.GetStringSlice("hooks.digest")
+			if len(hookArgs) == 0 {
+				return fmt.Errorf("--digest needs a command set as hooks.digest in the config file")
+			}
+			if watchDigestEvery <= 0 {
+				return fmt.Errorf("invalid --digest-every %s, it must be positive", watchDigestEvery)
+			}
+			if digestHook, err = kourai.ParseDigestHook(hookArgs); err != nil {
+				return err
+			}
+		}
+
+		perms, err := permissionsFromProfile(permissionProfile)
+		if err != nil {
+			return err
+		}
+		opts, store, err := pipelineOptions(key, perms)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		var metrics *kourai.ServiceMetrics
+		if watchMetrics != "" {
+			metrics = kourai.NewServiceMetrics()
+			opts = append(opts, kourai.WithServiceMetrics(metrics))
+		}
+		var digests *kourai.DigestCollector
+		var digestc <-chan time.Time
+		if digestHook != nil {
+			digests = kourai.NewDigestCollector(watchReviewBelow)
+			opts = append(opts, kourai.WithEvents(kourai.Events{OnError: digests.Failed}))
+			t := time.NewTicker(watchDigestEvery)
+			defer t.Stop()
+			digestc = t.C
+		}
+		sendDigest := func(ctx context.Context) {
+			d := digests.Take()
+			if err := d.Notify(ctx, digestHook); err != nil {
+				logger.Warn("failed to send the digest", "error", err)
+				return
+			}
+			logger.Info("sent the digest", "added", len(d.Added), "failed", len(d.Failed), "review", len(d.Review))
+		}
+		opts = append(opts,
+			kourai.WithDestination(dest),
+			kourai.WithSources(args),
+			kourai.WithLinkMode(mode),
+			kourai.WithCrossDeviceFallback(crossDevice),
+			kourai.WithStateDB(statePath),
+		)
+
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		journal, err := kourai.OpenJournal(filepath.Join(dest, kourai.JournalName))
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+
+		linkc, errc := kourai.Watch(cmd.Context(), watchQuiet, opts...)
+		if err := <-errc; err != nil {
+			return err
+		}
+		if metrics != nil {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics)
+			srv := &http.Server{Addr: watchMetrics, Handler: mux}
+			go func() {
+				<-cmd.Context().Done()
+				srv.Close()
+			}()
+			go func() {
+				if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+					logger.Error("serving metrics failed", "addr", watchMetrics, "error", err)
+				}
+			}()
+		}
+		logger.Info("watching for new files", "sources", args, "dest", dest)
+		for {
+			var l kourai.Link
+			var ok bool
+			select {
+			case l, ok = <-linkc:
+			case <-digestc:
+				sendDigest(cmd.Context())
+				continue
+			}
+			if !ok {
+				break
+			}
+			lease, err := lockDestination(cmd.Context(), dest)
+			if err != nil {
+				fmt.Println("encountered error:", err)
+				if digests != nil {
+					digests.Failed(l.Src, err)
+				}
+				continue
+			}
+			if err := l.Create(); err != nil {
+				fmt.Println(err)
+				metrics.Failed(l)
+			} else {
+				metrics.Created(l)
+				if digests != nil {
+					digests.Created(l)
+				}
+				fmt.Printf("%v\t%v\n", l.Src, l.Target)
+				if err := journal.Record(string(mode), l); err != nil {
+					fmt.Println("failed to record link in journal:", err)
+				}
+			}
+			releaseDestination(lease)
+		}
+		// Watching only stops when interrupted, after which the context is
+		// done, so the last digest gets a context of its own
+		if digests != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			sendDigest(ctx)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringP("dest", "d", "", "Destination directory")
+	watchCmd.MarkFlagRequired("dest")
+	watchCmd.Flags().StringVar(&watchMetrics, "metrics-listen", "", "Address Prometheus metrics are served on, e.g. localhost:9187")
+	watchCmd.Flags().DurationVar(&watchQuiet, "quiet", 5*time.Second, "How long a file must be left alone before it's linked")
+	watchCmd.Flags().StringVar(&linkMode, "mode", string(kourai.ModeHardlink), "How targets are created from sources: hardlink, copy (cloned on APFS) or move")
+	watchCmd.Flags().BoolVar(&crossDevice, "copy-across-devices", false, "Copy files that can't be hard linked because the destination is on another filesystem")
+	watchCmd.Flags().StringVar(&statePath, "state", "", "SQLite database of the sources linked, see \"kourai link --state\"")
+	watchCmd.Flags().BoolVar(&watchDigest, "digest", false, "Send a digest of the imports with the hooks.digest command of the config file")
+	watchCmd.Flags().DurationVar(&watchDigestEvery, "digest-every", 7*24*time.Hour, "How often digests are sent")
+	watchCmd.Flags().Float64Var(&watchReviewBelow, "review-below", 0.8, "List the targets matched with a confidence below this for review in digests, from 0 to 1")
+}
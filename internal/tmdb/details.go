@@ -0,0 +1,479 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Date is a calendar date as formatted by TMDB. Missing or empty dates
+// are left as the zero time.
+type Date struct {
+	time.Time
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil
+	}
+	d.Time = t
+	return nil
+}
+
+type MovieDetails struct {
+	ID                  uint32      `json:"id"`
+	Title               string      `json:"title"`
+	OriginalTitle       string      `json:"original_title"`
+	ReleaseDate         Date        `json:"release_date"`
+	Runtime             uint32      `json:"runtime"`
+	BelongsToCollection *Collection `json:"belongs_to_collection"`
+	Overview            string      `json:"overview"`
+	IMDbID              string      `json:"imdb_id"`
+	PosterPath          string      `json:"poster_path"`
+	BackdropPath        string      `json:"backdrop_path"`
+	VoteAverage         float32     `json:"vote_average"`
+	VoteCount           uint32      `json:"vote_count"`
+	OriginCountry       []string    `json:"origin_country"`
+	ProductionCountries []Country   `json:"production_countries"`
+	ProductionCompanies []Company   `json:"production_companies"`
+}
+
+// Company is a production company or TV network.
+type Company struct {
+	ID            uint32 `json:"id"`
+	Name          string `json:"name"`
+	OriginCountry string `json:"origin_country"`
+}
+
+// Country is a country a movie was produced in.
+type Country struct {
+	ISO3166 string `json:"iso_3166_1"`
+	Name    string `json:"name"`
+}
+
+// ExternalIDs are the IDs of an entry in other databases.
+type ExternalIDs struct {
+	IMDbID string `json:"imdb_id"`
+	TVDBID int    `json:"tvdb_id"`
+}
+
+// Credits are the cast and crew of a movie or episode. GuestStars is only
+// set for episodes.
+type Credits struct {
+	Cast       []CastMember `json:"cast"`
+	GuestStars []CastMember `json:"guest_stars"`
+	Crew       []CrewMember `json:"crew"`
+}
+
+// CastMember is an actor and the character played.
+type CastMember struct {
+	ID          uint32 `json:"id"`
+	Name        string `json:"name"`
+	Character   string `json:"character"`
+	Order       int    `json:"order"`
+	ProfilePath string `json:"profile_path"`
+}
+
+// CrewMember is a member of the crew and the job done, e.g. "Director".
+type CrewMember struct {
+	ID          uint32 `json:"id"`
+	Name        string `json:"name"`
+	Department  string `json:"department"`
+	Job         string `json:"job"`
+	ProfilePath string `json:"profile_path"`
+}
+
+// Collection is a set of movies, e.g. a franchise.
+type Collection struct {
+	ID           uint32 `json:"id"`
+	Name         string `json:"name"`
+	Overview     string `json:"overview"`
+	PosterPath   string `json:"poster_path"`
+	BackdropPath string `json:"backdrop_path"`
+}
+
+type TVDetails struct {
+	ID                  uint32    `json:"id"`
+	Name                string    `json:"name"`
+	OriginalName        string    `json:"original_name"`
+	OriginCountry       []string  `json:"origin_country"`
+	FirstAirDate        Date      `json:"first_air_date"`
+	Overview            string    `json:"overview"`
+	PosterPath          string    `json:"poster_path"`
+	BackdropPath        string    `json:"backdrop_path"`
+	Seasons             []Season  `json:"seasons"`
+	Networks            []Company `json:"networks"`
+	ProductionCompanies []Company `json:"production_companies"`
+}
+
+type Season struct {
+	ID           uint32 `json:"id"`
+	Name         string `json:"name"`
+	SeasonNumber int    `json:"season_number"`
+	PosterPath   string `json:"poster_path"`
+	AirDate      Date   `json:"air_date"`
+	EpisodeCount int    `json:"episode_count"`
+}
+
+// SeasonDetails is a season of a series and its episodes
+type SeasonDetails struct {
+	ID           uint32           `json:"id"`
+	SeasonNumber int              `json:"season_number"`
+	Episodes     []EpisodeDetails `json:"episodes"`
+}
+
+// get answers u from memory, or requests it through the shared, rate
+// limited request workers, waiting for other requesters of u to get it
+// first. The response channel is buffered, so a worker never blocks on a
+// requester that gave up when ctx was cancelled. Rate limited requests and
+// server errors are retried as set with SetRetries, waiting here rather
+// than in a worker, which goes on with the requests of others meanwhile.
+func (t *TMDB) get(ctx context.Context, u string, dest any) error {
+	if fresh, _ := ctx.Value(noCacheKey{}).(bool); !fresh {
+		cached, release, err := claim(ctx, u)
+		if err != nil {
+			return err
+		}
+		if release == nil {
+			// TODO: read up on this, lol. It works, but is mostly just copied after Googling
+			// Naively assigning to the container without reflect doesn't update the value
+			// at the caller
+			ct := reflect.ValueOf(dest).Elem()
+			v := reflect.ValueOf(cached).Elem()
+			ct.Set(v)
+			if observe != nil {
+				observe(true, 0)
+			}
+			return nil
+		}
+		defer release()
+	}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		res := make(chan result, 1)
+		select {
+		case requestc <- request{ctx: ctx, url: u, container: dest, res: res}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		var r result
+		select {
+		case r = <-res:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if r.cached {
+			if observe != nil {
+				observe(true, 0)
+			}
+			return nil
+		}
+		retry := errors.Is(r.err, errRetryable) && attempt < retries.attempts
+		if retry {
+			select {
+			case <-time.After(retries.wait(attempt, r.retryAfter)):
+				continue
+			case <-ctx.Done():
+			}
+		}
+		if observe != nil {
+			observe(false, time.Since(start))
+		}
+		return r.err
+	}
+}
+
+func (t *TMDB) MovieDetails(ctx context.Context, id int) (MovieDetails, error) {
+	var m MovieDetails
+	u := fmt.Sprintf("https://api.themoviedb.org/3/movie/%d%s", id, t.query())
+	if err := t.get(ctx, u, &m); err != nil {
+		return m, err
+	}
+	if m.ID == 0 {
+		return m, fmt.Errorf("no movie found at tmdb with id %d", id)
+	}
+	return m, nil
+}
+
+func (t *TMDB) TVDetails(ctx context.Context, id int) (TVDetails, error) {
+	var s TVDetails
+	u := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d%s", id, t.query())
+	if err := t.get(ctx, u, &s); err != nil {
+		return s, err
+	}
+	if s.ID == 0 {
+		return s, fmt.Errorf("no series found at tmdb with id %d", id)
+	}
+	return s, nil
+}
+
+func (t *TMDB) CollectionDetails(ctx context.Context, id int) (Collection, error) {
+	var c Collection
+	u := fmt.Sprintf("https://api.themoviedb.org/3/collection/%d%s", id, t.query())
+	if err := t.get(ctx, u, &c); err != nil {
+		return c, err
+	}
+	if c.ID == 0 {
+		return c, fmt.Errorf("no collection found at tmdb with id %d", id)
+	}
+	return c, nil
+}
+
+// MovieCredits returns the cast and crew of the movie with the given ID.
+func (t *TMDB) MovieCredits(ctx context.Context, id int) (Credits, error) {
+	var c Credits
+	u := fmt.Sprintf("https://api.themoviedb.org/3/movie/%d/credits%s", id, t.query())
+	err := t.get(ctx, u, &c)
+	return c, err
+}
+
+// EpisodeCredits returns the cast, guest stars and crew of an episode.
+func (t *TMDB) EpisodeCredits(ctx context.Context, seriesID int, season int, episode int) (Credits, error) {
+	var c Credits
+	u := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/season/%d/episode/%d/credits%s", seriesID, season, episode, t.query())
+	err := t.get(ctx, u, &c)
+	return c, err
+}
+
+func (t *TMDB) EpisodeExternalIDs(ctx context.Context, seriesID int, season int, episode int) (ExternalIDs, error) {
+	var ids ExternalIDs
+	u := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/season/%d/episode/%d/external_ids%s", seriesID, season, episode, t.query())
+	err := t.get(ctx, u, &ids)
+	return ids, err
+}
+
+func (t *TMDB) EpisodeDetails(ctx context.Context, seriesID int, season int, episode int) (EpisodeDetails, error) {
+	var ep EpisodeDetails
+	u := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/season/%d/episode/%d%s", seriesID, season, episode, t.query())
+	if err := t.get(ctx, u, &ep); err != nil {
+		return ep, err
+	}
+	if ep.ID == 0 {
+		return ep, fmt.Errorf("no episode found at tmdb for series %d, season %d, episode %d", seriesID, season, episode)
+	}
+	return ep, nil
+}
+
+// SeasonDetails returns a season of the series with the given ID, and its
+// episodes.
+func (t *TMDB) SeasonDetails(ctx context.Context, seriesID int, season int) (SeasonDetails, error) {
+	var sd SeasonDetails
+	u := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/season/%d%s", seriesID, season, t.query())
+	if err := t.get(ctx, u, &sd); err != nil {
+		return sd, err
+	}
+	if sd.ID == 0 {
+		return sd, fmt.Errorf("no season found at tmdb for series %d, season %d", seriesID, season)
+	}
+	return sd, nil
+}
+
+// EpisodeByAirDate returns the episode of the series with the given ID that
+// aired on date. Seasons are searched latest first, from the last one that
+// started airing on or before date, until one ended before it.
+func (t *TMDB) EpisodeByAirDate(ctx context.Context, seriesID int, date time.Time) (EpisodeDetails, error) {
+	show, err := t.TVDetails(ctx, seriesID)
+	if err != nil {
+		return EpisodeDetails{}, err
+	}
+	for i := len(show.Seasons) - 1; i >= 0; i-- {
+		s := show.Seasons[i]
+		if s.AirDate.IsZero() || s.AirDate.After(date) {
+			continue
+		}
+		sd, err := t.SeasonDetails(ctx, seriesID, s.SeasonNumber)
+		if err != nil {
+			return EpisodeDetails{}, err
+		}
+		ended := s.SeasonNumber > 0
+		for _, ep := range sd.Episodes {
+			if ep.AirDate.Equal(date) {
+				return ep, nil
+			}
+			ended = ended && ep.AirDate.Before(date)
+		}
+		if ended {
+			break
+		}
+	}
+	return EpisodeDetails{}, fmt.Errorf("no episode of series %d aired on %s at tmdb", seriesID, date.Format("2006-01-02"))
+}
+
+// EpisodeByAbsoluteNumber returns the nth episode of the series with the
+// given ID, counting the episodes of its seasons in order, specials
+// excepted.
+func (t *TMDB) EpisodeByAbsoluteNumber(ctx context.Context, seriesID int, n int) (EpisodeDetails, error) {
+	show, err := t.TVDetails(ctx, seriesID)
+	if err != nil {
+		return EpisodeDetails{}, err
+	}
+	seasons := append([]Season(nil), show.Seasons...)
+	sort.Slice(seasons, func(i, j int) bool { return seasons[i].SeasonNumber < seasons[j].SeasonNumber })
+	left := n
+	for _, s := range seasons {
+		if s.SeasonNumber == 0 {
+			continue
+		}
+		if left <= s.EpisodeCount {
+			return t.EpisodeDetails(ctx, seriesID, s.SeasonNumber, left)
+		}
+		left -= s.EpisodeCount
+	}
+	return EpisodeDetails{}, fmt.Errorf("no episode %d of series %d at tmdb, counting across seasons", n, seriesID)
+}
+
+// External sources of IDs that Find looks up
+const (
+	SourceIMDb = "imdb_id"
+	SourceTVDB = "tvdb_id"
+)
+
+// FindResults are the movies, series and episodes with an external ID.
+type FindResults struct {
+	MovieResults     []MovieSearchResult `json:"movie_results"`
+	TVResults        []TVSearchResult    `json:"tv_results"`
+	TVEpisodeResults []struct {
+		ShowID        uint32 `json:"show_id"`
+		SeasonNumber  int    `json:"season_number"`
+		EpisodeNumber int    `json:"episode_number"`
+	} `json:"tv_episode_results"`
+}
+
+// Find looks up what has the ID id at the external source, e.g. an IMDb ID
+// with SourceIMDb.
+func (t *TMDB) Find(ctx context.Context, id string, source string) (FindResults, error) {
+	var r FindResults
+	u := fmt.Sprintf("https://api.themoviedb.org/3/find/%s%s&external_source=%s", url.PathEscape(id), t.query(), source)
+	err := t.get(ctx, u, &r)
+	return r, err
+}
+
+const imageBaseURL = "https://image.tmdb.org/t/p/"
+
+// ImageURL returns the URL of the image at path in the given size.
+func ImageURL(path string, size string) string {
+	return imageBaseURL + size + path
+}
+
+// Configuration is the configuration of the API, such as where images are
+// served from
+type Configuration struct {
+	Images struct {
+		SecureBaseURL string   `json:"secure_base_url"`
+		PosterSizes   []string `json:"poster_sizes"`
+		BackdropSizes []string `json:"backdrop_sizes"`
+	} `json:"images"`
+}
+
+// Configuration returns the configuration of the API.
+func (t *TMDB) Configuration(ctx context.Context) (Configuration, error) {
+	var c Configuration
+	u := "https://api.themoviedb.org/3/configuration?api_key=" + t.key
+	if err := t.get(ctx, u, &c); err != nil {
+		return c, err
+	}
+	if c.Images.SecureBaseURL == "" {
+		return c, fmt.Errorf("tmdb configuration has no image URL")
+	}
+	return c, nil
+}
+
+// imageURL returns the URL of the image at path in the given size, served
+// from the base URL of the configuration. The configuration is requested
+// once; ImageURL is used when it fails.
+func (t *TMDB) imageURL(ctx context.Context, path string, size string) string {
+	t.imageOnce.Do(func() {
+		if c, err := t.Configuration(ctx); err == nil {
+			t.imageBase = c.Images.SecureBaseURL
+		}
+	})
+	if t.imageBase == "" {
+		return ImageURL(path, size)
+	}
+	return strings.TrimSuffix(t.imageBase, "/") + "/" + size + path
+}
+
+// Image is a poster or backdrop of a movie or series
+type Image struct {
+	FilePath string `json:"file_path"`
+	// Language is the ISO 639-1 code of the text in the image, or empty
+	// for images without text
+	Language    string  `json:"iso_639_1"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	VoteAverage float32 `json:"vote_average"`
+	VoteCount   int     `json:"vote_count"`
+}
+
+// Images are the posters and backdrops of a movie or series
+type Images struct {
+	ID        uint32  `json:"id"`
+	Backdrops []Image `json:"backdrops"`
+	Posters   []Image `json:"posters"`
+}
+
+// imageQuery returns the query string of image listings, including the
+// images in the language of t, in English and without text
+func (t *TMDB) imageQuery() string {
+	langs := "en,null"
+	if lang, _, _ := strings.Cut(t.lang, "-"); lang != "" && lang != "en" {
+		langs = lang + "," + langs
+	}
+	return "?api_key=" + t.key + "&include_image_language=" + url.QueryEscape(langs)
+}
+
+// MovieImages returns the posters and backdrops of the movie with the
+// given ID.
+func (t *TMDB) MovieImages(ctx context.Context, id int) (Images, error) {
+	var i Images
+	u := fmt.Sprintf("https://api.themoviedb.org/3/movie/%d/images%s", id, t.imageQuery())
+	err := t.get(ctx, u, &i)
+	return i, err
+}
+
+// TVImages returns the posters and backdrops of the series with the given
+// ID.
+func (t *TMDB) TVImages(ctx context.Context, id int) (Images, error) {
+	var i Images
+	u := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/images%s", id, t.imageQuery())
+	err := t.get(ctx, u, &i)
+	return i, err
+}
+
+// Image downloads the image at path, as returned in the poster_path and
+// similar fields, in the given size, e.g. "w780" or "original".
+func (t *TMDB) Image(ctx context.Context, path string, size string) ([]byte, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", t.imageURL(ctx, path, size), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image %s: %s", path, res.Status)
+	}
+	var body io.Reader = res.Body
+	if throttle != nil {
+		body = throttle(ctx, body)
+	}
+	return io.ReadAll(body)
+}
@@ -0,0 +1,579 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	limiter  *rate.Limiter
+	requestc chan request
+	persist  Cache
+	retries  = retryPolicy{attempts: 5, base: time.Second, max: time.Minute, jitter: 0.5}
+	// searchPages limits the pages of search results, 0 for all
+	searchPages int
+	// throttle wraps the bodies of image downloads, e.g. to limit their
+	// bandwidth
+	throttle func(ctx context.Context, r io.Reader) io.Reader
+	// httpClient sends the requests of all clients
+	httpClient = http.DefaultClient
+	// observe is told of each request answered, see SetObserver
+	observe func(cached bool, took time.Duration)
+)
+
+// retryPolicy is how often, and after how long, rate limited requests and
+// server errors are retried
+type retryPolicy struct {
+	attempts int
+	base     time.Duration
+	max      time.Duration
+	// jitter is the largest fraction of a delay added to it at random
+	jitter float64
+}
+
+// backoff returns the delay before retrying after the given attempt: base
+// doubled for each attempt, up to max, with up to a jitter fraction of it
+// added so that several clients don't retry in lockstep
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.base << (attempt - 1)
+	if d <= 0 || d > p.max {
+		d = p.max
+	}
+	return d + time.Duration(rand.Int63n(int64(float64(d)*p.jitter)+1))
+}
+
+// wait returns the delay before retrying after the given attempt, using
+// the delay the server asked for, if any, up to max
+func (p retryPolicy) wait(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter <= 0 {
+		return p.backoff(attempt)
+	}
+	return min(retryAfter, p.max)
+}
+
+// SetRetries sets the number of attempts of each request, including the
+// first, the delay before the first retry, and the largest fraction of a
+// delay added to it at random, between 0 and 1. Retries wait for the
+// duration given by the Retry-After header of the response, when present,
+// but never longer than a minute.
+func SetRetries(attempts int, base time.Duration, jitter float64) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	retries.attempts = attempts
+	if base > 0 {
+		retries.base = base
+	}
+	retries.jitter = min(max(jitter, 0), 1)
+}
+
+// SetSearchPages sets the largest number of pages of results searches
+// stream, of 20 results each, or 0 for all of them.
+func SetSearchPages(n int) {
+	searchPages = max(n, 0)
+}
+
+// SetThrottle makes image downloads read their response through the reader
+// returned by wrap, which may limit their bandwidth. A nil wrap reads them
+// as fast as they arrive.
+func SetThrottle(wrap func(ctx context.Context, r io.Reader) io.Reader) {
+	throttle = wrap
+}
+
+// SetHTTPClient sends requests, including image downloads, with c instead
+// of http.DefaultClient, e.g. to answer them with a fake server in tests. A
+// nil c restores http.DefaultClient.
+func SetHTTPClient(c *http.Client) {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	httpClient = c
+}
+
+// ResetCache forgets the responses kept in memory by URL, which are
+// otherwise kept for the lifetime of the process. The Cache set with
+// SetCache is left alone.
+func ResetCache() {
+	responses.Lock()
+	defer responses.Unlock()
+	responses.byURL = map[string]any{}
+}
+
+// pool is the number of workers sending requests, which are stopped by
+// sending to stopc, see SetWorkers
+var (
+	poolMu sync.Mutex
+	pool   int
+	stopc  = make(chan struct{})
+)
+
+// SetWorkers sets the number of workers sending requests at once, 8 by
+// default. They share the rate limit and the caches, and a response
+// requested by several at once is only requested once.
+func SetWorkers(n int) {
+	n = max(n, 1)
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	for ; pool < n; pool++ {
+		go fetch2(requestc, stopc)
+	}
+	for ; pool > n; pool-- {
+		stopc <- struct{}{}
+	}
+}
+
+// Cache keeps TMDB responses beyond the lifetime of the process, e.g. to
+// share them between several machines. Keys are request URLs without the
+// API key.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte)
+}
+
+// SetObserver calls f with each request answered, from the goroutine of the
+// requester, telling whether it was answered from a cache and, for requests
+// sent to TMDB, how long they took, retries included. A nil f observes
+// nothing.
+func SetObserver(f func(cached bool, took time.Duration)) {
+	observe = f
+}
+
+// SetCache sets the cache consulted before requesting TMDB. It should be
+// set before the first request.
+func SetCache(c Cache) {
+	persist = c
+}
+
+// cacheKey strips the API key from u
+func cacheKey(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	q := parsed.Query()
+	q.Del("api_key")
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// noCacheKey marks contexts of requests that bypass the caches
+type noCacheKey struct{}
+
+// WithoutCache returns a context of requests that bypass the caches, for
+// responses that change, such as the episodes of airing seasons. Their
+// responses are still cached for other requests.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+type request struct {
+	ctx       context.Context
+	url       string
+	container any
+	res       chan result
+}
+
+// result is the outcome of one attempt of a request
+type result struct {
+	err error
+	// cached is set when the response was cached
+	cached bool
+	// retryAfter is the delay a rate limited request should be retried
+	// after, as asked by the server, or 0
+	retryAfter time.Duration
+}
+
+type MovieSearchResults struct {
+	Results      []MovieSearchResult
+	Page         int
+	TotalPages   int `json:"total_pages"`
+	TotalResults int `json:"total_results"`
+}
+
+// TODO: genre IDs
+type MovieSearchResult struct {
+	Title string
+	Adult bool
+	ID    uint32
+
+	// TODO: some other type here, Custom Unmarshal function
+	OriginalLanguage string
+	OriginalTitle    string
+	Overview         string
+	Popularity       float32
+
+	ReleaseDate time.Time
+	VoteAverage float32
+	VoteCount   uint32
+}
+
+func (ms *MovieSearchResult) UnmarshalJSON(b []byte) error {
+	type Alias MovieSearchResult
+	aux := &struct {
+		*Alias
+		ReleaseDate string `json:"release_date"`
+	}{
+		Alias: (*Alias)(ms),
+	}
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+
+	t, err := time.Parse("2006-01-02", aux.ReleaseDate)
+	if err != nil {
+		return nil
+	}
+	ms.ReleaseDate = t
+
+	return nil
+}
+
+type TVSearchResults struct {
+	Results      []TVSearchResult
+	Page         int
+	TotalPages   int `json:"total_pages"`
+	TotalResults int `json:"total_results"`
+}
+
+type TVSearchResult struct {
+	Name             string
+	Adult            bool
+	ID               uint32
+	OriginCountry    []string
+	OriginalLanguage string
+	OriginalName     string
+	Overview         string
+	Popularity       float32
+	FirstAirDate     Date `json:"first_air_date"`
+}
+
+type EpisodeDetails struct {
+	Name string
+	ID   uint32
+
+	SeasonNumber  uint32 `json:"season_number"`
+	EpisodeNumber uint32 `json:"episode_number"`
+	Overview      string
+	Runtime       uint32
+	AirDate       Date `json:"air_date"`
+
+	VoteAverage float32 `json:"vote_average"`
+	VoteCount   uint32  `json:"vote_count"`
+}
+
+type TMDB struct {
+	key     string
+	lang    string
+	baseUrl string
+	http    *http.Client
+
+	// imageBase is the base URL of images, from the configuration
+	imageOnce sync.Once
+	imageBase string
+}
+
+// SearchMovies streams the movies matching title, from all pages of results
+// up to the limit set with SetSearchPages. The first page is requested
+// before returning, and errc receives its error, or an error when nothing
+// matched. Further pages are requested as the results of the previous one
+// are received.
+func (t *TMDB) SearchMovies(ctx context.Context, title string, options map[string]string) (<-chan MovieSearchResult, <-chan error) {
+	c := make(chan MovieSearchResult)
+	errc := make(chan error, 1)
+	errs := []error{}
+
+	params := []string{
+		fmt.Sprintf("query=%s", url.QueryEscape(title)),
+		"include_adult=true",
+	}
+	for k, v := range options {
+		params = append(params, fmt.Sprintf("%s=%s", k, url.QueryEscape(v)))
+	}
+
+	u := "https://api.themoviedb.org/3/search/movie" +
+		t.query() +
+		"&" + strings.Join(params, "&")
+
+	var movies MovieSearchResults
+	if err := t.get(ctx, u, &movies); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(movies.Results) == 0 {
+		errs = append(errs, fmt.Errorf("no results found at tmdb for title: \"%s\" with options %v", title, options))
+	}
+
+	go streamPages(ctx, c, movies.Results, movies.Page, movies.TotalPages, func(page int) ([]MovieSearchResult, int, error) {
+		var next MovieSearchResults
+		err := t.get(ctx, fmt.Sprintf("%s&page=%d", u, page), &next)
+		return next.Results, next.TotalPages, err
+	})
+	errc <- errors.Join(errs...)
+	return c, errc
+}
+
+func (t *TMDB) SearchMovie(ctx context.Context, title string, options map[string]string) (MovieSearchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	movies, errc := t.SearchMovies(ctx, title, options)
+	if err := <-errc; err != nil {
+		return MovieSearchResult{}, err
+	}
+
+	// TODO: match for more than 1 movie
+	return <-movies, nil
+}
+
+// SearchTV streams the series matching query, like SearchMovies.
+func (t *TMDB) SearchTV(ctx context.Context, query string, options map[string]string) (<-chan TVSearchResult, <-chan error) {
+	c := make(chan TVSearchResult)
+	errc := make(chan error, 1)
+	errs := []error{}
+
+	params := []string{
+		fmt.Sprintf("query=%s", url.QueryEscape(query)),
+	}
+	for k, v := range options {
+		params = append(params, fmt.Sprintf("%s=%s", k, url.QueryEscape(v)))
+	}
+
+	u := "https://api.themoviedb.org/3/search/tv" +
+		t.query() +
+		"&" + strings.Join(params, "&")
+
+	var series TVSearchResults
+	if err := t.get(ctx, u, &series); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(series.Results) == 0 {
+		errs = append(errs, fmt.Errorf("no results found at tmdb for query: \"%s\" with options %v", query, options))
+	}
+
+	go streamPages(ctx, c, series.Results, series.Page, series.TotalPages, func(page int) ([]TVSearchResult, int, error) {
+		var next TVSearchResults
+		err := t.get(ctx, fmt.Sprintf("%s&page=%d", u, page), &next)
+		return next.Results, next.TotalPages, err
+	})
+	errc <- errors.Join(errs...)
+	return c, errc
+}
+
+func (t *TMDB) SearchEpisode(ctx context.Context, series string, seriesYear int, season int, episode int) (EpisodeDetails, TVSearchResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ep EpisodeDetails
+	var searchopts map[string]string
+	if seriesYear > 0 {
+		searchopts = map[string]string{"year": fmt.Sprint(seriesYear)}
+	}
+	res, errc := t.SearchTV(ctx, series, searchopts)
+	if err := <-errc; err != nil {
+		return ep, TVSearchResult{}, err
+	}
+	show := <-res
+
+	query := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/season/%d/episode/%d", show.ID, season, episode) +
+		t.query()
+
+	err := t.get(ctx, query, &ep)
+	return ep, show, err
+}
+
+// streamPages sends results, the results of page, then those of the
+// following pages up to total, or the search page limit, requested with
+// next. Pages are only requested once the previous one was received, so
+// that callers reading a few results don't cost requests. c is closed when
+// all results were sent, a page fails, or ctx is done.
+func streamPages[T any](ctx context.Context, c chan<- T, results []T, page, total int, next func(page int) ([]T, int, error)) {
+	defer close(c)
+	for {
+		for _, r := range results {
+			select {
+			case c <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if page < 1 || page >= total || (searchPages > 0 && page >= searchPages) {
+			return
+		}
+		page++
+		var err error
+		if results, total, err = next(page); err != nil || len(results) == 0 {
+			return
+		}
+	}
+}
+
+func New(k string) *TMDB {
+	t := TMDB{
+		key: k,
+	}
+	return &t
+}
+
+// SetLanguage requests titles, overviews and names in lang, an IETF
+// language tag such as de-DE, from searches and details. TMDB falls back
+// to the original language of what isn't translated. An empty lang
+// requests TMDB's default, English.
+func (t *TMDB) SetLanguage(lang string) {
+	t.lang = lang
+}
+
+// query returns the query string of requests, authenticating them and
+// selecting their language
+func (t *TMDB) query() string {
+	q := "?api_key=" + t.key
+	if t.lang != "" {
+		q += "&language=" + url.QueryEscape(t.lang)
+	}
+	return q
+}
+
+// errRetryable marks errors of requests that may succeed when retried
+var errRetryable = errors.New("retryable")
+
+// do sends the request of r once. Rate limited requests and server errors
+// are reported as retryable, with the delay the server asked for, if any.
+func do(r request) ([]byte, int, time.Duration, error) {
+	// The requester may have given up while the request was queued
+	if err := limiter.Wait(r.ctx); err != nil {
+		return nil, 0, 0, err
+	}
+	req, _ := http.NewRequestWithContext(r.ctx, "GET", r.url, nil)
+	req.Header.Add("accept", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return nil, res.StatusCode, parseRetryAfter(res.Header.Get("Retry-After")), fmt.Errorf("%w: tmdb returned %s", errRetryable, res.Status)
+	}
+	body, err := io.ReadAll(res.Body)
+	return body, res.StatusCode, 0, err
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// responses are the responses kept in memory by URL, shared by the
+// workers, and the URLs being requested by one of them
+var responses = struct {
+	sync.Mutex
+	byURL    map[string]any
+	inflight map[string]chan struct{}
+}{byURL: map[string]any{}, inflight: map[string]chan struct{}{}}
+
+// claim returns the response kept for u, or else claims u for the caller
+// to request, waiting while another requester has, so that it's only
+// requested once. release must be called once a claimed u was answered or
+// failed.
+func claim(ctx context.Context, u string) (cached any, release func(), err error) {
+	for {
+		responses.Lock()
+		if v, ok := responses.byURL[u]; ok {
+			responses.Unlock()
+			return v, nil, nil
+		}
+		wait, busy := responses.inflight[u]
+		if !busy {
+			done := make(chan struct{})
+			responses.inflight[u] = done
+			responses.Unlock()
+			return nil, func() {
+				responses.Lock()
+				delete(responses.inflight, u)
+				responses.Unlock()
+				close(done)
+			}, nil
+		}
+		responses.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// keep keeps the response container of u in memory
+func keep(u string, container any) {
+	responses.Lock()
+	defer responses.Unlock()
+	responses.byURL[u] = container
+}
+
+// fetch2 is a worker answering requests until it's stopped, see SetWorkers
+func fetch2(c <-chan request, stop <-chan struct{}) {
+	for {
+		select {
+		case r := <-c:
+			r.res <- answer(r)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// answer answers r from the Cache set with SetCache, or sends it to TMDB
+// once; the requester looked in memory, see claim. The requests that should
+// be retried are answered with errRetryable, and retried by their
+// requester, so that waiting for them doesn't hold up the worker.
+func answer(r request) result {
+	fresh, _ := r.ctx.Value(noCacheKey{}).(bool)
+	if persist != nil && !fresh {
+		if body, ok := persist.Get(r.ctx, cacheKey(r.url)); ok {
+			if err := json.Unmarshal(body, r.container); err == nil {
+				keep(r.url, r.container)
+				return result{cached: true}
+			}
+		}
+	}
+
+	body, status, retryAfter, err := do(r)
+	if err != nil {
+		return result{err: err, retryAfter: retryAfter}
+	}
+	if err := json.Unmarshal(body, r.container); err != nil {
+		return result{err: err}
+	}
+	keep(r.url, r.container)
+	if persist != nil && status == http.StatusOK {
+		persist.Set(r.ctx, cacheKey(r.url), body)
+	}
+	return result{}
+}
+
+func init() {
+	limiter = rate.NewLimiter(rate.Limit(40), 40) // was 40, 60
+	requestc = make(chan request)
+	SetWorkers(8)
+}
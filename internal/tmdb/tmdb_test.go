@@ -0,0 +1,443 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// rewriteTransport sends all requests to the test server at u
+type rewriteTransport struct {
+	u *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = t.u.Scheme, t.u.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// fakeTMDB sends the requests of all clients to h, returning the number of
+// requests it received. Responses cached in memory by earlier tests are
+// forgotten.
+func fakeTMDB(t *testing.T, h http.HandlerFunc) *atomic.Int32 {
+	t.Helper()
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+		h(w, r)
+	}))
+	u, _ := url.Parse(srv.URL)
+	SetHTTPClient(&http.Client{Transport: rewriteTransport{u}})
+	ResetCache()
+	t.Cleanup(func() {
+		SetHTTPClient(nil)
+		ResetCache()
+		srv.Close()
+	})
+	return &n
+}
+
+// mapCache is a Cache kept in memory
+type mapCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	return []byte(v), ok
+}
+
+func (c *mapCache) Set(ctx context.Context, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = string(value)
+}
+
+func TestPersistentCache(t *testing.T) {
+	cache := &mapCache{values: map[string]string{
+		"https://api.themoviedb.org/3/tv/763002": `{"id":763002,"name":"Cached"}`,
+	}}
+	SetCache(cache)
+	defer SetCache(nil)
+	requests := fakeTMDB(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/763001") {
+			http.Error(w, `{"status_message":"not found"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"id":763001,"name":"Fetched"}`)
+	})
+	ctx := context.Background()
+	client := New("secret")
+
+	// Responses are persisted without the API key
+	s, err := client.TVDetails(ctx, 763001)
+	if err != nil || s.Name != "Fetched" {
+		t.Fatalf("TVDetails() = %v, %v", s, err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("TMDB received %d requests, want 1", got)
+	}
+
+	// Persisted responses are used without a request
+	s, err = client.TVDetails(ctx, 763002)
+	if err != nil || s.Name != "Cached" {
+		t.Fatalf("TVDetails() of a persisted response = %v, %v", s, err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("TMDB received %d requests, want 1", got)
+	}
+
+	// Errors aren't persisted
+	if _, err := client.TVDetails(ctx, 763003); err == nil {
+		t.Error("TVDetails() of a missing series returned no error")
+	}
+
+	want := map[string]string{
+		"https://api.themoviedb.org/3/tv/763001": `{"id":763001,"name":"Fetched"}`,
+		"https://api.themoviedb.org/3/tv/763002": `{"id":763002,"name":"Cached"}`,
+	}
+	if diff := cmp.Diff(want, cache.values); diff != "" {
+		t.Errorf("persisted responses mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"120", 2 * time.Minute},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), -time.Hour},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Hour},
+	}
+	for _, tt := range tests {
+		// HTTP dates have a resolution of a second
+		if got := parseRetryAfter(tt.header); got < tt.want-2*time.Second || got > tt.want+time.Second {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := retryPolicy{base: time.Second, max: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{80, 10 * time.Second}, // the shift overflows
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) without jitter = %s, want %s", tt.attempt, got, tt.want)
+		}
+		p.jitter = 0.5
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(tt.attempt); got < tt.want || got > tt.want+tt.want/2 {
+				t.Errorf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.want, tt.want+tt.want/2)
+			}
+		}
+		p.jitter = 0
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	p := retryPolicy{base: time.Second, max: time.Minute}
+	tests := []struct {
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{0, time.Second},
+		{-time.Hour, time.Second}, // a date in the past
+		{30 * time.Second, 30 * time.Second},
+		{time.Hour, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.wait(1, tt.retryAfter); got != tt.want {
+			t.Errorf("wait(1, %s) = %s, want %s", tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	defer func(p retryPolicy) { retries = p }(retries)
+	SetRetries(3, time.Millisecond, 0)
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	requests := fakeTMDB(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/763101") && n < 3:
+			// Retry-After is capped to the largest delay, which the test
+			// shortens
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case strings.HasSuffix(r.URL.Path, "/763102"):
+			w.WriteHeader(http.StatusBadGateway)
+		case strings.HasSuffix(r.URL.Path, "/763103"):
+			http.Error(w, `{}`, http.StatusNotFound)
+		default:
+			fmt.Fprintf(w, `{"id":%s,"name":"Show"}`, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		}
+	})
+	retries.max = 5 * time.Millisecond
+	ctx := context.Background()
+	client := New("test")
+
+	start := time.Now()
+	if s, err := client.TVDetails(ctx, 763101); err != nil || s.ID != 763101 {
+		t.Errorf("TVDetails() after rate limiting = %v, %v", s, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("TVDetails() waited %s, the Retry-After header wasn't capped", d)
+	}
+	if _, err := client.TVDetails(ctx, 763102); err == nil {
+		t.Error("TVDetails() of a failing server returned no error")
+	}
+	if _, err := client.TVDetails(ctx, 763103); err == nil {
+		t.Error("TVDetails() of a missing series returned no error")
+	}
+
+	want := map[string]int{"/3/tv/763101": 3, "/3/tv/763102": 3, "/3/tv/763103": 1}
+	if diff := cmp.Diff(want, attempts); diff != "" {
+		t.Errorf("attempts mismatch (-want +got):\n%s", diff)
+	}
+	if got := requests.Load(); got != 7 {
+		t.Errorf("TMDB received %d requests, want 7", got)
+	}
+
+	// Retries stop when the requester gives up
+	SetRetries(10, time.Hour, 0)
+	retries.max = time.Hour
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := client.TVDetails(ctx, 763102); err == nil {
+		t.Error("TVDetails() of a failing server returned no error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("TVDetails() kept retrying for %s after its context was done", d)
+	}
+}
+
+func TestRetriesDontBlock(t *testing.T) {
+	defer func(p retryPolicy) { retries = p }(retries)
+	SetRetries(2, time.Hour, 0)
+	retries.max = time.Second
+
+	limited := make(chan struct{}, 1)
+	fakeTMDB(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/763201") {
+			select {
+			case limited <- struct{}{}:
+			default:
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprintf(w, `{"id":%s,"name":"Show"}`, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	})
+	ctx := context.Background()
+	client := New("test")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.TVDetails(ctx, 763201)
+	}()
+	<-limited
+	// The other request is answered while the rate limited one waits
+	start := time.Now()
+	if s, err := client.TVDetails(ctx, 763202); err != nil || s.ID != 763202 {
+		t.Errorf("TVDetails() = %v, %v", s, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("TVDetails() waited %s for the retries of another request", d)
+	}
+	<-done
+}
+
+func TestWorkers(t *testing.T) {
+	defer SetWorkers(8)
+	SetWorkers(3)
+
+	// Each request is answered once three are in flight at once
+	var mu sync.Mutex
+	inflight := 0
+	all := make(chan struct{})
+	requests := fakeTMDB(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if inflight++; inflight == 3 {
+			close(all)
+		}
+		mu.Unlock()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		fmt.Fprintf(w, `{"id":%s,"name":"Show"}`, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	})
+	ctx := context.Background()
+	client := New("test")
+
+	var wg sync.WaitGroup
+	for _, id := range []int{763301, 763302, 763303, 763301, 763302} {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if s, err := client.TVDetails(ctx, id); err != nil || s.ID != uint32(id) {
+				t.Errorf("TVDetails(%d) = %v, %v", id, s, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	// The same series requested twice at once is only requested once
+	if got := requests.Load(); got != 3 {
+		t.Errorf("TMDB received %d requests, want 3", got)
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	defer SetSearchPages(searchPages)
+
+	var mu sync.Mutex
+	var pages []string
+	fakeTMDB(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		page := q.Get("page")
+		if page == "" {
+			page = "1"
+		}
+		mu.Lock()
+		pages = append(pages, q.Get("query")+"/"+page)
+		mu.Unlock()
+		if q.Get("query") == "none" {
+			fmt.Fprint(w, `{"page":1,"results":[],"total_pages":0,"total_results":0}`)
+			return
+		}
+		fmt.Fprintf(w, `{"page":%s,"results":[{"id":%s1},{"id":%s2}],"total_pages":3,"total_results":6}`, page, page, page)
+	})
+	client := New("test")
+
+	search := func(t *testing.T, ctx context.Context, query string, n int) []uint32 {
+		mu.Lock()
+		pages = nil
+		mu.Unlock()
+		c, errc := client.SearchMovies(ctx, query, nil)
+		if err := <-errc; err != nil {
+			t.Fatalf("SearchMovies(%q) returned %v", query, err)
+		}
+		var ids []uint32
+		for r := range c {
+			ids = append(ids, r.ID)
+			if len(ids) == n {
+				break
+			}
+		}
+		return ids
+	}
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		read  int
+		ids   []uint32
+		pages []string
+	}{
+		{"all pages", "all", 0, 0, []uint32{11, 12, 21, 22, 31, 32}, []string{"all/1", "all/2", "all/3"}},
+		{"limited pages", "limited", 2, 0, []uint32{11, 12, 21, 22}, []string{"limited/1", "limited/2"}},
+		{"first result", "first", 0, 1, []uint32{11}, []string{"first/1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSearchPages(tt.limit)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ids := search(t, ctx, tt.query, tt.read)
+			if diff := cmp.Diff(tt.ids, ids); diff != "" {
+				t.Errorf("results mismatch (-want +got):\n%s", diff)
+			}
+			cancel()
+			// A page being requested when the reader stopped may still arrive
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			if diff := cmp.Diff(tt.pages, pages); diff != "" {
+				t.Errorf("requested pages mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	SetSearchPages(0)
+	_, errc := client.SearchMovies(context.Background(), "none", nil)
+	if err := <-errc; err == nil {
+		t.Error("SearchMovies() without results returned no error")
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	var mu sync.Mutex
+	var langs []string
+	fakeTMDB(t, func(w http.ResponseWriter, r *http.Request) {
+		lang := r.URL.Query().Get("language")
+		mu.Lock()
+		langs = append(langs, r.URL.Path+" "+lang)
+		mu.Unlock()
+		title := "The Lives of Others"
+		if lang == "de-DE" {
+			title = "Das Leben der Anderen"
+		}
+		if strings.HasPrefix(r.URL.Path, "/3/search/") {
+			fmt.Fprintf(w, `{"page":1,"results":[{"id":763201,"title":%q}],"total_pages":1}`, title)
+			return
+		}
+		fmt.Fprintf(w, `{"id":763201,"title":%q}`, title)
+	})
+	ctx := context.Background()
+
+	client := New("test")
+	client.SetLanguage("de-DE")
+	m, err := client.SearchMovie(ctx, "Lives of Others", nil)
+	if err != nil || m.Title != "Das Leben der Anderen" {
+		t.Errorf("SearchMovie() in German = %v, %v", m, err)
+	}
+	d, err := client.MovieDetails(ctx, 763201)
+	if err != nil || d.Title != "Das Leben der Anderen" {
+		t.Errorf("MovieDetails() in German = %v, %v", d, err)
+	}
+	// Responses in other languages are cached separately
+	d, err = New("test").MovieDetails(ctx, 763201)
+	if err != nil || d.Title != "The Lives of Others" {
+		t.Errorf("MovieDetails() = %v, %v", d, err)
+	}
+
+	want := []string{"/3/search/movie de-DE", "/3/movie/763201 de-DE", "/3/movie/763201 "}
+	if diff := cmp.Diff(want, langs); diff != "" {
+		t.Errorf("requested languages mismatch (-want +got):\n%s", diff)
+	}
+}
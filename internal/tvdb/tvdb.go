@@ -0,0 +1,272 @@
+// Package tvdb is a client of TheTVDB v4 API, looking up series, their
+// episodes, and movies.
+package tvdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const baseURL = "https://api4.thetvdb.com/v4"
+
+// Search types
+const (
+	TypeSeries = "series"
+	TypeMovie  = "movie"
+)
+
+var (
+	limiter = rate.NewLimiter(rate.Limit(20), 20)
+	persist Cache
+	// attempts is how often rate limited requests and server errors are
+	// made, waiting backoff, doubled after each attempt, in between
+	attempts = 3
+	backoff  = time.Second
+)
+
+// Cache keeps TVDB responses beyond the lifetime of the process, keyed by
+// their URL. Like TMDB responses, they rarely change.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte)
+}
+
+// SetCache persists responses in c, or in nothing when c is nil. It applies
+// to all clients, and is set before the first request.
+func SetCache(c Cache) {
+	persist = c
+}
+
+// Client looks up series and movies on TheTVDB. It logs in with its API key
+// on the first request, and again when its token expires.
+type Client struct {
+	key string
+	pin string
+
+	mu    sync.Mutex
+	token string
+}
+
+// New returns a client authenticated by the project API key, and the PIN of
+// the subscriber for user-supported keys, or "" for others.
+func New(key, pin string) *Client {
+	return &Client{key: key, pin: pin}
+}
+
+// RemoteID is the ID of a series or movie at another site
+type RemoteID struct {
+	ID         string `json:"id"`
+	SourceName string `json:"sourceName"`
+}
+
+// SearchResult is a series or movie matching a search
+type SearchResult struct {
+	ID        string     `json:"tvdb_id"`
+	Name      string     `json:"name"`
+	Year      string     `json:"year"`
+	RemoteIDs []RemoteID `json:"remote_ids"`
+}
+
+// TMDBID returns the TMDB ID of r, or 0 when TheTVDB doesn't know it.
+func (r SearchResult) TMDBID() int {
+	for _, id := range r.RemoteIDs {
+		if id.SourceName == "TheMovieDB.com" {
+			n, _ := strconv.Atoi(id.ID)
+			return n
+		}
+	}
+	return 0
+}
+
+// Episode is an episode of a series, numbered as aired
+type Episode struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	SeasonNumber int    `json:"seasonNumber"`
+	Number       int    `json:"number"`
+}
+
+// Search returns the series or movies, as kind is TypeSeries or TypeMovie,
+// matching query, released in year unless it's 0, best match first. It
+// returns an error when nothing matched.
+func (c *Client) Search(ctx context.Context, query, kind string, year int) ([]SearchResult, error) {
+	q := url.Values{"query": {query}, "type": {kind}}
+	if year > 0 {
+		q.Set("year", fmt.Sprint(year))
+	}
+	var results []SearchResult
+	if err := c.get(ctx, "/search?"+q.Encode(), &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no results found at tvdb for %s %q", kind, query)
+	}
+	return results, nil
+}
+
+// Episode returns the episode of the series with the given TVDB ID.
+func (c *Client) Episode(ctx context.Context, seriesID string, season, episode int) (Episode, error) {
+	q := url.Values{"season": {fmt.Sprint(season)}, "episodeNumber": {fmt.Sprint(episode)}}
+	var res struct {
+		Episodes []Episode `json:"episodes"`
+	}
+	if err := c.get(ctx, "/series/"+url.PathEscape(seriesID)+"/episodes/default?"+q.Encode(), &res); err != nil {
+		return Episode{}, err
+	}
+	for _, e := range res.Episodes {
+		if e.SeasonNumber == season && e.Number == episode {
+			return e, nil
+		}
+	}
+	return Episode{}, fmt.Errorf("no episode found at tvdb for series %s, season %d, episode %d", seriesID, season, episode)
+}
+
+// errRetryable marks errors of requests that may succeed when retried
+var errRetryable = errors.New("retryable")
+
+// errUnauthorized marks requests made with an expired token
+var errUnauthorized = errors.New("unauthorized")
+
+// get decodes the data of the response to the API request of path into v.
+// Responses are cached, and rate limited requests and server errors are
+// retried.
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	u := baseURL + path
+	if persist != nil {
+		if b, ok := persist.Get(ctx, u); ok {
+			if err := decode(b, v); err == nil {
+				return nil
+			}
+		}
+	}
+
+	var b []byte
+	var err error
+	relogin := true
+	for attempt := 1; ; attempt++ {
+		b, err = c.do(ctx, u)
+		if errors.Is(err, errUnauthorized) && relogin {
+			relogin = false
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+			continue
+		}
+		if !errors.Is(err, errRetryable) || attempt >= attempts {
+			break
+		}
+		select {
+		case <-time.After(backoff << (attempt - 1)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := decode(b, v); err != nil {
+		return err
+	}
+	if persist != nil {
+		persist.Set(ctx, u, b)
+	}
+	return nil
+}
+
+// decode decodes the data of a response into v
+func decode(b []byte, v any) error {
+	var res struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return fmt.Errorf("failed to parse tvdb response with error %w", err)
+	}
+	if len(res.Data) == 0 || string(res.Data) == "null" {
+		return errors.New("tvdb response has no data")
+	}
+	return json.Unmarshal(res.Data, v)
+}
+
+// do sends the request of u once, logging in first if needed
+func (c *Client) do(ctx context.Context, u string) ([]byte, error) {
+	token, err := c.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: tvdb returned %s", errUnauthorized, res.Status)
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: tvdb returned %s", errRetryable, res.Status)
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("tvdb returned %s for %s", res.Status, u)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// login returns the token of c, logging in when it has none
+func (c *Client) login(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+	body, err := json.Marshal(map[string]string{"apikey": c.key, "pin": c.pin})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/login", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("content-type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("tvdb login failed: %s", res.Status)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := decode(b, &data); err != nil {
+		return "", err
+	}
+	if data.Token == "" {
+		return "", errors.New("tvdb login returned no token")
+	}
+	c.token = data.Token
+	return c.token, nil
+}
@@ -0,0 +1,137 @@
+package tvdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// rewriteTransport sends all requests to the test server at u
+type rewriteTransport struct {
+	u *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = t.u.Scheme, t.u.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// fakeTVDB sends the requests of all clients to h
+func fakeTVDB(t *testing.T, h http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	u, _ := url.Parse(srv.URL)
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = rewriteTransport{u}
+	t.Cleanup(func() {
+		http.DefaultClient.Transport = transport
+		srv.Close()
+	})
+}
+
+// mapCache is a Cache kept in memory
+type mapCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	return []byte(v), ok
+}
+
+func (c *mapCache) Set(ctx context.Context, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = string(value)
+}
+
+func TestClient(t *testing.T) {
+	defer func(d time.Duration) { backoff = d }(backoff)
+	backoff = time.Millisecond
+	cache := &mapCache{values: map[string]string{}}
+	SetCache(cache)
+	defer SetCache(nil)
+
+	var mu sync.Mutex
+	var requests []string
+	logins, failures := 0, 0
+	fakeTVDB(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/v4/login" {
+			logins++
+			fmt.Fprintf(w, `{"status":"success","data":{"token":"token%d"}}`, logins)
+			return
+		}
+		// The first token expires after a request
+		if r.Header.Get("authorization") != "Bearer token2" && len(requests) > 2 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/v4/search" && q.Get("query") == "Breaking Bad" && q.Get("type") == TypeSeries:
+			fmt.Fprint(w, `{"status":"success","data":[{"tvdb_id":"81189","name":"Breaking Bad","year":"2008",
+				"remote_ids":[{"id":"tt0903747","sourceName":"IMDB"},{"id":"1396","sourceName":"TheMovieDB.com"}]}]}`)
+		case r.URL.Path == "/v4/search":
+			fmt.Fprint(w, `{"status":"success","data":[]}`)
+		case r.URL.Path == "/v4/series/81189/episodes/default" && failures < 1:
+			failures++
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/v4/series/81189/episodes/default":
+			fmt.Fprintf(w, `{"status":"success","data":{"episodes":[{"id":349232,"name":"Pilot","seasonNumber":%s,"number":%s}]}}`,
+				q.Get("season"), q.Get("episodeNumber"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.Background()
+	c := New("key", "")
+
+	series, err := c.Search(ctx, "Breaking Bad", TypeSeries, 2008)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || series[0].ID != "81189" || series[0].TMDBID() != 1396 {
+		t.Errorf("Search() = %v", series)
+	}
+	if _, err := c.Search(ctx, "Nothing", TypeMovie, 0); err == nil {
+		t.Error("Search() without results returned no error")
+	}
+	ep, err := c.Episode(ctx, "81189", 1, 1)
+	if err != nil || ep.Name != "Pilot" {
+		t.Errorf("Episode() = %v, %v", ep, err)
+	}
+	// Responses are cached
+	if _, err := c.Search(ctx, "Breaking Bad", TypeSeries, 2008); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"POST /v4/login",
+		"GET /v4/search",
+		"GET /v4/search",
+		"POST /v4/login",
+		"GET /v4/search",
+		"GET /v4/series/81189/episodes/default",
+		"GET /v4/series/81189/episodes/default",
+	}
+	if diff := cmp.Diff(want, requests); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+	if len(cache.values) != 3 {
+		t.Errorf("%d responses were cached, want 3", len(cache.values))
+	}
+}
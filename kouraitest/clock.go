@@ -0,0 +1,69 @@
+package kouraitest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock whose time only passes when advanced, to simulate
+// the settle time of files and the expiry of ignores. Give it to
+// kourai.WithClock.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewClock returns a clock telling now until advanced.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of c.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After sends the time on the channel once c was advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := waiter{c.now.Add(d), make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+	} else {
+		c.waiters = append(c.waiters, w)
+	}
+	return w.c
+}
+
+// Waiting returns the number of After calls waiting for c to be advanced,
+// e.g. to advance it once the files of a run are being waited for.
+func (c *Clock) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Advance passes d on c, waking the After calls due by then.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = pending
+}
@@ -0,0 +1,374 @@
+// Package kouraitest helps writing end-to-end tests of kourai pipelines,
+// e.g. of custom filters and target templates, without network access. It
+// answers TMDB requests with a fake server knowing a few canned movies and
+// series, and builds the trees of source files to link.
+//
+// The kourai package keeps its options in a single global, so tests using
+// this package shouldn't run in parallel.
+package kouraitest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+	kourai "github.com/alzabo/kourai/pkg"
+)
+
+// APIKey is the TMDB API key of the fake server. It accepts any key.
+const APIKey = "kouraitest"
+
+// Movie is a movie known to the fake TMDB
+type Movie struct {
+	ID    int
+	Title string
+	// ReleaseDate is formatted as 2006-01-02, or empty when unknown
+	ReleaseDate string
+	IMDbID      string
+}
+
+// Series is a series known to the fake TMDB, with its episodes
+type Series struct {
+	ID   int
+	Name string
+	// FirstAirDate is formatted as 2006-01-02, or empty when unknown
+	FirstAirDate  string
+	OriginCountry []string
+	Episodes      []Episode
+}
+
+// Episode is an episode of a Series
+type Episode struct {
+	Season  int
+	Episode int
+	Name    string
+	// AirDate is formatted as 2006-01-02, or empty when unknown
+	AirDate string
+}
+
+// Canned fixtures known to every fake TMDB
+var (
+	Movies = []Movie{
+		{ID: 949, Title: "Heat", ReleaseDate: "1995-12-15", IMDbID: "tt0113277"},
+		{ID: 603, Title: "The Matrix", ReleaseDate: "1999-03-31", IMDbID: "tt0133093"},
+		{ID: 438631, Title: "Dune", ReleaseDate: "2021-09-15", IMDbID: "tt1160419"},
+		{ID: 841, Title: "Dune", ReleaseDate: "1984-12-14", IMDbID: "tt0087182"},
+		{ID: 18491, Title: "Neon Genesis Evangelion: The End of Evangelion", ReleaseDate: "1997-07-19"},
+	}
+	TV = []Series{
+		{ID: 1396, Name: "Breaking Bad", FirstAirDate: "2008-01-20", OriginCountry: []string{"US"}, Episodes: []Episode{
+			{1, 1, "Pilot", "2008-01-20"},
+			{1, 2, "Cat's in the Bag...", "2008-01-27"},
+			{1, 3, "...And the Bag's in the River", "2008-02-10"},
+			{2, 1, "Seven Thirty-Seven", "2009-03-08"},
+		}},
+		{ID: 1438, Name: "The Wire", FirstAirDate: "2002-06-02", OriginCountry: []string{"US"}, Episodes: []Episode{
+			{1, 1, "The Target", "2002-06-02"},
+			{1, 2, "The Detail", "2002-06-09"},
+		}},
+		{ID: 890, Name: "Neon Genesis Evangelion", FirstAirDate: "1995-10-04", OriginCountry: []string{"JP"}, Episodes: []Episode{
+			{1, 1, "Angel Attack", "1995-10-04"},
+		}},
+	}
+)
+
+// TMDB is a fake TMDB API server. The TMDB clients of the process send
+// their requests to it until the test ends.
+type TMDB struct {
+	mu       sync.Mutex
+	movies   map[int]Movie
+	series   map[int]Series
+	requests []string
+}
+
+// NewTMDB starts a fake TMDB API server knowing Movies and TV, and sends
+// the requests of the TMDB clients of the process to it until t ends.
+// Responses cached in memory by earlier tests are forgotten.
+func NewTMDB(t testing.TB) *TMDB {
+	t.Helper()
+	f := &TMDB{movies: map[int]Movie{}, series: map[int]Series{}}
+	for _, m := range Movies {
+		f.AddMovie(m)
+	}
+	for _, s := range TV {
+		f.AddSeries(s)
+	}
+	srv := httptest.NewServer(f)
+	u, _ := url.Parse(srv.URL)
+	tmdb.SetHTTPClient(&http.Client{Transport: rewriteTransport{u}})
+	tmdb.ResetCache()
+	t.Cleanup(func() {
+		tmdb.SetHTTPClient(nil)
+		tmdb.ResetCache()
+		srv.Close()
+	})
+	return f
+}
+
+// AddMovie adds m to the movies the server knows, replacing the movie of
+// the same ID.
+func (f *TMDB) AddMovie(m Movie) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.movies[m.ID] = m
+}
+
+// AddSeries adds s to the series the server knows, replacing the series of
+// the same ID.
+func (f *TMDB) AddSeries(s Series) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.series[s.ID] = s
+}
+
+// Requests returns the paths of the requests the server answered, e.g.
+// "/3/search/movie", in order.
+func (f *TMDB) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// Options returns the options looking media up on the server.
+func (f *TMDB) Options() []kourai.Option {
+	return []kourai.Option{kourai.WithTMDBApiKey(APIKey)}
+}
+
+// rewriteTransport sends all requests to the host of u
+type rewriteTransport struct {
+	u *url.URL
+}
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.u.Scheme
+	req.URL.Host = rt.u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// png is an image of a single transparent pixel, answering image downloads
+var png = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\x00\x01\x00\x00\x05\x00\x01\r\n-\xb4\x00\x00\x00\x00IEND\xaeB`\x82")
+
+var (
+	movieExpr   = regexp.MustCompile(`^/3/movie/(\d+)(/credits|/external_ids)?$`)
+	seriesExpr  = regexp.MustCompile(`^/3/tv/(\d+)(?:/season/(\d+)(?:/episode/(\d+))?)?(/credits|/external_ids)?$`)
+	nonWordExpr = regexp.MustCompile(`[^\pL\pN]+`)
+)
+
+func (f *TMDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.URL.Path)
+
+	q := r.URL.Query()
+	year := q.Get("year")
+	if year == "" {
+		year = q.Get("first_air_date_year")
+	}
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/t/p/"):
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	case path == "/3/search/movie":
+		results := []map[string]any{}
+		for _, m := range sorted(f.movies) {
+			if matches(q.Get("query"), m.Title) && (year == "" || strings.HasPrefix(m.ReleaseDate, year)) {
+				results = append(results, map[string]any{"id": m.ID, "title": m.Title, "release_date": m.ReleaseDate})
+			}
+		}
+		writeJSON(w, map[string]any{"page": 1, "total_pages": 1, "total_results": len(results), "results": results})
+	case path == "/3/search/tv":
+		results := []map[string]any{}
+		for _, s := range sorted(f.series) {
+			if matches(q.Get("query"), s.Name) && (year == "" || strings.HasPrefix(s.FirstAirDate, year)) {
+				results = append(results, map[string]any{"id": s.ID, "name": s.Name, "first_air_date": s.FirstAirDate, "origin_country": s.OriginCountry})
+			}
+		}
+		writeJSON(w, map[string]any{"page": 1, "total_pages": 1, "total_results": len(results), "results": results})
+	case strings.HasPrefix(path, "/3/find/"):
+		writeJSON(w, map[string]any{"movie_results": f.findMovies(strings.TrimPrefix(path, "/3/find/")), "tv_results": []any{}, "tv_episode_results": []any{}})
+	case movieExpr.MatchString(path):
+		m := movieExpr.FindStringSubmatch(path)
+		id, _ := strconv.Atoi(m[1])
+		movie, ok := f.movies[id]
+		if !ok {
+			notFound(w)
+			return
+		}
+		switch m[2] {
+		case "/credits":
+			writeJSON(w, map[string]any{"id": id, "cast": []any{}, "crew": []any{}})
+		case "/external_ids":
+			writeJSON(w, map[string]any{"id": id, "imdb_id": movie.IMDbID})
+		default:
+			writeJSON(w, map[string]any{"id": id, "title": movie.Title, "original_title": movie.Title, "release_date": movie.ReleaseDate, "imdb_id": movie.IMDbID})
+		}
+	case seriesExpr.MatchString(path):
+		f.serveSeries(w, seriesExpr.FindStringSubmatch(path))
+	default:
+		notFound(w)
+	}
+}
+
+// serveSeries answers requests of a series, one of its seasons or episodes,
+// as matched by seriesExpr
+func (f *TMDB) serveSeries(w http.ResponseWriter, m []string) {
+	id, _ := strconv.Atoi(m[1])
+	s, ok := f.series[id]
+	if !ok {
+		notFound(w)
+		return
+	}
+	if m[2] == "" {
+		seasons := []map[string]any{}
+		for _, e := range s.Episodes {
+			if len(seasons) == 0 || seasons[len(seasons)-1]["season_number"] != e.Season {
+				seasons = append(seasons, map[string]any{"id": id*100 + e.Season, "season_number": e.Season, "name": fmt.Sprintf("Season %d", e.Season), "air_date": e.AirDate, "episode_count": 0})
+			}
+			seasons[len(seasons)-1]["episode_count"] = seasons[len(seasons)-1]["episode_count"].(int) + 1
+		}
+		writeJSON(w, map[string]any{"id": id, "name": s.Name, "original_name": s.Name, "first_air_date": s.FirstAirDate, "origin_country": s.OriginCountry, "seasons": seasons})
+		return
+	}
+
+	season, _ := strconv.Atoi(m[2])
+	episodes := []map[string]any{}
+	for _, e := range s.Episodes {
+		if e.Season != season || (m[3] != "" && strconv.Itoa(e.Episode) != m[3]) {
+			continue
+		}
+		episodes = append(episodes, map[string]any{"id": id*10000 + e.Season*100 + e.Episode, "name": e.Name, "season_number": e.Season, "episode_number": e.Episode, "air_date": e.AirDate})
+	}
+	switch {
+	case len(episodes) == 0:
+		notFound(w)
+	case m[3] == "":
+		writeJSON(w, map[string]any{"id": id*100 + season, "season_number": season, "episodes": episodes})
+	case m[4] == "/credits":
+		writeJSON(w, map[string]any{"id": episodes[0]["id"], "cast": []any{}, "crew": []any{}, "guest_stars": []any{}})
+	case m[4] == "/external_ids":
+		writeJSON(w, map[string]any{"id": episodes[0]["id"]})
+	default:
+		writeJSON(w, episodes[0])
+	}
+}
+
+// findMovies returns the search results of the movies with the IMDb ID id
+func (f *TMDB) findMovies(id string) []map[string]any {
+	results := []map[string]any{}
+	for _, m := range sorted(f.movies) {
+		if m.IMDbID != "" && m.IMDbID == id {
+			results = append(results, map[string]any{"id": m.ID, "title": m.Title, "release_date": m.ReleaseDate})
+		}
+	}
+	return results
+}
+
+// matches reports whether the search query matches title, ignoring case
+// and punctuation
+func matches(query, title string) bool {
+	normalize := func(s string) string {
+		return strings.TrimSpace(nonWordExpr.ReplaceAllString(strings.ToLower(s), " "))
+	}
+	q := normalize(query)
+	return q != "" && strings.Contains(normalize(title), q)
+}
+
+// sorted returns the values of m ordered by their ID
+func sorted[T any](m map[int]T) []T {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	values := make([]T, len(ids))
+	for i, id := range ids {
+		values[i] = m[id]
+	}
+	return values
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func notFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, `{"success": false, "status_code": 34, "status_message": "The resource you requested could not be found."}`)
+}
+
+// Tree creates the files at the given slash-separated paths below a
+// temporary directory removed when t ends, and returns the directory. Files
+// are empty, unless their path is followed by "=" and their content.
+func Tree(t testing.TB, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range files {
+		name, content, _ := strings.Cut(f, "=")
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// Files returns the slash-separated paths of the files below root,
+// relative to it and sorted.
+func Files(t testing.TB, root string) []string {
+	t.Helper()
+	files := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Link runs kourai.LinkFromFiles with opts and creates the links it sends,
+// failing t on errors. It returns the links, sorted by target.
+func Link(t testing.TB, opts ...kourai.Option) []kourai.Link {
+	t.Helper()
+	ctx := context.Background()
+	linkc, errc := kourai.LinkFromFiles(ctx, opts...)
+	links := []kourai.Link{}
+	for ln := range linkc {
+		if err := ln.Create(); err != nil {
+			t.Errorf("failed to link %s to %s: %v", ln.Src, ln.Target, err)
+			continue
+		}
+		links = append(links, ln)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Target < links[j].Target })
+	return links
+}
@@ -0,0 +1,144 @@
+package kouraitest_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alzabo/kourai/kouraitest"
+	kourai "github.com/alzabo/kourai/pkg"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLink(t *testing.T) {
+	fake := kouraitest.NewTMDB(t)
+	fake.AddMovie(kouraitest.Movie{ID: 767001, Title: "Kouraitest", ReleaseDate: "2024-01-02"})
+	src := kouraitest.Tree(t,
+		"downloads/Heat.1995.1080p.BluRay.mkv",
+		"downloads/kouraitest.2024.mkv",
+		"downloads/Breaking.Bad.S01E02.720p.mkv",
+		"downloads/readme.txt=not media",
+	)
+	dest := t.TempDir()
+	movie, err := kourai.ParseTargetTemplate("Films/{{.Title}} ({{.Year}}){{.Ext}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := append(fake.Options(),
+		kourai.WithSources([]string{src}),
+		kourai.WithDestination(dest),
+		kourai.WithFileExtensions([]string{"mkv"}),
+		kourai.WithTargetTemplates(movie, nil),
+	)
+	kouraitest.Link(t, opts...)
+
+	want := []string{
+		"Films/Heat (1995).mkv",
+		"Films/Kouraitest (2024).mkv",
+		"tv/Breaking Bad/Season 1/Breaking Bad - S01E02 - Cat's in the Bag....mkv",
+	}
+	if diff := cmp.Diff(want, kouraitest.Files(t, dest)); diff != "" {
+		t.Errorf("linked files mismatch (-want +got):\n%s", diff)
+	}
+	if len(fake.Requests()) == 0 {
+		t.Error("no requests were sent to the fake TMDB")
+	}
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := kouraitest.NewClock(start)
+	src := t.TempDir()
+	files := fstest.MapFS{
+		"Heat.1995.mkv":  {Data: []byte("video"), ModTime: start.Add(-time.Hour)},
+		"Alien.1979.mkv": {Data: []byte("video"), ModTime: start.Add(-10 * time.Second)},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	links, errc := kourai.LinkFromFiles(ctx,
+		kourai.WithClock(clock),
+		kourai.WithFileSystem(kourai.MountFS(src, files)),
+		kourai.WithSources([]string{src}),
+		kourai.WithDestination(t.TempDir()),
+		kourai.WithFileExtensions([]string{"mkv"}),
+		kourai.WithSettleTime(time.Minute),
+	)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	// Options accumulate over runs, so later tests get the system's clock
+	// and file system back
+	defer func() {
+		done, cancel := context.WithCancel(context.Background())
+		cancel()
+		links, _ := kourai.LinkFromFiles(done, kourai.WithClock(nil), kourai.WithFileSystem(nil), kourai.WithSettleTime(0))
+		for range links {
+		}
+	}()
+
+	// Heat settled long ago, while Alien is waited for until the clock
+	// passes its settle time
+	if l := <-links; filepath.Base(l.Src) != "Heat.1995.mkv" {
+		t.Errorf("first link = %s, want Heat.1995.mkv", l.Src)
+	}
+	for clock.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	if l := <-links; filepath.Base(l.Src) != "Alien.1979.mkv" {
+		t.Errorf("second link = %s, want Alien.1979.mkv", l.Src)
+	}
+}
+
+func TestWatchClock(t *testing.T) {
+	clock := kouraitest.NewClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	src := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	links, errc := kourai.Watch(ctx, time.Minute,
+		kourai.WithClock(clock),
+		kourai.WithSources([]string{src}),
+		kourai.WithDestination(t.TempDir()),
+		kourai.WithFileExtensions([]string{"mkv"}),
+	)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		done, cancel := context.WithCancel(context.Background())
+		cancel()
+		links, _ := kourai.LinkFromFiles(done, kourai.WithClock(nil))
+		for range links {
+		}
+	}()
+
+	if err := os.WriteFile(filepath.Join(src, "Heat.1995.mkv"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The file is only linked once the clock passed the quiet time, which
+	// would take a minute of the system's clock
+	var advanced time.Duration
+	for {
+		select {
+		case l := <-links:
+			if filepath.Base(l.Src) != "Heat.1995.mkv" {
+				t.Errorf("link = %s, want Heat.1995.mkv", l.Src)
+			}
+			if advanced < time.Minute {
+				t.Errorf("linked after the clock was advanced by %s, want at least a minute", advanced)
+			}
+			return
+		case <-ctx.Done():
+			t.Fatal("Watch() didn't link the file by the time of its clock")
+		case <-time.After(10 * time.Millisecond):
+			if clock.Waiting() > 0 {
+				clock.Advance(10 * time.Second)
+				advanced += 10 * time.Second
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	AliasMovie  = "movie"
+	AliasSeries = "series"
+)
+
+var aliasNormalizeExpr = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// Alias maps a title, as parsed from file names, to the TMDB ID chosen for
+// it when a match was corrected.
+type Alias struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Year  int    `json:"year,omitempty"`
+	ID    int    `json:"id"`
+}
+
+// AliasDB holds aliases learned from corrections, in a JSON file or in a
+// Store. Aliases are consulted before searching TMDB, so a mistake only
+// needs to be corrected once.
+type AliasDB struct {
+	path    string
+	store   Store
+	mu      sync.Mutex
+	aliases map[string]Alias
+}
+
+const aliasBucket = "aliases"
+
+// OpenAliasDB loads the alias database at path. A missing file is an empty
+// database, created when the first alias is recorded.
+func OpenAliasDB(path string) (*AliasDB, error) {
+	db := &AliasDB{path: path, aliases: map[string]Alias{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	aliases := []Alias{}
+	if err := json.Unmarshal(b, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to parse alias database %s with error %w", path, err)
+	}
+	for _, a := range aliases {
+		db.aliases[aliasKey(a.Type, a.Title, a.Year)] = a
+	}
+	return db, nil
+}
+
+// NewStoreAliasDB keeps aliases in store. Aliases are read from the store
+// on every lookup, so machines sharing it see the corrections made on any
+// of them.
+func NewStoreAliasDB(store Store) *AliasDB {
+	return &AliasDB{store: store}
+}
+
+// aliasKey normalizes titles so that differences in case and punctuation
+// between file names don't matter.
+func aliasKey(kind, title string, year int) string {
+	t := strings.TrimSpace(aliasNormalizeExpr.ReplaceAllString(strings.ToLower(title), " "))
+	if year > 0 {
+		return fmt.Sprintf("%s:%s:%d", kind, t, year)
+	}
+	return fmt.Sprintf("%s:%s", kind, t)
+}
+
+// Lookup returns the ID recorded for a title, preferring an alias recorded
+// with the same year over one recorded without a year.
+func (db *AliasDB) Lookup(kind, title string, year int) (int, bool) {
+	if db == nil {
+		return 0, false
+	}
+	if year > 0 {
+		if a, ok := db.get(aliasKey(kind, title, year)); ok {
+			return a.ID, true
+		}
+	}
+	a, ok := db.get(aliasKey(kind, title, 0))
+	return a.ID, ok
+}
+
+func (db *AliasDB) get(key string) (Alias, bool) {
+	if db.store == nil {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		a, ok := db.aliases[key]
+		return a, ok
+	}
+	a := Alias{}
+	b, _, err := db.store.Get(context.Background(), aliasBucket, key)
+	if err == nil {
+		err = json.Unmarshal(b, &a)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		options.logger.Warn("failed to read alias", "key", key, "error", err)
+	}
+	return a, err == nil
+}
+
+// Record adds or replaces aliases and saves the database.
+func (db *AliasDB) Record(aliases ...Alias) error {
+	if db == nil {
+		return nil
+	}
+	for _, a := range aliases {
+		if a.Type != AliasMovie && a.Type != AliasSeries {
+			return fmt.Errorf("%w alias type %q, expected %s or %s", ErrUnsupportedType, a.Type, AliasMovie, AliasSeries)
+		}
+	}
+	if db.store != nil {
+		for _, a := range aliases {
+			b, err := json.Marshal(a)
+			if err != nil {
+				return err
+			}
+			if err := db.store.Put(context.Background(), aliasBucket, aliasKey(a.Type, a.Title, a.Year), b); err != nil {
+				return fmt.Errorf("failed to record alias for %s %q with error %w", a.Type, a.Title, err)
+			}
+		}
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, a := range aliases {
+		db.aliases[aliasKey(a.Type, a.Title, a.Year)] = a
+	}
+	return db.save()
+}
+
+// Remove deletes the alias for a title and saves the database.
+func (db *AliasDB) Remove(kind, title string, year int) error {
+	k := aliasKey(kind, title, year)
+	if _, ok := db.get(k); !ok {
+		return fmt.Errorf("no alias recorded for %s %q", kind, title)
+	}
+	if db.store != nil {
+		return db.store.Delete(context.Background(), aliasBucket, k)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.aliases, k)
+	return db.save()
+}
+
+// List returns all aliases, sorted by type and title.
+func (db *AliasDB) List() ([]Alias, error) {
+	aliases := []Alias{}
+	if db.store != nil {
+		values, err := db.store.List(context.Background(), aliasBucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list aliases with error %w", err)
+		}
+		for _, b := range values {
+			a := Alias{}
+			if err := json.Unmarshal(b, &a); err != nil {
+				return nil, fmt.Errorf("failed to parse alias %s with error %w", b, err)
+			}
+			aliases = append(aliases, a)
+		}
+	} else {
+		db.mu.Lock()
+		for _, a := range db.aliases {
+			aliases = append(aliases, a)
+		}
+		db.mu.Unlock()
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliasKey(aliases[i].Type, aliases[i].Title, aliases[i].Year) <
+			aliasKey(aliases[j].Type, aliases[j].Title, aliases[j].Year)
+	})
+	return aliases, nil
+}
+
+func (db *AliasDB) save() error {
+	aliases := make([]Alias, 0, len(db.aliases))
+	for _, a := range db.aliases {
+		aliases = append(aliases, a)
+	}
+	b, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return err
+	}
+	tmp := db.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, db.path)
+}
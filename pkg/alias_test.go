@@ -0,0 +1,89 @@
+package kourai
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAliasDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	db, err := OpenAliasDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAliasDB(t, db, func() *AliasDB {
+		db, err := OpenAliasDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestStoreAliasDB(t *testing.T) {
+	store, err := OpenStore("sqlite:" + filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	// A second database on the same store sees the aliases recorded by the
+	// first, like another machine would.
+	testAliasDB(t, NewStoreAliasDB(store), func() *AliasDB { return NewStoreAliasDB(store) })
+}
+
+// testAliasDB records aliases in db and looks them up in the database
+// returned by reopen.
+func testAliasDB(t *testing.T, db *AliasDB, reopen func() *AliasDB) {
+	t.Helper()
+	if err := db.Record(Alias{Type: AliasSeries, Title: "The Office", ID: 2316}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Record(Alias{Type: AliasMovie, Title: "Dune", Year: 2021, ID: 438631}); err != nil {
+		t.Fatal(err)
+	}
+
+	db = reopen()
+	tests := []struct {
+		kind  string
+		title string
+		year  int
+		id    int
+		found bool
+	}{
+		{AliasSeries, "the.office", 0, 2316, true},
+		{AliasSeries, "The Office", 2005, 2316, true},
+		{AliasMovie, "Dune", 2021, 438631, true},
+		{AliasMovie, "Dune", 1984, 0, false},
+		{AliasMovie, "The Office", 0, 0, false},
+	}
+	for _, tt := range tests {
+		id, ok := db.Lookup(tt.kind, tt.title, tt.year)
+		if id != tt.id || ok != tt.found {
+			t.Errorf("Lookup(%q, %q, %d) = %d, %v; want %d, %v", tt.kind, tt.title, tt.year, id, ok, tt.id, tt.found)
+		}
+	}
+
+	got, err := db.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Alias{
+		{Type: AliasMovie, Title: "Dune", Year: 2021, ID: 438631},
+		{Type: AliasSeries, Title: "The Office", ID: 2316},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("List() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := db.Remove(AliasSeries, "The Office", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Lookup(AliasSeries, "The Office", 0); ok {
+		t.Error("alias still found after removal")
+	}
+	if err := db.Remove(AliasSeries, "The Office", 0); err == nil {
+		t.Error("Remove() of a missing alias returned no error")
+	}
+}
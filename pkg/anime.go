@@ -0,0 +1,79 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// animeExpr matches the names of fansubbed anime, which are numbered
+	// absolutely and prefixed with the release group, e.g.
+	// [SubGroup] Series Name - 013 [1080p][ABCD1234]
+	animeExpr = regexp.MustCompile(`^\[[^\]]+\]\s*(.+?)\s+-\s+(\d{2,4})(?:v\d)?(?:\s+-\s+(.+?))?\s*(?:[\[(][^\])]*[\])]\s*)*$`)
+	// releaseGroupExpr matches a bracketed release group prefix
+	releaseGroupExpr = regexp.MustCompile(`^\s*\[[^\]]*\]\s*`)
+	// crcExpr matches the bracketed CRC32 checksums of releases
+	crcExpr = regexp.MustCompile(`\s*\[[0-9A-Fa-f]{8}\]`)
+)
+
+// stripReleaseTags removes the release group prefix and CRC of name
+func stripReleaseTags(name string) string {
+	return crcExpr.ReplaceAllString(releaseGroupExpr.ReplaceAllString(name, ""), "")
+}
+
+// setAbsolute parses an absolutely numbered episode from basename, given
+// the location of the submatches of animeExpr in it. Until the absolute
+// number is mapped to a season and episode by looking the series up, the
+// episode is numbered as the episode of the first season.
+func (e *episode) setAbsolute(basename string, loc []int) error {
+	n, err := strconv.Atoi(basename[loc[4]:loc[5]])
+	if err != nil {
+		return fmt.Errorf("error parsing absolute episode number from \"%s\" with error %w", basename, err)
+	}
+	e.absolute = n
+	e.season, e.episode = 1, n
+	e.id = fmt.Sprintf("s01e%02d", n)
+
+	series := basename[loc[2]:loc[3]]
+	if year, d := findYear(series); d != nil && d[0] > 0 {
+		e.year = year
+		series = series[:d[0]]
+	}
+	e.series = makeTitle(strings.TrimRight(series, " ([-"))
+	if loc[6] != -1 {
+		e.title = makeTitle(basename[loc[6]:loc[7]])
+	}
+	if e.series == "" {
+		return fmt.Errorf("%w: could not determine the series of \"%s\"", ErrNoTitle, basename)
+	}
+	return nil
+}
+
+// setEpisodeByAbsolute names and numbers e, an absolutely numbered episode,
+// after the episode of show p maps its number to. Providers that aren't
+// AbsoluteProviders look the number up as an episode of the first season.
+func (e *episode) setEpisodeByAbsolute(ctx context.Context, p MetadataProvider, show SeriesMetadata) {
+	var ep EpisodeMetadata
+	var err error
+	if ap, ok := p.(AbsoluteProvider); ok {
+		ep, err = ap.EpisodeByAbsoluteNumber(ctx, show, e.absolute)
+	} else {
+		ep, err = p.GetEpisode(ctx, show, e.season, e.episode)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			options.logger.Debug("episode lookup by absolute number failed", "path", e.path, "series", e.series, "absolute", e.absolute, "error", err)
+		}
+		return
+	}
+	if ep.Title != "" {
+		e.title = ep.Title
+	}
+	if ep.Season != 0 || ep.Episode != 0 {
+		e.season, e.episode = ep.Season, ep.Episode
+		e.id = fmt.Sprintf("s%02de%02d", e.season, e.episode)
+	}
+}
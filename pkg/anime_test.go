@@ -0,0 +1,88 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnimeFromPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		target  string
+		episode *episode
+	}{
+		{
+			"/dl/[SubGroup] Series Name - 013 [1080p][ABCD1234].mkv",
+			"tv/Series Name/Season 1/Series Name - S01E13.mkv",
+			&episode{series: "Series Name", id: "s01e13", season: 1, episode: 13, absolute: 13,
+				quality: quality{resolution: "1080p", group: "SubGroup"}},
+		},
+		{
+			"/dl/[Group] Long Show (2019) - 1024v2 - The Title (BD 1080p) [0A1B2C3D].mkv",
+			"tv/Long Show (2019)/Season 1/Long Show (2019) - S01E1024 - The Title.mkv",
+			&episode{series: "Long Show", title: "The Title", id: "s01e1024", season: 1, episode: 1024, year: 2019, absolute: 1024,
+				quality: quality{resolution: "1080p", group: "Group"}},
+		},
+		{
+			// Release tags are removed from other names too
+			"/dl/[Group] Show - S02E03 [720p][DEADBEEF].mkv",
+			"tv/Show/Season 2/Show - S02E03.mkv",
+			&episode{series: "Show", id: "S02E03", season: 2, episode: 3,
+				quality: quality{resolution: "720p", group: "Group"}},
+		},
+	}
+	for _, tt := range tests {
+		l, err := NewLinkable(tt.path)
+		if err != nil {
+			t.Errorf("NewLinkable(%s) returned %v", tt.path, err)
+			continue
+		}
+		tt.episode.path = tt.path
+		if diff := cmp.Diff(tt.episode, l, cmp.AllowUnexported(episode{}, externalID{}, quality{})); diff != "" {
+			t.Errorf("NewLinkable(%s) mismatch (-want +got):\n%s", tt.path, diff)
+		}
+		if got := l.Target(); got != tt.target {
+			t.Errorf("Target() = %q, want %q", got, tt.target)
+		}
+	}
+
+	// Years in movie names aren't absolute episode numbers
+	if l, _ := NewLinkable("/dl/Blade Runner - 2049.mkv"); l != nil {
+		if _, ok := l.(*movie); !ok {
+			t.Errorf("NewLinkable(Blade Runner - 2049.mkv) returned %T, want a movie", l)
+		}
+	}
+}
+
+func TestAbsoluteLookup(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/search/tv":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[{"id":776001,"name":"Series Name"}]}`)
+		case "/3/tv/776001":
+			fmt.Fprint(w, `{"id":776001,"name":"Series Name","seasons":[
+				{"season_number":0,"episode_count":3},
+				{"season_number":1,"episode_count":12},
+				{"season_number":2,"episode_count":12}]}`)
+		case "/3/tv/776001/season/2/episode/1":
+			fmt.Fprint(w, `{"id":1,"name":"A New Start","season_number":2,"episode_number":1}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	l, err := NewLinkable("/dl/[SubGroup] Series Name - 013 [1080p][ABCD1234].mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup(context.Background(), options.metadataProvider(), l)
+	want := "tv/Series Name/Season 2/Series Name - S02E01 - A New Start.mkv"
+	if got := l.Target(); got != want {
+		t.Errorf("Target() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package kourai
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTitleLen is the longest episode title of targets, in bytes, which
+// keeps their names within the 255 byte limit of common filesystems
+const maxTitleLen = 150
+
+// maxSegments is the most episodes of a multi-episode file looked up for
+// the titles of its segments
+const maxSegments = 10
+
+// segmentSep separates the titles of the segments of anthology episodes,
+// e.g. "Title A / Title B" or "Title A + Title B"
+var segmentSep = regexp.MustCompile(`\s+[/+]\s+`)
+
+// segmentTitle renders the title of an episode telling several stories,
+// joining the titles of its segments with " + ". Duplicate segments are
+// dropped and slashes left in a segment, which would nest folders, are
+// replaced. Titles longer than maxTitleLen keep the segments that fit, or
+// are cut between words, followed by an ellipsis.
+func segmentTitle(title string) string {
+	var segments []string
+	seen := map[string]bool{}
+	for _, s := range segmentSep.Split(strings.TrimSpace(title), -1) {
+		s = strings.TrimSpace(strings.ReplaceAll(s, "/", "-"))
+		if s == "" || seen[strings.ToLower(s)] {
+			continue
+		}
+		seen[strings.ToLower(s)] = true
+		segments = append(segments, s)
+	}
+	t := strings.Join(segments, " + ")
+	if len(t) <= maxTitleLen {
+		return t
+	}
+
+	const ellipsis = "…"
+	for n := len(segments) - 1; n > 0; n-- {
+		if t := strings.Join(segments[:n], " + ") + " + " + ellipsis; len(t) <= maxTitleLen {
+			return t
+		}
+	}
+	cut := maxTitleLen - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(t[cut]) {
+		cut--
+	}
+	t = t[:cut]
+	if i := strings.LastIndexByte(t, ' '); i > 0 {
+		t = t[:i]
+	}
+	return strings.TrimRight(t, " +-") + ellipsis
+}
+
+// segments returns the numbers of the episodes in the file of e, e.g. 1, 2
+// and 3 for S01E01E03, up to maxSegments
+func (e *episode) segments() []int {
+	eps := strings.Split(strings.ToLower(e.id), "e")
+	last, err := strconv.Atoi(strings.Trim(eps[len(eps)-1], "-"))
+	if len(eps) < 3 || err != nil || last <= e.episode {
+		return []int{e.episode}
+	}
+	var n []int
+	for i := e.episode; i <= last && len(n) < maxSegments; i++ {
+		n = append(n, i)
+	}
+	return n
+}
+
+// setSegments names e after the episodes of show in its file, joining their
+// titles as segments when the file holds several, as TMDB lists each story
+// of anthology episodes. Titles of episodes that can't be looked up are
+// left out.
+func (e *episode) setSegments(ctx context.Context, p MetadataProvider, show SeriesMetadata) {
+	var titles []string
+	for i, n := range e.segments() {
+		ep, err := p.GetEpisode(ctx, show, e.season, n)
+		if err != nil {
+			if i == 0 && ctx.Err() == nil {
+				options.logger.Debug("episode lookup failed", "path", e.path, "series", e.series, "error", err)
+			}
+			if i == 0 {
+				return
+			}
+			continue
+		}
+		if ep.Title != "" {
+			titles = append(titles, ep.Title)
+		}
+	}
+	e.title = strings.Join(titles, " / ")
+}
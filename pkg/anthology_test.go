@@ -0,0 +1,64 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSegmentTitle(t *testing.T) {
+	long := strings.Repeat("Segment ", 12)
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Pilot", "Pilot"},
+		{"Title A / Title B", "Title A + Title B"},
+		{"Title A + Title B", "Title A + Title B"},
+		{"Pie/Cake / Title B / title b", "Pie-Cake + Title B"},
+		{"AC/DC", "AC-DC"},
+		{long + "A / " + long + "B", strings.TrimSpace(long) + " A + …"},
+		{strings.Repeat("Word ", 40), strings.TrimSpace(strings.Repeat("Word ", 29)) + "…"},
+	}
+	for _, tt := range tests {
+		if got := segmentTitle(tt.title); got != tt.want {
+			t.Errorf("segmentTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+
+	title := segmentTitle(strings.Repeat("日本語の題名", 20))
+	if len(title) > maxTitleLen || !utf8.ValidString(title) {
+		t.Errorf("segmentTitle() = %q, %d bytes, want valid UTF-8 of at most %d bytes", title, len(title), maxTitleLen)
+	}
+}
+
+func TestSegmentLookup(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/search/tv":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[{"id":777001,"name":"Cartoon Show"}]}`)
+		case "/3/tv/777001":
+			fmt.Fprint(w, `{"id":777001,"name":"Cartoon Show"}`)
+		case "/3/tv/777001/season/1/episode/1":
+			fmt.Fprint(w, `{"id":1,"name":"Rocket Race","season_number":1,"episode_number":1}`)
+		case "/3/tv/777001/season/1/episode/2":
+			fmt.Fprint(w, `{"id":2,"name":"Moon/Sun","season_number":1,"episode_number":2}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	l, err := NewLinkable("/dl/Cartoon Show S01E01E02.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup(context.Background(), options.metadataProvider(), l)
+	want := "tv/Cartoon Show/Season 1/Cartoon Show - S01E01-E02 - Rocket Race + Moon-Sun.mkv"
+	if got := l.Target(); got != want {
+		t.Errorf("Target() = %q, want %q", got, want)
+	}
+}
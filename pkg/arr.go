@@ -0,0 +1,144 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Applications whose libraries can seed the alias database
+const (
+	ArrSonarr = "sonarr"
+	ArrRadarr = "radarr"
+)
+
+type arrSeries struct {
+	Title  string `json:"title"`
+	Year   int    `json:"year"`
+	TMDBID int    `json:"tmdbId"`
+	Path   string `json:"path"`
+}
+
+type arrMovie struct {
+	Title     string `json:"title"`
+	Year      int    `json:"year"`
+	TMDBID    int    `json:"tmdbId"`
+	Path      string `json:"path"`
+	MovieFile *struct {
+		RelativePath string `json:"relativePath"`
+	} `json:"movieFile"`
+}
+
+// ArrAliases reads the library of a Sonarr or Radarr instance through its
+// v3 API and returns aliases for the title↔TMDB ID mappings confirmed
+// there. Besides the title, the names used on disk, i.e. the folder name
+// and, for movies, the title parsed from the file name, are mapped too,
+// since those are what future lookups will search for. Series are mapped
+// with their year, and without it unless another series has the same
+// title. Series without a TMDB ID, as in Sonarr before v4, are skipped.
+func ArrAliases(ctx context.Context, app, baseURL, apiKey string) ([]Alias, error) {
+	var endpoint, kind string
+	switch app {
+	case ArrSonarr:
+		endpoint, kind = "/api/v3/series", AliasSeries
+	case ArrRadarr:
+		endpoint, kind = "/api/v3/movie", AliasMovie
+	default:
+		return nil, fmt.Errorf("%w application %q, expected %s or %s", ErrUnsupportedType, app, ArrSonarr, ArrRadarr)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(baseURL, "/")+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("X-Api-Key", apiKey)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", app, res.Status)
+	}
+
+	aliases := []Alias{}
+	seen := map[string]bool{}
+	add := func(title string, year int, id int) {
+		if title == "" || id == 0 {
+			return
+		}
+		k := aliasKey(kind, title, year)
+		if !seen[k] {
+			seen[k] = true
+			aliases = append(aliases, Alias{Type: kind, Title: title, Year: year, ID: id})
+		}
+	}
+
+	// folder returns the name of the folder at p, a path of the
+	// application's host, without its year
+	folder := func(p string) string {
+		p, _ = PathMap{}.ToLocal(p)
+		return folderYearExpr.ReplaceAllString(filepath.Base(p), "")
+	}
+
+	if app == ArrSonarr {
+		var series []arrSeries
+		if err := json.NewDecoder(res.Body).Decode(&series); err != nil {
+			return nil, fmt.Errorf("failed to parse %s response with error %w", app, err)
+		}
+		// Episode file names rarely carry the year of their series, so
+		// titles are also mapped without the year, unless several series
+		// share them, e.g. remakes
+		names := func(s arrSeries) []string {
+			if s.Path == "" {
+				return []string{s.Title}
+			}
+			return []string{s.Title, folder(s.Path)}
+		}
+		ids := map[string]map[int]bool{}
+		for _, s := range series {
+			for _, name := range names(s) {
+				k := aliasKey(kind, name, 0)
+				if ids[k] == nil {
+					ids[k] = map[int]bool{}
+				}
+				ids[k][s.TMDBID] = true
+			}
+		}
+		for _, s := range series {
+			for _, name := range names(s) {
+				add(name, s.Year, s.TMDBID)
+				if len(ids[aliasKey(kind, name, 0)]) == 1 {
+					add(name, 0, s.TMDBID)
+				}
+			}
+		}
+		return aliases, nil
+	}
+
+	var movies []arrMovie
+	if err := json.NewDecoder(res.Body).Decode(&movies); err != nil {
+		return nil, fmt.Errorf("failed to parse %s response with error %w", app, err)
+	}
+	for _, m := range movies {
+		add(m.Title, m.Year, m.TMDBID)
+		if m.Path != "" {
+			add(folder(m.Path), m.Year, m.TMDBID)
+		}
+		if m.MovieFile != nil {
+			file, _ := PathMap{}.ToLocal(m.MovieFile.RelativePath)
+			if parsed, err := MovieFromPath(filepath.Base(file)); err == nil {
+				year := m.Year
+				if parsed.YearValid() {
+					year = parsed.year
+				}
+				add(parsed.title, year, m.TMDBID)
+			}
+		}
+	}
+	return aliases, nil
+}
@@ -0,0 +1,68 @@
+package kourai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArrAliases(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v3/series":
+			w.Write([]byte(`[
+				{"title": "The Office (US)", "year": 2005, "tmdbId": 2316, "path": "/tv/The Office (2005)"},
+				{"title": "Old Show", "year": 1999, "tmdbId": 0, "path": "/tv/Old Show"},
+				{"title": "Battlestar Galactica", "year": 1978, "tmdbId": 1981, "path": "/tv/Battlestar Galactica (1978)"},
+				{"title": "Battlestar Galactica", "year": 2004, "tmdbId": 1972, "path": "/tv/Battlestar Galactica (2004)"}
+			]`))
+		case "/api/v3/movie":
+			w.Write([]byte(`[
+				{"title": "Dune", "year": 2021, "tmdbId": 438631, "path": "/movies/Dune (2021)",
+				 "movieFile": {"relativePath": "Dune.Part.One.2021.2160p.mkv"}}
+			]`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		app  string
+		want []Alias
+	}{
+		{ArrSonarr, []Alias{
+			{Type: AliasSeries, Title: "The Office (US)", Year: 2005, ID: 2316},
+			{Type: AliasSeries, Title: "The Office (US)", ID: 2316},
+			{Type: AliasSeries, Title: "The Office", Year: 2005, ID: 2316},
+			{Type: AliasSeries, Title: "The Office", ID: 2316},
+			{Type: AliasSeries, Title: "Battlestar Galactica", Year: 1978, ID: 1981},
+			{Type: AliasSeries, Title: "Battlestar Galactica", Year: 2004, ID: 1972},
+		}},
+		{ArrRadarr, []Alias{
+			{Type: AliasMovie, Title: "Dune", Year: 2021, ID: 438631},
+			{Type: AliasMovie, Title: "Dune Part One", Year: 2021, ID: 438631},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := ArrAliases(context.Background(), tt.app, srv.URL+"/", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("ArrAliases(%s) = %v, want %v", tt.app, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ArrAliases(%s)[%d] = %v, want %v", tt.app, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	if _, err := ArrAliases(context.Background(), ArrRadarr, srv.URL, "wrong"); err == nil {
+		t.Error("ArrAliases() with a wrong API key returned no error")
+	}
+}
@@ -0,0 +1,184 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+)
+
+// artworkSize is the TMDB image size downloaded for posters
+const artworkSize = "original"
+
+// artworkPending holds the artwork paths being written, so that episodes of
+// the same season linked concurrently download each poster once
+var artworkPending sync.Map
+
+// Artwork places the artwork of media next to their target, following the
+// Plex and Kodi local asset conventions:
+//
+//	<movie>/poster.jpg              movie poster
+//	<movie>/fanart.jpg              movie backdrop
+//	<series>/folder.jpg             series poster
+//	<series>/fanart.jpg             series backdrop
+//	<series>/Season01.jpg           season poster
+//	<series>/Season 1/folder.jpg    season poster
+//
+// The folders are found from the layout of targets, see episodeFolders and
+// movieFolder; artwork is skipped for layouts without them. Posters in the
+// metadata language are preferred, and backdrops without text. Existing
+// artwork is kept. Nothing is done unless artwork is enabled.
+func (ln Link) Artwork(ctx context.Context) error {
+	if !ln.artwork || options.TMDBClient == nil {
+		return nil
+	}
+	switch m := ln.media.(type) {
+	case *movie:
+		return ln.movieArtwork(ctx, m)
+	case *episode:
+		return ln.episodeArtwork(ctx, m)
+	}
+	return nil
+}
+
+func (ln Link) movieArtwork(ctx context.Context, m *movie) error {
+	dir := movieFolder(ln.Target, m)
+	if m.tmdbID == 0 || dir == "" {
+		return nil
+	}
+	images, err := options.TMDBClient.MovieImages(ctx, m.tmdbID)
+	if err != nil {
+		return err
+	}
+	poster, fanart := bestPoster(images.Posters), bestBackdrop(images.Backdrops)
+	if poster == "" || fanart == "" {
+		d, err := options.TMDBClient.MovieDetails(ctx, m.tmdbID)
+		if err != nil {
+			return err
+		}
+		if poster == "" {
+			poster = d.PosterPath
+		}
+		if fanart == "" {
+			fanart = d.BackdropPath
+		}
+	}
+	var errs []error
+	if poster != "" {
+		errs = append(errs, placeArtwork(ctx, poster, filepath.Join(dir, "poster.jpg"), ln.perms))
+	}
+	if fanart != "" {
+		errs = append(errs, placeArtwork(ctx, fanart, filepath.Join(dir, "fanart.jpg"), ln.perms))
+	}
+	return errors.Join(errs...)
+}
+
+func (ln Link) episodeArtwork(ctx context.Context, e *episode) error {
+	seriesDir, seasonDir := episodeFolders(ln.Target, e)
+	if e.tmdbID == 0 || (seriesDir == "" && seasonDir == "") {
+		return nil
+	}
+
+	show, err := options.TMDBClient.TVDetails(ctx, e.tmdbID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if seriesDir != "" {
+		poster, fanart := show.PosterPath, show.BackdropPath
+		if images, err := options.TMDBClient.TVImages(ctx, e.tmdbID); err == nil {
+			if p := bestPoster(images.Posters); p != "" {
+				poster = p
+			}
+			if p := bestBackdrop(images.Backdrops); p != "" {
+				fanart = p
+			}
+		}
+		if poster != "" {
+			errs = append(errs, placeArtwork(ctx, poster, filepath.Join(seriesDir, "folder.jpg"), ln.perms))
+		}
+		if fanart != "" {
+			errs = append(errs, placeArtwork(ctx, fanart, filepath.Join(seriesDir, "fanart.jpg"), ln.perms))
+		}
+	}
+	for _, s := range show.Seasons {
+		if s.SeasonNumber != e.season || s.PosterPath == "" {
+			continue
+		}
+		if seriesDir != "" {
+			errs = append(errs, placeArtwork(ctx, s.PosterPath, filepath.Join(seriesDir, fmt.Sprintf("Season%02d.jpg", e.season)), ln.perms))
+		}
+		if seasonDir != "" {
+			errs = append(errs, placeArtwork(ctx, s.PosterPath, filepath.Join(seasonDir, "folder.jpg"), ln.perms))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// bestPoster returns the path of the best voted poster in the metadata
+// language, in English or without text, in that order, or "" when there's
+// none
+func bestPoster(images []tmdb.Image) string {
+	lang, _, _ := strings.Cut(options.language, "-")
+	return bestImage(images, lang, "en", "")
+}
+
+// bestBackdrop returns the path of the best voted backdrop without text, in
+// the metadata language or in English, in that order, or "" when there's
+// none
+func bestBackdrop(images []tmdb.Image) string {
+	lang, _, _ := strings.Cut(options.language, "-")
+	return bestImage(images, "", lang, "en")
+}
+
+// bestImage returns the path of the best voted image in the first of langs
+// any image is in, or of the best voted image when none is
+func bestImage(images []tmdb.Image, langs ...string) string {
+	best := func(match func(tmdb.Image) bool) string {
+		var path string
+		var votes float32 = -1
+		for _, i := range images {
+			if match(i) && i.VoteAverage > votes {
+				path, votes = i.FilePath, i.VoteAverage
+			}
+		}
+		return path
+	}
+	for _, lang := range langs {
+		if path := best(func(i tmdb.Image) bool { return i.Language == lang }); path != "" {
+			return path
+		}
+	}
+	return best(func(tmdb.Image) bool { return true })
+}
+
+// placeArtwork downloads the TMDB image at imagePath to target, unless
+// target exists
+func placeArtwork(ctx context.Context, imagePath, target string, perms *Permissions) error {
+	if _, loaded := artworkPending.LoadOrStore(target, struct{}{}); loaded {
+		return nil
+	}
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	b, err := options.TMDBClient.Image(ctx, imagePath, artworkSize)
+	if err != nil {
+		artworkPending.Delete(target)
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		artworkPending.Delete(target)
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		artworkPending.Delete(target)
+		return err
+	}
+	return perms.applyFile(target)
+}
@@ -0,0 +1,284 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEpisodeFolders(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+
+	e := &episode{series: "Show", id: "s01e02", season: 1, episode: 2, year: 2001, path: "show.s01e02.mkv", tmdbID: 760001}
+	tests := []struct {
+		name     string
+		template string
+		target   string
+		series   string
+		season   string
+	}{
+		{"default layout", "", "/lib/tv/Show (2001)/Season 1/Show (2001) - S01E02.mkv", "/lib/tv/Show (2001)", "/lib/tv/Show (2001)/Season 1"},
+		{"no season folders", "TV/{{.Series}}/{{.EpisodeID}}{{.Ext}}", "/lib/TV/Show/S01E02.mkv", "/lib/TV/Show", ""},
+		{"nested series folder", "TV/{{.Series}}/Episodes/{{.SeasonFolder}}/{{.EpisodeID}}{{.Ext}}", "/lib/TV/Show/Episodes/Season 1/S01E02.mkv", "/lib/TV/Show/Episodes", "/lib/TV/Show/Episodes/Season 1"},
+		{"folder per episode", "TV/{{.Series}}/{{.SeasonFolder}}/{{.EpisodeID}}/{{.EpisodeID}}{{.Ext}}", "/lib/TV/Show/Season 1/S01E02/S01E02.mkv", "/lib/TV/Show", "/lib/TV/Show/Season 1"},
+		{"flat", "TV/{{.Series}} - {{.EpisodeID}}{{.Ext}}", "/lib/TV/Show - S01E02.mkv", "", ""},
+		{"seasons above series", "TV/{{.SeasonFolder}}/{{.Series}}/{{.EpisodeID}}{{.Ext}}", "/lib/TV/Season 1/Show/S01E02.mkv", "", ""},
+		{"series by TMDB ID", "TV/{{.TMDBID}}/{{.EpisodeID}}{{.Ext}}", "/lib/TV/760001/S01E02.mkv", "/lib/TV/760001", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options = NewOptions()
+			if tt.template != "" {
+				tmpl, err := ParseTargetTemplate(tt.template)
+				if err != nil {
+					t.Fatal(err)
+				}
+				options.episodeTarget = tmpl
+			}
+			target := filepath.FromSlash(tt.target)
+			series, season := episodeFolders(target, e)
+			if series != filepath.FromSlash(tt.series) || season != filepath.FromSlash(tt.season) {
+				t.Errorf("episodeFolders() = %q, %q; want %q, %q", series, season, tt.series, tt.season)
+			}
+		})
+	}
+}
+
+// artworkTMDB serves a series with a poster for season 1, and images
+// containing their path
+func artworkTMDB(t *testing.T) {
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/3/tv/") {
+			fmt.Fprint(w, `{"id":1,"name":"Show","poster_path":"/series.jpg",
+				"seasons":[{"season_number":1,"poster_path":"/season1.jpg"},{"season_number":2,"poster_path":"/season2.jpg"}]}`)
+			return
+		}
+		w.Write([]byte(r.URL.Path[strings.LastIndex(r.URL.Path, "/"):]))
+	}))
+}
+
+// artworkFiles returns the images below dir, with their content
+func artworkFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".jpg") {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestArtwork(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+
+	tests := []struct {
+		name     string
+		template string
+		target   string
+		want     map[string]string
+	}{
+		{
+			name:   "default layout",
+			target: "tv/Show/Season 1/Show - S01E01.mkv",
+			want: map[string]string{
+				"tv/Show/folder.jpg":          "/series.jpg",
+				"tv/Show/Season01.jpg":        "/season1.jpg",
+				"tv/Show/Season 1/folder.jpg": "/season1.jpg",
+			},
+		},
+		{
+			name:     "no season folders",
+			template: "TV/{{.Series}}/{{.EpisodeID}}{{.Ext}}",
+			target:   "TV/Show/S01E01.mkv",
+			want: map[string]string{
+				"TV/Show/folder.jpg":   "/series.jpg",
+				"TV/Show/Season01.jpg": "/season1.jpg",
+			},
+		},
+		{
+			name:     "flat",
+			template: "TV/{{.Series}} - {{.EpisodeID}}{{.Ext}}",
+			target:   "TV/Show - S01E01.mkv",
+			want:     map[string]string{},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options = NewOptions()
+			artworkTMDB(t)
+			if tt.template != "" {
+				tmpl, err := ParseTargetTemplate(tt.template)
+				if err != nil {
+					t.Fatal(err)
+				}
+				options.episodeTarget = tmpl
+			}
+			dest := t.TempDir()
+			target := filepath.Join(dest, filepath.FromSlash(tt.target))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				t.Fatal(err)
+			}
+			ln := Link{
+				Target:  target,
+				artwork: true,
+				media:   &episode{series: "Show", id: "s01e01", season: 1, episode: 1, path: "show.s01e01.mkv", tmdbID: 760100 + i},
+			}
+			if err := ln.Artwork(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, artworkFiles(t, dest)); diff != "" {
+				t.Errorf("artwork mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPlaceArtwork(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	artworkTMDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Existing artwork is kept
+	existing := filepath.Join(dir, "existing.jpg")
+	if err := os.WriteFile(existing, []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := placeArtwork(ctx, "/series.jpg", existing, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	placed := filepath.Join(dir, "placed.jpg")
+	if err := placeArtwork(ctx, "/series.jpg", placed, nil); err != nil {
+		t.Fatal(err)
+	}
+	// A poster being placed isn't downloaded again
+	if err := os.Remove(placed); err != nil {
+		t.Fatal(err)
+	}
+	if err := placeArtwork(ctx, "/season1.jpg", placed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed downloads are retried
+	missing := filepath.Join(dir, "missing", "poster.jpg")
+	if err := placeArtwork(ctx, "/series.jpg", missing, nil); err == nil {
+		t.Error("placeArtwork() into a missing directory returned no error")
+	}
+	if err := os.Mkdir(filepath.Dir(missing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := placeArtwork(ctx, "/series.jpg", missing, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"existing.jpg": "mine", "missing/poster.jpg": "/series.jpg"}
+	if diff := cmp.Diff(want, artworkFiles(t, dir)); diff != "" {
+		t.Errorf("artwork mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMovieArtwork(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+
+	tests := []struct {
+		name   string
+		images string
+		want   map[string]string
+	}{
+		{
+			name: "images in the metadata language",
+			images: `{"posters":[{"file_path":"/en.jpg","iso_639_1":"en","vote_average":9},{"file_path":"/fr.jpg","iso_639_1":"fr","vote_average":5}],
+				"backdrops":[{"file_path":"/fr-backdrop.jpg","iso_639_1":"fr","vote_average":9},{"file_path":"/backdrop.jpg","iso_639_1":null,"vote_average":4},{"file_path":"/backdrop2.jpg","iso_639_1":null,"vote_average":6}]}`,
+			want: map[string]string{
+				"movies/Film (2001)/poster.jpg": "/fr.jpg",
+				"movies/Film (2001)/fanart.jpg": "/backdrop2.jpg",
+			},
+		},
+		{
+			name:   "images of other languages",
+			images: `{"posters":[{"file_path":"/de.jpg","iso_639_1":"de","vote_average":2},{"file_path":"/ja.jpg","iso_639_1":"ja","vote_average":3}],"backdrops":[]}`,
+			want: map[string]string{
+				"movies/Film (2001)/poster.jpg": "/ja.jpg",
+				"movies/Film (2001)/fanart.jpg": "/details-backdrop.jpg",
+			},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options = NewOptions()
+			options.language = "fr-FR"
+			fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/images"):
+					fmt.Fprint(w, tt.images)
+				case strings.HasPrefix(r.URL.Path, "/3/movie/"):
+					fmt.Fprint(w, `{"id":1,"title":"Film","poster_path":"/details.jpg","backdrop_path":"/details-backdrop.jpg"}`)
+				default:
+					w.Write([]byte(r.URL.Path[strings.LastIndex(r.URL.Path, "/"):]))
+				}
+			}))
+			m := &movie{title: "Film", year: 2001, path: "film.2001.mkv", tmdbID: 769001 + i}
+			dest := t.TempDir()
+			target := filepath.Join(dest, filepath.FromSlash(m.Target()))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				t.Fatal(err)
+			}
+			ln := Link{Target: target, artwork: true, media: m}
+			if err := ln.Artwork(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, artworkFiles(t, dest)); diff != "" {
+				t.Errorf("artwork mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesFanart(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/images"):
+			fmt.Fprint(w, `{"posters":[],"backdrops":[{"file_path":"/titled.jpg","iso_639_1":"en","vote_average":9},{"file_path":"/fanart.jpg","iso_639_1":null,"vote_average":1}]}`)
+		case strings.HasPrefix(r.URL.Path, "/3/tv/"):
+			fmt.Fprint(w, `{"id":1,"name":"Show","poster_path":"/series.jpg","backdrop_path":"/details-backdrop.jpg","seasons":[]}`)
+		default:
+			w.Write([]byte(r.URL.Path[strings.LastIndex(r.URL.Path, "/"):]))
+		}
+	}))
+	dest := t.TempDir()
+	target := filepath.Join(dest, "tv", "Show", "Season 1", "Show - S01E01.mkv")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ln := Link{
+		Target:  target,
+		artwork: true,
+		media:   &episode{series: "Show", id: "s01e01", season: 1, episode: 1, path: "show.s01e01.mkv", tmdbID: 769101},
+	}
+	if err := ln.Artwork(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"tv/Show/folder.jpg": "/series.jpg", "tv/Show/fanart.jpg": "/fanart.jpg"}
+	if diff := cmp.Diff(want, artworkFiles(t, dest)); diff != "" {
+		t.Errorf("artwork mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,78 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRolledBack is returned by ApplyAtomic when it reverted the targets it
+// created.
+var ErrRolledBack = errors.New("run rolled back")
+
+// Run returns the ID of the run j records, as listed by JournalRuns.
+func (j *Journal) Run() string {
+	return j.run
+}
+
+// ApplyAtomic creates the targets of plan as a whole, recording each in
+// journal, and returns the links created along with the errors of those
+// that failed. Targets that already exist, e.g. as linked by an earlier run,
+// are skipped with their errors but aren't failures. Once more than
+// maxFailures of plan, a fraction from 0 to 1, failed, e.g. because of
+// permissions or a missing mount, ctx is done, or the lease on the
+// destination was lost, it stops and reverts every target of the run using
+// the journal, returning an error wrapping ErrRolledBack. The journal isn't
+// recorded to after a rollback.
+func ApplyAtomic(ctx context.Context, plan []Link, journal *Journal, maxFailures float64) ([]Link, error) {
+	created := []Link{}
+	var errs []error
+	failed := 0
+	budget := int(maxFailures * float64(len(plan)))
+	var stop error
+	for _, ln := range plan {
+		if err := ctx.Err(); err != nil {
+			stop = fmt.Errorf("%w: stopped before all sources were linked: %w", ErrRolledBack, err)
+			break
+		}
+		if err := ln.Create(); err != nil {
+			errs = append(errs, err)
+			if errors.Is(err, ErrTargetExists) {
+				continue
+			}
+			failed++
+			if errors.Is(err, ErrLeaseLost) {
+				stop = fmt.Errorf("%w: %w", ErrRolledBack, err)
+				break
+			}
+			if failed > budget {
+				stop = fmt.Errorf("%w: %d of %d links failed, more than %g%%", ErrRolledBack, failed, len(plan), maxFailures*100)
+				break
+			}
+			continue
+		}
+		mode := ln.Mode
+		if mode == "" {
+			mode = ModeHardlink
+		}
+		if err := journal.Record(string(mode), ln); err != nil {
+			// Targets missing from the journal aren't rolled back by it
+			errs = append(errs, fmt.Errorf("failed to record %s in the journal: %w", ln.Target, err))
+			if err := undoEntry(JournalEntry{Mode: string(mode), Src: ln.Src, Target: ln.Target}); err != nil {
+				errs = append(errs, err)
+			}
+			stop = fmt.Errorf("%w: the journal can't be written", ErrRolledBack)
+			break
+		}
+		created = append(created, ln)
+	}
+	if stop == nil {
+		return created, errors.Join(errs...)
+	}
+	if len(created) > 0 {
+		if _, err := UndoRun(journal.path, journal.run); err != nil {
+			errs = append(errs, fmt.Errorf("failed to roll back: %w", err))
+		}
+	}
+	return nil, errors.Join(append([]error{stop}, errs...)...)
+}
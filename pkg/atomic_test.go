@@ -0,0 +1,111 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyAtomic(t *testing.T) {
+	// plan returns links of three sources, the last of which fails as its
+	// target folder is a file
+	plan := func(root string) []Link {
+		links := []Link{}
+		for _, name := range []string{"a", "b", "c"} {
+			src := filepath.Join(root, "dl", name+".mkv")
+			os.MkdirAll(filepath.Dir(src), 0755)
+			if err := os.WriteFile(src, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			links = append(links, Link{Src: src, Target: filepath.Join(root, "movies", name, name+".mkv"), Mode: ModeHardlink})
+		}
+		os.MkdirAll(filepath.Join(root, "movies"), 0755)
+		if err := os.WriteFile(filepath.Join(root, "movies", "c"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return links
+	}
+
+	for _, tc := range []struct {
+		name        string
+		maxFailures float64
+		rolledBack  bool
+	}{
+		{"within threshold", 0.4, false},
+		{"above threshold", 0.2, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			journalPath := filepath.Join(root, JournalName)
+			j, err := OpenJournal(journalPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.Close()
+
+			links, err := ApplyAtomic(context.Background(), plan(root), j, tc.maxFailures)
+			if err == nil {
+				t.Fatal("ApplyAtomic() returned no error for a failing link")
+			}
+			if got := errors.Is(err, ErrRolledBack); got != tc.rolledBack {
+				t.Fatalf("ApplyAtomic() rolled back = %v, want %v: %v", got, tc.rolledBack, err)
+			}
+			entries, _ := ReadJournal(journalPath)
+			if tc.rolledBack {
+				if len(links) != 0 || len(entries) != 0 {
+					t.Errorf("ApplyAtomic() kept %d links and %d journal entries, want none", len(links), len(entries))
+				}
+				for _, name := range []string{"a", "b"} {
+					if _, err := os.Stat(filepath.Join(root, "movies", name)); !os.IsNotExist(err) {
+						t.Errorf("target folder %s was not rolled back", name)
+					}
+				}
+				return
+			}
+			if len(links) != 2 || len(entries) != 2 {
+				t.Errorf("ApplyAtomic() kept %d links and %d journal entries, want 2", len(links), len(entries))
+			}
+			for _, l := range links {
+				if _, err := os.Stat(l.Target); err != nil {
+					t.Errorf("target %s was not created", l.Target)
+				}
+			}
+		})
+	}
+
+	// Targets linked by an earlier run are skipped, not failures
+	t.Run("existing target", func(t *testing.T) {
+		root := t.TempDir()
+		links := []Link{}
+		for _, name := range []string{"a", "b"} {
+			src := filepath.Join(root, "dl", name+".mkv")
+			os.MkdirAll(filepath.Dir(src), 0755)
+			if err := os.WriteFile(src, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			links = append(links, Link{Src: src, Target: filepath.Join(root, "movies", name, name+".mkv"), Mode: ModeHardlink})
+		}
+		// a was linked by an earlier run
+		if err := links[0].Create(); err != nil {
+			t.Fatal(err)
+		}
+		j, err := OpenJournal(filepath.Join(root, JournalName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+
+		created, err := ApplyAtomic(context.Background(), links, j, 0)
+		if errors.Is(err, ErrRolledBack) || !errors.Is(err, ErrTargetExists) {
+			t.Fatalf("ApplyAtomic() = %v, want the existing target skipped without a rollback", err)
+		}
+		if len(created) != 1 || created[0].Target != links[1].Target {
+			t.Errorf("ApplyAtomic() created %v, want only %s", created, links[1].Target)
+		}
+		if _, err := os.Stat(links[1].Target); err != nil {
+			t.Errorf("target %s was not created", links[1].Target)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+	"golang.org/x/time/rate"
+)
+
+var (
+	rateExpr = regexp.MustCompile(`(?i)^\s*(\d+(?:\.\d+)?)\s*([kmgt]?)(i?)b?\s*(?:/s)?\s*$`)
+	sizeExpr = regexp.MustCompile(`(?i)^\s*(\d+(?:\.\d+)?)\s*([kmgt]?)(i?)b?\s*$`)
+)
+
+// ParseRate parses a bandwidth in bytes per second, e.g. 50MB/s, 5MiB/s or
+// 800k. Units are decimal, K being 1000 bytes, unless they're binary, as
+// in Ki for 1024 bytes. An empty rate, or 0, is unlimited and returned as 0.
+func ParseRate(s string) (int64, error) {
+	return parseBytes(s, rateExpr, "rate", "bytes per second such as 50MB/s or 5MiB/s")
+}
+
+// ParseSize parses a size in bytes, e.g. 100MB, 1.5GiB or 800k, in the
+// units of ParseRate. An empty size is returned as 0.
+func ParseSize(s string) (int64, error) {
+	return parseBytes(s, sizeExpr, "size", "bytes such as 100MB or 1.5GiB")
+}
+
+// parseBytes parses the number of bytes of s, matched by expr, in decimal
+// or binary units; kind and expected describe s in errors
+func parseBytes(s string, expr *regexp.Regexp, kind, expected string) (int64, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, nil
+	}
+	m := expr.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid %s %q, expected %s", kind, s, expected)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", kind, s, err)
+	}
+	base := 1000.0
+	if m[3] != "" {
+		if m[2] == "" {
+			return 0, fmt.Errorf("invalid %s %q, binary units need a prefix such as Ki or Mi", kind, s)
+		}
+		base = 1024
+	}
+	if m[2] != "" {
+		for i := strings.Index("kmgt", strings.ToLower(m[2])); i >= 0; i-- {
+			n *= base
+		}
+	}
+	return int64(n), nil
+}
+
+// maxRateBurst is the most bytes read at once by throttled readers
+const maxRateBurst = 256 << 10
+
+// newRateLimiter returns a limiter of bps bytes a second, or nil when bps
+// isn't positive
+func newRateLimiter(bps int64) *rate.Limiter {
+	if bps <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bps), int(min(bps, maxRateBurst)))
+}
+
+// throttledReader reads from r no faster than all of its limiters allow
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rate.Limiter
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	for _, l := range t.limiters {
+		if len(p) > l.Burst() {
+			p = p[:l.Burst()]
+		}
+	}
+	n, err := t.r.Read(p)
+	for _, l := range t.limiters {
+		if werr := l.WaitN(t.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// throttled returns r limited by the given limiters, ignoring nil ones, or
+// r itself when none limit it so that copies may still use ReaderFrom.
+func throttled(ctx context.Context, r io.Reader, limiters ...*rate.Limiter) io.Reader {
+	var limits []*rate.Limiter
+	for _, l := range limiters {
+		if l != nil {
+			limits = append(limits, l)
+		}
+	}
+	if len(limits) == 0 {
+		return r
+	}
+	return throttledReader{ctx: ctx, r: r, limiters: limits}
+}
+
+// WithBandwidth limits the bandwidth, in bytes per second, of copies,
+// including moves across filesystems, and of artwork downloads to total
+// combined, and each to copy and download. A limit of 0 is unlimited.
+// Clones on filesystems that support them don't transfer data and aren't
+// limited. Like the response cache, the download limit applies to all TMDB
+// clients.
+func WithBandwidth(total, copy, download int64) Option {
+	all := newRateLimiter(total)
+	copyLimiters := []*rate.Limiter{all, newRateLimiter(copy)}
+	downloadLimiters := []*rate.Limiter{all, newRateLimiter(download)}
+	return func(o *Options) {
+		o.copyLimiters = copyLimiters
+		if total <= 0 && download <= 0 {
+			tmdb.SetThrottle(nil)
+			return
+		}
+		tmdb.SetThrottle(func(ctx context.Context, r io.Reader) io.Reader {
+			return throttled(ctx, r, downloadLimiters...)
+		})
+	}
+}
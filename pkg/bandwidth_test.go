@@ -0,0 +1,147 @@
+package kourai
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate string
+		want int64
+		err  bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"800", 800, false},
+		{"800k", 800_000, false},
+		{"50MB/s", 50_000_000, false},
+		{"5MiB/s", 5 << 20, false},
+		{"1.5 GB/s", 1_500_000_000, false},
+		{"2KiB", 2048, false},
+		{"iB/s", 0, true},
+		{"5 iB/s", 0, true},
+		{"fast", 0, true},
+		{"-5MB/s", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.rate)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d, error %v", tt.rate, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+		err  bool
+	}{
+		{"", 0, false},
+		{"100MB", 100_000_000, false},
+		{"1.5 GiB", 3 << 29, false},
+		{"800k", 800_000, false},
+		{"50MB/s", 0, true},
+		{"big", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.size)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d, error %v", tt.size, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 3000)
+	r := bytes.NewReader(data)
+	if got := throttled(context.Background(), r, nil, nil); got != io.Reader(r) {
+		t.Errorf("throttled() without limits returned %T, want the reader", got)
+	}
+
+	// The slowest limit applies, after a burst of 1000 bytes
+	start := time.Now()
+	got, err := io.ReadAll(throttled(context.Background(), r, newRateLimiter(1_000_000), rate.NewLimiter(10_000, 1000)))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("throttled() read %d bytes, %v", len(got), err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("3000 bytes at 10kB/s were read in %s", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := io.ReadAll(throttled(ctx, bytes.NewReader(data), newRateLimiter(100))); err == nil {
+		t.Error("throttled() read on after its context was cancelled")
+	}
+}
+
+func TestCopyFileBandwidth(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("clones on APFS don't transfer data")
+	}
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	options.SetOptions(WithBandwidth(0, 20_000, 0))
+	defer WithBandwidth(0, 0, 0)(options)
+
+	root := t.TempDir()
+	src := filepath.Join(root, "src.mkv")
+	if err := os.WriteFile(src, bytes.Repeat([]byte("x"), 25_000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := copyFile(src, filepath.Join(root, "target.mkv"), info); err != nil {
+		t.Fatal(err)
+	}
+	// After a burst of 20kB, the remaining 5kB take 250ms
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("25kB at 20kB/s were copied in %s", d)
+	}
+}
+
+func TestLowPriority(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	defer WithBandwidth(0, 0, 0)(NewOptions())
+
+	tests := []struct {
+		name string
+		opts []Option
+		io   int
+		rate rate.Limit
+	}{
+		{"default", []Option{WithConcurrency(8), WithLowPriority(true)}, 1, lowPriorityCopyRate},
+		{"copy rate", []Option{WithBandwidth(0, 1000, 0), WithLowPriority(true)}, 1, 1000},
+		{"download rate", []Option{WithBandwidth(0, 0, 1000), WithLowPriority(true)}, 1, lowPriorityCopyRate},
+		{"disabled", []Option{WithConcurrency(8), WithLowPriority(false)}, 8, 0},
+	}
+	for _, tt := range tests {
+		options = NewOptions()
+		options.SetOptions(tt.opts...)
+		if options.ioWorkers != tt.io {
+			t.Errorf("%s: %d IO workers, want %d", tt.name, options.ioWorkers, tt.io)
+		}
+		var limit rate.Limit
+		for _, l := range options.copyLimiters {
+			if l != nil {
+				limit = l.Limit()
+			}
+		}
+		if limit != tt.rate {
+			t.Errorf("%s: copies limited to %v, want %v", tt.name, limit, tt.rate)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package kourai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotName is the name of the snapshot of the media of a library kept
+// in its root, see UpdateSnapshot.
+const SnapshotName = ".kourai-snapshot.json"
+
+// SnapshotFile is a media file of a library, by its path relative to the
+// library root, with forward slashes
+type SnapshotFile struct {
+	Path  string `json:"path"`
+	Dev   uint64 `json:"dev"`
+	Inode uint64 `json:"inode"`
+	Size  int64  `json:"size"`
+}
+
+// Snapshot lists the media files of a library at a time.
+type Snapshot struct {
+	Time  time.Time      `json:"time"`
+	Files []SnapshotFile `json:"files"`
+}
+
+// TakeSnapshot lists the media files below dest, skipping hidden entries
+// such as kourai's own files.
+func TakeSnapshot(dest string) (Snapshot, error) {
+	s := Snapshot{Time: time.Now().UTC(), Files: []SnapshotFile{}}
+	err := filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dest && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !isMedia(info) {
+			return nil
+		}
+		dev, ino, _, err := fileIdentity(p, info)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dest, p)
+		if err != nil {
+			return err
+		}
+		s.Files = append(s.Files, SnapshotFile{Path: filepath.ToSlash(rel), Dev: dev, Inode: ino, Size: info.Size()})
+		return nil
+	})
+	return s, err
+}
+
+// PreviousSnapshot returns the snapshot last written in dest by
+// UpdateSnapshot, or takes one when there's none yet, so that the first
+// changelog only holds the changes made from now on. Media files are those
+// with the extensions of the options.
+func PreviousSnapshot(dest string, optionConfig ...Option) (Snapshot, error) {
+	options.SetOptions(optionConfig...)
+	b, err := os.ReadFile(filepath.Join(dest, SnapshotName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return TakeSnapshot(dest)
+	} else if err != nil {
+		return Snapshot{}, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("failed to parse snapshot %s with error %w", filepath.Join(dest, SnapshotName), err)
+	}
+	return s, nil
+}
+
+// UpdateSnapshot takes a snapshot of dest, writes it in place of the last
+// one, and returns the changes made to the library since before.
+func UpdateSnapshot(dest string, before Snapshot) (Changelog, error) {
+	after, err := TakeSnapshot(dest)
+	if err != nil {
+		return Changelog{}, err
+	}
+	b, err := json.Marshal(after)
+	if err != nil {
+		return Changelog{}, err
+	}
+	path := filepath.Join(dest, SnapshotName)
+	tmp, err := os.CreateTemp(dest, SnapshotName+".*.tmp")
+	if err != nil {
+		return Changelog{}, err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return Changelog{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return Changelog{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Changelog{}, err
+	}
+	return Changes(before, after), nil
+}
+
+// Rename is a media file of a library moved from one path to another
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Changelog lists the media files added to, removed from and renamed in a
+// library between two snapshots, by their paths relative to its root.
+type Changelog struct {
+	// From is the time of the earlier snapshot
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Added   []string  `json:"added"`
+	Removed []string  `json:"removed"`
+	Renamed []Rename  `json:"renamed"`
+}
+
+// Changes compares the snapshots before and after. Files removed from one
+// path and added at another are renamed when they're the same file, by
+// inode.
+func Changes(before, after Snapshot) Changelog {
+	c := Changelog{From: before.Time, To: after.Time, Added: []string{}, Removed: []string{}, Renamed: []Rename{}}
+	key := func(f SnapshotFile) inodeKey { return inodeKey{f.Dev, f.Inode} }
+	had := map[string]bool{}
+	for _, f := range before.Files {
+		had[f.Path] = true
+	}
+	has := map[string]bool{}
+	added := map[inodeKey][]string{}
+	for _, f := range after.Files {
+		has[f.Path] = true
+		if !had[f.Path] {
+			added[key(f)] = append(added[key(f)], f.Path)
+		}
+	}
+	renamed := map[string]bool{}
+	for _, f := range before.Files {
+		if has[f.Path] {
+			continue
+		}
+		if to := added[key(f)]; len(to) > 0 {
+			c.Renamed = append(c.Renamed, Rename{From: f.Path, To: to[0]})
+			renamed[to[0]] = true
+			added[key(f)] = to[1:]
+			continue
+		}
+		c.Removed = append(c.Removed, f.Path)
+	}
+	for _, f := range after.Files {
+		if !had[f.Path] && !renamed[f.Path] {
+			c.Added = append(c.Added, f.Path)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Slice(c.Renamed, func(i, j int) bool { return c.Renamed[i].To < c.Renamed[j].To })
+	return c
+}
+
+// Empty reports whether nothing changed.
+func (c Changelog) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Renamed) == 0
+}
+
+// WriteMarkdown writes c as a Markdown section, e.g. to post to a chat.
+func (c Changelog) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Library changes %s\n", c.To.Local().Format("2006-01-02 15:04"))
+	list := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n### %s (%d)\n", title, len(items))
+		for _, item := range items {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+	list("Added", c.Added)
+	renamed := make([]string, len(c.Renamed))
+	for i, r := range c.Renamed {
+		renamed[i] = r.From + " → " + r.To
+	}
+	list("Renamed", renamed)
+	list("Removed", c.Removed)
+	if c.Empty() {
+		b.WriteString("\nNothing changed.\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// AppendChangelog appends c to the file at path, creating it when missing:
+// as a JSON line when its name ends in .json or .jsonl, or else as a
+// Markdown section, keeping a history of the library.
+func AppendChangelog(path string, c Changelog) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".jsonl":
+		err = json.NewEncoder(f).Encode(c)
+	default:
+		if info, statErr := f.Stat(); statErr == nil && info.Size() > 0 {
+			io.WriteString(f, "\n")
+		}
+		err = c.WriteMarkdown(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
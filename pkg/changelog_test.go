@@ -0,0 +1,92 @@
+package kourai
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChangelog(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	dest := t.TempDir()
+	write := func(rel string) {
+		t.Helper()
+		p := filepath.Join(dest, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(rel), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("movies/Heat (1995)/Heat.1995.mkv")
+	write("movies/Alien (1979)/Alien.1979.mkv")
+	write("movies/Cats (2019)/Cats.2019.mkv")
+
+	before, err := PreviousSnapshot(dest, WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before.Files) != 3 {
+		t.Fatalf("PreviousSnapshot() without a snapshot = %+v, want the 3 files", before)
+	}
+
+	write("movies/Dune (2021)/Dune.2021.mkv")
+	write("movies/Dune (2021)/Dune.2021.nfo")
+	os.Remove(filepath.Join(dest, "movies/Cats (2019)/Cats.2019.mkv"))
+	os.Mkdir(filepath.Join(dest, "movies/Aliens (1986)"), 0755)
+	if err := os.Rename(filepath.Join(dest, "movies/Alien (1979)/Alien.1979.mkv"), filepath.Join(dest, "movies/Aliens (1986)/Aliens.1986.mkv")); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := UpdateSnapshot(dest, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Changelog{
+		From:    before.Time,
+		To:      changes.To,
+		Added:   []string{"movies/Dune (2021)/Dune.2021.mkv"},
+		Removed: []string{"movies/Cats (2019)/Cats.2019.mkv"},
+		Renamed: []Rename{{From: "movies/Alien (1979)/Alien.1979.mkv", To: "movies/Aliens (1986)/Aliens.1986.mkv"}},
+	}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Errorf("UpdateSnapshot() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The snapshot written is the starting point of the next changelog
+	after, err := PreviousSnapshot(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again := Changes(after, after); !again.Empty() {
+		t.Errorf("Changes() of the same snapshot = %+v, want none", again)
+	}
+	if len(after.Files) != 3 {
+		t.Errorf("PreviousSnapshot() = %+v, want the 3 files of the last snapshot", after)
+	}
+
+	var b bytes.Buffer
+	if err := changes.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"### Added (1)\n- movies/Dune (2021)/Dune.2021.mkv\n", "### Renamed (1)\n", "### Removed (1)\n"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("WriteMarkdown() = %q, want it to contain %q", b.String(), s)
+		}
+	}
+
+	log := filepath.Join(t.TempDir(), "changes.jsonl")
+	for i := 0; i < 2; i++ {
+		if err := AppendChangelog(log, changes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b, _ := os.ReadFile(log); strings.Count(string(b), "\n") != 2 {
+		t.Errorf("AppendChangelog() twice wrote %q, want 2 JSON lines", b)
+	}
+}
@@ -0,0 +1,188 @@
+package kourai
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// checksumFormats maps supported algorithms to the name of the manifest
+// written in each movie or series folder.
+var checksumFormats = map[string]string{
+	"sha256": "CHECKSUMS.sha256",
+	"xxhash": "CHECKSUMS.xxh64",
+	"sfv":    "CHECKSUMS.sfv",
+}
+
+// checksumXattrPrefix prefixes the name of the extended attribute holding
+// the checksum of a file, followed by the algorithm, e.g.
+// user.kourai.checksum.sha256
+const checksumXattrPrefix = "user.kourai.checksum."
+
+// ChecksumWriter maintains a checksum manifest in every movie and series
+// folder of a destination, as links are added to it. Manifests use the
+// format of sha256sum/xxhsum ("<sum>  <path>") or SFV ("<path> <crc32>"),
+// with paths relative to the folder containing the manifest. With xattrs
+// set, the checksum is also stored in an extended attribute of each file.
+type ChecksumWriter struct {
+	dest     string
+	algo     string
+	manifest string
+	xattrs   bool
+	mu       sync.Mutex
+}
+
+func NewChecksumWriter(dest, algo string, xattrs bool) (*ChecksumWriter, error) {
+	manifest, ok := checksumFormats[algo]
+	if !ok {
+		return nil, fmt.Errorf("%w checksum algorithm %q", ErrUnsupportedType, algo)
+	}
+	w := &ChecksumWriter{
+		dest:     dest,
+		algo:     algo,
+		manifest: manifest,
+		xattrs:   xattrs,
+	}
+	return w, nil
+}
+
+func newChecksumHash(algo string) hash.Hash {
+	switch algo {
+	case "xxhash":
+		return xxhash.New()
+	case "sfv":
+		return crc32.NewIEEE()
+	default:
+		return sha256.New()
+	}
+}
+
+func hashFile(algo, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newChecksumHash(algo)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s with error %w", path, err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// parseChecksumLine returns the path and sum of a manifest entry. Comments
+// and blank lines are not entries.
+func parseChecksumLine(algo, line string) (path string, sum string, ok bool) {
+	if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	if algo == "sfv" {
+		i := strings.LastIndex(line, " ")
+		if i <= 0 {
+			return "", "", false
+		}
+		return line[:i], strings.ToLower(line[i+1:]), true
+	}
+	sum, path, ok = strings.Cut(line, "  ")
+	return path, strings.ToLower(sum), ok
+}
+
+// folder returns the movie or series folder that contains the target of ln,
+// as laid out by its media, e.g. movies/A/<Movie> when sharded, or the
+// second level below the destination, e.g. tv/<Series>, for targets
+// without media. Movies and episodes whose layout has no folder of their
+// own keep their manifest in the folder of the target.
+func (w *ChecksumWriter) folder(ln Link) (string, error) {
+	rel, err := filepath.Rel(w.dest, ln.Target)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 || parts[0] == ".." {
+		return "", fmt.Errorf("target %s is not within a folder of %s", ln.Target, w.dest)
+	}
+	var dir string
+	switch m := ln.media.(type) {
+	case *movie:
+		dir = movieFolder(ln.Target, m)
+	case *episode:
+		dir, _ = episodeFolders(ln.Target, m)
+	default:
+		if len(parts) < 3 {
+			return "", fmt.Errorf("target %s is not within a folder of %s", ln.Target, w.dest)
+		}
+		return filepath.Join(w.dest, parts[0], parts[1]), nil
+	}
+	if dir == "" {
+		dir = filepath.Dir(ln.Target)
+	}
+	return dir, nil
+}
+
+// Add hashes the target of ln and records it in the manifest of its folder,
+// replacing any earlier entry for the same file.
+func (w *ChecksumWriter) Add(ln Link) error {
+	dir, err := w.folder(ln)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dir, ln.Target)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+
+	sum, err := hashFile(w.algo, ln.Target)
+	if err != nil {
+		return err
+	}
+
+	if w.xattrs {
+		if err := setXattr(ln.Target, checksumXattrPrefix+w.algo, []byte(sum)); err != nil {
+			return fmt.Errorf("failed to store checksum of %s with error %w", ln.Target, err)
+		}
+	}
+
+	var line string
+	if w.algo == "sfv" {
+		line = fmt.Sprintf("%s %s", rel, sum)
+	} else {
+		line = fmt.Sprintf("%s  %s", sum, rel)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.update(filepath.Join(dir, w.manifest), rel, line)
+}
+
+func (w *ChecksumWriter) update(manifest, rel, line string) error {
+	lines := []string{}
+	if f, err := os.Open(manifest); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			l := scanner.Text()
+			if p, _, ok := parseChecksumLine(w.algo, l); l == "" || (ok && p == rel) {
+				continue
+			}
+			lines = append(lines, l)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lines = append(lines, line)
+	return os.WriteFile(manifest, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,135 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseChecksumLine(t *testing.T) {
+	tests := []struct {
+		algo, line string
+		path, sum  string
+		ok         bool
+	}{
+		{"sha256", "ABC123  Season 1/a b.mkv", "Season 1/a b.mkv", "abc123", true},
+		{"xxhash", "# comment", "", "", false},
+		{"sfv", "Season 1/a b.mkv 0A1B2C3D", "Season 1/a b.mkv", "0a1b2c3d", true},
+		{"sfv", "; generated", "", "", false},
+		{"sfv", "nospace", "", "", false},
+		{"sha256", "", "", "", false},
+	}
+	for _, tt := range tests {
+		path, sum, ok := parseChecksumLine(tt.algo, tt.line)
+		if path != tt.path || sum != tt.sum || ok != tt.ok {
+			t.Errorf("parseChecksumLine(%q, %q) = %q, %q, %v, want %q, %q, %v", tt.algo, tt.line, path, sum, ok, tt.path, tt.sum, tt.ok)
+		}
+	}
+}
+
+func TestChecksumWriterAdd(t *testing.T) {
+	for _, algo := range []string{"sha256", "xxhash", "sfv"} {
+		t.Run(algo, func(t *testing.T) {
+			dest := t.TempDir()
+			target := filepath.Join(dest, "tv", "Show", "Season 1", "Show - S01E01.mkv")
+			os.MkdirAll(filepath.Dir(target), 0755)
+			if err := os.WriteFile(target, []byte("episode"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			w, err := NewChecksumWriter(dest, algo, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Adding twice replaces the entry
+			for i := 0; i < 2; i++ {
+				if err := w.Add(Link{Target: target}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sum, err := hashFile(algo, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := sum + "  Season 1/Show - S01E01.mkv\n"
+			if algo == "sfv" {
+				want = "Season 1/Show - S01E01.mkv " + sum + "\n"
+			}
+			b, err := os.ReadFile(filepath.Join(dest, "tv", "Show", checksumFormats[algo]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, string(b)); diff != "" {
+				t.Errorf("manifest mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestChecksumWriterSharded(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	options.SetOptions(WithShardedLayout(true))
+
+	dest := t.TempDir()
+	w, err := NewChecksumWriter(dest, "sha256", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for folder, m := range map[string]*movie{
+		"Alien (1979)":  {title: "Alien", year: 1979, path: "/dl/Alien.1979.mkv"},
+		"Aliens (1986)": {title: "Aliens", year: 1986, path: "/dl/Aliens.1986.mkv"},
+	} {
+		ln := Link{Src: m.path, Target: filepath.Join(dest, m.Target()), media: m}
+		os.MkdirAll(filepath.Dir(ln.Target), 0755)
+		if err := os.WriteFile(ln.Target, []byte(m.title), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Add(ln); err != nil {
+			t.Fatal(err)
+		}
+		manifest := filepath.Join(dest, "movies", "A", folder, checksumFormats["sha256"])
+		if _, err := os.Stat(manifest); err != nil {
+			t.Errorf("no manifest in %s: %v", filepath.Dir(manifest), err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "movies", "A", checksumFormats["sha256"])); !os.IsNotExist(err) {
+		t.Errorf("manifest written in the shard folder, want one per movie folder")
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"sha256": "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		"sfv":    "352441c2",
+		"xxhash": "44bc2cf5ad770999",
+	}
+	for algo, want := range tests {
+		got, err := hashFile(algo, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("hashFile(%q) = %s, want %s", algo, got, want)
+		}
+	}
+}
+
+func TestChecksumWriterOutsideFolder(t *testing.T) {
+	dest := t.TempDir()
+	w, err := NewChecksumWriter(dest, "sha256", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(Link{Target: filepath.Join(dest, "loose.mkv")}); err == nil {
+		t.Error("Add() of a target outside a movie or series folder returned no error")
+	}
+	if _, err := NewChecksumWriter(dest, "md5", false); err == nil {
+		t.Error("NewChecksumWriter() with an unsupported algorithm returned no error")
+	}
+}
@@ -0,0 +1,149 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ambiguityMargin is how close in confidence to the best search result
+// others are plausible matches too
+const ambiguityMargin = 0.05
+
+// defaultChoiceConfidence is the confidence below which the best search
+// result is doubted, unless WithMinConfidence sets another
+const defaultChoiceConfidence = 0.6
+
+// errNoChoice is returned by searches when none of the results was chosen
+var errNoChoice = errors.New("no search result was chosen")
+
+// Candidate is a search result to choose from, see WithChooser
+type Candidate struct {
+	Title      string
+	Year       int
+	TMDBID     int
+	Confidence float64
+}
+
+// Choice asks which of Candidates, sorted by confidence, is the media at
+// Path, searched for as Query and Year.
+type Choice struct {
+	Path string
+	// Type is AliasMovie or AliasSeries
+	Type       string
+	Query      string
+	Year       int
+	Candidates []Candidate
+}
+
+// CandidateProvider is a MetadataProvider that also returns the scored
+// results of its searches, best first, so that ambiguous searches can be
+// resolved by choosing among them. Other providers aren't asked.
+type CandidateProvider interface {
+	MetadataProvider
+	MovieCandidates(ctx context.Context, title string, year int) ([]MovieMetadata, error)
+	SeriesCandidates(ctx context.Context, name string, year int) ([]SeriesMetadata, error)
+}
+
+// WithChooser calls choose when a search is ambiguous: several results
+// match about as well as the best one, or the best one is doubtful, below
+// the minimum confidence of WithMinConfidence or 0.6. choose returns the
+// index of the right candidate, or -1 to keep the names parsed from the
+// path. Chosen matches are recorded as aliases, so that they're not asked
+// again. choose may be called by several workers at once.
+func WithChooser(choose func(Choice) int) Option {
+	return func(o *Options) {
+		o.chooser = choose
+	}
+}
+
+// ambiguous reports whether the best of confidences, sorted best first,
+// should be confirmed
+func ambiguous(confidences []float64) bool {
+	if len(confidences) == 0 {
+		return false
+	}
+	if confidences[0] < max(options.minConfidence, defaultChoiceConfidence) {
+		return true
+	}
+	return len(confidences) > 1 && confidences[0]-confidences[1] < ambiguityMargin
+}
+
+// choose asks options.chooser about c, returning the index of the chosen
+// candidate, or -1 when none is. The choice is recorded as an alias of the
+// title and year parsed from the path, which lookups consult.
+func choose(c Choice, title string, year int) int {
+	n := options.chooser(c)
+	if n < 0 || n >= len(c.Candidates) {
+		return -1
+	}
+	if id := c.Candidates[n].TMDBID; id != 0 {
+		if err := options.aliases.Record(Alias{Type: c.Type, Title: title, Year: year, ID: id}); err != nil {
+			options.logger.Warn("failed to record the chosen match as an alias", "path", c.Path, "error", err)
+		}
+	}
+	return n
+}
+
+// searchMovie searches p for m as query, asking options.chooser to resolve
+// ambiguous results. It returns errNoChoice when no result was chosen.
+func searchMovie(ctx context.Context, p MetadataProvider, m *movie, query string, year int) (MovieMetadata, error) {
+	cp, ok := p.(CandidateProvider)
+	if options.chooser == nil || !ok {
+		return p.SearchMovie(ctx, query, year)
+	}
+	results, err := cp.MovieCandidates(ctx, query, year)
+	if err != nil {
+		return MovieMetadata{}, err
+	}
+	if len(results) == 0 {
+		return MovieMetadata{}, fmt.Errorf("%w for %q", ErrNoMatch, query)
+	}
+	confidences := make([]float64, len(results))
+	candidates := make([]Candidate, len(results))
+	for i, r := range results {
+		confidences[i] = r.Confidence
+		candidates[i] = Candidate{Title: r.Title, Year: r.Year, TMDBID: r.TMDBID, Confidence: r.Confidence}
+	}
+	if !ambiguous(confidences) {
+		return results[0], nil
+	}
+	n := choose(Choice{Path: m.path, Type: AliasMovie, Query: query, Year: year, Candidates: candidates}, m.title, m.year)
+	if n < 0 {
+		return MovieMetadata{}, errNoChoice
+	}
+	res := results[n]
+	res.Confidence = 1
+	return res, nil
+}
+
+// searchSeries searches p for the series of e, like searchMovie
+func searchSeries(ctx context.Context, p MetadataProvider, e *episode) (SeriesMetadata, error) {
+	cp, ok := p.(CandidateProvider)
+	if options.chooser == nil || !ok {
+		return p.SearchSeries(ctx, e.series, e.year)
+	}
+	results, err := cp.SeriesCandidates(ctx, e.series, e.year)
+	if err != nil {
+		return SeriesMetadata{}, err
+	}
+	if len(results) == 0 {
+		return SeriesMetadata{}, fmt.Errorf("%w for %q", ErrNoMatch, e.series)
+	}
+	confidences := make([]float64, len(results))
+	candidates := make([]Candidate, len(results))
+	for i, r := range results {
+		confidences[i] = r.Confidence
+		candidates[i] = Candidate{Title: r.Name, Year: r.Year, TMDBID: r.TMDBID, Confidence: r.Confidence}
+	}
+	if !ambiguous(confidences) {
+		return results[0], nil
+	}
+	n := choose(Choice{Path: e.path, Type: AliasSeries, Query: e.series, Year: e.year, Candidates: candidates}, e.series, e.year)
+	if n < 0 {
+		return SeriesMetadata{}, errNoChoice
+	}
+	res := results[n]
+	res.Confidence = 1
+	return res, nil
+}
@@ -0,0 +1,61 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestChooser(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch q := r.URL.Query().Get("query"); {
+		case r.URL.Path != "/3/search/movie":
+			http.NotFound(w, r)
+		case q == "Crash":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[
+				{"id":779001,"title":"Crash","release_date":"2004-09-10","popularity":30},
+				{"id":779002,"title":"Crash","release_date":"1996-07-04","popularity":25}]}`)
+		case q == "Heat":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[
+				{"id":779003,"title":"Heat","release_date":"1995-12-15","popularity":60},
+				{"id":779004,"title":"Heat Wave","release_date":"1990-01-01","popularity":1}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	var asked []Choice
+	answer := 1
+	WithChooser(func(c Choice) int {
+		asked = append(asked, c)
+		return answer
+	})(options)
+
+	l, _ := NewLinkable("/dl/Crash.mkv")
+	lookup(context.Background(), options.metadataProvider(), l)
+	if m := l.(*movie); m.tmdbID != 779002 || m.year != 1996 {
+		t.Errorf("lookup() = %d (%d), want the chosen 779002 (1996)", m.tmdbID, m.year)
+	}
+	if len(asked) != 1 || len(asked[0].Candidates) != 2 || asked[0].Type != AliasMovie {
+		t.Fatalf("chooser was asked %+v, want one choice of 2 movies", asked)
+	}
+
+	// Choosing none keeps the parsed names
+	answer = -1
+	l, _ = NewLinkable("/dl/other/crash.mkv")
+	lookup(context.Background(), options.metadataProvider(), l)
+	if m := l.(*movie); m.tmdbID != 0 || m.title != "Crash" {
+		t.Errorf("lookup() = %q (%d), want the parsed name kept", m.title, m.tmdbID)
+	}
+
+	// Clear matches aren't asked about
+	asked = nil
+	l, _ = NewLinkable("/dl/Heat.mkv")
+	lookup(context.Background(), options.metadataProvider(), l)
+	if m := l.(*movie); m.tmdbID != 779003 || len(asked) != 0 {
+		t.Errorf("lookup() = %d after %d choices, want 779003 without asking", m.tmdbID, len(asked))
+	}
+}
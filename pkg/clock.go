@@ -0,0 +1,104 @@
+package kourai
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Clock tells the time to the checks that depend on it, e.g. the settle
+// time of files and the expiry of ignores, so that tests can simulate it.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the channel once d passed
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock of the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WithClock tells the time with c instead of the system clock, which nil
+// restores.
+func WithClock(c Clock) Option {
+	return func(o *Options) {
+		if c == nil {
+			c = systemClock{}
+		}
+		o.clock = c
+	}
+}
+
+// FileSystem is the file system sources are found and checked in, so that
+// tests can simulate the files of the sources and how they change. Targets
+// are always created on the operating system's file system, and files
+// without its inode information, i.e. of other file systems, aren't
+// recognized by WithStateDB and WithSkipLinked.
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	// WalkDir walks the tree at root as filepath.WalkDir does
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// osFileSystem is the FileSystem of the os package
+type osFileSystem struct{}
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (osFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
+
+// WithFileSystem finds and checks the files of the sources in fsys instead
+// of the operating system's file system, which nil restores.
+func WithFileSystem(fsys FileSystem) Option {
+	return func(o *Options) {
+		if fsys == nil {
+			fsys = osFileSystem{}
+		}
+		o.fs = fsys
+	}
+}
+
+// mountedFS is an fs.FS at a path of the operating system's file system
+type mountedFS struct {
+	root string
+	fsys fs.FS
+}
+
+// MountFS returns the FileSystem of fsys, e.g. a testing/fstest.MapFS,
+// as if it were mounted at the absolute path root, for WithFileSystem.
+// Paths outside root don't exist.
+func MountFS(root string, fsys fs.FS) FileSystem {
+	return mountedFS{root: filepath.Clean(root), fsys: fsys}
+}
+
+// name returns the name in m.fsys of the path p
+func (m mountedFS) name(p string) (string, bool) {
+	rel, err := filepath.Rel(m.root, filepath.Clean(p))
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (m mountedFS) Stat(p string) (fs.FileInfo, error) {
+	name, ok := m.name(p)
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+	}
+	return fs.Stat(m.fsys, name)
+}
+
+func (m mountedFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	name, ok := m.name(root)
+	if !ok {
+		return fn(root, nil, &fs.PathError{Op: "lstat", Path: root, Err: fs.ErrNotExist})
+	}
+	return fs.WalkDir(m.fsys, name, func(p string, d fs.DirEntry, err error) error {
+		return fn(filepath.Join(m.root, filepath.FromSlash(p)), d, err)
+	})
+}
@@ -0,0 +1,140 @@
+package kourai
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeClock is a Clock whose time only passes when advanced
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := fakeWaiter{c.now.Add(d), make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+	} else {
+		c.waiters = append(c.waiters, w)
+	}
+	return w.c
+}
+
+// waiting returns the number of pending After calls
+func (c *fakeClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+// changingFS stats files in after once changed is set, as they were
+// written to
+type changingFS struct {
+	FileSystem
+	after   FileSystem
+	changed atomic.Bool
+}
+
+func (f *changingFS) Stat(name string) (fs.FileInfo, error) {
+	if f.changed.Load() {
+		return f.after.Stat(name)
+	}
+	return f.FileSystem.Stat(name)
+}
+
+func TestClockAndFileSystem(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: now}
+	root := filepath.Join(t.TempDir(), "dl")
+	files := fstest.MapFS{
+		"Heat.1995.mkv":             {Data: []byte("video"), ModTime: now.Add(-time.Hour)},
+		"Alien.1979/Alien.1979.mkv": {Data: []byte("video"), ModTime: now.Add(-10 * time.Second)},
+		"Dune.2021.mkv":             {Data: []byte("vid"), ModTime: now.Add(-10 * time.Second)},
+		"notes.txt":                 {Data: []byte("notes")},
+	}
+	written := fstest.MapFS{}
+	for name, f := range files {
+		written[name] = f
+	}
+	written["Dune.2021.mkv"] = &fstest.MapFile{Data: []byte("video"), ModTime: now.Add(30 * time.Second)}
+	fsys := &changingFS{FileSystem: MountFS(root, files), after: MountFS(root, written)}
+	options.SetOptions(
+		WithClock(clock),
+		WithFileSystem(fsys),
+		WithFileExtensions([]string{"mkv"}),
+		WithSettleTime(time.Minute),
+		WithIgnores([]Ignore{{Pattern: "Cats", Expires: now.Add(-time.Second)}}),
+	)
+	if err := options.loadIgnores(); err != nil {
+		t.Fatal(err)
+	}
+	if options.ignores != nil {
+		t.Errorf("ignores expired at the time of the clock were loaded: %+v", options.ignores)
+	}
+
+	media, errc := findFiles(context.Background(), root, options.fileFilters...)
+	// The recent files are waited for, and Dune is still written to then
+	for clock.waiting() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	fsys.changed.Store(true)
+	clock.advance(time.Minute)
+	got := []string{}
+	for m := range media {
+		rel, _ := filepath.Rel(root, m.Path())
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{"Alien.1979/Alien.1979.mkv", "Heat.1995.mkv"}, got); diff != "" {
+		t.Errorf("findFiles() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := options.fs.Stat(filepath.Join(filepath.Dir(root), "other")); err == nil {
+		t.Error("Stat() of a path outside the mounted file system returned no error")
+	}
+}
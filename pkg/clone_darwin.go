@@ -0,0 +1,10 @@
+package kourai
+
+import "golang.org/x/sys/unix"
+
+// cloneFile creates target as an APFS clone of src, which shares its data
+// blocks until either is modified, so copies are instant and take no
+// space. It fails on filesystems without clones, or across volumes.
+func cloneFile(src, target string) error {
+	return unix.Clonefile(src, target, unix.CLONE_NOFOLLOW)
+}
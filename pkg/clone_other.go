@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package kourai
+
+import "errors"
+
+func cloneFile(src, target string) error {
+	return errors.New("file clones are only supported on macOS")
+}
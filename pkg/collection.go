@@ -0,0 +1,93 @@
+package kourai
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SetsDir is the folder of the destination holding the artwork and
+// information of movie sets, to be configured as the "Movie set information
+// folder" in Kodi.
+const SetsDir = "sets"
+
+// setNFO is the set.nfo written for a movie set
+type setNFO struct {
+	XMLName  xml.Name `xml:"set"`
+	Title    string   `xml:"title"`
+	Overview string   `xml:"overview,omitempty"`
+	UniqueID struct {
+		Type string `xml:"type,attr"`
+		ID   int    `xml:",chardata"`
+	} `xml:"uniqueid"`
+}
+
+// setNameReplacer removes characters that aren't allowed in folder names on
+// common filesystems from set names
+var setNameReplacer = strings.NewReplacer("/", "-", `\`, "-", ":", " -", "*", "", "?", "", `"`, "", "<", "", ">", "", "|", "")
+
+// CollectionSet writes the information and artwork of the TMDB collection
+// the movie of ln belongs to, when collection sets are enabled:
+//
+//	<dest>/sets/<Collection>/set.nfo
+//	<dest>/sets/<Collection>/poster.jpg
+//	<dest>/sets/<Collection>/fanart.jpg
+//
+// Existing files are kept. Nothing is done for episodes, or movies that
+// don't belong to a collection.
+func (ln Link) CollectionSet(ctx context.Context) error {
+	m, ok := ln.media.(*movie)
+	if !ok || ln.setsDir == "" || m.tmdbID == 0 || options.TMDBClient == nil {
+		return nil
+	}
+	details, err := options.TMDBClient.MovieDetails(ctx, m.tmdbID)
+	if err != nil || details.BelongsToCollection == nil {
+		return err
+	}
+	c, err := options.TMDBClient.CollectionDetails(ctx, int(details.BelongsToCollection.ID))
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(ln.setsDir, setNameReplacer.Replace(c.Name))
+	if err := ln.perms.mkdirAll(dir); err != nil {
+		return err
+	}
+	var errs []error
+	path := filepath.Join(dir, "set.nfo")
+	if _, loaded := artworkPending.LoadOrStore(path, struct{}{}); !loaded {
+		if _, err := os.Stat(path); err != nil {
+			nfo := setNFO{Title: c.Name, Overview: c.Overview}
+			nfo.UniqueID.Type, nfo.UniqueID.ID = "tmdb", int(c.ID)
+			errs = append(errs, writeNFO(path, nfo, ln.perms))
+		}
+	}
+	if c.PosterPath != "" {
+		errs = append(errs, placeArtwork(ctx, c.PosterPath, filepath.Join(dir, "poster.jpg"), ln.perms))
+	}
+	if c.BackdropPath != "" {
+		errs = append(errs, placeArtwork(ctx, c.BackdropPath, filepath.Join(dir, "fanart.jpg"), ln.perms))
+	}
+	return errors.Join(errs...)
+}
+
+// setCollection sets the collection of m to the TMDB collection it belongs
+// to, if any. Failed lookups leave m out of a collection folder.
+func (m *movie) setCollection(ctx context.Context) {
+	if m.tmdbID == 0 || options.TMDBClient == nil {
+		return
+	}
+	details, err := options.TMDBClient.MovieDetails(ctx, m.tmdbID)
+	if err != nil {
+		if ctx.Err() == nil {
+			options.logger.Warn("collection lookup failed", "path", m.path, "error", err)
+		}
+		return
+	}
+	if details.BelongsToCollection != nil {
+		m.collection = details.BelongsToCollection.Name
+	}
+}
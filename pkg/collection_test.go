@@ -0,0 +1,199 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSetNFO(t *testing.T) {
+	nfo := setNFO{Title: "Dune Collection", Overview: "Spice & sand."}
+	nfo.UniqueID.Type, nfo.UniqueID.ID = "tmdb", 726871
+	path := filepath.Join(t.TempDir(), "set.nfo")
+	if err := writeNFO(path, nfo, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<set>
+  <title>Dune Collection</title>
+  <overview>Spice &amp; sand.</overview>
+  <uniqueid type="tmdb">726871</uniqueid>
+</set>
+`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Errorf("set.nfo mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// collectionTMDB serves movies 762001 and 762002, the first in collection
+// 8091, and images containing their path
+func collectionTMDB(t *testing.T) {
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/movie/762001"):
+			fmt.Fprint(w, `{"id":762001,"title":"Alien","release_date":"1979-05-25","belongs_to_collection":{"id":8091,"name":"Alien: Collection"}}`)
+		case strings.HasSuffix(r.URL.Path, "/movie/762002"):
+			fmt.Fprint(w, `{"id":762002,"title":"Heat","release_date":"1995-12-15"}`)
+		case strings.HasSuffix(r.URL.Path, "/collection/8091"):
+			fmt.Fprint(w, `{"id":8091,"name":"Alien: Collection","overview":"Xenomorphs.","poster_path":"/poster.jpg","backdrop_path":"/backdrop.jpg"}`)
+		case strings.HasPrefix(r.URL.Path, "/3/"):
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(r.URL.Path[strings.LastIndex(r.URL.Path, "/"):]))
+		}
+	}))
+}
+
+// setFiles returns the files below dir, with their content
+func setFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCollectionSet(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	collectionTMDB(t)
+
+	nfo := `<?xml version="1.0" encoding="UTF-8"?>
+<set>
+  <title>Alien: Collection</title>
+  <overview>Xenomorphs.</overview>
+  <uniqueid type="tmdb">8091</uniqueid>
+</set>
+`
+	tests := []struct {
+		name     string
+		media    Linkable
+		existing map[string]string
+		want     map[string]string
+	}{
+		{
+			name:  "movie in a collection",
+			media: &movie{title: "Alien", year: 1979, tmdbID: 762001},
+			want: map[string]string{
+				"Alien - Collection/set.nfo":    nfo,
+				"Alien - Collection/poster.jpg": "/poster.jpg",
+				"Alien - Collection/fanart.jpg": "/backdrop.jpg",
+			},
+		},
+		{
+			name:     "existing files are kept",
+			media:    &movie{title: "Alien", year: 1979, tmdbID: 762001},
+			existing: map[string]string{"Alien - Collection/set.nfo": "mine", "Alien - Collection/poster.jpg": "mine"},
+			want: map[string]string{
+				"Alien - Collection/set.nfo":    "mine",
+				"Alien - Collection/poster.jpg": "mine",
+				"Alien - Collection/fanart.jpg": "/backdrop.jpg",
+			},
+		},
+		{
+			name:  "movie without a collection",
+			media: &movie{title: "Heat", year: 1995, tmdbID: 762002},
+			want:  map[string]string{},
+		},
+		{
+			name:  "movie without a TMDB ID",
+			media: &movie{title: "Alien", year: 1979},
+			want:  map[string]string{},
+		},
+		{
+			name:  "episode",
+			media: &episode{series: "Alien", season: 1, episode: 1, tmdbID: 762001},
+			want:  map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sets := filepath.Join(t.TempDir(), SetsDir)
+			if err := os.MkdirAll(filepath.Join(sets, "Alien - Collection"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tt.existing {
+				if err := os.WriteFile(filepath.Join(sets, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ln := Link{setsDir: sets, media: tt.media}
+			if err := ln.CollectionSet(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, setFiles(t, sets)); diff != "" {
+				t.Errorf("set files mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCollectionFolders(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+	}{
+		{
+			name: "default layout",
+			want: []string{"movies/Alien - Collection/Alien (1979)/alien.1979.mkv", "movies/Heat (1995)/heat.1995.mkv"},
+		},
+		{
+			name:     "template",
+			template: "Films/{{.Collection}}/{{.Title}}{{.Ext}}",
+			want:     []string{"Films/Alien - Collection/Alien.mkv", "Films/Heat.mkv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options = NewOptions()
+			collectionTMDB(t)
+			WithCollectionFolders(true)(options)
+			if tt.template != "" {
+				tmpl, err := ParseTargetTemplate(tt.template)
+				if err != nil {
+					t.Fatal(err)
+				}
+				options.movieTarget = tmpl
+			}
+			var got []string
+			for _, m := range []*movie{
+				{title: "Alien", year: 1979, path: "alien.1979.mkv", tmdbID: 762001},
+				{title: "Heat", year: 1995, path: "heat.1995.mkv", tmdbID: 762002},
+			} {
+				ln, ok := linkFromMedia(context.Background(), m)
+				if !ok {
+					t.Fatalf("linkFromMedia(%s) skipped the movie", m.title)
+				}
+				rel, _ := filepath.Rel(options.dest, ln.Target)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("targets mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
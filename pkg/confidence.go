@@ -0,0 +1,105 @@
+package kourai
+
+import (
+	"fmt"
+)
+
+// maxCandidates is the most search results scored to find the best match
+const maxCandidates = 10
+
+// Weights of the parts of match confidence, adding up to 1
+const (
+	titleWeight      = 0.7
+	yearWeight       = 0.2
+	popularityWeight = 0.1
+)
+
+// WithMinConfidence rejects search results matching the media they were
+// searched for with a confidence below min, between 0 and 1, e.g. 0.6.
+// Rejected media keep the names parsed from their paths and are flagged in
+// reports, or aren't linked at all when skip is set. Zero accepts every
+// result.
+func WithMinConfidence(min float64, skip bool) Option {
+	return func(o *Options) {
+		o.minConfidence = min
+		o.skipUnsure = skip
+	}
+}
+
+// matchConfidence scores how well a search result matches the query it was
+// found with, from 0 to 1, by the similarity of the query to the best of
+// the names of the result, the distance of the release years when both are
+// known, and the popularity of the result, which breaks ties between
+// remakes and namesakes.
+func matchConfidence(query string, year int, names []string, resultYear int, popularity float64) float64 {
+	var title float64
+	for _, n := range names {
+		title = max(title, similarity(query, n))
+	}
+	years := 0.5
+	if year > 0 && resultYear > 0 {
+		d := year - resultYear
+		if d < 0 {
+			d = -d
+		}
+		years = max(0, 1-0.25*float64(d))
+	}
+	pop := max(popularity, 0) / (max(popularity, 0) + 20)
+	return titleWeight*title + yearWeight*years + popularityWeight*pop
+}
+
+// similarity is 1 for names equal ignoring case and punctuation, down to 0
+// for names with nothing in common, by their edit distance
+func similarity(a, b string) float64 {
+	ra, rb := []rune(folderKey(a)), []rune(folderKey(b))
+	n := max(len(ra), len(rb))
+	if n == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(n)
+}
+
+// levenshtein returns the number of runes inserted, deleted or substituted
+// to turn a into b
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Confidence returns how well the best search result for l matched it,
+// from 0 to 1, or 0 when l wasn't searched for, e.g. because it was found
+// by ID.
+func Confidence(l Linkable) float64 {
+	switch v := l.(type) {
+	case *movie:
+		return v.confidence
+	case *episode:
+		return v.confidence
+	}
+	return 0
+}
+
+// unsure reports whether the best search result for l was rejected for its
+// low confidence, see WithMinConfidence, and describes it
+func unsure(l Linkable) (string, bool) {
+	c := Confidence(l)
+	if c <= 0 || c >= options.minConfidence {
+		return "", false
+	}
+	return fmt.Sprintf("low-confidence match (%.2f)", c), true
+}
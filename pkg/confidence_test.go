@@ -0,0 +1,71 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMatchConfidence(t *testing.T) {
+	exact := matchConfidence("Heat", 1995, []string{"Heat"}, 1995, 50)
+	if exact < 0.95 {
+		t.Errorf("matchConfidence() of an exact match = %.2f, want at least 0.95", exact)
+	}
+	if c := matchConfidence("Heat", 1995, []string{"Heat"}, 1986, 50); c >= exact {
+		t.Errorf("matchConfidence() of another year = %.2f, want less than %.2f", c, exact)
+	}
+	if c := matchConfidence("Heat", 0, []string{"Le Samouraï", "Heat"}, 1967, 0); c < 0.7 {
+		t.Errorf("matchConfidence() of an original title = %.2f, want at least 0.7", c)
+	}
+	if c := matchConfidence("The Matrix", 1999, []string{"Sherlock Holmes and the Matrix Murders"}, 2013, 1); c > 0.5 {
+		t.Errorf("matchConfidence() of an unrelated title = %.2f, want at most 0.5", c)
+	}
+	if got := similarity("Marvel's Agents of S.H.I.E.L.D.", "marvels agents of shield"); got != 1 {
+		t.Errorf("similarity() ignoring punctuation = %.2f, want 1", got)
+	}
+}
+
+func TestMinConfidence(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch q := r.URL.Query().Get("query"); {
+		case r.URL.Path != "/3/search/movie":
+			http.NotFound(w, r)
+		case q == "Solaris":
+			// TMDB ranks the popular remake first
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[
+				{"id":778001,"title":"Solaris","release_date":"2002-11-27","popularity":30},
+				{"id":778002,"title":"Solaris","release_date":"1972-03-20","popularity":15}]}`)
+		default:
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[
+				{"id":778003,"title":"Completely Different Film","release_date":"1990-01-01","popularity":2}]}`)
+		}
+	}))
+
+	// The result of the right year is preferred to the first
+	l, _ := NewLinkable("/dl/Solaris.1972.mkv")
+	lookup(context.Background(), options.metadataProvider(), l)
+	if m := l.(*movie); m.tmdbID != 778002 {
+		t.Errorf("lookup() matched TMDB ID %d, want 778002", m.tmdbID)
+	}
+
+	WithMinConfidence(0.6, false)(options)
+	l, _ = NewLinkable("/dl/Obscure.Home.Video.1991.mkv")
+	lookup(context.Background(), options.metadataProvider(), l)
+	m := l.(*movie)
+	if m.title != "Obscure Home Video" || m.tmdbID != 0 {
+		t.Errorf("lookup() used a low-confidence match %q (%d)", m.title, m.tmdbID)
+	}
+	if reason, ok := unsure(m); !ok {
+		t.Errorf("unsure() = false, want a low-confidence match")
+	} else if got := lowConfidence(m); got == "" {
+		t.Errorf("lowConfidence() = %q, want %q flagged", got, reason)
+	}
+
+	WithMinConfidence(0.6, true)(options)
+	if _, ok := linkFromMedia(context.Background(), m); ok {
+		t.Errorf("linkFromMedia() linked a low-confidence match")
+	}
+}
@@ -0,0 +1,43 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// existingDirs replaces the directories of target, relative to dest, that
+// don't exist with existing ones whose names only differ in case or
+// punctuation, e.g. "Marvel's Agents of S.H.I.E.L.D." and "Marvels Agents
+// of SHIELD". Writers whose lookups differ slightly, or that raced to create
+// a series, then add to one folder instead of creating duplicates.
+func existingDirs(dest, target string) string {
+	parts := strings.Split(filepath.ToSlash(target), "/")
+	dir := dest
+	for i, name := range parts[:len(parts)-1] {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			dir = p
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Nothing exists below a missing directory
+			break
+		}
+		key := folderKey(name)
+		for _, e := range entries {
+			if e.IsDir() && folderKey(e.Name()) == key {
+				parts[i] = e.Name()
+				break
+			}
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// folderKey strips everything but letters and digits from name
+func folderKey(name string) string {
+	return aliasNormalizeExpr.ReplaceAllString(strings.ToLower(name), "")
+}
@@ -0,0 +1,80 @@
+package kourai
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// copyPath copies src to target, recursing into directories. It's used
+// when src can't be linked, e.g. because it's on another filesystem.
+func copyPath(src, target string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return copyFile(src, target, info)
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(target, rel)
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(path, dst, info)
+	})
+}
+
+// copyFile clones src to target where the filesystem supports it, e.g.
+// on APFS. Otherwise it streams src into a temporary file next to target,
+// which is renamed into place once complete so that a partial copy is
+// never left at the target. The mode and modification time of src are
+// preserved.
+func copyFile(src, target string, info fs.FileInfo) error {
+	if err := cloneFile(src, target); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, throttled(context.Background(), in, options.copyLimiters...)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,72 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCopyFile(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src.mkv")
+	if err := os.WriteFile(src, []byte("movie"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(src, mtime, mtime)
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(root, "target.mkv")
+	if err := copyFile(src, target, info); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(info, got) {
+		t.Error("copyFile() linked the source instead of copying it")
+	}
+	if got.Mode() != info.Mode() || !got.ModTime().Equal(mtime) {
+		t.Errorf("copyFile() target mode %v, mtime %v, want %v, %v", got.Mode(), got.ModTime(), info.Mode(), mtime)
+	}
+	if b, _ := os.ReadFile(target); string(b) != "movie" {
+		t.Errorf("copyFile() target contains %q", b)
+	}
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 2 {
+		t.Errorf("copyFile() left %d files, want 2", len(entries))
+	}
+}
+
+func TestCopyPathDirectory(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	files := []string{"a.mkv", "sub/b.srt"}
+	for _, f := range files {
+		os.MkdirAll(filepath.Join(src, filepath.Dir(f)), 0755)
+		os.WriteFile(filepath.Join(src, f), []byte(f), 0644)
+	}
+	target := filepath.Join(root, "target")
+	if err := copyPath(src, target); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	filepath.WalkDir(target, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(target, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if diff := cmp.Diff(files, got); diff != "" {
+		t.Errorf("copyPath() mismatch (-want +got):\n%s", diff)
+	}
+}
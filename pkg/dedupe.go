@@ -0,0 +1,84 @@
+package kourai
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// WithSourcePriority ranks source directories for resolving duplicates:
+// when media of several sources have the same target, the one below the
+// earliest of dirs is linked, e.g. a folder of remuxes before one of web
+// releases, whatever the quality tagged in their names. Sources below none
+// of dirs rank last, and media of the same rank keep the order they were
+// found in.
+func WithSourcePriority(dirs []string) Option {
+	return func(o *Options) {
+		o.sourcePriority = nil
+		for _, d := range dirs {
+			if d = strings.TrimSpace(d); d != "" {
+				o.sourcePriority = append(o.sourcePriority, absPath(d))
+			}
+		}
+	}
+}
+
+// SourcePriorities reports whether sources are ranked, see
+// WithSourcePriority.
+func SourcePriorities() bool {
+	return len(options.sourcePriority) > 0
+}
+
+// sourceRank returns the index of the first ranked source directory path
+// is below, or the number of them when it's below none
+func sourceRank(path string) int {
+	path = absPath(path)
+	for i, dir := range options.sourcePriority {
+		if rel, err := filepath.Rel(dir, path); err == nil && filepath.IsLocal(rel) {
+			return i
+		}
+	}
+	return len(options.sourcePriority)
+}
+
+// winners returns, for each of n items, the index of the item linked to
+// its target, by the rank of their sources and then their order, or -1
+// for items without a target. Targets are compared ignoring case, as some
+// filesystems do.
+func winners(n int, target, src func(int) string) []int {
+	first := map[string]int{}
+	for i := 0; i < n; i++ {
+		if target(i) == "" {
+			continue
+		}
+		key := strings.ToLower(target(i))
+		if w, ok := first[key]; !ok || sourceRank(src(i)) < sourceRank(src(w)) {
+			first[key] = i
+		}
+	}
+	won := make([]int, n)
+	for i := range won {
+		won[i] = -1
+		if target(i) != "" {
+			won[i] = first[strings.ToLower(target(i))]
+		}
+	}
+	return won
+}
+
+// DedupeLinks keeps one of the links having the same target, that of the
+// highest ranked source, see WithSourcePriority, or else the first of them
+// in the order given, since only one file can be linked to a target. The
+// links dropped are returned in the order given too.
+func DedupeLinks(links []Link) (kept, dropped []Link) {
+	won := winners(len(links),
+		func(i int) string { return links[i].Target },
+		func(i int) string { return links[i].Src })
+	for i, l := range links {
+		if won[i] == i || won[i] < 0 {
+			kept = append(kept, l)
+		} else {
+			dropped = append(dropped, l)
+		}
+	}
+	return kept, dropped
+}
@@ -0,0 +1,50 @@
+package kourai
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDedupeLinks(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	links := []Link{
+		{Src: "/data/web/Alien.1979.2160p.WEB-DL.mkv", Target: "/media/movies/Alien (1979)/Alien.mkv"},
+		{Src: "/data/other/Alien.1979.mkv", Target: "/media/movies/Alien (1979)/Alien.mkv"},
+		{Src: "/data/remux/Alien.1979.1080p.Remux.mkv", Target: "/media/movies/Alien (1979)/alien.mkv"},
+		{Src: "/data/web/Heat.1995.mkv", Target: "/media/movies/Heat (1995)/Heat.mkv"},
+		{Src: "/data/other/Heat.1995.mkv", Target: "/media/movies/Heat (1995)/Heat.mkv"},
+	}
+	srcs := func(links []Link) []string {
+		s := []string{}
+		for _, l := range links {
+			s = append(s, l.Src)
+		}
+		return s
+	}
+
+	kept, _ := DedupeLinks(links)
+	if diff := cmp.Diff([]string{"/data/web/Alien.1979.2160p.WEB-DL.mkv", "/data/web/Heat.1995.mkv"}, srcs(kept)); diff != "" {
+		t.Errorf("DedupeLinks() without priorities mismatch (-want +got):\n%s", diff)
+	}
+
+	options.SetOptions(WithSourcePriority([]string{"/data/remux", "/data/web/"}))
+	kept, dropped := DedupeLinks(links)
+	if diff := cmp.Diff([]string{"/data/remux/Alien.1979.1080p.Remux.mkv", "/data/web/Heat.1995.mkv"}, srcs(kept)); diff != "" {
+		t.Errorf("DedupeLinks() kept mismatch (-want +got):\n%s", diff)
+	}
+	if len(dropped) != 3 {
+		t.Errorf("DedupeLinks() dropped %v, want the 3 others", srcs(dropped))
+	}
+
+	results := []ScanResult{
+		{Path: "/data/web/Heat.1995.mkv", Target: "movies/Heat (1995)/Heat.mkv"},
+		{Path: "/data/remux/Heat.1995.mkv", Target: "movies/Heat (1995)/Heat.mkv"},
+	}
+	MarkDuplicates(results)
+	if results[0].SkippedBecause != SkipDuplicate || results[1].SkippedBecause != "" {
+		t.Errorf("MarkDuplicates() = %+v, want the web source skipped", results)
+	}
+}
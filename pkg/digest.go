@@ -0,0 +1,142 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digest summarizes what a watch imported over a period, e.g. a week, to be
+// sent as a single notification rather than one per file.
+type Digest struct {
+	// From and To bound the period summarized
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Added are the targets created
+	Added []string `json:"added"`
+	// Failed are the sources that couldn't be looked up or linked
+	Failed []DigestFailure `json:"failed"`
+	// Review are the targets matched by a search with a low confidence,
+	// which "kourai rematch" looks up again
+	Review []string `json:"review"`
+}
+
+// DigestFailure is a source that failed and why
+type DigestFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// DigestFields are the values available to the arguments of digest hooks,
+// see ParseDigestHook.
+type DigestFields struct {
+	From time.Time
+	To   time.Time
+	// Added, Failed and Review count the entries of the digest
+	Added  int
+	Failed int
+	Review int
+	// Summary is the digest as Markdown, see Digest.WriteMarkdown
+	Summary string
+}
+
+// ParseDigestHook parses the command and arguments of a hook notified of
+// digests, checking that they only use the fields of DigestFields.
+func ParseDigestHook(args []string) (*Hook, error) {
+	return parseHook(args, DigestFields{})
+}
+
+// DigestCollector accumulates a Digest from the links created and the
+// errors of a watch, see Created and Failed, which are safe to call from
+// several goroutines.
+type DigestCollector struct {
+	reviewBelow float64
+
+	mu sync.Mutex
+	d  Digest
+}
+
+// NewDigestCollector starts a digest from now. Targets matched with a
+// confidence below reviewBelow, from 0 to 1, are listed for review.
+func NewDigestCollector(reviewBelow float64) *DigestCollector {
+	return &DigestCollector{reviewBelow: reviewBelow, d: Digest{From: time.Now()}}
+}
+
+// Created adds the target of l.
+func (c *DigestCollector) Created(l Link) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.d.Added = append(c.d.Added, l.Target)
+	if conf := Confidence(l.media); conf > 0 && conf < c.reviewBelow {
+		c.d.Review = append(c.d.Review, l.Target)
+	}
+}
+
+// Failed adds the failure of the source at path; it can be given to
+// WithEvents as OnError.
+func (c *DigestCollector) Failed(path string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.d.Failed = append(c.d.Failed, DigestFailure{Path: path, Error: err.Error()})
+}
+
+// Take returns the digest of the period up to now, and starts the next one.
+func (c *DigestCollector) Take() Digest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := c.d
+	d.To = time.Now()
+	c.d = Digest{From: d.To}
+	return d
+}
+
+// Empty reports whether nothing was imported or failed.
+func (d Digest) Empty() bool {
+	return len(d.Added) == 0 && len(d.Failed) == 0
+}
+
+// WriteMarkdown writes d as a Markdown section, e.g. to post to a chat.
+func (d Digest) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Imports %s to %s\n", d.From.Local().Format("2006-01-02"), d.To.Local().Format("2006-01-02"))
+	list := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n### %s (%d)\n", title, len(items))
+		for _, item := range items {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+	list("Added", d.Added)
+	failed := make([]string, len(d.Failed))
+	for i, f := range d.Failed {
+		failed[i] = f.Path + ": " + f.Error
+	}
+	list("Failed", failed)
+	list("To review", d.Review)
+	if d.Empty() {
+		b.WriteString("\nNothing was imported.\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Notify runs h, parsed with ParseDigestHook, with the fields of d.
+func (d Digest) Notify(ctx context.Context, h *Hook) error {
+	var summary strings.Builder
+	if err := d.WriteMarkdown(&summary); err != nil {
+		return err
+	}
+	return h.run(ctx, DigestFields{
+		From:    d.From,
+		To:      d.To,
+		Added:   len(d.Added),
+		Failed:  len(d.Failed),
+		Review:  len(d.Review),
+		Summary: summary.String(),
+	})
+}
@@ -0,0 +1,65 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDigest(t *testing.T) {
+	c := NewDigestCollector(0.8)
+	c.Created(Link{Src: "/dl/Heat.1995.mkv", Target: "/lib/movies/Heat (1995)/Heat (1995).mkv", media: &movie{confidence: 0.95}})
+	c.Created(Link{Src: "/dl/Dune.mkv", Target: "/lib/movies/Dune (1984)/Dune (1984).mkv", media: &movie{confidence: 0.5}})
+	// Found by ID, not searched for
+	c.Created(Link{Src: "/dl/Alien {tmdb-348}.mkv", Target: "/lib/movies/Alien (1979)/Alien (1979).mkv", media: &movie{}})
+	c.Failed("/dl/Ran.1985.mkv", errors.New("permission denied"))
+
+	d := c.Take()
+	want := Digest{
+		From: d.From,
+		To:   d.To,
+		Added: []string{
+			"/lib/movies/Heat (1995)/Heat (1995).mkv",
+			"/lib/movies/Dune (1984)/Dune (1984).mkv",
+			"/lib/movies/Alien (1979)/Alien (1979).mkv",
+		},
+		Failed: []DigestFailure{{Path: "/dl/Ran.1985.mkv", Error: "permission denied"}},
+		Review: []string{"/lib/movies/Dune (1984)/Dune (1984).mkv"},
+	}
+	if diff := cmp.Diff(want, d); diff != "" {
+		t.Errorf("Take() mismatch (-want +got):\n%s", diff)
+	}
+	if next := c.Take(); !next.Empty() || !next.From.Equal(d.To) {
+		t.Errorf("Take() after a digest = %+v, want an empty digest from %s", next, d.To)
+	}
+
+	var b strings.Builder
+	if err := d.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"### Added (3)", "- /dl/Ran.1985.mkv: permission denied", "### To review (1)"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("WriteMarkdown() = %q, missing %q", b.String(), s)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "digest")
+	hook, err := ParseDigestHook([]string{"sh", "-c", `echo "$1 $2" > "$0"`, out, "{{.Added}}", "{{.Review}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Notify(context.Background(), hook); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(out); err != nil || string(got) != "3 1\n" {
+		t.Errorf("digest hook wrote %q, %v; want \"3 1\\n\"", got, err)
+	}
+	if _, err := ParseDigestHook([]string{"notify-send", "{{.Series}}"}); err == nil {
+		t.Error("ParseDigestHook() with a field of HookFields returned no error")
+	}
+}
@@ -0,0 +1,50 @@
+package kourai
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// dirLocks serializes the targets created in the same directory, so that
+// concurrent links of the same target can't both find it missing and
+// replace each other, and links into a new series or season folder don't
+// race creating it.
+var dirLocks = &keyedMutex{locks: map[string]*refMutex{}}
+
+// keyedMutex is a set of mutexes by key, which are only kept while held or
+// waited for
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// lockDir locks dir until the returned function is called
+func lockDir(dir string) func() {
+	return dirLocks.lock(filepath.Clean(dir))
+}
+
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		k.mu.Lock()
+		if m.refs--; m.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,263 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// discTitleExpr matches the names of the titles ripped from a disc,
+	// e.g. title_t00 or Show_Disc1_t03, by MakeMKV
+	discTitleExpr = regexp.MustCompile(`(?i)(?:^|[_ .-])t(\d{2,3})$`)
+	// discHintExpr matches the season of a disc folder, e.g. "Show S01",
+	// "Show.S02.D1" or "Show (2005) Season 3 Disc 2"
+	discHintExpr = regexp.MustCompile(`(?i)^(.+?)[\s._-]+(?:s|season[\s._-]*)(\d{1,2})(?:[\s._-]*(?:d|disc|disk)[\s._-]*\d+)?$`)
+)
+
+// DiscHint is the series and season of the titles of a disc, whose names
+// don't tell.
+type DiscHint struct {
+	Series string
+	Year   int
+	Season int
+}
+
+// ParseDiscHint parses the series and season of a disc from s, e.g. "Show
+// S01", "The Office (2005) Season 2" or the name of its folder,
+// "The.Office.S02.D1".
+func ParseDiscHint(s string) (DiscHint, error) {
+	m := discHintExpr.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return DiscHint{}, fmt.Errorf("no series and season in disc hint %q, expected e.g. \"Show S01\"", s)
+	}
+	h := DiscHint{Series: strings.NewReplacer(".", " ", "_", " ").Replace(m[1])}
+	h.Season, _ = strconv.Atoi(m[2])
+	if year, loc := findYear(h.Series); loc != nil && loc[0] > 0 {
+		h.Year = year
+		h.Series = h.Series[:loc[0]]
+	}
+	h.Series = makeTitle(strings.TrimSpace(h.Series))
+	if h.Series == "" {
+		return DiscHint{}, fmt.Errorf("%w in disc hint %q", ErrNoTitle, s)
+	}
+	return h, nil
+}
+
+// episode returns the episode n of the season of h, ripped to path
+func (h DiscHint) episode(path string, n int) *episode {
+	return &episode{
+		path:    path,
+		series:  h.Series,
+		year:    h.Year,
+		season:  h.Season,
+		episode: n,
+		id:      fmt.Sprintf("s%02de%02d", h.Season, n),
+	}
+}
+
+// DiscTitle is a title ripped from a disc and the episode it's mapped to.
+type DiscTitle struct {
+	Path string
+	// Number is that of the title on the disc, e.g. 3 for title_t03
+	Number   int
+	Duration time.Duration
+	// Episode is the number of the episode of the season of the disc, or
+	// 0 for titles that aren't episodes, e.g. extras or a "play all"
+	// title; Name and Runtime are those of the episode
+	Episode int
+	Name    string
+	Runtime time.Duration
+}
+
+// DiscEpisode is an episode of the season of a disc.
+type DiscEpisode struct {
+	Number  int
+	Name    string
+	Runtime time.Duration
+}
+
+// probeDuration returns the duration of the video at path
+var probeDuration = ffprobeDuration
+
+// ffprobeDuration returns the duration of the video at path, as given by
+// ffprobe
+func ffprobeDuration(ctx context.Context, path string) (time.Duration, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe of %s failed with error %w", path, err)
+	}
+	secs, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("no duration of %s in ffprobe output %q", path, out)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// MapDiscTitles maps the titles ripped from a disc into dir, named like
+// title_t00.mkv to title_t05.mkv, to the episodes of the season given by
+// hint. Their durations, given by ffprobe, are matched to the runtimes of
+// the episodes on TMDB, keeping the order of the titles, which is that of
+// the episodes on most discs; titles too short or too long for any
+// episode, e.g. extras or a title playing every episode, are left
+// unmapped. The titles are returned in their order, with the episodes of
+// the season to choose from when a mapping is wrong.
+func MapDiscTitles(ctx context.Context, dir string, hint DiscHint, optionConfig ...Option) ([]DiscTitle, []DiscEpisode, error) {
+	options.SetOptions(optionConfig...)
+	if options.TMDBClient == nil {
+		return nil, nil, errors.New("a TMDB API key is required to map the titles of a disc")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	titles := []DiscTitle{}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || !isMedia(info) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		m := discTitleExpr.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		titles = append(titles, DiscTitle{Path: filepath.Join(dir, e.Name()), Number: n})
+	}
+	if len(titles) == 0 {
+		return nil, nil, fmt.Errorf("no disc titles, e.g. title_t00.mkv, in %s", dir)
+	}
+	sort.Slice(titles, func(i, j int) bool { return titles[i].Number < titles[j].Number })
+
+	// The series is looked up once, as the first title
+	e := hint.episode(titles[0].Path, 1)
+	lookup(ctx, tmdbProvider{options.TMDBClient}, e)
+	if e.tmdbID == 0 {
+		return nil, nil, fmt.Errorf("%w for series %q", ErrNoMatch, hint.Series)
+	}
+	season, err := options.TMDBClient.SeasonDetails(ctx, e.tmdbID, hint.Season)
+	if err != nil {
+		return nil, nil, err
+	}
+	episodes := make([]DiscEpisode, 0, len(season.Episodes))
+	for _, ep := range season.Episodes {
+		episodes = append(episodes, DiscEpisode{
+			Number:  int(ep.EpisodeNumber),
+			Name:    ep.Name,
+			Runtime: time.Duration(ep.Runtime) * time.Minute,
+		})
+	}
+	sort.Slice(episodes, func(i, j int) bool { return episodes[i].Number < episodes[j].Number })
+
+	var errs []error
+	for i := range titles {
+		if titles[i].Duration, err = probeDuration(ctx, titles[i].Path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, j := range alignDurations(titles, episodes) {
+		if j >= 0 {
+			titles[i].Episode = episodes[j].Number
+			titles[i].Name = episodes[j].Name
+			titles[i].Runtime = episodes[j].Runtime
+		}
+	}
+	return titles, episodes, errors.Join(errs...)
+}
+
+// runtimeTolerance returns how far the duration of a title may be from the
+// runtime r of an episode to be matched to it: TMDB runtimes are rounded
+// to minutes, and often those of the broadcast
+func runtimeTolerance(r time.Duration) time.Duration {
+	return max(2*time.Minute, r/10)
+}
+
+// alignDurations returns the index of the episode matched to each title,
+// or -1, matching as many titles as possible to episodes of a close
+// runtime, in order, and of those alignments the one closest in runtimes
+func alignDurations(titles []DiscTitle, episodes []DiscEpisode) []int {
+	type score struct {
+		matched int
+		cost    float64
+	}
+	better := func(a, b score) bool {
+		return a.matched > b.matched || a.matched == b.matched && a.cost < b.cost
+	}
+	n, m := len(titles), len(episodes)
+	// best[i][j] is the best alignment of the titles from i and the
+	// episodes from j
+	best := make([][]score, n+1)
+	for i := range best {
+		best[i] = make([]score, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			s := best[i+1][j]
+			if b := best[i][j+1]; better(b, s) {
+				s = b
+			}
+			d, r := titles[i].Duration, episodes[j].Runtime
+			if r > 0 && d > 0 && (d-r).Abs() <= runtimeTolerance(r) {
+				b := best[i+1][j+1]
+				b.matched++
+				b.cost += float64((d - r).Abs()) / float64(r)
+				if better(b, s) {
+					s = b
+				}
+			}
+			best[i][j] = s
+		}
+	}
+
+	matches := make([]int, n)
+	for i := range matches {
+		matches[i] = -1
+	}
+	for i, j := 0, 0; i < n && j < m; {
+		d, r := titles[i].Duration, episodes[j].Runtime
+		if r > 0 && d > 0 && (d-r).Abs() <= runtimeTolerance(r) {
+			b := best[i+1][j+1]
+			b.matched++
+			b.cost += float64((d - r).Abs()) / float64(r)
+			if b == best[i][j] {
+				matches[i] = j
+				i, j = i+1, j+1
+				continue
+			}
+		}
+		if best[i+1][j] == best[i][j] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return matches
+}
+
+// DiscLinks looks up the episodes the titles are mapped to, as episodes of
+// the season given by hint, and returns their links. Unmapped titles, and
+// those excluded by the options, e.g. by WithOnly, aren't linked.
+func DiscLinks(ctx context.Context, titles []DiscTitle, hint DiscHint, optionConfig ...Option) []Link {
+	options.SetOptions(optionConfig...)
+	links := []Link{}
+	for _, t := range titles {
+		if t.Episode <= 0 {
+			continue
+		}
+		e := hint.episode(t.Path, t.Episode)
+		if matchMedia(ctx, e) {
+			links = append(links, LinkFromMedia(e, options.destination(e)))
+		}
+	}
+	return links
+}
@@ -0,0 +1,111 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDiscHint(t *testing.T) {
+	tests := []struct {
+		in   string
+		want DiscHint
+	}{
+		{"The Office S02", DiscHint{Series: "The Office", Season: 2}},
+		{"The.Office.S02.D1", DiscHint{Series: "The Office", Season: 2}},
+		{"Doctor Who (2005) Season 3 Disc 2", DiscHint{Series: "Doctor Who", Year: 2005, Season: 3}},
+		{"show_s1_disc2", DiscHint{Series: "Show", Season: 1}},
+	}
+	for _, tt := range tests {
+		got, err := ParseDiscHint(tt.in)
+		if err != nil {
+			t.Errorf("ParseDiscHint(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDiscHint(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseDiscHint("The Office"); err == nil {
+		t.Error("ParseDiscHint() without a season succeeded")
+	}
+}
+
+func TestMapDiscTitles(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/search/tv":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[{"id":781001,"name":"Disc Show"}]}`)
+		case "/3/tv/781001":
+			fmt.Fprint(w, `{"id":781001,"name":"Disc Show"}`)
+		case "/3/tv/781001/season/1":
+			fmt.Fprint(w, `{"id":1,"season_number":1,"episodes":[
+				{"name":"Pilot","episode_number":1,"runtime":44},
+				{"name":"Two","episode_number":2,"runtime":42},
+				{"name":"Three","episode_number":3,"runtime":60},
+				{"name":"Four","episode_number":4,"runtime":43}]}`)
+		case "/3/tv/781001/season/1/episode/3":
+			fmt.Fprint(w, `{"id":3,"name":"Three","season_number":1,"episode_number":3}`)
+		case "/3/tv/781001/season/1/episode/4":
+			fmt.Fprint(w, `{"id":4,"name":"Four","season_number":1,"episode_number":4}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	// The second disc: a "play all" title, episodes 3 and 4, and an extra
+	dir := t.TempDir()
+	durations := map[string]time.Duration{
+		"title_t00.mkv": 103 * time.Minute,
+		"title_t01.mkv": 58*time.Minute + 30*time.Second,
+		"title_t02.mkv": 43*time.Minute + 10*time.Second,
+		"title_t03.mkv": 12 * time.Minute,
+	}
+	for f := range durations {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(f func(context.Context, string) (time.Duration, error)) { probeDuration = f }(probeDuration)
+	probeDuration = func(ctx context.Context, path string) (time.Duration, error) {
+		return durations[filepath.Base(path)], nil
+	}
+
+	hint := DiscHint{Series: "Disc Show", Season: 1}
+	titles, episodes, err := MapDiscTitles(context.Background(), dir, hint, WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(episodes) != 4 {
+		t.Errorf("MapDiscTitles() returned %d episodes, want 4", len(episodes))
+	}
+	got := map[string]int{}
+	for _, title := range titles {
+		got[filepath.Base(title.Path)] = title.Episode
+	}
+	want := map[string]int{"title_t00.mkv": 0, "title_t01.mkv": 3, "title_t02.mkv": 4, "title_t03.mkv": 0}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MapDiscTitles() mismatch (-want +got):\n%s", diff)
+	}
+
+	links := DiscLinks(context.Background(), titles, hint, WithDestination("/media"))
+	targets := []string{}
+	for _, l := range links {
+		targets = append(targets, l.Target)
+	}
+	wantTargets := []string{
+		"/media/tv/Disc Show/Season 1/Disc Show - S01E03 - Three.mkv",
+		"/media/tv/Disc Show/Season 1/Disc Show - S01E04 - Four.mkv",
+	}
+	if diff := cmp.Diff(wantTargets, targets); diff != "" {
+		t.Errorf("DiscLinks() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,44 @@
+package kourai
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// editionExpr matches the edition tokens of movie names, e.g.
+	// Directors.Cut, Extended Edition or Remastered
+	editionExpr = regexp.MustCompile(`(?i)[\s._-]*[\[(]?\b(director'?s[\s._-]+cut|extended(?:[\s._-]+(?:cut|edition|version))?|theatrical(?:[\s._-]+(?:cut|edition|version))?|(?:digitally[\s._-]+)?remastered|special[\s._-]+edition|final[\s._-]+cut)\b[\])]?`)
+	// plexEditionExpr matches the edition tag of names already in Plex's
+	// format, e.g. {edition-Director's Cut}
+	plexEditionExpr = regexp.MustCompile(`(?i)\s*\{edition-([^}]+)\}`)
+)
+
+// editions are the names of the editions matched by editionExpr, by the
+// first word of the match
+var editions = map[string]string{
+	"director":   "Director's Cut",
+	"directors":  "Director's Cut",
+	"director's": "Director's Cut",
+	"extended":   "Extended",
+	"theatrical": "Theatrical",
+	"remastered": "Remastered",
+	"digitally":  "Remastered",
+	"special":    "Special Edition",
+	"final":      "Final Cut",
+}
+
+// parseEdition returns the edition of the movie named s, and s without it
+func parseEdition(s string) (edition, rest string) {
+	if m := plexEditionExpr.FindStringSubmatchIndex(s); m != nil {
+		return strings.TrimSpace(s[m[2]:m[3]]), s[:m[0]] + s[m[1]:]
+	}
+	m := editionExpr.FindStringSubmatchIndex(s)
+	if m == nil {
+		return "", s
+	}
+	word := strings.FieldsFunc(strings.ToLower(s[m[2]:m[3]]), func(r rune) bool {
+		return r == ' ' || r == '.' || r == '_' || r == '-'
+	})[0]
+	return editions[word], s[:m[0]] + " " + s[m[1]:]
+}
@@ -0,0 +1,54 @@
+package kourai
+
+import (
+	"testing"
+)
+
+func TestEditionFromPath(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	tests := []struct {
+		path   string
+		target string
+	}{
+		{
+			"/dl/Blade.Runner.1982.Directors.Cut.1080p.BluRay.mkv",
+			"movies/Blade Runner (1982) {edition-Director's Cut}/Blade.Runner.1982.Directors.Cut.1080p.BluRay.mkv",
+		},
+		{
+			"/dl/Aliens Special Edition (1986)/aliens.mkv",
+			"movies/Aliens (1986) {edition-Special Edition}/aliens.mkv",
+		},
+		{
+			"/dl/The.Lord.of.the.Rings.2001.EXTENDED.2160p.mkv",
+			"movies/The Lord Of The Rings (2001) {edition-Extended}/The.Lord.of.the.Rings.2001.EXTENDED.2160p.mkv",
+		},
+		{
+			"/dl/Alien (1979) [Theatrical Cut].mkv",
+			"movies/Alien (1979) {edition-Theatrical}/Alien (1979) [Theatrical Cut].mkv",
+		},
+		{
+			"/dl/Jaws.1975.Remastered.mkv",
+			"movies/Jaws (1975) {edition-Remastered}/Jaws.1975.Remastered.mkv",
+		},
+		{
+			"/dl/Apocalypse Now (1979) {edition-Final Cut}/Apocalypse Now (1979).mkv",
+			"movies/Apocalypse Now (1979) {edition-Final Cut}/Apocalypse Now (1979).mkv",
+		},
+		{
+			"/dl/Heat.1995.mkv",
+			"movies/Heat (1995)/Heat.1995.mkv",
+		},
+	}
+	for _, tt := range tests {
+		m, err := MovieFromPath(tt.path)
+		if err != nil {
+			t.Errorf("MovieFromPath(%s) returned %v", tt.path, err)
+			continue
+		}
+		if got := m.Target(); got != tt.target {
+			t.Errorf("Target() = %q, want %q", got, tt.target)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package kourai
+
+import "errors"
+
+// The outcomes of parsing, looking up and linking media that callers may
+// want to tell apart. Errors returned by the package wrap them, so check
+// for them with errors.Is rather than by message.
+var (
+	// ErrNoEpisodeID is returned when no season and episode, air date or
+	// absolute number can be parsed from the path of an episode.
+	ErrNoEpisodeID = errors.New("no episode ID")
+	// ErrNoTitle is returned when no movie title or series name can be
+	// parsed from a path.
+	ErrNoTitle = errors.New("no title")
+	// ErrNoMatch is returned when the metadata provider has no result for a
+	// search.
+	ErrNoMatch = errors.New("no match")
+	// ErrTargetExists is returned when a link would replace an existing
+	// file without being allowed to.
+	ErrTargetExists = errors.New("target already exists")
+	// ErrUnsupportedType is returned for a link mode, alias type, media or
+	// other named kind of value the package doesn't know.
+	ErrUnsupportedType = errors.New("unsupported")
+)
@@ -0,0 +1,53 @@
+package kourai
+
+// Events are callbacks of the stages of the pipeline, so that applications
+// embedding kourai, e.g. a chat bot, can follow runs without parsing logs,
+// see WithEvents. Callbacks are called from several workers at once, and
+// nil ones are skipped.
+type Events struct {
+	// OnItemParsed is called with the media parsed from the name of a
+	// source file, before it's looked up
+	OnItemParsed func(Linkable)
+	// OnItemMatched is called with the link of media looked up, and not
+	// excluded by filters, before its target is created
+	OnItemMatched func(Link)
+	// OnLinkCreated is called with each target created
+	OnLinkCreated func(Link)
+	// OnError is called with the errors that don't stop the pipeline, by
+	// the path of the source they concern: unreadable paths, failed
+	// lookups, which leave media named after their paths, and targets
+	// that couldn't be created
+	OnError func(path string, err error)
+}
+
+// WithEvents calls the callbacks of e as the pipeline progresses, in place
+// of those of earlier calls.
+func WithEvents(e Events) Option {
+	return func(o *Options) {
+		o.events = e
+	}
+}
+
+func (e Events) parsed(l Linkable) {
+	if e.OnItemParsed != nil {
+		e.OnItemParsed(l)
+	}
+}
+
+func (e Events) matched(ln Link) {
+	if e.OnItemMatched != nil {
+		e.OnItemMatched(ln)
+	}
+}
+
+func (e Events) created(ln Link) {
+	if e.OnLinkCreated != nil {
+		e.OnLinkCreated(ln)
+	}
+}
+
+func (e Events) failed(path string, err error) {
+	if e.OnError != nil {
+		e.OnError(path, err)
+	}
+}
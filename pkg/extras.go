@@ -0,0 +1,110 @@
+package kourai
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The folders of the extras of a movie or season that Plex recognizes
+const (
+	ExtrasBehindTheScenes = "Behind The Scenes"
+	ExtrasDeletedScenes   = "Deleted Scenes"
+	ExtrasFeaturettes     = "Featurettes"
+	ExtrasInterviews      = "Interviews"
+	ExtrasScenes          = "Scenes"
+	ExtrasShorts          = "Shorts"
+	ExtrasTrailers        = "Trailers"
+	ExtrasOther           = "Other"
+)
+
+var (
+	// extraFolderExpr matches the names of the folders extras are kept in,
+	// e.g. Featurettes or "Deleted Scenes"
+	extraFolderExpr = regexp.MustCompile(`(?i)^(behind[ ._-]?the[ ._-]?scenes|deleted[ ._-]?scenes?|featurettes?|interviews?|scenes|shorts|trailers?|extras|other)$`)
+	// extraNameExpr matches the tokens naming extras, e.g. Heat.1995.Trailer,
+	// which only count after the year or episode ID of a name, so that
+	// titles such as The Interview or Trailer Park Boys aren't taken for
+	// extras
+	extraNameExpr = regexp.MustCompile(`(?i)(?:^|[ ._\-\[(])(trailer|teaser|featurette|behind[ ._-]?the[ ._-]?scenes|making[ ._-]of|deleted[ ._-]scenes?|interview)(?:$|[ ._\-\])\d])`)
+	// extraSuffixExpr matches the suffixes of extras Plex recognizes, e.g.
+	// Heat (1995)-behindthescenes, in lower case only, as release groups
+	// such as SCENE are named alike
+	extraSuffixExpr = regexp.MustCompile(`-(behindthescenes|deleted|featurette|interview|scene|short|trailer|other)$`)
+)
+
+// extraFolder returns the Plex folder of the extras named by s, the name of
+// a folder or a token of a file name
+func extraFolder(s string) string {
+	s = strings.ToLower(strings.NewReplacer(" ", "", ".", "", "_", "", "-", "").Replace(s))
+	switch {
+	case strings.HasPrefix(s, "behindthescenes"), strings.HasPrefix(s, "makingof"):
+		return ExtrasBehindTheScenes
+	case strings.HasPrefix(s, "deleted"):
+		return ExtrasDeletedScenes
+	case strings.HasPrefix(s, "featurette"):
+		return ExtrasFeaturettes
+	case strings.HasPrefix(s, "interview"):
+		return ExtrasInterviews
+	case strings.HasPrefix(s, "scene"):
+		return ExtrasScenes
+	case strings.HasPrefix(s, "short"):
+		return ExtrasShorts
+	case strings.HasPrefix(s, "trailer"), strings.HasPrefix(s, "teaser"):
+		return ExtrasTrailers
+	}
+	return ExtrasOther
+}
+
+// parseExtra returns the Plex folder of the extra at p, or "" when it's no
+// extra, and the path its movie or episode is parsed from. Extras are kept
+// in an extras folder, whose movie or episode is that of the folder above,
+// or named with a token after the year or episode ID of their name. As
+// download clients file media in category folders named alike, e.g. Other
+// or Shorts, files in an extras folder are only extras when the folder
+// above names a movie, episode or season, or when they don't name one
+// themselves.
+func parseExtra(p string) (folder, parent string) {
+	dir, file := filepath.Split(p)
+	dir = filepath.Clean(dir)
+	name := strings.TrimSuffix(file, filepath.Ext(file))
+	if extraFolderExpr.MatchString(filepath.Base(dir)) {
+		above := filepath.Dir(dir)
+		if namesMedia(filepath.Base(above)) || seasonDirExpr.MatchString(filepath.Base(above)) || !namesMedia(name) {
+			return extraFolder(filepath.Base(dir)), filepath.Join(above, file)
+		}
+	}
+	start := -1
+	if loc := episodeExpr.FindStringIndex(name); loc != nil {
+		start = loc[1]
+	} else if year, loc := findYear(name); loc != nil && year >= oldestMovieYear {
+		start = loc[1]
+	}
+	if start < 0 {
+		return "", p
+	}
+	if m := extraSuffixExpr.FindStringSubmatch(name[start:]); m != nil {
+		return extraFolder(m[1]), p
+	}
+	if m := extraNameExpr.FindStringSubmatch(name[start:]); m != nil {
+		return extraFolder(m[1]), p
+	}
+	return "", p
+}
+
+// namesMedia reports whether name numbers an episode, or has the year of
+// a movie
+func namesMedia(name string) bool {
+	if episodeExpr.MatchString(name) || crossExpr.MatchString(name) {
+		return true
+	}
+	year, loc := findYear(name)
+	return loc != nil && year >= oldestMovieYear
+}
+
+// extraTarget returns the target of the extra at p of the movie or episode
+// whose target is target: its file in the extras folder next to it
+func extraTarget(target, folder, p string) string {
+	return path.Join(path.Dir(target), folder, filepath.Base(p))
+}
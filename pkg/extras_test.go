@@ -0,0 +1,45 @@
+package kourai
+
+import "testing"
+
+func TestExtras(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	tests := []struct {
+		path   string
+		target string
+	}{
+		{"/dl/Heat.1995.1080p.Trailer.mkv", "movies/Heat (1995)/Trailers/Heat.1995.1080p.Trailer.mkv"},
+		{"/dl/Heat (1995)-behindthescenes.mkv", "movies/Heat (1995)/Behind The Scenes/Heat (1995)-behindthescenes.mkv"},
+		{"/dl/Heat.1995/Featurettes/Making the Heist.mkv", "movies/Heat (1995)/Featurettes/Making the Heist.mkv"},
+		{"/dl/Heat.1995/Deleted Scenes/Diner.mkv", "movies/Heat (1995)/Deleted Scenes/Diner.mkv"},
+		{"/dl/Heat.1995/Extras/Commentary.mkv", "movies/Heat (1995)/Other/Commentary.mkv"},
+		{"/dl/Heat.1995.Making.Of.mkv", "movies/Heat (1995)/Behind The Scenes/Heat.1995.Making.Of.mkv"},
+		{"/dl/Andor.S01E01.Deleted.Scenes.mkv", "tv/Andor/Season 1/Deleted Scenes/Andor.S01E01.Deleted.Scenes.mkv"},
+		// Titles aren't extras, nor are release groups
+		{"/dl/The.Interview.2014.mkv", "movies/The Interview (2014)/The.Interview.2014.mkv"},
+		{"/dl/Trailer.Park.Boys.S01E01.mkv", "tv/Trailer Park Boys/Season 1/Trailer Park Boys - S01E01.mkv"},
+		{"/dl/Heat.1995.1080p.x264-SCENE.mkv", "movies/Heat (1995)/Heat.1995.1080p.x264-SCENE.mkv"},
+		// Category folders of download clients named like extras folders
+		{"/dl/Other/Heat.1995.mkv", "movies/Heat (1995)/Heat.1995.mkv"},
+		{"/dl/Shorts/Bao.2018.mkv", "movies/Bao (2018)/Bao.2018.mkv"},
+		{"/dl/Other/Andor.S01E01.mkv", "tv/Andor/Season 1/Andor - S01E01.mkv"},
+		// but extras folders of a movie or season are
+		{"/dl/Heat (1995)/Other/Heat.1995.Commentary.mkv", "movies/Heat (1995)/Other/Heat.1995.Commentary.mkv"},
+		{"/dl/Andor/Season 1/Featurettes/Andor.S01E01.Cast.mkv", "tv/Andor/Season 1/Featurettes/Andor.S01E01.Cast.mkv"},
+	}
+	for _, tt := range tests {
+		l, err := NewLinkable(tt.path)
+		if err != nil {
+			t.Errorf("NewLinkable(%s) = %v", tt.path, err)
+			continue
+		}
+		if l.Path() != tt.path {
+			t.Errorf("NewLinkable(%s).Path() = %s", tt.path, l.Path())
+		}
+		if got := l.Target(); got != tt.target {
+			t.Errorf("NewLinkable(%s).Target() = %s, want %s", tt.path, got, tt.target)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package kourai
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode identifying the file at path,
+// along with its number of hard links.
+func fileIdentity(path string, info fs.FileInfo) (dev, ino, nlink uint64, err error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("no inode information available for %s", path)
+	}
+	return uint64(stat.Dev), uint64(stat.Ino), uint64(stat.Nlink), nil
+}
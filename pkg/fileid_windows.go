@@ -0,0 +1,33 @@
+package kourai
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// fileIdentity returns the volume serial number and NTFS file index
+// identifying the file at path, along with its number of hard links.
+// Windows doesn't report these in fs.FileInfo, so the file is opened to
+// query them.
+func fileIdentity(path string, info fs.FileInfo) (dev, ino, nlink uint64, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	h, err := syscall.CreateFile(p, 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING,
+		syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to open %s with error %w", path, err)
+	}
+	defer syscall.CloseHandle(h)
+
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &d); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to query file information for %s with error %w", path, err)
+	}
+	ino = uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow)
+	return uint64(d.VolumeSerialNumber), ino, uint64(d.NumberOfLinks), nil
+}
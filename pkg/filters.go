@@ -1,10 +1,15 @@
 package kourai
 
 import (
+	"context"
+	"fmt"
 	"io/fs"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
 )
 
 type fileMTimeFilter struct {
@@ -24,22 +29,43 @@ func (f fileMTimeFilter) exclude(info fs.FileInfo) bool {
 	return a || b
 }
 
+// fileSizeFilter excludes files smaller than min bytes, e.g. samples that
+// aren't named sample
+type fileSizeFilter struct {
+	min int64
+}
+
+func (f fileSizeFilter) exclude(info fs.FileInfo) bool {
+	return !info.IsDir() && info.Size() < f.min
+}
+
 type fileExtensionFilter struct {
 	extensions map[string]bool
 }
 
 // files whose extensions are not contained in the fileExtensionFilter
-// are excluded
+// are excluded, unless the policy of their extension links them
 func (f fileExtensionFilter) exclude(info fs.FileInfo) bool {
 	if info.IsDir() {
 		return false
 	}
-	split := strings.Split(info.Name(), ".")
-	ext := strings.ToLower(split[len(split)-1])
+	ext := fileExt(info.Name())
+	switch options.extensionPolicies[ext] {
+	case PolicyLink, PolicyEpisode:
+		return false
+	case PolicySkip, PolicyIgnore:
+		return true
+	}
 	_, ok := f.extensions[ext]
 	return !ok
 }
 
+// fileExt returns the lower case extension of name, without the dot
+func fileExt(name string) string {
+	split := strings.Split(name, ".")
+	return strings.ToLower(split[len(split)-1])
+}
+
 func newFileExtensionFilter(extensions []string) fileExtensionFilter {
 	f := fileExtensionFilter{map[string]bool{}}
 	for _, ext := range extensions {
@@ -48,6 +74,74 @@ func newFileExtensionFilter(extensions []string) fileExtensionFilter {
 	return f
 }
 
+// videoExtensions are the extensions of video files, whose exclusion by a
+// fileExtensionFilter is worth reporting, unlike that of subtitles, NFOs or
+// artwork
+var videoExtensions = map[string]bool{
+	"avi": true, "m2ts": true, "m4v": true, "mkv": true, "mov": true,
+	"mp4": true, "mpg": true, "ts": true, "webm": true, "wmv": true,
+}
+
+// ExtensionPolicy is how files with an extension are handled, in place of
+// the extensions given to WithFileExtensions.
+type ExtensionPolicy string
+
+const (
+	// PolicyLink links files as media, e.g. whole .iso disc images
+	PolicyLink ExtensionPolicy = "link"
+	// PolicyEpisode links files only when they're episodes by their names
+	// or folders, e.g. .ts recordings in a "Show S01" folder, and skips
+	// them with a report otherwise
+	PolicyEpisode ExtensionPolicy = "episode"
+	// PolicySkip skips files with a report
+	PolicySkip ExtensionPolicy = "skip"
+	// PolicyIgnore skips files silently, e.g. music
+	PolicyIgnore ExtensionPolicy = "ignore"
+)
+
+// ParseExtensionPolicy parses the policy of one or more extensions, e.g.
+// "iso=skip" or "ts,m2ts=episode".
+func ParseExtensionPolicy(s string) (map[string]ExtensionPolicy, error) {
+	exts, policy, ok := strings.Cut(s, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid extension policy %q, expected e.g. iso=skip", s)
+	}
+	p := ExtensionPolicy(strings.ToLower(strings.TrimSpace(policy)))
+	switch p {
+	case PolicyLink, PolicyEpisode, PolicySkip, PolicyIgnore:
+	default:
+		return nil, fmt.Errorf("unknown policy %q of %q, expected %s, %s, %s or %s", policy, s, PolicyLink, PolicyEpisode, PolicySkip, PolicyIgnore)
+	}
+	policies := map[string]ExtensionPolicy{}
+	for _, ext := range strings.Split(exts, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext == "" {
+			return nil, fmt.Errorf("invalid extension policy %q, expected e.g. iso=skip", s)
+		}
+		policies[ext] = p
+	}
+	return policies, nil
+}
+
+// WithExtensionPolicies handles the files with the extensions of policies,
+// without a dot, by their policy rather than by the extensions given to
+// WithFileExtensions. Policies add to those of earlier calls.
+func WithExtensionPolicies(policies map[string]ExtensionPolicy) Option {
+	return func(o *Options) {
+		if len(policies) > 0 && o.extensionPolicies == nil {
+			o.extensionPolicies = map[string]ExtensionPolicy{}
+		}
+		for ext, p := range policies {
+			o.extensionPolicies[strings.ToLower(strings.TrimPrefix(ext, "."))] = p
+		}
+	}
+}
+
+// isVideo reports whether path has the extension of a video file
+func isVideo(path string) bool {
+	return videoExtensions[strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))]
+}
+
 type RegexpFilter struct {
 	excludes []*regexp.Regexp
 }
@@ -55,7 +149,7 @@ type RegexpFilter struct {
 func (f RegexpFilter) exclude(info fs.FileInfo) bool {
 	for _, e := range f.excludes {
 		if e.MatchString(info.Name()) {
-			//fmt.Println("skipping", info.Name(), "which matched", e)
+			options.logger.Debug("skipping file", "name", info.Name(), "pattern", e.String())
 			return true
 		}
 	}
@@ -74,19 +168,130 @@ type fileFilter interface {
 	exclude(fs.FileInfo) bool
 }
 
+// mediaDetails are the TMDB details media filters are evaluated against
+type mediaDetails struct {
+	// countries are the ISO 3166-1 codes of the origin and production
+	// countries
+	countries []string
+	companies []tmdb.Company
+	// networks are the networks of series, nil for movies
+	networks []tmdb.Company
+}
+
+// lookupDetails returns the TMDB details of the movie or series of l, or
+// nil when l has no TMDB ID or the lookup failed
+func lookupDetails(ctx context.Context, l Linkable) *mediaDetails {
+	if options.TMDBClient == nil {
+		return nil
+	}
+	var d mediaDetails
+	var err error
+	switch m := l.(type) {
+	case *movie:
+		if m.tmdbID == 0 {
+			return nil
+		}
+		var details tmdb.MovieDetails
+		if details, err = options.TMDBClient.MovieDetails(ctx, m.tmdbID); err == nil {
+			d.countries = details.OriginCountry
+			for _, c := range details.ProductionCountries {
+				d.countries = append(d.countries, c.ISO3166)
+			}
+			d.companies = details.ProductionCompanies
+		}
+	case *episode:
+		if m.tmdbID == 0 {
+			return nil
+		}
+		var details tmdb.TVDetails
+		if details, err = options.TMDBClient.TVDetails(ctx, m.tmdbID); err == nil {
+			d.countries = details.OriginCountry
+			d.companies = details.ProductionCompanies
+			d.networks = details.Networks
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			options.logger.Warn("details lookup for filters failed", "path", l.Path(), "error", err)
+		}
+		return nil
+	}
+	return &d
+}
+
+// countryFilter excludes media originating from or produced in any of
+// countries, lower case ISO 3166-1 codes
 type countryFilter struct {
 	countries map[string]bool
 }
 
-func (f countryFilter) exclude(l Linkable) bool {
-	//for _, country := range m.Countries {
-	//	if _, ok := f.countries[country]; ok {
-	//		return true
-	//	}
-	//}
+func (f countryFilter) exclude(l Linkable, details func() *mediaDetails) bool {
+	d := details()
+	if d == nil {
+		return false
+	}
+	for _, c := range d.countries {
+		if f.countries[strings.ToLower(c)] {
+			return true
+		}
+	}
 	return false
 }
 
+// companyFilter excludes media by their production companies, or by the
+// networks of series when networks is set. Companies are keyed by their
+// lower case name and their TMDB ID.
+type companyFilter struct {
+	networks bool
+	excluded map[string]bool
+	included map[string]bool
+}
+
+func newCompanyFilter(networks bool, excluded, included []string) companyFilter {
+	f := companyFilter{networks, map[string]bool{}, map[string]bool{}}
+	for _, c := range excluded {
+		f.excluded[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+	for _, c := range included {
+		f.included[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+	return f
+}
+
+func matchesCompany(set map[string]bool, c tmdb.Company) bool {
+	return set[strings.ToLower(c.Name)] || set[fmt.Sprint(c.ID)]
+}
+
+// exclude excludes media made by an excluded company and, when companies
+// are included, media made by none of them. Media without details are
+// excluded only when companies are included, since they aren't known to
+// match. Movies have no network and aren't filtered by networks.
+func (f companyFilter) exclude(l Linkable, details func() *mediaDetails) bool {
+	if _, ok := l.(*episode); f.networks && !ok {
+		return false
+	}
+	d := details()
+	if d == nil {
+		return len(f.included) > 0
+	}
+	companies := d.companies
+	if f.networks {
+		companies = d.networks
+	}
+	matched := false
+	for _, c := range companies {
+		if matchesCompany(f.excluded, c) {
+			return true
+		}
+		matched = matched || matchesCompany(f.included, c)
+	}
+	return len(f.included) > 0 && !matched
+}
+
+// mediaFilter excludes media after they're looked up. Filters that need
+// the TMDB details of media call details, which looks them up once.
 type mediaFilter interface {
-	exclude(Linkable) bool
+	exclude(l Linkable, details func() *mediaDetails) bool
 }
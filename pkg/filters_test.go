@@ -0,0 +1,189 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompanyFilters(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/movie/774001":
+			fmt.Fprint(w, `{"id":774001,"title":"Alien","release_date":"1979-05-25",
+				"origin_country":["US"],"production_countries":[{"iso_3166_1":"GB"}],
+				"production_companies":[{"id":25,"name":"20th Century Fox"},{"id":401,"name":"Brandywine Productions"}]}`)
+		case "/3/movie/774002":
+			fmt.Fprint(w, `{"id":774002,"title":"Heat","release_date":"1995-12-15",
+				"origin_country":["US"],"production_companies":[{"id":508,"name":"Regency Enterprises"}]}`)
+		case "/3/tv/774003":
+			fmt.Fprint(w, `{"id":774003,"name":"Andor","origin_country":["US"],
+				"networks":[{"id":2739,"name":"Disney+"}],"production_companies":[{"id":1,"name":"Lucasfilm Ltd."}]}`)
+		case "/3/tv/774003/season/1/episode/1":
+			fmt.Fprint(w, `{"id":1,"name":"Kassa"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	media := func() []Linkable {
+		return []Linkable{
+			&movie{title: "Alien", year: 1979, path: "alien.mkv", tmdbID: 774001},
+			&movie{title: "Heat", year: 1995, path: "heat.mkv", tmdbID: 774002},
+			&episode{series: "Andor", id: "S01E01", season: 1, episode: 1, path: "andor.s01e01.mkv", tmdbID: 774003},
+			&movie{title: "Unknown", path: "unknown.mkv"},
+		}
+	}
+	tests := []struct {
+		name string
+		opt  Option
+		want []string
+	}{
+		{"exclude company by name", WithCompanyFilter([]string{"20th century fox"}, nil),
+			[]string{"heat.mkv", "andor.s01e01.mkv", "unknown.mkv"}},
+		{"include company by ID", WithCompanyFilter(nil, []string{"508", "Lucasfilm Ltd."}),
+			[]string{"heat.mkv", "andor.s01e01.mkv"}},
+		{"exclude network", WithNetworkFilter([]string{"Disney+"}, nil),
+			[]string{"alien.mkv", "heat.mkv", "unknown.mkv"}},
+		{"include network keeps movies", WithNetworkFilter(nil, []string{"HBO"}),
+			[]string{"alien.mkv", "heat.mkv", "unknown.mkv"}},
+		{"production country", WithCountryFilter([]string{"gb"}),
+			[]string{"heat.mkv", "andor.s01e01.mkv", "unknown.mkv"}},
+	}
+	for _, tt := range tests {
+		options.mediaFilters = nil
+		tt.opt(options)
+		var got []string
+		for _, m := range media() {
+			if _, ok := linkFromMedia(context.Background(), m); ok {
+				got = append(got, m.Path())
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: linked %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtensionPolicies(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	if _, err := ParseExtensionPolicy("iso=rip"); err == nil {
+		t.Error("ParseExtensionPolicy() of an unknown policy returned no error")
+	}
+	policies := map[string]ExtensionPolicy{}
+	for _, s := range []string{".ISO=link", "ts, m2ts=episode", "flac,mp3=ignore", "wmv=skip"} {
+		p, err := ParseExtensionPolicy(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ext, policy := range p {
+			policies[ext] = policy
+		}
+	}
+
+	root := t.TempDir()
+	for _, rel := range []string{
+		"Heat.1995.mkv",
+		"Alien.1979.iso",
+		"Andor S01/Andor.S01E01.ts",
+		"Recording.2021.m2ts",
+		"Album/01 Track.flac",
+		"Cats.2019.wmv",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(rel), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var mu sync.Mutex
+	skipped := map[string]string{}
+	options.SetOptions(
+		WithFileExtensions([]string{"mkv", "flac"}),
+		WithExtensionPolicies(policies),
+		WithSkipReport(func(s SkippedFile) {
+			mu.Lock()
+			defer mu.Unlock()
+			rel, _ := filepath.Rel(root, s.Path)
+			skipped[filepath.ToSlash(rel)] = s.Code
+		}),
+	)
+
+	media, errc := findFiles(context.Background(), root, options.fileFilters...)
+	got := []string{}
+	for m := range media {
+		rel, _ := filepath.Rel(root, m.Path())
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{"Alien.1979.iso", "Andor S01/Andor.S01E01.ts", "Heat.1995.mkv"}, got); diff != "" {
+		t.Errorf("findFiles() mismatch (-want +got):\n%s", diff)
+	}
+	want := map[string]string{"Recording.2021.m2ts": SkipExtension, "Cats.2019.wmv": SkipExtension}
+	if diff := cmp.Diff(want, skipped); diff != "" {
+		t.Errorf("skipped files mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMinFileSize(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	root := t.TempDir()
+	for rel, size := range map[string]int{
+		"Heat.1995.mkv":                2048,
+		"Heat.1995/clip.mkv":           100,
+		"Alien.1979/Alien.1979.mkv":    1024,
+		"Alien.1979/Alien.1979.en.srt": 10,
+		"Andor S01/Andor.S01E01.mkv":   4096,
+		"Andor S01/Andor.S01E01.nfo":   10,
+	} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var mu sync.Mutex
+	skipped := map[string]string{}
+	options.SetOptions(
+		WithMinFileSize(1024),
+		WithSkipReport(func(s SkippedFile) {
+			mu.Lock()
+			defer mu.Unlock()
+			rel, _ := filepath.Rel(root, s.Path)
+			skipped[filepath.ToSlash(rel)] = s.Code
+		}),
+	)
+
+	media, errc := findFiles(context.Background(), root, options.fileFilters...)
+	got := []string{}
+	for m := range media {
+		rel, _ := filepath.Rel(root, m.Path())
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{"Alien.1979/Alien.1979.mkv", "Andor S01/Andor.S01E01.mkv", "Heat.1995.mkv"}, got); diff != "" {
+		t.Errorf("findFiles() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"Heat.1995/clip.mkv": SkipSize}, skipped); diff != "" {
+		t.Errorf("skipped files mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,25 @@
+package kourai
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+const finderTagsXattr = "com.apple.metadata:_kMDItemUserTags"
+
+// finderTagsPlist encodes tags as the property list stored in the
+// _kMDItemUserTags extended attribute. Finder accepts XML property lists
+// as well as binary ones.
+func finderTagsPlist(tags []string) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0"><array>`)
+	for _, t := range tags {
+		b.WriteString("<string>")
+		xml.EscapeText(&b, []byte(t))
+		b.WriteString("</string>")
+	}
+	b.WriteString("</array></plist>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,13 @@
+package kourai
+
+import "golang.org/x/sys/unix"
+
+// FinderTagsSupported reports whether Finder tags can be applied on this
+// platform.
+const FinderTagsSupported = true
+
+// setFinderTags replaces the Finder tags of path. Tags may carry a label
+// color as a suffix, e.g. "kourai-managed\n6".
+func setFinderTags(path string, tags []string) error {
+	return unix.Setxattr(path, finderTagsXattr, finderTagsPlist(tags), 0)
+}
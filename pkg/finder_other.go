@@ -0,0 +1,13 @@
+//go:build !darwin
+
+package kourai
+
+import "errors"
+
+// FinderTagsSupported reports whether Finder tags can be applied on this
+// platform.
+const FinderTagsSupported = false
+
+func setFinderTags(path string, tags []string) error {
+	return errors.New("Finder tags are only supported on macOS")
+}
@@ -0,0 +1,313 @@
+package kourai
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// folderNameExpr matches a bracketed year at the end of a folder name,
+	// e.g. "Title (2001)", "Title [2001]" or "Title.(2001)". Bare years are
+	// left alone, as they may be part of the title.
+	folderNameExpr = regexp.MustCompile(`^(.*?)[\s.]*[\(\[]((?:18|19|20)\d{2})[\)\]]$`)
+	seasonDirExpr  = regexp.MustCompile(`(?i)^season[\s._]*(\d+)$`)
+)
+
+// FsckIssue is a violation of the naming rules found in a destination.
+// Issues that can be fixed carry the rename fixing them, or Remove for
+// directories that should be removed.
+type FsckIssue struct {
+	Path    string
+	Problem string
+	Fix     *Link
+	Remove  bool
+}
+
+func (i FsckIssue) Fixable() bool {
+	return i.Fix != nil || i.Remove
+}
+
+// Apply fixes the issue. Folders renamed to the name of an existing
+// folder are merged into it, unless both contain an entry of the same name.
+func (i FsckIssue) Apply() error {
+	switch {
+	case i.Fix != nil:
+		if info, err := os.Stat(i.Fix.Target); err == nil && info.IsDir() {
+			return mergeDir(i.Fix.Src, i.Fix.Target)
+		}
+		return i.Fix.Rename()
+	case i.Remove:
+		return os.Remove(i.Path)
+	}
+	return fmt.Errorf("%s: %s can't be fixed automatically", i.Path, i.Problem)
+}
+
+func mergeDir(src, target string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := os.Lstat(filepath.Join(target, e.Name())); err == nil {
+			return fmt.Errorf("can't merge %s into %s, both contain %s", src, target, e.Name())
+		}
+	}
+	for _, e := range entries {
+		if err := os.Rename(filepath.Join(src, e.Name()), filepath.Join(target, e.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(src)
+}
+
+// Fsck checks the destination against the naming rules and reports the
+// entries that drifted from them, e.g. after manual edits. The default
+// layout is checked in detail: folder names and years, including those of
+// movies in collection folders, season folders, episodes filed in the wrong
+// season, stray files, and with a sharded layout, folders filed under the
+// wrong letter. When target templates
+// are set, only the depth of media files is checked. Empty directories are
+// reported in both cases.
+func Fsck(dest string, optionConfig ...Option) ([]FsckIssue, error) {
+	options.SetOptions(optionConfig...)
+	if _, err := os.Stat(dest); err != nil {
+		return nil, err
+	}
+
+	issues := []FsckIssue{}
+	if options.movieTarget != nil || options.episodeTarget != nil {
+		issues = append(issues, fsckDepth(dest)...)
+	} else {
+		issues = append(issues, fsckLayout(dest)...)
+	}
+	return append(issues, fsckEmptyDirs(dest)...), nil
+}
+
+func isMedia(info fs.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	for _, filter := range options.fileFilters {
+		if filter.exclude(info) {
+			return false
+		}
+	}
+	return true
+}
+
+// fsckFolderName checks the year notation of a movie or series folder
+func fsckFolderName(dir string) []FsckIssue {
+	name := filepath.Base(dir)
+	m := folderNameExpr.FindStringSubmatch(name)
+	if m == nil {
+		return nil
+	}
+	issues := []FsckIssue{}
+	year, _ := strconv.Atoi(m[2])
+	if year < oldestMovieYear || year > time.Now().Year()+5 {
+		issues = append(issues, FsckIssue{Path: dir, Problem: fmt.Sprintf("implausible year %d", year)})
+	}
+	want := fmt.Sprintf("%s (%d)", m[1], year)
+	if m[1] != "" && name != want {
+		issues = append(issues, FsckIssue{
+			Path:    dir,
+			Problem: fmt.Sprintf("year should be formatted as %q", want),
+			Fix:     &Link{Src: dir, Target: filepath.Join(filepath.Dir(dir), want)},
+		})
+	}
+	return issues
+}
+
+func fsckLayout(dest string) []FsckIssue {
+	issues := []FsckIssue{}
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		return []FsckIssue{{Path: dest, Problem: err.Error()}}
+	}
+	for _, e := range entries {
+		p := filepath.Join(dest, e.Name())
+		switch {
+		case strings.HasPrefix(e.Name(), "."):
+			// kourai's journal and lock, and other hidden files
+		case strings.EqualFold(e.Name(), "movies") && e.IsDir():
+			// Folders are named in the case of targets, see WithTargetCase
+			issues = append(issues, fsckMovies(p)...)
+		case strings.EqualFold(e.Name(), "tv") && e.IsDir():
+			issues = append(issues, fsckSeries(p)...)
+		case e.Name() == SetsDir && e.IsDir():
+			// movie set information, see CollectionSet
+		default:
+			issues = append(issues, FsckIssue{Path: p, Problem: "unexpected entry, expected only movies and tv"})
+		}
+	}
+	return issues
+}
+
+func fsckMovies(root string) []FsckIssue {
+	dirs, issues := mediaFolders(root, "movie")
+	for _, p := range dirs {
+		if movies := collectionMovies(p); movies != nil {
+			for _, mp := range movies {
+				issues = append(issues, fsckFolderName(mp)...)
+			}
+			continue
+		}
+		issues = append(issues, fsckFolderName(p)...)
+	}
+	return issues
+}
+
+// collectionMovies returns the movie folders in dir when it's the folder of
+// a collection, see WithCollectionFolders, or nil. Collection folders have
+// no year, unlike the folders of the movies in them.
+func collectionMovies(dir string) []string {
+	if folderNameExpr.MatchString(filepath.Base(dir)) {
+		return nil
+	}
+	entries, _ := os.ReadDir(dir)
+	var movies []string
+	collection := false
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		movies = append(movies, filepath.Join(dir, e.Name()))
+		collection = collection || folderNameExpr.MatchString(e.Name())
+	}
+	if !collection {
+		return nil
+	}
+	return movies
+}
+
+func fsckSeries(root string) []FsckIssue {
+	series, issues := mediaFolders(root, "series")
+	for _, sp := range series {
+		issues = append(issues, fsckFolderName(sp)...)
+
+		seasons, _ := os.ReadDir(sp)
+		for _, d := range seasons {
+			dp := filepath.Join(sp, d.Name())
+			if strings.HasPrefix(d.Name(), ".") {
+				// kourai's actor thumbnails, and other hidden entries
+				continue
+			}
+			if !d.IsDir() {
+				// Artwork and metadata are kept next to the seasons
+				if info, err := d.Info(); err == nil && isMedia(info) {
+					issues = append(issues, fsckMisfiled(dp, sp, -1))
+				}
+				continue
+			}
+			season := -1
+			if strings.EqualFold(d.Name(), "Specials") {
+				season = 0
+			} else if m := seasonDirExpr.FindStringSubmatch(d.Name()); m != nil {
+				season, _ = strconv.Atoi(m[1])
+				if want := options.targetCase.apply(fmt.Sprintf("Season %d", season)); !strings.EqualFold(d.Name(), want) {
+					issues = append(issues, FsckIssue{
+						Path:    dp,
+						Problem: fmt.Sprintf("season folder should be named %q", want),
+						Fix:     &Link{Src: dp, Target: filepath.Join(sp, want)},
+					})
+				}
+			} else {
+				issues = append(issues, FsckIssue{Path: dp, Problem: "unexpected folder, expected season folders only"})
+				continue
+			}
+			files, _ := os.ReadDir(dp)
+			for _, f := range files {
+				fp := filepath.Join(dp, f.Name())
+				info, err := f.Info()
+				if err != nil || !isMedia(info) {
+					continue
+				}
+				if issue := fsckMisfiled(fp, sp, season); issue.Problem != "" {
+					issues = append(issues, issue)
+				}
+				if name := filepath.Base(sp); !strings.HasPrefix(strings.ToLower(f.Name()), strings.ToLower(name+" - ")) {
+					issues = append(issues, FsckIssue{Path: fp, Problem: fmt.Sprintf("file name doesn't start with the series folder %q", name)})
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// fsckMisfiled checks that the episode at p is in the folder of its season
+// below the series folder, returning an empty issue when it is
+func fsckMisfiled(p, seriesDir string, season int) FsckIssue {
+	e, err := EpisodeFromPath(p)
+	if err != nil {
+		return FsckIssue{Path: p, Problem: "media file without an episode identifier"}
+	}
+	if e.season == season {
+		return FsckIssue{}
+	}
+	folder := fmt.Sprintf("Season %d", e.season)
+	if e.season == 0 {
+		folder = "Specials"
+	}
+	folder = options.targetCase.apply(folder)
+	return FsckIssue{
+		Path:    p,
+		Problem: fmt.Sprintf("episode of season %d filed outside of %q", e.season, folder),
+		Fix:     &Link{Src: p, Target: filepath.Join(seriesDir, folder, filepath.Base(p))},
+	}
+}
+
+// fsckDepth checks that media files are as deep below dest as the targets
+// rendered by the templates, or the default layouts
+func fsckDepth(dest string) []FsckIssue {
+	depths := map[int]bool{}
+	for _, l := range []Linkable{
+		&movie{title: "Title", year: 2001, path: "title.2001.mkv"},
+		&episode{series: "Series", title: "Title", id: "s01e01", season: 1, episode: 1, path: "series.s01e01.mkv"},
+	} {
+		depths[strings.Count(l.Target(), "/")+1] = true
+	}
+
+	issues := []FsckIssue{}
+	filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !isMedia(info) {
+			return nil
+		}
+		rel, _ := filepath.Rel(dest, p)
+		n := strings.Count(filepath.ToSlash(rel), "/") + 1
+		// Extras are kept in a folder next to their movie or episode
+		if extraFolderExpr.MatchString(filepath.Base(filepath.Dir(p))) {
+			n--
+		}
+		if !depths[n] {
+			issues = append(issues, FsckIssue{Path: p, Problem: fmt.Sprintf("media file at depth %d, which the templates don't produce", n)})
+		}
+		return nil
+	})
+	return issues
+}
+
+// fsckEmptyDirs reports directories without any entries
+func fsckEmptyDirs(dest string) []FsckIssue {
+	issues := []FsckIssue{}
+	filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || p == dest {
+			return nil
+		}
+		entries, err := os.ReadDir(p)
+		if err == nil && len(entries) == 0 {
+			issues = append(issues, FsckIssue{Path: p, Problem: "empty directory", Remove: true})
+		}
+		return nil
+	})
+	return issues
+}
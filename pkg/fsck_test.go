@@ -0,0 +1,82 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFsck(t *testing.T) {
+	dest := t.TempDir()
+	for _, f := range []string{
+		"movies/Dune (2021)/Dune.2021.mkv",
+		"movies/Heat [1995]/Heat.1995.mkv",
+		"movies/stray.mkv",
+		"movies/James Bond Collection/Dr. No (1962)/Dr.No.1962.mkv",
+		"movies/James Bond Collection/Goldfinger [1964]/Goldfinger.1964.mkv",
+		"tv/Show (2001)/Season 1/Show (2001) - S01E01 - Pilot.mkv",
+		"tv/Show (2001)/Season 1/Show (2001) - S02E01 - Return.mkv",
+		"tv/Show (2001)/Season 01/Show (2001) - S01E02.mkv",
+		"tv/Show (2001)/Show (2001) - S01E03.mkv",
+		"tv/Show (2001)/poster.jpg",
+		// kourai's actor thumbnails are no season folder
+		"tv/Show (2001)/" + ActorsDir + "/Jane_Doe.jpg",
+		"tv/Show (2001)/Season 1/Other - S01E04.mkv",
+		"notes.txt",
+		".kourai-journal.jsonl",
+	} {
+		p := filepath.Join(dest, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.MkdirAll(filepath.Join(dest, "movies", "Empty (2000)"), 0755)
+
+	issues, err := Fsck(dest, WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, i := range issues {
+		rel, _ := filepath.Rel(dest, i.Path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{
+		"movies/Empty (2000)",
+		"movies/Heat [1995]",
+		"movies/James Bond Collection/Goldfinger [1964]",
+		"movies/stray.mkv",
+		"notes.txt",
+		"tv/Show (2001)/Season 01",
+		"tv/Show (2001)/Season 1/Other - S01E04.mkv",
+		"tv/Show (2001)/Season 1/Show (2001) - S02E01 - Return.mkv",
+		"tv/Show (2001)/Show (2001) - S01E03.mkv",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Fsck() mismatch (-want +got):\n%s", diff)
+	}
+
+	for i := len(issues) - 1; i >= 0; i-- {
+		if issues[i].Fix != nil {
+			if err := issues[i].Apply(); err != nil {
+				t.Errorf("failed to fix %v: %v", issues[i], err)
+			}
+		}
+	}
+	for _, f := range []string{
+		"movies/Heat (1995)/Heat.1995.mkv",
+		"movies/James Bond Collection/Goldfinger (1964)/Goldfinger.1964.mkv",
+		"tv/Show (2001)/Season 2/Show (2001) - S02E01 - Return.mkv",
+		"tv/Show (2001)/Season 1/Show (2001) - S01E03.mkv",
+		"tv/Show (2001)/Season 1/Show (2001) - S01E02.mkv",
+	} {
+		if _, err := os.Stat(filepath.Join(dest, f)); err != nil {
+			t.Errorf("%s was not fixed", f)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package kourai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Default hooks, downloading the first YouTube search result with yt-dlp
+var (
+	DefaultTrailerHook = []string{"yt-dlp", "--quiet", "--no-playlist", "-f", "mp4", "-o", "{{.Output}}", "ytsearch1:{{.Title}} {{.Year}} official trailer"}
+	DefaultThemeHook   = []string{"yt-dlp", "--quiet", "--no-playlist", "-x", "--audio-format", "mp3", "-o", "{{.Output}}", "ytsearch1:{{.Series}} theme song"}
+)
+
+// HookFields are the values available to the arguments of hooks.
+type HookFields struct {
+	// Type is "movie" or "episode"
+	Type string
+	// Title is the movie title, or the title of the episode the hook runs
+	// for
+	Title string
+	// Series is the series title, empty for movies
+	Series string
+	// Season and Episode are the numbers of episodes, 0 for movies
+	Season  int
+	Episode int
+	// Year is the release year, or 0 when unknown
+	Year   int
+	TMDBID int
+	// Output is the path the hook should write to. Trailer paths end in
+	// ".%(ext)s", which yt-dlp replaces with the extension of the download.
+	Output string
+}
+
+// Hook is a command run to fetch an extra, e.g. a trailer, after a target
+// was linked. Each argument is a text/template rendered with HookFields.
+type Hook struct {
+	args []*template.Template
+}
+
+// ParseHook parses the command and arguments of a hook, checking that they
+// only use the fields of HookFields.
+func ParseHook(args []string) (*Hook, error) {
+	return parseHook(args, HookFields{})
+}
+
+// parseHook parses a hook run with fields of the type of fields
+func parseHook(args []string, fields any) (*Hook, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("a hook needs a command")
+	}
+	h := &Hook{}
+	for _, a := range args {
+		t, err := template.New("hook").Option("missingkey=error").Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hook argument %q: %w", a, err)
+		}
+		if err := t.Execute(&bytes.Buffer{}, fields); err != nil {
+			return nil, fmt.Errorf("invalid hook argument %q: %w", a, err)
+		}
+		h.args = append(h.args, t)
+	}
+	return h, nil
+}
+
+// run runs h with f, the fields it was parsed for
+func (h *Hook) run(ctx context.Context, f any) error {
+	args := make([]string, len(h.args))
+	for i, t := range h.args {
+		var b strings.Builder
+		if err := t.Execute(&b, f); err != nil {
+			return err
+		}
+		args[i] = b.String()
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hook %s failed with error %w: %s", args[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// hooksDone holds the folders the hooks ran for, so that they run once per
+// movie or series in a run
+var hooksDone sync.Map
+
+// Enrich runs the hooks set with WithHooks for the media of ln: the trailer
+// hook for movies, written to "<movie folder>/<folder name>-trailer.<ext>",
+// and the theme hook for series, written to "<series folder>/theme.mp3".
+// These are the local asset locations read by Plex, and Kodi, Jellyfin and
+// Emby. In layouts where movies share a folder, trailers are named after the
+// target instead, and layouts without series folders get no theme music,
+// see episodeFolders. Hooks don't run when an asset already exists.
+func (ln Link) Enrich(ctx context.Context) error {
+	switch m := ln.media.(type) {
+	case *movie:
+		if ln.trailerHook == nil {
+			return nil
+		}
+		base := strings.TrimSuffix(ln.Target, filepath.Ext(ln.Target))
+		pattern := globEscape(base) + "-trailer.*"
+		if dir := movieFolder(ln.Target, m); dir != "" {
+			base = filepath.Join(dir, filepath.Base(dir))
+			pattern = filepath.Join(globEscape(dir), "*-trailer.*")
+		}
+		if _, done := hooksDone.LoadOrStore("trailer:"+base, true); done {
+			return nil
+		}
+		if existing, _ := filepath.Glob(pattern); len(existing) > 0 {
+			return nil
+		}
+		f := HookFields{
+			Type:   "movie",
+			Title:  m.title,
+			TMDBID: m.tmdbID,
+			Output: base + "-trailer.%(ext)s",
+		}
+		if m.YearValid() {
+			f.Year = m.year
+		}
+		return ln.trailerHook.run(ctx, f)
+	case *episode:
+		if ln.themeHook == nil {
+			return nil
+		}
+		dir, _ := episodeFolders(ln.Target, m)
+		if dir == "" {
+			return nil
+		}
+		if _, done := hooksDone.LoadOrStore("theme:"+dir, true); done {
+			return nil
+		}
+		output := filepath.Join(dir, "theme.mp3")
+		if _, err := os.Stat(output); err == nil {
+			return nil
+		}
+		return ln.themeHook.run(ctx, HookFields{
+			Type:    "episode",
+			Title:   m.title,
+			Series:  m.series,
+			Season:  m.season,
+			Episode: m.episode,
+			Year:    m.year,
+			TMDBID:  m.tmdbID,
+			Output:  output,
+		})
+	}
+	return nil
+}
+
+// EnrichLinks runs the hooks of links, see Link.Enrich, with up to workers
+// at once. Hooks download extras, so they're run once targets are created
+// rather than holding up the links that follow. report is called with the
+// failures, from any of the workers.
+func EnrichLinks(ctx context.Context, links []Link, workers int, report func(Link, error)) {
+	if workers < 1 {
+		workers = 1
+	}
+	c := make(chan Link)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ln := range c {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := ln.Enrich(ctx); err != nil {
+					report(ln, err)
+				}
+			}
+		}()
+	}
+send:
+	for _, ln := range links {
+		select {
+		case c <- ln:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(c)
+	wg.Wait()
+}
+
+// globEscape escapes the pattern characters of filepath.Match in s
+func globEscape(s string) string {
+	r := strings.NewReplacer(`*`, `[*]`, `?`, `[?]`, `[`, `[[]`)
+	return r.Replace(s)
+}
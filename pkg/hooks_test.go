@@ -0,0 +1,184 @@
+package kourai
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnrich(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook test uses sh")
+	}
+	dest := t.TempDir()
+	hook, err := ParseHook([]string{"sh", "-c", `echo "$1" > "$0"`, "{{.Output}}", "{{.Series}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := EpisodeFromPath("/dl/Show.S01E01.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := Link{Target: filepath.Join(dest, "tv/Show/Season 1/Show - S01E01.mkv"), media: e, themeHook: hook}
+	os.MkdirAll(filepath.Join(dest, "tv/Show/Season 1"), 0755)
+	if err := ln.Enrich(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "tv/Show/theme.mp3")); err != nil || string(b) != "Show\n" {
+		t.Errorf("theme hook wrote %q, %v; want \"Show\\n\"", b, err)
+	}
+
+	if _, err := ParseHook([]string{"yt-dlp", "{{.Nope}}"}); err == nil {
+		t.Error("ParseHook() with an unknown field returned no error")
+	}
+}
+
+func TestEnrichLayouts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook test uses sh")
+	}
+	defer func(o *Options) { options = o }(options)
+
+	hook, err := ParseHook([]string{"sh", "-c", `echo "$1" > "$0"`, "{{.Output}}", "{{.Title}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		movie   string
+		episode string
+		target  string
+		media   Linkable
+		want    []string
+	}{
+		{
+			name:   "movie folder",
+			target: "movies/Dune (2021)/dune.mkv",
+			media:  &movie{title: "Dune", year: 2021, path: "/dl/dune.mkv"},
+			want:   []string{"movies/Dune (2021)/Dune (2021)-trailer.%(ext)s"},
+		},
+		{
+			name:   "movies sharing a folder",
+			movie:  "Movies/{{.Title}} ({{.Year}}){{.Ext}}",
+			target: "Movies/Dune (2021).mkv",
+			media:  &movie{title: "Dune", year: 2021, path: "/dl/dune.mkv"},
+			want:   []string{"Movies/Dune (2021)-trailer.%(ext)s"},
+		},
+		{
+			name:    "series without season folders",
+			episode: "TV/{{.Series}}/{{.EpisodeID}}{{.Ext}}",
+			target:  "TV/Show/S01E01.mkv",
+			media:   &episode{series: "Show", title: "Pilot", id: "s01e01", season: 1, episode: 1, path: "/dl/show.s01e01.mkv"},
+			want:    []string{"TV/Show/theme.mp3"},
+		},
+		{
+			name:    "flat series",
+			episode: "TV/{{.Series}} - {{.EpisodeID}}{{.Ext}}",
+			target:  "TV/Show - S01E01.mkv",
+			media:   &episode{series: "Show", title: "Pilot", id: "s01e01", season: 1, episode: 1, path: "/dl/show.s01e01.mkv"},
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options = NewOptions()
+			for tmpl, target := range map[string]**TargetTemplate{tt.movie: &options.movieTarget, tt.episode: &options.episodeTarget} {
+				if tmpl == "" {
+					continue
+				}
+				if *target, err = ParseTargetTemplate(tmpl); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dest := t.TempDir()
+			ln := Link{Target: filepath.Join(dest, filepath.FromSlash(tt.target)), media: tt.media, trailerHook: hook, themeHook: hook}
+			if err := os.MkdirAll(filepath.Dir(ln.Target), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ln.Enrich(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					rel, _ := filepath.Rel(dest, p)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Enrich() outputs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEnrichLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook test uses sh")
+	}
+	dest := t.TempDir()
+	running := filepath.Join(dest, "running")
+	if err := os.Mkdir(running, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Each hook marks itself running, records how many are, and fails for
+	// the series named Fail
+	hook, err := ParseHook([]string{"sh", "-c", `touch "$1/$2"; ls "$1" | wc -l >> "$1.log"; sleep 0.05; rm "$1/$2"; [ "$2" != Fail ] && echo ok > "$0"`,
+		"{{.Output}}", running, "{{.Series}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := func(names ...string) []Link {
+		var links []Link
+		for _, series := range names {
+			target := filepath.Join(dest, "tv", series, "Season 1", series+" - S01E01.mkv")
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				t.Fatal(err)
+			}
+			links = append(links, Link{Target: target, themeHook: hook,
+				media: &episode{series: series, id: "s01e01", season: 1, episode: 1, path: "/dl/show.s01e01.mkv"}})
+		}
+		return links
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	EnrichLinks(context.Background(), links("A", "B", "C", "Fail", "D", "E", "F", "G"), 3, func(ln Link, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, ln.media.(*episode).series)
+	})
+	if diff := cmp.Diff([]string{"Fail"}, failed); diff != "" {
+		t.Errorf("failed hooks mismatch (-want +got):\n%s", diff)
+	}
+	themes, _ := filepath.Glob(filepath.Join(dest, "tv", "*", "theme.mp3"))
+	if len(themes) != 7 {
+		t.Errorf("hooks wrote %d themes, want 7", len(themes))
+	}
+	b, err := os.ReadFile(running + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range strings.Fields(string(b)) {
+		if n, _ := strconv.Atoi(f); n > 3 {
+			t.Errorf("%d hooks ran at once, want at most 3", n)
+		}
+	}
+
+	// Nothing runs once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	EnrichLinks(ctx, links("H", "I", "J", "K"), 3, func(ln Link, err error) {
+		t.Errorf("hook of %s ran after the context was cancelled", ln.Target)
+	})
+}
@@ -0,0 +1,178 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ignoreBucket is the bucket of the store ignores are kept in
+const ignoreBucket = "ignores"
+
+// Ignore silences source files that would otherwise be linked, e.g. false
+// positive matches: a file or the files below a folder, by path, or the
+// files and folders whose names match a pattern.
+type Ignore struct {
+	// Path is an absolute path, ignored with the files below it
+	Path string `json:"path,omitempty"`
+	// Pattern is a regular expression matched against file and directory
+	// names, as the patterns of WithExcludePatterns
+	Pattern string    `json:"pattern,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Added   time.Time `json:"added"`
+	// Expires is when the ignore lapses, or zero when it doesn't
+	Expires time.Time `json:"expires"`
+}
+
+// ParseIgnore returns the ignore of s, a path when it's absolute or exists,
+// or else a pattern.
+func ParseIgnore(s string) (Ignore, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Ignore{}, errors.New("empty ignore")
+	}
+	if _, err := os.Lstat(s); err == nil || filepath.IsAbs(s) {
+		return Ignore{Path: absPath(s)}, nil
+	}
+	if _, err := regexp.Compile(s); err != nil {
+		return Ignore{}, fmt.Errorf("invalid ignore pattern %q: %w", s, err)
+	}
+	return Ignore{Pattern: s}, nil
+}
+
+func (ig Ignore) String() string {
+	if ig.Path != "" {
+		return ig.Path
+	}
+	return ig.Pattern
+}
+
+// Expired reports whether ig lapsed at now.
+func (ig Ignore) Expired(now time.Time) bool {
+	return !ig.Expires.IsZero() && !now.Before(ig.Expires)
+}
+
+// key is the key of ig in the store, the same for ignores of the same path
+// or pattern
+func (ig Ignore) key() string {
+	if ig.Path != "" {
+		return "path:" + ig.Path
+	}
+	return "pattern:" + ig.Pattern
+}
+
+// AddIgnore stores ig, replacing the ignore of the same path or pattern.
+func (db *StateDB) AddIgnore(ig Ignore) error {
+	if ig.Path == "" && ig.Pattern == "" {
+		return errors.New("empty ignore")
+	}
+	if ig.Added.IsZero() {
+		ig.Added = time.Now().UTC()
+	}
+	b, err := json.Marshal(ig)
+	if err != nil {
+		return err
+	}
+	return db.store.Put(context.Background(), ignoreBucket, ig.key(), b)
+}
+
+// RemoveIgnore removes the ignore of the path or pattern of ig, returning
+// ErrNotFound when there's none.
+func (db *StateDB) RemoveIgnore(ig Ignore) error {
+	if _, _, err := db.store.Get(context.Background(), ignoreBucket, ig.key()); err != nil {
+		return err
+	}
+	return db.store.Delete(context.Background(), ignoreBucket, ig.key())
+}
+
+// Ignores returns the stored ignores, expired ones included, by path or
+// pattern.
+func (db *StateDB) Ignores() ([]Ignore, error) {
+	values, err := db.store.List(context.Background(), ignoreBucket)
+	if err != nil {
+		return nil, err
+	}
+	ignores := make([]Ignore, 0, len(values))
+	for _, b := range values {
+		var ig Ignore
+		if err := json.Unmarshal(b, &ig); err != nil {
+			return nil, err
+		}
+		ignores = append(ignores, ig)
+	}
+	sort.Slice(ignores, func(i, j int) bool { return ignores[i].String() < ignores[j].String() })
+	return ignores, nil
+}
+
+// WithIgnores ignores source files for the run, in addition to the
+// ignores stored in the state database, see WithStateDB.
+func WithIgnores(ignores []Ignore) Option {
+	return func(o *Options) {
+		o.runIgnores = ignores
+	}
+}
+
+// ignoreList matches paths against ignores that haven't expired
+type ignoreList struct {
+	ignores []Ignore
+	// patterns are the compiled patterns of ignores, nil for paths
+	patterns []*regexp.Regexp
+}
+
+// loadIgnores sets the ignores of the run and of the state database of o
+func (o *Options) loadIgnores() error {
+	ignores := append([]Ignore{}, o.runIgnores...)
+	if o.state != nil {
+		stored, err := o.state.Ignores()
+		if err != nil {
+			return fmt.Errorf("failed to read ignores with error %w", err)
+		}
+		ignores = append(ignores, stored...)
+	}
+	o.ignores = nil
+	now := o.clock.Now()
+	l := &ignoreList{}
+	for _, ig := range ignores {
+		if ig.Expired(now) {
+			continue
+		}
+		var re *regexp.Regexp
+		if ig.Path == "" {
+			var err error
+			if re, err = regexp.Compile(ig.Pattern); err != nil {
+				return fmt.Errorf("invalid ignore pattern %q: %w", ig.Pattern, err)
+			}
+		}
+		l.ignores = append(l.ignores, ig)
+		l.patterns = append(l.patterns, re)
+	}
+	if len(l.ignores) > 0 {
+		o.ignores = l
+	}
+	return nil
+}
+
+// match returns the ignore matching path. A nil list matches nothing.
+func (l *ignoreList) match(path string) (Ignore, bool) {
+	if l == nil {
+		return Ignore{}, false
+	}
+	path = absPath(path)
+	for i, ig := range l.ignores {
+		if re := l.patterns[i]; re != nil {
+			if re.MatchString(filepath.Base(path)) {
+				return ig, true
+			}
+		} else if rel, err := filepath.Rel(ig.Path, path); err == nil && filepath.IsLocal(rel) {
+			return ig, true
+		}
+	}
+	return Ignore{}, false
+}
@@ -0,0 +1,79 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIgnores(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src := t.TempDir()
+	os.Mkdir(filepath.Join(src, "Extras"), 0755)
+	for _, f := range []string{"Heat.1995.mkv", "Alien.1979.mkv", "Dune.2021.mkv", "Cats.2019.mkv", "Extras/Heat.1995.Featurette.mkv"} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := filepath.Join(t.TempDir(), "state.db")
+	db, err := OpenStateDB(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ig := range []Ignore{
+		{Path: filepath.Join(src, "Extras")},
+		{Pattern: `^Dune\.`, Reason: "waiting for a remux"},
+		{Path: filepath.Join(src, "Alien.1979.mkv"), Expires: time.Now().Add(-time.Minute)},
+	} {
+		if err := db.AddIgnore(ig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.RemoveIgnore(Ignore{Pattern: "nope"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveIgnore() of a missing ignore = %v, want ErrNotFound", err)
+	}
+	ignores, err := db.Ignores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ignores) != 3 || ignores[2].Reason != "waiting for a remux" {
+		t.Errorf("Ignores() = %+v, want the 3 ignores added", ignores)
+	}
+	db.Close()
+
+	cats, err := ParseIgnore("Cats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.SetOptions(WithStateDB(state), WithIgnores([]Ignore{cats}))
+	if err := options.openState(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { options.state.Close() }()
+	got := []string{}
+	media, _ := findFiles(context.Background(), src, options.fileFilters...)
+	for m := range media {
+		rel, _ := filepath.Rel(src, m.Path())
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	// Alien's ignore expired
+	if diff := cmp.Diff([]string{"Alien.1979.mkv", "Heat.1995.mkv"}, got); diff != "" {
+		t.Errorf("findFiles() with ignores mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := ParseIgnore("(unclosed"); err == nil {
+		t.Error("ParseIgnore() of an invalid pattern returned no error")
+	}
+	if ig, _ := ParseIgnore(filepath.Join(src, "Heat.1995.mkv")); ig.Path == "" {
+		t.Errorf("ParseIgnore() of a path = %+v, want a path", ig)
+	}
+}
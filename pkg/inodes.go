@@ -0,0 +1,100 @@
+package kourai
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// InodeGroup is a set of paths that are hard links to the same file.
+type InodeGroup struct {
+	Dev   uint64
+	Ino   uint64
+	Size  int64
+	Nlink uint64
+	Paths []string
+}
+
+// InodeReport describes how the regular files below a set of roots share
+// storage. ApparentBytes counts every path, UniqueBytes counts every inode
+// only once.
+type InodeReport struct {
+	Groups        []InodeGroup
+	Files         int
+	ApparentBytes int64
+	UniqueBytes   int64
+}
+
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
+// NewInodeReport walks roots, e.g. destination libraries and their sources,
+// grouping regular files by device and inode. Groups are sorted by size,
+// largest first.
+func NewInodeReport(roots ...string) (InodeReport, error) {
+	var report InodeReport
+	var errs []error
+	groups := map[inodeKey]*InodeGroup{}
+
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			dev, ino, nlink, err := fileIdentity(path, info)
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+
+			k := inodeKey{dev, ino}
+			g, ok := groups[k]
+			if !ok {
+				g = &InodeGroup{
+					Dev:   k.dev,
+					Ino:   k.ino,
+					Size:  info.Size(),
+					Nlink: nlink,
+				}
+				groups[k] = g
+				report.UniqueBytes += g.Size
+			}
+			// Overlapping roots would visit the same path twice
+			for _, p := range g.Paths {
+				if p == path {
+					return nil
+				}
+			}
+			g.Paths = append(g.Paths, path)
+			report.Files++
+			report.ApparentBytes += g.Size
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, g := range groups {
+		report.Groups = append(report.Groups, *g)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Size != report.Groups[j].Size {
+			return report.Groups[i].Size > report.Groups[j].Size
+		}
+		return report.Groups[i].Ino < report.Groups[j].Ino
+	})
+	return report, errors.Join(errs...)
+}
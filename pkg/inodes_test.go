@@ -0,0 +1,82 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNewInodeReport(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "downloads")
+	dest := filepath.Join(root, "library")
+	os.MkdirAll(src, 0755)
+	os.MkdirAll(filepath.Join(dest, "movies"), 0755)
+
+	files := map[string]string{
+		"downloads/a.mkv": "aaaa",
+		"downloads/b.mkv": "bb",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	linked := filepath.Join(dest, "movies", "a.mkv")
+	if err := os.Link(filepath.Join(src, "a.mkv"), linked); err != nil {
+		t.Fatal(err)
+	}
+
+	// The overlapping root visits the destination twice
+	report, err := NewInodeReport(src, dest, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := InodeReport{
+		Groups: []InodeGroup{
+			{Size: 4, Nlink: 2, Paths: []string{filepath.Join(src, "a.mkv"), linked}},
+			{Size: 2, Nlink: 1, Paths: []string{filepath.Join(src, "b.mkv")}},
+		},
+		Files:         3,
+		ApparentBytes: 10,
+		UniqueBytes:   6,
+	}
+	if diff := cmp.Diff(want, report, cmpopts.IgnoreFields(InodeGroup{}, "Dev", "Ino")); diff != "" {
+		t.Errorf("NewInodeReport() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFileIdentity(t *testing.T) {
+	root := t.TempDir()
+	a, b, c := filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(root, "c")
+	os.WriteFile(a, []byte("a"), 0644)
+	os.WriteFile(c, []byte("a"), 0644)
+	if err := os.Link(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	identity := func(path string) [3]uint64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dev, ino, nlink, err := fileIdentity(path, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return [3]uint64{dev, ino, nlink}
+	}
+	ia, ib, ic := identity(a), identity(b), identity(c)
+	if ia != ib {
+		t.Errorf("fileIdentity() of hard links differs: %v, %v", ia, ib)
+	}
+	if ia[2] != 2 || ic[2] != 1 {
+		t.Errorf("fileIdentity() link counts = %d, %d, want 2, 1", ia[2], ic[2])
+	}
+	if ia[0] == ic[0] && ia[1] == ic[1] {
+		t.Errorf("fileIdentity() of distinct files is the same: %v", ia)
+	}
+}
@@ -0,0 +1,73 @@
+package kourai
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// ErrTooManyIOErrors is returned when more paths of the sources couldn't be
+// read than allowed by WithMaxIOErrors.
+var ErrTooManyIOErrors = errors.New("too many unreadable paths")
+
+// IOError is a file or directory of the sources that couldn't be read, e.g.
+// for lack of permission. Files below unreadable directories aren't found.
+type IOError struct {
+	Path string
+	Err  error
+}
+
+// ioErrorList collects the IOErrors of the runs of the process
+type ioErrorList struct {
+	mu     sync.Mutex
+	errors []IOError
+	// max is the number of errors tolerated, or -1 for any
+	max int
+}
+
+// WithMaxIOErrors stops finding files, and has IOErrors return
+// ErrTooManyIOErrors, once more than n paths of the sources couldn't be
+// read. A negative n tolerates any number, as by default.
+func WithMaxIOErrors(n int) Option {
+	return func(o *Options) {
+		o.ioErrors.mu.Lock()
+		defer o.ioErrors.mu.Unlock()
+		o.ioErrors.max = max(n, -1)
+	}
+}
+
+// add records that path couldn't be read, reporting it as skipped, and
+// returns ErrTooManyIOErrors when more errors occurred than tolerated
+func (l *ioErrorList) add(path string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	options.logger.Warn("failed to read source path", "path", path, "error", err)
+	skip(path, SkipUnreadable, err.Error())
+	options.events.failed(path, err)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, IOError{path, err})
+	return l.exceeded()
+}
+
+// exceeded returns ErrTooManyIOErrors when more errors occurred than
+// tolerated; l.mu is held by the caller
+func (l *ioErrorList) exceeded() error {
+	if l.max >= 0 && len(l.errors) > l.max {
+		return fmt.Errorf("%w: %d paths of the sources couldn't be read, more than the %d allowed", ErrTooManyIOErrors, len(l.errors), l.max)
+	}
+	return nil
+}
+
+// IOErrors returns the paths of the sources that couldn't be read so far,
+// and ErrTooManyIOErrors when there were more than allowed by
+// WithMaxIOErrors, in which case the run should be failed.
+func IOErrors() ([]IOError, error) {
+	l := &options.ioErrors
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]IOError{}, l.errors...), l.exceeded()
+}
@@ -0,0 +1,91 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// deniedFS fails to list the directories of denied, as without permission
+type deniedFS struct {
+	FileSystem
+	denied map[string]bool
+}
+
+func (f deniedFS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return f.FileSystem.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && f.denied[p] {
+			if err := fn(p, d, &fs.PathError{Op: "open", Path: p, Err: fs.ErrPermission}); err != nil {
+				return err
+			}
+			return fs.SkipDir
+		}
+		return fn(p, d, err)
+	})
+}
+
+func TestIOErrors(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	root := filepath.Join(t.TempDir(), "dl")
+	files := fstest.MapFS{
+		"Heat.1995.mkv":                 {Data: []byte("video")},
+		"private/Alien.1979.mkv":        {Data: []byte("video")},
+		"locked/Dune.2021.mkv":          {Data: []byte("video")},
+		"shows/Andor.S01E01.mkv":        {Data: []byte("video")},
+		"shows/locked/Andor.S01E02.mkv": {Data: []byte("video")},
+	}
+	fsys := deniedFS{MountFS(root, files), map[string]bool{
+		filepath.Join(root, "private"):      true,
+		filepath.Join(root, "locked"):       true,
+		filepath.Join(root, "shows/locked"): true,
+	}}
+	skipped := map[string]string{}
+	options.SetOptions(
+		WithFileSystem(fsys),
+		WithFileExtensions([]string{"mkv"}),
+		WithSkipReport(func(s SkippedFile) {
+			skipped[s.Path] = s.Code
+		}),
+	)
+
+	media, errc := findFiles(context.Background(), root, options.fileFilters...)
+	for range media {
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	unreadable, err := IOErrors()
+	if err != nil {
+		t.Errorf("IOErrors() without a limit returned %v", err)
+	}
+	want := []IOError{
+		{filepath.Join(root, "locked"), fs.ErrPermission},
+		{filepath.Join(root, "private"), fs.ErrPermission},
+		{filepath.Join(root, "shows/locked"), fs.ErrPermission},
+	}
+	if diff := cmp.Diff(want, unreadable, cmp.Comparer(func(a, b error) bool { return errors.Is(a, b) })); diff != "" {
+		t.Errorf("IOErrors() mismatch (-want +got):\n%s", diff)
+	}
+	if code := skipped[filepath.Join(root, "private")]; code != SkipUnreadable {
+		t.Errorf("unreadable directory skipped as %q, want %q", code, SkipUnreadable)
+	}
+
+	// More errors than allowed stop the walk
+	options.SetOptions(WithMaxIOErrors(3))
+	media, errc = findFiles(context.Background(), root, options.fileFilters...)
+	for range media {
+	}
+	if err := <-errc; !errors.Is(err, ErrTooManyIOErrors) {
+		t.Errorf("findFiles() past the limit returned %v, want %v", err, ErrTooManyIOErrors)
+	}
+	if unreadable, err := IOErrors(); !errors.Is(err, ErrTooManyIOErrors) || len(unreadable) != 4 {
+		t.Errorf("IOErrors() past the limit = %d errors, %v, want 4 and %v", len(unreadable), err, ErrTooManyIOErrors)
+	}
+}
@@ -0,0 +1,274 @@
+package kourai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalName is the name of the journal file kept in a library root.
+const JournalName = ".kourai-journal.jsonl"
+
+// JournalEntry records a single change made to a library.
+type JournalEntry struct {
+	Run    string    `json:"run"`
+	Mode   string    `json:"mode"`
+	Src    string    `json:"src"`
+	Target string    `json:"target"`
+	Time   time.Time `json:"time"`
+	// Size and ModTime are those of the target when it was created, so
+	// that a target replaced since is recognized
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mtime,omitempty"`
+	// Confidence is that of the search result the media was matched by,
+	// or zero when it wasn't searched for, see Confidence
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// Journal appends entries for one run to a newline delimited JSON file, so
+// that the changes made by the run can be reverted later.
+type Journal struct {
+	path string
+	run  string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s with error %w", path, err)
+	}
+	j := &Journal{
+		path: path,
+		run:  time.Now().UTC().Format(time.RFC3339Nano),
+		f:    f,
+	}
+	return j, nil
+}
+
+// Record appends an entry for ln to the journal. Links whose source is
+// already their target changed nothing and are not recorded.
+func (j *Journal) Record(mode string, ln Link) error {
+	if filepath.Clean(ln.Src) == filepath.Clean(ln.Target) {
+		return nil
+	}
+	e := JournalEntry{
+		Run:    j.run,
+		Mode:   mode,
+		Src:    ln.Src,
+		Target: ln.Target,
+		Time:   time.Now().UTC(),
+	}
+	if info, err := os.Lstat(ln.Target); err == nil && info.Mode().IsRegular() {
+		e.Size, e.ModTime = info.Size(), info.ModTime().UTC()
+	}
+	if ln.media != nil {
+		e.Confidence = Confidence(ln.media)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.f.Write(append(b, '\n'))
+	return err
+}
+
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+func ReadJournal(path string) ([]JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return entries, fmt.Errorf("failed to parse journal %s with error %w", path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func writeJournal(path string, entries []JournalEntry) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// JournalRuns returns the IDs of the runs recorded in entries, oldest
+// first, with the number of entries of each.
+func JournalRuns(entries []JournalEntry) ([]string, map[string]int) {
+	runs := []string{}
+	counts := map[string]int{}
+	for _, e := range entries {
+		if _, ok := counts[e.Run]; !ok {
+			runs = append(runs, e.Run)
+		}
+		counts[e.Run]++
+	}
+	return runs, counts
+}
+
+// UndoLastRun reverts the changes recorded for the most recent run in the
+// journal at path.
+func UndoLastRun(path string) ([]JournalEntry, error) {
+	return UndoRun(path, "")
+}
+
+// UndoRun reverts the changes recorded for run in the journal at path,
+// newest first, and removes them from the journal. An empty run is the most
+// recent one. Entries that could not be reverted are kept.
+func UndoRun(path string, run string) ([]JournalEntry, error) {
+	entries, err := ReadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("journal %s is empty", path)
+	}
+
+	if run == "" {
+		run = entries[len(entries)-1].Run
+	} else if _, counts := JournalRuns(entries); counts[run] == 0 {
+		return nil, fmt.Errorf("no run %s in journal %s", run, path)
+	}
+	var errs []error
+	kept := []JournalEntry{}
+	undone := []JournalEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Run != run {
+			kept = append(kept, e)
+			continue
+		}
+		if err := undoEntry(e); err != nil {
+			errs = append(errs, err)
+			kept = append(kept, e)
+			continue
+		}
+		RemoveEmptyParents(filepath.Dir(e.Target), filepath.Dir(path))
+		undone = append(undone, e)
+	}
+
+	// kept was built newest first
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	if err := writeJournal(path, kept); err != nil {
+		errs = append(errs, err)
+	}
+	return undone, errors.Join(errs...)
+}
+
+func undoEntry(e JournalEntry) error {
+	switch LinkMode(e.Mode) {
+	case ModeMove:
+		if _, err := os.Stat(e.Src); err == nil {
+			return fmt.Errorf("cannot move %s back, %s already exists", e.Target, e.Src)
+		}
+		if err := os.MkdirAll(filepath.Dir(e.Src), 0755); err != nil {
+			return err
+		}
+		return os.Rename(e.Target, e.Src)
+	case ModeHardlink, ModeCopy:
+		return removeTarget(e)
+	default:
+		return fmt.Errorf("%w journal mode %q for %s", ErrUnsupportedType, e.Mode, e.Target)
+	}
+}
+
+// removeTarget removes a target that was linked or copied from its source.
+// Targets are only removed while their source still exists, and files only
+// when they are still the source or unchanged since they were copied, so
+// that nothing replaced since, or the last copy of a file, is lost.
+func removeTarget(e JournalEntry) error {
+	target, err := os.Lstat(e.Target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	src, err := os.Stat(e.Src)
+	if err != nil {
+		return fmt.Errorf("not removing %s, its source %s is not available: %w", e.Target, e.Src, err)
+	}
+	if target.Mode().IsRegular() && !os.SameFile(src, target) {
+		same, err := unchangedCopy(e, src, target)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("not removing %s, it no longer matches %s", e.Target, e.Src)
+		}
+	}
+	return os.RemoveAll(e.Target)
+}
+
+// unchangedCopy reports whether the target of e is still the copy of its
+// source that was journaled. Entries recorded without the size and
+// modification time of the target are compared by content.
+func unchangedCopy(e JournalEntry, src, target os.FileInfo) (bool, error) {
+	if src.Size() != target.Size() {
+		return false, nil
+	}
+	if !e.ModTime.IsZero() {
+		return e.Size == target.Size() && e.ModTime.Equal(target.ModTime()), nil
+	}
+	want, err := hashFile("xxhash", e.Src)
+	if err != nil {
+		return false, err
+	}
+	got, err := hashFile("xxhash", e.Target)
+	if err != nil {
+		return false, err
+	}
+	return want == got, nil
+}
+
+// RemoveEmptyParents removes dir and its parents for as long as they are
+// empty, stopping at root.
+func RemoveEmptyParents(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUndoLastRun(t *testing.T) {
+	root := t.TempDir()
+	journalPath := filepath.Join(root, JournalName)
+
+	runs := [][]Link{{
+		{Src: filepath.Join(root, "a.mkv"), Target: filepath.Join(root, "movies/A/a.mkv")},
+	}, {
+		{Src: filepath.Join(root, "dl/b.mkv"), Target: filepath.Join(root, "movies/B/b.mkv")},
+		{Src: filepath.Join(root, "dl/c.mkv"), Target: filepath.Join(root, "movies/C/c.mkv")},
+	}}
+	for _, run := range runs {
+		j, err := OpenJournal(journalPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ln := range run {
+			os.MkdirAll(filepath.Dir(ln.Src), 0755)
+			if f, err := os.Create(ln.Src); err != nil {
+				t.Fatal("failed to create test file", ln.Src)
+			} else {
+				f.Close()
+			}
+			if err := ln.Rename(); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Record("move", ln); err != nil {
+				t.Fatal(err)
+			}
+		}
+		j.Close()
+	}
+
+	undone, err := UndoLastRun(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undone) != 2 {
+		t.Errorf("UndoLastRun() undid %d entries, want 2", len(undone))
+	}
+	for _, ln := range runs[1] {
+		if _, err := os.Stat(ln.Src); err != nil {
+			t.Errorf("%s was not moved back", ln.Src)
+		}
+		if _, err := os.Stat(filepath.Dir(ln.Target)); !os.IsNotExist(err) {
+			t.Errorf("empty directory %s was not removed", filepath.Dir(ln.Target))
+		}
+	}
+	if _, err := os.Stat(runs[0][0].Target); err != nil {
+		t.Errorf("%s from an earlier run was moved back", runs[0][0].Target)
+	}
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Src != runs[0][0].Src {
+		t.Errorf("journal after undo = %v, want only the first run", entries)
+	}
+}
+
+func TestUndoLinkedRun(t *testing.T) {
+	root := t.TempDir()
+	journalPath := filepath.Join(root, JournalName)
+
+	links := []Link{
+		{Src: filepath.Join(root, "dl/a.mkv"), Target: filepath.Join(root, "movies/A/a.mkv"), Mode: ModeHardlink},
+		{Src: filepath.Join(root, "dl/b.mkv"), Target: filepath.Join(root, "movies/B/b.mkv"), Mode: ModeCopy},
+		{Src: filepath.Join(root, "dl/c.mkv"), Target: filepath.Join(root, "movies/C/c.mkv"), Mode: ModeHardlink},
+	}
+	j, err := OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ln := range links {
+		os.MkdirAll(filepath.Dir(ln.Src), 0755)
+		if err := os.WriteFile(ln.Src, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ln.Create(); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.Record(string(ln.Mode), ln); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	// c.mkv was replaced after the run and must be kept
+	os.Remove(links[2].Target)
+	if err := os.WriteFile(links[2].Target, []byte("replaced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := UndoLastRun(journalPath)
+	if err == nil {
+		t.Error("UndoLastRun() removed a replaced target without error")
+	}
+	if len(undone) != 2 {
+		t.Errorf("UndoLastRun() undid %d entries, want 2", len(undone))
+	}
+	for _, ln := range links[:2] {
+		if _, err := os.Stat(ln.Src); err != nil {
+			t.Errorf("source %s was removed", ln.Src)
+		}
+		if _, err := os.Stat(filepath.Dir(ln.Target)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", filepath.Dir(ln.Target))
+		}
+	}
+	if _, err := os.Stat(links[2].Target); err != nil {
+		t.Errorf("replaced target %s was removed", links[2].Target)
+	}
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Target != links[2].Target {
+		t.Errorf("journal after undo = %v, want only the entry that was kept", entries)
+	}
+}
+
+func TestRecordSkipsUnchanged(t *testing.T) {
+	root := t.TempDir()
+	journalPath := filepath.Join(root, JournalName)
+	j, err := OpenJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, "movies/A (2000)/A (2000).mkv")
+	if err := j.Record(string(ModeMove), Link{Src: path, Target: path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Record(string(ModeMove), Link{Src: filepath.Join(root, "a.mkv"), Target: path}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	entries, err := ReadJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Src != filepath.Join(root, "a.mkv") {
+		t.Errorf("journal = %v, want only the entry of the moved file", entries)
+	}
+}
+
+func TestRemoveTarget(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src.mkv")
+	if err := os.WriteFile(src, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		content  string
+		journal  bool
+		replaced bool
+		removed  bool
+	}{
+		{name: "copy", content: "data", journal: true, removed: true},
+		{name: "replaced with the same size", content: "data", journal: true, replaced: true},
+		{name: "copy without recorded mtime", content: "data", removed: true},
+		{name: "different content without recorded mtime", content: "DATA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(root, "target.mkv")
+			if err := os.WriteFile(target, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(target, past, past)
+			e := JournalEntry{Mode: string(ModeCopy), Src: src, Target: target}
+			if tt.journal {
+				info, _ := os.Stat(target)
+				e.Size, e.ModTime = info.Size(), info.ModTime()
+			}
+			if tt.replaced {
+				os.WriteFile(target, []byte("DATA"), 0644)
+			}
+
+			err := removeTarget(e)
+			_, statErr := os.Stat(target)
+			if removed := os.IsNotExist(statErr); removed != tt.removed {
+				t.Errorf("removeTarget() removed = %v, want %v (error %v)", removed, tt.removed, err)
+			}
+			if (err != nil) == tt.removed {
+				t.Errorf("removeTarget() error = %v", err)
+			}
+			os.Remove(target)
+		})
+	}
+}
@@ -1,23 +1,28 @@
+// Package kourai implements the kourai command. Its API changes as the
+// command needs; other Go projects should depend on the stable API of
+// github.com/alzabo/kourai/api/v1 instead.
 package kourai
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	tmdb "github.com/alzabo/kourai/tmdb"
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+	"github.com/alzabo/kourai/internal/tvdb"
 
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+	"golang.org/x/time/rate"
 )
 
 // TODO: filtering before works, but results are empty because the mtime on the root folder
@@ -28,7 +33,17 @@ var (
 	episodeExpr  = regexp.MustCompile(`(?i)(s\d+).?(e\d+)-?((?:e\d+)+)*`)
 	sentinelExpr = regexp.MustCompile(`(?i)\b(\d{3,4}[ip]|limited|unrated|web(-dl|rip)|bluray|10bit|pal|re(rip|pack)|dvdrip|a\.k\.a\.?|aka)\b`)
 	seasonExpr   = regexp.MustCompile(`(?i)s(\d+)`)
-	dateExpr     = regexp.MustCompile(`(?:\b(19|20)\d{2}\b(?:-\d{1,2}-\d{1,2})?)`)
+	// crossExpr matches the NxNN episode IDs of some releases, e.g. 1x05,
+	// or 1x01-1x02 and 1x01-02 for files with several episodes
+	crossExpr = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})((?:-(?:\d{1,2}x)?\d{2,3})*)\b`)
+	crossNext = regexp.MustCompile(`-(?:\d{1,2}x)?(\d{2,3})`)
+	dateExpr  = regexp.MustCompile(`(?:\b(19|20)\d{2}\b(?:-\d{1,2}-\d{1,2})?)`)
+	// providerIDExpr matches the provider ID tags of curated names, e.g.
+	// {tmdb-603}, [imdbid-tt0133093] or {tvdb=81189}
+	providerIDExpr = regexp.MustCompile(`(?i)\s*[\[{](tmdb|imdb|tvdb)(?:id)?[-=]((?:tt)?\d+)[\]}]`)
+	// airDateExpr matches the air dates identifying the episodes of daily
+	// shows, e.g. Show.2024.05.01.Guest
+	airDateExpr = regexp.MustCompile(`\b((?:19|20)\d{2})[.\-_ ](\d{1,2})[.\-_ ](\d{1,2})\b`)
 )
 
 const oldestMovieYear int = 1888
@@ -38,9 +53,88 @@ type Options struct {
 	TMDBClient     *tmdb.TMDB
 	fileFilters    []fileFilter
 	mediaFilters   []mediaFilter
+	only           *selectorFilter
 	sources        []string
 	dest           string
 	excludeTypes   map[string]struct{}
+	permissions    *Permissions
+	finderTags     []string
+	episodePadding int
+	copyFallback   bool
+	linkMode       LinkMode
+	aliases        *AliasDB
+	artwork        bool
+	logger         *slog.Logger
+	ioWorkers      int
+	netWorkers     int
+	trailerHook    *Hook
+	themeHook      *Hook
+	collectionSets bool
+	// collectionDirs nests movies under their TMDB collection, see
+	// WithCollectionFolders
+	collectionDirs bool
+	// sharded files media folders under their first letter, see
+	// WithShardedLayout
+	sharded       bool
+	nfo           bool
+	ratingSource  RatingSource
+	omdbKey       string
+	actorThumbs   bool
+	movieTarget   *TargetTemplate
+	episodeTarget *TargetTemplate
+	language      string
+	copyLimiters  []*rate.Limiter
+	provider      MetadataProvider
+	local         []LocalProvider
+	routes        []Route
+	// settle is how long files must be left unchanged before they're
+	// linked, see WithSettleTime
+	settle time.Duration
+	// skipped is called with the files that aren't linked, see
+	// WithSkipReport
+	skipped func(SkippedFile)
+	// minConfidence rejects search results, see WithMinConfidence
+	minConfidence float64
+	skipUnsure    bool
+	// chooser resolves ambiguous searches, see WithChooser
+	chooser func(Choice) int
+	// titleExceptions are the words written as given by the user in
+	// parsed titles, by their lower case, see WithTitleExceptions
+	titleExceptions map[string]string
+	// state records processed sources, opened from statePath, see
+	// WithStateDB
+	statePath string
+	state     *StateDB
+	// skipLinked skips sources hard linked already, see WithSkipLinked
+	skipLinked *linkedFilter
+	// sourcePriority ranks source directories, see WithSourcePriority
+	sourcePriority []string
+	// runIgnores are the ignores of the run, see WithIgnores, and ignores
+	// those and the ignores of state, loaded by openState
+	runIgnores []Ignore
+	ignores    *ignoreList
+	// clock and fs are those of the checks of sources, see WithClock and
+	// WithFileSystem
+	clock Clock
+	fs    FileSystem
+	// extensionPolicies override the extensions of fileFilters, see
+	// WithExtensionPolicies
+	extensionPolicies map[string]ExtensionPolicy
+	// service counts the work of watch and serve, see WithServiceMetrics
+	service *ServiceMetrics
+	// ioErrors are the paths of the sources that couldn't be read, see
+	// WithMaxIOErrors
+	ioErrors ioErrorList
+	// subtitles links the subtitles of videos, see WithSubtitles
+	subtitles bool
+	// events are the callbacks of embedding applications, see WithEvents
+	events Events
+	// targetCase is the case of targets, see WithTargetCase
+	targetCase CasePolicy
+	// probe probes videos with ffprobe, see WithProbe
+	probe bool
+	// keepFileYear keeps the years of names, see WithFileYear
+	keepFileYear bool
 }
 
 func (o *Options) SetOptions(opts ...Option) {
@@ -49,12 +143,81 @@ func (o *Options) SetOptions(opts ...Option) {
 	}
 }
 
+// Validate reports the problems of o that would make a run do nothing or
+// fail, such as a missing destination, all at once. LinkFromFiles
+// validates its options before finding any file.
+func (o *Options) Validate() error {
+	var errs []error
+	if o.dest == "" {
+		errs = append(errs, errors.New("no destination directory"))
+	}
+	return errors.Join(append(errs, o.validateSources())...)
+}
+
+// validateSources reports the problems of o but a missing destination,
+// which Scan doesn't need
+func (o *Options) validateSources() error {
+	var errs []error
+	if len(o.sources) == 0 {
+		errs = append(errs, errors.New("no source directories"))
+	}
+	for i, src := range o.sources {
+		if src == "" {
+			errs = append(errs, fmt.Errorf("source directory %d is empty", i+1))
+		}
+	}
+	_, noMovies := o.excludeTypes["movie"]
+	_, noEpisodes := o.excludeTypes["episode"]
+	if noMovies && noEpisodes {
+		errs = append(errs, errors.New("both movies and episodes are excluded, nothing would be linked"))
+	}
+	if _, err := ParseLinkMode(string(o.linkMode)); err != nil {
+		errs = append(errs, err)
+	}
+	if o.nfo {
+		if _, err := ParseRatingSource(string(o.ratingSource)); err != nil {
+			errs = append(errs, err)
+		}
+		if o.ratingSource == RatingIMDb && o.omdbKey == "" {
+			errs = append(errs, errors.New("IMDb ratings need an OMDb API key"))
+		}
+	}
+	if o.actorThumbs && !o.nfo {
+		errs = append(errs, errors.New("actor thumbnails are only placed when writing NFOs"))
+	}
+	for i, r := range o.routes {
+		if r.Dest == "" {
+			errs = append(errs, fmt.Errorf("route %d has no destination directory", i+1))
+		}
+	}
+	if o.minConfidence < 0 || o.minConfidence > 1 {
+		errs = append(errs, fmt.Errorf("minimum confidence %v is not between 0 and 1", o.minConfidence))
+	}
+	if o.settle < 0 {
+		errs = append(errs, fmt.Errorf("invalid settle time %s", o.settle))
+	}
+	if o.probe {
+		if _, err := exec.LookPath("ffprobe"); err != nil {
+			errs = append(errs, fmt.Errorf("probing videos needs ffprobe: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func NewOptions() *Options {
 	defaultFilter := NewRegexpFilter([]string{`(?i)\bsample\b`})
 
 	o := &Options{}
 	o.fileFilters = append(o.fileFilters, defaultFilter)
 	o.excludeTypes = map[string]struct{}{}
+	o.episodePadding = 2
+	o.linkMode = ModeHardlink
+	o.logger = slog.Default()
+	o.ioWorkers = 8
+	o.netWorkers = 8
+	o.clock = systemClock{}
+	o.fs = osFileSystem{}
+	o.ioErrors.max = -1
 	return o
 }
 
@@ -78,6 +241,19 @@ func WithTMDBApiKey(k string) Option {
 			return
 		}
 		o.TMDBClient = tmdb.New(k)
+		o.TMDBClient.SetLanguage(o.language)
+	}
+}
+
+// WithMetadataLanguage looks titles up on TMDB in lang, an IETF language tag
+// such as de-DE, so that targets are named with localized titles. Titles
+// that aren't translated keep their original language.
+func WithMetadataLanguage(lang string) Option {
+	return func(o *Options) {
+		o.language = lang
+		if o.TMDBClient != nil {
+			o.TMDBClient.SetLanguage(lang)
+		}
 	}
 }
 
@@ -116,33 +292,358 @@ func WithFileModificationFilter(after, before *time.Time) Option {
 	}
 }
 
-// TODO: collect additional metadata when filters that require it are enabled.
+// WithMinFileSize excludes files smaller than size bytes, e.g. sample clips
+// whose names don't say so. A size of 0 excludes none.
+func WithMinFileSize(size int64) Option {
+	return func(o *Options) {
+		if size > 0 {
+			o.fileFilters = append(o.fileFilters, fileSizeFilter{size})
+		}
+	}
+}
+
+// WithPermissions sets the ownership and modes of directories and files
+// created in the destination.
+func WithPermissions(p *Permissions) Option {
+	return func(o *Options) {
+		o.permissions = p
+	}
+}
+
+// WithAliasDB consults db for corrected matches before searching TMDB.
+func WithAliasDB(db *AliasDB) Option {
+	return func(o *Options) {
+		o.aliases = db
+	}
+}
+
+// WithStore keeps TMDB and TVDB responses in store for ttl, or forever when
+// ttl is zero. The response caches are shared by all clients. A nil store
+// disables them.
+func WithStore(store Store, ttl time.Duration) Option {
+	return func(o *Options) {
+		if store != nil {
+			tmdb.SetCache(storeCache{store: store, bucket: tmdbCacheBucket, ttl: ttl})
+			tvdb.SetCache(storeCache{store: store, bucket: tvdbCacheBucket, ttl: ttl})
+		} else {
+			tmdb.SetCache(nil)
+			tvdb.SetCache(nil)
+		}
+	}
+}
+
+// WithTMDBRetries retries TMDB requests that were rate limited or failed
+// with a server error, making up to attempts requests, with an
+// exponential backoff starting at base unless the response says how long
+// to wait. Up to a jitter fraction of each delay is added at random. Like
+// the response cache, this applies to all TMDB clients.
+func WithTMDBRetries(attempts int, base time.Duration, jitter float64) Option {
+	return func(o *Options) {
+		tmdb.SetRetries(attempts, base, jitter)
+	}
+}
+
+// WithTMDBSearchPages limits the pages of TMDB search results matched
+// against, of 20 results each, to n, or reads all of them when n is 0.
+// Like the response cache, this applies to all TMDB clients.
+func WithTMDBSearchPages(n int) Option {
+	return func(o *Options) {
+		tmdb.SetSearchPages(n)
+	}
+}
+
+// WithTargetTemplates replaces the default layouts of movie and episode
+// targets. A nil template keeps the default layout of its media type.
+func WithTargetTemplates(movie, episode *TargetTemplate) Option {
+	return func(o *Options) {
+		o.movieTarget = movie
+		o.episodeTarget = episode
+	}
+}
+
+// WithLogger sets the logger used to report problems that don't stop a
+// run, e.g. failed TMDB lookups. The default is slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// WithConcurrency sets the number of workers of both disk and network
+// bound work, see WithIOConcurrency and WithNetworkConcurrency.
+func WithConcurrency(n int) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.ioWorkers = n
+			WithNetworkConcurrency(n)(o)
+		}
+	}
+}
+
+// WithIOConcurrency sets the number of workers filtering and parsing the
+// files found in sources, which is bound by the disks.
+func WithIOConcurrency(n int) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.ioWorkers = n
+		}
+	}
+}
+
+// lowPriorityCopyRate is the bandwidth of copies in low priority mode,
+// unless a copy rate is given
+const lowPriorityCopyRate = 50_000_000
+
+// WithLowPriority keeps the disks available to other processes, e.g. a
+// media server streaming from them, by parsing files found in sources with
+// a single worker, and limiting copies to 50MB/s unless their bandwidth is
+// limited already, see WithBandwidth. It follows the options it overrides.
+// LowerPriority lowers the priority of the process itself.
+func WithLowPriority(low bool) Option {
+	return func(o *Options) {
+		if !low {
+			return
+		}
+		o.ioWorkers = 1
+		for _, l := range o.copyLimiters {
+			if l != nil {
+				return
+			}
+		}
+		o.copyLimiters = []*rate.Limiter{newRateLimiter(lowPriorityCopyRate)}
+	}
+}
+
+// WithNetworkConcurrency sets the number of workers looking files up on
+// TMDB, and of the TMDB requests sent at once. The TMDB rate limit applies
+// regardless. Like the response cache, this applies to all TMDB clients.
+func WithNetworkConcurrency(n int) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.netWorkers = n
+			tmdb.SetWorkers(n)
+		}
+	}
+}
+
+// WithHooks sets the hooks fetching movie trailers and series theme music,
+// see Link.Enrich. A nil hook is not run.
+func WithHooks(trailer, theme *Hook) Option {
+	return func(o *Options) {
+		o.trailerHook = trailer
+		o.themeHook = theme
+	}
+}
+
+// WithCollectionSets enables writing the information and artwork of the
+// TMDB collections of movies, see Link.CollectionSet.
+func WithCollectionSets(enabled bool) Option {
+	return func(o *Options) {
+		o.collectionSets = enabled
+	}
+}
+
+// WithCollectionFolders nests movies of a TMDB collection under a folder
+// of the collection, e.g. movies/James Bond Collection/Goldfinger (1964),
+// in the default layout. Target templates get it as {{.Collection}}.
+func WithCollectionFolders(enabled bool) Option {
+	return func(o *Options) {
+		o.collectionDirs = enabled
+	}
+}
+
+// WithNFO enables writing Kodi NFOs next to targets, see Link.NFO, with
+// the rating of the given source. IMDb ratings are looked up on OMDb with
+// omdbKey.
+func WithNFO(enabled bool, ratings RatingSource, omdbKey string) Option {
+	return func(o *Options) {
+		o.nfo = enabled
+		o.ratingSource = ratings
+		o.omdbKey = omdbKey
+	}
+}
+
+// WithActorThumbs enables placing thumbnails of the cast in Kodi .actors
+// folders when writing NFOs, see Link.NFO.
+func WithActorThumbs(enabled bool) Option {
+	return func(o *Options) {
+		o.actorThumbs = enabled
+	}
+}
+
+// WithArtwork enables placing posters next to targets, see Link.Artwork.
+func WithArtwork(enabled bool) Option {
+	return func(o *Options) {
+		o.artwork = enabled
+	}
+}
+
+// WithLinkMode sets the strategy used to create targets: hard linking,
+// copying or moving the source.
+func WithLinkMode(mode LinkMode) Option {
+	return func(o *Options) {
+		o.linkMode = mode
+	}
+}
+
+// WithCrossDeviceFallback copies sources that can't be hard linked because
+// they're on a different filesystem than the destination, instead of
+// skipping them.
+func WithCrossDeviceFallback(enabled bool) Option {
+	return func(o *Options) {
+		o.copyFallback = enabled
+	}
+}
+
+// WithEpisodePadding sets the minimum number of digits episode numbers are
+// zero padded to in targets, regardless of the padding of the source.
+func WithEpisodePadding(width int) Option {
+	return func(o *Options) {
+		if width < 1 {
+			return
+		}
+		o.episodePadding = width
+	}
+}
+
+// WithFinderTags applies Finder tags to created targets on macOS, so
+// they're identifiable as managed by kourai. Hard links share their
+// extended attributes with the source, which is tagged as well.
+func WithFinderTags(tags []string) Option {
+	return func(o *Options) {
+		o.finderTags = tags
+	}
+}
+
+// WithOnly limits results to media matching the selectors. Selectors are
+// evaluated against the names parsed from paths, before the TMDB lookup,
+// so that media that isn't selected costs no TMDB requests.
+func WithOnly(selectors []Selector) Option {
+	f := &selectorFilter{map[string][]Selector{}}
+	for _, s := range selectors {
+		f.fields[s.field] = append(f.fields[s.field], s)
+	}
+	return func(o *Options) {
+		if len(selectors) == 0 {
+			o.only = nil
+			return
+		}
+		o.only = f
+	}
+}
+
+// WithCountryFilter excludes media originating from or produced in any of
+// the countries, given by ISO 3166-1 code, e.g. "US". Countries are looked
+// up on TMDB after the media.
 func WithCountryFilter(codes []string) Option {
 	f := countryFilter{map[string]bool{}}
 	for _, code := range codes {
 		f.countries[strings.ToLower(code)] = true
 	}
 	return func(o *Options) {
-		o.mediaFilters = append(o.mediaFilters, f)
+		if len(codes) > 0 {
+			o.mediaFilters = append(o.mediaFilters, f)
+		}
+	}
+}
+
+// WithCompanyFilter excludes media made by any of the excluded production
+// companies and, unless included is empty, media made by none of the
+// included ones. Companies are given by name, compared without case, or by
+// TMDB ID, and looked up on TMDB after the media. Media that can't be
+// looked up are only excluded when companies are included.
+func WithCompanyFilter(excluded, included []string) Option {
+	f := newCompanyFilter(false, excluded, included)
+	return func(o *Options) {
+		if len(excluded)+len(included) > 0 {
+			o.mediaFilters = append(o.mediaFilters, f)
+		}
+	}
+}
+
+// WithNetworkFilter filters series by the TV networks that air them, like
+// WithCompanyFilter does by production companies. Movies aren't filtered.
+func WithNetworkFilter(excluded, included []string) Option {
+	f := newCompanyFilter(true, excluded, included)
+	return func(o *Options) {
+		if len(excluded)+len(included) > 0 {
+			o.mediaFilters = append(o.mediaFilters, f)
+		}
 	}
 }
 
 type episode struct {
-	series  string
-	title   string
-	id      string
-	season  int
-	episode int
-	year    int
-	path    string
-	tmdbID  int
+	series   string
+	title    string
+	id       string
+	season   int
+	episode  int
+	year     int
+	path     string
+	tmdbID   int
+	external externalID
+	// airDate identifies the episodes of daily shows, which are named
+	// after it instead of their season and episode
+	airDate time.Time
+	// released is the year the series first aired, as given by the
+	// metadata provider, or 0 when it wasn't looked up
+	released int
+	// absolute is the number of the episode counted across seasons, for
+	// absolutely numbered episodes, or 0
+	absolute int
+	quality  quality
+	// confidence is that of the series found by searching for it, or 0
+	// when it wasn't searched for
+	confidence float64
+	// matchedBy is how the series was found, one of the MatchedBy
+	// constants, or empty when it wasn't looked up
+	matchedBy string
+	// extra is the Plex folder of the extras the file is one of, e.g.
+	// Deleted Scenes, or empty for the episode itself
+	extra string
+	// info is probed from the file, see WithProbe
+	info MediaInfo
+}
+
+// externalID is the ID of media at another provider, as tagged in its name
+type externalID struct {
+	// source is the TMDB name of the provider, e.g. tmdb.SourceIMDb
+	source string
+	id     string
+}
+
+// providerIDs removes the provider ID tags from name, setting the TMDB ID
+// or external ID they give unless they're set already, so that tagged
+// media is looked up by ID instead of searched for. A TMDB ID is preferred
+// to other IDs.
+func providerIDs(name string, tmdbID *int, external *externalID) string {
+	for _, m := range providerIDExpr.FindAllStringSubmatch(name, -1) {
+		switch id := m[2]; strings.ToLower(m[1]) {
+		case "tmdb":
+			if n, err := strconv.Atoi(id); err == nil && *tmdbID == 0 {
+				*tmdbID = n
+			}
+		case "imdb":
+			if strings.HasPrefix(id, "tt") && external.source == "" {
+				*external = externalID{tmdb.SourceIMDb, id}
+			}
+		case "tvdb":
+			if !strings.HasPrefix(id, "tt") && external.source == "" {
+				*external = externalID{tmdb.SourceTVDB, id}
+			}
+		}
+	}
+	return providerIDExpr.ReplaceAllString(name, "")
 }
 
 func (e *episode) Path() string {
 	return e.path
 }
 
-func (e *episode) Target() string {
+// fields returns the values of e available to target templates
+func (e *episode) fields() TargetFields {
 	var season string
 	if e.season == 0 {
 		season = "Specials"
@@ -150,19 +651,74 @@ func (e *episode) Target() string {
 		season = fmt.Sprintf("Season %d", e.season)
 	}
 
-	// format episode ID the way plex likes, including episode IDs
-	var ep string
-	eps := strings.Split(strings.ToLower(e.id), "e")
-	// Handle edge case episodes where multiple episodes are combined in a
-	// single file, e.g. s01e01e02, rendering it as S01E01-E02
-	if len(eps) > 2 {
-		s := eps[0]
-		first := strings.Trim(eps[1], "-")
-		last := strings.Trim(eps[len(eps)-1], "-")
-		ep = strings.ToUpper(fmt.Sprintf("%se%s-e%s", s, first, last))
+	// format episode ID the way plex likes, including episode IDs. Daily
+	// shows are named after the air date and filed by year
+	var ep, airDate string
+	if !e.airDate.IsZero() {
+		airDate = e.airDate.Format("2006-01-02")
+		ep = airDate
+		season = fmt.Sprintf("Season %d", e.airDate.Year())
 	} else {
-		ep = strings.ToUpper(e.id)
+		eps := strings.Split(strings.ToLower(e.id), "e")
+		first, errFirst := strconv.Atoi(strings.Trim(eps[1], "-"))
+		last, errLast := strconv.Atoi(strings.Trim(eps[len(eps)-1], "-"))
+		if errFirst != nil || errLast != nil {
+			ep = strings.ToUpper(e.id)
+		} else {
+			w := options.episodePadding
+			ep = fmt.Sprintf("S%02dE%0*d", e.season, w, first)
+			// Handle edge case episodes where multiple episodes are combined in a
+			// single file, e.g. s01e01e02, rendering it as S01E01-E02
+			if len(eps) > 2 {
+				ep += fmt.Sprintf("-E%0*d", w, last)
+			}
+		}
+	}
+	return TargetFields{
+		Type:         TypeEpisode,
+		Title:        segmentTitle(e.title),
+		Series:       e.series,
+		Year:         e.year,
+		Season:       e.season,
+		SeasonFolder: season,
+		EpisodeID:    ep,
+		Episode:      e.episode,
+		AirDate:      airDate,
+		TMDBID:       e.tmdbID,
+		Decade:       decade(releaseYear(e)),
+		Resolution:   e.quality.resolution,
+		Source:       e.quality.source,
+		Codec:        e.quality.codec,
+		Group:        e.quality.group,
+		Quality:      e.quality.String(),
+		Ext:          filepath.Ext(e.path),
+		Filename:     filepath.Base(e.path),
+		Duration:     e.info.Duration,
+		Width:        e.info.Width,
+		Height:       e.info.Height,
+		VideoCodec:   e.info.VideoCodec,
+		AudioCodec:   e.info.AudioCodec,
 	}
+}
+
+func (e *episode) Target() string {
+	if e.extra != "" {
+		return options.targetCase.apply(extraTarget(e.target(), e.extra, e.path))
+	}
+	return options.targetCase.apply(e.target())
+}
+
+// target returns the target of the episode itself
+func (e *episode) target() string {
+	f := e.fields()
+	if options.episodeTarget != nil {
+		target, err := options.episodeTarget.render(f)
+		if err == nil {
+			return target
+		}
+		options.logger.Warn("target template failed, using the default layout", "path", e.path, "error", err)
+	}
+	season, ep := f.SeasonFolder, f.EpisodeID
 
 	var series string
 	if e.year != 0 {
@@ -172,10 +728,10 @@ func (e *episode) Target() string {
 	}
 
 	var target string
-	dir := fmt.Sprintf("tv/%s/%s", series, season)
+	dir := fmt.Sprintf("tv/%s/%s", shardDir(series), season)
 	ext := filepath.Ext(e.path)
-	if e.title != "" {
-		target = fmt.Sprintf("%s/%s - %s - %s%s", dir, series, ep, e.title, ext)
+	if f.Title != "" {
+		target = fmt.Sprintf("%s/%s - %s - %s%s", dir, series, ep, f.Title, ext)
 	} else {
 		target = fmt.Sprintf("%s/%s - %s%s", dir, series, ep, ext)
 	}
@@ -188,11 +744,41 @@ func EpisodeFromPath(path string) (*episode, error) {
 	var title [2]int
 	var series [2]int
 
-	_, file := filepath.Split(path)
+	dir, file := filepath.Split(path)
 	ext := filepath.Ext(file)
-	basename := file[:len(file)-len(ext)]
-
-	if locs := episodeExpr.FindStringSubmatchIndex(basename); locs != nil {
+	// Tags are those of the series, which are usually on its folder, maybe
+	// above a season folder, rather than on its episodes
+	dir = filepath.Dir(dir)
+	providerIDs(filepath.Base(dir), &ep.tmdbID, &ep.external)
+	providerIDs(filepath.Base(filepath.Dir(dir)), &ep.tmdbID, &ep.external)
+	basename := providerIDs(file[:len(file)-len(ext)], &ep.tmdbID, &ep.external)
+	// Season packs are tagged on the folder of their episodes
+	ep.quality = parseQuality(basename).or(parseQuality(filepath.Base(filepath.Dir(path))))
+
+	if episodeExpr.FindStringIndex(basename) == nil && crossExpr.FindStringIndex(basename) == nil {
+		if loc := animeExpr.FindStringSubmatchIndex(basename); loc != nil {
+			return ep, ep.setAbsolute(basename, loc)
+		}
+		if loc := airDateExpr.FindStringSubmatchIndex(basename); loc != nil {
+			return ep, ep.setAirDate(basename, loc)
+		}
+	}
+	basename = stripReleaseTags(basename)
+	if locs := episodeExpr.FindStringSubmatchIndex(basename); locs == nil {
+		if locs := crossExpr.FindStringSubmatchIndex(basename); locs != nil {
+			// NxNN IDs are rewritten as SxxEyy IDs, e.g. 1x01-1x02 as s1e01e02
+			ep.id = "s" + basename[locs[2]:locs[3]] + "e" + basename[locs[4]:locs[5]]
+			for _, m := range crossNext.FindAllStringSubmatch(basename[locs[6]:locs[7]], -1) {
+				ep.id += "e" + m[1]
+			}
+			title[0] = locs[1] + 1
+			if locs[0] > 0 {
+				series[1] = locs[0] - 1
+			}
+		} else {
+			return ep, fmt.Errorf("%w given path \"%s\"; expression %v", ErrNoEpisodeID, basename, episodeExpr)
+		}
+	} else {
 		// This is probably not more efficient than using regexp.Replace to
 		// strip out unwanted characters from the full match
 		// Step through subexpression matches to build an ID that only contains
@@ -212,8 +798,6 @@ func EpisodeFromPath(path string) (*episode, error) {
 		if start > 0 {
 			series[1] = start - 1
 		}
-	} else {
-		return ep, fmt.Errorf("could not determine episode ID given path \"%s\"; expression %v", basename, episodeExpr)
 	}
 
 	if s, err := strconv.Atoi(seasonExpr.FindString(ep.id)[1:]); err != nil {
@@ -230,14 +814,13 @@ func EpisodeFromPath(path string) (*episode, error) {
 	}
 
 	title[1] = len(basename)
-	if loc := dateExpr.FindStringIndex(basename); loc != nil {
-		date := basename[loc[0]:loc[1]]
-		year, _, _ := strings.Cut(date, "-")
-		var err error
-		ep.year, err = strconv.Atoi(year)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("could not parse episode year with error %w", err))
-		}
+	// Years after the episode ID are part of the episode title
+	name := basename
+	if series[1] > 0 {
+		name = basename[:series[1]]
+	}
+	if year, loc := findYear(name); loc != nil {
+		ep.year = year
 		// If a date is given, it will come after the series name.
 		// The end index of the series is updated to the index before the
 		// beginning of the date match
@@ -266,26 +849,139 @@ func EpisodeFromPath(path string) (*episode, error) {
 	return ep, errors.Join(errs...)
 }
 
+// setAirDate parses the episode of a daily show from basename, given the
+// location of its air date in it, with the series name before the date and
+// the title after it. Until it's looked up, the episode is in the season of
+// its year, as the default layout files it.
+func (e *episode) setAirDate(basename string, loc []int) error {
+	date, err := parseAirDate(basename, loc)
+	if err != nil {
+		return err
+	}
+	e.airDate = date
+	e.id = date.Format("2006-01-02")
+	e.season = date.Year()
+
+	title := basename[loc[1]:]
+	if s := sentinelExpr.FindStringIndex(title); s != nil {
+		title = title[:s[0]]
+	}
+	e.title = makeTitle(title)
+	e.series = makeTitle(basename[:loc[0]])
+	if e.series == "" {
+		return fmt.Errorf("%w: could not determine the series of \"%s\"", ErrNoTitle, basename)
+	}
+	return nil
+}
+
+// parseAirDate parses the air date of basename, given the location of the
+// submatches of airDateExpr in it
+func parseAirDate(basename string, loc []int) (time.Time, error) {
+	var ymd [3]int
+	for i := range ymd {
+		ymd[i], _ = strconv.Atoi(basename[loc[2+2*i]:loc[3+2*i]])
+	}
+	date := time.Date(ymd[0], time.Month(ymd[1]), ymd[2], 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(ymd[1]) || date.Day() != ymd[2] {
+		return time.Time{}, fmt.Errorf("invalid air date %q in \"%s\"", basename[loc[0]:loc[1]], basename)
+	}
+	return date, nil
+}
+
 type movie struct {
-	title  string
-	year   int
-	path   string
-	tmdbID int
+	title    string
+	year     int
+	path     string
+	tmdbID   int
+	external externalID
+	// collection is the name of the TMDB collection of the movie, when
+	// collection folders are enabled
+	collection string
+	// released is the release year given by the metadata provider, or 0
+	// when it wasn't looked up
+	released int
+	// edition is the edition of the movie named in its path, e.g.
+	// Director's Cut
+	edition string
+	quality quality
+	// confidence is that of the best search result for the movie, or 0
+	// when it wasn't searched for
+	confidence float64
+	// matchedBy is how the movie was found, one of the MatchedBy
+	// constants, or empty when it wasn't looked up
+	matchedBy string
+	// extra is the Plex folder of the extras the file is one of, e.g.
+	// Trailers, or empty for the movie itself
+	extra string
+	// info is probed from the file, see WithProbe
+	info MediaInfo
+	// fileYear is the year of the name when it was corrected to the
+	// release year of the match, or 0, see correctYear
+	fileYear int
 }
 
 func (m *movie) Path() string {
 	return m.path
 }
 
+// fields returns the values of m available to target templates
+func (m *movie) fields() TargetFields {
+	f := TargetFields{
+		Type:       TypeMovie,
+		Title:      m.title,
+		TMDBID:     m.tmdbID,
+		Collection: setNameReplacer.Replace(m.collection),
+		Edition:    m.edition,
+		Resolution: m.quality.resolution,
+		Source:     m.quality.source,
+		Codec:      m.quality.codec,
+		Group:      m.quality.group,
+		Quality:    m.quality.String(),
+		Decade:     decade(releaseYear(m)),
+		Ext:        filepath.Ext(m.path),
+		Filename:   filepath.Base(m.path),
+		Duration:   m.info.Duration,
+		Width:      m.info.Width,
+		Height:     m.info.Height,
+		VideoCodec: m.info.VideoCodec,
+		AudioCodec: m.info.AudioCodec,
+	}
+	if m.YearValid() {
+		f.Year = m.year
+	}
+	return f
+}
+
 func (m *movie) Target() string {
+	if m.extra != "" {
+		return options.targetCase.apply(extraTarget(m.target(), m.extra, m.path))
+	}
+	return options.targetCase.apply(m.target())
+}
+
+// target returns the target of the movie itself
+func (m *movie) target() string {
 	_, file := filepath.Split(m.path)
+	if options.movieTarget != nil {
+		target, err := options.movieTarget.render(m.fields())
+		if err == nil {
+			return target
+		}
+		options.logger.Warn("target template failed, using the default layout", "path", m.path, "error", err)
+	}
 	var dir string
 	if m.YearValid() {
 		dir = fmt.Sprintf("%s (%d)", m.title, m.year)
 	} else {
 		dir = m.title
 	}
-	return fmt.Sprintf("movies/%s/%s", dir, file)
+	if m.edition != "" {
+		dir = fmt.Sprintf("%s {edition-%s}", dir, m.edition)
+	}
+	if m.collection != "" {
+		dir = setNameReplacer.Replace(m.collection) + "/" + dir
+	}
+	return fmt.Sprintf("movies/%s/%s", shardDir(dir), file)
 }
 
 func (m *movie) YearValid() bool {
@@ -299,17 +995,27 @@ func MovieFromPath(path string) (*movie, error) {
 	dir, file := filepath.Split(path)
 	dir = filepath.Base(dir)
 	ext := filepath.Ext(file)
-	basename := file[:len(file)-len(ext)]
+	basename := stripReleaseTags(file[:len(file)-len(ext)])
+	q := parseQuality(file[:len(file)-len(ext)]).or(parseQuality(dir))
+
+	var tmdbID int
+	var external externalID
+	basename = providerIDs(basename, &tmdbID, &external)
+	dir = providerIDs(dir, &tmdbID, &external)
+	edition, basename := parseEdition(basename)
+	if edition == "" {
+		edition, dir = parseEdition(dir)
+	} else {
+		_, dir = parseEdition(dir)
+	}
+	for _, m := range movies {
+		m.tmdbID, m.external, m.edition, m.quality = tmdbID, external, edition, q
+	}
 
 	for i, j := range [2]string{basename, dir} {
 		end := len(j)
-		dateLoc := dateExpr.FindStringIndex(j)
+		year, dateLoc := findYear(j)
 		if dateLoc != nil {
-			year, err := strconv.Atoi(j[dateLoc[0]:dateLoc[1]])
-			if err != nil {
-				// TODO: log, if the regexp matched, it should parse
-				continue
-			}
 			if year < oldestMovieYear {
 				// TODO: log something here
 				continue
@@ -327,7 +1033,7 @@ func MovieFromPath(path string) (*movie, error) {
 		movies[i].title = title
 	}
 	if movies[0].title == "" && movies[1].title == "" {
-		return &movie{}, fmt.Errorf("failed to create movie from path %v", path)
+		return &movie{}, fmt.Errorf("%w: failed to create movie from path %v", ErrNoTitle, path)
 	}
 	for _, m := range movies {
 		if m.title != "" && m.YearValid() {
@@ -339,7 +1045,7 @@ func MovieFromPath(path string) (*movie, error) {
 			return m, nil
 		}
 	}
-	return &movie{}, fmt.Errorf("could not determine movie from %v; parsed values %v", path, movies)
+	return &movie{}, fmt.Errorf("%w: could not determine movie from %v; parsed values %v", ErrNoTitle, path, movies)
 }
 
 type Linkable interface {
@@ -347,45 +1053,190 @@ type Linkable interface {
 	Target() string
 }
 
+// NewLinkable parses the movie or episode at path. Extras, e.g. trailers,
+// are parsed as the movie or episode they belong to, and linked into the
+// extras folders next to it.
 func NewLinkable(path string) (Linkable, error) {
-	var l Linkable
-	var err error
-
-	if episodeExpr.FindString(path) != "" {
-		l, err = EpisodeFromPath(path)
-	} else {
-		l, err = MovieFromPath(path)
+	extra, parent := parseExtra(path)
+	if detectType(parent) == TypeEpisode {
+		e, err := EpisodeFromPath(parent)
+		e.path, e.extra = path, extra
+		return e, err
 	}
-	return l, err
+	m, err := MovieFromPath(parent)
+	m.path, m.extra = path, extra
+	return m, err
 }
 
-func tmdbLookup(l Linkable) {
+// lookup names l after what p finds, keeping the names parsed from its path
+// when p finds nothing.
+func lookup(ctx context.Context, p MetadataProvider, l Linkable) {
 	switch v := l.(type) {
 	case *episode:
-		ep, show, err := options.TMDBClient.SearchEpisode(v.series, v.year, v.season, v.episode)
+		// Provider ID tags are exact, aliases were confirmed by the user, and
+		// both spare the search
+		if ids, ok := p.(IDProvider); ok {
+			id, ok := v.tmdbID, v.tmdbID != 0
+			by := MatchedByIDTag
+			if !ok {
+				id, ok = findExternal(ctx, ids, v.path, v.external, true)
+			}
+			if !ok {
+				id, ok = options.aliases.Lookup(AliasSeries, v.series, v.year)
+				by = MatchedByCache
+			}
+			if ok {
+				show, err := ids.SeriesByID(ctx, id)
+				if err != nil {
+					options.logger.Warn("lookup of series by ID failed", "path", v.path, "id", id, "error", err)
+					options.events.failed(v.path, err)
+					return
+				}
+				// IDs read from an NFO were matched by it
+				if v.matchedBy == "" {
+					v.matchedBy = by
+				}
+				v.setSeries(ctx, p, show)
+				return
+			}
+		}
+		show, err := searchSeries(ctx, p, v)
+		if errors.Is(err, errNoChoice) {
+			return
+		}
 		if err != nil {
+			if ctx.Err() == nil {
+				options.logger.Warn("lookup failed", "path", v.path, "series", v.series, "error", err)
+				options.events.failed(v.path, err)
+			}
 			return
 		}
-		v.series = show.Name
-		v.title = ep.Name
+		v.confidence = show.Confidence
+		if show.Confidence < options.minConfidence {
+			options.logger.Warn("low-confidence match, using the name parsed from the path", "path", v.path, "series", v.series, "match", show.Name, "confidence", show.Confidence)
+			return
+		}
+		v.matchedBy = MatchedBySearch
+		v.setSeries(ctx, p, show)
 	case *movie:
+		if ids, ok := p.(IDProvider); ok {
+			id, ok := v.tmdbID, v.tmdbID != 0
+			by := MatchedByIDTag
+			if !ok {
+				id, ok = findExternal(ctx, ids, v.path, v.external, false)
+			}
+			if !ok {
+				id, ok = options.aliases.Lookup(AliasMovie, v.title, v.year)
+				by = MatchedByCache
+			}
+			if ok {
+				res, err := ids.MovieByID(ctx, id)
+				if err != nil {
+					options.logger.Warn("lookup of movie by ID failed", "path", v.path, "id", id, "error", err)
+					options.events.failed(v.path, err)
+					return
+				}
+				if v.matchedBy == "" {
+					v.matchedBy = by
+				}
+				v.title, v.year, v.tmdbID = res.Title, res.Year, id
+				v.released = res.Year
+				return
+			}
+		}
 		for _, i := range titlePermutations(v.title) {
-			var searchOpts map[string]string
+			var year int
 			if v.YearValid() {
-				searchOpts = map[string]string{"year": fmt.Sprint(v.year)}
+				year = v.year
+			}
+			res, err := searchMovie(ctx, p, v, i, year)
+			if ctx.Err() != nil || errors.Is(err, errNoChoice) {
+				return
 			}
-			res, err := options.TMDBClient.SearchMovie(i, searchOpts)
 			if err != nil {
-				fmt.Println(err)
+				options.logger.Debug("search failed", "path", v.path, "query", i, "error", err)
+				continue
+			}
+			v.confidence = max(v.confidence, res.Confidence)
+			if res.Confidence < options.minConfidence {
+				options.logger.Debug("low-confidence match", "path", v.path, "query", i, "match", res.Title, "confidence", res.Confidence)
 				continue
 			}
+			v.confidence = res.Confidence
+			v.matchedBy = MatchedBySearch
 			v.title = res.Title
+			v.released = res.Year
 			if !v.YearValid() {
-				v.year = res.ReleaseDate.Year()
+				v.year = res.Year
+			} else {
+				v.correctYear(res.Year)
+			}
+			if res.TMDBID != 0 {
+				v.tmdbID = res.TMDBID
 			}
 			return
 		}
+		options.logger.Warn("no match, using the name parsed from the path", "path", v.path, "title", v.title)
+	}
+}
+
+// setSeries names e after show, and its episode as p knows it
+func (e *episode) setSeries(ctx context.Context, p MetadataProvider, show SeriesMetadata) {
+	e.series = show.Name
+	e.released = show.Year
+	if show.TMDBID != 0 {
+		e.tmdbID = show.TMDBID
+	}
+	if !e.airDate.IsZero() {
+		e.setEpisodeByAirDate(ctx, p, show)
+		return
+	}
+	if e.absolute != 0 {
+		e.setEpisodeByAbsolute(ctx, p, show)
+		return
+	}
+	e.setSegments(ctx, p, show)
+}
+
+// setEpisodeByAirDate names e, an episode of a daily show, after the episode
+// of show that aired on its air date, and numbers it as p does. Providers
+// that aren't AirDateProviders leave it named after its path.
+func (e *episode) setEpisodeByAirDate(ctx context.Context, p MetadataProvider, show SeriesMetadata) {
+	dp, ok := p.(AirDateProvider)
+	if !ok {
+		return
+	}
+	ep, err := dp.EpisodeByAirDate(ctx, show, e.airDate)
+	if err != nil {
+		if ctx.Err() == nil {
+			options.logger.Debug("episode lookup by air date failed", "path", e.path, "series", e.series, "error", err)
+		}
+		return
+	}
+	if ep.Title != "" {
+		e.title = ep.Title
+	}
+	e.season, e.episode = ep.Season, ep.Episode
+}
+
+// findExternal looks up the TMDB ID of the series or movie at path, tagged
+// with an external ID, reporting whether p knows the ID. Episode IDs give
+// the ID of their series.
+func findExternal(ctx context.Context, p IDProvider, path string, ext externalID, series bool) (int, bool) {
+	if ext.source == "" {
+		return 0, false
+	}
+	id, err := p.FindTMDBID(ctx, ext.source, ext.id, series)
+	if err != nil {
+		if ctx.Err() == nil {
+			options.logger.Warn("lookup of external ID failed", "path", path, "id", ext.id, "error", err)
+		}
+		return 0, false
+	}
+	if id == 0 {
+		options.logger.Debug("no match of external ID, searching by name", "path", path, "id", ext.id)
 	}
+	return id, id != 0
 }
 
 // TODO: This could be a little more sophisticated
@@ -440,6 +1291,30 @@ func permutation(str string) []string {
 type Link struct {
 	Src    string
 	Target string
+	Mode   LinkMode
+	perms  *Permissions
+	tags   []string
+
+	// copyFallback copies Src when it can't be hard linked across devices
+	copyFallback bool
+	// artwork places posters next to the target, see Artwork
+	artwork bool
+	media   Linkable
+	// trailerHook and themeHook fetch extras, see Enrich
+	trailerHook *Hook
+	themeHook   *Hook
+	// setsDir holds movie set information, see CollectionSet
+	setsDir string
+	nfo     bool
+	// actorThumbs places cast thumbnails along NFOs, see NFO
+	actorThumbs bool
+	// state records the source once the target is created
+	state *StateDB
+}
+
+// Media returns the media of the source of ln.
+func (ln Link) Media() Linkable {
+	return ln.media
 }
 
 func (ln Link) Exists() bool {
@@ -447,26 +1322,161 @@ func (ln Link) Exists() bool {
 	return !os.IsNotExist(err)
 }
 
-func (ln Link) Create() {
+// Create creates the target of ln from its source, according to its mode.
+// When its permissions or tags can't be applied, the target is removed
+// again, or moved back to the source in move mode. Creates of targets in
+// the same directory are serialized, so that only one of several links to
+// the same target succeeds. The events of WithEvents are told of the
+// outcome.
+func (ln Link) Create() error {
+	if err := ln.create(); err != nil {
+		options.events.failed(ln.Src, err)
+		return err
+	}
+	options.events.created(ln)
+	return nil
+}
+
+func (ln Link) create() error {
+	if err := checkLeases(ln.Target); err != nil {
+		return err
+	}
+	defer lockDir(filepath.Dir(ln.Target))()
+	// Hard links fail on existing targets by themselves, while copies and
+	// moves would replace them
+	if ln.Mode != ModeHardlink && ln.Mode != "" && ln.Exists() {
+		return fmt.Errorf("%w: %v", ErrTargetExists, ln.Target)
+	}
+
+	if err := ln.perms.mkdirAll(filepath.Dir(ln.Target)); err != nil {
+		return fmt.Errorf("error %w encountered when creating path for %v", err, ln.Target)
+	}
+
+	// Moves take the source away, so it's identified beforehand
+	var src fs.FileInfo
+	if ln.state != nil {
+		src, _ = os.Stat(ln.Src)
+	}
+	if err := ln.transfer(); errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %v", ErrTargetExists, ln.Target)
+	} else if err != nil {
+		return fmt.Errorf("error %w encountered when creating %v", err, ln)
+	}
+	if err := ln.applyAttributes(); err != nil {
+		// Callers only journal targets that were created successfully, so
+		// none may be left behind
+		undo := os.Remove(ln.Target)
+		if ln.Mode == ModeMove {
+			undo = movePath(ln.Target, ln.Src)
+		}
+		return errors.Join(err, undo)
+	}
+	if src != nil {
+		if err := ln.state.recordLink(ln, src); err != nil {
+			options.logger.Warn("failed to record the state of the source", "path", ln.Src, "error", err)
+		}
+	}
+	return nil
+}
+
+// applyAttributes applies the permissions and Finder tags of ln to its
+// target.
+func (ln Link) applyAttributes() error {
+	if err := ln.perms.applyFile(ln.Target); err != nil {
+		return fmt.Errorf("error %w encountered when setting permissions for %v", err, ln.Target)
+	}
+	if len(ln.tags) > 0 {
+		if err := setFinderTags(ln.Target, ln.tags); err != nil {
+			return fmt.Errorf("error %w encountered when tagging %v", err, ln.Target)
+		}
+	}
+	return nil
+}
+
+// Rename moves the source to the target instead of linking it, for
+// normalizing names inside an existing library. Both need to be on the same
+// filesystem.
+func (ln Link) Rename() error {
+	if filepath.Clean(ln.Src) == filepath.Clean(ln.Target) {
+		return nil
+	}
+	if err := checkLeases(ln.Target); err != nil {
+		return err
+	}
+	defer lockDir(filepath.Dir(ln.Target))()
 	if ln.Exists() {
-		fmt.Printf("target %v already exists\n", ln.Target)
-		return
+		return fmt.Errorf("%w: %v", ErrTargetExists, ln.Target)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(ln.Target), 0755); err != nil {
-		fmt.Printf("error %v encountered when creating path for %v\n", err, ln.Target)
-		return
+	if err := ln.perms.mkdirAll(filepath.Dir(ln.Target)); err != nil {
+		return fmt.Errorf("error %w encountered when creating path for %v", err, ln.Target)
+	}
+
+	if err := os.Rename(ln.Src, ln.Target); err != nil {
+		return fmt.Errorf("error %w encountered when renaming %v", err, ln)
 	}
+	if err := ln.applyAttributes(); err != nil {
+		return errors.Join(err, os.Rename(ln.Target, ln.Src))
+	}
+	return nil
+}
 
-	if err := os.Link(ln.Src, ln.Target); err != nil {
-		fmt.Printf("error %v encountered when creating link for %v\n", err, ln)
+// RemoveEmptyDirs removes directories below root that are left without any
+// entries, e.g. after their contents were renamed elsewhere. Root itself is
+// kept.
+func RemoveEmptyDirs(root string) error {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Children are visited after their parents, so walking the list in
+	// reverse empties the deepest directories first
+	var errs []error
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
 
 func LinkFromMedia(l Linkable, destdir string) Link {
 	ln := Link{
 		Src:    l.Path(),
-		Target: path.Join(destdir, l.Target()),
+		Target: path.Join(destdir, existingDirs(destdir, l.Target())),
+		Mode:   options.linkMode,
+		perms:  options.permissions,
+		tags:   options.finderTags,
+
+		copyFallback: options.copyFallback,
+		artwork:      options.artwork,
+		media:        l,
+		trailerHook:  options.trailerHook,
+		themeHook:    options.themeHook,
+		nfo:          options.nfo,
+		actorThumbs:  options.actorThumbs,
+		state:        options.state,
+	}
+	if options.collectionSets {
+		ln.setsDir = path.Join(destdir, SetsDir)
 	}
 	return ln
 }
@@ -478,24 +1488,59 @@ func makeTitle(s string) string {
 	if options.SkipTitleCaser {
 		return t
 	} else {
-		return cases.Title(language.AmericanEnglish, cases.NoLower).String(t)
+		return titleCase(t)
 	}
 }
 
-func findFiles(root string, filters ...fileFilter) (<-chan Linkable, <-chan error) {
+// findFiles walks root, sending the media files not excluded by filters.
+// Files are filtered and parsed by options.ioWorkers workers. errc
+// receives the error of the walk after the channel of media is closed, or
+// ctx.Err() when the walk was stopped by ctx.
+func findFiles(ctx context.Context, root string, filters ...fileFilter) (<-chan Linkable, <-chan error) {
 	c := make(chan Linkable)
 	errc := make(chan error, 1)
-	if _, err := os.Stat(root); err != nil {
+	if _, err := options.fs.Stat(root); err != nil {
 		close(c)
 		errc <- fmt.Errorf("failed to stat %s with error %s", root, err)
 		return c, errc
 	}
+
+	type file struct {
+		path string
+		info fs.FileInfo
+	}
+	files := make(chan file)
+	var wg sync.WaitGroup
+	for i := 0; i < options.ioWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				m, ok := mediaFromFile(ctx, f.path, f.info, filters)
+				if !ok {
+					continue
+				}
+				select {
+				case c <- m:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
 	go func() {
-		var wg sync.WaitGroup
-		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		err := options.fs.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// A directory that can't be listed is skipped, and reported
+			// with the files that can't be read
+			if err != nil {
+				return options.ioErrors.add(path, err)
+			}
 			var info fs.FileInfo
 			if i, err := d.Info(); err != nil {
-				return nil
+				return options.ioErrors.add(path, err)
 			} else {
 				info = i
 			}
@@ -503,124 +1548,264 @@ func findFiles(root string, filters ...fileFilter) (<-chan Linkable, <-chan erro
 			// If a directory matches an exclude filter, return to the
 			// WalkDirFunc to skip its children too
 			if d.IsDir() {
+				if ig, ok := options.ignores.match(path); ok {
+					skip(path, SkipIgnored, "directory ignored as "+ig.String())
+					return fs.SkipDir
+				}
 				for _, filter := range filters {
 					if filter.exclude(info) {
-						// TODO: debug logging
-						//slog.Debug("skipping directory", info)
-						//fmt.Println("skipping directory", path, "filter", filter)
+						options.logger.Debug("skipping directory", "path", path, "filter", fmt.Sprintf("%T", filter))
+						if _, ok := filter.(RegexpFilter); ok {
+							skip(path, SkipRegexp, "directory excluded by pattern")
+						}
 						return fs.SkipDir
 					}
 				}
 				return nil
 			}
+			if !d.Type().IsRegular() { // TODO: Handle symlinks?
+				return nil
+			}
 
-			// Non-directory files can be filtered concurrently
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				if !d.Type().IsRegular() { // TODO: Handle symlinks?
-					return
-				}
-				for _, filter := range filters {
-					if filter.exclude(info) {
-						return
-					}
-				}
-				m, err := NewLinkable(path)
-				if err != nil {
-					return
-				}
-				c <- m
-			}()
+			// Non-directory files are filtered by the workers
+			select {
+			case files <- file{path, info}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 			return nil
 		})
-		go func() {
-			wg.Wait()
-			close(c)
-		}()
+		close(files)
+		wg.Wait()
+		close(c)
 		errc <- err
 	}()
 	return c, errc
 }
 
-// TODO: accept done channel
-func LinkFromFiles(optionConfig ...Option) (<-chan Link, <-chan error) {
+// mediaFromFile parses the file at path, found as info, unless it's
+// excluded by filters or the options, reporting why it's skipped
+func mediaFromFile(ctx context.Context, path string, info fs.FileInfo, filters []fileFilter) (Linkable, bool) {
+	options.service.scan()
+	for _, filter := range filters {
+		if filter.exclude(info) {
+			switch f := filter.(type) {
+			case RegexpFilter:
+				skip(path, SkipRegexp, "excluded by pattern")
+			case fileSizeFilter:
+				if isVideo(path) {
+					skip(path, SkipSize, fmt.Sprintf("smaller than %d bytes", f.min))
+				}
+			case fileExtensionFilter:
+				switch ext := fileExt(path); options.extensionPolicies[ext] {
+				case PolicySkip:
+					skip(path, SkipExtension, "."+ext+" files are skipped")
+				case PolicyIgnore:
+				default:
+					if isVideo(path) {
+						skip(path, SkipExtension, "extension not included")
+					}
+				}
+			}
+			return nil, false
+		}
+	}
+	if ig, ok := options.ignores.match(path); ok {
+		skip(path, SkipIgnored, "ignored as "+ig.String())
+		return nil, false
+	}
+	if target, ok := options.state.processed(path, info); ok {
+		skip(path, SkipProcessed, "already linked to "+relTarget(target))
+		return nil, false
+	}
+	if options.skipLinked.linked(path, info) {
+		skip(path, SkipLinked, "already hard linked")
+		return nil, false
+	}
+	m, err := NewLinkable(path)
+	if err != nil {
+		skip(path, SkipUnparsed, "name could not be parsed")
+		return nil, false
+	}
+	if ext := fileExt(path); options.extensionPolicies[ext] == PolicyEpisode {
+		if _, ok := m.(*episode); !ok {
+			skip(path, SkipExtension, "."+ext+" files are only linked as episodes")
+			return nil, false
+		}
+	}
+	if options.settle > 0 && !settled(ctx, path, info) {
+		if ctx.Err() == nil {
+			options.logger.Info("skipping file still being written", "path", path)
+			skip(path, SkipUnsettled, "still being written")
+		}
+		return nil, false
+	}
+	if options.probe && isVideo(path) && !probe(ctx, path, m) {
+		return nil, false
+	}
+	options.events.parsed(m)
+	return m, true
+}
+
+// LinkFromFiles finds the media files in the configured sources and sends
+// a Link for each. Files are looked up on TMDB by options.netWorkers
+// workers. Scanning and TMDB lookups stop when ctx is cancelled, after which
+// the channel is closed; callers check ctx.Err() to tell a cancelled run
+// from a complete one. Invalid options are sent on the error channel, see
+// Options.Validate, and nothing is linked.
+func LinkFromFiles(ctx context.Context, optionConfig ...Option) (<-chan Link, <-chan error) {
 	options.SetOptions(optionConfig...)
 	linkc := make(chan Link)
 	errc := make(chan error, 1)
+	if err := options.Validate(); err != nil {
+		close(linkc)
+		errc <- fmt.Errorf("invalid options: %w", err)
+		return linkc, errc
+	}
+	if err := options.openState(); err != nil {
+		close(linkc)
+		errc <- err
+		return linkc, errc
+	}
 
+	mediac := findSources(ctx)
+	wg := sync.WaitGroup{}
+	for i := 0; i < options.netWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range mediac {
+				if ln, ok := linkFromMedia(ctx, m); ok {
+					for _, ln := range withSidecars(ln) {
+						select {
+						case linkc <- ln:
+						case <-ctx.Done():
+						}
+					}
+				}
+			}
+		}()
+	}
 	go func() {
-		wg := sync.WaitGroup{}
+		wg.Wait()
+		close(linkc)
+	}()
+	errc <- nil
+	return linkc, errc
+}
 
+// findSources returns the media found in each source in turn
+func findSources(ctx context.Context) <-chan Linkable {
+	mediac := make(chan Linkable)
+	go func() {
+		defer close(mediac)
 		for _, src := range options.sources {
-			media, errc := findFiles(src, options.fileFilters...)
-			if err := <-errc; err != nil {
-				fmt.Println(err)
-				continue
+			if ctx.Err() != nil {
+				return
 			}
+			media, errc := findFiles(ctx, src, options.fileFilters...)
 			for m := range media {
-				m := m
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					// type exclusion may be done before an expensive TMDBLookup call
-					// because the required properties are already set
-					switch m.(type) {
-					case *movie:
-						if _, ok := options.excludeTypes["movie"]; ok {
-							return
-						}
-					case *episode:
-						if _, ok := options.excludeTypes["episode"]; ok {
-							return
-						}
-					}
-					if options.TMDBClient != nil {
-						tmdbLookup(m)
-					} else {
-						fmt.Println("it's broken")
-					}
-					for _, filter := range options.mediaFilters {
-						if filter.exclude(m) {
-							return
-						}
-					}
-					linkc <- LinkFromMedia(m, options.dest)
-				}()
+				select {
+				case mediac <- m:
+				case <-ctx.Done():
+				}
+			}
+			if err := <-errc; err != nil && ctx.Err() == nil {
+				options.logger.Error("failed to scan source", "source", src, "error", err)
+				if errors.Is(err, ErrTooManyIOErrors) {
+					return
+				}
 			}
 		}
-		go func() {
-			wg.Wait()
-			close(linkc)
-		}()
 	}()
-	errc <- nil
-	return linkc, errc
+	return mediac
 }
 
-func Nlinks(d fs.DirEntry) (count uint64, err error) {
+// linkFromMedia looks up m and returns its Link, unless it is excluded
+func linkFromMedia(ctx context.Context, m Linkable) (Link, bool) {
+	if !matchMedia(ctx, m) {
+		return Link{}, false
+	}
+	ln := LinkFromMedia(m, options.destination(m))
+	options.events.matched(ln)
+	return ln, true
+}
+
+// matchMedia looks up m and reports whether it's linked, or excluded
+func matchMedia(ctx context.Context, m Linkable) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	// type exclusion may be done before an expensive TMDBLookup call
+	// because the required properties are already set
+	switch m.(type) {
+	case *movie:
+		if _, ok := options.excludeTypes["movie"]; ok {
+			skip(m.Path(), SkipType, "movies are excluded")
+			return false
+		}
+	case *episode:
+		if _, ok := options.excludeTypes["episode"]; ok {
+			skip(m.Path(), SkipType, "episodes are excluded")
+			return false
+		}
+	}
+	if options.only != nil && options.only.exclude(m) {
+		skip(m.Path(), SkipNotSelected, "not selected")
+		return false
+	}
+	if lookupLocal(m) {
+		options.logger.Debug("named after local metadata", "path", m.Path())
+	} else if p := options.metadataProvider(); p != nil {
+		lookup(ctx, p, m)
+	} else {
+		options.logger.Debug("no TMDB API key, using names parsed from the path", "path", m.Path())
+	}
+	if _, ok := unsure(m); ok && options.skipUnsure {
+		skip(m.Path(), SkipLowConfidence, "low-confidence match")
+		return false
+	}
+	if v, ok := m.(*movie); ok && options.collectionDirs {
+		v.setCollection(ctx)
+	}
+	var details *mediaDetails
+	var looked bool
+	detailsOf := func() *mediaDetails {
+		if !looked {
+			details, looked = lookupDetails(ctx, m), true
+		}
+		return details
+	}
+	for _, filter := range options.mediaFilters {
+		if filter.exclude(m, detailsOf) {
+			skip(m.Path(), SkipFilter, mediaFilterReason(filter))
+			return false
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// Nlinks returns the number of hard links of the file at path, as visited
+// by filepath.WalkDir with d. The whole path is needed on Windows, where
+// the file is opened to count them.
+func Nlinks(path string, d fs.DirEntry) (count uint64, err error) {
 	var info fs.FileInfo
 	info, err = d.Info()
 	if err != nil {
 		return
 	}
-	if sys := info.Sys(); sys != nil {
-		if stat, ok := sys.(*syscall.Stat_t); ok {
-			count = uint64(stat.Nlink)
-		}
-	}
-	if count == 0 {
-		err = fmt.Errorf("failed to determine number of links for file '%s'", d.Name())
+	_, _, count, err = fileIdentity(path, info)
+	if err == nil && count == 0 {
+		err = fmt.Errorf("failed to determine number of links for file '%s'", path)
 	}
 	return
 }
 
-func Search(key string, f string, options map[string]string) {
+func Search(key string, f string, searchOpts map[string]string) {
 	client := tmdb.New(key)
-	res, errc := client.SearchMovies(f, nil, options)
+	res, errc := client.SearchMovies(context.Background(), f, searchOpts)
 	if err := <-errc; err != nil {
-		// log
-		fmt.Print(err)
+		options.logger.Error("TMDB search failed", "query", f, "error", err)
 		return
 	}
 	for r := range res {
@@ -1,10 +1,18 @@
 package kourai
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -63,7 +71,7 @@ func TestFindFiles(t *testing.T) {
 		// The returned slice of Media items is sorted according to
 		// the order in which the file was visited.
 		got := sort.StringSlice{}
-		media, _ := findFiles(root, NewRegexpFilter(i.excludes))
+		media, _ := findFiles(context.Background(), root, NewRegexpFilter(i.excludes))
 		for m := range media {
 			// strip tmpdir prefix off of each path
 			got = append(got, m.Path()[len(root)+1:len(m.Path())])
@@ -88,9 +96,10 @@ func TestMovieFromPath(t *testing.T) {
 	}{{
 		path: "/foo/bar/Foobar/Foobar.1999.2160p.WEB-DL.mkv",
 		movie: &movie{
-			path:  "/foo/bar/Foobar/Foobar.1999.2160p.WEB-DL.mkv",
-			title: "Foobar",
-			year:  1999,
+			path:    "/foo/bar/Foobar/Foobar.1999.2160p.WEB-DL.mkv",
+			title:   "Foobar",
+			year:    1999,
+			quality: quality{resolution: "2160p", source: "WEB-DL"},
 		},
 	}, {
 		path: "/foo/bar/night.of.the.BEAST.2022/idk.mkv",
@@ -106,6 +115,22 @@ func TestMovieFromPath(t *testing.T) {
 			title: "Just The Title",
 			year:  0,
 		},
+	}, {
+		path: "/foo/The Matrix (1999) {tmdb-603}/The Matrix (1999) {imdb-tt0133093}.mkv",
+		movie: &movie{
+			path:     "/foo/The Matrix (1999) {tmdb-603}/The Matrix (1999) {imdb-tt0133093}.mkv",
+			title:    "The Matrix",
+			year:     1999,
+			tmdbID:   603,
+			external: externalID{"imdb_id", "tt0133093"},
+		},
+	}, {
+		path: "/foo/Heat [imdbid-tt0113277]/heat.mkv",
+		movie: &movie{
+			path:     "/foo/Heat [imdbid-tt0113277]/heat.mkv",
+			title:    "Heat",
+			external: externalID{"imdb_id", "tt0113277"},
+		},
 	}}
 
 	for _, w := range tt {
@@ -113,7 +138,7 @@ func TestMovieFromPath(t *testing.T) {
 		if err != nil {
 			t.Errorf("failed to create movie from path %s", w.path)
 		}
-		if diff := cmp.Diff(w.movie, g, cmp.AllowUnexported(movie{})); diff != "" {
+		if diff := cmp.Diff(w.movie, g, cmp.AllowUnexported(movie{}, externalID{}, quality{})); diff != "" {
 			t.Errorf("MovieFromPath() mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -170,6 +195,64 @@ func TestEpisodeFromPath(t *testing.T) {
 			season:  1,
 			episode: 3,
 		},
+	}, {
+		"/tv/Breaking Bad (2008) {tvdb-81189}/Season 1/Breaking Bad (2008) - S01E01.mkv",
+		"tv/Breaking Bad (2008)/Season 1/Breaking Bad (2008) - S01E01.mkv",
+		&episode{
+			path:     "/tv/Breaking Bad (2008) {tvdb-81189}/Season 1/Breaking Bad (2008) - S01E01.mkv",
+			series:   "Breaking Bad",
+			id:       "S01E01",
+			season:   1,
+			episode:  1,
+			year:     2008,
+			external: externalID{"tvdb_id", "81189"},
+		},
+	}, {
+		"/tv/Show {tmdb-1396}/Show.S01E02.Title.{tmdb-1996}.mkv",
+		"tv/Show/Season 1/Show - S01E02 - Title.mkv",
+		&episode{
+			path:    "/tv/Show {tmdb-1396}/Show.S01E02.Title.{tmdb-1996}.mkv",
+			series:  "Show",
+			title:   "Title",
+			id:      "S01E02",
+			season:  1,
+			episode: 2,
+			tmdbID:  1396,
+		},
+	}, {
+		"/tv/Firefly/Firefly.1x05.Safe.mkv",
+		"tv/Firefly/Season 1/Firefly - S01E05 - Safe.mkv",
+		&episode{
+			path:    "/tv/Firefly/Firefly.1x05.Safe.mkv",
+			series:  "Firefly",
+			title:   "Safe",
+			id:      "s1e05",
+			season:  1,
+			episode: 5,
+		},
+	}, {
+		"/tv/Lost/Lost - 3x22-3x23 - Through the Looking Glass.avi",
+		"tv/Lost/Season 3/Lost - S03E22-E23 - Through The Looking Glass.avi",
+		&episode{
+			path:    "/tv/Lost/Lost - 3x22-3x23 - Through the Looking Glass.avi",
+			series:  "Lost",
+			title:   "Through The Looking Glass",
+			id:      "s3e22e23",
+			season:  3,
+			episode: 22,
+		},
+	}, {
+		"/tv/The Daily Show/The.Daily.Show.2024.05.01.Jane.Doe.720p.WEB.mkv",
+		"tv/The Daily Show/Season 2024/The Daily Show - 2024-05-01 - Jane Doe.mkv",
+		&episode{
+			path:    "/tv/The Daily Show/The.Daily.Show.2024.05.01.Jane.Doe.720p.WEB.mkv",
+			series:  "The Daily Show",
+			title:   "Jane Doe",
+			id:      "2024-05-01",
+			season:  2024,
+			airDate: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			quality: quality{resolution: "720p", source: "WEB-DL"},
+		},
 	}}
 
 	for _, w := range tt {
@@ -177,7 +260,7 @@ func TestEpisodeFromPath(t *testing.T) {
 		if err != nil {
 			t.Errorf("failed to create episode from path %s", w.path)
 		}
-		if diff := cmp.Diff(w.episode, g, cmp.AllowUnexported(episode{})); diff != "" {
+		if diff := cmp.Diff(w.episode, g, cmp.AllowUnexported(episode{}, externalID{}, quality{})); diff != "" {
 			t.Errorf("MovieFromPath() mismatch (-want +got):\n%s", diff)
 		}
 		if diff := cmp.Diff(w.target, g.Target()); diff != "" {
@@ -185,6 +268,49 @@ func TestEpisodeFromPath(t *testing.T) {
 		}
 	}
 }
+func TestEpisodeFromPathWithoutID(t *testing.T) {
+	if _, err := EpisodeFromPath("/dl/Show.mkv"); !errors.Is(err, ErrNoEpisodeID) {
+		t.Errorf("EpisodeFromPath() = %v, want ErrNoEpisodeID", err)
+	}
+}
+
+func TestAirDateLookup(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/search/tv":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[{"id":774101,"name":"The Daily Show"}]}`)
+		case "/3/tv/774101":
+			fmt.Fprint(w, `{"id":774101,"name":"The Daily Show","seasons":[
+				{"season_number":28,"air_date":"2023-01-17"},
+				{"season_number":29,"air_date":"2024-01-08"},
+				{"season_number":30,"air_date":"2025-01-06"}]}`)
+		case "/3/tv/774101/season/29":
+			fmt.Fprint(w, `{"id":29,"season_number":29,"episodes":[
+				{"id":1,"name":"Jan 8","season_number":29,"episode_number":1,"air_date":"2024-01-08"},
+				{"id":2,"name":"Jane Doe Guests","season_number":29,"episode_number":52,"air_date":"2024-05-01"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	l, err := NewLinkable("/dl/The.Daily.Show.2024.05.01.Jane.Doe.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup(context.Background(), options.metadataProvider(), l)
+	e, ok := l.(*episode)
+	if !ok {
+		t.Fatalf("NewLinkable() returned %T, want an episode", l)
+	}
+	if e.season != 29 || e.episode != 52 || e.tmdbID != 774101 {
+		t.Errorf("lookup() numbered the episode %d/%d of %d, want 29/52 of 774101", e.season, e.episode, e.tmdbID)
+	}
+	want := "tv/The Daily Show/Season 2024/The Daily Show - 2024-05-01 - Jane Doe Guests.mkv"
+	if got := e.Target(); got != want {
+		t.Errorf("Target() = %q, want %q", got, want)
+	}
+}
 
 func TestTitlePermutations(t *testing.T) {
 	cases := []struct {
@@ -207,3 +333,297 @@ func TestTitlePermutations(t *testing.T) {
 		}
 	}
 }
+
+func TestEpisodeTargetPadding(t *testing.T) {
+	defer func(w int) { options.episodePadding = w }(options.episodePadding)
+
+	tt := []struct {
+		path    string
+		padding int
+		target  string
+	}{{
+		"/tv/Long Show - s01e7 - Title.mkv",
+		2,
+		"tv/Long Show/Season 1/Long Show - S01E07 - Title.mkv",
+	}, {
+		"/tv/Long Show - S01E07 - Title.mkv",
+		3,
+		"tv/Long Show/Season 1/Long Show - S01E007 - Title.mkv",
+	}, {
+		"/tv/Long Show - S1E120E121.mkv",
+		3,
+		"tv/Long Show/Season 1/Long Show - S01E120-E121.mkv",
+	}, {
+		"/tv/Long Show - S01E0007.mkv",
+		1,
+		"tv/Long Show/Season 1/Long Show - S01E7.mkv",
+	}}
+
+	for _, w := range tt {
+		options.episodePadding = w.padding
+		g, err := EpisodeFromPath(w.path)
+		if err != nil {
+			t.Errorf("failed to create episode from path %s", w.path)
+		}
+		if diff := cmp.Diff(w.target, g.Target()); diff != "" {
+			t.Errorf("episode.Target() mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestTargetTemplates(t *testing.T) {
+	defer func(m, e *TargetTemplate) {
+		options.movieTarget, options.episodeTarget = m, e
+	}(options.movieTarget, options.episodeTarget)
+
+	movie, err := ParseTargetTemplate(`Films/{{.Title}}{{if .Year}} [{{.Year}}]{{end}}/{{.Title}}{{.Ext}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	episode, err := ParseTargetTemplate(`Shows/{{.Series}}/{{printf "%02d" .Season}}/{{.EpisodeID}}{{.Ext}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.movieTarget, options.episodeTarget = movie, episode
+
+	tt := []struct {
+		path   string
+		target string
+	}{
+		{"/dl/Dune.2021.2160p.mkv", "Films/Dune [2021]/Dune.mkv"},
+		{"/dl/Some Movie/some_movie.avi", "Films/Some Movie/Some Movie.avi"},
+		{"/tv/Long Show - S02E07 - Title.mkv", "Shows/Long Show/02/S02E07.mkv"},
+	}
+	for _, w := range tt {
+		g, err := NewLinkable(w.path)
+		if err != nil {
+			t.Fatalf("failed to parse %s", w.path)
+		}
+		if diff := cmp.Diff(w.target, g.Target()); diff != "" {
+			t.Errorf("Target() mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	for _, s := range []string{`{{.Title`, `{{.Nope}}`, `/{{.Title}}`, `../{{.Title}}`} {
+		if _, err := ParseTargetTemplate(s); err == nil {
+			t.Errorf("ParseTargetTemplate(%q) returned no error", s)
+		}
+	}
+}
+
+// concurrencyFilter excludes nothing, recording the most calls it had at
+// once
+type concurrencyFilter struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (f *concurrencyFilter) exclude(info fs.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	f.mu.Lock()
+	f.current++
+	f.max = max(f.max, f.current)
+	f.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	f.mu.Lock()
+	f.current--
+	f.mu.Unlock()
+	return false
+}
+
+func TestFindFilesWorkers(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+
+	root := t.TempDir()
+	for i := 0; i < 40; i++ {
+		createFiles(t, filepath.Join(root, fmt.Sprintf("Movie %d (2001).mkv", i)))
+	}
+	for _, workers := range []int{1, 3, 8} {
+		options = NewOptions()
+		// Files are parsed by the disk bound workers
+		options.SetOptions(WithConcurrency(20), WithIOConcurrency(workers), WithIOConcurrency(0))
+		if options.netWorkers != 20 {
+			t.Errorf("WithIOConcurrency() changed the network workers to %d", options.netWorkers)
+		}
+		f := &concurrencyFilter{}
+		media, errc := findFiles(context.Background(), root, f)
+		n := 0
+		for range media {
+			n++
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if n != 40 {
+			t.Errorf("%d workers found %d files, want 40", workers, n)
+		}
+		if f.max > workers {
+			t.Errorf("%d workers filtered %d files at once", workers, f.max)
+		}
+		if workers > 1 && f.max < 2 {
+			t.Errorf("%d workers never filtered files concurrently", workers)
+		}
+	}
+}
+
+func TestFindFilesCancel(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	root := t.TempDir()
+	for i := 0; i < 40; i++ {
+		createFiles(t, filepath.Join(root, fmt.Sprintf("Movie %d (2001).mkv", i)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	media, errc := findFiles(ctx, root)
+	<-media
+	cancel()
+	// The walk stops and the channel is closed once the workers stop
+	done := make(chan struct{})
+	go func() {
+		for range media {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("findFiles() didn't stop after its context was cancelled")
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("findFiles() returned %v, want context.Canceled", err)
+	}
+
+	// A cancelled run looks nothing up
+	links, _ := LinkFromFiles(ctx, WithSources([]string{root}), WithDestination(t.TempDir()))
+	for ln := range links {
+		t.Errorf("LinkFromFiles() with a cancelled context sent %s", ln.Src)
+	}
+}
+
+func TestProviderIDLookup(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	var requests []string
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/3/movie/765001":
+			fmt.Fprint(w, `{"id":765001,"title":"The Matrix","release_date":"1999-03-31"}`)
+		case "/3/find/tt0765002":
+			fmt.Fprint(w, `{"movie_results":[{"id":765002,"title":"Heat"}]}`)
+		case "/3/movie/765002":
+			fmt.Fprint(w, `{"id":765002,"title":"Heat","release_date":"1995-12-15"}`)
+		case "/3/find/765003":
+			fmt.Fprint(w, `{"tv_results":[{"id":765004,"name":"Breaking Bad"}]}`)
+		case "/3/tv/765004":
+			fmt.Fprint(w, `{"id":765004,"name":"Breaking Bad"}`)
+		case "/3/tv/765004/season/1/episode/1":
+			fmt.Fprint(w, `{"id":1,"name":"Pilot"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	tests := []struct {
+		path     string
+		want     Linkable
+		requests []string
+	}{
+		{"/dl/The Matrix {tmdb-765001}/matrix.mkv",
+			&movie{title: "The Matrix", year: 1999, tmdbID: 765001, released: 1999, matchedBy: MatchedByIDTag},
+			[]string{"/3/movie/765001"}},
+		{"/dl/Heat {imdb-tt0765002}.mkv",
+			&movie{title: "Heat", year: 1995, tmdbID: 765002, external: externalID{"imdb_id", "tt0765002"}, released: 1995, matchedBy: MatchedByIDTag},
+			[]string{"/3/find/tt0765002", "/3/movie/765002"}},
+		{"/dl/Breaking Bad {tvdb-765003}/Season 1/Breaking.Bad.S01E01.mkv",
+			&episode{series: "Breaking Bad", title: "Pilot", id: "S01E01", season: 1, episode: 1, tmdbID: 765004, external: externalID{"tvdb_id", "765003"}, matchedBy: MatchedByIDTag},
+			[]string{"/3/find/765003", "/3/tv/765004", "/3/tv/765004/season/1/episode/1"}},
+	}
+	for _, tt := range tests {
+		requests = nil
+		l, err := NewLinkable(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lookup(context.Background(), options.metadataProvider(), l)
+		switch v := tt.want.(type) {
+		case *movie:
+			v.path = tt.path
+		case *episode:
+			v.path = tt.path
+		}
+		if diff := cmp.Diff(tt.want, l, cmp.AllowUnexported(movie{}, episode{}, externalID{}, quality{})); diff != "" {
+			t.Errorf("lookup(%s) mismatch (-want +got):\n%s", tt.path, diff)
+		}
+		if diff := cmp.Diff(tt.requests, requests); diff != "" {
+			t.Errorf("lookup(%s) requests mismatch (-want +got):\n%s", tt.path, diff)
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"valid", []Option{WithSources([]string{"/dl"}), WithDestination("/media")}, nil},
+		{"empty", nil, []string{"no destination directory", "no source directories"}},
+		{"contradictory",
+			[]Option{
+				WithSources([]string{"/dl", ""}),
+				WithDestination("/media"),
+				WithExcludeTypes(true, true),
+				WithLinkMode("symlink"),
+				WithNFO(true, RatingIMDb, ""),
+			},
+			[]string{
+				"source directory 2 is empty",
+				"both movies and episodes are excluded",
+				`unsupported link mode "symlink"`,
+				"IMDb ratings need an OMDb API key",
+			}},
+		{"actor thumbs without NFOs",
+			[]Option{WithSources([]string{"/dl"}), WithDestination("/media"), WithActorThumbs(true)},
+			[]string{"actor thumbnails"}},
+		{"negative settle time",
+			[]Option{WithSources([]string{"/dl"}), WithDestination("/media"), WithSettleTime(-time.Second)},
+			[]string{"invalid settle time"}},
+	}
+	for _, tt := range tests {
+		o := NewOptions()
+		o.SetOptions(tt.opts...)
+		err := o.Validate()
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: Validate() = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: Validate() = nil, want errors", tt.name)
+			continue
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%s: Validate() = %q, want it to contain %q", tt.name, err, w)
+			}
+		}
+	}
+}
+
+func TestLinkFromFilesInvalidOptions(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	links, errc := LinkFromFiles(context.Background(), WithSources([]string{t.TempDir()}))
+	for ln := range links {
+		t.Errorf("LinkFromFiles() without a destination sent %s", ln.Src)
+	}
+	if err := <-errc; err == nil || !strings.Contains(err.Error(), "no destination directory") {
+		t.Errorf("LinkFromFiles() without a destination returned %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LeaseName is the name of the lock file kept in a destination while a run
+// writes to it.
+const LeaseName = ".kourai-lock"
+
+// LeaseInfo is the content of a lock file.
+type LeaseInfo struct {
+	Owner     string    `json:"owner"`
+	Acquired  time.Time `json:"acquired"`
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+var (
+	// ErrLeaseHeld is returned when another writer holds a live lease.
+	ErrLeaseHeld = errors.New("destination is locked by another writer")
+	// ErrLeaseLost is returned by Lease.Err once a lease was lost, and by
+	// the creates and renames of targets in its destination from then on.
+	ErrLeaseLost = errors.New("destination lock lost")
+)
+
+// Lease is a lock on a destination that is kept alive by a heartbeat, so
+// that writers on several machines sharing a library don't write to it at
+// the same time. Leases whose heartbeat is older than their TTL, e.g. of a
+// writer that crashed, are taken over.
+type Lease struct {
+	path string
+	info LeaseInfo
+	ttl  time.Duration
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu   sync.Mutex
+	lost error
+}
+
+// leases are those held by this process, whose loss stops the creates and
+// renames of targets in their destinations
+var (
+	leasesMu sync.Mutex
+	leases   = map[*Lease]bool{}
+)
+
+// leaseOwner identifies this process across machines
+func leaseOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// minLeaseInterval bounds how often a lease is retried and renewed, so a
+// tiny TTL doesn't turn into a busy loop.
+const minLeaseInterval = 100 * time.Millisecond
+
+// AcquireLease locks dest, retrying until ctx is done while another writer
+// holds it. The heartbeat is written every third of ttl, which must be
+// positive.
+func AcquireLease(ctx context.Context, dest string, ttl time.Duration) (*Lease, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid lease TTL %s, it must be positive", ttl)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	l := &Lease{path: filepath.Join(dest, LeaseName), ttl: ttl, stop: make(chan struct{})}
+	for {
+		err := l.tryAcquire()
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLeaseHeld) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(l.interval()):
+		}
+	}
+
+	l.wg.Add(1)
+	go l.heartbeat()
+	leasesMu.Lock()
+	leases[l] = true
+	leasesMu.Unlock()
+	return l, nil
+}
+
+// interval returns how long to wait between attempts and heartbeats
+func (l *Lease) interval() time.Duration {
+	return max(l.ttl/3, minLeaseInterval)
+}
+
+func (l *Lease) tryAcquire() error {
+	now := time.Now().UTC()
+	l.info = LeaseInfo{Owner: leaseOwner(), Acquired: now, Heartbeat: now}
+	b, _ := json.Marshal(l.info)
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.Write(b)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	held, err := readLease(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w, released while acquiring", ErrLeaseHeld)
+	} else if err != nil {
+		return err
+	}
+	if time.Since(held.Heartbeat) < l.ttl {
+		return fmt.Errorf("%w %s since %s", ErrLeaseHeld, held.Owner, held.Acquired.Local().Format(time.DateTime))
+	}
+	return l.takeOver(held)
+}
+
+// takeOver acquires the lease in place of held, the stale lease read from
+// the lock file, by renaming it aside. Another writer that saw it stale too
+// may have taken it over since, in which case the lease renamed is its
+// fresh one, and is put back.
+func (l *Lease) takeOver(held LeaseInfo) error {
+	stale := fmt.Sprintf("%s.stale-%s", l.path, leaseOwner())
+	if err := os.Rename(l.path, stale); err != nil {
+		return fmt.Errorf("%w, taken over by another writer", ErrLeaseHeld)
+	}
+	taken, err := readLease(stale)
+	if err != nil || taken.Owner != held.Owner || !taken.Heartbeat.Equal(held.Heartbeat) {
+		restoreLease(stale, l.path)
+		return fmt.Errorf("%w, taken over by another writer", ErrLeaseHeld)
+	}
+	os.Remove(stale)
+	return l.tryAcquire()
+}
+
+// restoreLease moves the lease at stale back to path, unless a lease was
+// created there since, which is kept. Hard links don't replace existing
+// files, unlike renames, which are only used where they aren't supported.
+func restoreLease(stale, path string) {
+	err := os.Link(stale, path)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		os.Rename(stale, path)
+		return
+	}
+	os.Remove(stale)
+}
+
+// ReadLease returns the lease held on dest.
+func ReadLease(dest string) (LeaseInfo, error) {
+	return readLease(filepath.Join(dest, LeaseName))
+}
+
+// readLease reads the lock file at path
+func readLease(path string) (LeaseInfo, error) {
+	var info LeaseInfo
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(b, &info); err != nil {
+		return info, fmt.Errorf("failed to parse lease %s with error %w", path, err)
+	}
+	return info, nil
+}
+
+func (l *Lease) heartbeat() {
+	defer l.wg.Done()
+	t := time.NewTicker(l.interval())
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-t.C:
+		}
+		if err := l.renew(); err != nil {
+			if !errors.Is(err, ErrLeaseLost) {
+				err = fmt.Errorf("%w: %w", ErrLeaseLost, err)
+			}
+			l.mu.Lock()
+			l.lost = err
+			l.mu.Unlock()
+			return
+		}
+	}
+}
+
+// renew writes a new heartbeat, unless the lease was taken over
+func (l *Lease) renew() error {
+	held, err := readLease(l.path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLeaseLost, err)
+	}
+	if held.Owner != l.info.Owner || !held.Acquired.Equal(l.info.Acquired) {
+		return fmt.Errorf("%w to %s", ErrLeaseLost, held.Owner)
+	}
+	l.info.Heartbeat = time.Now().UTC()
+	b, _ := json.Marshal(l.info)
+	tmp := l.path + ".tmp-" + leaseOwner()
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// Err returns why the lease was lost, wrapping ErrLeaseLost, e.g. because
+// heartbeats couldn't be written for longer than the TTL, or nil while it's
+// held.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// Release stops the heartbeat and removes the lock file, if it's still
+// held by l.
+func (l *Lease) Release() error {
+	leasesMu.Lock()
+	delete(leases, l)
+	leasesMu.Unlock()
+	close(l.stop)
+	l.wg.Wait()
+	held, err := readLease(l.path)
+	if err != nil {
+		return err
+	}
+	if held.Owner != l.info.Owner || !held.Acquired.Equal(l.info.Acquired) {
+		return fmt.Errorf("%w to %s", ErrLeaseLost, held.Owner)
+	}
+	return os.Remove(l.path)
+}
+
+// checkLeases returns why the lease held on a destination that contains
+// path was lost, so that nothing more is written to it, or nil
+func checkLeases(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	leasesMu.Lock()
+	defer leasesMu.Unlock()
+	for l := range leases {
+		dest, err := filepath.Abs(filepath.Dir(l.path))
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dest, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if err := l.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
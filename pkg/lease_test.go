@@ -0,0 +1,142 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	dest := t.TempDir()
+	ctx := context.Background()
+
+	l, err := AcquireLease(ctx, dest, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := AcquireLease(ctx2, dest, time.Minute); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("AcquireLease() of a held lease returned %v, want ErrLeaseHeld", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, LeaseName)); !os.IsNotExist(err) {
+		t.Error("lock file was not removed on release")
+	}
+
+	// A lease of a writer that stopped heartbeating is taken over
+	stale, _ := json.Marshal(LeaseInfo{Owner: "other:1", Heartbeat: time.Now().Add(-time.Hour)})
+	if err := os.WriteFile(filepath.Join(dest, LeaseName), stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = AcquireLease(ctx, dest, time.Minute)
+	if err != nil {
+		t.Fatalf("AcquireLease() of a stale lease returned %v", err)
+	}
+	if info, err := ReadLease(dest); err != nil || info.Owner != leaseOwner() {
+		t.Errorf("ReadLease() = %v, %v; want owner %s", info, err, leaseOwner())
+	}
+	l.Release()
+}
+
+func TestLeaseTakeOverRace(t *testing.T) {
+	dest := t.TempDir()
+	path := filepath.Join(dest, LeaseName)
+
+	// The stale lease seen was taken over by another writer in the meantime
+	seen := LeaseInfo{Owner: "crashed:1", Heartbeat: time.Now().Add(-time.Hour)}
+	fresh := LeaseInfo{Owner: "other:2", Acquired: time.Now().UTC(), Heartbeat: time.Now().UTC()}
+	b, _ := json.Marshal(fresh)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := &Lease{path: path, ttl: time.Minute}
+	if err := l.takeOver(seen); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("takeOver() of a lease taken over since returned %v, want ErrLeaseHeld", err)
+	}
+	if info, err := ReadLease(dest); err != nil || info.Owner != fresh.Owner {
+		t.Errorf("ReadLease() = %v, %v; want the lease of %s kept", info, err, fresh.Owner)
+	}
+	if matches, _ := filepath.Glob(path + ".stale-*"); len(matches) > 0 {
+		t.Errorf("takeOver() left %v behind", matches)
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "Heat.1995.mkv"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := AcquireLease(context.Background(), dest, 3*minLeaseInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+	other, _ := json.Marshal(LeaseInfo{Owner: "other:2", Acquired: time.Now().UTC(), Heartbeat: time.Now().UTC()})
+	if err := os.WriteFile(filepath.Join(dest, LeaseName), other, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); l.Err() == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := l.Err(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Err() of a lease taken over = %v, want ErrLeaseLost", err)
+	}
+	ln := Link{Src: filepath.Join(src, "Heat.1995.mkv"), Target: filepath.Join(dest, "movies/Heat (1995)/Heat (1995).mkv")}
+	if err := ln.Create(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Create() after the lease was lost = %v, want ErrLeaseLost", err)
+	}
+	if _, err := os.Stat(ln.Target); !os.IsNotExist(err) {
+		t.Errorf("Create() after the lease was lost created %s", ln.Target)
+	}
+}
+
+func TestLeaseTTL(t *testing.T) {
+	ctx := context.Background()
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		if _, err := AcquireLease(ctx, t.TempDir(), ttl); err == nil {
+			t.Errorf("AcquireLease() with a TTL of %s returned no error", ttl)
+		}
+	}
+
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{time.Minute, 20 * time.Second},
+		{time.Nanosecond, minLeaseInterval},
+		{minLeaseInterval, minLeaseInterval},
+	}
+	for _, tt := range tests {
+		l := &Lease{ttl: tt.ttl}
+		if got := l.interval(); got != tt.want {
+			t.Errorf("interval() with a TTL of %s = %s, want %s", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestExistingDirs(t *testing.T) {
+	dest := t.TempDir()
+	os.MkdirAll(filepath.Join(dest, "tv", "Marvel's Agents of S.H.I.E.L.D. (2013)", "Season 1"), 0755)
+
+	tt := []struct {
+		target string
+		want   string
+	}{
+		{"tv/Marvels Agents of SHIELD (2013)/Season 1/e.mkv", "tv/Marvel's Agents of S.H.I.E.L.D. (2013)/Season 1/e.mkv"},
+		{"tv/Marvels Agents of SHIELD (2013)/Season 2/e.mkv", "tv/Marvel's Agents of S.H.I.E.L.D. (2013)/Season 2/e.mkv"},
+		{"tv/Agents of SHIELD/Season 1/e.mkv", "tv/Agents of SHIELD/Season 1/e.mkv"},
+		{"movies/Dune (2021)/dune.mkv", "movies/Dune (2021)/dune.mkv"},
+	}
+	for _, w := range tt {
+		if got := existingDirs(dest, w.target); got != w.want {
+			t.Errorf("existingDirs(%q) = %q, want %q", w.target, got, w.want)
+		}
+	}
+}
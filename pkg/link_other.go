@@ -0,0 +1,48 @@
+//go:build !windows
+
+package kourai
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// isCrossDevice reports whether err was caused by linking across
+// filesystems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// linkDir recreates the directory tree of src at target, hard linking every
+// file, since directories themselves can't be hard linked. Like hard links
+// of files, it fails when target exists, and leaves nothing behind when
+// it fails otherwise, e.g. across filesystems.
+func linkDir(src, target string) error {
+	if err := os.Mkdir(target, 0755); err != nil {
+		return err
+	}
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(target, rel)
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return os.Link(path, dst)
+	})
+	if err != nil {
+		os.RemoveAll(target)
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+//go:build !windows
+
+package kourai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestIsCrossDevice(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&os.LinkError{Op: "link", Old: "a", New: "b", Err: syscall.EXDEV}, true},
+		{fmt.Errorf("wrapped: %w", &os.LinkError{Op: "link", Err: syscall.EXDEV}), true},
+		{&os.LinkError{Op: "link", Old: "a", New: "b", Err: syscall.EPERM}, false},
+		{os.ErrNotExist, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isCrossDevice(tt.err); got != tt.want {
+			t.Errorf("isCrossDevice(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestLinkDir(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	files := []string{"BDMV/index.bdmv", "BDMV/STREAM/00000.m2ts"}
+	for _, f := range files {
+		p := filepath.Join(src, "Heat.1995.BluRay", filepath.FromSlash(f))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ln := Link{Src: filepath.Join(src, "Heat.1995.BluRay"), Target: filepath.Join(dest, "movies/Heat (1995)/Heat (1995)")}
+	if err := ln.Create(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		a, err := os.Stat(filepath.Join(ln.Src, filepath.FromSlash(f)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.Stat(filepath.Join(ln.Target, filepath.FromSlash(f)))
+		if err != nil {
+			t.Fatalf("Create() of a disc folder didn't link %s: %v", f, err)
+		}
+		if !os.SameFile(a, b) {
+			t.Errorf("Create() of a disc folder copied %s rather than linking it", f)
+		}
+	}
+	if err := ln.Create(); !errors.Is(err, ErrTargetExists) {
+		t.Errorf("Create() of an existing disc folder = %v, want %v", err, ErrTargetExists)
+	}
+}
+
+func TestNlinks(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "Heat.1995.mkv")
+	if err := os.WriteFile(p, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(p, filepath.Join(dir, "Heat (1995).mkv")); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range entries {
+		if n, err := Nlinks(filepath.Join(dir, d.Name()), d); err != nil || n != 2 {
+			t.Errorf("Nlinks(%s) = %d, %v; want 2", d.Name(), n, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package kourai
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, returned when linking
+// across volumes.
+const errorNotSameDevice syscall.Errno = 17
+
+// isCrossDevice reports whether err was caused by linking across volumes.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
+
+// linkDir creates target as an NTFS directory junction pointing at src.
+// Unlike directory symlinks, junctions don't require elevated privileges,
+// but they do require an absolute src.
+func linkDir(src, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		return fs.ErrExist
+	}
+	src, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("cmd", "/c", "mklink", "/J", target, src).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create junction %s with error %w: %s", target, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
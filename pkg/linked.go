@@ -0,0 +1,78 @@
+package kourai
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+// linkedFilter skips sources that are hard linked already, see
+// WithSkipLinked
+type linkedFilter struct {
+	underDest bool
+	once      sync.Once
+	// inodes are those of the files below the destinations, when
+	// underDest is set
+	inodes map[inodeKey]bool
+}
+
+// WithSkipLinked skips the regular files that are hard linked elsewhere,
+// i.e. whose link count is 2 or more, as sources linked by an earlier run,
+// without parsing or looking them up. With underDest, only files with a
+// link below the destination, or the destination of a route, are skipped,
+// so that sources hard linked by other tools, e.g. a torrent client
+// seeding them, are still linked; the destinations are walked once, when
+// the first hard linked source is found.
+func WithSkipLinked(skip, underDest bool) Option {
+	return func(o *Options) {
+		o.skipLinked = nil
+		if skip {
+			o.skipLinked = &linkedFilter{underDest: underDest}
+		}
+	}
+}
+
+// linked reports whether the file at path, with info, is hard linked
+// already. A nil f skips nothing.
+func (f *linkedFilter) linked(path string, info fs.FileInfo) bool {
+	if f == nil {
+		return false
+	}
+	dev, ino, nlink, err := fileIdentity(path, info)
+	if err != nil || nlink < 2 {
+		return false
+	}
+	if !f.underDest {
+		return true
+	}
+	f.once.Do(f.index)
+	return f.inodes[inodeKey{dev, ino}]
+}
+
+// index records the inodes of the files below the destinations
+func (f *linkedFilter) index() {
+	f.inodes = map[inodeKey]bool{}
+	roots := []string{options.dest}
+	for _, r := range options.routes {
+		roots = append(roots, r.Dest)
+	}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if dev, ino, _, err := fileIdentity(p, info); err == nil {
+				f.inodes[inodeKey{dev, ino}] = true
+			}
+			return nil
+		})
+	}
+	options.logger.Debug("indexed the destinations for linked sources", "roots", roots, "files", len(f.inodes))
+}
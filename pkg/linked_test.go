@@ -0,0 +1,47 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSkipLinked(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest, seeding := t.TempDir(), t.TempDir(), t.TempDir()
+	for _, f := range []string{"Alien.1979.mkv", "Heat.1995.mkv", "Dune.2021.mkv"} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(src, "Alien.1979.mkv"), filepath.Join(dest, "Alien.1979.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(src, "Heat.1995.mkv"), filepath.Join(seeding, "Heat.1995.mkv")); err != nil {
+		t.Fatal(err)
+	}
+
+	found := func(underDest bool) []string {
+		t.Helper()
+		options.SetOptions(WithDestination(dest), WithSkipLinked(true, underDest))
+		got := []string{}
+		media, _ := findFiles(context.Background(), src)
+		for m := range media {
+			got = append(got, filepath.Base(m.Path()))
+		}
+		sort.Strings(got)
+		return got
+	}
+	if diff := cmp.Diff([]string{"Dune.2021.mkv"}, found(false)); diff != "" {
+		t.Errorf("findFiles() skipping linked sources mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"Dune.2021.mkv", "Heat.1995.mkv"}, found(true)); diff != "" {
+		t.Errorf("findFiles() skipping sources linked into the destination mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,247 @@
+package kourai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Media servers whose "added at" dates can be backdated
+const (
+	ServerPlex     = "plex"
+	ServerJellyfin = "jellyfin"
+)
+
+type plexSections struct {
+	MediaContainer struct {
+		Directory []struct {
+			Key      string `json:"key"`
+			Type     string `json:"type"`
+			Location []struct {
+				Path string `json:"path"`
+			} `json:"Location"`
+		} `json:"Directory"`
+	} `json:"MediaContainer"`
+}
+
+type plexItems struct {
+	MediaContainer struct {
+		Metadata []struct {
+			RatingKey string `json:"ratingKey"`
+			AddedAt   int64  `json:"addedAt"`
+			Media     []struct {
+				Part []struct {
+					File string `json:"file"`
+				} `json:"Part"`
+			} `json:"Media"`
+		} `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+type jellyfinItems struct {
+	Items []struct {
+		ID          string    `json:"Id"`
+		Path        string    `json:"Path"`
+		DateCreated time.Time `json:"DateCreated"`
+	} `json:"Items"`
+}
+
+// mediaServer sends requests to the API of a media server
+type mediaServer struct {
+	name    string
+	baseURL string
+	header  string
+	token   string
+	// extra are other headers sent with each request
+	extra map[string]string
+}
+
+func (s mediaServer) do(ctx context.Context, method, endpoint string, body []byte, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("accept", "application/json")
+	req.Header.Add(s.header, s.token)
+	for k, v := range s.extra {
+		req.Header.Add(k, v)
+	}
+	if body != nil {
+		req.Header.Add("content-type", "application/json")
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s for %s %s", s.name, res.Status, method, endpoint)
+	}
+	if v == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s response with error %w", s.name, err)
+	}
+	return nil
+}
+
+// BackdateAdded sets the date a Plex or Jellyfin server added the items of
+// its libraries to the time in added, keyed by the local path of their
+// file, so that importing an existing collection doesn't flood "Recently
+// Added". The paths of the server are mapped to local ones by pathMap.
+// Items are only moved back in time: those added before the given time,
+// and files the server doesn't know, are left alone. The server must have
+// scanned the files already. Jellyfin 10.9 or later is required. It
+// returns the number of items backdated.
+func BackdateAdded(ctx context.Context, server, baseURL, token string, pathMap PathMap, added map[string]time.Time) (int, error) {
+	s := mediaServer{name: server, baseURL: strings.TrimRight(baseURL, "/"), token: token}
+	lookup := func(p string) (time.Time, bool) {
+		local, ok := pathMap.ToLocal(p)
+		if !ok {
+			return time.Time{}, false
+		}
+		t, ok := added[local]
+		return t, ok
+	}
+
+	n := 0
+	switch server {
+	case ServerPlex:
+		s.header = "X-Plex-Token"
+		var sections plexSections
+		if err := s.do(ctx, "GET", "/library/sections", nil, &sections); err != nil {
+			return n, err
+		}
+		for _, d := range sections.MediaContainer.Directory {
+			// Episodes are type 4 in shows sections, movies type 1
+			kind := "1"
+			switch d.Type {
+			case "movie":
+			case "show":
+				kind = "4"
+			default:
+				continue
+			}
+			endpoint := "/library/sections/" + url.PathEscape(d.Key) + "/all?type=" + kind
+			var items plexItems
+			if err := s.do(ctx, "GET", endpoint, nil, &items); err != nil {
+				return n, err
+			}
+			for _, item := range items.MediaContainer.Metadata {
+				earliest := time.Unix(item.AddedAt, 0)
+				for _, m := range item.Media {
+					for _, p := range m.Part {
+						if t, ok := lookup(p.File); ok && t.Before(earliest) {
+							earliest = t
+						}
+					}
+				}
+				if earliest.Unix() >= item.AddedAt {
+					continue
+				}
+				q := url.Values{
+					"type":           {kind},
+					"id":             {item.RatingKey},
+					"addedAt.value":  {fmt.Sprint(earliest.Unix())},
+					"addedAt.locked": {"1"},
+				}
+				if err := s.do(ctx, "PUT", "/library/sections/"+url.PathEscape(d.Key)+"/all?"+q.Encode(), nil, nil); err != nil {
+					return n, err
+				}
+				n++
+			}
+		}
+		return n, nil
+
+	case ServerJellyfin:
+		s.header = "X-Emby-Token"
+		var items jellyfinItems
+		if err := s.do(ctx, "GET", "/Items?Recursive=true&IncludeItemTypes=Movie,Episode&Fields=Path,DateCreated", nil, &items); err != nil {
+			return n, err
+		}
+		for _, item := range items.Items {
+			t, ok := lookup(item.Path)
+			if !ok || !t.Before(item.DateCreated) {
+				continue
+			}
+			// Updates replace all the metadata of an item, so the item is
+			// sent back whole, with only its date changed
+			endpoint := "/Items/" + url.PathEscape(item.ID)
+			var full map[string]any
+			if err := s.do(ctx, "GET", endpoint, nil, &full); err != nil {
+				return n, err
+			}
+			full["DateCreated"] = t.UTC().Format(time.RFC3339)
+			body, err := json.Marshal(full)
+			if err != nil {
+				return n, err
+			}
+			if err := s.do(ctx, "POST", endpoint, body, nil); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	}
+	return n, fmt.Errorf("%w media server %q, expected %s or %s", ErrUnsupportedType, server, ServerPlex, ServerJellyfin)
+}
+
+// RefreshPlex asks the Plex server at baseURL to scan the folders of
+// targets, each in the library sections whose folders hold it, so that new
+// media appear without waiting for a scheduled scan. Targets are mapped to
+// the paths the server sees by pathMap. Each folder is scanned once, and targets
+// outside the sections are left alone. It returns the number of folders
+// scanned.
+func RefreshPlex(ctx context.Context, baseURL, token string, pathMap PathMap, targets []string) (int, error) {
+	s := mediaServer{name: ServerPlex, baseURL: strings.TrimRight(baseURL, "/"), header: "X-Plex-Token", token: token}
+	var sections plexSections
+	if err := s.do(ctx, "GET", "/library/sections", nil, &sections); err != nil {
+		return 0, err
+	}
+
+	// below reports whether the local folder dir is the folder of a
+	// section, a path of the server, or below it
+	below := func(dir, section string) bool {
+		local, ok := pathMap.ToLocal(section)
+		if !ok {
+			return false
+		}
+		rel, err := filepath.Rel(local, dir)
+		return err == nil && filepath.IsLocal(rel)
+	}
+
+	n := 0
+	scanned := map[string]bool{}
+	for _, target := range targets {
+		dir := filepath.Dir(target)
+		folder, ok := pathMap.ToRemote(dir)
+		if !ok || scanned[folder] {
+			continue
+		}
+		scanned[folder] = true
+		for _, d := range sections.MediaContainer.Directory {
+			for _, loc := range d.Location {
+				if !below(dir, loc.Path) {
+					continue
+				}
+				q := url.Values{"path": {folder}}
+				endpoint := "/library/sections/" + url.PathEscape(d.Key) + "/refresh?" + q.Encode()
+				if err := s.do(ctx, "GET", endpoint, nil, nil); err != nil {
+					return n, err
+				}
+				n++
+				break
+			}
+		}
+	}
+	return n, nil
+}
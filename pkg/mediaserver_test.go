@@ -0,0 +1,141 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBackdateAdded(t *testing.T) {
+	var mu sync.Mutex
+	var updates []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "secret" && r.Header.Get("X-Emby-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /library/sections":
+			fmt.Fprint(w, `{"MediaContainer":{"Directory":[{"key":"1","type":"movie"},{"key":"2","type":"show"},{"key":"3","type":"artist"}]}}`)
+		case "GET /library/sections/1/all":
+			fmt.Fprint(w, `{"MediaContainer":{"Metadata":[
+				{"ratingKey":"10","addedAt":1700000000,"Media":[{"Part":[{"file":"/lib/movies/Dune (2021)/Dune (2021).mkv"}]}]},
+				{"ratingKey":"11","addedAt":1500000000,"Media":[{"Part":[{"file":"/lib/movies/Heat (1995)/Heat (1995).mkv"}]}]},
+				{"ratingKey":"12","addedAt":1700000000,"Media":[{"Part":[{"file":"/lib/movies/Other (2000)/Other (2000).mkv"}]}]}
+			]}}`)
+		case "GET /library/sections/2/all":
+			fmt.Fprint(w, `{"MediaContainer":{"Metadata":[
+				{"ratingKey":"20","addedAt":1700000000,"Media":[{"Part":[{"file":"C:\\lib\\tv\\Show - S01E01.mkv"}]}]}
+			]}}`)
+		case "PUT /library/sections/1/all", "PUT /library/sections/2/all":
+			q := r.URL.Query()
+			mu.Lock()
+			updates = append(updates, fmt.Sprintf("plex %s type=%s %s locked=%s", q.Get("id"), q.Get("type"), q.Get("addedAt.value"), q.Get("addedAt.locked")))
+			mu.Unlock()
+		case "GET /Items":
+			fmt.Fprint(w, `{"Items":[
+				{"Id":"a","Path":"/lib/movies/Dune (2021)/Dune (2021).mkv","DateCreated":"2023-11-14T22:13:20Z"},
+				{"Id":"b","Path":"/lib/movies/Heat (1995)/Heat (1995).mkv","DateCreated":"2017-07-14T02:40:00Z"}
+			]}`)
+		case "GET /Items/a":
+			fmt.Fprint(w, `{"Id":"a","Name":"Dune","Overview":"Spice.","DateCreated":"2023-11-14T22:13:20Z"}`)
+		case "POST /Items/a":
+			var item map[string]any
+			json.NewDecoder(r.Body).Decode(&item)
+			mu.Lock()
+			updates = append(updates, fmt.Sprintf("jellyfin %s %s %s %s", item["Id"], item["Name"], item["Overview"], item["DateCreated"]))
+			mu.Unlock()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	added := map[string]time.Time{
+		"/lib/movies/Dune (2021)/Dune (2021).mkv": time.Unix(1600000000, 0),
+		"/lib/movies/Heat (1995)/Heat (1995).mkv": time.Unix(1600000000, 0),
+		"C:/lib/tv/Show - S01E01.mkv":             time.Unix(1650000000, 0),
+	}
+	tests := []struct {
+		server  string
+		n       int
+		updates []string
+	}{
+		{ServerPlex, 2, []string{"plex 10 type=1 1600000000 locked=1", "plex 20 type=4 1650000000 locked=1"}},
+		{ServerJellyfin, 1, []string{"jellyfin a Dune Spice. 2020-09-13T12:26:40Z"}},
+	}
+	for _, tt := range tests {
+		updates = nil
+		n, err := BackdateAdded(context.Background(), tt.server, srv.URL+"/", "secret", PathMap{}, added)
+		if err != nil {
+			t.Fatalf("BackdateAdded(%s) returned %v", tt.server, err)
+		}
+		if n != tt.n {
+			t.Errorf("BackdateAdded(%s) = %d, want %d", tt.server, n, tt.n)
+		}
+		if diff := cmp.Diff(tt.updates, updates); diff != "" {
+			t.Errorf("%s updates mismatch (-want +got):\n%s", tt.server, diff)
+		}
+	}
+
+	if _, err := BackdateAdded(context.Background(), ServerPlex, srv.URL, "wrong", PathMap{}, added); err == nil {
+		t.Error("BackdateAdded() with a wrong token returned no error")
+	}
+	if _, err := BackdateAdded(context.Background(), "emby", srv.URL, "secret", PathMap{}, added); err == nil {
+		t.Error("BackdateAdded() of an unsupported server returned no error")
+	}
+}
+
+func TestRefreshPlex(t *testing.T) {
+	var refreshed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/library/sections":
+			fmt.Fprint(w, `{"MediaContainer":{"Directory":[
+				{"key":"1","type":"movie","Location":[{"path":"/media/movies"}]},
+				{"key":"2","type":"show","Location":[{"path":"/media/tv/"},{"path":"/other/tv"}]}
+			]}}`)
+		case "/library/sections/1/refresh", "/library/sections/2/refresh":
+			refreshed = append(refreshed, r.URL.Path+" "+r.URL.Query().Get("path"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	local := filepath.Join(t.TempDir(), "lib")
+	targets := []string{
+		filepath.Join(local, "movies", "Heat (1995)", "Heat.1995.mkv"),
+		filepath.Join(local, "tv", "Andor", "Season 1", "Andor - S01E01.mkv"),
+		filepath.Join(local, "tv", "Andor", "Season 1", "Andor - S01E02.mkv"),
+		filepath.Join(local, "music", "Song.mp3"),
+		"/elsewhere/movies/Alien (1979)/Alien.1979.mkv",
+	}
+	n, err := RefreshPlex(context.Background(), srv.URL, "secret", PathMap{Local: local, Remote: "/media/"}, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/library/sections/1/refresh /media/movies/Heat (1995)",
+		"/library/sections/2/refresh /media/tv/Andor/Season 1",
+	}
+	if diff := cmp.Diff(want, refreshed); n != 2 || diff != "" {
+		t.Errorf("RefreshPlex() = %d, mismatch (-want +got):\n%s", n, diff)
+	}
+
+	if _, err := RefreshPlex(context.Background(), srv.URL, "wrong", PathMap{}, targets); err == nil {
+		t.Error("RefreshPlex() with a wrong token returned no error")
+	}
+}
@@ -0,0 +1,363 @@
+package kourai
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+)
+
+// skipCodes are the Skip constants, so that every reason is written as a
+// metric, also when no file was skipped for it
+var skipCodes = []string{
+	SkipExtension, SkipRegexp, SkipDuplicate, SkipLowConfidence, SkipUnparsed,
+	SkipUnsettled, SkipType, SkipNotSelected, SkipFilter, SkipProcessed,
+	SkipLinked, SkipIgnored, SkipUnreadable, SkipSize, SkipCorrupt,
+}
+
+// Metrics counts the links and skipped files of a run, to be written for
+// the textfile collector of the Prometheus node exporter, so that runs of
+// cron jobs, which can't be scraped, are monitored too. Its methods may be
+// called from several workers at once, and a nil Metrics counts nothing.
+type Metrics struct {
+	mu      sync.Mutex
+	command string
+	start   time.Time
+	planned int
+	created int
+	failed  int
+	skipped map[string]int
+}
+
+// NewMetrics starts counting a run of command, e.g. link.
+func NewMetrics(command string) *Metrics {
+	return &Metrics{command: command, start: time.Now(), skipped: map[string]int{}}
+}
+
+// Planned counts a link found by the run.
+func (m *Metrics) Planned(l Link) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.planned++
+}
+
+// Created counts a target created by the run.
+func (m *Metrics) Created(l Link) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.created++
+}
+
+// Failed counts links that failed, or were rolled back.
+func (m *Metrics) Failed(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed += n
+}
+
+// Skipped counts a skipped file; it can be given to WithSkipReport.
+func (m *Metrics) Skipped(s SkippedFile) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.skipped[s.Code]++
+}
+
+// WriteTextfile writes the metrics of the run, which ended now, to path in
+// the Prometheus text format. Run success is 1 when the run completed and
+// no link failed. The file is replaced atomically, as the collector may
+// read it at any time; its name must end in .prom for the collector to
+// read it.
+func (m *Metrics) WriteTextfile(path string, completed bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	success := 0
+	if completed && m.failed == 0 {
+		success = 1
+	}
+
+	var b bytes.Buffer
+	metric := func(name, help string, values func(func(labels string, v float64))) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		values(func(labels string, v float64) {
+			fmt.Fprintf(&b, "%s{command=%q%s} %v\n", name, m.command, labels, v)
+		})
+	}
+	single := func(v float64) func(func(string, float64)) {
+		return func(add func(string, float64)) { add("", v) }
+	}
+	metric("kourai_last_run_timestamp_seconds", "When the last run ended, as a Unix time.",
+		single(float64(now.Unix())))
+	metric("kourai_last_run_duration_seconds", "How long the last run took.",
+		single(now.Sub(m.start).Seconds()))
+	metric("kourai_last_run_success", "Whether the last run completed without failed links.",
+		single(float64(success)))
+	metric("kourai_last_run_links", "Links of the last run by result.", func(add func(string, float64)) {
+		add(`,result="planned"`, float64(m.planned))
+		add(`,result="created"`, float64(m.created))
+		add(`,result="failed"`, float64(m.failed))
+	})
+	metric("kourai_last_run_skipped_files", "Files skipped by the last run by reason.", func(add func(string, float64)) {
+		counts := map[string]int{}
+		for _, code := range skipCodes {
+			counts[code] = 0
+		}
+		codes := []string{}
+		for code, n := range m.skipped {
+			counts[code] = n
+		}
+		for code := range counts {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			add(fmt.Sprintf(",reason=%q", code), float64(counts[code]))
+		}
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// Temporary files are only readable by their owner
+	os.Chmod(tmp.Name(), 0644)
+	return os.Rename(tmp.Name(), path)
+}
+
+// durationBuckets are the upper bounds of the buckets of latency
+// histograms, in seconds
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// histogram counts observations by durationBuckets
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+	v := d.Seconds()
+	for i, le := range durationBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes h as the histogram name
+func (h *histogram) write(b *bytes.Buffer, name, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, le := range durationBuckets {
+		var n uint64
+		if h.counts != nil {
+			n = h.counts[i]
+		}
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(le, 'f', -1, 64), n)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %v\n%s_count %d\n", name, h.count, name, h.sum, name, h.count)
+}
+
+// ServiceMetrics counts the work of a long running watch or hook server,
+// see WithServiceMetrics, and serves it to Prometheus as an http.Handler,
+// e.g. on /metrics. Its methods may be called from several goroutines at
+// once, and a nil ServiceMetrics counts nothing.
+type ServiceMetrics struct {
+	mu       sync.Mutex
+	scanned  int
+	skipped  map[string]int
+	created  int
+	failed   int
+	tmdbHits int
+	tmdb     histogram
+	requests map[int]int
+	latency  histogram
+}
+
+// NewServiceMetrics returns metrics counting from now.
+func NewServiceMetrics() *ServiceMetrics {
+	return &ServiceMetrics{skipped: map[string]int{}, requests: map[int]int{}}
+}
+
+// WithServiceMetrics counts the files scanned and skipped and the TMDB
+// requests with m, and nil stops counting. TMDB requests are counted for
+// the whole process.
+func WithServiceMetrics(m *ServiceMetrics) Option {
+	return func(o *Options) {
+		o.service = m
+		if m == nil {
+			tmdb.SetObserver(nil)
+		} else {
+			tmdb.SetObserver(m.tmdbRequest)
+		}
+	}
+}
+
+// scan counts a file considered for linking
+func (m *ServiceMetrics) scan() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scanned++
+}
+
+// skip counts a file skipped for code, one of the Skip constants
+func (m *ServiceMetrics) skip(code string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.skipped[code]++
+}
+
+// Created counts a target created.
+func (m *ServiceMetrics) Created(l Link) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.created++
+}
+
+// Failed counts a link that failed.
+func (m *ServiceMetrics) Failed(l Link) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed++
+}
+
+// tmdbRequest counts a TMDB request, answered from a cache or sent
+func (m *ServiceMetrics) tmdbRequest(cached bool, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cached {
+		m.tmdbHits++
+		return
+	}
+	m.tmdb.observe(took)
+}
+
+// Instrument counts the requests served by h by status code, and their
+// latency.
+func (m *ServiceMetrics) Instrument(h http.Handler) http.Handler {
+	if m == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.requests[sw.status]++
+		m.latency.observe(time.Since(start))
+	})
+}
+
+// statusWriter records the status code written to a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format. The TMDB
+// cache hit rate is the rate of requests with cache="hit" over that of all
+// of them.
+func (m *ServiceMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	var b bytes.Buffer
+	counter := func(name, help string, values func(func(labels string, v int))) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		values(func(labels string, v int) {
+			fmt.Fprintf(&b, "%s%s %d\n", name, labels, v)
+		})
+	}
+	counter("kourai_files_scanned_total", "Files considered for linking.", func(add func(string, int)) {
+		add("", m.scanned)
+	})
+	counter("kourai_files_skipped_total", "Files skipped by reason; unparsed are those whose names couldn't be parsed.", func(add func(string, int)) {
+		counts := map[string]int{}
+		for _, code := range skipCodes {
+			counts[code] = 0
+		}
+		for code, n := range m.skipped {
+			counts[code] = n
+		}
+		codes := []string{}
+		for code := range counts {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			add(fmt.Sprintf("{reason=%q}", code), counts[code])
+		}
+	})
+	counter("kourai_links_total", "Links by result.", func(add func(string, int)) {
+		add(`{result="created"}`, m.created)
+		add(`{result="failed"}`, m.failed)
+	})
+	counter("kourai_tmdb_requests_total", "TMDB requests by whether they were answered from a cache.", func(add func(string, int)) {
+		add(`{cache="hit"}`, m.tmdbHits)
+		add(`{cache="miss"}`, int(m.tmdb.count))
+	})
+	m.tmdb.write(&b, "kourai_tmdb_request_duration_seconds", "Latency of the requests sent to TMDB, retries included.")
+	counter("kourai_http_requests_total", "Hook requests served by status code.", func(add func(string, int)) {
+		codes := []int{}
+		for code := range m.requests {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			add(fmt.Sprintf("{code=\"%d\"}", code), m.requests[code])
+		}
+	})
+	m.latency.write(&b, "kourai_http_request_duration_seconds", "Latency of the hook requests served.")
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(b.Bytes())
+}
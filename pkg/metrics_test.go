@@ -0,0 +1,98 @@
+package kourai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+)
+
+func TestMetricsTextfile(t *testing.T) {
+	m := NewMetrics("link")
+	l := Link{Src: "/dl/Heat.1995.mkv", Target: "/media/movies/Heat (1995)/Heat.1995.mkv"}
+	m.Planned(l)
+	m.Planned(l)
+	m.Created(l)
+	m.Failed(1)
+	m.Skipped(SkippedFile{Path: "/dl/notes.mkv", Code: SkipUnparsed})
+
+	path := filepath.Join(t.TempDir(), "kourai.prom")
+	if err := m.WriteTextfile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"# TYPE kourai_last_run_success gauge\n",
+		`kourai_last_run_success{command="link"} 0` + "\n",
+		`kourai_last_run_links{command="link",result="planned"} 2` + "\n",
+		`kourai_last_run_links{command="link",result="created"} 1` + "\n",
+		`kourai_last_run_links{command="link",result="failed"} 1` + "\n",
+		`kourai_last_run_skipped_files{command="link",reason="unparsed"} 1` + "\n",
+		`kourai_last_run_skipped_files{command="link",reason="duplicate"} 0` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteTextfile() wrote\n%s\nwant it to contain %q", got, want)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("WriteTextfile() left %d files, want only %s", len(entries), path)
+	}
+
+	var none *Metrics
+	none.Planned(l)
+	none.Skipped(SkippedFile{})
+}
+
+func TestServiceMetrics(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	m := NewServiceMetrics()
+	options.SetOptions(WithServiceMetrics(m), WithFileExtensions([]string{"mkv"}))
+	defer tmdb.SetObserver(nil)
+
+	root := t.TempDir()
+	for _, name := range []string{"Heat.1995.mkv", "Heat.1995.Sample.mkv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	media, errc := findFiles(context.Background(), root, options.fileFilters...)
+	for range media {
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	m.Created(Link{Src: filepath.Join(root, "Heat.1995.mkv")})
+	m.tmdbRequest(true, 0)
+	m.tmdbRequest(false, 300*time.Millisecond)
+	h := m.Instrument(http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		"kourai_files_scanned_total 3\n",
+		`kourai_files_skipped_total{reason="regexp"} 1` + "\n",
+		`kourai_links_total{result="created"} 1` + "\n",
+		`kourai_links_total{result="failed"} 0` + "\n",
+		`kourai_tmdb_requests_total{cache="hit"} 1` + "\n",
+		`kourai_tmdb_request_duration_seconds_bucket{le="0.25"} 0` + "\n",
+		`kourai_tmdb_request_duration_seconds_bucket{le="0.5"} 1` + "\n",
+		`kourai_http_requests_total{code="404"} 1` + "\n",
+		"kourai_http_request_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("metrics = %s\nwant them to contain %q", rec.Body.String(), line)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package kourai
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// LinkMode is the strategy a Link uses to create its target from its
+// source.
+type LinkMode string
+
+const (
+	// ModeHardlink hard links the source, leaving it in place. Sources on
+	// another filesystem are copied when the cross-device fallback is set.
+	ModeHardlink LinkMode = "hardlink"
+	// ModeCopy copies the source, leaving it in place.
+	ModeCopy LinkMode = "copy"
+	// ModeMove renames the source to the target, or copies and then deletes
+	// it when the target is on another filesystem.
+	ModeMove LinkMode = "move"
+)
+
+func ParseLinkMode(s string) (LinkMode, error) {
+	switch m := LinkMode(s); m {
+	case ModeHardlink, ModeCopy, ModeMove:
+		return m, nil
+	case "":
+		return ModeHardlink, nil
+	}
+	return "", fmt.Errorf("%w link mode %q, expected one of %s, %s or %s", ErrUnsupportedType, s, ModeHardlink, ModeCopy, ModeMove)
+}
+
+// transfer creates the target of ln from its source according to its mode.
+func (ln Link) transfer() error {
+	switch ln.Mode {
+	case ModeCopy:
+		return copyPath(ln.Src, ln.Target)
+	case ModeMove:
+		return movePath(ln.Src, ln.Target)
+	case ModeHardlink, "":
+		err := linkSource(ln.Src, ln.Target)
+		if err != nil && ln.copyFallback && isCrossDevice(err) {
+			// Copies replace existing targets, which the link may not have
+			// got to report
+			if _, err := os.Lstat(ln.Target); err == nil {
+				return fs.ErrExist
+			}
+			return copyPath(ln.Src, ln.Target)
+		}
+		return err
+	}
+	return fmt.Errorf("%w link mode %q", ErrUnsupportedType, ln.Mode)
+}
+
+// linkSource creates target as a link to src. Files are hard linked, while
+// directories, e.g. the BDMV and VIDEO_TS folders of discs, are linked with
+// the platform's linkDir: as NTFS junctions on Windows, and as trees of hard
+// links elsewhere.
+func linkSource(src, target string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return linkDir(src, target)
+	}
+	return os.Link(src, target)
+}
+
+// movePath renames src to target, falling back to copying and removing src
+// when they're on different filesystems.
+func movePath(src, target string) error {
+	err := os.Rename(src, target)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+	if err := copyPath(src, target); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
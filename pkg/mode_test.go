@@ -0,0 +1,165 @@
+package kourai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestParseLinkMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    LinkMode
+		wantErr bool
+	}{
+		{"", ModeHardlink, false},
+		{"hardlink", ModeHardlink, false},
+		{"copy", ModeCopy, false},
+		{"move", ModeMove, false},
+		{"symlink", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLinkMode(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr || (tt.wantErr && !errors.Is(err, ErrUnsupportedType)) {
+			t.Errorf("ParseLinkMode(%q) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLinkModes(t *testing.T) {
+	tests := []struct {
+		mode      LinkMode
+		srcKept   bool
+		sameFile  bool
+		createErr bool
+	}{
+		{mode: ModeHardlink, srcKept: true, sameFile: true},
+		{mode: ModeCopy, srcKept: true},
+		{mode: ModeMove},
+		{mode: "symlink", srcKept: true, createErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			root := t.TempDir()
+			ln := Link{
+				Src:    filepath.Join(root, "dl", "a.mkv"),
+				Target: filepath.Join(root, "movies", "A (2000)", "A (2000).mkv"),
+				Mode:   tt.mode,
+			}
+			os.MkdirAll(filepath.Dir(ln.Src), 0755)
+			if err := os.WriteFile(ln.Src, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			before, _ := os.Stat(ln.Src)
+
+			err := ln.Create()
+			if (err != nil) != tt.createErr {
+				t.Fatalf("Create() error = %v, want error %v", err, tt.createErr)
+			}
+			if _, err := os.Stat(ln.Src); (err == nil) != tt.srcKept {
+				t.Errorf("source exists = %v, want %v", err == nil, tt.srcKept)
+			}
+			if tt.createErr {
+				return
+			}
+			after, err := os.Stat(ln.Target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if os.SameFile(before, after) != (tt.sameFile || tt.mode == ModeMove) {
+				t.Errorf("target is the source = %v", os.SameFile(before, after))
+			}
+			if err := ln.Create(); !errors.Is(err, ErrTargetExists) {
+				t.Errorf("Create() over an existing target = %v, want ErrTargetExists", err)
+			}
+		})
+	}
+}
+
+func TestMovePath(t *testing.T) {
+	root := t.TempDir()
+	src, target := filepath.Join(root, "a"), filepath.Join(root, "b")
+	os.WriteFile(src, []byte("a"), 0644)
+	if err := movePath(src, target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("movePath() left the source behind")
+	}
+}
+
+func TestCreateRollback(t *testing.T) {
+	if _, err := exec.LookPath("restorecon"); err == nil {
+		t.Skip("restorecon is installed, permissions can't be made to fail")
+	}
+	perms := &Permissions{UID: -1, GID: -1, SELinuxContext: RestoreconContext}
+	for _, mode := range []LinkMode{ModeHardlink, ModeCopy, ModeMove} {
+		t.Run(string(mode), func(t *testing.T) {
+			root := t.TempDir()
+			ln := Link{
+				Src:    filepath.Join(root, "a.mkv"),
+				Target: filepath.Join(root, "movies", "A (2000)", "A (2000).mkv"),
+				Mode:   mode,
+				perms:  perms,
+			}
+			if err := os.WriteFile(ln.Src, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ln.Create(); err == nil {
+				t.Fatal("Create() with failing permissions returned no error")
+			}
+			if _, err := os.Stat(ln.Target); !os.IsNotExist(err) {
+				t.Errorf("target was left behind")
+			}
+			if _, err := os.Stat(ln.Src); err != nil {
+				t.Errorf("source is gone: %v", err)
+			}
+		})
+	}
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	for _, mode := range []LinkMode{ModeHardlink, ModeCopy, ModeMove} {
+		t.Run(string(mode), func(t *testing.T) {
+			root := t.TempDir()
+			target := filepath.Join(root, "tv", "Show", "Season 1", "Show - S01E01.mkv")
+			const n = 16
+			errs := make(chan error, n)
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				src := filepath.Join(root, "dl", fmt.Sprintf("%d.mkv", i))
+				os.MkdirAll(filepath.Dir(src), 0755)
+				if err := os.WriteFile(src, []byte{byte(i)}, 0644); err != nil {
+					t.Fatal(err)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- Link{Src: src, Target: target, Mode: mode}.Create()
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			created := 0
+			for err := range errs {
+				switch {
+				case err == nil:
+					created++
+				case !errors.Is(err, ErrTargetExists):
+					t.Errorf("Create() error = %v, want the target to exist already", err)
+				}
+			}
+			if created != 1 {
+				t.Errorf("%d of %d links to the same target were created, want 1", created, n)
+			}
+			if len(dirLocks.locks) != 0 {
+				t.Errorf("%d directory locks left held", len(dirLocks.locks))
+			}
+		})
+	}
+}
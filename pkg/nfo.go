@@ -0,0 +1,342 @@
+package kourai
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+)
+
+// ActorsDir is the folder of actor thumbnails Kodi reads next to movies
+// and in series folders.
+const ActorsDir = ".actors"
+
+// RatingSource is the rating written to NFOs.
+type RatingSource string
+
+const (
+	// RatingTMDB is the TMDB vote average
+	RatingTMDB RatingSource = "tmdb"
+	// RatingIMDb is the IMDb rating, looked up on OMDb by the IMDb ID
+	// found on TMDB. It needs an OMDb API key.
+	RatingIMDb RatingSource = "imdb"
+	// RatingNone leaves ratings out
+	RatingNone RatingSource = "none"
+)
+
+func ParseRatingSource(s string) (RatingSource, error) {
+	switch r := RatingSource(s); r {
+	case RatingTMDB, RatingIMDb, RatingNone:
+		return r, nil
+	case "":
+		return RatingTMDB, nil
+	}
+	return "", fmt.Errorf("%w rating source %q, expected one of %s, %s or %s", ErrUnsupportedType, s, RatingTMDB, RatingIMDb, RatingNone)
+}
+
+type nfoRating struct {
+	Name    string  `xml:"name,attr"`
+	Max     int     `xml:"max,attr"`
+	Default bool    `xml:"default,attr"`
+	Value   float64 `xml:"value"`
+	Votes   int     `xml:"votes,omitempty"`
+}
+
+type nfoUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr,omitempty"`
+	ID      string `xml:",chardata"`
+}
+
+type nfoActor struct {
+	Name  string `xml:"name"`
+	Role  string `xml:"role,omitempty"`
+	Order int    `xml:"order"`
+	Thumb string `xml:"thumb,omitempty"`
+}
+
+type movieNFO struct {
+	XMLName       xml.Name      `xml:"movie"`
+	Title         string        `xml:"title"`
+	OriginalTitle string        `xml:"originaltitle,omitempty"`
+	Year          int           `xml:"year,omitempty"`
+	Premiered     string        `xml:"premiered,omitempty"`
+	Runtime       uint32        `xml:"runtime,omitempty"`
+	Plot          string        `xml:"plot,omitempty"`
+	Ratings       []nfoRating   `xml:"ratings>rating,omitempty"`
+	UniqueIDs     []nfoUniqueID `xml:"uniqueid"`
+	Directors     []string      `xml:"director"`
+	Writers       []string      `xml:"credits"`
+	Actors        []nfoActor    `xml:"actor"`
+}
+
+type tvshowNFO struct {
+	XMLName       xml.Name      `xml:"tvshow"`
+	Title         string        `xml:"title"`
+	OriginalTitle string        `xml:"originaltitle,omitempty"`
+	Year          int           `xml:"year,omitempty"`
+	Premiered     string        `xml:"premiered,omitempty"`
+	Plot          string        `xml:"plot,omitempty"`
+	UniqueIDs     []nfoUniqueID `xml:"uniqueid"`
+}
+
+type episodeNFO struct {
+	XMLName   xml.Name      `xml:"episodedetails"`
+	Title     string        `xml:"title"`
+	ShowTitle string        `xml:"showtitle"`
+	Season    int           `xml:"season"`
+	Episode   int           `xml:"episode"`
+	Aired     string        `xml:"aired,omitempty"`
+	Plot      string        `xml:"plot,omitempty"`
+	Ratings   []nfoRating   `xml:"ratings>rating,omitempty"`
+	UniqueIDs []nfoUniqueID `xml:"uniqueid"`
+	Directors []string      `xml:"director"`
+	Writers   []string      `xml:"credits"`
+	Actors    []nfoActor    `xml:"actor"`
+}
+
+// nfoRatings returns the rating of the configured source
+func nfoRatings(ctx context.Context, tmdbRating float32, tmdbVotes uint32, imdbID string) ([]nfoRating, error) {
+	switch options.ratingSource {
+	case RatingNone:
+		return nil, nil
+	case RatingIMDb:
+		if imdbID == "" {
+			return nil, errors.New("no IMDb ID found on TMDB to look up the IMDb rating")
+		}
+		rating, votes, err := imdbRating(ctx, options.omdbKey, imdbID)
+		if err != nil {
+			return nil, err
+		}
+		return []nfoRating{{Name: "imdb", Max: 10, Default: true, Value: rating, Votes: votes}}, nil
+	}
+	if tmdbVotes == 0 {
+		return nil, nil
+	}
+	return []nfoRating{{Name: "themoviedb", Max: 10, Default: true, Value: float64(tmdbRating), Votes: int(tmdbVotes)}}, nil
+}
+
+// nfoCredits returns the directors, writers and actors of c. Guest stars
+// follow the regular cast.
+func nfoCredits(c tmdb.Credits) (directors, writers []string, actors []nfoActor) {
+	seen := map[string]bool{}
+	for _, m := range c.Crew {
+		switch {
+		case m.Job == "Director" && !seen["d"+m.Name]:
+			seen["d"+m.Name] = true
+			directors = append(directors, m.Name)
+		case m.Department == "Writing" && !seen["w"+m.Name]:
+			seen["w"+m.Name] = true
+			writers = append(writers, m.Name)
+		}
+	}
+	for _, m := range append(c.Cast, c.GuestStars...) {
+		a := nfoActor{Name: m.Name, Role: m.Character, Order: len(actors)}
+		if m.ProfilePath != "" {
+			a.Thumb = tmdb.ImageURL(m.ProfilePath, artworkSize)
+		}
+		actors = append(actors, a)
+	}
+	return directors, writers, actors
+}
+
+// actorThumbName is the file name of the thumbnail of an actor in a Kodi
+// .actors folder
+func actorThumbName(name string) string {
+	name = strings.NewReplacer(" ", "_", "/", "_", string(filepath.Separator), "_").Replace(name)
+	return name + ".jpg"
+}
+
+// placeActorThumbs downloads the profile images of cast into the .actors
+// folder in dir, keeping existing thumbnails
+func placeActorThumbs(ctx context.Context, dir string, cast []tmdb.CastMember, perms *Permissions) error {
+	dir = filepath.Join(dir, ActorsDir)
+	var errs []error
+	for _, m := range cast {
+		if m.ProfilePath == "" || m.Name == "" {
+			continue
+		}
+		if err := perms.mkdirAll(dir); err != nil {
+			return err
+		}
+		errs = append(errs, placeArtwork(ctx, m.ProfilePath, filepath.Join(dir, actorThumbName(m.Name)), perms))
+	}
+	return errors.Join(errs...)
+}
+
+// tvshowNFOs holds the tvshow.nfo paths written, or being written, so that
+// each is written once per run
+var tvshowNFOs sync.Map
+
+// writeTVShowNFO writes the tvshow.nfo of the series with the TMDB ID id
+// into its folder dir, unless it exists
+func writeTVShowNFO(ctx context.Context, dir string, id int, perms *Permissions) error {
+	path := filepath.Join(dir, "tvshow.nfo")
+	if _, done := tvshowNFOs.LoadOrStore(path, true); done {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	d, err := options.TMDBClient.TVDetails(ctx, id)
+	if err != nil {
+		tvshowNFOs.Delete(path)
+		return err
+	}
+	nfo := tvshowNFO{
+		Title:         d.Name,
+		OriginalTitle: d.OriginalName,
+		Plot:          d.Overview,
+		UniqueIDs:     []nfoUniqueID{{Type: "tmdb", Default: true, ID: strconv.Itoa(id)}},
+	}
+	if !d.FirstAirDate.IsZero() {
+		nfo.Year = d.FirstAirDate.Year()
+		nfo.Premiered = d.FirstAirDate.Format("2006-01-02")
+	}
+	return writeNFO(path, nfo, perms)
+}
+
+// NFO writes a Kodi NFO next to the target of ln, named after it, when NFO
+// export is enabled. The series folders of episodes get a tvshow.nfo too.
+// Existing NFOs are kept, as are media without a TMDB match. When the
+// rating can't be looked up, e.g. because OMDb failed or TMDB knows no IMDb
+// ID, the NFO is written without one. The NFO lists the cast and crew found
+// on TMDB, or none when they can't be looked up. With actor thumbnails
+// enabled, profile images of the cast are placed in the .actors folder next
+// to movies, or in the series folder of episodes.
+func (ln Link) NFO(ctx context.Context) error {
+	if !ln.nfo || options.TMDBClient == nil {
+		return nil
+	}
+	path := strings.TrimSuffix(ln.Target, filepath.Ext(ln.Target)) + ".nfo"
+	// Layouts without series folders get no tvshow.nfo
+	if m, ok := ln.media.(*episode); ok && m.tmdbID != 0 {
+		if seriesDir, _ := episodeFolders(ln.Target, m); seriesDir != "" {
+			if err := writeTVShowNFO(ctx, seriesDir, m.tmdbID, ln.perms); err != nil {
+				options.logger.Warn("failed to write tvshow.nfo", "path", seriesDir, "error", err)
+			}
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	var (
+		doc    any
+		thumbs func() error
+	)
+	switch m := ln.media.(type) {
+	case *movie:
+		if m.tmdbID == 0 {
+			return nil
+		}
+		d, err := options.TMDBClient.MovieDetails(ctx, m.tmdbID)
+		if err != nil {
+			return err
+		}
+		nfo := movieNFO{
+			Title:         d.Title,
+			OriginalTitle: d.OriginalTitle,
+			Runtime:       d.Runtime,
+			Plot:          d.Overview,
+			UniqueIDs:     []nfoUniqueID{{Type: "tmdb", Default: true, ID: strconv.Itoa(m.tmdbID)}},
+		}
+		if !d.ReleaseDate.IsZero() {
+			nfo.Year = d.ReleaseDate.Year()
+			nfo.Premiered = d.ReleaseDate.Format("2006-01-02")
+		}
+		if d.IMDbID != "" {
+			nfo.UniqueIDs = append(nfo.UniqueIDs, nfoUniqueID{Type: "imdb", ID: d.IMDbID})
+		}
+		if nfo.Ratings, err = nfoRatings(ctx, d.VoteAverage, d.VoteCount, d.IMDbID); err != nil {
+			options.logger.Warn("rating lookup failed, writing NFO without a rating", "path", path, "error", err)
+		}
+		credits, err := options.TMDBClient.MovieCredits(ctx, m.tmdbID)
+		if err != nil {
+			options.logger.Warn("TMDB credits lookup failed, writing NFO without credits", "path", path, "error", err)
+		}
+		nfo.Directors, nfo.Writers, nfo.Actors = nfoCredits(credits)
+		if ln.actorThumbs && err == nil {
+			thumbs = func() error {
+				return placeActorThumbs(ctx, filepath.Dir(ln.Target), credits.Cast, ln.perms)
+			}
+		}
+		doc = nfo
+	case *episode:
+		if m.tmdbID == 0 {
+			return nil
+		}
+		d, err := options.TMDBClient.EpisodeDetails(ctx, m.tmdbID, m.season, m.episode)
+		if err != nil {
+			return err
+		}
+		nfo := episodeNFO{
+			Title:     d.Name,
+			ShowTitle: m.series,
+			Season:    m.season,
+			Episode:   m.episode,
+			Plot:      d.Overview,
+			UniqueIDs: []nfoUniqueID{{Type: "tmdb", Default: true, ID: strconv.Itoa(int(d.ID))}},
+		}
+		if !d.AirDate.IsZero() {
+			nfo.Aired = d.AirDate.Format("2006-01-02")
+		}
+		var imdbID string
+		if options.ratingSource == RatingIMDb {
+			var ids tmdb.ExternalIDs
+			ids, err = options.TMDBClient.EpisodeExternalIDs(ctx, m.tmdbID, m.season, m.episode)
+			imdbID = ids.IMDbID
+		}
+		if err == nil {
+			nfo.Ratings, err = nfoRatings(ctx, d.VoteAverage, d.VoteCount, imdbID)
+		}
+		if err != nil {
+			options.logger.Warn("rating lookup failed, writing NFO without a rating", "path", path, "error", err)
+		}
+		credits, err := options.TMDBClient.EpisodeCredits(ctx, m.tmdbID, m.season, m.episode)
+		if err != nil {
+			options.logger.Warn("TMDB credits lookup failed, writing NFO without credits", "path", path, "error", err)
+		}
+		nfo.Directors, nfo.Writers, nfo.Actors = nfoCredits(credits)
+		// The series folder is shared by all episodes, so only the regular
+		// cast gets thumbnails there. Layouts without one get none.
+		if seriesDir, _ := episodeFolders(ln.Target, m); ln.actorThumbs && err == nil && seriesDir != "" {
+			thumbs = func() error {
+				return placeActorThumbs(ctx, seriesDir, credits.Cast, ln.perms)
+			}
+		}
+		doc = nfo
+	default:
+		return nil
+	}
+	if err := writeNFO(path, doc, ln.perms); err != nil {
+		return err
+	}
+	if thumbs != nil {
+		return thumbs()
+	}
+	return nil
+}
+
+func writeNFO(path string, doc any, perms *Permissions) error {
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append([]byte(xml.Header), append(b, '\n')...)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return perms.applyFile(path)
+}
@@ -0,0 +1,185 @@
+package kourai
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+)
+
+// LocalProvider looks media up in files next to them, without the network.
+// Local providers are consulted before the MetadataProvider, which isn't
+// asked about media they know the name of. What they return may be
+// partial, e.g. IDs without a title, which the MetadataProvider then looks
+// up by ID.
+type LocalProvider interface {
+	// Movie returns what is known of the movie at path, and whether
+	// anything is
+	Movie(path string) (MovieMetadata, bool)
+	// Episode returns what is known of the episode at path and its series,
+	// and whether anything is
+	Episode(path string, season, episode int) (SeriesMetadata, EpisodeMetadata, bool)
+}
+
+// WithLocalProviders consults ps, in order, before looking media up online.
+func WithLocalProviders(ps ...LocalProvider) Option {
+	return func(o *Options) {
+		o.local = ps
+	}
+}
+
+// localNFO is what NFOs of movies, series and episodes have in common
+type localNFO struct {
+	Title     string        `xml:"title"`
+	Year      int           `xml:"year"`
+	Premiered string        `xml:"premiered"`
+	Season    int           `xml:"season"`
+	Episode   int           `xml:"episode"`
+	UniqueIDs []nfoUniqueID `xml:"uniqueid"`
+	// ID is the IMDb or TMDB ID of NFOs of older versions of Kodi
+	ID string `xml:"id"`
+}
+
+// ids returns the TMDB and IMDb IDs of n
+func (n localNFO) ids() (tmdbID int, imdbID string) {
+	for _, id := range n.UniqueIDs {
+		switch strings.ToLower(id.Type) {
+		case "tmdb":
+			tmdbID, _ = strconv.Atoi(strings.TrimSpace(id.ID))
+		case "imdb":
+			imdbID = strings.TrimSpace(id.ID)
+		}
+	}
+	if id := strings.TrimSpace(n.ID); strings.HasPrefix(id, "tt") && imdbID == "" {
+		imdbID = id
+	} else if n, err := strconv.Atoi(id); err == nil && tmdbID == 0 {
+		tmdbID = n
+	}
+	return tmdbID, imdbID
+}
+
+// year returns the year of n, or of its premiere
+func (n localNFO) year() int {
+	if n.Year == 0 && len(n.Premiered) >= 4 {
+		y, _ := strconv.Atoi(n.Premiered[:4])
+		return y
+	}
+	return n.Year
+}
+
+// readLocalNFO reads the NFO at path with the given root element. NFOs
+// that are missing, only a URL, or of something else are reported as not
+// found.
+func readLocalNFO(path, root string) (localNFO, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return localNFO{}, false
+	}
+	defer f.Close()
+	var nfo struct {
+		XMLName xml.Name
+		localNFO
+	}
+	// Kodi allows a URL after the document, which is left unread
+	if err := xml.NewDecoder(f).Decode(&nfo); err != nil || nfo.XMLName.Local != root {
+		return localNFO{}, false
+	}
+	return nfo.localNFO, true
+}
+
+// NFOProvider reads the Kodi NFOs next to media: <name>.nfo or movie.nfo
+// of movies, and tvshow.nfo in the folder of a series, maybe above a season
+// folder, along with <name>.nfo of episodes.
+type NFOProvider struct{}
+
+func (NFOProvider) Movie(path string) (MovieMetadata, bool) {
+	dir := filepath.Dir(path)
+	for _, name := range []string{strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".nfo", "movie.nfo"} {
+		nfo, ok := readLocalNFO(filepath.Join(dir, name), "movie")
+		if !ok {
+			continue
+		}
+		m := MovieMetadata{Title: strings.TrimSpace(nfo.Title), Year: nfo.year()}
+		m.TMDBID, m.IMDbID = nfo.ids()
+		return m, true
+	}
+	return MovieMetadata{}, false
+}
+
+func (NFOProvider) Episode(path string, season, episode int) (SeriesMetadata, EpisodeMetadata, bool) {
+	var s SeriesMetadata
+	var e EpisodeMetadata
+	found := false
+	dir := filepath.Dir(path)
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		if nfo, ok := readLocalNFO(filepath.Join(d, "tvshow.nfo"), "tvshow"); ok {
+			s.Name = strings.TrimSpace(nfo.Title)
+			s.TMDBID, s.IMDbID = nfo.ids()
+			s.ID = strconv.Itoa(s.TMDBID)
+			found = true
+			break
+		}
+	}
+	// The NFO of an episode is only trusted when it's of the same episode
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".nfo"
+	if nfo, ok := readLocalNFO(filepath.Join(dir, name), "episodedetails"); ok && nfo.Season == season && nfo.Episode == episode {
+		e.Title = strings.TrimSpace(nfo.Title)
+		found = true
+	}
+	return s, e, found
+}
+
+// lookupLocal names m after what the local providers know of it, reporting
+// whether it's fully named, so that it needn't be looked up online.
+func lookupLocal(m Linkable) bool {
+	for _, p := range options.local {
+		switch v := m.(type) {
+		case *movie:
+			md, ok := p.Movie(v.path)
+			if !ok {
+				continue
+			}
+			// IDs of the NFO spare the search, and the media is matched by
+			// the NFO once they're looked up
+			if md.TMDBID != 0 {
+				v.tmdbID, v.matchedBy = md.TMDBID, MatchedByNFO
+			}
+			if md.IMDbID != "" && v.external.source == "" {
+				v.external, v.matchedBy = externalID{tmdb.SourceIMDb, md.IMDbID}, MatchedByNFO
+			}
+			if md.Title == "" {
+				continue
+			}
+			v.title, v.matchedBy = md.Title, MatchedByNFO
+			if md.Year != 0 {
+				v.year, v.released = md.Year, md.Year
+			}
+			return true
+		case *episode:
+			show, ep, ok := p.Episode(v.path, v.season, v.episode)
+			if !ok {
+				continue
+			}
+			if show.TMDBID != 0 {
+				v.tmdbID, v.matchedBy = show.TMDBID, MatchedByNFO
+			}
+			if show.IMDbID != "" && v.external.source == "" {
+				v.external, v.matchedBy = externalID{tmdb.SourceIMDb, show.IMDbID}, MatchedByNFO
+			}
+			if show.Name != "" {
+				v.series = show.Name
+			}
+			if ep.Title != "" {
+				v.title = ep.Title
+			}
+			if show.Name != "" && ep.Title != "" {
+				v.matchedBy = MatchedByNFO
+				return true
+			}
+		}
+	}
+	return false
+}
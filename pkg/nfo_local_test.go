@@ -0,0 +1,78 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNFOProvider(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	options.SetOptions(WithLocalProviders(NFOProvider{}))
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"Movie/movie.nfo": `<?xml version="1.0" encoding="UTF-8" standalone="yes" ?>
+<movie><title>Heat</title><premiered>1995-12-15</premiered><uniqueid type="tmdb" default="true">949</uniqueid><uniqueid type="imdb">tt0113277</uniqueid></movie>`,
+		"Movie/heat.mkv": "",
+		// NFOs named after the file win, and may be followed by a URL
+		"Named/movie.nfo": `<movie><title>Wrong</title></movie>`,
+		"Named/dune.nfo":  "<movie><title>Dune</title><year>2021</year></movie>\nhttps://www.themoviedb.org/movie/438631",
+		"Named/dune.mkv":  "",
+		// IDs without a title are left for online lookups
+		"IDOnly/movie.nfo":                  `<movie><id>tt0133093</id></movie>`,
+		"IDOnly/matrix.mkv":                 "",
+		"URLOnly/movie.nfo":                 "https://www.themoviedb.org/movie/603",
+		"URLOnly/dune.mkv":                  "",
+		"Show/tvshow.nfo":                   `<tvshow><title>The Wire</title><uniqueid type="tmdb">1438</uniqueid></tvshow>`,
+		"Show/Season 1/the.wire.s01e01.nfo": `<episodedetails><title>The Target</title><season>1</season><episode>1</episode></episodedetails>`,
+		"Show/Season 1/the.wire.s01e01.mkv": "",
+		// NFOs of other episodes are ignored
+		"Show/Season 1/the.wire.s01e02.nfo": `<episodedetails><title>The Target</title><season>1</season><episode>1</episode></episodedetails>`,
+		"Show/Season 1/the.wire.s01e02.mkv": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		want  Linkable
+		named bool
+	}{
+		{"Movie/heat.mkv", &movie{title: "Heat", year: 1995, released: 1995, tmdbID: 949, external: externalID{"imdb_id", "tt0113277"}, matchedBy: MatchedByNFO}, true},
+		{"Named/dune.mkv", &movie{title: "Dune", year: 2021, released: 2021, matchedBy: MatchedByNFO}, true},
+		{"IDOnly/matrix.mkv", &movie{title: "Matrix", external: externalID{"imdb_id", "tt0133093"}, matchedBy: MatchedByNFO}, false},
+		{"URLOnly/dune.mkv", &movie{title: "Dune"}, false},
+		{"Show/Season 1/the.wire.s01e01.mkv", &episode{series: "The Wire", title: "The Target", id: "s01e01", season: 1, episode: 1, tmdbID: 1438, matchedBy: MatchedByNFO}, true},
+		{"Show/Season 1/the.wire.s01e02.mkv", &episode{series: "The Wire", id: "s01e02", season: 1, episode: 2, tmdbID: 1438, matchedBy: MatchedByNFO}, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.path)
+		l, err := NewLinkable(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if named := lookupLocal(l); named != tt.named {
+			t.Errorf("lookupLocal(%s) = %v, want %v", tt.path, named, tt.named)
+		}
+		switch v := tt.want.(type) {
+		case *movie:
+			v.path = path
+		case *episode:
+			v.path = path
+		}
+		if diff := cmp.Diff(tt.want, l, cmp.AllowUnexported(movie{}, episode{}, externalID{}, quality{})); diff != "" {
+			t.Errorf("lookupLocal(%s) mismatch (-want +got):\n%s", tt.path, diff)
+		}
+	}
+}
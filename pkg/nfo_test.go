@@ -0,0 +1,381 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+	"github.com/google/go-cmp/cmp"
+)
+
+// rewriteTransport sends all requests to the host of u
+type rewriteTransport struct {
+	u *url.URL
+}
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.u.Scheme
+	req.URL.Host = rt.u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// fakeTMDB answers the requests of the TMDB client with h until the test
+// ends. Responses cached in memory by earlier tests are forgotten.
+func fakeTMDB(t *testing.T, h http.Handler) {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	u, _ := url.Parse(srv.URL)
+	client := options.TMDBClient
+	tmdb.SetHTTPClient(&http.Client{Transport: rewriteTransport{u}})
+	tmdb.ResetCache()
+	options.TMDBClient = tmdb.New("test")
+	t.Cleanup(func() {
+		tmdb.SetHTTPClient(nil)
+		tmdb.ResetCache()
+		options.TMDBClient = client
+		srv.Close()
+	})
+}
+
+func TestNFORatings(t *testing.T) {
+	defer func(r RatingSource) { options.ratingSource = r }(options.ratingSource)
+
+	options.ratingSource = RatingTMDB
+	got, err := nfoRatings(context.Background(), 7.5, 120, "tt0000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []nfoRating{{Name: "themoviedb", Max: 10, Default: true, Value: 7.5, Votes: 120}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("nfoRatings() mismatch (-want +got):\n%s", diff)
+	}
+
+	options.ratingSource = RatingNone
+	if got, err := nfoRatings(context.Background(), 7.5, 120, "tt0000001"); err != nil || got != nil {
+		t.Errorf("nfoRatings() with no rating source = %v, %v", got, err)
+	}
+
+	options.ratingSource = RatingIMDb
+	if _, err := nfoRatings(context.Background(), 7.5, 120, ""); err == nil {
+		t.Error("nfoRatings() of IMDb without an IMDb ID returned no error")
+	}
+}
+
+func TestWriteNFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movie.nfo")
+	nfo := movieNFO{
+		Title:     "Dune",
+		Year:      2021,
+		Ratings:   []nfoRating{{Name: "imdb", Max: 10, Default: true, Value: 8, Votes: 900}},
+		UniqueIDs: []nfoUniqueID{{Type: "tmdb", Default: true, ID: "438631"}, {Type: "imdb", ID: "tt1160419"}},
+	}
+	if err := writeNFO(path, nfo, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<movie>
+  <title>Dune</title>
+  <year>2021</year>
+  <ratings>
+    <rating name="imdb" max="10" default="true">
+      <value>8</value>
+      <votes>900</votes>
+    </rating>
+  </ratings>
+  <uniqueid type="tmdb" default="true">438631</uniqueid>
+  <uniqueid type="imdb">tt1160419</uniqueid>
+</movie>
+`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Errorf("writeNFO() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNFOCredits(t *testing.T) {
+	credits := tmdb.Credits{
+		Cast: []tmdb.CastMember{
+			{Name: "Timothée Chalamet", Character: "Paul Atreides", ProfilePath: "/paul.jpg"},
+			{Name: "Zendaya", Character: "Chani"},
+		},
+		GuestStars: []tmdb.CastMember{{Name: "Guest", Character: "Someone"}},
+		Crew: []tmdb.CrewMember{
+			{Name: "Denis Villeneuve", Department: "Directing", Job: "Director"},
+			{Name: "Denis Villeneuve", Department: "Writing", Job: "Screenplay"},
+			{Name: "Eric Roth", Department: "Writing", Job: "Screenplay"},
+			{Name: "Eric Roth", Department: "Writing", Job: "Novel"},
+			{Name: "Hans Zimmer", Department: "Sound", Job: "Original Music Composer"},
+		},
+	}
+	directors, writers, actors := nfoCredits(credits)
+	if diff := cmp.Diff([]string{"Denis Villeneuve"}, directors); diff != "" {
+		t.Errorf("nfoCredits() directors mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"Denis Villeneuve", "Eric Roth"}, writers); diff != "" {
+		t.Errorf("nfoCredits() writers mismatch (-want +got):\n%s", diff)
+	}
+	want := []nfoActor{
+		{Name: "Timothée Chalamet", Role: "Paul Atreides", Order: 0, Thumb: "https://image.tmdb.org/t/p/original/paul.jpg"},
+		{Name: "Zendaya", Role: "Chani", Order: 1},
+		{Name: "Guest", Role: "Someone", Order: 2},
+	}
+	if diff := cmp.Diff(want, actors); diff != "" {
+		t.Errorf("nfoCredits() actors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestActorThumbName(t *testing.T) {
+	tests := map[string]string{
+		"Zendaya":          "Zendaya.jpg",
+		"Rebecca Ferguson": "Rebecca_Ferguson.jpg",
+		"AC/DC":            "AC_DC.jpg",
+	}
+	for name, want := range tests {
+		if got := actorThumbName(name); got != want {
+			t.Errorf("actorThumbName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestEpisodeNFOCredits(t *testing.T) {
+	defer func(r RatingSource) { options.ratingSource = r }(options.ratingSource)
+	options.ratingSource = RatingNone
+
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/credits"):
+			fmt.Fprint(w, `{"cast":[{"name":"Regular","character":"Lead","profile_path":"/regular.jpg"}],
+				"guest_stars":[{"name":"Guest","character":"Villain","profile_path":"/guest.jpg"}]}`)
+		case strings.HasPrefix(r.URL.Path, "/3/tv/"):
+			fmt.Fprint(w, `{"id":9001,"name":"Pilot","overview":"It begins."}`)
+		default:
+			w.Write([]byte("image"))
+		}
+	}))
+
+	dest := t.TempDir()
+	target := filepath.Join(dest, "Show", "Season 1", "Show - S01E01.mkv")
+	ln := Link{
+		Target:      target,
+		nfo:         true,
+		actorThumbs: true,
+		media:       &episode{series: "Show", season: 1, episode: 1, tmdbID: 764001},
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ln.NFO(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(strings.TrimSuffix(target, ".mkv") + ".nfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<name>Regular</name>", "<name>Guest</name>", "<role>Villain</role>"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("NFO lacks %s:\n%s", want, b)
+		}
+	}
+
+	// Only the regular cast belongs in the series folder
+	entries, err := os.ReadDir(filepath.Join(dest, "Show", ActorsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if diff := cmp.Diff([]string{"Regular.jpg"}, got); diff != "" {
+		t.Errorf("actor thumbnails mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEpisodeActorThumbsWithoutSeriesFolder(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	options.ratingSource = RatingNone
+	tmpl, err := ParseTargetTemplate(`{{.Series}} - {{.EpisodeID}}{{.Ext}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.episodeTarget = tmpl
+
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/credits"):
+			fmt.Fprint(w, `{"cast":[{"name":"Regular","character":"Lead","profile_path":"/regular.jpg"}]}`)
+		case strings.HasPrefix(r.URL.Path, "/3/tv/"):
+			fmt.Fprint(w, `{"id":9002,"name":"Pilot"}`)
+		default:
+			w.Write([]byte("image"))
+		}
+	}))
+
+	dest := t.TempDir()
+	ln := Link{
+		Target:      filepath.Join(dest, "Show - S01E01.mkv"),
+		nfo:         true,
+		actorThumbs: true,
+		media:       &episode{series: "Show", season: 1, episode: 1, tmdbID: 764002},
+	}
+	if err := ln.NFO(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Thumbnails would land in the parent of the destination
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dest), ActorsDir)); !os.IsNotExist(err) {
+		t.Errorf("actor thumbnails placed outside the destination: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, ActorsDir)); !os.IsNotExist(err) {
+		t.Errorf("actor thumbnails placed without a series folder: %v", err)
+	}
+}
+
+func TestMovieNFOWithoutCredits(t *testing.T) {
+	defer func(r RatingSource) { options.ratingSource = r }(options.ratingSource)
+	options.ratingSource = RatingNone
+
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/credits") {
+			fmt.Fprint(w, "not json")
+			return
+		}
+		fmt.Fprint(w, `{"id":764002,"title":"Dune","release_date":"2021-09-15"}`)
+	}))
+
+	target := filepath.Join(t.TempDir(), "Dune (2021).mkv")
+	ln := Link{
+		Target:      target,
+		nfo:         true,
+		actorThumbs: true,
+		media:       &movie{title: "Dune", year: 2021, tmdbID: 764002},
+	}
+	if err := ln.NFO(context.Background()); err != nil {
+		t.Fatalf("NFO() with failing credits lookup = %v", err)
+	}
+	b, err := os.ReadFile(strings.TrimSuffix(target, ".mkv") + ".nfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<title>Dune</title>") || strings.Contains(string(b), "<actor>") {
+		t.Errorf("unexpected NFO without credits:\n%s", b)
+	}
+}
+
+func TestTVShowNFO(t *testing.T) {
+	defer func(r RatingSource) { options.ratingSource = r }(options.ratingSource)
+	options.ratingSource = RatingNone
+
+	var seriesRequests atomic.Int32
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/3/tv/768001":
+			seriesRequests.Add(1)
+			fmt.Fprint(w, `{"id":768001,"name":"The Wire","original_name":"The Wire","first_air_date":"2002-06-02","overview":"Baltimore."}`)
+		case strings.HasSuffix(r.URL.Path, "/credits"):
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprint(w, `{"id":9003,"name":"The Target"}`)
+		}
+	}))
+
+	dest := t.TempDir()
+	for _, name := range []string{"The Wire - S01E01.mkv", "The Wire - S01E02.mkv"} {
+		target := filepath.Join(dest, "The Wire (2002)", "Season 1", name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		ln := Link{Target: target, nfo: true, media: &episode{series: "The Wire", season: 1, episode: 1, tmdbID: 768001}}
+		if err := ln.NFO(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := seriesRequests.Load(); n != 1 {
+		t.Errorf("series looked up %d times, want 1", n)
+	}
+
+	// The NFO is read back by NFOProvider
+	nfo, ok := readLocalNFO(filepath.Join(dest, "The Wire (2002)", "tvshow.nfo"), "tvshow")
+	if !ok {
+		t.Fatal("no tvshow.nfo written")
+	}
+	if tmdbID, _ := nfo.ids(); nfo.Title != "The Wire" || nfo.year() != 2002 || tmdbID != 768001 {
+		t.Errorf("unexpected tvshow.nfo: %+v", nfo)
+	}
+}
+
+func TestNFOWithoutRating(t *testing.T) {
+	defer func(r RatingSource, key string) { options.ratingSource, options.omdbKey = r, key }(options.ratingSource, options.omdbKey)
+	options.ratingSource, options.omdbKey = RatingIMDb, "secret"
+
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("apikey") != "":
+			fmt.Fprint(w, `{"Response":"False","Error":"Request limit reached!"}`)
+		case strings.HasSuffix(r.URL.Path, "/credits"):
+			fmt.Fprint(w, `{}`)
+		case strings.HasSuffix(r.URL.Path, "/external_ids"):
+			fmt.Fprint(w, `{}`)
+		case strings.HasPrefix(r.URL.Path, "/3/movie/"):
+			fmt.Fprint(w, `{"id":764101,"title":"Dune","imdb_id":"tt1160419","vote_average":7.8,"vote_count":100}`)
+		default:
+			fmt.Fprint(w, `{"id":9003,"name":"Pilot","vote_average":7.8,"vote_count":100}`)
+		}
+	}))
+
+	dest := t.TempDir()
+	links := []Link{
+		// OMDb fails
+		{Target: filepath.Join(dest, "Dune (2021).mkv"), nfo: true, media: &movie{title: "Dune", year: 2021, tmdbID: 764101}},
+		// TMDB knows no IMDb ID
+		{Target: filepath.Join(dest, "Show - S01E01.mkv"), nfo: true, media: &episode{series: "Show", season: 1, episode: 1, tmdbID: 764102}},
+	}
+	for _, ln := range links {
+		if err := ln.NFO(context.Background()); err != nil {
+			t.Fatalf("NFO() with a failing rating lookup = %v", err)
+		}
+		b, err := os.ReadFile(strings.TrimSuffix(ln.Target, ".mkv") + ".nfo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), "<title>") || strings.Contains(string(b), "<rating ") {
+			t.Errorf("unexpected NFO without a rating:\n%s", b)
+		}
+	}
+}
+
+// failingTransport fails every request
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestIMDbRatingRedactsKey(t *testing.T) {
+	defer func(rt http.RoundTripper) { http.DefaultClient.Transport = rt }(http.DefaultClient.Transport)
+	http.DefaultClient.Transport = failingTransport{}
+
+	_, _, err := imdbRating(context.Background(), "secret-key", "tt1160419")
+	if err == nil {
+		t.Fatal("imdbRating() with a failing connection returned no error")
+	}
+	if strings.Contains(err.Error(), "secret-key") {
+		t.Errorf("imdbRating() error leaks the API key: %v", err)
+	}
+	if !strings.Contains(err.Error(), "tt1160419") {
+		t.Errorf("imdbRating() error lacks the IMDb ID: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// omdbRating is the IMDb rating of a title, as returned by OMDb
+type omdbRating struct {
+	Response   string `json:"Response"`
+	Error      string `json:"Error"`
+	IMDbRating string `json:"imdbRating"`
+	IMDbVotes  string `json:"imdbVotes"`
+}
+
+// imdbRating returns the IMDb rating and number of votes of the title with
+// the given IMDb ID from OMDb.
+func imdbRating(ctx context.Context, apiKey, imdbID string) (float64, int, error) {
+	u := fmt.Sprintf("https://www.omdbapi.com/?i=%s&apikey=%s", url.QueryEscape(imdbID), url.QueryEscape(apiKey))
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The error includes the URL, which shouldn't leak the key into logs
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = fmt.Sprintf("https://www.omdbapi.com/?i=%s&apikey=xxxxx", url.QueryEscape(imdbID))
+		}
+		return 0, 0, err
+	}
+	defer res.Body.Close()
+
+	var r omdbRating
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse OMDb response with error %w", err)
+	}
+	if r.Response == "False" {
+		return 0, 0, fmt.Errorf("OMDb lookup of %s failed: %s", imdbID, r.Error)
+	}
+	rating, err := strconv.ParseFloat(r.IMDbRating, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("no IMDb rating for %s", imdbID)
+	}
+	votes, _ := strconv.Atoi(strings.ReplaceAll(r.IMDbVotes, ",", ""))
+	return rating, votes, nil
+}
@@ -0,0 +1,186 @@
+package kourai
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types of media, as told apart by DetectType
+const (
+	TypeMovie   = "movie"
+	TypeEpisode = "episode"
+)
+
+// DetectType returns TypeEpisode when the name of the file at path numbers
+// an episode, e.g. "Show.S01E02.mkv", "Show.1x02.mkv", "Show.2024.05.01.mkv"
+// or "[Group] Show - 02.mkv", or when its folders do, e.g.
+// "Show.S01E02/video.mkv", and TypeMovie otherwise. Extras are of the type
+// of the media they belong to. The file isn't accessed.
+func DetectType(path string) string {
+	_, parent := parseExtra(path)
+	return detectType(parent)
+}
+
+// detectType returns the type of the media at path, which is no extra
+func detectType(path string) string {
+	base := filepath.Base(path)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	if episodeExpr.FindString(path) != "" || crossExpr.MatchString(base) || airDateExpr.MatchString(base) || animeExpr.MatchString(name) {
+		return TypeEpisode
+	}
+	return TypeMovie
+}
+
+// SeriesFolder is the series, and maybe the season, parsed from the name of
+// a folder by ParseSeriesFolder.
+type SeriesFolder struct {
+	Series string
+	Year   int
+	// TMDBID is that of the provider ID tag of the series, e.g.
+	// {tmdb-1438}, or 0
+	TMDBID int
+	// Season is that of a season folder or pack, 0 for specials, or -1 for
+	// the folder of a whole series
+	Season int
+}
+
+// ParseSeriesFolder parses the series and season of the folder at path,
+// which is either the folder of a series, e.g. "The Wire (2002)", a season
+// folder below it, e.g. "The Wire (2002)/Season 2" or "The Wire/Specials",
+// or a season pack, e.g. "The.Wire.S02.1080p.BluRay-GROUP". The folder isn't
+// accessed.
+func ParseSeriesFolder(path string) (SeriesFolder, error) {
+	path = filepath.Clean(path)
+	base := filepath.Base(path)
+	if strings.EqualFold(base, "Specials") {
+		return parseSeriesName(filepath.Base(filepath.Dir(path)), 0, path)
+	}
+	if m := seasonDirExpr.FindStringSubmatch(base); m != nil {
+		season, _ := strconv.Atoi(m[1])
+		return parseSeriesName(filepath.Base(filepath.Dir(path)), season, path)
+	}
+	var tmdbID int
+	var external externalID
+	name := stripReleaseTags(providerIDs(base, &tmdbID, &external))
+	if loc := sentinelExpr.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	}
+	if h, err := ParseDiscHint(strings.TrimRight(name, " ._-")); err == nil {
+		return SeriesFolder{Series: h.Series, Year: h.Year, TMDBID: tmdbID, Season: h.Season}, nil
+	}
+	return parseSeriesName(base, -1, path)
+}
+
+// parseSeriesName parses the name of the folder of a series, that of the
+// season folder at path
+func parseSeriesName(name string, season int, path string) (SeriesFolder, error) {
+	f := SeriesFolder{Season: season}
+	var external externalID
+	name = stripReleaseTags(providerIDs(name, &f.TMDBID, &external))
+	if loc := sentinelExpr.FindStringIndex(name); loc != nil && loc[0] > 0 {
+		name = name[:loc[0]]
+	}
+	if year, loc := findYear(name); loc != nil && loc[0] > 0 {
+		f.Year = year
+		name = name[:loc[0]]
+	}
+	f.Series = makeTitle(strings.TrimRight(name, " ([-._"))
+	if f.Series == "" {
+		return SeriesFolder{}, fmt.Errorf("%w: could not determine the series of folder \"%s\"", ErrNoTitle, path)
+	}
+	return f, nil
+}
+
+// EpisodeID is the numbering of an episode parsed from its name by
+// ParseEpisodeID.
+type EpisodeID struct {
+	// ID is that of the name rewritten in lower case, with numbers of at
+	// least two digits, e.g. "s01e02e03" for "S01E02-E03", "S1E2E3" or
+	// "1x02-1x03"
+	ID      string
+	Season  int
+	Episode int
+	// Absolute is the number of absolutely numbered episodes, e.g. 1052
+	// for "[Group] Show - 1052", which are numbered as the episode of the
+	// first season until they're looked up, or 0
+	Absolute int
+	// AirDate is that of the episodes of daily shows, whose ID is the date,
+	// e.g. "2024-05-01", and whose season is its year until they're looked
+	// up
+	AirDate time.Time
+}
+
+// ParseEpisodeID parses the season and episode numbered by name, the name of
+// an episode without its extension, e.g. "Show.S01E02.Pilot", or only its
+// ID, e.g. "S01E02" or "2024.05.01". The series name isn't needed. It
+// returns ErrNoEpisodeID when name numbers no episode.
+func ParseEpisodeID(name string) (EpisodeID, error) {
+	var tmdbID int
+	var external externalID
+	name = providerIDs(name, &tmdbID, &external)
+	// As in EpisodeFromPath, season and episode IDs take precedence
+	if episodeExpr.FindStringIndex(name) == nil && crossExpr.FindStringIndex(name) == nil {
+		if m := animeExpr.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			return EpisodeID{ID: fmt.Sprintf("s01e%02d", n), Season: 1, Episode: n, Absolute: n}, nil
+		}
+		if loc := airDateExpr.FindStringSubmatchIndex(name); loc != nil {
+			date, err := parseAirDate(name, loc)
+			if err != nil {
+				return EpisodeID{}, fmt.Errorf("%w: %w", ErrNoEpisodeID, err)
+			}
+			return EpisodeID{ID: date.Format("2006-01-02"), Season: date.Year(), AirDate: date}, nil
+		}
+	}
+	name = stripReleaseTags(name)
+	var season int
+	var episodes []int
+	if m := episodeExpr.FindStringSubmatch(name); m != nil {
+		season, _ = strconv.Atoi(m[1][1:])
+		for _, n := range strings.Split(strings.ToLower(m[2]+m[3]), "e")[1:] {
+			e, _ := strconv.Atoi(n)
+			episodes = append(episodes, e)
+		}
+	} else if m := crossExpr.FindStringSubmatch(name); m != nil {
+		season, _ = strconv.Atoi(m[1])
+		e, _ := strconv.Atoi(m[2])
+		episodes = append(episodes, e)
+		for _, next := range crossNext.FindAllStringSubmatch(m[3], -1) {
+			e, _ := strconv.Atoi(next[1])
+			episodes = append(episodes, e)
+		}
+	} else {
+		return EpisodeID{}, fmt.Errorf("%w given name \"%s\"", ErrNoEpisodeID, name)
+	}
+	id := fmt.Sprintf("s%02d", season)
+	for _, e := range episodes {
+		id += fmt.Sprintf("e%02d", e)
+	}
+	return EpisodeID{ID: id, Season: season, Episode: episodes[0]}, nil
+}
+
+// CleanTitle returns the title of the movie, or name of the series of the
+// episode, of name, a release name without its extension: release tags,
+// years, provider ID tags and quality are stripped, and separators replaced
+// by spaces, e.g. "Heat" for "Heat.1995.1080p.BluRay.x264-GROUP". It returns
+// "" when name has no title.
+func CleanTitle(name string) string {
+	p := releasePath(name)
+	if detectType(p) == TypeEpisode {
+		e, _ := EpisodeFromPath(p)
+		return e.series
+	}
+	if m, err := MovieFromPath(p); err == nil {
+		return m.title
+	}
+	return ""
+}
+
+// releasePath returns the path of a file named name, whose extension is
+// empty, so that none of name is taken for it
+func releasePath(name string) string {
+	return name + "."
+}
@@ -0,0 +1,99 @@
+package kourai
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDetectType(t *testing.T) {
+	tests := map[string]string{
+		"/dl/Heat.1995.1080p.mkv":                     TypeMovie,
+		"/dl/Breaking.Bad.S01E02.mkv":                 TypeEpisode,
+		"/dl/Breaking.Bad.S01E02/video.mkv":           TypeEpisode,
+		"/dl/Doctor.Who.1x02.mkv":                     TypeEpisode,
+		"/dl/The.Daily.Show.2024.05.01.mkv":           TypeEpisode,
+		"/dl/[Group] One Piece - 1052 [1080p].mkv":    TypeEpisode,
+		"/dl/Breaking.Bad.S01E02/Featurettes/bts.mkv": TypeEpisode,
+		"/dl/Heat (1995)/Trailers/Heat Trailer 2.mkv": TypeMovie,
+	}
+	for path, want := range tests {
+		if got := DetectType(path); got != want {
+			t.Errorf("DetectType(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestParseSeriesFolder(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SeriesFolder
+	}{
+		{"/tv/The Wire (2002)", SeriesFolder{Series: "The Wire", Year: 2002, Season: -1}},
+		{"/tv/The Wire {tmdb-1438}/", SeriesFolder{Series: "The Wire", TMDBID: 1438, Season: -1}},
+		{"/tv/The Wire (2002)/Season 02", SeriesFolder{Series: "The Wire", Year: 2002, Season: 2}},
+		{"/tv/The Wire/Specials", SeriesFolder{Series: "The Wire", Season: 0}},
+		{"/dl/The.Wire.S02.1080p.BluRay.x264-GROUP", SeriesFolder{Series: "The Wire", Season: 2}},
+		{"/dl/Doctor Who (2005) Season 3", SeriesFolder{Series: "Doctor Who", Year: 2005, Season: 3}},
+	}
+	for _, tt := range tests {
+		got, err := ParseSeriesFolder(tt.in)
+		if err != nil {
+			t.Errorf("ParseSeriesFolder(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSeriesFolder(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseSeriesFolder("Season 1"); !errors.Is(err, ErrNoTitle) {
+		t.Errorf("ParseSeriesFolder() of a season folder without series = %v, want %v", err, ErrNoTitle)
+	}
+}
+
+func TestParseEpisodeID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want EpisodeID
+	}{
+		{"Breaking.Bad.S01E02.Gray.Matter.720p", EpisodeID{ID: "s01e02", Season: 1, Episode: 2}},
+		{"Show.S02E03-E04", EpisodeID{ID: "s02e03e04", Season: 2, Episode: 3}},
+		{"Doctor.Who.1x02", EpisodeID{ID: "s01e02", Season: 1, Episode: 2}},
+		{"Doctor.Who.1x02-1x03", EpisodeID{ID: "s01e02e03", Season: 1, Episode: 2}},
+		{"Show.S1E2E3", EpisodeID{ID: "s01e02e03", Season: 1, Episode: 2}},
+		{"S01E02", EpisodeID{ID: "s01e02", Season: 1, Episode: 2}},
+		{"2024.05.01", EpisodeID{ID: "2024-05-01", Season: 2024, AirDate: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}},
+		{"[Group] One Piece - 1052 [1080p]", EpisodeID{ID: "s01e1052", Season: 1, Episode: 1052, Absolute: 1052}},
+		{"The.Daily.Show.2024.05.01.Guest", EpisodeID{ID: "2024-05-01", Season: 2024, AirDate: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		got, err := ParseEpisodeID(tt.in)
+		if err != nil {
+			t.Errorf("ParseEpisodeID(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseEpisodeID(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"Heat.1995.1080p", "Show.2024.13.45"} {
+		if _, err := ParseEpisodeID(in); !errors.Is(err, ErrNoEpisodeID) {
+			t.Errorf("ParseEpisodeID(%q) = %v, want %v", in, err, ErrNoEpisodeID)
+		}
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := map[string]string{
+		"Heat.1995.1080p.BluRay.x264-GROUP":       "Heat",
+		"[Group] Spirited Away (2001) [ABCD1234]": "Spirited Away",
+		"Breaking.Bad.S01E02.Gray.Matter.720p":    "Breaking Bad",
+		"The.Daily.Show.2024.05.01.Guest":         "The Daily Show",
+		"":                                        "",
+	}
+	for in, want := range tests {
+		if got := CleanTitle(in); got != want {
+			t.Errorf("CleanTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
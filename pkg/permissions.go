@@ -0,0 +1,133 @@
+package kourai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// Permissions describe the ownership, modes and SELinux context given to
+// directories and files created in a library. Owner and group are left
+// unchanged when UID or GID are -1, modes and context when they are zero.
+//
+// Hard links share their inode with the source, so the file mode and
+// ownership of a linked file also apply to its source.
+type Permissions struct {
+	UID      int
+	GID      int
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	SetGID   bool
+
+	// SELinuxContext is either a full context such as
+	// "system_u:object_r:container_file_t:s0", or RestoreconContext.
+	SELinuxContext string
+}
+
+// NewPermissions resolves a permission profile. Owner and group are user
+// and group names or numeric IDs, modes are octal strings such as "0775".
+// Empty values are left unchanged.
+func NewPermissions(owner, group, dirMode, fileMode string, setgid bool) (*Permissions, error) {
+	p := &Permissions{UID: -1, GID: -1, SetGID: setgid}
+	var errs []error
+
+	if owner != "" {
+		if id, err := strconv.Atoi(owner); err == nil {
+			p.UID = id
+		} else if u, err := user.Lookup(owner); err != nil {
+			errs = append(errs, err)
+		} else {
+			p.UID, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if group != "" {
+		if id, err := strconv.Atoi(group); err == nil {
+			p.GID = id
+		} else if g, err := user.LookupGroup(group); err != nil {
+			errs = append(errs, err)
+		} else {
+			p.GID, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	for _, m := range []struct {
+		value string
+		mode  *os.FileMode
+	}{{dirMode, &p.DirMode}, {fileMode, &p.FileMode}} {
+		if m.value == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(m.value, 8, 32)
+		if err != nil || v > 0777 {
+			errs = append(errs, fmt.Errorf("invalid mode %q, expected an octal value like 0755", m.value))
+			continue
+		}
+		*m.mode = os.FileMode(v)
+	}
+	return p, errors.Join(errs...)
+}
+
+func (p *Permissions) apply(path string, mode os.FileMode) error {
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if p.UID != -1 || p.GID != -1 {
+		if err := os.Lchown(path, p.UID, p.GID); err != nil {
+			return err
+		}
+	}
+	if p.SELinuxContext != "" {
+		if err := setSELinuxContext(path, p.SELinuxContext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFile sets the ownership and mode of a file created in a library.
+func (p *Permissions) applyFile(path string) error {
+	if p == nil {
+		return nil
+	}
+	return p.apply(path, p.FileMode)
+}
+
+// mkdirAll creates dir and any missing parents, applying the directory
+// ownership and mode to the directories it creates.
+func (p *Permissions) mkdirAll(dir string) error {
+	if p == nil {
+		return os.MkdirAll(dir, 0755)
+	}
+
+	missing := []string{}
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	mode := p.DirMode
+	if p.SetGID {
+		if mode == 0 {
+			mode = 0755
+		}
+		mode |= os.ModeSetgid
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := p.apply(missing[i], mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
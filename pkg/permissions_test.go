@@ -0,0 +1,115 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewPermissions(t *testing.T) {
+	tests := []struct {
+		name                            string
+		owner, group, dirMode, fileMode string
+		setgid                          bool
+		want                            *Permissions
+		wantErr                         bool
+	}{
+		{
+			name: "empty",
+			want: &Permissions{UID: -1, GID: -1},
+		},
+		{
+			name:  "special bits in mode",
+			owner: "1000", group: "100", dirMode: "2775", fileMode: "0664", setgid: true,
+			wantErr: true,
+			want:    &Permissions{UID: 1000, GID: 100, FileMode: 0664, SetGID: true},
+		},
+		{
+			name:  "modes",
+			owner: "1000", group: "100", dirMode: "0775", fileMode: "664",
+			want: &Permissions{UID: 1000, GID: 100, DirMode: 0775, FileMode: 0664},
+		},
+		{
+			name:     "invalid mode",
+			fileMode: "rw-r--r--",
+			want:     &Permissions{UID: -1, GID: -1},
+			wantErr:  true,
+		},
+		{
+			name:    "unknown user",
+			owner:   "no-such-user-kourai",
+			want:    &Permissions{UID: -1, GID: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPermissions(tt.owner, tt.group, tt.dirMode, tt.fileMode, tt.setgid)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("NewPermissions() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPermissionsApply(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+	root := t.TempDir()
+	uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+	p, err := NewPermissions(uid, gid, "0750", "0640", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(root, "movies", "A (2000)")
+	if err := p.mkdirAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "A (2000).mkv")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.applyFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	rootInfo, _ := os.Stat(root)
+	want := map[string]os.FileMode{
+		// Existing directories are left alone
+		root:                          rootInfo.Mode(),
+		filepath.Join(root, "movies"): os.ModeDir | os.ModeSetgid | 0750,
+		dir:                           os.ModeDir | os.ModeSetgid | 0750,
+		file:                          0640,
+	}
+	got := map[string]os.FileMode{}
+	for path := range want {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[path] = info.Mode()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("modes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNilPermissions(t *testing.T) {
+	var p *Permissions
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	if err := p.mkdirAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.applyFile(dir); err != nil {
+		t.Errorf("applyFile() of nil Permissions = %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package kourai
+
+import "golang.org/x/sys/unix"
+
+// ioprio_set arguments, see ioprio_set(2)
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// lowestNice is the nice value of the lowest CPU priority
+const lowestNice = 19
+
+// LowerPriority lowers the CPU priority of the process to the lowest nice
+// value, and puts its disk IO in the idle class, so that it only uses the
+// disks when nothing else does.
+func LowerPriority() error {
+	if err := unix.Setpriority(unix.PRIO_PROCESS, 0, lowestNice); err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, ioprioClassIdle<<ioprioClassShift)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package kourai
+
+import "golang.org/x/sys/unix"
+
+// lowestNice is the nice value of the lowest CPU priority
+const lowestNice = 19
+
+// LowerPriority lowers the CPU priority of the process to the lowest nice
+// value. Disk IO priorities are only supported on Linux.
+func LowerPriority() error {
+	return unix.Setpriority(unix.PRIO_PROCESS, 0, lowestNice)
+}
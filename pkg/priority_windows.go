@@ -0,0 +1,8 @@
+package kourai
+
+import "errors"
+
+// LowerPriority is only supported on Unix systems.
+func LowerPriority() error {
+	return errors.New("lowering the priority is not supported on Windows")
+}
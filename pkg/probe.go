@@ -0,0 +1,149 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// MediaInfo is the duration, resolution and codecs of a video, as probed
+// by ffprobe, see WithProbe
+type MediaInfo struct {
+	Duration time.Duration
+	// Width and Height are those of the first video stream, or 0
+	Width  int
+	Height int
+	// VideoCodec and AudioCodec are the ffprobe names of the codecs of the
+	// first video and audio streams, e.g. hevc and eac3, or empty
+	VideoCodec string
+	AudioCodec string
+}
+
+// probedCodecs are the names of the video codecs named by ffprobe, as named
+// by the codec tags of releases, see codecs
+var probedCodecs = map[string]string{
+	"h264": "H.264",
+	"hevc": "H.265",
+	"av1":  "AV1",
+	"vp9":  "VP9",
+}
+
+// WithProbe probes the duration, resolution and codecs of each video found
+// with ffprobe, which must be in the PATH. Videos ffprobe can't read, or
+// without a duration, are skipped as corrupt. The probed resolution and
+// codec stand in for those not tagged in names, and all are available to
+// target templates and selectors.
+func WithProbe(enabled bool) Option {
+	return func(o *Options) {
+		o.probe = enabled
+	}
+}
+
+// probeMedia returns the MediaInfo of the video at path
+var probeMedia = ffprobeMedia
+
+// ffprobeOutput is the part of the JSON output of ffprobe -show_format
+// -show_streams that is used
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"streams"`
+}
+
+// ffprobeMedia returns the MediaInfo of the video at path, as given by
+// ffprobe
+func ffprobeMedia(ctx context.Context, path string) (MediaInfo, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return MediaInfo{}, fmt.Errorf("ffprobe of %s failed with error %w", path, err)
+	}
+	return parseFFprobe(out)
+}
+
+// parseFFprobe parses the JSON output of ffprobe. A missing duration is
+// returned as 0.
+func parseFFprobe(out []byte) (MediaInfo, error) {
+	var probed ffprobeOutput
+	if err := json.Unmarshal(out, &probed); err != nil {
+		return MediaInfo{}, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+	var info MediaInfo
+	if secs, err := strconv.ParseFloat(probed.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(secs * float64(time.Second))
+	}
+	for _, s := range probed.Streams {
+		switch {
+		case s.CodecType == "video" && info.VideoCodec == "":
+			info.VideoCodec, info.Width, info.Height = s.CodecName, s.Width, s.Height
+		case s.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = s.CodecName
+		}
+	}
+	return info, nil
+}
+
+// quality returns the resolution and codec of the video of i, in the terms
+// of the tags of releases. Resolutions are told by width too, as widescreen
+// videos are cropped, e.g. 1920x800 being 1080p.
+func (i MediaInfo) quality() quality {
+	var q quality
+	switch {
+	case i.Width >= 3800 || i.Height >= 2000:
+		q.resolution = "2160p"
+	case i.Width >= 1900 || i.Height >= 1000:
+		q.resolution = "1080p"
+	case i.Width >= 1260 || i.Height >= 700:
+		q.resolution = "720p"
+	case i.Height > 0:
+		q.resolution = fmt.Sprintf("%dp", i.Height)
+	}
+	q.codec = probedCodecs[i.VideoCodec]
+	return q
+}
+
+// probe probes the video at path, parsed as l, reporting it as skipped
+// when it's corrupt
+func probe(ctx context.Context, path string, l Linkable) bool {
+	info, err := probeMedia(ctx, path)
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		options.logger.Warn("skipping video ffprobe can't read", "path", path, "error", err)
+		options.events.failed(path, err)
+		skip(path, SkipCorrupt, "unreadable by ffprobe")
+		return false
+	}
+	if info.Duration <= 0 {
+		skip(path, SkipCorrupt, "no duration")
+		return false
+	}
+	switch v := l.(type) {
+	case *movie:
+		v.info, v.quality = info, v.quality.or(info.quality())
+	case *episode:
+		v.info, v.quality = info, v.quality.or(info.quality())
+	}
+	return true
+}
+
+// mediaInfoOf returns the MediaInfo of l, zero when it wasn't probed
+func mediaInfoOf(l Linkable) MediaInfo {
+	switch v := l.(type) {
+	case *movie:
+		return v.info
+	case *episode:
+		return v.info
+	}
+	return MediaInfo{}
+}
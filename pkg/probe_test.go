@@ -0,0 +1,116 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFFprobe(t *testing.T) {
+	out := []byte(`{
+		"streams": [
+			{"index": 0, "codec_name": "hevc", "codec_type": "video", "width": 1920, "height": 800},
+			{"index": 1, "codec_name": "eac3", "codec_type": "audio", "channels": 6},
+			{"index": 2, "codec_name": "aac", "codec_type": "audio", "channels": 2},
+			{"index": 3, "codec_name": "subrip", "codec_type": "subtitle"}
+		],
+		"format": {"filename": "Heat.1995.mkv", "duration": "6142.500000"}
+	}`)
+	got, err := parseFFprobe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MediaInfo{Duration: 6142500 * time.Millisecond, Width: 1920, Height: 800, VideoCodec: "hevc", AudioCodec: "eac3"}
+	if got != want {
+		t.Errorf("parseFFprobe() = %+v, want %+v", got, want)
+	}
+	if q := got.quality(); q.resolution != "1080p" || q.codec != "H.265" {
+		t.Errorf("quality() = %+v, want 1080p H.265", q)
+	}
+	if _, err := parseFFprobe([]byte("Invalid data found when processing input")); err == nil {
+		t.Error("parseFFprobe() of invalid output returned no error")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	defer func(f func(context.Context, string) (MediaInfo, error)) { probeMedia = f }(probeMedia)
+
+	root := t.TempDir()
+	probed := map[string]MediaInfo{
+		"Heat.1995.mkv":                 {Duration: 170 * time.Minute, Width: 3840, Height: 1600, VideoCodec: "hevc", AudioCodec: "truehd"},
+		"Alien.1979.720p.x264.mkv":      {Duration: 117 * time.Minute, Width: 1920, Height: 1080, VideoCodec: "hevc", AudioCodec: "aac"},
+		"Andor.S01E01.mkv":              {},
+		"Andor.S01E02.mkv":              {Duration: 40 * time.Minute, Width: 1920, Height: 1080, VideoCodec: "h264"},
+		"Andor.S01E02.en.srt":           {},
+		"Truncated.Download.S01E03.mkv": {},
+	}
+	for name := range probed {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	probeMedia = func(ctx context.Context, path string) (MediaInfo, error) {
+		if filepath.Ext(path) != ".mkv" {
+			t.Errorf("probed %s, which is no video", path)
+		}
+		if filepath.Base(path) == "Truncated.Download.S01E03.mkv" {
+			return MediaInfo{}, errors.New("moov atom not found")
+		}
+		return probed[filepath.Base(path)], nil
+	}
+	var mu sync.Mutex
+	skipped := map[string]string{}
+	only, err := ParseSelector("vcodec=hevc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTargetTemplate("Films/{{.Title}} [{{.Resolution}} {{.AudioCodec}} {{.Duration.Minutes}}m]{{.Ext}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.SetOptions(
+		WithProbe(true),
+		WithOnly([]Selector{only}),
+		WithTargetTemplates(tmpl, nil),
+		WithSkipReport(func(s SkippedFile) {
+			mu.Lock()
+			defer mu.Unlock()
+			skipped[filepath.Base(s.Path)] = s.Code
+		}),
+	)
+
+	media, errc := findFiles(context.Background(), root, options.fileFilters...)
+	got := map[string]string{}
+	for m := range media {
+		if matchMedia(context.Background(), m) {
+			got[filepath.Base(m.Path())] = m.Target()
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Heat.1995.mkv":            "Films/Heat [2160p truehd 170m].mkv",
+		"Alien.1979.720p.x264.mkv": "Films/Alien [720p aac 117m].mkv",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("targets mismatch (-want +got):\n%s", diff)
+	}
+	wantSkipped := map[string]string{
+		"Andor.S01E01.mkv":              SkipCorrupt,
+		"Andor.S01E02.mkv":              SkipNotSelected,
+		"Andor.S01E02.en.srt":           SkipNotSelected,
+		"Truncated.Download.S01E03.mkv": SkipCorrupt,
+	}
+	if diff := cmp.Diff(wantSkipped, skipped); diff != "" {
+		t.Errorf("skipped files mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,305 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+	"github.com/alzabo/kourai/internal/tvdb"
+)
+
+// Metadata providers media can be looked up with
+const (
+	ProviderTMDB = "tmdb"
+	ProviderTVDB = "tvdb"
+)
+
+// MovieMetadata is what a metadata provider knows of a movie
+type MovieMetadata struct {
+	Title string
+	// Year is the release year, or 0 when it's unknown
+	Year int
+	// TMDBID is the TMDB ID of the movie, or 0 when the provider doesn't
+	// know it. Artwork, NFOs and collection sets need it.
+	TMDBID int
+	// IMDbID is the IMDb ID of the movie, or "" when it's unknown
+	IMDbID string
+	// Confidence is how well a search result matches the title searched
+	// for, from 0 to 1, see matchConfidence. Lookups by ID are certain.
+	Confidence float64
+}
+
+// SeriesMetadata is what a metadata provider knows of a series
+type SeriesMetadata struct {
+	Name string
+	// ID identifies the series at the provider, for GetEpisode
+	ID string
+	// TMDBID is the TMDB ID of the series, or 0 when the provider doesn't
+	// know it
+	TMDBID int
+	// IMDbID is the IMDb ID of the series, or "" when it's unknown
+	IMDbID string
+	// Year is the year the series first aired, or 0 when it's unknown
+	Year int
+	// Confidence is how well a search result matches the name searched
+	// for, from 0 to 1, like that of MovieMetadata
+	Confidence float64
+}
+
+// EpisodeMetadata is what a metadata provider knows of an episode
+type EpisodeMetadata struct {
+	Title string
+	// Season and Episode number the episode at the provider, or are 0 when
+	// the provider doesn't say
+	Season  int
+	Episode int
+}
+
+// MetadataProvider looks up the names of the media parsed from paths. TMDB
+// is the default provider, see WithMetadataProvider.
+type MetadataProvider interface {
+	// SearchMovie returns the best match of title, released in year unless
+	// it's 0, with its confidence
+	SearchMovie(ctx context.Context, title string, year int) (MovieMetadata, error)
+	// SearchSeries returns the best match of name, first aired in year
+	// unless it's 0, with its confidence
+	SearchSeries(ctx context.Context, name string, year int) (SeriesMetadata, error)
+	// GetEpisode returns an episode of a series returned by SearchSeries or
+	// SeriesByID
+	GetEpisode(ctx context.Context, series SeriesMetadata, season, episode int) (EpisodeMetadata, error)
+}
+
+// IDProvider is a MetadataProvider that also looks media up by ID. Aliases
+// and {tmdb-…} tags give TMDB IDs, and tags may give the IMDb or TVDB IDs
+// of what the provider finds. Providers that aren't IDProviders ignore
+// them and search by name.
+type IDProvider interface {
+	MetadataProvider
+	MovieByID(ctx context.Context, tmdbID int) (MovieMetadata, error)
+	SeriesByID(ctx context.Context, tmdbID int) (SeriesMetadata, error)
+	// FindTMDBID returns the TMDB ID of the movie, or series when series
+	// is true, with the ID id at source, e.g. tmdb.SourceIMDb, or 0 when
+	// there is none
+	FindTMDBID(ctx context.Context, source, id string, series bool) (int, error)
+}
+
+// AirDateProvider is a MetadataProvider that also looks up the episodes of
+// daily shows, which are named after the date they aired, e.g.
+// Show.2024.05.01.Guest.mkv. Other providers leave them named after their
+// paths.
+type AirDateProvider interface {
+	MetadataProvider
+	// EpisodeByAirDate returns the episode of series that aired on date,
+	// with its season and episode number
+	EpisodeByAirDate(ctx context.Context, series SeriesMetadata, date time.Time) (EpisodeMetadata, error)
+}
+
+// AbsoluteProvider is a MetadataProvider that also maps the absolute
+// numbers of episodes, counted across the seasons of a series as anime
+// releases number them, to their seasons and episodes. Other providers
+// look absolute numbers up as episodes of the first season.
+type AbsoluteProvider interface {
+	MetadataProvider
+	// EpisodeByAbsoluteNumber returns the nth episode of series, with its
+	// season and episode number
+	EpisodeByAbsoluteNumber(ctx context.Context, series SeriesMetadata, n int) (EpisodeMetadata, error)
+}
+
+// WithMetadataProvider looks media up with p instead of TMDB. TMDB is still
+// used for artwork, NFOs and collection sets, of the media p knows the
+// TMDB ID of. A nil provider looks media up on TMDB when there's an API key.
+func WithMetadataProvider(p MetadataProvider) Option {
+	return func(o *Options) {
+		o.provider = p
+	}
+}
+
+// metadataProvider returns the provider media is looked up with, or nil
+// when there is none
+func (o *Options) metadataProvider() MetadataProvider {
+	if o.provider != nil {
+		return o.provider
+	}
+	if o.TMDBClient != nil {
+		return tmdbProvider{o.TMDBClient}
+	}
+	return nil
+}
+
+// tmdbProvider looks media up on TMDB
+type tmdbProvider struct {
+	client *tmdb.TMDB
+}
+
+func (p tmdbProvider) SearchMovie(ctx context.Context, title string, year int) (MovieMetadata, error) {
+	results, err := p.MovieCandidates(ctx, title, year)
+	if err != nil || len(results) == 0 {
+		return MovieMetadata{}, err
+	}
+	return results[0], nil
+}
+
+// MovieCandidates scores the first results of a search, as TMDB ranks
+// namesakes and remakes by popularity rather than by year
+func (p tmdbProvider) MovieCandidates(ctx context.Context, title string, year int) ([]MovieMetadata, error) {
+	var searchOpts map[string]string
+	if year > 0 {
+		searchOpts = map[string]string{"year": fmt.Sprint(year)}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results, errc := p.client.SearchMovies(ctx, title, searchOpts)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	var movies []MovieMetadata
+	for res := range results {
+		m := MovieMetadata{Title: res.Title, TMDBID: int(res.ID)}
+		if !res.ReleaseDate.IsZero() {
+			m.Year = res.ReleaseDate.Year()
+		}
+		m.Confidence = matchConfidence(title, year, []string{res.Title, res.OriginalTitle}, m.Year, float64(res.Popularity))
+		if movies = append(movies, m); len(movies) == maxCandidates {
+			break
+		}
+	}
+	sort.SliceStable(movies, func(i, j int) bool { return movies[i].Confidence > movies[j].Confidence })
+	return movies, nil
+}
+
+func (p tmdbProvider) SearchSeries(ctx context.Context, name string, year int) (SeriesMetadata, error) {
+	results, err := p.SeriesCandidates(ctx, name, year)
+	if err != nil || len(results) == 0 {
+		return SeriesMetadata{}, err
+	}
+	return results[0], nil
+}
+
+// SeriesCandidates scores the first results of a search, like
+// MovieCandidates
+func (p tmdbProvider) SeriesCandidates(ctx context.Context, name string, year int) ([]SeriesMetadata, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var searchOpts map[string]string
+	if year > 0 {
+		searchOpts = map[string]string{"year": fmt.Sprint(year)}
+	}
+	res, errc := p.client.SearchTV(ctx, name, searchOpts)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	var series []SeriesMetadata
+	for show := range res {
+		s := SeriesMetadata{Name: show.Name, ID: fmt.Sprint(show.ID), TMDBID: int(show.ID)}
+		if !show.FirstAirDate.IsZero() {
+			s.Year = show.FirstAirDate.Year()
+		}
+		s.Confidence = matchConfidence(name, year, []string{show.Name, show.OriginalName}, s.Year, float64(show.Popularity))
+		if series = append(series, s); len(series) == maxCandidates {
+			break
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].Confidence > series[j].Confidence })
+	return series, nil
+}
+
+func (p tmdbProvider) GetEpisode(ctx context.Context, series SeriesMetadata, season, episode int) (EpisodeMetadata, error) {
+	ep, err := p.client.EpisodeDetails(ctx, series.TMDBID, season, episode)
+	return EpisodeMetadata{Title: ep.Name, Season: season, Episode: episode}, err
+}
+
+func (p tmdbProvider) EpisodeByAirDate(ctx context.Context, series SeriesMetadata, date time.Time) (EpisodeMetadata, error) {
+	ep, err := p.client.EpisodeByAirDate(ctx, series.TMDBID, date)
+	return EpisodeMetadata{Title: ep.Name, Season: int(ep.SeasonNumber), Episode: int(ep.EpisodeNumber)}, err
+}
+
+func (p tmdbProvider) EpisodeByAbsoluteNumber(ctx context.Context, series SeriesMetadata, n int) (EpisodeMetadata, error) {
+	ep, err := p.client.EpisodeByAbsoluteNumber(ctx, series.TMDBID, n)
+	return EpisodeMetadata{Title: ep.Name, Season: int(ep.SeasonNumber), Episode: int(ep.EpisodeNumber)}, err
+}
+
+func (p tmdbProvider) MovieByID(ctx context.Context, tmdbID int) (MovieMetadata, error) {
+	res, err := p.client.MovieDetails(ctx, tmdbID)
+	if err != nil {
+		return MovieMetadata{}, err
+	}
+	m := MovieMetadata{Title: res.Title, TMDBID: tmdbID, Confidence: 1}
+	if !res.ReleaseDate.IsZero() {
+		m.Year = res.ReleaseDate.Year()
+	}
+	return m, nil
+}
+
+func (p tmdbProvider) SeriesByID(ctx context.Context, tmdbID int) (SeriesMetadata, error) {
+	show, err := p.client.TVDetails(ctx, tmdbID)
+	s := SeriesMetadata{Name: show.Name, ID: fmt.Sprint(tmdbID), TMDBID: tmdbID, Confidence: 1}
+	if !show.FirstAirDate.IsZero() {
+		s.Year = show.FirstAirDate.Year()
+	}
+	return s, err
+}
+
+func (p tmdbProvider) FindTMDBID(ctx context.Context, source, id string, series bool) (int, error) {
+	r, err := p.client.Find(ctx, id, source)
+	switch {
+	case err != nil:
+		return 0, err
+	case series && len(r.TVResults) > 0:
+		return int(r.TVResults[0].ID), nil
+	case series && len(r.TVEpisodeResults) > 0:
+		return int(r.TVEpisodeResults[0].ShowID), nil
+	case !series && len(r.MovieResults) > 0:
+		return int(r.MovieResults[0].ID), nil
+	}
+	return 0, nil
+}
+
+// NewTVDBProvider returns a provider looking media up on TheTVDB with the
+// project API key, and the PIN of the subscriber for user-supported keys,
+// or "" for others. It knows the TMDB IDs TheTVDB lists for media.
+func NewTVDBProvider(key, pin string) MetadataProvider {
+	return tvdbProvider{tvdb.New(key, pin)}
+}
+
+// tvdbProvider looks media up on TheTVDB
+type tvdbProvider struct {
+	client *tvdb.Client
+}
+
+func (p tvdbProvider) SearchMovie(ctx context.Context, title string, year int) (MovieMetadata, error) {
+	res, err := p.client.Search(ctx, title, tvdb.TypeMovie, year)
+	if err != nil {
+		return MovieMetadata{}, err
+	}
+	r, y, c := bestTVDBResult(res, title, year)
+	return MovieMetadata{Title: r.Name, Year: y, TMDBID: r.TMDBID(), Confidence: c}, nil
+}
+
+func (p tvdbProvider) SearchSeries(ctx context.Context, name string, year int) (SeriesMetadata, error) {
+	res, err := p.client.Search(ctx, name, tvdb.TypeSeries, year)
+	if err != nil {
+		return SeriesMetadata{}, err
+	}
+	r, y, c := bestTVDBResult(res, name, year)
+	return SeriesMetadata{Name: r.Name, ID: r.ID, TMDBID: r.TMDBID(), Year: y, Confidence: c}, nil
+}
+
+// bestTVDBResult returns the first of results best matching query, with its
+// year and confidence. TheTVDB doesn't rank results by popularity.
+func bestTVDBResult(results []tvdb.SearchResult, query string, year int) (best tvdb.SearchResult, bestYear int, confidence float64) {
+	for i, r := range results[:min(len(results), maxCandidates)] {
+		y, _ := strconv.Atoi(r.Year)
+		if c := matchConfidence(query, year, []string{r.Name}, y, 0); i == 0 || c > confidence {
+			best, bestYear, confidence = r, y, c
+		}
+	}
+	return best, bestYear, confidence
+}
+
+func (p tvdbProvider) GetEpisode(ctx context.Context, series SeriesMetadata, season, episode int) (EpisodeMetadata, error) {
+	ep, err := p.client.Episode(ctx, series.ID, season, episode)
+	return EpisodeMetadata{Title: ep.Name}, err
+}
@@ -0,0 +1,90 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeProvider knows the movies and series it maps from their searched
+// names, and episodes titled after their number
+type fakeProvider struct {
+	movies   map[string]MovieMetadata
+	series   map[string]SeriesMetadata
+	searches []string
+}
+
+func (p *fakeProvider) SearchMovie(ctx context.Context, title string, year int) (MovieMetadata, error) {
+	p.searches = append(p.searches, "movie "+title)
+	if m, ok := p.movies[title]; ok {
+		return m, nil
+	}
+	return MovieMetadata{}, errors.New("no match")
+}
+
+func (p *fakeProvider) SearchSeries(ctx context.Context, name string, year int) (SeriesMetadata, error) {
+	p.searches = append(p.searches, "series "+name)
+	if s, ok := p.series[name]; ok {
+		return s, nil
+	}
+	return SeriesMetadata{}, errors.New("no match")
+}
+
+func (p *fakeProvider) GetEpisode(ctx context.Context, series SeriesMetadata, season, episode int) (EpisodeMetadata, error) {
+	if series.ID != "s1" || season != 1 {
+		return EpisodeMetadata{}, errors.New("no such episode")
+	}
+	return EpisodeMetadata{Title: map[int]string{1: "Pilot", 2: "Second"}[episode]}, nil
+}
+
+func TestMetadataProvider(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	db := NewStoreAliasDB(NewMemoryStore())
+	if err := db.Record(Alias{Type: AliasMovie, Title: "Aliased", ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{
+		movies: map[string]MovieMetadata{
+			"Heat":    {Title: "Heat", Year: 1995},
+			"Aliased": {Title: "Found By Name", Year: 2001, TMDBID: 42},
+		},
+		series: map[string]SeriesMetadata{"Show": {Name: "The Show", ID: "s1"}},
+	}
+	options.SetOptions(WithTMDBApiKey("unused"), WithAliasDB(db), WithMetadataProvider(p))
+
+	tests := []struct {
+		path string
+		want Linkable
+	}{
+		{"/dl/heat.mkv", &movie{title: "Heat", year: 1995, released: 1995, matchedBy: MatchedBySearch}},
+		// Aliases and tags give TMDB IDs, which only IDProviders look up
+		{"/dl/aliased.mkv", &movie{title: "Found By Name", year: 2001, tmdbID: 42, released: 2001, matchedBy: MatchedBySearch}},
+		{"/dl/Heat {tmdb-949}/heat.mkv", &movie{title: "Heat", year: 1995, tmdbID: 949, released: 1995, matchedBy: MatchedBySearch}},
+		{"/dl/nothing.mkv", &movie{title: "Nothing"}},
+		{"/dl/show.s01e02.mkv", &episode{series: "The Show", title: "Second", id: "s01e02", season: 1, episode: 2, matchedBy: MatchedBySearch}},
+		// The series is named even when its episode isn't known
+		{"/dl/show.s02e01.mkv", &episode{series: "The Show", id: "s02e01", season: 2, episode: 1, matchedBy: MatchedBySearch}},
+	}
+	for _, tt := range tests {
+		l, err := NewLinkable(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lookup(context.Background(), options.metadataProvider(), l)
+		switch v := tt.want.(type) {
+		case *movie:
+			v.path = tt.path
+		case *episode:
+			v.path = tt.path
+		}
+		if diff := cmp.Diff(tt.want, l, cmp.AllowUnexported(movie{}, episode{}, externalID{}, quality{})); diff != "" {
+			t.Errorf("lookup(%s) mismatch (-want +got):\n%s", tt.path, diff)
+		}
+	}
+	if diff := cmp.Diff([]string{"movie Heat", "movie Aliased", "movie Heat", "movie Nothing", "series Show", "series Show"}, p.searches); diff != "" {
+		t.Errorf("searches mismatch (-want +got):\n%s", diff)
+	}
+}
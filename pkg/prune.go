@@ -0,0 +1,154 @@
+package kourai
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prune removes the media files below the destination dest that have fewer
+// than minLinks hard links, i.e. whose sources were deleted, e.g. 2 for
+// hard links of a single source. Only the targets the journal records as
+// hard links are considered, since copies and moved files have a single
+// link whether their sources were deleted or not, and the files it has no
+// entries of are left alone. Files named after those removed, e.g.
+// subtitles, NFOs and thumbnails, are removed along with them, and their
+// entries from the journal, so that "kourai verify" doesn't find them
+// stale. Directories left empty are removed last.
+//
+// The paths of the media files removed are returned, or of those that
+// would be with dryRun, when nothing is changed.
+func Prune(dest string, minLinks uint64, dryRun bool, optionConfig ...Option) ([]string, error) {
+	options.SetOptions(optionConfig...)
+	if _, err := os.Stat(dest); err != nil {
+		return nil, err
+	}
+	entries, err := journalTargets(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	var dead []string
+	var errs []error
+	err = filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		// kourai's journal and lock, and other hidden entries
+		if p != dest && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !isMedia(info) {
+			return nil
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if e, ok := entries[abs]; !ok || (e.Mode != string(ModeHardlink) && e.Mode != "") {
+			return nil
+		}
+		_, _, nlink, err := fileIdentity(p, info)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if nlink < minLinks {
+			dead = append(dead, p)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if dryRun {
+		return dead, errors.Join(errs...)
+	}
+
+	removed := []string{}
+	for _, p := range dead {
+		if err := removeWithSidecars(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, p)
+	}
+	if err := forgetTargets(filepath.Join(dest, JournalName), removed); err != nil {
+		errs = append(errs, err)
+	}
+	if err := RemoveEmptyDirs(dest); err != nil {
+		errs = append(errs, err)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// removeWithSidecars removes the media file at p, then the files next to it
+// named after it, e.g. "<name>.srt" or "<name>-thumb.jpg"
+func removeWithSidecars(p string) error {
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+	stem := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	entries, err := os.ReadDir(filepath.Dir(p))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !(strings.HasPrefix(name, stem+".") || strings.HasPrefix(name, stem+"-")) {
+			continue
+		}
+		// Another media file, e.g. "<name>-1080p.mkv", isn't a sidecar
+		if info, err := e.Info(); err == nil && isMedia(info) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(filepath.Dir(p), name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forgetTargets removes the entries of targets from the journal at path,
+// when there's one
+func forgetTargets(path string, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	entries, err := ReadJournal(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	gone := map[string]bool{}
+	for _, t := range targets {
+		if abs, err := filepath.Abs(t); err == nil {
+			gone[abs] = true
+		}
+	}
+	kept := []JournalEntry{}
+	for _, e := range entries {
+		if abs, err := filepath.Abs(e.Target); err == nil && gone[abs] {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(kept) == len(entries) {
+		return nil
+	}
+	return writeJournal(path, kept)
+}
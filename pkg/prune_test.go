@@ -0,0 +1,113 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrune(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	for _, f := range []string{"Show.S01E01.mkv", "Show.S01E02.mkv"} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal, err := OpenJournal(filepath.Join(dest, JournalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := filepath.Join(dest, "tv/Show/Season 1/Show - S01E01.mkv")
+	gone := filepath.Join(dest, "tv/Show/Season 2/Show - S01E02.mkv")
+	for src, target := range map[string]string{filepath.Join(src, "Show.S01E01.mkv"): kept, filepath.Join(src, "Show.S01E02.mkv"): gone} {
+		os.MkdirAll(filepath.Dir(target), 0755)
+		if err := os.Link(src, target); err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Record(string(ModeHardlink), Link{Src: src, Target: target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close()
+	os.WriteFile(filepath.Join(dest, "tv/Show/Season 2/Show - S01E02.en.srt"), nil, 0644)
+	os.Remove(filepath.Join(src, "Show.S01E02.mkv"))
+
+	pruned, err := Prune(dest, 2, true, WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{gone}, pruned); diff != "" {
+		t.Errorf("Prune() dry run mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(gone); err != nil {
+		t.Errorf("Prune() removed %s in a dry run", gone)
+	}
+
+	pruned, err = Prune(dest, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{gone}, pruned); diff != "" {
+		t.Errorf("Prune() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "tv/Show/Season 2")); !os.IsNotExist(err) {
+		t.Errorf("Prune() left the emptied season folder")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("Prune() removed %s", kept)
+	}
+	entries, err := ReadJournal(filepath.Join(dest, JournalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Target != kept {
+		t.Errorf("journal = %v, want only the entry of %s", entries, kept)
+	}
+}
+
+func TestPruneCopies(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	journal, err := OpenJournal(filepath.Join(dest, JournalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dest, "movies/Heat (1995)/Heat (1995).mkv")
+	moved := filepath.Join(dest, "movies/Alien (1979)/Alien (1979).mkv")
+	for mode, target := range map[LinkMode]string{ModeCopy: copied, ModeMove: moved} {
+		os.MkdirAll(filepath.Dir(target), 0755)
+		if err := os.WriteFile(target, []byte(target), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Record(string(mode), Link{Src: filepath.Join(src, filepath.Base(target)), Target: target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close()
+	// Not in the journal at all
+	unknown := filepath.Join(dest, "movies/Ran (1985)/Ran (1985).mkv")
+	os.MkdirAll(filepath.Dir(unknown), 0755)
+	if err := os.WriteFile(unknown, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := Prune(dest, 2, false, WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 0 {
+		t.Errorf("Prune() of copies removed %v", pruned)
+	}
+	for _, p := range []string{copied, moved, unknown} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("Prune() removed %s", p)
+		}
+	}
+}
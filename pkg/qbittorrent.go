@@ -0,0 +1,244 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Torrent is a completed torrent of qBittorrent
+type Torrent struct {
+	Hash     string `json:"hash"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	// Tags are comma separated, as qBittorrent lists them
+	Tags string `json:"tags"`
+	// ContentPath is the file of single file torrents, or else their
+	// folder, mapped to a local path, see NewQBittorrent
+	ContentPath string `json:"content_path"`
+}
+
+// Tagged reports whether t has tag.
+func (t Torrent) Tagged(tag string) bool {
+	for _, s := range strings.Split(t.Tags, ",") {
+		if strings.TrimSpace(s) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// PathMap maps the paths below Local, a folder of this host, to those below
+// Remote, the same folder as another host or container sees it, e.g. a
+// media server or download client. Paths of other hosts are written with
+// forward slashes, which they always use unless they run on Windows, and
+// are read with either. The zero PathMap maps paths to themselves.
+type PathMap struct {
+	Local  string
+	Remote string
+}
+
+// ParsePathMap parses a path map given as <local path>=<remote path>, e.g.
+// /mnt/media=/media.
+func ParsePathMap(s string) (PathMap, error) {
+	local, remote, ok := strings.Cut(s, "=")
+	if !ok || local == "" || remote == "" {
+		return PathMap{}, fmt.Errorf("invalid path map %q, expected <local path>=<remote path>", s)
+	}
+	return PathMap{Local: local, Remote: remote}, nil
+}
+
+// ToRemote returns the path the other host sees for p, a path of this host,
+// or false when p isn't below m.Local.
+func (m PathMap) ToRemote(p string) (string, bool) {
+	if m.Local == "" {
+		return filepath.ToSlash(p), true
+	}
+	rel, err := filepath.Rel(filepath.Clean(m.Local), p)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return path.Join(strings.ReplaceAll(m.Remote, `\`, "/"), filepath.ToSlash(rel)), true
+}
+
+// ToLocal returns the path of this host of p, a path of the other host, or
+// false when p isn't below m.Remote.
+func (m PathMap) ToLocal(p string) (string, bool) {
+	p = strings.ReplaceAll(p, `\`, "/")
+	if m.Remote == "" {
+		return filepath.FromSlash(p), true
+	}
+	remote := strings.TrimRight(strings.ReplaceAll(m.Remote, `\`, "/"), "/")
+	if p != remote && !strings.HasPrefix(p, remote+"/") {
+		return "", false
+	}
+	return filepath.Join(m.Local, filepath.FromSlash(strings.TrimPrefix(p, remote))), true
+}
+
+// QBittorrent is a client of the Web API of qBittorrent
+type QBittorrent struct {
+	baseURL  string
+	client   *http.Client
+	pathMaps []PathMap
+}
+
+// NewQBittorrent logs in to the Web API of qBittorrent at baseURL. Content
+// paths of torrents are mapped to local paths by the first of pathMaps
+// whose Remote they're below. An
+// empty username skips logging in, for instances that trust the network
+// they're reached from.
+func NewQBittorrent(ctx context.Context, baseURL, username, password string, pathMaps []PathMap) (*QBittorrent, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	q := &QBittorrent{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		client:   &http.Client{Jar: jar},
+		pathMaps: pathMaps,
+	}
+	if username == "" {
+		return q, nil
+	}
+	body, err := q.post(ctx, "/api/v2/auth/login", url.Values{"username": {username}, "password": {password}})
+	if err != nil {
+		return nil, err
+	}
+	// Failed logins are answered with 200 too
+	if strings.TrimSpace(string(body)) != "Ok." {
+		return nil, errors.New("qBittorrent login failed, check the username and password")
+	}
+	return q, nil
+}
+
+// do sends req, returning the body of a successful response
+func (q *QBittorrent) do(req *http.Request) ([]byte, error) {
+	// qBittorrent refuses requests whose Referer or Origin don't match
+	// its address, and accepts those without
+	req.Header.Set("Referer", q.baseURL)
+	res, err := q.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("qBittorrent returned %s for %s", res.Status, req.URL.Path)
+	}
+	return body, nil
+}
+
+func (q *QBittorrent) post(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", q.baseURL+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return q.do(req)
+}
+
+// Completed returns the completed torrents of categories, or of every
+// category when none is given, with their content paths mapped.
+func (q *QBittorrent) Completed(ctx context.Context, categories []string) ([]Torrent, error) {
+	query := func(category string) ([]Torrent, error) {
+		v := url.Values{"filter": {"completed"}}
+		if category != "" {
+			v.Set("category", category)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", q.baseURL+"/api/v2/torrents/info?"+v.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := q.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var torrents []Torrent
+		if err := json.Unmarshal(body, &torrents); err != nil {
+			return nil, fmt.Errorf("failed to parse qBittorrent torrents with error %w", err)
+		}
+		return torrents, nil
+	}
+	if len(categories) == 0 {
+		categories = []string{""}
+	}
+	var all []Torrent
+	for _, c := range categories {
+		torrents, err := query(c)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, torrents...)
+	}
+	for i, t := range all {
+		for _, m := range q.pathMaps {
+			if p, ok := m.ToLocal(t.ContentPath); ok {
+				all[i].ContentPath = p
+				break
+			}
+		}
+	}
+	return all, nil
+}
+
+// AddTags tags the torrents of hashes, creating the tags when missing.
+func (q *QBittorrent) AddTags(ctx context.Context, hashes []string, tags ...string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	_, err := q.post(ctx, "/api/v2/torrents/addTags", url.Values{
+		"hashes": {strings.Join(hashes, "|")},
+		"tags":   {strings.Join(tags, ",")},
+	})
+	return err
+}
+
+// TorrentLinks are the links of the content of a torrent
+type TorrentLinks struct {
+	Torrent Torrent
+	Links   []Link
+	// Err is why the content of the torrent couldn't be linked, e.g. a
+	// content path that isn't mapped to a local one
+	Err error
+}
+
+// LinkTorrents finds the media in the content of each of torrents, as
+// LinkFromFiles would in the sources, and returns their links, one per
+// target, by torrent. Invalid options are returned as an error, and
+// nothing is linked; the sources are those of the torrents.
+func LinkTorrents(ctx context.Context, torrents []Torrent, optionConfig ...Option) ([]TorrentLinks, error) {
+	paths := make([]string, len(torrents))
+	for i, t := range torrents {
+		paths[i] = t.ContentPath
+	}
+	options.SetOptions(append(optionConfig, WithSources(paths))...)
+	if len(torrents) == 0 {
+		return nil, nil
+	}
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+	if err := options.openState(); err != nil {
+		return nil, err
+	}
+	results := make([]TorrentLinks, len(torrents))
+	for i, t := range torrents {
+		results[i].Torrent = t
+		results[i].Links, results[i].Err = linkPath(ctx, t.ContentPath)
+		if err := ctx.Err(); err != nil {
+			return results[:i], err
+		}
+	}
+	return results, nil
+}
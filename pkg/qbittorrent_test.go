@@ -0,0 +1,148 @@
+package kourai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQBittorrent(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	os.Mkdir(filepath.Join(src, "Alien.1979.1080p"), 0755)
+	for _, f := range []string{"Heat.1995.mkv", "Alien.1979.1080p/Alien.1979.1080p.mkv", "Alien.1979.1080p/sample.mkv"} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tagged string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/auth/login" {
+			if r.FormValue("password") != "secret" {
+				w.Write([]byte("Fails."))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session", Path: "/"})
+			w.Write([]byte("Ok."))
+			return
+		}
+		if c, err := r.Cookie("SID"); err != nil || c.Value != "session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v2/torrents/info":
+			if r.URL.Query().Get("filter") != "completed" || r.URL.Query().Get("category") != "movies" {
+				w.Write([]byte(`[]`))
+				return
+			}
+			w.Write([]byte(`[
+				{"hash": "aaa", "name": "Heat.1995.mkv", "category": "movies", "tags": "", "content_path": "/downloads/Heat.1995.mkv"},
+				{"hash": "bbb", "name": "Alien.1979.1080p", "category": "movies", "tags": "kourai, seeding", "content_path": "/downloads/Alien.1979.1080p"},
+				{"hash": "ccc", "name": "Gone", "category": "movies", "tags": "", "content_path": "/elsewhere/Gone"}
+			]`))
+		case "/api/v2/torrents/addTags":
+			tagged = r.FormValue("hashes") + " " + r.FormValue("tags")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	if _, err := NewQBittorrent(ctx, srv.URL, "admin", "wrong", nil); err == nil {
+		t.Error("NewQBittorrent() with a wrong password returned no error")
+	}
+	qbt, err := NewQBittorrent(ctx, srv.URL+"/", "admin", "secret", []PathMap{{Local: src, Remote: "/downloads/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents, err := qbt.Completed(ctx, []string{"movies"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 3 || torrents[1].ContentPath != filepath.Join(src, "Alien.1979.1080p") || torrents[2].ContentPath != "/elsewhere/Gone" {
+		t.Fatalf("Completed() = %+v, want 3 torrents with mapped paths", torrents)
+	}
+	if torrents[0].Tagged("kourai") || !torrents[1].Tagged("kourai") {
+		t.Errorf("Tagged(kourai) = %v, %v, want false, true", torrents[0].Tagged("kourai"), torrents[1].Tagged("kourai"))
+	}
+
+	results, err := LinkTorrents(ctx, torrents, WithDestination(dest), WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, r := range results {
+		if r.Err != nil {
+			got[r.Torrent.Hash] = []string{"error"}
+			continue
+		}
+		got[r.Torrent.Hash] = []string{}
+		for _, l := range r.Links {
+			rel, _ := filepath.Rel(dest, l.Target)
+			got[r.Torrent.Hash] = append(got[r.Torrent.Hash], filepath.ToSlash(rel))
+		}
+	}
+	want := map[string][]string{
+		"aaa": {"movies/Heat (1995)/Heat.1995.mkv"},
+		"bbb": {"movies/Alien (1979)/Alien.1979.1080p.mkv"},
+		"ccc": {"error"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LinkTorrents() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := qbt.AddTags(ctx, []string{"aaa", "bbb"}, "kourai"); err != nil {
+		t.Fatal(err)
+	}
+	if tagged != "aaa|bbb kourai" {
+		t.Errorf("AddTags() sent %q, want %q", tagged, "aaa|bbb kourai")
+	}
+}
+
+func TestPathMap(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "media")
+	m := PathMap{Local: local, Remote: "/media/"}
+	remoteTests := []struct {
+		path, want string
+		ok         bool
+	}{
+		{filepath.Join(local, "movies", "Heat (1995)"), "/media/movies/Heat (1995)", true},
+		{local, "/media", true},
+		{filepath.Join(filepath.Dir(local), "other"), "", false},
+	}
+	for _, tt := range remoteTests {
+		if got, ok := m.ToRemote(tt.path); got != tt.want || ok != tt.ok {
+			t.Errorf("ToRemote(%s) = %q, %v; want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+	localTests := []struct {
+		path, want string
+		ok         bool
+	}{
+		{"/media/movies/Heat (1995)", filepath.Join(local, "movies", "Heat (1995)"), true},
+		// Windows hosts use backslashes
+		{`\media\tv\Andor`, filepath.Join(local, "tv", "Andor"), true},
+		{"/mediaserver/tv", "", false},
+	}
+	for _, tt := range localTests {
+		if got, ok := m.ToLocal(tt.path); got != tt.want || ok != tt.ok {
+			t.Errorf("ToLocal(%s) = %q, %v; want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+	if got, _ := (PathMap{}).ToLocal(`C:\lib\tv`); got != filepath.FromSlash("C:/lib/tv") {
+		t.Errorf("ToLocal() of the zero PathMap = %q, want the path with forward slashes", got)
+	}
+	if _, err := ParsePathMap("/mnt/media"); err == nil {
+		t.Error("ParsePathMap() without a remote path returned no error")
+	}
+}
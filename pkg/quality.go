@@ -0,0 +1,134 @@
+package kourai
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// resolutionTokenExpr matches the resolution tags of releases, e.g. 1080p
+	resolutionTokenExpr = regexp.MustCompile(`(?i)\b(4320p|2160p|1080[pi]|720p|576[pi]|480[pi]|4k|uhd)\b`)
+	// sourceExpr matches the source tags of releases, e.g. BluRay or WEB-DL
+	sourceExpr = regexp.MustCompile(`(?i)\b(blu-?ray|bd-?rip|br-?rip|bd-?remux|remux|web-?dl|web-?rip|web|hdtv|dvd-?rip|dvd|hdrip)\b`)
+	// codecExpr matches the video codec tags of releases, e.g. x264 or HEVC
+	codecExpr = regexp.MustCompile(`(?i)\b(x\.?26[45]|h\.?26[45]|hevc|avc|xvid|divx|av1|vp9)\b`)
+	// trailingGroupExpr matches the release group suffix of names, e.g.
+	// -GROUP, which only follows other release tags
+	trailingGroupExpr = regexp.MustCompile(`-([A-Za-z0-9]+)$`)
+	// leadingGroupExpr matches the bracketed release group prefix of
+	// fansubbed releases, e.g. [SubGroup]
+	leadingGroupExpr = regexp.MustCompile(`^\s*\[([^\]]+)\]`)
+)
+
+// sources are the names of the sources matched by sourceExpr, by their
+// lower case tag without dashes
+var sources = map[string]string{
+	"bluray":  "BluRay",
+	"bdrip":   "BluRay",
+	"brrip":   "BluRay",
+	"bdremux": "Remux",
+	"remux":   "Remux",
+	"webdl":   "WEB-DL",
+	"web":     "WEB-DL",
+	"webrip":  "WEBRip",
+	"hdtv":    "HDTV",
+	"dvdrip":  "DVD",
+	"dvd":     "DVD",
+	"hdrip":   "HDRip",
+}
+
+// codecs are the names of the codecs matched by codecExpr, by their lower
+// case tag without dots
+var codecs = map[string]string{
+	"x264": "H.264",
+	"h264": "H.264",
+	"avc":  "H.264",
+	"x265": "H.265",
+	"h265": "H.265",
+	"hevc": "H.265",
+	"xvid": "XviD",
+	"divx": "DivX",
+	"av1":  "AV1",
+	"vp9":  "VP9",
+}
+
+// quality is the quality of a release, as tagged in its name
+type quality struct {
+	// resolution is the vertical resolution, e.g. 1080p
+	resolution string
+	// source is the source of the release, e.g. BluRay or WEB-DL
+	source string
+	// codec is the video codec, e.g. H.264
+	codec string
+	// group is the release group
+	group string
+}
+
+// String returns the resolution and source of q, e.g. "1080p BluRay"
+func (q quality) String() string {
+	var s []string
+	for _, v := range []string{q.resolution, q.source} {
+		if v != "" {
+			s = append(s, v)
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+// parseQuality returns the quality tagged in name, a file or directory name
+// without extension. Release group suffixes are only taken from names with
+// other release tags, since titles contain dashes too.
+func parseQuality(name string) quality {
+	var q quality
+	if m := resolutionTokenExpr.FindStringSubmatch(name); m != nil {
+		q.resolution = strings.ToLower(m[1])
+		if q.resolution == "4k" || q.resolution == "uhd" {
+			q.resolution = "2160p"
+		}
+	}
+	if m := sourceExpr.FindStringSubmatch(name); m != nil {
+		q.source = sources[strings.ReplaceAll(strings.ToLower(m[1]), "-", "")]
+	}
+	if m := codecExpr.FindStringSubmatch(name); m != nil {
+		q.codec = codecs[strings.ReplaceAll(strings.ToLower(m[1]), ".", "")]
+	}
+	if m := leadingGroupExpr.FindStringSubmatch(name); m != nil {
+		q.group = strings.TrimSpace(m[1])
+	} else if q != (quality{}) {
+		// Tags are removed first, as some contain dashes, e.g. WEB-DL
+		rest := name
+		for _, e := range []*regexp.Regexp{resolutionTokenExpr, sourceExpr, codecExpr} {
+			rest = e.ReplaceAllString(rest, "")
+		}
+		if m := trailingGroupExpr.FindStringSubmatch(rest); m != nil {
+			q.group = m[1]
+		}
+	}
+	return q
+}
+
+// or returns q, with the values it lacks taken from other
+func (q quality) or(other quality) quality {
+	for _, v := range []struct{ to, from *string }{
+		{&q.resolution, &other.resolution},
+		{&q.source, &other.source},
+		{&q.codec, &other.codec},
+		{&q.group, &other.group},
+	} {
+		if *v.to == "" {
+			*v.to = *v.from
+		}
+	}
+	return q
+}
+
+// qualityOf returns the quality of l, or false for media of other packages
+func qualityOf(l Linkable) (quality, bool) {
+	switch v := l.(type) {
+	case *movie:
+		return v.quality, true
+	case *episode:
+		return v.quality, true
+	}
+	return quality{}, false
+}
@@ -0,0 +1,47 @@
+package kourai
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		name string
+		want quality
+	}{
+		{"Heat.1995.1080p.BluRay.x264-SPARKS", quality{"1080p", "BluRay", "H.264", "SPARKS"}},
+		{"Dune.Part.Two.2024.2160p.WEB-DL.DDP5.1.HEVC-GRP", quality{"2160p", "WEB-DL", "H.265", "GRP"}},
+		{"Movie 2019 4K UHD Remux", quality{resolution: "2160p", source: "Remux"}},
+		{"Show.S01E01.720p.HDTV", quality{resolution: "720p", source: "HDTV"}},
+		{"[SubGroup] Series Name - 013 [1080p]", quality{resolution: "1080p", group: "SubGroup"}},
+		// Dashes in titles aren't release groups
+		{"Spider-Man", quality{}},
+		{"Spider-Man.2002.DVDRip.XviD", quality{source: "DVD", codec: "XviD"}},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, parseQuality(tt.name), cmp.AllowUnexported(quality{})); diff != "" {
+			t.Errorf("parseQuality(%q) mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestQualityTemplate(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	tmpl, err := ParseTargetTemplate(`movies/{{.Title}} ({{.Year}}) - {{.Quality}}{{.Ext}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithTargetTemplates(tmpl, nil)(options)
+
+	m, err := MovieFromPath("/dl/Heat.1995.1080p.BluRay.x264-SPARKS/heat.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "movies/Heat (1995) - 1080p BluRay.mkv"
+	if got := m.Target(); got != want {
+		t.Errorf("Target() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Rematch looks the media of the destination dest up again from the names
+// of their sources, e.g. after the parser or the matcher improved, and
+// returns the renames of the entries that would now be named otherwise,
+// from their current target to the new one, in the order of their targets.
+//
+// Entries are found in the journal of dest, with the confidence of the
+// match they were linked by. Only entries matched by a search with a
+// confidence below the given one are looked up again; entries found by ID
+// or linked before confidences were journaled have none, and are only
+// looked up with a confidence above 1. Entries whose target was removed
+// are left out.
+//
+// Nothing is changed; the renames are applied with Link.Rename, and
+// recorded in the journal with the confidence of the new match.
+func Rematch(ctx context.Context, dest string, below float64, optionConfig ...Option) ([]Link, error) {
+	options.SetOptions(optionConfig...)
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ReadJournal(filepath.Join(dest, JournalName))
+	if err != nil {
+		return nil, err
+	}
+
+	type linked struct {
+		src        string
+		confidence float64
+	}
+	current := map[string]linked{}
+	for _, e := range entries {
+		src, target := absPath(e.Src), absPath(e.Target)
+		// Renames within the destination are followed back to the source
+		if prev, ok := current[src]; ok {
+			delete(current, src)
+			src = prev.src
+		}
+		current[target] = linked{src: src, confidence: e.Confidence}
+	}
+	targets := make([]string, 0, len(current))
+	for t := range current {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	links := []Link{}
+	var errs []error
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return links, err
+		}
+		e := current[target]
+		if below <= 1 && (e.confidence == 0 || e.confidence >= below) {
+			continue
+		}
+		if _, err := os.Lstat(target); err != nil {
+			continue
+		}
+		m, err := NewLinkable(e.src)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !matchMedia(ctx, m) {
+			continue
+		}
+		ln := LinkFromMedia(m, dest)
+		ln.Src = target
+		if absPath(ln.Target) != target {
+			links = append(links, ln)
+		}
+	}
+	return links, errors.Join(errs...)
+}
+
+// absPath returns the absolute form of p, or p cleaned when it has none
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return filepath.Clean(p)
+}
@@ -0,0 +1,68 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRematch(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	p := &fakeProvider{movies: map[string]MovieMetadata{
+		"Heat":  {Title: "Heat", Year: 1995},
+		"Alien": {Title: "Alien", Year: 1979},
+		"Dune":  {Title: "Dune", Year: 2021},
+	}}
+
+	dest := t.TempDir()
+	entries := []JournalEntry{
+		{Src: "/dl/Heat.1995.mkv", Target: filepath.Join(dest, "movies/Heet (1995)/Heat.1995.mkv"), Confidence: 0.5},
+		{Src: "/dl/Alien.1979.mkv", Target: filepath.Join(dest, "movies/Alien 2 (1979)/Alien.1979.mkv"), Confidence: 0.95},
+		{Src: "/dl/Dune.2021.mkv", Target: filepath.Join(dest, "movies/Dune/Dune.2021.mkv")},
+		// Renamed within the destination since, the source is followed
+		{Src: filepath.Join(dest, "movies/Dune/Dune.2021.mkv"), Target: filepath.Join(dest, "movies/Dune (1984)/Dune.2021.mkv")},
+		// Removed since
+		{Src: "/dl/Heat.1995.copy.mkv", Target: filepath.Join(dest, "movies/Heet (1995)/Heat.1995.copy.mkv"), Confidence: 0.5},
+	}
+	for _, e := range []JournalEntry{entries[0], entries[1], entries[3]} {
+		os.MkdirAll(filepath.Dir(e.Target), 0755)
+		if err := os.WriteFile(e.Target, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeJournal(filepath.Join(dest, JournalName), entries); err != nil {
+		t.Fatal(err)
+	}
+
+	renames := func(below float64) []string {
+		t.Helper()
+		links, err := Rematch(context.Background(), dest, below, WithMetadataProvider(p), WithFileExtensions([]string{"mkv"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, l := range links {
+			src, _ := filepath.Rel(dest, l.Src)
+			target, _ := filepath.Rel(dest, l.Target)
+			got = append(got, filepath.ToSlash(src)+" -> "+filepath.ToSlash(target))
+		}
+		return got
+	}
+
+	want := []string{"movies/Heet (1995)/Heat.1995.mkv -> movies/Heat (1995)/Heat.1995.mkv"}
+	if diff := cmp.Diff(want, renames(0.8)); diff != "" {
+		t.Errorf("Rematch() mismatch (-want +got):\n%s", diff)
+	}
+	want = []string{
+		"movies/Alien 2 (1979)/Alien.1979.mkv -> movies/Alien (1979)/Alien.1979.mkv",
+		"movies/Dune (1984)/Dune.2021.mkv -> movies/Dune (2021)/Dune.2021.mkv",
+		"movies/Heet (1995)/Heat.1995.mkv -> movies/Heat (1995)/Heat.1995.mkv",
+	}
+	if diff := cmp.Diff(want, renames(2)); diff != "" {
+		t.Errorf("Rematch() of every entry mismatch (-want +got):\n%s", diff)
+	}
+}
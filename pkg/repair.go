@@ -0,0 +1,196 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var folderYearExpr = regexp.MustCompile(`\s*\((?:19|20)\d{2}\)$`)
+
+// RepairTitle plans the renames fixing a movie or series that was matched
+// to the wrong TMDB entry. Every file in destination folders named after
+// title, with or without a year, is renamed to the names of the TMDB movie
+// or series with the given ID. Destination entries are hard links, so
+// renaming them within the destination keeps them linked to their sources.
+//
+// The type of the entry is taken from the folders that matched; use
+// WithExcludeTypes when a title exists as both a movie and a series.
+//
+// The correction is recorded in the alias database, when one is set, for
+// the titles parsed from the sources of the renamed files. Sources are
+// found in the journal of the destination. Movies keep their original
+// file names, so movie files without a journal entry are parsed instead.
+func RepairTitle(ctx context.Context, title string, id int, optionConfig ...Option) ([]Link, error) {
+	options.SetOptions(optionConfig...)
+	if options.TMDBClient == nil {
+		return nil, errors.New("a TMDB API key is required to repair a title")
+	}
+	if options.dest == "" {
+		return nil, errors.New("a destination is required to repair a title")
+	}
+
+	folders := map[string][]string{}
+	for _, kind := range []string{"movies", "tv"} {
+		mediaType := map[string]string{"movies": "movie", "tv": "episode"}[kind]
+		if _, ok := options.excludeTypes[mediaType]; ok {
+			continue
+		}
+		// The folder of the kind is named in the case of targets, see
+		// WithTargetCase, or in that of an existing folder
+		root := existingDirs(options.dest, options.targetCase.apply(kind)+"/")
+		// Misfiled folders, e.g. in the wrong shard, are left to fsck
+		dirs, _ := mediaFolders(filepath.Join(options.dest, root), mediaType)
+		for _, dir := range dirs {
+			base := filepath.Base(dir)
+			name := folderYearExpr.ReplaceAllString(base, "")
+			if strings.EqualFold(name, title) || strings.EqualFold(base, title) {
+				folders[kind] = append(folders[kind], dir)
+			}
+		}
+	}
+	if len(folders) == 0 {
+		return nil, fmt.Errorf("no movie or series named %q found in %s", title, options.dest)
+	}
+	if len(folders) > 1 {
+		return nil, fmt.Errorf("%q exists as both a movie and a series; exclude one of the types", title)
+	}
+
+	links := []Link{}
+	var errs []error
+	sources := journalSources(options.dest)
+	for kind, dirs := range folders {
+		for _, dir := range dirs {
+			l, err := repairFolder(ctx, dir, kind, id, sources)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			links = append(links, l...)
+		}
+	}
+	return links, errors.Join(errs...)
+}
+
+// journalSources maps the targets recorded in the journal of dest to
+// their original sources. Targets that were renamed within dest, e.g. by
+// an earlier repair, are followed back to the source they were linked
+// from.
+func journalSources(dest string) map[string]string {
+	sources := map[string]string{}
+	entries, err := ReadJournal(filepath.Join(dest, JournalName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		options.logger.Warn("failed to read journal, corrections are learned from file names only", "dest", dest, "error", err)
+	}
+	for _, e := range entries {
+		src := filepath.Clean(e.Src)
+		if orig, ok := sources[src]; ok {
+			src = orig
+		}
+		sources[filepath.Clean(e.Target)] = src
+	}
+	return sources
+}
+
+func repairFolder(ctx context.Context, dir string, kind string, id int, sources map[string]string) ([]Link, error) {
+	links := []Link{}
+	var errs []error
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		for _, filter := range options.fileFilters {
+			if filter.exclude(info) {
+				return nil
+			}
+		}
+
+		var l Linkable
+		switch kind {
+		case "movies":
+			m, err := MovieFromPath(p)
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			details, err := options.TMDBClient.MovieDetails(ctx, id)
+			if err != nil {
+				return err
+			}
+			// Movies keep their original file names, so the parsed title is
+			// the one future searches would use when the source is unknown
+			parsed := m
+			if src, ok := sources[filepath.Clean(p)]; ok {
+				if sm, err := MovieFromPath(src); err == nil {
+					parsed = sm
+				}
+			}
+			if err := options.aliases.Record(Alias{Type: AliasMovie, Title: parsed.title, Year: parsed.year, ID: id}); err != nil {
+				errs = append(errs, err)
+			}
+			m.title = details.Title
+			m.year = details.ReleaseDate.Year()
+			m.tmdbID = id
+			l = m
+		case "tv":
+			e, err := EpisodeFromPath(p)
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			// Episodes are renamed after the series, so only their source
+			// has the name future searches would use
+			if src, ok := sources[filepath.Clean(p)]; ok {
+				if se, err := EpisodeFromPath(src); err == nil {
+					if err := options.aliases.Record(Alias{Type: AliasSeries, Title: se.series, Year: se.year, ID: id}); err != nil {
+						errs = append(errs, err)
+					}
+				}
+			} else {
+				options.logger.Debug("no source recorded, correction not learned", "path", p)
+			}
+			details, err := options.TMDBClient.TVDetails(ctx, id)
+			if err != nil {
+				return err
+			}
+			e.series = details.Name
+			if !details.FirstAirDate.IsZero() {
+				e.year = details.FirstAirDate.Year()
+			}
+			e.tmdbID = id
+			if ep, err := options.TMDBClient.EpisodeDetails(ctx, id, e.season, e.episode); err == nil {
+				e.title = ep.Name
+			} else {
+				errs = append(errs, err)
+			}
+			l = e
+		}
+
+		ln := LinkFromMedia(l, options.dest)
+		if path.Clean(ln.Src) != path.Clean(ln.Target) {
+			links = append(links, ln)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return links, errors.Join(errs...)
+}
@@ -0,0 +1,155 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// repairTMDB serves the details of a movie and a series for repair tests
+func repairTMDB(t *testing.T, movieID, seriesID int) {
+	t.Helper()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/3/movie/%d", movieID):
+			fmt.Fprintf(w, `{"id":%d,"title":"The Thing","release_date":"1982-06-25"}`, movieID)
+		case fmt.Sprintf("/3/tv/%d", seriesID):
+			fmt.Fprintf(w, `{"id":%d,"name":"The Office","first_air_date":"2005-03-24"}`, seriesID)
+		case fmt.Sprintf("/3/tv/%d/season/1/episode/1", seriesID):
+			fmt.Fprint(w, `{"id":1,"name":"Pilot"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func createFiles(t *testing.T, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRepairTitle(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	repairTMDB(t, 754001, 754002)
+
+	dest := t.TempDir()
+	movie := filepath.Join(dest, "movies", "The Thing (2011)", "The.Thing.1982.mkv")
+	episode := filepath.Join(dest, "tv", "The Office (2001)", "Season 1", "The Office (2001) - S01E01 - Downsize.mkv")
+	createFiles(t, movie, episode)
+
+	tests := []struct {
+		title string
+		id    int
+		want  [][2]string
+	}{
+		{"The Thing", 754001, [][2]string{{
+			movie,
+			filepath.Join(dest, "movies", "The Thing (1982)", "The.Thing.1982.mkv"),
+		}}},
+		{"the office (2001)", 754002, [][2]string{{
+			episode,
+			filepath.Join(dest, "tv", "The Office (2005)", "Season 1", "The Office (2005) - S01E01 - Pilot.mkv"),
+		}}},
+	}
+	for _, tt := range tests {
+		links, err := RepairTitle(context.Background(), tt.title, tt.id, WithDestination(dest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := [][2]string{}
+		for _, l := range links {
+			got = append(got, [2]string{l.Src, l.Target})
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("RepairTitle(%q) mismatch (-want +got):\n%s", tt.title, diff)
+		}
+	}
+}
+
+func TestRepairTitleErrors(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	dest := t.TempDir()
+	createFiles(t,
+		filepath.Join(dest, "movies", "Dune (2021)", "Dune.2021.mkv"),
+		filepath.Join(dest, "tv", "Dune (2000)", "Season 1", "Dune (2000) - S01E01.mkv"),
+	)
+	if _, err := RepairTitle(context.Background(), "Dune", 1, WithDestination(dest)); err == nil {
+		t.Error("RepairTitle() without a TMDB client returned no error")
+	}
+
+	repairTMDB(t, 754003, 754004)
+	tests := []string{"Missing", "Dune"}
+	for _, title := range tests {
+		if _, err := RepairTitle(context.Background(), title, 754003, WithDestination(dest)); err == nil {
+			t.Errorf("RepairTitle(%q) returned no error", title)
+		}
+	}
+	links, err := RepairTitle(context.Background(), "Dune", 754003, WithDestination(dest), WithExcludeTypes(false, true))
+	if err != nil || len(links) != 1 {
+		t.Errorf("RepairTitle() of the movie only = %v, %v", links, err)
+	}
+}
+
+func TestRepairTitleAliases(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	repairTMDB(t, 755001, 755002)
+
+	root := t.TempDir()
+	dest := filepath.Join(root, "library")
+	links := []Link{{
+		Src:    filepath.Join(root, "dl", "Thing.1982.1080p.mkv"),
+		Target: filepath.Join(dest, "movies", "The Thing (2011)", "Thing.1982.1080p.mkv"),
+	}, {
+		Src:    filepath.Join(root, "dl", "The.Office.US.S01E01.mkv"),
+		Target: filepath.Join(dest, "tv", "The Office (2001)", "Season 1", "The Office (2001) - S01E01.mkv"),
+	}, {
+		// Renamed by an earlier repair
+		Src:    filepath.Join(dest, "tv", "The Office (2001)", "Season 1", "The Office (2001) - S01E01.mkv"),
+		Target: filepath.Join(dest, "tv", "The Office (2001)", "Season 1", "The Office (2001) - S01E01 - Downsize.mkv"),
+	}}
+	createFiles(t, links[0].Target, links[2].Target)
+	j, err := OpenJournal(filepath.Join(dest, JournalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ln := range links {
+		j.Record(string(ModeHardlink), ln)
+	}
+	j.Close()
+
+	db, err := OpenAliasDB(filepath.Join(root, "aliases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"The Thing", "The Office"} {
+		id := map[string]int{"The Thing": 755001, "The Office": 755002}[title]
+		if _, err := RepairTitle(context.Background(), title, id, WithDestination(dest), WithAliasDB(db)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []Alias{
+		{Type: AliasMovie, Title: "Thing", Year: 1982, ID: 755001},
+		{Type: AliasSeries, Title: "The Office US", ID: 755002},
+	}
+	got, err := db.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("aliases mismatch (-want +got):\n%s", diff)
+	}
+}
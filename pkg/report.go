@@ -0,0 +1,311 @@
+package kourai
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SkippedFile is a media file of a source that wasn't linked, and why.
+type SkippedFile struct {
+	Path string
+	// Code is why the file was skipped, one of the Skip constants
+	Code   string
+	Reason string
+}
+
+// Why files are skipped, as machine-readable codes
+const (
+	// SkipExtension is a video file without one of the extensions given to
+	// WithFileExtensions, or a file skipped by the policy of its extension,
+	// see WithExtensionPolicies
+	SkipExtension = "extension"
+	// SkipRegexp is a file or directory excluded by a pattern
+	SkipRegexp = "regexp"
+	// SkipDuplicate is a file with the same target as another
+	SkipDuplicate = "duplicate"
+	// SkipLowConfidence is a doubtful match, see WithMinConfidence
+	SkipLowConfidence = "low-confidence"
+	// SkipUnparsed is a file whose name couldn't be parsed
+	SkipUnparsed = "unparsed"
+	// SkipUnsettled is a file still being written, see WithSettleTime
+	SkipUnsettled = "unsettled"
+	// SkipType is a movie or episode of an excluded type
+	SkipType = "type"
+	// SkipNotSelected is media not matched by the selector of WithOnly
+	SkipNotSelected = "not-selected"
+	// SkipFilter is media excluded by a filter of its metadata, e.g. by
+	// country, company or watch history
+	SkipFilter = "filter"
+	// SkipProcessed is a source linked by an earlier run and unchanged
+	// since, see WithStateDB
+	SkipProcessed = "processed"
+	// SkipLinked is a source hard linked already, see WithSkipLinked
+	SkipLinked = "hard-linked"
+	// SkipIgnored is a file or directory ignored, see WithIgnores
+	SkipIgnored = "ignored"
+	// SkipUnreadable is a file or directory that couldn't be read, e.g.
+	// for lack of permission, see WithMaxIOErrors
+	SkipUnreadable = "unreadable"
+	// SkipSize is a video file smaller than allowed, see WithMinFileSize
+	SkipSize = "size"
+	// SkipCorrupt is a video that ffprobe can't read, or without a
+	// duration, see WithProbe
+	SkipCorrupt = "corrupt"
+)
+
+// WithSkipReport calls f with each media file that isn't linked because it
+// was excluded, or its name couldn't be parsed. Files without a media
+// extension, or smaller than allowed, are only reported when they're videos,
+// and files excluded by modification time aren't. f is called from several
+// workers at once.
+func WithSkipReport(f func(SkippedFile)) Option {
+	return func(o *Options) {
+		o.skipped = f
+	}
+}
+
+// skip reports that the file at path isn't linked, see WithSkipReport
+func skip(path, code, reason string) {
+	options.service.skip(code)
+	if options.skipped != nil {
+		options.skipped(SkippedFile{path, code, reason})
+	}
+}
+
+// mediaFilterReason describes why f excluded media, for skip reports
+func mediaFilterReason(f mediaFilter) string {
+	switch v := f.(type) {
+	case countryFilter:
+		return "excluded country"
+	case companyFilter:
+		if v.networks {
+			return "excluded network"
+		}
+		return "excluded company"
+	case watchedFilter:
+		return "watched already"
+	}
+	return "excluded by a filter"
+}
+
+// Report collects the links and skipped files of a run, usually a dry run,
+// to be reviewed as a single HTML page. It's safe for concurrent use.
+type Report struct {
+	mu      sync.Mutex
+	links   []Link
+	skipped []SkippedFile
+}
+
+func NewReport() *Report {
+	return &Report{}
+}
+
+// Add adds a link to r.
+func (r *Report) Add(l Link) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.links = append(r.links, l)
+}
+
+// Skipped adds a skipped file to r; it can be given to WithSkipReport.
+func (r *Report) Skipped(s SkippedFile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped = append(r.skipped, s)
+}
+
+// reportLink is a link of a report, with the problems found with it
+type reportLink struct {
+	Src       string
+	Target    string
+	Collision string
+	Doubt     string
+}
+
+// reportGroup is the links of a movie or show
+type reportGroup struct {
+	Name     string
+	Type     string
+	Links    []reportLink
+	Problems int
+}
+
+// lowConfidence returns why l was probably misnamed, or "" when it was
+// matched well
+func lowConfidence(l Linkable) string {
+	var doubts []string
+	if reason, ok := unsure(l); ok {
+		doubts = append(doubts, reason)
+	}
+	switch v := l.(type) {
+	case *movie:
+		if notFound(l) {
+			doubts = append(doubts, "not found by the metadata provider")
+		}
+		if !v.YearValid() {
+			doubts = append(doubts, "no year")
+		}
+	case *episode:
+		if notFound(l) {
+			doubts = append(doubts, "series not found by the metadata provider")
+		}
+		if v.title == "" {
+			doubts = append(doubts, "no episode title")
+		}
+	}
+	return strings.Join(doubts, ", ")
+}
+
+// notFound reports whether l was looked up without being found
+func notFound(l Linkable) bool {
+	if options.metadataProvider() == nil {
+		return false
+	}
+	switch v := l.(type) {
+	case *movie:
+		return v.tmdbID == 0 && v.released == 0
+	case *episode:
+		return v.tmdbID == 0 && v.released == 0
+	}
+	return false
+}
+
+// collision returns why the target of l can't be created: another link of
+// the run has the same target, ignoring case as some filesystems do, or a
+// file other than its source exists there already
+func collision(l Link, targets map[string]int) string {
+	if targets[strings.ToLower(l.Target)] > 1 {
+		return "same target as another file"
+	}
+	info, err := os.Stat(l.Target)
+	if err != nil {
+		return ""
+	}
+	if src, err := os.Stat(l.Src); err == nil && os.SameFile(src, info) {
+		return ""
+	}
+	return "target exists"
+}
+
+// groups returns the links of r by movie and show, sorted by name
+func (r *Report) groups() []*reportGroup {
+	targets := map[string]int{}
+	for _, l := range r.links {
+		targets[strings.ToLower(l.Target)]++
+	}
+	byName := map[string]*reportGroup{}
+	for _, l := range r.links {
+		f := Fields(l.media)
+		name := f.Title
+		if f.Type == "episode" {
+			name = f.Series
+		}
+		if f.Year != 0 {
+			name = fmt.Sprintf("%s (%d)", name, f.Year)
+		}
+		key := f.Type + "/" + name
+		g, ok := byName[key]
+		if !ok {
+			g = &reportGroup{Name: name, Type: f.Type}
+			byName[key] = g
+		}
+		rl := reportLink{Src: l.Src, Target: l.Target, Collision: collision(l, targets), Doubt: lowConfidence(l.media)}
+		if rl.Collision != "" || rl.Doubt != "" {
+			g.Problems++
+		}
+		g.Links = append(g.Links, rl)
+	}
+	groups := make([]*reportGroup, 0, len(byName))
+	for _, g := range byName {
+		sort.Slice(g.Links, func(i, j int) bool { return g.Links[i].Target < g.Links[j].Target })
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Type != groups[j].Type {
+			return groups[i].Type > groups[j].Type
+		}
+		return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name)
+	})
+	return groups
+}
+
+// WriteHTML writes r as a self-contained HTML page: links grouped by movie
+// and show, with collisions and low-confidence matches highlighted and the
+// groups having them expanded, followed by the skipped files.
+func (r *Report) WriteHTML(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := struct {
+		Generated  string
+		Links      int
+		Collisions int
+		Doubts     int
+		Groups     []*reportGroup
+		Skipped    []SkippedFile
+	}{
+		Generated: time.Now().Format(time.RFC1123),
+		Links:     len(r.links),
+		Groups:    r.groups(),
+		Skipped:   append([]SkippedFile(nil), r.skipped...),
+	}
+	for _, g := range data.Groups {
+		for _, l := range g.Links {
+			if l.Collision != "" {
+				data.Collisions++
+			}
+			if l.Doubt != "" {
+				data.Doubts++
+			}
+		}
+	}
+	sort.Slice(data.Skipped, func(i, j int) bool { return data.Skipped[i].Path < data.Skipped[j].Path })
+	return reportTemplate.Execute(w, data)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>kourai report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin: .5em 0 1em; }
+td, th { text-align: left; padding: .2em .6em; border-bottom: 1px solid #eee; font-family: ui-monospace, monospace; font-size: .85em; word-break: break-all; }
+th { font-family: system-ui, sans-serif; }
+summary { cursor: pointer; padding: .2em 0; }
+.count { color: #777; }
+.collision { background: #fdd; }
+.doubt { background: #ffc; }
+.flag { font-family: system-ui, sans-serif; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>kourai report</h1>
+<p>{{.Generated}}: {{.Links}} links, <span class="collision">{{.Collisions}} collisions</span>, <span class="doubt">{{.Doubts}} low-confidence matches</span>, {{len .Skipped}} skipped files.</p>
+<h2>Links</h2>
+{{range .Groups}}<details{{if .Problems}} open{{end}}>
+<summary><strong>{{.Name}}</strong> <span class="count">{{.Type}}, {{len .Links}} files{{if .Problems}}, {{.Problems}} to review{{end}}</span></summary>
+<table>
+<tr><th>Source</th><th>Target</th><th></th></tr>
+{{range .Links}}<tr{{if .Collision}} class="collision"{{else if .Doubt}} class="doubt"{{end}}><td>{{.Src}}</td><td>{{.Target}}</td><td class="flag">{{.Collision}}{{if and .Collision .Doubt}}; {{end}}{{.Doubt}}</td></tr>
+{{end}}</table>
+</details>
+{{else}}<p>Nothing to link.</p>
+{{end}}<h2>Skipped files</h2>
+{{if .Skipped}}<details>
+<summary>{{len .Skipped}} files</summary>
+<table>
+<tr><th>Path</th><th>Reason</th></tr>
+{{range .Skipped}}<tr><td>{{.Path}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+</details>
+{{else}}<p>No files were skipped.</p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,62 @@
+package kourai
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	root := t.TempDir()
+	for _, name := range []string{
+		"Show.S01E01.mkv",
+		"Show.S01E01.720p.mkv",
+		"Show.S01E02.Second.mkv",
+		"Heat.1995.mkv",
+		"Heat.1995.sample.mkv",
+		"Untitled Film.mkv",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := NewReport()
+	links, _ := LinkFromFiles(context.Background(),
+		WithSources([]string{root}),
+		WithDestination(t.TempDir()),
+		WithFileExtensions([]string{"mkv"}),
+		WithSkipReport(report.Skipped),
+	)
+	for l := range links {
+		report.Add(l)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+
+	for _, want := range []string{
+		"5 links, <span class=\"collision\">2 collisions</span>",
+		"<strong>Show</strong> <span class=\"count\">episode, 3 files, 2 to review</span>",
+		"<strong>Heat (1995)</strong> <span class=\"count\">movie, 1 files</span>",
+		"same target as another file",
+		"no year",
+		"Heat.1995.sample.mkv</td><td>excluded by pattern",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("WriteHTML() doesn't contain %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "notes.txt") {
+		t.Errorf("WriteHTML() reports a file without a media extension")
+	}
+}
@@ -0,0 +1,68 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Research looks the media of ln up again as query, e.g. "Dune (2021)",
+// when it was matched to the wrong movie or series, and returns the link
+// to its new target. The match is recorded as an alias of the names parsed
+// from the source, so that later runs find it too. It fails when nothing
+// matches query.
+func (ln Link) Research(ctx context.Context, query string) (Link, error) {
+	p := options.metadataProvider()
+	if p == nil {
+		return Link{}, errors.New("searching needs a TMDB API key or another metadata provider")
+	}
+	title, year := strings.TrimSpace(query), 0
+	if y, loc := findYear(title); loc != nil {
+		year = y
+		title = strings.TrimSpace(title[:loc[0]] + title[loc[1]:])
+	}
+	if title == "" {
+		return Link{}, errors.New("nothing to search for")
+	}
+
+	var l Linkable
+	var alias Alias
+	switch v := ln.media.(type) {
+	case *movie:
+		m := *v
+		m.title, m.year, m.tmdbID, m.released, m.confidence, m.matchedBy = title, year, 0, 0, 0, ""
+		m.external, m.collection, m.fileYear = externalID{}, "", 0
+		lookup(ctx, p, &m)
+		if m.tmdbID == 0 {
+			return Link{}, fmt.Errorf("%w for movie %q", ErrNoMatch, query)
+		}
+		if options.collectionDirs {
+			m.setCollection(ctx)
+		}
+		if parsed, err := MovieFromPath(m.path); err == nil {
+			alias = Alias{Type: AliasMovie, Title: parsed.title, Year: parsed.year, ID: m.tmdbID}
+		}
+		l = &m
+	case *episode:
+		e := *v
+		e.series, e.year, e.tmdbID, e.released, e.confidence, e.matchedBy = title, year, 0, 0, 0, ""
+		e.external = externalID{}
+		lookup(ctx, p, &e)
+		if e.tmdbID == 0 {
+			return Link{}, fmt.Errorf("%w for series %q", ErrNoMatch, query)
+		}
+		if parsed, err := EpisodeFromPath(e.path); err == nil {
+			alias = Alias{Type: AliasSeries, Title: parsed.series, Year: parsed.year, ID: e.tmdbID}
+		}
+		l = &e
+	default:
+		return Link{}, fmt.Errorf("%w media, %s can't be searched for", ErrUnsupportedType, ln.Src)
+	}
+	if alias.ID != 0 {
+		if err := options.aliases.Record(alias); err != nil {
+			options.logger.Warn("failed to record the match as an alias", "path", ln.Src, "error", err)
+		}
+	}
+	return LinkFromMedia(l, options.destination(l)), nil
+}
@@ -0,0 +1,59 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestResearch(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/3/search/movie" && q.Get("query") == "Stalker" && q.Get("year") == "1979":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[
+				{"id":780001,"title":"Stalker","release_date":"1979-05-25","popularity":20}]}`)
+		case r.URL.Path == "/3/search/movie" && q.Get("query") == "Stalker":
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[
+				{"id":780002,"title":"Stalker","release_date":"2010-01-01","popularity":30}]}`)
+		default:
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[]}`)
+		}
+	}))
+	db, err := OpenAliasDB(filepath.Join(t.TempDir(), "aliases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.SetOptions(WithDestination("/lib"), WithAliasDB(db))
+
+	m, _ := NewLinkable("/dl/Stalker.mkv")
+	lookup(context.Background(), options.metadataProvider(), m)
+	ln := LinkFromMedia(m, options.dest)
+	if want := filepath.Join("/lib", "movies/Stalker (2010)/Stalker.mkv"); ln.Target != want {
+		t.Fatalf("Target = %q, want %q", ln.Target, want)
+	}
+
+	got, err := ln.Research(context.Background(), "Stalker (1979)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("/lib", "movies/Stalker (1979)/Stalker.mkv"); got.Target != want || got.Src != ln.Src {
+		t.Errorf("Research() = %s → %s, want %s → %s", got.Src, got.Target, ln.Src, want)
+	}
+	if id, ok := options.aliases.Lookup(AliasMovie, "Stalker", 0); !ok || id != 780001 {
+		t.Errorf("alias of the source = %d, %v, want 780001", id, ok)
+	}
+	// The link researched is left alone
+	if f := Fields(ln.Media()); f.TMDBID != 780002 {
+		t.Errorf("original link changed to %d", f.TMDBID)
+	}
+
+	if _, err := ln.Research(context.Background(), "Nothing Like It"); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("Research() for a query without results = %v, want ErrNoMatch", err)
+	}
+}
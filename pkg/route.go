@@ -0,0 +1,142 @@
+package kourai
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Route links the media released in a range of decades into another
+// library than the destination, e.g. films made before 1970 into a library
+// of classics.
+type Route struct {
+	// From and To are the first and last decade of the range, e.g. 1960
+	// for the 1960s, or 0 when the range is open on that side
+	From int
+	To   int
+	// Dest is the directory of the library
+	Dest string
+}
+
+// ParseRoute parses a route given as <decades>=<dir>, where decades is a
+// decade, e.g. 1970s, or a range of decades, e.g. 1950s-1960s, that may be
+// open on either side: -1960s routes media released before 1970, and 2000s-
+// media released since 2000.
+func ParseRoute(s string) (Route, error) {
+	decades, dest, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(dest) == "" {
+		return Route{}, fmt.Errorf("invalid route %q, expected <decades>=<dir>, e.g. -1960s=/media/classics", s)
+	}
+	r := Route{Dest: strings.TrimSpace(dest)}
+	from, to, isRange := strings.Cut(strings.TrimSpace(decades), "-")
+	if !isRange {
+		to = from
+	}
+	var err error
+	if r.From, err = parseDecade(from); err != nil {
+		return Route{}, fmt.Errorf("invalid route %q: %w", s, err)
+	}
+	if r.To, err = parseDecade(to); err != nil {
+		return Route{}, fmt.Errorf("invalid route %q: %w", s, err)
+	}
+	if r.From == 0 && r.To == 0 {
+		return Route{}, fmt.Errorf("invalid route %q: no decade given", s)
+	}
+	if r.To != 0 && r.From > r.To {
+		return Route{}, fmt.Errorf("invalid route %q: %ds is after %ds", s, r.From, r.To)
+	}
+	return r, nil
+}
+
+// parseDecade parses a decade such as 1970s, or returns 0 for an empty
+// string
+func parseDecade(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	d, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(s), "s"))
+	if err != nil || d < 1000 || d%10 != 0 {
+		return 0, fmt.Errorf("invalid decade %q, expected e.g. 1970s", s)
+	}
+	return d, nil
+}
+
+// matches reports whether year is in the decades of r
+func (r Route) matches(year int) bool {
+	if year == 0 {
+		return false
+	}
+	return (r.From == 0 || year >= r.From) && (r.To == 0 || year < r.To+10)
+}
+
+// WithRoutes links media into the library of the first route matching the
+// decade they were released in, instead of the destination. Release years
+// come from the metadata provider, e.g. the TMDB release date of movies and
+// first air date of series, rather than the paths, unless media aren't
+// looked up.
+func WithRoutes(routes []Route) Option {
+	return func(o *Options) {
+		o.routes = routes
+	}
+}
+
+// destination returns the library l is linked into
+func (o *Options) destination(l Linkable) string {
+	year := releaseYear(l)
+	for _, r := range o.routes {
+		if r.matches(year) {
+			return r.Dest
+		}
+	}
+	return o.dest
+}
+
+// Destinations returns the libraries media are linked into: the destination
+// followed by those of the routes, without duplicates, see WithRoutes.
+func Destinations() []string {
+	dests := []string{options.dest}
+	for _, r := range options.routes {
+		if !slices.Contains(dests, r.Dest) {
+			dests = append(dests, r.Dest)
+		}
+	}
+	return dests
+}
+
+// Destination returns the library the target of ln is in, the destination
+// or that of a route, see Destinations.
+func (ln Link) Destination() string {
+	return options.destination(ln.media)
+}
+
+// releaseYear returns the year l was released, or its series first aired,
+// as given by the metadata provider or else parsed from its path, or 0
+// when it's unknown
+func releaseYear(l Linkable) int {
+	switch m := l.(type) {
+	case *movie:
+		if m.released != 0 {
+			return m.released
+		}
+		if m.YearValid() {
+			return m.year
+		}
+	case *episode:
+		if m.released != 0 {
+			return m.released
+		}
+		return m.year
+	}
+	return 0
+}
+
+// decade formats the decade of year, e.g. 1970s, or returns an empty string
+// when year is 0
+func decade(year int) string {
+	if year == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", year-year%10)
+}
@@ -0,0 +1,88 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Route
+		err  bool
+	}{
+		{in: "1970s=/lib", want: Route{1970, 1970, "/lib"}},
+		{in: "-1960s=/media/classics", want: Route{0, 1960, "/media/classics"}},
+		{in: "2000s-=/new", want: Route{2000, 0, "/new"}},
+		{in: "1950S-1960s = /lib", want: Route{1950, 1960, "/lib"}},
+		{in: "1970s", err: true},
+		{in: "1975s=/lib", err: true},
+		{in: "-=/lib", err: true},
+		{in: "1990s-1980s=/lib", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRoute(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseRoute(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("ParseRoute(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/3/search/movie":
+			if r.URL.Query().Get("query") != "Casablanca" {
+				fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"page":1,"total_pages":1,"results":[{"id":775001,"title":"Casablanca","release_date":"1942-11-26"}]}`)
+		case "/3/movie/775002":
+			fmt.Fprint(w, `{"id":775002,"title":"Heat","release_date":"1995-12-15"}`)
+		case "/3/tv/775003":
+			fmt.Fprint(w, `{"id":775003,"name":"The Twilight Zone","first_air_date":"1959-10-02"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	routes := []Route{{To: 1960, Dest: "/classics"}, {From: 1990, To: 1990, Dest: "/nineties"}}
+	options.SetOptions(WithDestination("/media"), WithRoutes(routes))
+
+	tests := []struct {
+		media Linkable
+		want  string
+	}{
+		// The year of the file name is that of a remaster
+		{&movie{title: "Casablanca", year: 1992, path: "casablanca.1992.mkv"}, "/classics/movies/Casablanca (1992)/casablanca.1992.mkv"},
+		{&movie{title: "Heat", year: 1995, path: "heat.mkv", tmdbID: 775002}, "/nineties/movies/Heat (1995)/heat.mkv"},
+		{&episode{series: "The Twilight Zone", id: "S01E01", season: 1, episode: 1, path: "tz.s01e01.mkv", tmdbID: 775003},
+			"/classics/tv/The Twilight Zone/Season 1/The Twilight Zone - S01E01.mkv"},
+		{&movie{title: "Unknown", year: 2010, path: "unknown.2010.mkv"}, "/media/movies/Unknown (2010)/unknown.2010.mkv"},
+	}
+	for _, tt := range tests {
+		ln, ok := linkFromMedia(context.Background(), tt.media)
+		if !ok {
+			t.Fatalf("linkFromMedia(%s) skipped the media", tt.media.Path())
+		}
+		if ln.Target != tt.want {
+			t.Errorf("linkFromMedia(%s) target = %s, want %s", tt.media.Path(), ln.Target, tt.want)
+		}
+		if dest := ln.Destination(); !strings.HasPrefix(ln.Target, dest+"/") {
+			t.Errorf("Destination() of %s = %s, which doesn't contain it", ln.Target, dest)
+		}
+	}
+	if diff := cmp.Diff([]string{"/media", "/classics", "/nineties"}, Destinations()); diff != "" {
+		t.Errorf("Destinations() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,168 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ScanResult is a media file found by Scan: a movie or an episode, which
+// is Matched when the metadata provider found it, or a file that would be
+// skipped, with the Reason.
+type ScanResult struct {
+	Path string `json:"path"`
+	// Type is "movie" or "episode", or empty for skipped files
+	Type       string  `json:"type,omitempty"`
+	Title      string  `json:"title,omitempty"`
+	Series     string  `json:"series,omitempty"`
+	Year       int     `json:"year,omitempty"`
+	EpisodeID  string  `json:"episode_id,omitempty"`
+	TMDBID     int     `json:"tmdb_id,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	// Target is the path the file would be linked to, relative to the
+	// destination
+	Target  string `json:"target,omitempty"`
+	Matched bool   `json:"matched"`
+	// MatchedBy is how a matched file was found, one of the MatchedBy
+	// constants, or empty when it's named after its path
+	MatchedBy string `json:"matched_by,omitempty"`
+	// SkippedBecause is why the file would be skipped, one of the Skip
+	// constants
+	SkippedBecause string `json:"skipped_because,omitempty"`
+	// Reason is why the file is skipped, or why a match is doubtful
+	Reason string `json:"reason,omitempty"`
+	// FileYear is the year of the name of a movie that was corrected to
+	// the release year of its match, see WithFileYear
+	FileYear int `json:"file_year,omitempty"`
+}
+
+// How media are matched, as machine-readable codes
+const (
+	// MatchedBySearch is media found by searching the metadata provider
+	// for the names parsed from its path
+	MatchedBySearch = "tmdb-search"
+	// MatchedByIDTag is media looked up by the provider ID tagged in its
+	// name, e.g. [tmdbid-1234]
+	MatchedByIDTag = "id-tag"
+	// MatchedByNFO is media named after, or looked up by the IDs of, the
+	// NFO next to it
+	MatchedByNFO = "nfo"
+	// MatchedByCache is media looked up by a match remembered in the alias
+	// database
+	MatchedByCache = "cache"
+)
+
+// Scan finds, parses and looks up the media of the sources like
+// LinkFromFiles, without needing a destination or changing any file, and
+// returns a result for each media file, including those that would be
+// skipped. Media without a metadata provider are matched by the names
+// parsed from their paths.
+func Scan(ctx context.Context, optionConfig ...Option) (<-chan ScanResult, <-chan error) {
+	options.SetOptions(optionConfig...)
+	resultc := make(chan ScanResult)
+	errc := make(chan error, 1)
+	if err := options.validateSources(); err != nil {
+		close(resultc)
+		errc <- fmt.Errorf("invalid options: %w", err)
+		return resultc, errc
+	}
+	if err := options.openState(); err != nil {
+		close(resultc)
+		errc <- err
+		return resultc, errc
+	}
+
+	send := func(r ScanResult) {
+		select {
+		case resultc <- r:
+		case <-ctx.Done():
+		}
+	}
+	skipped := options.skipped
+	options.skipped = func(s SkippedFile) {
+		if skipped != nil {
+			skipped(s)
+		}
+		send(ScanResult{Path: s.Path, SkippedBecause: s.Code, Reason: s.Reason})
+	}
+
+	mediac := findSources(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < options.netWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range mediac {
+				if matchMedia(ctx, m) {
+					send(scanResult(m))
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		options.skipped = skipped
+		close(resultc)
+	}()
+	errc <- nil
+	return resultc, errc
+}
+
+// scanResult describes m, which was looked up
+func scanResult(m Linkable) ScanResult {
+	f := Fields(m)
+	r := ScanResult{
+		Path:       m.Path(),
+		Type:       f.Type,
+		Title:      f.Title,
+		Series:     f.Series,
+		Year:       f.Year,
+		EpisodeID:  f.EpisodeID,
+		TMDBID:     f.TMDBID,
+		Confidence: Confidence(m),
+		Target:     m.Target(),
+		Reason:     lowConfidence(m),
+	}
+	if v, ok := m.(*movie); ok {
+		r.FileYear = v.fileYear
+	}
+	_, doubtful := unsure(m)
+	r.Matched = !doubtful && !notFound(m)
+	if r.Matched {
+		r.MatchedBy = matchedBy(m)
+	}
+	return r
+}
+
+// matchedBy returns how l was found, see the MatchedBy constants
+func matchedBy(l Linkable) string {
+	switch v := l.(type) {
+	case *movie:
+		return v.matchedBy
+	case *episode:
+		return v.matchedBy
+	}
+	return ""
+}
+
+// MarkDuplicates marks the results having the same target as another as
+// skipped duplicates, but for that of the highest ranked source, see
+// WithSourcePriority, or else the first of them in the order given, since
+// only one file can be linked to a target. Targets are compared ignoring
+// case, as some filesystems do.
+func MarkDuplicates(results []ScanResult) {
+	won := winners(len(results),
+		func(i int) string {
+			if results[i].SkippedBecause != "" {
+				return ""
+			}
+			return results[i].Target
+		},
+		func(i int) string { return results[i].Path })
+	for i, w := range won {
+		if w >= 0 && w != i {
+			results[i].SkippedBecause = SkipDuplicate
+			results[i].Reason = "same target as " + results[w].Path
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScan(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src := t.TempDir()
+	for _, f := range []string{"Alien.1979.mkv", "Show/Show.S01E02.mkv", "Alien.1979.sample.mkv", "Alien.1979.mp4", "Alien.1979.srt"} {
+		p := filepath.Join(src, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, _ := os.ReadDir(src)
+
+	resultc, errc := Scan(context.Background(), WithSources([]string{src}), WithFileExtensions([]string{"mkv"}))
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	got := []ScanResult{}
+	for r := range resultc {
+		got = append(got, r)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+	want := []ScanResult{
+		{Path: filepath.Join(src, "Alien.1979.mkv"), Type: "movie", Title: "Alien", Year: 1979, Target: "movies/Alien (1979)/Alien.1979.mkv", Matched: true},
+		{Path: filepath.Join(src, "Alien.1979.mp4"), SkippedBecause: SkipExtension, Reason: "extension not included"},
+		{Path: filepath.Join(src, "Alien.1979.sample.mkv"), SkippedBecause: SkipRegexp, Reason: "excluded by pattern"},
+		{Path: filepath.Join(src, "Show/Show.S01E02.mkv"), Type: "episode", Series: "Show", EpisodeID: "S01E02", Target: "tv/Show/Season 1/Show - S01E02.mkv", Matched: true, Reason: "no episode title"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Scan() mismatch (-want +got):\n%s", diff)
+	}
+	if after, _ := os.ReadDir(src); len(after) != len(before) {
+		t.Errorf("Scan() changed the source, %d entries instead of %d", len(after), len(before))
+	}
+	if options.skipped != nil {
+		t.Error("Scan() left its skip report set")
+	}
+}
+
+func TestMarkDuplicates(t *testing.T) {
+	results := []ScanResult{
+		{Path: "/dl/a/Alien.1979.mkv", Type: "movie", Target: "movies/Alien (1979)/Alien.1979.mkv", Matched: true},
+		{Path: "/dl/b/alien.1979.mkv", Type: "movie", Target: "movies/Alien (1979)/alien.1979.mkv", Matched: true},
+		{Path: "/dl/Heat.1995.mkv", Type: "movie", Target: "movies/Heat (1995)/Heat.1995.mkv", Matched: true},
+		{Path: "/dl/Heat.1995.sample.mkv", SkippedBecause: SkipRegexp, Reason: "excluded by pattern"},
+	}
+	MarkDuplicates(results)
+	var got []string
+	for _, r := range results {
+		got = append(got, r.SkippedBecause)
+	}
+	if diff := cmp.Diff([]string{"", SkipDuplicate, "", SkipRegexp}, got); diff != "" {
+		t.Errorf("MarkDuplicates() mismatch (-want +got):\n%s", diff)
+	}
+	if want := "same target as /dl/a/Alien.1979.mkv"; results[1].Reason != want {
+		t.Errorf("Reason = %q, want %q", results[1].Reason, want)
+	}
+}
@@ -0,0 +1,258 @@
+package kourai
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	ScrubOK       = "ok"
+	ScrubMismatch = "mismatch"
+	ScrubMissing  = "missing"
+	ScrubError    = "error"
+)
+
+// ScrubResult is the outcome of verifying a single manifest entry.
+type ScrubResult struct {
+	Path   string
+	Status string
+	Want   string
+	Got    string
+	Err    error
+}
+
+// manifestAlgos maps the names of checksum manifests to their algorithm
+func manifestAlgos() map[string]string {
+	algos := map[string]string{}
+	for algo, name := range checksumFormats {
+		algos[name] = algo
+	}
+	return algos
+}
+
+// Scrub finds the checksum manifests written by ChecksumWriter below dest
+// and re-hashes the files they list, reporting files that are missing or
+// whose contents changed. With xattrs set, files not listed in a manifest
+// are verified against the checksum stored in their extended attributes.
+// sample is the fraction of files to verify; values outside (0, 1) verify
+// every file.
+func Scrub(dest string, sample float64, xattrs bool) ([]ScrubResult, error) {
+	algos := manifestAlgos()
+	results := []ScrubResult{}
+	var errs []error
+	var files []string
+	err := filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		algo, ok := algos[d.Name()]
+		if d.IsDir() || !ok {
+			return nil
+		}
+		r, err := scrubManifest(path, algo, sample)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		results = append(results, r...)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if !xattrs {
+		return results, errors.Join(errs...)
+	}
+
+	// Manifest entries were sampled already
+	listed := map[string]bool{}
+	for _, r := range results {
+		listed[r.Path] = true
+	}
+	for _, path := range files {
+		if listed[path] || (sample > 0 && sample < 1 && rand.Float64() >= sample) {
+			continue
+		}
+		if r, ok := scrubXattr(path); ok {
+			results = append(results, r)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// storedChecksum returns the checksum stored in an extended attribute of
+// path, and its algorithm
+func storedChecksum(path string) (algo string, sum string, ok bool) {
+	for algo := range checksumFormats {
+		if b, err := getXattr(path, checksumXattrPrefix+algo); err == nil {
+			return algo, string(b), true
+		}
+	}
+	return "", "", false
+}
+
+// scrubXattr verifies path against the checksum stored in its extended
+// attributes, if any
+func scrubXattr(path string) (ScrubResult, bool) {
+	algo, want, ok := storedChecksum(path)
+	if !ok {
+		return ScrubResult{}, false
+	}
+	return verify(path, algo, want), true
+}
+
+// verify hashes path and compares it to want
+func verify(path, algo, want string) ScrubResult {
+	r := ScrubResult{Path: path, Want: want}
+	r.Got, r.Err = hashFile(algo, path)
+	switch {
+	case errors.Is(r.Err, os.ErrNotExist):
+		r.Status = ScrubMissing
+	case r.Err != nil:
+		r.Status = ScrubError
+	case r.Got != r.Want:
+		r.Status = ScrubMismatch
+	default:
+		r.Status = ScrubOK
+	}
+	return r
+}
+
+func scrubManifest(manifest, algo string, sample float64) ([]ScrubResult, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(manifest)
+	results := []ScrubResult{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rel, want, ok := parseChecksumLine(algo, scanner.Text())
+		if !ok {
+			continue
+		}
+		if sample > 0 && sample < 1 && rand.Float64() >= sample {
+			continue
+		}
+
+		results = append(results, verify(filepath.Join(dir, filepath.FromSlash(rel)), algo, want))
+	}
+	return results, scanner.Err()
+}
+
+// manifestEntries returns the checksums listed in a manifest, by path
+func manifestEntries(manifest, algo string) (map[string]string, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(manifest)
+	entries := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rel, sum, ok := parseChecksumLine(algo, scanner.Text()); ok {
+			entries[filepath.Join(dir, filepath.FromSlash(rel))] = sum
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// ScrubWatch watches the files below dest for changes, and verifies each
+// changed file that is listed in a checksum manifest, or with xattrs set
+// has a stored checksum, once it was left alone for settle. Results are
+// passed to report. It returns when ctx is done.
+func ScrubWatch(ctx context.Context, dest string, xattrs bool, settle time.Duration, report func(ScrubResult)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	type checksum struct{ algo, sum string }
+	algos := manifestAlgos()
+	expected := map[string]checksum{}
+	load := func(manifest, algo string) {
+		entries, err := manifestEntries(manifest, algo)
+		if err != nil {
+			options.logger.Warn("failed to read checksum manifest", "path", manifest, "error", err)
+		}
+		for path, sum := range entries {
+			expected[path] = checksum{algo, sum}
+		}
+	}
+	watch := func(root string) error {
+		return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return watcher.Add(path)
+			}
+			if algo, ok := algos[d.Name()]; ok {
+				load(path, algo)
+			}
+			return nil
+		})
+	}
+	if err := watch(dest); err != nil {
+		return err
+	}
+
+	if settle <= 0 {
+		settle = time.Second
+	}
+	pending := map[string]time.Time{}
+	ticker := time.NewTicker(settle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.Errors:
+			options.logger.Warn("watching for changes failed", "dest", dest, "error", err)
+		case ev := <-watcher.Events:
+			if algo, ok := algos[filepath.Base(ev.Name)]; ok {
+				load(ev.Name, algo)
+				continue
+			}
+			if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+				if ev.Has(fsnotify.Create) {
+					if err := watch(ev.Name); err != nil {
+						options.logger.Warn("failed to watch directory", "path", ev.Name, "error", err)
+					}
+				}
+				continue
+			}
+			pending[ev.Name] = time.Now()
+		case now := <-ticker.C:
+			for path, changed := range pending {
+				if now.Sub(changed) < settle {
+					continue
+				}
+				delete(pending, path)
+				if c, ok := expected[path]; ok {
+					report(verify(path, c.algo, c.sum))
+				} else if xattrs {
+					if r, ok := scrubXattr(path); ok {
+						report(r)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// scrubLibrary links files into a new destination with a checksum
+// manifest, and returns the destination and the targets
+func scrubLibrary(t *testing.T, xattrs bool) (string, []string) {
+	t.Helper()
+	dest := t.TempDir()
+	w, err := NewChecksumWriter(dest, "sha256", xattrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []string{
+		filepath.Join(dest, "movies", "A (2000)", "A (2000).mkv"),
+		filepath.Join(dest, "movies", "B (2001)", "B (2001).mkv"),
+		filepath.Join(dest, "movies", "C (2002)", "C (2002).mkv"),
+	}
+	for _, target := range targets {
+		os.MkdirAll(filepath.Dir(target), 0755)
+		if err := os.WriteFile(target, []byte(filepath.Base(target)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Add(Link{Target: target}); err != nil {
+			if xattrs {
+				t.Skip("extended attributes not supported:", err)
+			}
+			t.Fatal(err)
+		}
+	}
+	return dest, targets
+}
+
+func scrubStatuses(results []ScrubResult) map[string]string {
+	got := map[string]string{}
+	for _, r := range results {
+		got[r.Path] = r.Status
+	}
+	return got
+}
+
+func TestScrub(t *testing.T) {
+	dest, targets := scrubLibrary(t, false)
+	if err := os.WriteFile(targets[1], []byte("bit rot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(targets[2])
+
+	results, err := Scrub(dest, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		targets[0]: ScrubOK,
+		targets[1]: ScrubMismatch,
+		targets[2]: ScrubMissing,
+	}
+	if diff := cmp.Diff(want, scrubStatuses(results)); diff != "" {
+		t.Errorf("Scrub() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestScrubXattrs(t *testing.T) {
+	dest, targets := scrubLibrary(t, true)
+	// Without manifests, only the extended attributes are left
+	matches, _ := filepath.Glob(filepath.Join(dest, "movies", "*", "CHECKSUMS.sha256"))
+	for _, m := range matches {
+		os.Remove(m)
+	}
+	if err := os.WriteFile(targets[0], []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Scrub(dest, 1, false)
+	if err != nil || len(results) != 0 {
+		t.Errorf("Scrub() without xattrs = %v, %v, want no results", results, err)
+	}
+	results, err = Scrub(dest, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		targets[0]: ScrubMismatch,
+		targets[1]: ScrubOK,
+		targets[2]: ScrubOK,
+	}
+	if diff := cmp.Diff(want, scrubStatuses(results)); diff != "" {
+		t.Errorf("Scrub() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestScrubWatch(t *testing.T) {
+	dest, targets := scrubLibrary(t, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results := make(chan ScrubResult, 10)
+	done := make(chan error)
+	go func() {
+		done <- ScrubWatch(ctx, dest, false, 50*time.Millisecond, func(r ScrubResult) { results <- r })
+	}()
+	// Give the watcher time to start
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(targets[1], []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Files without a checksum are not reported
+	if err := os.WriteFile(filepath.Join(filepath.Dir(targets[1]), "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	select {
+	case r := <-results:
+		got = append(got, r.Path+" "+r.Status)
+	case <-ctx.Done():
+		t.Fatal("ScrubWatch() reported no modified file")
+	}
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+	close(results)
+	for r := range results {
+		got = append(got, r.Path+" "+r.Status)
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{targets[1] + " " + ScrubMismatch}, got); diff != "" {
+		t.Errorf("ScrubWatch() mismatch (-want +got):\n%s", diff)
+	}
+}
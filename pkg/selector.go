@@ -0,0 +1,161 @@
+package kourai
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var selectorFields = map[string]bool{
+	"type":    true,
+	"series":  true,
+	"title":   true,
+	"year":    true,
+	"season":  true,
+	"episode": true,
+	// the quality tagged in names, or probed, e.g. resolution=1080p
+	"resolution": true,
+	"source":     true,
+	"codec":      true,
+	"group":      true,
+	// the codecs and height probed from files, see WithProbe
+	"vcodec": true,
+	"acodec": true,
+	"height": true,
+}
+
+// Selector matches a field of parsed media, e.g. series=Breaking Bad.
+// Operators are "=" and "!=" for equality, ignoring case and punctuation,
+// and "~=" for a case-insensitive regular expression match.
+type Selector struct {
+	field string
+	op    string
+	value string
+	expr  *regexp.Regexp
+}
+
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	i := strings.IndexAny(s, "=~!")
+	if i <= 0 {
+		return sel, fmt.Errorf("invalid selector %q, expected <field>=<value>, <field>!=<value> or <field>~=<regexp>", s)
+	}
+	sel.field = strings.ToLower(strings.TrimSpace(s[:i]))
+	rest := s[i:]
+	for _, op := range []string{"~=", "!=", "="} {
+		if strings.HasPrefix(rest, op) {
+			sel.op = op
+			sel.value = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if sel.op == "" {
+		return sel, fmt.Errorf("invalid operator in selector %q", s)
+	}
+	if !selectorFields[sel.field] {
+		return sel, fmt.Errorf("unknown field %q in selector %q", sel.field, s)
+	}
+	if sel.op == "~=" {
+		expr, err := regexp.Compile("(?i)" + sel.value)
+		if err != nil {
+			return sel, fmt.Errorf("invalid expression in selector %q: %w", s, err)
+		}
+		sel.expr = expr
+	}
+	return sel, nil
+}
+
+func (s Selector) match(l Linkable) bool {
+	v, ok := selectorValue(l, s.field)
+	switch s.op {
+	case "~=":
+		return ok && s.expr.MatchString(v)
+	case "!=":
+		return !ok || folderKey(v) != folderKey(s.value)
+	default:
+		return ok && folderKey(v) == folderKey(s.value)
+	}
+}
+
+// selectorValue returns the value of field for l, or false when l has no
+// such field, e.g. the series of a movie.
+func selectorValue(l Linkable, field string) (string, bool) {
+	if q, ok := qualityOf(l); ok {
+		switch field {
+		case "resolution":
+			return q.resolution, q.resolution != ""
+		case "source":
+			return q.source, q.source != ""
+		case "codec":
+			return q.codec, q.codec != ""
+		case "group":
+			return q.group, q.group != ""
+		}
+	}
+	switch info := mediaInfoOf(l); field {
+	case "vcodec":
+		return info.VideoCodec, info.VideoCodec != ""
+	case "acodec":
+		return info.AudioCodec, info.AudioCodec != ""
+	case "height":
+		return strconv.Itoa(info.Height), info.Height != 0
+	}
+	switch v := l.(type) {
+	case *episode:
+		switch field {
+		case "type":
+			return "episode", true
+		case "series":
+			return v.series, true
+		case "title":
+			return v.title, true
+		case "year":
+			return strconv.Itoa(v.year), v.year != 0
+		case "season":
+			return strconv.Itoa(v.season), true
+		case "episode":
+			return strconv.Itoa(v.episode), true
+		}
+	case *movie:
+		switch field {
+		case "type":
+			return "movie", true
+		case "title":
+			return v.title, true
+		case "year":
+			return strconv.Itoa(v.year), v.YearValid()
+		}
+	}
+	return "", false
+}
+
+// selectorFilter excludes media not matching its selectors. Selectors on
+// the same field are alternatives, so that several shows can be selected,
+// while selectors on different fields, and negated selectors, must all
+// match.
+type selectorFilter struct {
+	fields map[string][]Selector
+}
+
+func (f selectorFilter) exclude(l Linkable) bool {
+	for _, selectors := range f.fields {
+		matched, alternatives := false, false
+		for _, s := range selectors {
+			if s.op == "!=" {
+				if !s.match(l) {
+					return true
+				}
+				continue
+			}
+			alternatives = true
+			if s.match(l) {
+				matched = true
+			}
+		}
+		if alternatives && !matched {
+			return true
+		}
+	}
+	return false
+}
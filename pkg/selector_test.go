@@ -0,0 +1,120 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSelectorFilter(t *testing.T) {
+	bb := &episode{series: "Breaking Bad", title: "Pilot", season: 1, episode: 1, year: 2008, quality: quality{resolution: "1080p"}}
+	andor := &episode{series: "Andor", title: "Kassa", season: 1, episode: 1}
+	dune := &movie{title: "Dune Part Two", year: 2024, quality: quality{resolution: "2160p", source: "BluRay"}}
+
+	tt := []struct {
+		selectors []string
+		included  []Linkable
+		excluded  []Linkable
+	}{{
+		[]string{"series=breaking bad"},
+		[]Linkable{bb},
+		[]Linkable{andor, dune},
+	}, {
+		[]string{"title~=^dune"},
+		[]Linkable{dune},
+		[]Linkable{bb, andor},
+	}, {
+		[]string{"series=Breaking Bad", "series=Andor"},
+		[]Linkable{bb, andor},
+		[]Linkable{dune},
+	}, {
+		[]string{"type=episode", "year=2008"},
+		[]Linkable{bb},
+		[]Linkable{andor, dune},
+	}, {
+		[]string{"resolution=2160p"},
+		[]Linkable{dune},
+		[]Linkable{bb, andor},
+	}, {
+		[]string{"source!=bluray"},
+		[]Linkable{bb, andor},
+		[]Linkable{dune},
+	}, {
+		[]string{"series=breaking.bad"},
+		[]Linkable{bb},
+		[]Linkable{andor, dune},
+	}, {
+		[]string{"series!=Andor", "series!=Breaking Bad"},
+		[]Linkable{dune},
+		[]Linkable{bb, andor},
+	}}
+
+	for _, c := range tt {
+		selectors := []Selector{}
+		for _, s := range c.selectors {
+			sel, err := ParseSelector(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			selectors = append(selectors, sel)
+		}
+		o := &Options{}
+		WithOnly(selectors)(o)
+		f := o.only
+		for _, l := range c.included {
+			if f.exclude(l) {
+				t.Errorf("selectors %v excluded %v", c.selectors, l)
+			}
+		}
+		for _, l := range c.excluded {
+			if !f.exclude(l) {
+				t.Errorf("selectors %v included %v", c.selectors, l)
+			}
+		}
+	}
+
+	for _, s := range []string{"series", "=Andor", "name=Andor", "title~=("} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestOnlySkipsLookup(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	var requests []string
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("query"))
+		fmt.Fprint(w, `{"results":[]}`)
+	}))
+	sel, err := ParseSelector("series=Andor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	WithOnly([]Selector{sel})(options)
+
+	media := []Linkable{
+		&episode{series: "Andor", title: "Kassa", id: "S01E01", season: 1, episode: 1, path: "Andor.S01E01.mkv"},
+		&episode{series: "Breaking Bad", id: "S01E01", season: 1, episode: 1, path: "Breaking.Bad.S01E01.mkv"},
+		&movie{title: "Dune", year: 2021, path: "Dune.2021.mkv"},
+	}
+	var linked []string
+	for _, m := range media {
+		if ln, ok := linkFromMedia(context.Background(), m); ok {
+			linked = append(linked, ln.Src)
+		}
+	}
+	if diff := cmp.Diff([]string{"Andor.S01E01.mkv"}, linked); diff != "" {
+		t.Errorf("linkFromMedia() mismatch (-want +got):\n%s", diff)
+	}
+	for _, q := range requests {
+		if q != "" && q != "Andor" {
+			t.Errorf("media that isn't selected was looked up as %q", q)
+		}
+	}
+}
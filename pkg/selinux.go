@@ -0,0 +1,79 @@
+package kourai
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RestoreconContext is a special SELinux context that relabels created
+// files with restorecon, using the policy's default context for their path,
+// instead of setting a fixed context.
+const RestoreconContext = "restorecon"
+
+// selinuxUnreadableTypes are SELinux types that media servers confined by
+// a policy are generally not allowed to read.
+var selinuxUnreadableTypes = map[string]bool{
+	"default_t":   true,
+	"unlabeled_t": true,
+	"user_home_t": true,
+	"user_tmp_t":  true,
+	"tmp_t":       true,
+}
+
+// selinuxEnforceFile reports whether SELinux is enforcing
+var selinuxEnforceFile = "/sys/fs/selinux/enforce"
+
+func selinuxEnforcing() bool {
+	b, err := os.ReadFile(selinuxEnforceFile)
+	return err == nil && strings.TrimSpace(string(b)) == "1"
+}
+
+// setSELinuxContext labels path with context, or with the default context
+// of the loaded policy when context is RestoreconContext.
+func setSELinuxContext(path, context string) error {
+	if context == RestoreconContext {
+		out, err := exec.Command("restorecon", path).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("restorecon %s failed with error %w: %s", path, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return setSELinuxXattr(path, context)
+}
+
+// SELinuxWarning returns a description of the problem when SELinux is
+// enforcing and the destination, or its closest existing parent, is
+// labeled with a type that media servers typically can't read. Files
+// created there inherit that type unless a context is set explicitly.
+func SELinuxWarning(dest string) string {
+	if !selinuxEnforcing() {
+		return ""
+	}
+	dir := filepath.Clean(dest)
+	for {
+		if _, err := os.Stat(dir); err == nil || dir == filepath.Dir(dir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	ctx, err := selinuxContext(dir)
+	if err != nil {
+		return fmt.Sprintf("SELinux is enforcing, but the context of %s could not be read: %v", dir, err)
+	}
+	if !selinuxUnreadable(ctx) {
+		return ""
+	}
+	return fmt.Sprintf("SELinux is enforcing and %s is labeled %s; media servers will likely be unable to read created files. "+
+		"Set a context, or use %q to relabel them", dir, ctx, RestoreconContext)
+}
+
+// selinuxUnreadable reports whether files labeled with ctx are generally
+// unreadable for confined media servers
+func selinuxUnreadable(ctx string) bool {
+	// user:role:type:level
+	parts := strings.Split(ctx, ":")
+	return len(parts) >= 3 && selinuxUnreadableTypes[parts[2]]
+}
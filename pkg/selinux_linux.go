@@ -0,0 +1,21 @@
+package kourai
+
+import (
+	"strings"
+	"syscall"
+)
+
+const selinuxXattr = "security.selinux"
+
+func selinuxContext(path string) (string, error) {
+	buf := make([]byte, 256)
+	n, err := syscall.Getxattr(path, selinuxXattr, buf)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf[:n]), "\x00"), nil
+}
+
+func setSELinuxXattr(path, context string) error {
+	return syscall.Setxattr(path, selinuxXattr, []byte(context+"\x00"), 0)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package kourai
+
+import "errors"
+
+var errSELinuxUnsupported = errors.New("SELinux is only supported on Linux")
+
+func selinuxContext(path string) (string, error) {
+	return "", errSELinuxUnsupported
+}
+
+func setSELinuxXattr(path, context string) error {
+	return errSELinuxUnsupported
+}
@@ -0,0 +1,69 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSELinuxUnreadable(t *testing.T) {
+	tests := map[string]bool{
+		"unconfined_u:object_r:user_home_t:s0":     true,
+		"system_u:object_r:default_t:s0":           true,
+		"system_u:object_r:container_file_t:s0":    false,
+		"system_u:object_r:public_content_rw_t:s0": false,
+		"garbage": false,
+		"":        false,
+	}
+	for ctx, want := range tests {
+		if got := selinuxUnreadable(ctx); got != want {
+			t.Errorf("selinuxUnreadable(%q) = %v, want %v", ctx, got, want)
+		}
+	}
+}
+
+func TestSELinuxWarning(t *testing.T) {
+	defer func(f string) { selinuxEnforceFile = f }(selinuxEnforceFile)
+	root := t.TempDir()
+	selinuxEnforceFile = filepath.Join(root, "enforce")
+	dest := filepath.Join(root, "library", "not", "created")
+
+	tests := []struct {
+		enforce string
+		want    string
+	}{
+		{"", ""},
+		{"0\n", ""},
+	}
+	for _, tt := range tests {
+		if tt.enforce != "" {
+			os.WriteFile(selinuxEnforceFile, []byte(tt.enforce), 0644)
+		}
+		if got := SELinuxWarning(dest); got != tt.want {
+			t.Errorf("SELinuxWarning() with enforce %q = %q, want %q", tt.enforce, got, tt.want)
+		}
+	}
+
+	// Enforcing, the closest existing parent is checked
+	os.WriteFile(selinuxEnforceFile, []byte("1\n"), 0644)
+	if _, err := selinuxContext(root); err == nil {
+		t.Skip("the test directory is labeled; SELinux is active on this host")
+	}
+	got := SELinuxWarning(dest)
+	if !strings.Contains(got, "could not be read") || !strings.Contains(got, root) {
+		t.Errorf("SELinuxWarning() of an unlabeled destination = %q", got)
+	}
+}
+
+func TestSetSELinuxContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(path, nil, 0644)
+	want := "system_u:object_r:container_file_t:s0"
+	if err := setSELinuxContext(path, want); err != nil {
+		t.Skip("security extended attributes can't be set here:", err)
+	}
+	if got, err := selinuxContext(path); err != nil || got != want {
+		t.Errorf("selinuxContext() = %q, %v, want %q", got, err, want)
+	}
+}
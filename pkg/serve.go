@@ -0,0 +1,176 @@
+package kourai
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HookLink is a link created, or failed, for the path of a hook request
+type HookLink struct {
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HookResponse is the response to a hook request
+type HookResponse struct {
+	Path  string     `json:"path"`
+	Links []HookLink `json:"links"`
+	Error string     `json:"error,omitempty"`
+}
+
+// HookHandler returns the handler of completion hooks of download clients,
+// which POST the path of a finished download, file or folder, as the path
+// form or query value, the dir and name values of clients that pass them
+// apart, or a JSON body of the form {"path": "..."}. The media at the path
+// are linked as LinkFromFiles would, create being called for each link,
+// and the targets created are returned as a HookResponse.
+//
+// Paths must be below one of the sources. When token isn't empty, requests
+// must carry it as a bearer token or the token value. The options are set
+// and validated once, as requests are served concurrently.
+func HookHandler(token string, create func(Link) error, optionConfig ...Option) (http.Handler, error) {
+	options.SetOptions(optionConfig...)
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+	if err := options.openState(); err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := func(status int, res HookResponse) {
+			if res.Links == nil {
+				res.Links = []HookLink{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(res)
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			reply(http.StatusMethodNotAllowed, HookResponse{Error: "only POST is allowed"})
+			return
+		}
+		if token != "" && !hookAuthorized(r, token) {
+			reply(http.StatusUnauthorized, HookResponse{Error: "missing or wrong token"})
+			return
+		}
+		path, err := hookPath(r)
+		if err != nil {
+			reply(http.StatusBadRequest, HookResponse{Error: err.Error()})
+			return
+		}
+		res := HookResponse{Path: path}
+		if !inSources(path) {
+			res.Error = "path is not below a source directory"
+			reply(http.StatusForbidden, res)
+			return
+		}
+
+		links, err := linkPath(r.Context(), path)
+		if errors.Is(err, fs.ErrNotExist) {
+			res.Error = err.Error()
+			reply(http.StatusNotFound, res)
+			return
+		} else if err != nil {
+			res.Error = err.Error()
+			reply(http.StatusInternalServerError, res)
+			return
+		}
+		status := http.StatusOK
+		for _, l := range links {
+			hl := HookLink{Source: l.Src, Target: l.Target}
+			if err := create(l); err != nil {
+				hl.Target, hl.Error = "", err.Error()
+				status = http.StatusInternalServerError
+			}
+			res.Links = append(res.Links, hl)
+		}
+		options.logger.Info("hook request served", "path", path, "links", len(links), "status", status)
+		reply(status, res)
+	}), nil
+}
+
+// hookAuthorized reports whether r carries token
+func hookAuthorized(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		got = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// hookPath returns the absolute path requested by r
+func hookPath(r *http.Request) (string, error) {
+	var path string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Path string `json:"path"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return "", fmt.Errorf("failed to parse request body with error %w", err)
+		}
+		path = body.Path
+	} else if path = r.FormValue("path"); path == "" && r.FormValue("name") != "" {
+		path = filepath.Join(r.FormValue("dir"), r.FormValue("name"))
+	}
+	if path == "" {
+		return "", errors.New("no path in request")
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %s is not absolute", path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// inSources reports whether path is one of the sources or below them
+func inSources(path string) bool {
+	for _, src := range options.sources {
+		if rel, err := filepath.Rel(absPath(src), path); err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkPath finds the media at path, a file or a folder, and returns their
+// links, one per target
+func linkPath(ctx context.Context, path string) ([]Link, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var media []Linkable
+	if info.IsDir() {
+		mediac, errc := findFiles(ctx, path, options.fileFilters...)
+		for m := range mediac {
+			media = append(media, m)
+		}
+		if err := <-errc; err != nil {
+			return nil, err
+		}
+	} else if m, ok := mediaFromFile(ctx, path, info, options.fileFilters); ok {
+		media = append(media, m)
+	}
+
+	links := []Link{}
+	for _, m := range media {
+		if ln, ok := linkFromMedia(ctx, m); ok {
+			links = append(links, withSidecars(ln)...)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	links, _ = DedupeLinks(links)
+	return links, nil
+}
@@ -0,0 +1,102 @@
+package kourai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHookHandler(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	os.Mkdir(filepath.Join(src, "Alien.1979"), 0755)
+	for _, f := range []string{"Heat.1995.mkv", "Alien.1979/Alien.1979.mkv", "Alien.1979/Alien.1979.nfo"} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	created := []string{}
+	h, err := HookHandler("secret", func(l Link) error {
+		created = append(created, l.Target)
+		return l.Create()
+	}, WithSources([]string{src}), WithDestination(dest), WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	post := func(query url.Values, contentType, body string) (int, HookResponse) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", srv.URL+"?"+query.Encode(), strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var hr HookResponse
+		if err := json.NewDecoder(res.Body).Decode(&hr); err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, hr
+	}
+
+	status, res := post(url.Values{"path": {filepath.Join(src, "Heat.1995.mkv")}}, "", "")
+	want := []HookLink{{Source: filepath.Join(src, "Heat.1995.mkv"), Target: filepath.Join(dest, "movies", "Heat (1995)", "Heat.1995.mkv")}}
+	if diff := cmp.Diff(want, res.Links); status != http.StatusOK || diff != "" {
+		t.Errorf("hook of a file = %d, mismatch (-want +got):\n%s", status, diff)
+	}
+
+	body, _ := json.Marshal(map[string]string{"path": filepath.Join(src, "Alien.1979")})
+	status, res = post(nil, "application/json", string(body))
+	want = []HookLink{{Source: filepath.Join(src, "Alien.1979", "Alien.1979.mkv"), Target: filepath.Join(dest, "movies", "Alien (1979)", "Alien.1979.mkv")}}
+	if diff := cmp.Diff(want, res.Links); status != http.StatusOK || diff != "" {
+		t.Errorf("hook of a folder = %d, mismatch (-want +got):\n%s", status, diff)
+	}
+	if len(created) != 2 {
+		t.Errorf("created %v, want the 2 targets", created)
+	}
+
+	// Linking a path again fails, as its target exists
+	status, res = post(url.Values{"dir": {src}, "name": {"Heat.1995.mkv"}}, "", "")
+	if status != http.StatusInternalServerError || len(res.Links) != 1 || res.Links[0].Error == "" {
+		t.Errorf("hook of a linked file = %d %+v, want a failed link", status, res)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		status int
+	}{
+		{"", http.StatusBadRequest},
+		{"Heat.1995.mkv", http.StatusBadRequest},
+		{filepath.Join(src, "Dune.2021.mkv"), http.StatusNotFound},
+		{filepath.Join(dest, "movies"), http.StatusForbidden},
+		{filepath.Join(src, "..", filepath.Base(dest)), http.StatusForbidden},
+	} {
+		if status, _ := post(url.Values{"path": {tt.path}}, "", ""); status != tt.status {
+			t.Errorf("hook of %q = %d, want %d", tt.path, status, tt.status)
+		}
+	}
+
+	res2, err := http.Post(srv.URL+"?path="+url.QueryEscape(filepath.Join(src, "Heat.1995.mkv")), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2.Body.Close()
+	if res2.StatusCode != http.StatusUnauthorized {
+		t.Errorf("hook without token = %d, want %d", res2.StatusCode, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,41 @@
+package kourai
+
+import (
+	"context"
+	"io/fs"
+	"time"
+)
+
+// WithSettleTime only links files whose size and modification time are
+// unchanged for d, so that files still being unpacked or transferred by
+// another process aren't linked. Files modified less than d ago are waited
+// for; older files are checked once more without waiting. Zero disables
+// the check.
+func WithSettleTime(d time.Duration) Option {
+	return func(o *Options) {
+		o.settle = d
+	}
+}
+
+// settled reports whether the file at path, found as info, is unchanged
+// after options.settle passed since it was last modified. It returns
+// false when ctx is done first.
+func settled(ctx context.Context, path string, info fs.FileInfo) bool {
+	wait := info.ModTime().Add(options.settle).Sub(options.clock.Now())
+	if wait > options.settle {
+		// Modification times in the future are waited for once
+		wait = options.settle
+	}
+	if wait > 0 {
+		select {
+		case <-options.clock.After(wait):
+		case <-ctx.Done():
+			return false
+		}
+	}
+	now, err := options.fs.Stat(path)
+	if err != nil {
+		return false
+	}
+	return now.Size() == info.Size() && now.ModTime().Equal(info.ModTime())
+}
@@ -0,0 +1,48 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSettleTime(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	WithSettleTime(300 * time.Millisecond)(options)
+
+	root := t.TempDir()
+	old := filepath.Join(root, "Heat.1995.mkv")
+	growing := filepath.Join(root, "Alien.1979.mkv")
+	for _, p := range []string{old, growing} {
+		if err := os.WriteFile(p, []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, hourAgo, hourAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	// The growing file is written to while it settles
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		f, err := os.OpenFile(growing, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		f.WriteString("more video")
+		f.Close()
+	}()
+
+	var got []string
+	media, _ := findFiles(context.Background(), root)
+	for m := range media {
+		got = append(got, filepath.Base(m.Path()))
+	}
+	if len(got) != 1 || got[0] != "Heat.1995.mkv" {
+		t.Errorf("findFiles() = %v, want only the settled Heat.1995.mkv", got)
+	}
+}
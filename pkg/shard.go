@@ -0,0 +1,115 @@
+package kourai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Shard folders of names starting with a digit, or with neither a letter
+// nor a digit
+const (
+	digitShard = "0-9"
+	otherShard = "#"
+)
+
+// shardArticleExpr matches the leading articles media servers ignore when
+// sorting titles
+var shardArticleExpr = regexp.MustCompile(`(?i)^(?:the|an?)\s+`)
+
+// WithShardedLayout files movie and series folders under a folder of the
+// first letter of their name in the default layouts, e.g. movies/A/Alien
+// (1979) and tv/T/The Office (2005), for filesystems and media servers
+// that slow down with tens of thousands of entries in one directory.
+// Movies of collection folders are filed under the letter of the
+// collection. Templates get the same folders with {{shard .Title}}.
+func WithShardedLayout(enabled bool) Option {
+	return func(o *Options) {
+		o.sharded = enabled
+	}
+}
+
+// shard returns the folder name is filed under in sharded layouts: the
+// first letter of name, ignoring leading articles and accents, in upper
+// case, digitShard for names starting with a digit, or otherShard.
+func shard(name string) string {
+	name = strings.TrimSpace(name)
+	if rest := shardArticleExpr.ReplaceAllString(name, ""); rest != "" {
+		name = rest
+	}
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.IsLetter(r):
+			return string(unicode.ToUpper(r))
+		case unicode.IsDigit(r):
+			return digitShard
+		case !unicode.IsPunct(r) && !unicode.IsSpace(r):
+			return otherShard
+		}
+		// Skip leading quotes, dots and the like, e.g. ...And Justice
+	}
+	return otherShard
+}
+
+// shardDir prefixes dir, the folder of a movie or series, with its shard
+// folder in sharded layouts
+func shardDir(dir string) string {
+	if !options.sharded {
+		return dir
+	}
+	return shard(dir) + "/" + dir
+}
+
+// isShard reports whether name is the name of a shard folder
+func isShard(name string) bool {
+	return name == digitShard || name == otherShard || name == shard(name) && name != ""
+}
+
+// mediaFolders returns the movie or series folders below root, the movies
+// or tv folder of a destination, looking into shard folders in sharded
+// layouts, along with the entries filed where the layout doesn't put them.
+// kind names the folders in issues, e.g. "movie".
+func mediaFolders(root, kind string) ([]string, []FsckIssue) {
+	var dirs []string
+	issues := []FsckIssue{}
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		p := filepath.Join(root, e.Name())
+		switch {
+		case !e.IsDir():
+			issues = append(issues, FsckIssue{Path: p, Problem: fmt.Sprintf("file outside of a %s folder", kind)})
+		case !options.sharded:
+			dirs = append(dirs, p)
+		case !isShard(e.Name()):
+			issues = append(issues, FsckIssue{
+				Path:    p,
+				Problem: fmt.Sprintf("%s folder outside of the shard folders", kind),
+				Fix:     &Link{Src: p, Target: filepath.Join(root, shard(e.Name()), e.Name())},
+			})
+		default:
+			folders, _ := os.ReadDir(p)
+			for _, f := range folders {
+				fp := filepath.Join(p, f.Name())
+				if !f.IsDir() {
+					issues = append(issues, FsckIssue{Path: fp, Problem: fmt.Sprintf("file outside of a %s folder", kind)})
+					continue
+				}
+				if want := shard(f.Name()); want != e.Name() {
+					issues = append(issues, FsckIssue{
+						Path:    fp,
+						Problem: fmt.Sprintf("%s folder should be filed under %q", kind, want),
+						Fix:     &Link{Src: fp, Target: filepath.Join(root, want, f.Name())},
+					})
+					continue
+				}
+				dirs = append(dirs, fp)
+			}
+		}
+	}
+	return dirs, issues
+}
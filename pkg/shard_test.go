@@ -0,0 +1,120 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestShard(t *testing.T) {
+	for name, want := range map[string]string{
+		"Alien (1979)":           "A",
+		"alien":                  "A",
+		"The Office (2005)":      "O",
+		"A Quiet Place (2018)":   "Q",
+		"An American Werewolf":   "A",
+		"The":                    "T",
+		"Élite (2018)":           "E",
+		"...And Justice for All": "A",
+		"'Allo 'Allo! (1982)":    "A",
+		"2001 A Space Odyssey":   "0-9",
+		"Ōkami":                  "O",
+		"千と千尋の神隠し":               "千",
+		"$#*! My Dad Says":       "#",
+		"":                       "#",
+	} {
+		if got := shard(name); got != want {
+			t.Errorf("shard(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestShardedLayout(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	options.SetOptions(WithShardedLayout(true))
+
+	for _, tc := range []struct {
+		l    Linkable
+		want string
+	}{
+		{&movie{title: "Alien", year: 1979, path: "/dl/Alien.1979.mkv"}, "movies/A/Alien (1979)/Alien.1979.mkv"},
+		{&movie{title: "Goldfinger", year: 1964, collection: "James Bond Collection", path: "/dl/Goldfinger.1964.mkv"}, "movies/J/James Bond Collection/Goldfinger (1964)/Goldfinger.1964.mkv"},
+		{&episode{series: "The Office", year: 2005, title: "Pilot", id: "s01e01", season: 1, episode: 1, path: "/dl/the.office.s01e01.mkv"}, "tv/O/The Office (2005)/Season 1/The Office (2005) - S01E01 - Pilot.mkv"},
+	} {
+		if got := tc.l.Target(); got != tc.want {
+			t.Errorf("Target() = %q, want %q", got, tc.want)
+		}
+	}
+
+	tmpl, err := ParseTargetTemplate("TV/{{shard .Series}}/{{.Series}}/{{.EpisodeID}}{{.Ext}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.SetOptions(WithTargetTemplates(nil, tmpl))
+	e := &episode{series: "The Office", id: "s01e01", season: 1, episode: 1, path: "/dl/the.office.s01e01.mkv"}
+	if got, want := e.Target(), "TV/O/The Office/S01E01.mkv"; got != want {
+		t.Errorf("template Target() = %q, want %q", got, want)
+	}
+}
+
+func TestFsckSharded(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	dest := t.TempDir()
+	for _, f := range []string{
+		"movies/A/Alien (1979)/Alien.1979.mkv",
+		"movies/B/Dune (2021)/Dune.2021.mkv",
+		"movies/Heat (1995)/Heat.1995.mkv",
+		"movies/H/stray.mkv",
+		"tv/O/The Office (2005)/Season 1/The Office (2005) - S01E01 - Pilot.mkv",
+		"tv/T/The Wire (2002)/Season 1/The Wire (2002) - S01E01 - The Target.mkv",
+	} {
+		p := filepath.Join(dest, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issues, err := Fsck(dest, WithFileExtensions([]string{"mkv"}), WithShardedLayout(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, i := range issues {
+		rel, _ := filepath.Rel(dest, i.Path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{
+		"movies/B/Dune (2021)",
+		"movies/H/stray.mkv",
+		"movies/Heat (1995)",
+		"tv/T/The Wire (2002)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Fsck() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, i := range issues {
+		if i.Fix != nil {
+			if err := i.Apply(); err != nil {
+				t.Errorf("failed to fix %v: %v", i, err)
+			}
+		}
+	}
+	for _, f := range []string{
+		"movies/D/Dune (2021)/Dune.2021.mkv",
+		"movies/H/Heat (1995)/Heat.1995.mkv",
+		"tv/W/The Wire (2002)/Season 1/The Wire (2002) - S01E01 - The Target.mkv",
+	} {
+		if _, err := os.Stat(filepath.Join(dest, f)); err != nil {
+			t.Errorf("%s was not fixed", f)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateBucket is the bucket of the store the state of sources is kept in
+const stateBucket = "sources"
+
+// StateLinked is the result of sources whose target was created
+const StateLinked = "linked"
+
+// SourceState records a processed source file as it was when it was
+// processed, so that it's recognized while it's unchanged.
+type SourceState struct {
+	Path    string    `json:"path"`
+	Dev     uint64    `json:"dev"`
+	Inode   uint64    `json:"inode"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// Result is what became of the source, e.g. StateLinked
+	Result string    `json:"result"`
+	Target string    `json:"target,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// StateDB keeps the state of processed sources, by their absolute path, in
+// a SQLite database, so that repeat runs skip the sources they already
+// handled without parsing or looking them up again.
+type StateDB struct {
+	path  string
+	store Store
+}
+
+// OpenStateDB opens the state database at path, creating it when missing.
+func OpenStateDB(path string) (*StateDB, error) {
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return &StateDB{path: path, store: store}, nil
+}
+
+// WithStateDB records the sources linked in the state database at path,
+// and skips the sources it holds while they're unchanged and their target
+// still exists. An empty path disables it. The database is opened by
+// LinkFromFiles, which fails when it can't be.
+func WithStateDB(path string) Option {
+	return func(o *Options) {
+		o.statePath = path
+	}
+}
+
+// openState opens the state database of o, unless it's already open, and
+// loads the ignores of the run
+func (o *Options) openState() error {
+	if o.statePath == "" {
+		o.state = nil
+	} else if o.state == nil || o.state.path != o.statePath {
+		db, err := OpenStateDB(o.statePath)
+		if err != nil {
+			return fmt.Errorf("failed to open state database %s with error %w", o.statePath, err)
+		}
+		if o.state != nil {
+			o.state.Close()
+		}
+		o.state = db
+	}
+	return o.loadIgnores()
+}
+
+// Get returns the state recorded for the source at path.
+func (db *StateDB) Get(path string) (SourceState, error) {
+	var s SourceState
+	b, _, err := db.store.Get(context.Background(), stateBucket, absPath(path))
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+// Record replaces the state of the source s.Path.
+func (db *StateDB) Record(s SourceState) error {
+	s.Path = absPath(s.Path)
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.store.Put(context.Background(), stateBucket, s.Path, b)
+}
+
+// recordLink records the source of ln, as it was before its target was
+// created from it, as linked
+func (db *StateDB) recordLink(ln Link, info fs.FileInfo) error {
+	dev, ino, _, err := fileIdentity(ln.Src, info)
+	if err != nil {
+		return err
+	}
+	return db.Record(SourceState{
+		Path:    ln.Src,
+		Dev:     dev,
+		Inode:   ino,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UTC(),
+		Result:  StateLinked,
+		Target:  absPath(ln.Target),
+		Time:    time.Now().UTC(),
+	})
+}
+
+// processed returns the target of the source at path, with info, when it
+// was linked unchanged and the target still exists. A nil db holds
+// nothing.
+func (db *StateDB) processed(path string, info fs.FileInfo) (string, bool) {
+	if db == nil {
+		return "", false
+	}
+	s, err := db.Get(path)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			options.logger.Warn("failed to read the state of a source", "path", path, "error", err)
+		}
+		return "", false
+	}
+	dev, ino, _, err := fileIdentity(path, info)
+	if err != nil || s.Result != StateLinked || s.Dev != dev || s.Inode != ino ||
+		s.Size != info.Size() || !s.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	if _, err := os.Lstat(s.Target); err != nil {
+		return "", false
+	}
+	return s.Target, true
+}
+
+func (db *StateDB) Close() error {
+	return db.store.Close()
+}
+
+// relTarget is target relative to the destination of the run, when it's
+// below it, for messages
+func relTarget(target string) string {
+	if rel, err := filepath.Rel(absPath(options.dest), target); err == nil && filepath.IsLocal(rel) {
+		return rel
+	}
+	return target
+}
@@ -0,0 +1,82 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStateDB(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	for _, f := range []string{"Heat.1995.mkv", "Alien.1979.mkv"} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := filepath.Join(t.TempDir(), "state.db")
+	var mu sync.Mutex
+	var skipped []SkippedFile
+	run := func() []string {
+		t.Helper()
+		skipped = nil
+		links, errc := LinkFromFiles(context.Background(),
+			WithSources([]string{src}),
+			WithDestination(dest),
+			WithFileExtensions([]string{"mkv"}),
+			WithStateDB(state),
+			WithSkipReport(func(s SkippedFile) {
+				mu.Lock()
+				defer mu.Unlock()
+				skipped = append(skipped, s)
+			}),
+		)
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for l := range links {
+			if err := l.Create(); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, filepath.Base(l.Src))
+		}
+		return got
+	}
+	defer func() { options.state.Close() }()
+
+	if got := run(); len(got) != 2 {
+		t.Fatalf("first run linked %v, want both sources", got)
+	}
+	if got := run(); len(got) != 0 {
+		t.Errorf("second run linked %v, want nothing", got)
+	}
+	if len(skipped) != 2 || skipped[0].Code != SkipProcessed {
+		t.Errorf("second run skipped %v, want both sources as processed", skipped)
+	}
+
+	// Removed targets are linked again
+	os.Remove(filepath.Join(dest, "movies/Alien (1979)/Alien.1979.mkv"))
+	if got := run(); len(got) != 1 || got[0] != "Alien.1979.mkv" {
+		t.Errorf("third run linked %v, want only Alien.1979.mkv", got)
+	}
+
+	// Changed sources aren't processed any more
+	heat := filepath.Join(src, "Heat.1995.mkv")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(heat, later, later); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(heat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := options.state.processed(heat, info); ok {
+		t.Errorf("processed(%s) after it changed = true, want false", heat)
+	}
+}
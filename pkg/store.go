@@ -0,0 +1,267 @@
+package kourai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for keys it doesn't hold.
+var ErrNotFound = errors.New("not found")
+
+// Store keeps state and cached data as values grouped in buckets. Backends
+// that several machines can reach, e.g. Postgres, Redis or a directory on a
+// shared volume, let them share state.
+type Store interface {
+	// Get returns the value of key and when it was last written.
+	Get(ctx context.Context, bucket, key string) ([]byte, time.Time, error)
+	Put(ctx context.Context, bucket, key string, value []byte) error
+	Delete(ctx context.Context, bucket, key string) error
+	// List returns the values of every key in bucket.
+	List(ctx context.Context, bucket string) ([][]byte, error)
+	Close() error
+}
+
+// DefaultStorePath returns the location of the SQLite store in the user's
+// cache directory.
+func DefaultStorePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kourai", "state.db"), nil
+}
+
+// OpenStore opens the store described by uri:
+//
+//	memory                  values kept for the lifetime of the process
+//	sqlite:<path>           a SQLite database at path
+//	postgres://<host>/<db>  a Postgres database, shared between machines
+//	redis://<host>/<db>     a Redis server, shared between machines
+//	dir:<path>              one file per value below path
+//	<path>                  same as dir:<path>
+func OpenStore(uri string) (Store, error) {
+	scheme, rest, found := strings.Cut(uri, ":")
+	switch {
+	case uri == "memory":
+	case !found || len(scheme) == 1: // a path, or a Windows drive letter
+		scheme, rest = "dir", uri
+	}
+	switch scheme {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "dir":
+		rest = strings.TrimPrefix(rest, "//")
+		if rest == "" {
+			return nil, errors.New("a directory is required for a dir store")
+		}
+		return NewDirStore(rest)
+	case "sqlite":
+		rest = strings.TrimPrefix(rest, "//")
+		if rest == "" {
+			return nil, errors.New("a database path is required for a sqlite store")
+		}
+		return OpenSQLiteStore(rest)
+	case "postgres", "postgresql":
+		return OpenPostgresStore(uri)
+	case "redis", "rediss":
+		return OpenRedisStore(uri)
+	}
+	return nil, fmt.Errorf("unknown store %q", uri)
+}
+
+type memoryValue struct {
+	value []byte
+	time  time.Time
+}
+
+// MemoryStore is a Store that isn't persisted.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]memoryValue
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: map[string]memoryValue{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, bucket, key string) ([]byte, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[bucket+"\x00"+key]
+	if !ok {
+		return nil, time.Time{}, ErrNotFound
+	}
+	return v.value, v.time, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[bucket+"\x00"+key] = memoryValue{value: append([]byte{}, value...), time: time.Now()}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, bucket+"\x00"+key)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, bucket string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for k := range s.values {
+		if strings.HasPrefix(k, bucket+"\x00") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, s.values[k].value)
+	}
+	return values, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// DirStore is a Store keeping each value in its own file, named after a
+// hash of its key, in a directory per bucket. Values are replaced with a
+// rename, so writers on several machines sharing the directory never see
+// partial values.
+type DirStore struct {
+	root string
+}
+
+func NewDirStore(root string) (*DirStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store %s with error %w", root, err)
+	}
+	return &DirStore{root: root}, nil
+}
+
+func (s *DirStore) path(bucket, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.root, bucket, hex.EncodeToString(sum[:]))
+}
+
+func (s *DirStore) Get(ctx context.Context, bucket, key string) ([]byte, time.Time, error) {
+	p := s.path(bucket, key)
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, ErrNotFound
+	} else if err != nil {
+		return nil, time.Time{}, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, ErrNotFound
+	}
+	return b, info.ModTime(), err
+}
+
+func (s *DirStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	p := s.path(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (s *DirStore) Delete(ctx context.Context, bucket, key string) error {
+	err := os.Remove(s.path(bucket, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *DirStore) List(ctx context.Context, bucket string) ([][]byte, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, bucket))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	values := [][]byte{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".tmp-") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.root, bucket, e.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue // deleted since the directory was read
+		} else if err != nil {
+			return nil, err
+		}
+		values = append(values, b)
+	}
+	return values, nil
+}
+
+func (s *DirStore) Close() error {
+	return nil
+}
+
+// redactURI hides the password of a store URI in messages.
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		scheme, _, _ := strings.Cut(uri, ":")
+		return scheme + ":"
+	}
+	return u.Redacted()
+}
+
+// storeCache adapts a Store to the TMDB and TVDB response caches, keeping
+// responses in bucket and expiring those older than ttl.
+type storeCache struct {
+	store  Store
+	bucket string
+	ttl    time.Duration
+}
+
+// Buckets of the response caches
+const (
+	tmdbCacheBucket = "tmdb"
+	tvdbCacheBucket = "tvdb"
+)
+
+func (c storeCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	b, t, err := c.store.Get(ctx, c.bucket, key)
+	if err != nil || (c.ttl > 0 && time.Since(t) > c.ttl) {
+		return nil, false
+	}
+	return b, true
+}
+
+func (c storeCache) Set(ctx context.Context, key string, value []byte) {
+	c.store.Put(ctx, c.bucket, key, value)
+}
@@ -0,0 +1,87 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a Store keeping each value in a Redis hash, along with the
+// time it was written, below the kourai: prefix.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// OpenRedisStore connects to the Redis server at uri, e.g.
+// redis://:password@host:6379/0.
+func OpenRedisStore(uri string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis store %s: %w", redactURI(uri), err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to open store %s with error %w", redactURI(uri), err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+func redisKey(bucket, key string) string {
+	return "kourai:" + bucket + ":" + key
+}
+
+func (s *RedisStore) Get(ctx context.Context, bucket, key string) ([]byte, time.Time, error) {
+	v, err := s.client.HMGet(ctx, redisKey(bucket, key), "value", "updated").Result()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	value, ok := v[0].(string)
+	if !ok {
+		return nil, time.Time{}, ErrNotFound
+	}
+	updated, _ := v[1].(string)
+	ns, _ := strconv.ParseInt(updated, 10, 64)
+	return []byte(value), time.Unix(0, ns), nil
+}
+
+func (s *RedisStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	return s.client.HSet(ctx, redisKey(bucket, key), "value", value, "updated", time.Now().UnixNano()).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, bucket, key string) error {
+	return s.client.Del(ctx, redisKey(bucket, key)).Err()
+}
+
+func (s *RedisStore) List(ctx context.Context, bucket string) ([][]byte, error) {
+	keys := []string{}
+	iter := s.client.Scan(ctx, 0, redisKey(bucket, "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	values := [][]byte{}
+	for _, k := range keys {
+		v, err := s.client.HGet(ctx, k, "value").Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue // deleted since the scan
+		} else if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,111 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	stores := map[string]Store{"memory": NewMemoryStore()}
+	uris := map[string]string{
+		"dir":    "dir:" + t.TempDir(),
+		"sqlite": "sqlite:" + filepath.Join(t.TempDir(), "state", "state.db"),
+		// Shared backends are only tested against a server given through
+		// the environment, e.g. postgres://localhost/kourai_test and
+		// redis://localhost/15. The tests write to the kourai buckets.
+		"postgres": os.Getenv("KOURAI_TEST_POSTGRES"),
+		"redis":    os.Getenv("KOURAI_TEST_REDIS"),
+	}
+	for name, uri := range uris {
+		if uri == "" {
+			continue
+		}
+		s, err := OpenStore(uri)
+		if err != nil {
+			t.Fatalf("OpenStore(%s) returned %v", name, err)
+		}
+		defer s.Close()
+		stores[name] = s
+	}
+
+	for name, s := range stores {
+		s.Delete(ctx, "b", "k")
+		s.Delete(ctx, "b", "k2")
+		if _, _, err := s.Get(ctx, "b", "k"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get() of a missing key returned %v, want ErrNotFound", name, err)
+		}
+		if err := s.Put(ctx, "b", "k", []byte("v1")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(ctx, "b", "k", []byte("v2")); err != nil {
+			t.Fatal(err)
+		}
+		if v, _, err := s.Get(ctx, "b", "k"); err != nil || string(v) != "v2" {
+			t.Errorf("%s: Get() = %q, %v; want \"v2\"", name, v, err)
+		}
+		if _, _, err := s.Get(ctx, "other", "k"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get() found a key of another bucket", name)
+		}
+		if err := s.Put(ctx, "b", "k2", []byte("v3")); err != nil {
+			t.Fatal(err)
+		}
+		values, err := s.List(ctx, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, v := range values {
+			got = append(got, string(v))
+		}
+		sort.Strings(got)
+		if diff := cmp.Diff([]string{"v2", "v3"}, got); diff != "" {
+			t.Errorf("%s: List() mismatch (-want +got):\n%s", name, diff)
+		}
+		if err := s.Delete(ctx, "b", "k2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete(ctx, "b", "k"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.Get(ctx, "b", "k"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get() after Delete() returned %v, want ErrNotFound", name, err)
+		}
+	}
+
+	// memory has no colon, but isn't the path of a dir store
+	if s, err := OpenStore("memory"); err != nil {
+		t.Errorf("OpenStore(memory) returned %v", err)
+	} else if _, ok := s.(*MemoryStore); !ok {
+		t.Errorf("OpenStore(memory) = %T, want *MemoryStore", s)
+	}
+	path := filepath.Join(t.TempDir(), "memory")
+	if s, err := OpenStore(path); err != nil {
+		t.Errorf("OpenStore(%s) returned %v", path, err)
+	} else if _, ok := s.(*MemoryStore); ok {
+		t.Errorf("OpenStore(%s) = %T, want a dir store", path, s)
+	}
+	if _, err := OpenStore("ftp://localhost"); err == nil {
+		t.Error("OpenStore() of an unknown backend returned no error")
+	}
+}
+
+func TestRedactURI(t *testing.T) {
+	tests := map[string]string{
+		"postgres://kourai:secret@db/kourai": "postgres://kourai:xxxxx@db/kourai",
+		"redis://:secret@cache:6379/0":       "redis://:xxxxx@cache:6379/0",
+		"redis://cache":                      "redis://cache",
+		"postgres://kourai:secret@[::1":      "postgres:",
+	}
+	for uri, want := range tests {
+		if got := redactURI(uri); got != want {
+			t.Errorf("redactURI(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
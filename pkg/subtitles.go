@@ -0,0 +1,71 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// subtitleExtensions are the extensions of the subtitles linked along their
+// videos, see WithSubtitles
+var subtitleExtensions = map[string]bool{
+	"ass": true, "idx": true, "srt": true, "ssa": true, "sub": true, "vtt": true,
+}
+
+// WithSubtitles also links the subtitles next to each video and named after
+// it, e.g. Heat.1995.en.srt or Heat.1995.forced.srt, to the name of its
+// target with the same language and other suffixes, e.g.
+// "Heat (1995).en.srt". Subtitles are sent as links of their own, right
+// after that of their video.
+func WithSubtitles(enabled bool) Option {
+	return func(o *Options) {
+		o.subtitles = enabled
+	}
+}
+
+// withSidecars returns ln followed by the links of the files accompanying
+// its source, its subtitles when enabled by WithSubtitles
+func withSidecars(ln Link) []Link {
+	links := []Link{ln}
+	if options.subtitles {
+		links = append(links, subtitleLinks(ln)...)
+	}
+	return links
+}
+
+// subtitleLinks returns the links of the subtitles next to the source of ln
+// whose names start with its name, without extension, ignoring case. Their
+// targets are the target of ln with the rest of their names, so that the
+// language suffixes media servers recognize are kept, in the case of
+// targets. Only the media of ln
+// is carried over, so that its artwork and NFO aren't written twice.
+func subtitleLinks(ln Link) []Link {
+	dir := filepath.Dir(ln.Src)
+	name := strings.TrimSuffix(filepath.Base(ln.Src), filepath.Ext(ln.Src))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		options.logger.Warn("failed to look for subtitles", "path", ln.Src, "error", err)
+		return nil
+	}
+	target := strings.TrimSuffix(ln.Target, filepath.Ext(ln.Target))
+	var links []Link
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !subtitleExtensions[fileExt(e.Name())] || len(e.Name()) <= len(name) {
+			continue
+		}
+		suffix := e.Name()[len(name):]
+		if !strings.EqualFold(e.Name()[:len(name)], name) || !strings.HasPrefix(suffix, ".") {
+			continue
+		}
+		links = append(links, Link{
+			Src:          filepath.Join(dir, e.Name()),
+			Target:       target + options.targetCase.apply(suffix),
+			Mode:         ln.Mode,
+			perms:        ln.perms,
+			tags:         ln.tags,
+			copyFallback: ln.copyFallback,
+			media:        ln.media,
+		})
+	}
+	return links
+}
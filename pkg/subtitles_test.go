@@ -0,0 +1,67 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSubtitles(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	for _, f := range []string{
+		"Heat.1995.mkv",
+		"Heat.1995.srt",
+		"heat.1995.en.forced.srt",
+		"Heat.1995.de.ass",
+		"Heat.1995.nfo",
+		"Heat.1995.Directors.Cut.mkv",
+		"Heat.1995s.srt",
+		"Alien.1979.srt",
+	} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	options.SetOptions(
+		WithSources([]string{src}),
+		WithDestination(dest),
+		WithFileExtensions([]string{"mkv"}),
+		WithSubtitles(true),
+	)
+	links, err := linkPath(context.Background(), filepath.Join(src, "Heat.1995.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, l := range links {
+		if err := l.Create(); err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(dest, l.Target)
+		got[filepath.Base(l.Src)] = filepath.ToSlash(rel)
+	}
+	want := map[string]string{
+		"Heat.1995.mkv":           "movies/Heat (1995)/Heat.1995.mkv",
+		"Heat.1995.srt":           "movies/Heat (1995)/Heat.1995.srt",
+		"heat.1995.en.forced.srt": "movies/Heat (1995)/Heat.1995.en.forced.srt",
+		"Heat.1995.de.ass":        "movies/Heat (1995)/Heat.1995.de.ass",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+
+	// Subtitles are only linked when enabled
+	options.SetOptions(WithSubtitles(false))
+	if links, err = linkPath(context.Background(), filepath.Join(src, "Heat.1995.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 {
+		t.Errorf("linkPath() without subtitles = %+v, want the video only", links)
+	}
+}
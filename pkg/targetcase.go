@@ -0,0 +1,51 @@
+package kourai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CasePolicy is the case of the paths of targets, see WithTargetCase
+type CasePolicy string
+
+const (
+	// CasePreserve keeps the case of titles and of the layout
+	CasePreserve CasePolicy = "preserve"
+	// CaseLower lower cases targets, e.g. for rclone crypt remotes
+	CaseLower CasePolicy = "lower"
+	// CaseUpper upper cases targets
+	CaseUpper CasePolicy = "upper"
+)
+
+// ParseCasePolicy parses a case policy: preserve, lower or upper. An empty
+// policy is CasePreserve.
+func ParseCasePolicy(s string) (CasePolicy, error) {
+	switch p := CasePolicy(strings.ToLower(s)); p {
+	case CasePreserve, CaseLower, CaseUpper:
+		return p, nil
+	case "":
+		return CasePreserve, nil
+	}
+	return "", fmt.Errorf("%w case policy %q, expected one of %s, %s or %s", ErrUnsupportedType, s, CasePreserve, CaseLower, CaseUpper)
+}
+
+// WithTargetCase changes the case of targets, rendered by the default layout
+// or the target templates, to that of p. Folders of the destination whose
+// names only differ in case from those of targets are linked into, rather
+// than created again next to them.
+func WithTargetCase(p CasePolicy) Option {
+	return func(o *Options) {
+		o.targetCase = p
+	}
+}
+
+// apply returns s in the case of p
+func (p CasePolicy) apply(s string) string {
+	switch p {
+	case CaseLower:
+		return strings.ToLower(s)
+	case CaseUpper:
+		return strings.ToUpper(s)
+	}
+	return s
+}
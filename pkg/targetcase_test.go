@@ -0,0 +1,87 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCasePolicy(t *testing.T) {
+	for s, want := range map[string]CasePolicy{"": CasePreserve, "lower": CaseLower, "UPPER": CaseUpper} {
+		if got, err := ParseCasePolicy(s); err != nil || got != want {
+			t.Errorf("ParseCasePolicy(%q) = %s, %v; want %s", s, got, err, want)
+		}
+	}
+	if _, err := ParseCasePolicy("title"); err == nil {
+		t.Error("ParseCasePolicy() of an unknown policy returned no error")
+	}
+}
+
+func TestTargetCase(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	movie, err := NewLinkable("/dl/Heat.1995.1080p.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	episode, err := NewLinkable("/dl/Breaking.Bad.S01E02.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTargetTemplate("TV/{{.Series}}/{{.SeasonFolder}}/{{.Series}} {{.EpisodeID}}{{.Ext}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		opts   []Option
+		l      Linkable
+		target string
+	}{
+		{[]Option{WithTargetCase(CasePreserve)}, movie, "movies/Heat (1995)/Heat.1995.1080p.mkv"},
+		{[]Option{WithTargetCase(CaseLower)}, movie, "movies/heat (1995)/heat.1995.1080p.mkv"},
+		{[]Option{WithTargetCase(CaseLower)}, episode, "tv/breaking bad/season 1/breaking bad - s01e02.mkv"},
+		{[]Option{WithTargetCase(CaseUpper), WithTargetTemplates(nil, tmpl)}, episode, "TV/BREAKING BAD/SEASON 1/BREAKING BAD S01E02.MKV"},
+	}
+	for _, tt := range tests {
+		options.SetOptions(tt.opts...)
+		if got := tt.l.Target(); got != tt.target {
+			t.Errorf("Target() of %s with %s = %q, want %q", tt.l.Path(), options.targetCase, got, tt.target)
+		}
+	}
+
+	// Existing folders in another case are linked into
+	options.SetOptions(WithTargetCase(CaseLower), WithTargetTemplates(nil, nil))
+	dest := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dest, "movies", "Heat (1995)"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.ToSlash(filepath.Join(dest, "movies", "Heat (1995)", "heat.1995.1080p.mkv"))
+	if got := filepath.ToSlash(LinkFromMedia(movie, dest).Target); got != want {
+		t.Errorf("LinkFromMedia() target = %q, want %q", got, want)
+	}
+}
+
+func TestFsckTargetCase(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	dest := t.TempDir()
+	for _, f := range []string{
+		"tv/breaking bad/season 1/breaking bad - s01e01 - pilot.mkv",
+		"tv/breaking bad/Season 2/Breaking Bad - S02E01.mkv",
+	} {
+		p := filepath.Join(dest, filepath.FromSlash(f))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issues, err := Fsck(dest, WithFileExtensions([]string{"mkv"}), WithTargetCase(CaseLower))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range issues {
+		t.Errorf("Fsck() of a library in another case reported %s: %s", i.Path, i.Problem)
+	}
+}
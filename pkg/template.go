@@ -0,0 +1,191 @@
+package kourai
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TargetFields are the values available to target templates. Fields that
+// don't apply to the media type, e.g. the season of a movie, are empty.
+type TargetFields struct {
+	// Type is "movie" or "episode"
+	Type string
+	// Title is the movie title, or the episode title
+	Title  string
+	Series string
+	Year   int
+	Season int
+	// SeasonFolder is "Season <N>", or "Specials" for season 0
+	SeasonFolder string
+	// EpisodeID is formatted as in the default layout, e.g. S01E02 or
+	// S01E01-E02 for files with several episodes, or is the air date of
+	// episodes of daily shows
+	EpisodeID string
+	Episode   int
+	// AirDate is the air date of episodes of daily shows, e.g. 2024-05-01,
+	// and empty for others
+	AirDate string
+	TMDBID  int
+	// Decade is the decade the movie was released in, or the series first
+	// aired in, e.g. 1970s, as given by the metadata provider when it was
+	// looked up, or empty when unknown
+	Decade string
+	// Edition is the edition of movies, e.g. Director's Cut, or empty
+	Edition string
+	// Collection is the TMDB collection of movies, with collection folders
+	// enabled, or empty for movies that don't belong to one
+	Collection string
+	// Resolution, Source and Codec are the quality tagged in the name of
+	// the source or its folder, e.g. 1080p, BluRay and H.264, or empty
+	Resolution string
+	Source     string
+	Codec      string
+	// Group is the release group of the source, or empty
+	Group string
+	// Quality is the resolution and source, e.g. "1080p BluRay"
+	Quality string
+	// Ext is the extension of the source, including the dot
+	Ext string
+	// Filename is the base name of the source
+	Filename string
+	// Duration, Width, Height, VideoCodec and AudioCodec are probed from
+	// the source, see WithProbe, e.g. 1h42m0s, 1920, 1080, hevc and eac3,
+	// or empty when it wasn't probed
+	Duration   time.Duration
+	Width      int
+	Height     int
+	VideoCodec string
+	AudioCodec string
+}
+
+// Fields returns the values of l available to target templates, or zero
+// TargetFields for media of other packages.
+func Fields(l Linkable) TargetFields {
+	switch m := l.(type) {
+	case *movie:
+		return m.fields()
+	case *episode:
+		return m.fields()
+	}
+	return TargetFields{}
+}
+
+// targetFuncs are the functions available to target templates
+var targetFuncs = template.FuncMap{
+	// shard returns the folder a name is filed under in sharded layouts,
+	// e.g. {{shard .Series}}/{{.Series}}, see WithShardedLayout
+	"shard": shard,
+}
+
+// TargetTemplate renders the target path of media, relative to the
+// destination, from a text/template.
+type TargetTemplate struct {
+	tmpl *template.Template
+}
+
+// ParseTargetTemplate parses s and checks that it renders a relative path
+// for sample media.
+func ParseTargetTemplate(s string) (*TargetTemplate, error) {
+	tmpl, err := template.New("target").Option("missingkey=error").Funcs(targetFuncs).Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target template: %w", err)
+	}
+	t := &TargetTemplate{tmpl: tmpl}
+	sample := TargetFields{
+		Type: "episode", Title: "Pilot", Series: "Series", Year: 2001,
+		Season: 1, SeasonFolder: "Season 1", EpisodeID: "S01E01", Episode: 1,
+		Ext: ".mkv", Filename: "series.s01e01.mkv",
+	}
+	if _, err := t.render(sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *TargetTemplate) render(f TargetFields) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, f); err != nil {
+		return "", fmt.Errorf("failed to render target template: %w", err)
+	}
+	target := path.Clean(strings.TrimSpace(b.String()))
+	if target == "." || !filepath.IsLocal(target) {
+		return "", fmt.Errorf("target template rendered %q, which is not a path inside the destination", b.String())
+	}
+	return target, nil
+}
+
+// episodeFolders returns the series and season folders of target, the path
+// of episode e, or empty strings where the layout has none. Since templates
+// can change the layout, the folders are found by comparing the layout of e
+// with those of other episodes: the series folder is the deepest one shared
+// by every episode of the series but not by other series, and the season
+// folder the deepest one shared by the episodes of its season only.
+func episodeFolders(target string, e *episode) (series, season string) {
+	// Episodes given in full, so that rendering them doesn't depend on the
+	// ID parsed from the source
+	dirs := func(name string, tmdbID, s, n int) []string {
+		other := &episode{
+			series:  name,
+			title:   fmt.Sprintf("Episode %d", n),
+			id:      fmt.Sprintf("s%02de%02d", s, n),
+			season:  s,
+			episode: n,
+			year:    e.year,
+			path:    fmt.Sprintf("%s.s%02de%02d%s", name, s, n, filepath.Ext(e.path)),
+			tmdbID:  tmdbID,
+		}
+		d := path.Dir(other.Target())
+		if d == "." {
+			return nil
+		}
+		return strings.Split(d, "/")
+	}
+	own := dirs(e.series, e.tmdbID, e.season, e.episode)
+	sameSeason := commonPrefix(own, dirs(e.series, e.tmdbID, e.season, e.episode+1))
+	sameSeries := commonPrefix(own, dirs(e.series, e.tmdbID, e.season+1, e.episode+1))
+	otherSeries := commonPrefix(own, dirs(e.series+" Other", e.tmdbID+1, e.season, e.episode))
+
+	up := func(levels int) string {
+		dir := target
+		for i := 0; i < levels; i++ {
+			dir = filepath.Dir(dir)
+		}
+		return dir
+	}
+	if sameSeries > otherSeries {
+		series = up(len(own) - sameSeries + 1)
+	}
+	if sameSeason > sameSeries && sameSeries > otherSeries {
+		season = up(len(own) - sameSeason + 1)
+	}
+	return series, season
+}
+
+// movieFolder returns the folder of target, the path of movie m, or an
+// empty string when the layout puts other movies in it too.
+func movieFolder(target string, m *movie) string {
+	other := &movie{
+		title:      m.title + " Other",
+		year:       m.year + 1,
+		path:       filepath.Join(filepath.Dir(m.path), "other"+filepath.Ext(m.path)),
+		tmdbID:     m.tmdbID + 1,
+		collection: m.collection,
+	}
+	if path.Dir(m.Target()) == path.Dir(other.Target()) {
+		return ""
+	}
+	return filepath.Dir(target)
+}
+
+// commonPrefix returns the number of leading elements a and b share
+func commonPrefix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
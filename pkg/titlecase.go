@@ -0,0 +1,58 @@
+package kourai
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// defaultTitleExceptions are words title casing gets wrong: acronyms, roman
+// numerals and stylized names, as they're written. Words that are also
+// common English words, e.g. US or IT, are left out.
+var defaultTitleExceptions = []string{
+	"CIA", "CSI", "DC", "FBI", "LAPD", "NCIS", "NYPD", "SWAT", "TV", "UFO", "UK", "USA",
+	"II", "III", "IV", "VI", "VII", "VIII", "IX", "XI", "XII",
+	"M*A*S*H", "WALL·E", "BoJack", "iCarly", "iZombie", "MacGyver",
+}
+
+// WithTitleExceptions adds words to be written as given in titles parsed
+// from paths, e.g. "ALF" or "DuckTales", whatever their casing in the path.
+// Acronyms, roman numerals and a few stylized names are known already.
+// Titles found by a metadata provider are used as it writes them.
+func WithTitleExceptions(words []string) Option {
+	return func(o *Options) {
+		if o.titleExceptions == nil {
+			o.titleExceptions = map[string]string{}
+		}
+		for _, w := range words {
+			if w = strings.TrimSpace(w); w != "" {
+				o.titleExceptions[strings.ToLower(w)] = w
+			}
+		}
+	}
+}
+
+// titleExceptions maps the default exceptions by their lower case
+var titleExceptions = func() map[string]string {
+	m := map[string]string{}
+	for _, w := range defaultTitleExceptions {
+		m[strings.ToLower(w)] = w
+	}
+	return m
+}()
+
+// titleCase converts t to title case, writing the exceptions as they're
+// given
+func titleCase(t string) string {
+	words := strings.Split(cases.Title(language.AmericanEnglish, cases.NoLower).String(t), " ")
+	for i, w := range words {
+		lower := strings.ToLower(w)
+		if e, ok := options.titleExceptions[lower]; ok {
+			words[i] = e
+		} else if e, ok := titleExceptions[lower]; ok {
+			words[i] = e
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,47 @@
+package kourai
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTitleCase(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	options.SetOptions(WithTitleExceptions([]string{"ALF", " "}))
+
+	tests := []struct {
+		in, want string
+	}{
+		{"the fbi files", "The FBI Files"},
+		{"rocky ii", "Rocky II"},
+		{"m*a*s*h", "M*A*S*H"},
+		{"wall·e", "WALL·E"},
+		{"bojack horseman", "BoJack Horseman"},
+		// Exceptions are whole words
+		{"bring us home", "Bring Us Home"},
+		{"ivy", "Ivy"},
+		{"alf", "ALF"},
+	}
+	for _, tt := range tests {
+		if got := makeTitle(tt.in); got != tt.want {
+			t.Errorf("makeTitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestProviderTitleVerbatim(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	p := &fakeProvider{movies: map[string]MovieMetadata{"Wall E": {Title: "WALL·E", Year: 2008}}}
+	options.SetOptions(WithMetadataProvider(p))
+
+	m, err := MovieFromPath("/dl/wall.e.2008.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup(context.Background(), p, m)
+	if want := "movies/WALL·E (2008)/wall.e.2008.mkv"; m.Target() != want {
+		t.Errorf("Target() = %q, want %q", m.Target(), want)
+	}
+}
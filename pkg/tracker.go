@@ -0,0 +1,199 @@
+package kourai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tmdb "github.com/alzabo/kourai/internal/tmdb"
+)
+
+// trackerBucket keeps the TrackedShows of the library, keyed by the
+// lowercase name of the series
+const trackerBucket = "tracked"
+
+// EpisodeNumber is the season and number of an episode
+type EpisodeNumber struct {
+	Season  int `json:"season"`
+	Episode int `json:"episode"`
+}
+
+func (n EpisodeNumber) less(o EpisodeNumber) bool {
+	return n.Season < o.Season || (n.Season == o.Season && n.Episode < o.Episode)
+}
+
+// TrackedShow is a series of the library, and the latest of its episodes
+// the library has. Episodes aired after it are new.
+type TrackedShow struct {
+	Name   string        `json:"name"`
+	TMDBID int           `json:"tmdb_id"`
+	Latest EpisodeNumber `json:"latest"`
+}
+
+// MissingEpisode is an episode of a tracked show that aired after the
+// latest episode in the library
+type MissingEpisode struct {
+	Series  string
+	TMDBID  int
+	Season  int
+	Episode int
+	Title   string
+	AirDate time.Time
+}
+
+// TrackShows records the series of the episodes below dest in store, along
+// with the latest episode of each, and returns them. Series are looked up by
+// their TMDB ID tag, the ID they were recorded with before, or by name with
+// the metadata provider, which must know their TMDB ID.
+func TrackShows(ctx context.Context, store Store, dest string, optionConfig ...Option) ([]TrackedShow, error) {
+	options.SetOptions(optionConfig...)
+	shows := map[string]*TrackedShow{}
+	media, errc := findFiles(ctx, dest, options.fileFilters...)
+	for m := range media {
+		e, ok := m.(*episode)
+		if !ok || e.series == "" {
+			continue
+		}
+		key := strings.ToLower(e.series)
+		show, ok := shows[key]
+		if !ok {
+			show = &TrackedShow{Name: e.series}
+			shows[key] = show
+		}
+		if e.tmdbID != 0 {
+			show.TMDBID = e.tmdbID
+		}
+		// Specials aren't ordered with the other seasons, and daily shows
+		// are named after air dates rather than numbered
+		if n := (EpisodeNumber{e.season, e.episode}); e.season > 0 && e.airDate.IsZero() && show.Latest.less(n) {
+			show.Latest = n
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	tracked := make([]TrackedShow, 0, len(shows))
+	for key, show := range shows {
+		if show.TMDBID == 0 {
+			if b, _, err := store.Get(ctx, trackerBucket, key); err == nil {
+				var prev TrackedShow
+				if json.Unmarshal(b, &prev) == nil {
+					show.TMDBID = prev.TMDBID
+				}
+			}
+		}
+		if show.TMDBID == 0 {
+			if p := options.metadataProvider(); p != nil {
+				if s, err := p.SearchSeries(ctx, show.Name, 0); err == nil {
+					show.TMDBID = s.TMDBID
+				}
+			}
+		}
+		if show.TMDBID == 0 {
+			errs = append(errs, fmt.Errorf("no TMDB ID found for %s, tag its folder with {tmdb-<id>} to track it", show.Name))
+			continue
+		}
+		b, err := json.Marshal(show)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Put(ctx, trackerBucket, key, b); err != nil {
+			return nil, err
+		}
+		tracked = append(tracked, *show)
+	}
+	sort.Slice(tracked, func(i, j int) bool { return tracked[i].Name < tracked[j].Name })
+	return tracked, errors.Join(errs...)
+}
+
+// TrackedShows returns the shows recorded by TrackShows.
+func TrackedShows(ctx context.Context, store Store) ([]TrackedShow, error) {
+	values, err := store.List(ctx, trackerBucket)
+	if err != nil {
+		return nil, err
+	}
+	shows := make([]TrackedShow, 0, len(values))
+	for _, b := range values {
+		var show TrackedShow
+		if err := json.Unmarshal(b, &show); err != nil {
+			return nil, fmt.Errorf("failed to parse tracked show with error %w", err)
+		}
+		shows = append(shows, show)
+	}
+	sort.Slice(shows, func(i, j int) bool { return shows[i].Name < shows[j].Name })
+	return shows, nil
+}
+
+// NewEpisodes asks TMDB for the episodes of shows that aired after their
+// latest episode in the library, by now. Seasons are always requested
+// anew, bypassing the response caches.
+func NewEpisodes(ctx context.Context, shows []TrackedShow, now time.Time) ([]MissingEpisode, error) {
+	client := options.TMDBClient
+	if client == nil {
+		return nil, errors.New("looking up new episodes needs a TMDB API key")
+	}
+	ctx = tmdb.WithoutCache(ctx)
+	var missing []MissingEpisode
+	var errs []error
+	for _, show := range shows {
+		details, err := client.TVDetails(ctx, show.TMDBID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", show.Name, err))
+			continue
+		}
+		for _, season := range details.Seasons {
+			if season.SeasonNumber < max(show.Latest.Season, 1) {
+				continue
+			}
+			if season.AirDate.IsZero() || season.AirDate.After(now) {
+				continue
+			}
+			sd, err := client.SeasonDetails(ctx, show.TMDBID, season.SeasonNumber)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", show.Name, err))
+				continue
+			}
+			for _, ep := range sd.Episodes {
+				n := EpisodeNumber{int(ep.SeasonNumber), int(ep.EpisodeNumber)}
+				if !show.Latest.less(n) || ep.AirDate.IsZero() || ep.AirDate.After(now) {
+					continue
+				}
+				missing = append(missing, MissingEpisode{
+					Series:  show.Name,
+					TMDBID:  show.TMDBID,
+					Season:  n.Season,
+					Episode: n.Episode,
+					Title:   ep.Name,
+					AirDate: ep.AirDate.Time,
+				})
+			}
+		}
+	}
+	return missing, errors.Join(errs...)
+}
+
+// NotifyNewEpisodes runs h for each of the missing episodes, with the
+// episode as its fields and an empty Output.
+func NotifyNewEpisodes(ctx context.Context, h *Hook, missing []MissingEpisode) error {
+	var errs []error
+	for _, m := range missing {
+		err := h.run(ctx, HookFields{
+			Type:    "episode",
+			Title:   m.Title,
+			Series:  m.Series,
+			Season:  m.Season,
+			Episode: m.Episode,
+			TMDBID:  m.TMDBID,
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,98 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewEpisodes(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	var seasonRequests atomic.Int32
+	responses := map[string]string{
+		"/3/search/tv": `{"page": 1, "total_pages": 1, "results": [{"id": 766002, "name": "Show"}]}`,
+		"/3/tv/766001": `{"id": 766001, "name": "The Wire", "seasons": [{"season_number": 0, "air_date": "2002-01-01"}, {"season_number": 1, "air_date": "2002-06-02"}, {"season_number": 2, "air_date": "2003-06-01"}, {"season_number": 3, "air_date": "2099-01-01"}]}`,
+		"/3/tv/766001/season/1": `{"id": 1, "season_number": 1, "episodes": [
+			{"id": 11, "name": "The Target", "season_number": 1, "episode_number": 1, "air_date": "2002-06-02"},
+			{"id": 12, "name": "The Detail", "season_number": 1, "episode_number": 2, "air_date": "2002-06-09"},
+			{"id": 13, "name": "The Buys", "season_number": 1, "episode_number": 3, "air_date": "2002-06-16"}]}`,
+		"/3/tv/766001/season/2": `{"id": 2, "season_number": 2, "episodes": [
+			{"id": 21, "name": "Ebb Tide", "season_number": 2, "episode_number": 1, "air_date": "2003-06-01"},
+			{"id": 22, "name": "Collateral Damage", "season_number": 2, "episode_number": 2, "air_date": "2099-06-08"}]}`,
+		"/3/tv/766002":          `{"id": 766002, "name": "Show", "seasons": [{"season_number": 1, "air_date": "2001-01-01"}]}`,
+		"/3/tv/766002/season/1": `{"id": 3, "season_number": 1, "episodes": [{"id": 31, "name": "Pilot", "season_number": 1, "episode_number": 1, "air_date": "2001-01-01"}]}`,
+	}
+	fakeTMDB(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if filepath.Base(filepath.Dir(r.URL.Path)) == "season" {
+			seasonRequests.Add(1)
+		}
+		fmt.Fprint(w, body)
+	}))
+
+	dest := t.TempDir()
+	for _, name := range []string{
+		"tv/The Wire {tmdb-766001}/Season 1/The Wire - S01E01 - The Target.mkv",
+		"tv/The Wire {tmdb-766001}/Season 1/The Wire - S01E02 - The Detail.mkv",
+		"tv/The Wire {tmdb-766001}/Specials/The Wire - S00E05 - Special.mkv",
+		"tv/Show/Season 1/Show - S01E01 - Pilot.mkv",
+		"movies/Heat (1995)/heat.mkv",
+	} {
+		path := filepath.Join(dest, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	shows, err := TrackShows(ctx, store, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TrackedShow{
+		{Name: "Show", TMDBID: 766002, Latest: EpisodeNumber{1, 1}},
+		{Name: "The Wire", TMDBID: 766001, Latest: EpisodeNumber{1, 2}},
+	}
+	if diff := cmp.Diff(want, shows); diff != "" {
+		t.Errorf("TrackShows() mismatch (-want +got):\n%s", diff)
+	}
+	if stored, err := TrackedShows(ctx, store); err != nil || !cmp.Equal(want, stored) {
+		t.Errorf("TrackedShows() = %v, %v, want %v", stored, err, want)
+	}
+
+	now := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	wantMissing := []MissingEpisode{
+		{Series: "The Wire", TMDBID: 766001, Season: 1, Episode: 3, Title: "The Buys", AirDate: time.Date(2002, 6, 16, 0, 0, 0, 0, time.UTC)},
+		{Series: "The Wire", TMDBID: 766001, Season: 2, Episode: 1, Title: "Ebb Tide", AirDate: time.Date(2003, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for i := 0; i < 2; i++ {
+		missing, err := NewEpisodes(ctx, shows, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(wantMissing, missing); diff != "" {
+			t.Errorf("NewEpisodes() mismatch (-want +got):\n%s", diff)
+		}
+	}
+	// Seasons aren't cached, so that episodes that aired since are found
+	if n := seasonRequests.Load(); n != 6 {
+		t.Errorf("requested seasons %d times, want 6", n)
+	}
+}
@@ -0,0 +1,213 @@
+package kourai
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The kinds of VerifyIssue
+const (
+	// VerifyStale is a journal entry whose target no longer exists
+	VerifyStale = "stale"
+	// VerifyBroken is a hard link that no longer shares the inode of its
+	// source, because the source was deleted or replaced
+	VerifyBroken = "broken"
+	// VerifyMisnamed is an entry not named as its media would be now
+	VerifyMisnamed = "misnamed"
+	// VerifyDuplicate is an entry sharing its source with another entry
+	VerifyDuplicate = "duplicate"
+)
+
+// VerifyIssue is a destination entry found wrong by Verify, or a journal
+// entry for a target that's gone.
+type VerifyIssue struct {
+	Path string
+	// Kind is one of the Verify constants
+	Kind    string
+	Problem string
+}
+
+// Verify audits the media files of the destination dest against its
+// journal and the current layout:
+//
+//   - journal entries whose target is gone are stale
+//   - hard links no longer sharing the inode of their source are broken,
+//     as are hard links without a journal entry that aren't linked to any
+//     other file
+//   - files that would be named otherwise by the default layout or the
+//     target templates, given the names parsed from their paths, are
+//     misnamed
+//   - files sharing an inode or a source with another are duplicates
+//
+// Nothing is changed. Movies aren't checked for names with collection
+// folders, which can't be told from their paths.
+func Verify(dest string, optionConfig ...Option) ([]VerifyIssue, error) {
+	options.SetOptions(optionConfig...)
+	if _, err := os.Stat(dest); err != nil {
+		return nil, err
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	// Names are compared as written, since media were named after their
+	// metadata rather than the casing of their paths
+	defer func(skip bool) { options.SkipTitleCaser = skip }(options.SkipTitleCaser)
+	options.SkipTitleCaser = true
+
+	hardlinks := options.linkMode == ModeHardlink || options.linkMode == ""
+	entries, err := journalTargets(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []VerifyIssue{}
+	seen := map[string]bool{}
+	inodes := map[inodeKey]string{}
+	sources := map[string]string{}
+	err = filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// kourai's journal and lock, and other hidden entries
+		if p != dest && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !isMedia(info) {
+			return nil
+		}
+		seen[p] = true
+		e, journaled := entries[p]
+
+		// Copies of a source don't share its inode, but its journal entries
+		dev, ino, nlink, idErr := fileIdentity(p, info)
+		duplicate := ""
+		if idErr == nil {
+			k := inodeKey{dev, ino}
+			if first, ok := inodes[k]; ok {
+				duplicate = "same file as " + first
+			} else {
+				inodes[k] = p
+			}
+		}
+		if journaled {
+			if first, ok := sources[e.Src]; ok && duplicate == "" {
+				duplicate = "linked from the same source as " + first
+			} else if !ok {
+				sources[e.Src] = p
+			}
+		}
+		if duplicate != "" {
+			issues = append(issues, VerifyIssue{Path: p, Kind: VerifyDuplicate, Problem: duplicate})
+		}
+
+		switch {
+		case journaled && (e.Mode == string(ModeHardlink) || e.Mode == ""):
+			if problem := verifyLink(e.Src, info); problem != "" {
+				issues = append(issues, VerifyIssue{Path: p, Kind: VerifyBroken, Problem: problem})
+			}
+		case !journaled && hardlinks && idErr == nil && nlink < 2:
+			issues = append(issues, VerifyIssue{Path: p, Kind: VerifyBroken, Problem: "not linked to any other file, its source was probably deleted"})
+		}
+
+		if want := verifyName(dest, p); want != "" {
+			issues = append(issues, VerifyIssue{Path: p, Kind: VerifyMisnamed, Problem: fmt.Sprintf("should be named %s", want)})
+		}
+		return nil
+	})
+	if err != nil {
+		return issues, err
+	}
+
+	for target := range entries {
+		if !seen[target] {
+			if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+				issues = append(issues, VerifyIssue{Path: target, Kind: VerifyStale, Problem: "target of a journal entry doesn't exist"})
+			}
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues, nil
+}
+
+// journalTargets returns the journal entries of the targets currently in
+// dest, by target. Targets renamed within dest, e.g. by a repair, keep the
+// source they were linked from and the mode they were linked with.
+func journalTargets(dest string) (map[string]JournalEntry, error) {
+	entries, err := ReadJournal(filepath.Join(dest, JournalName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]JournalEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]JournalEntry{}
+	for _, e := range entries {
+		if e.Src, err = filepath.Abs(e.Src); err != nil {
+			return nil, err
+		}
+		if e.Target, err = filepath.Abs(e.Target); err != nil {
+			return nil, err
+		}
+		if prev, ok := targets[e.Src]; ok {
+			delete(targets, e.Src)
+			e.Src, e.Mode = prev.Src, prev.Mode
+		}
+		targets[e.Target] = e
+	}
+	return targets, nil
+}
+
+// verifyLink returns why target, a hard link of src, no longer is one, or
+// "" when it still is
+func verifyLink(src string, target fs.FileInfo) string {
+	info, err := os.Stat(src)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Sprintf("source %s no longer exists", src)
+	case err != nil:
+		return err.Error()
+	case os.SameFile(info, target):
+	case options.copyFallback && info.Size() == target.Size():
+		// Copied instead, across filesystems
+	default:
+		return fmt.Sprintf("source %s was replaced, the target is a stale copy", src)
+	}
+	return ""
+}
+
+// verifyName returns the path the media file at p below dest would be
+// named now, or "" when it's named so already or can't be parsed
+func verifyName(dest, p string) string {
+	l, err := NewLinkable(p)
+	if err != nil {
+		return ""
+	}
+	if m, ok := l.(*movie); ok {
+		if options.collectionDirs {
+			return ""
+		}
+		// Movies keep the file names of their sources, so only their folder
+		// is named after their metadata, when they're in one
+		dir := filepath.Dir(p)
+		if f, err := MovieFromPath(filepath.Join(dir, filepath.Base(dir)+filepath.Ext(p))); err == nil && f.YearValid() {
+			m.title, m.year = f.title, f.year
+		}
+	}
+	if want := filepath.Join(dest, l.Target()); want != p {
+		return want
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package kourai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVerify(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	for _, f := range []string{"Alien.1979.mkv", "heat.1995.mkv", "Dune.2021.mkv", "Show.S01E01.mkv", "stray.mkv"} {
+		if err := os.WriteFile(filepath.Join(src, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal, err := OpenJournal(filepath.Join(dest, JournalName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := func(src, target string, journaled bool) {
+		t.Helper()
+		target = filepath.Join(dest, target)
+		os.MkdirAll(filepath.Dir(target), 0755)
+		if err := os.Link(src, target); err != nil {
+			t.Fatal(err)
+		}
+		if journaled {
+			if err := journal.Record(string(ModeHardlink), Link{Src: src, Target: target}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	link(filepath.Join(src, "Alien.1979.mkv"), "movies/Alien (1979)/Alien.1979.mkv", true)
+	link(filepath.Join(src, "Alien.1979.mkv"), "movies/Alien (1979)/Alien.1979.copy.mkv", true)
+	link(filepath.Join(src, "heat.1995.mkv"), "movies/Heat (1995)/heat.1995.mkv", true)
+	link(filepath.Join(src, "Dune.2021.mkv"), "movies/Dune (2021)/Dune.2021.mkv", true)
+	link(filepath.Join(src, "Show.S01E01.mkv"), "tv/Show/Season 2/Show - S01E01.mkv", true)
+	link(filepath.Join(src, "stray.mkv"), "movies/Stray (2000)/stray.mkv", false)
+	// Gone since it was linked
+	link(filepath.Join(src, "Show.S01E01.mkv"), "tv/Show/Season 1/Show - S01E01.mkv", true)
+	journal.Close()
+	os.Remove(filepath.Join(dest, "tv/Show/Season 1/Show - S01E01.mkv"))
+	os.Remove(filepath.Join(src, "Dune.2021.mkv"))
+	os.Remove(filepath.Join(src, "stray.mkv"))
+
+	issues, err := Verify(dest, WithFileExtensions([]string{"mkv"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type issue struct{ Path, Kind string }
+	got := []issue{}
+	for _, i := range issues {
+		rel, _ := filepath.Rel(dest, i.Path)
+		got = append(got, issue{filepath.ToSlash(rel), i.Kind})
+	}
+	want := []issue{
+		{"movies/Alien (1979)/Alien.1979.mkv", VerifyDuplicate},
+		{"movies/Dune (2021)/Dune.2021.mkv", VerifyBroken},
+		{"movies/Stray (2000)/stray.mkv", VerifyBroken},
+		{"tv/Show/Season 1/Show - S01E01.mkv", VerifyStale},
+		{"tv/Show/Season 2/Show - S01E01.mkv", VerifyMisnamed},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Verify() mismatch (-want +got):\n%s", diff)
+	}
+	if options.SkipTitleCaser {
+		t.Error("Verify() left title casing disabled")
+	}
+}
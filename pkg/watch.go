@@ -0,0 +1,162 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch watches the sources for files that are created, moved in or
+// written to, and sends a Link for each media file among them, as
+// LinkFromFiles would, once it was left alone for quiet, so that files
+// still being downloaded or unpacked aren't linked half written. Folders
+// created or moved into the sources are watched too, and their files
+// linked. Files already in the sources when Watch starts aren't linked;
+// LinkFromFiles links them.
+//
+// Time is told, and the sources are walked and checked, by the clock and
+// file system of WithClock and WithFileSystem, while changes are watched on
+// the operating system's file system. Files are looked up by
+// options.netWorkers workers. Watching stops when
+// ctx is done, after which the channel is closed. Invalid options, or
+// sources that can't be watched, are sent on the error channel and nothing
+// is watched.
+func Watch(ctx context.Context, quiet time.Duration, optionConfig ...Option) (<-chan Link, <-chan error) {
+	options.SetOptions(optionConfig...)
+	linkc := make(chan Link)
+	errc := make(chan error, 1)
+	fail := func(err error) (<-chan Link, <-chan error) {
+		close(linkc)
+		errc <- err
+		return linkc, errc
+	}
+	if err := options.Validate(); err != nil {
+		return fail(fmt.Errorf("invalid options: %w", err))
+	}
+	if err := options.openState(); err != nil {
+		return fail(err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fail(err)
+	}
+	if quiet <= 0 {
+		quiet = 2 * time.Second
+	}
+
+	pending := map[string]time.Time{}
+	// watch watches root and the folders below it, but for excluded
+	// ones, adding the files in them to pending when found is set
+	watch := func(root string, found bool) error {
+		return options.fs.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				if found && d.Type().IsRegular() {
+					pending[path] = options.clock.Now()
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if _, ok := options.ignores.match(path); ok {
+				return fs.SkipDir
+			}
+			for _, filter := range options.fileFilters {
+				if filter.exclude(info) {
+					return fs.SkipDir
+				}
+			}
+			return watcher.Add(path)
+		})
+	}
+	for _, src := range options.sources {
+		if err := watch(src, false); err != nil {
+			watcher.Close()
+			return fail(fmt.Errorf("failed to watch %s with error %w", src, err))
+		}
+	}
+
+	files := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < options.netWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range files {
+				info, err := options.fs.Stat(path)
+				if err != nil || !info.Mode().IsRegular() {
+					continue
+				}
+				m, ok := mediaFromFile(ctx, path, info, options.fileFilters)
+				if !ok {
+					continue
+				}
+				if ln, ok := linkFromMedia(ctx, m); ok {
+					for _, ln := range withSidecars(ln) {
+						select {
+						case linkc <- ln:
+						case <-ctx.Done():
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			watcher.Close()
+			close(files)
+			wg.Wait()
+			close(linkc)
+		}()
+		tick := options.clock.After(quiet / 2)
+		// Settled files are queued, so that events are still received
+		// while the workers are busy looking files up
+		var ready []string
+		for {
+			var out chan<- string
+			var next string
+			if len(ready) > 0 {
+				out, next = files, ready[0]
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case out <- next:
+				ready = ready[1:]
+			case err := <-watcher.Errors:
+				options.logger.Warn("watching the sources failed", "error", err)
+			case ev := <-watcher.Events:
+				if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+					continue
+				}
+				if info, err := options.fs.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := watch(ev.Name, true); err != nil {
+						options.logger.Warn("failed to watch directory", "path", ev.Name, "error", err)
+					}
+					continue
+				}
+				pending[ev.Name] = options.clock.Now()
+			case now := <-tick:
+				tick = options.clock.After(quiet / 2)
+				for path, changed := range pending {
+					if now.Sub(changed) >= quiet {
+						delete(pending, path)
+						ready = append(ready, path)
+					}
+				}
+			}
+		}
+	}()
+	errc <- nil
+	return linkc, errc
+}
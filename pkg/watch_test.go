@@ -0,0 +1,55 @@
+package kourai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatch(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+
+	src, dest := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "Existing.2000.mkv"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	links, errc := Watch(ctx, 200*time.Millisecond,
+		WithSources([]string{src}), WithDestination(dest), WithFileExtensions([]string{"mkv"}))
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	// A file written in place, and a folder moved in with its files
+	if err := os.WriteFile(filepath.Join(src, "Heat.1995.mkv"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	staging := t.TempDir()
+	os.Mkdir(filepath.Join(staging, "Alien.1979"), 0755)
+	os.WriteFile(filepath.Join(staging, "Alien.1979", "Alien.1979.mkv"), nil, 0644)
+	os.WriteFile(filepath.Join(staging, "Alien.1979", "Alien.1979.nfo"), nil, 0644)
+	if err := os.Rename(filepath.Join(staging, "Alien.1979"), filepath.Join(src, "Alien.1979")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for l := range links {
+		rel, _ := filepath.Rel(dest, l.Target)
+		got = append(got, filepath.ToSlash(rel))
+		if len(got) == 2 {
+			cancel()
+		}
+	}
+	sort.Strings(got)
+	want := []string{"movies/Alien (1979)/Alien.1979.mkv", "movies/Heat (1995)/Heat.1995.mkv"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Watch() mismatch (-want +got):\n%s", diff)
+	}
+}
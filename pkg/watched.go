@@ -0,0 +1,220 @@
+package kourai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SourceTrakt is the Trakt watch history, see FetchWatchHistory
+const SourceTrakt = "trakt"
+
+// traktURL is the Trakt API, unless another URL is given
+const traktURL = "https://api.trakt.tv"
+
+type plexWatched struct {
+	MediaContainer struct {
+		Metadata []struct {
+			Title            string `json:"title"`
+			Year             int    `json:"year"`
+			GrandparentTitle string `json:"grandparentTitle"`
+			ParentIndex      int    `json:"parentIndex"`
+			Index            int    `json:"index"`
+			ViewCount        int    `json:"viewCount"`
+			Guid             []struct {
+				ID string `json:"id"`
+			} `json:"Guid"`
+		} `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+type traktIDs struct {
+	TMDB int `json:"tmdb"`
+}
+
+type traktWatchedMovies []struct {
+	Movie struct {
+		Title string   `json:"title"`
+		Year  int      `json:"year"`
+		IDs   traktIDs `json:"ids"`
+	} `json:"movie"`
+}
+
+type traktWatchedShows []struct {
+	Show struct {
+		Title string   `json:"title"`
+		IDs   traktIDs `json:"ids"`
+	} `json:"show"`
+	Seasons []struct {
+		Number   int `json:"number"`
+		Episodes []struct {
+			Number int `json:"number"`
+		} `json:"episodes"`
+	} `json:"seasons"`
+}
+
+// WatchHistory is the movies and episodes a user has watched. Movies are
+// known by TMDB ID when the source gives it, and otherwise by title and
+// year, and episodes by series and number.
+type WatchHistory struct {
+	movies   map[string]bool
+	episodes map[string]bool
+}
+
+func newWatchHistory() *WatchHistory {
+	return &WatchHistory{movies: map[string]bool{}, episodes: map[string]bool{}}
+}
+
+func (h *WatchHistory) addMovie(tmdbID int, title string, year int) {
+	if tmdbID != 0 {
+		h.movies[fmt.Sprintf("tmdb:%d", tmdbID)] = true
+	}
+	h.movies[fmt.Sprintf("%s:%d", folderKey(title), year)] = true
+}
+
+func (h *WatchHistory) addEpisode(tmdbID int, series string, season, episode int) {
+	if tmdbID != 0 {
+		h.episodes[fmt.Sprintf("tmdb:%d:%d:%d", tmdbID, season, episode)] = true
+	}
+	h.episodes[fmt.Sprintf("%s:%d:%d", folderKey(series), season, episode)] = true
+}
+
+// Len returns the number of movies and episodes in h
+func (h *WatchHistory) Len() (movies, episodes int) {
+	for k := range h.movies {
+		if !strings.HasPrefix(k, "tmdb:") {
+			movies++
+		}
+	}
+	for k := range h.episodes {
+		if !strings.HasPrefix(k, "tmdb:") {
+			episodes++
+		}
+	}
+	return movies, episodes
+}
+
+// Watched reports whether l was watched, by its TMDB ID when both l and the
+// history know it, and by its name otherwise.
+func (h *WatchHistory) Watched(l Linkable) bool {
+	switch m := l.(type) {
+	case *movie:
+		if m.tmdbID != 0 && h.movies[fmt.Sprintf("tmdb:%d", m.tmdbID)] {
+			return true
+		}
+		return h.movies[fmt.Sprintf("%s:%d", folderKey(m.title), releaseYear(m))]
+	case *episode:
+		if m.tmdbID != 0 && h.episodes[fmt.Sprintf("tmdb:%d:%d:%d", m.tmdbID, m.season, m.episode)] {
+			return true
+		}
+		return h.episodes[fmt.Sprintf("%s:%d:%d", folderKey(m.series), m.season, m.episode)]
+	}
+	return false
+}
+
+// FetchWatchHistory fetches the watch history of a Plex server, with the
+// Plex token, or of a Trakt user, with the OAuth access token of the user
+// and the client ID of the Trakt app. The base URL of Trakt defaults to its
+// public API.
+func FetchWatchHistory(ctx context.Context, source, baseURL, token, clientID string) (*WatchHistory, error) {
+	h := newWatchHistory()
+	switch source {
+	case ServerPlex:
+		if baseURL == "" {
+			return nil, errors.New("the URL of the Plex server is required")
+		}
+		s := mediaServer{name: source, baseURL: strings.TrimRight(baseURL, "/"), header: "X-Plex-Token", token: token}
+		var sections plexSections
+		if err := s.do(ctx, "GET", "/library/sections", nil, &sections); err != nil {
+			return nil, err
+		}
+		for _, d := range sections.MediaContainer.Directory {
+			kind := "1"
+			switch d.Type {
+			case "movie":
+			case "show":
+				kind = "4"
+			default:
+				continue
+			}
+			q := url.Values{"type": {kind}, "includeGuids": {"1"}}
+			var items plexWatched
+			if err := s.do(ctx, "GET", "/library/sections/"+url.PathEscape(d.Key)+"/all?"+q.Encode(), nil, &items); err != nil {
+				return nil, err
+			}
+			for _, item := range items.MediaContainer.Metadata {
+				if item.ViewCount == 0 {
+					continue
+				}
+				if kind == "4" {
+					h.addEpisode(0, item.GrandparentTitle, item.ParentIndex, item.Index)
+					continue
+				}
+				var tmdbID int
+				for _, g := range item.Guid {
+					if id, ok := strings.CutPrefix(g.ID, "tmdb://"); ok {
+						tmdbID, _ = strconv.Atoi(id)
+					}
+				}
+				h.addMovie(tmdbID, item.Title, item.Year)
+			}
+		}
+		return h, nil
+
+	case SourceTrakt:
+		if token == "" || clientID == "" {
+			return nil, errors.New("a Trakt access token and client ID are required")
+		}
+		if baseURL == "" {
+			baseURL = traktURL
+		}
+		s := mediaServer{name: source, baseURL: strings.TrimRight(baseURL, "/"), header: "Authorization", token: "Bearer " + token,
+			extra: map[string]string{"trakt-api-version": "2", "trakt-api-key": clientID}}
+		var movies traktWatchedMovies
+		if err := s.do(ctx, "GET", "/sync/watched/movies", nil, &movies); err != nil {
+			return nil, err
+		}
+		for _, m := range movies {
+			h.addMovie(m.Movie.IDs.TMDB, m.Movie.Title, m.Movie.Year)
+		}
+		var shows traktWatchedShows
+		if err := s.do(ctx, "GET", "/sync/watched/shows", nil, &shows); err != nil {
+			return nil, err
+		}
+		for _, show := range shows {
+			for _, season := range show.Seasons {
+				for _, ep := range season.Episodes {
+					h.addEpisode(show.Show.IDs.TMDB, show.Show.Title, season.Number, ep.Number)
+				}
+			}
+		}
+		return h, nil
+	}
+	return nil, fmt.Errorf("%w watch history source %q, expected %s or %s", ErrUnsupportedType, source, ServerPlex, SourceTrakt)
+}
+
+// watchedFilter excludes media in a watch history
+type watchedFilter struct {
+	history *WatchHistory
+}
+
+func (f watchedFilter) exclude(l Linkable, _ func() *mediaDetails) bool {
+	if f.history.Watched(l) {
+		options.logger.Debug("skipping watched media", "path", l.Path())
+		return true
+	}
+	return false
+}
+
+// WithWatchHistory skips the media in h, so that media that were watched
+// already and downloaded again aren't linked. A nil history skips nothing.
+func WithWatchHistory(h *WatchHistory) Option {
+	return func(o *Options) {
+		if h != nil {
+			o.mediaFilters = append(o.mediaFilters, watchedFilter{h})
+		}
+	}
+}
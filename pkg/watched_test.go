@@ -0,0 +1,69 @@
+package kourai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWatchHistory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/library/sections":
+			fmt.Fprint(w, `{"MediaContainer":{"Directory":[{"key":"1","type":"movie"},{"key":"2","type":"show"}]}}`)
+		case "/library/sections/1/all":
+			fmt.Fprint(w, `{"MediaContainer":{"Metadata":[
+				{"title":"Heat","year":1995,"viewCount":2,"Guid":[{"id":"imdb://tt0113277"},{"id":"tmdb://949"}]},
+				{"title":"Dune","year":2021}
+			]}}`)
+		case "/library/sections/2/all":
+			fmt.Fprint(w, `{"MediaContainer":{"Metadata":[
+				{"grandparentTitle":"The Wire","parentIndex":1,"index":1,"viewCount":1},
+				{"grandparentTitle":"The Wire","parentIndex":1,"index":2}
+			]}}`)
+		case "/sync/watched/movies":
+			if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("trakt-api-key") != "client" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `[{"movie":{"title":"Heat","year":1995,"ids":{"tmdb":949}}}]`)
+		case "/sync/watched/shows":
+			fmt.Fprint(w, `[{"show":{"title":"The Wire","ids":{"tmdb":1438}},"seasons":[{"number":1,"episodes":[{"number":1}]}]}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	media := []struct {
+		media   Linkable
+		watched bool
+	}{
+		{&movie{title: "Heat", year: 1995, tmdbID: 949}, true},
+		{&movie{title: "HEAT", year: 1995}, true},
+		{&movie{title: "Heat", year: 1986}, false},
+		{&movie{title: "Dune", year: 2021}, false},
+		{&episode{series: "The Wire", season: 1, episode: 1}, true},
+		{&episode{series: "The Wire", season: 1, episode: 2}, false},
+	}
+	for _, source := range []string{ServerPlex, SourceTrakt} {
+		h, err := FetchWatchHistory(context.Background(), source, srv.URL, "secret", "client")
+		if err != nil {
+			t.Fatalf("FetchWatchHistory(%s) returned %v", source, err)
+		}
+		for _, m := range media {
+			if got := h.Watched(m.media); got != m.watched {
+				t.Errorf("%s: Watched(%v) = %v, want %v", source, m.media, got, m.watched)
+			}
+		}
+	}
+
+	if _, err := FetchWatchHistory(context.Background(), SourceTrakt, srv.URL, "wrong", "client"); err == nil {
+		t.Error("FetchWatchHistory() with a wrong token returned no error")
+	}
+	if _, err := FetchWatchHistory(context.Background(), "emby", srv.URL, "secret", ""); err == nil {
+		t.Error("FetchWatchHistory() of an unsupported source returned no error")
+	}
+}
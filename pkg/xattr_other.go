@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package kourai
+
+import "errors"
+
+// XattrsSupported reports whether extended attributes can be read and
+// written on this platform.
+const XattrsSupported = false
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
+
+func setXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
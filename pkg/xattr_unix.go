@@ -0,0 +1,26 @@
+//go:build linux || darwin
+
+package kourai
+
+import "golang.org/x/sys/unix"
+
+// XattrsSupported reports whether extended attributes can be read and
+// written on this platform.
+const XattrsSupported = true
+
+func getXattr(path, name string) ([]byte, error) {
+	n, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	n, err = unix.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	return unix.Setxattr(path, name, value, 0)
+}
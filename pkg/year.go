@@ -0,0 +1,95 @@
+package kourai
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	// parenYearExpr matches years in parentheses or brackets, including
+	// the full-width parentheses of CJK names, e.g. (1999), [1999] or
+	// （1999）
+	parenYearExpr = regexp.MustCompile(`[(\[（]((?:19|20)\d{2})[)\]）]`)
+	// resolutionExpr matches resolutions given by width and height, e.g.
+	// 1920x1080 or 1920 x 1080
+	resolutionExpr = regexp.MustCompile(`(?i)\b\d{3,4}\s*[x×]\s*\d{3,4}\b`)
+	// groupYearExpr matches release groups named like years at the end of
+	// names, e.g. x264-2000
+	groupYearExpr = regexp.MustCompile(`-(?:19|20)\d{2}$`)
+)
+
+// findYear returns the release year given in the name s, and the location
+// of the match in s, or 0 and nil when s gives none.
+//
+// Years in parentheses or brackets are preferred. Otherwise, numbers that
+// are part of resolutions or release group names, or that are too far in
+// the future to be release years, aren't years, and of the others, the
+// last one before the release tags is taken. Years at the start of names
+// are part of titles, as in 2001.A.Space.Odyssey.1968 or 1923.S01E01.
+func findYear(s string) (int, []int) {
+	latest := options.clock.Now().Year() + 2
+	for _, m := range parenYearExpr.FindAllStringSubmatchIndex(s, -1) {
+		if year, _ := strconv.Atoi(s[m[2]:m[3]]); year <= latest {
+			return year, m[:2]
+		}
+	}
+
+	var skip [][]int
+	skip = append(skip, resolutionExpr.FindAllStringIndex(s, -1)...)
+	skip = append(skip, groupYearExpr.FindAllStringIndex(s, -1)...)
+	tags := len(s)
+	if loc := sentinelExpr.FindStringIndex(s); loc != nil {
+		tags = loc[0]
+	}
+
+	var candidates [][]int
+	for _, loc := range dateExpr.FindAllStringIndex(s, -1) {
+		year, _ := strconv.Atoi(s[loc[0] : loc[0]+4])
+		if loc[0] == 0 || year > latest || overlaps(loc, skip) {
+			continue
+		}
+		candidates = append(candidates, loc)
+	}
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	loc := candidates[0]
+	for _, c := range candidates[1:] {
+		if c[0] < tags {
+			loc = c
+		}
+	}
+	year, _ := strconv.Atoi(s[loc[0] : loc[0]+4])
+	return year, loc
+}
+
+// overlaps reports whether the match at loc overlaps any of locs
+func overlaps(loc []int, locs [][]int) bool {
+	for _, l := range locs {
+		if loc[0] < l[1] && l[0] < loc[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// WithFileYear keeps the year given in the names of movies when it's one
+// year off the release year of their match, rather than correcting it, see
+// correctYear.
+func WithFileYear(keep bool) Option {
+	return func(o *Options) {
+		o.keepFileYear = keep
+	}
+}
+
+// correctYear names m after released, the release year of its match, when
+// the year of its name is one year off, as the years of festival premieres
+// and wide releases often are. The year of the name is kept as fileYear.
+// Other differences are left alone, as the match may be a remake.
+func (m *movie) correctYear(released int) {
+	if options.keepFileYear || !m.YearValid() || (m.year-released != 1 && released-m.year != 1) {
+		return
+	}
+	options.logger.Info("corrected year to the release year of the match", "path", m.path, "year", m.year, "released", released)
+	m.fileYear, m.year = m.year, released
+}
@@ -0,0 +1,127 @@
+package kourai
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFindYear(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"Heat.1995.1080p.BluRay", 1995},
+		{"The Matrix (1999)", 1999},
+		{"Spirited Away （2001）", 2001},
+		{"Blade Runner 2049 (2017)", 2017},
+		{"1917 (2019)", 2019},
+		{"2001.A.Space.Odyssey.1968.1080p", 1968},
+		{"Wonder.Woman.1984.2020.2160p.WEB-DL", 2020},
+		{"1917", 0},
+		{"Just The Title", 0},
+	}
+	for _, tt := range tests {
+		if got, _ := findYear(tt.name); got != tt.want {
+			t.Errorf("findYear(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestYearFalsePositives are names with numbers that were taken as years
+func TestYearFalsePositives(t *testing.T) {
+	tests := []struct {
+		path  string
+		title string
+		year  int
+	}{
+		{"/dl/Heat 1995 1920 x 1080.mkv", "Heat", 1995},
+		{"/dl/Some.Movie.2160p.x265-2000.mkv", "Some Movie", 0},
+		{"/dl/Heat.1995.1080p.x264-1999.mkv", "Heat", 1995},
+		{"/dl/Blade.Runner.2049.mkv", "Blade Runner 2049", 0},
+		{"/dl/Blade Runner 2049 (2017)/Blade.Runner.2049.2160p.mkv", "Blade Runner 2049", 2017},
+		{"/dl/2001.A.Space.Odyssey.1968.mkv", "2001 A Space Odyssey", 1968},
+		{"/dl/2001 A Space Odyssey (1968).mkv", "2001 A Space Odyssey", 1968},
+		{"/dl/Blade Runner 2049 (2017).mkv", "Blade Runner 2049", 2017},
+		{"/dl/1917.mkv", "1917", 0},
+		{"/dl/1917.2019.1080p.BluRay.mkv", "1917", 2019},
+		{"/dl/Alien.1979.Remastered.[2000ABCD].mkv", "Alien", 1979},
+	}
+	for _, tt := range tests {
+		m, err := MovieFromPath(tt.path)
+		if err != nil {
+			t.Errorf("MovieFromPath(%s) returned %v", tt.path, err)
+			continue
+		}
+		if m.title != tt.title || m.year != tt.year {
+			t.Errorf("MovieFromPath(%s) = %q (%d), want %q (%d)", tt.path, m.title, m.year, tt.title, tt.year)
+		}
+	}
+
+	// Series named like years aren't dated by their name
+	e, err := EpisodeFromPath("/dl/1923.S01E01.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.series != "1923" || e.year != 0 {
+		t.Errorf("EpisodeFromPath() = %q (%d), want series 1923 and no year", e.series, e.year)
+	}
+
+	// Years in episode titles aren't the year of the series
+	e, err = EpisodeFromPath("/dl/Show.S01E05.1984.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.year != 0 || e.title != "1984" {
+		t.Errorf("EpisodeFromPath() = %q (%d), want title 1984 and no year", e.title, e.year)
+	}
+}
+
+func TestCorrectYear(t *testing.T) {
+	defer func(o *Options) { options = o }(options)
+	options = NewOptions()
+	p := &fakeProvider{movies: map[string]MovieMetadata{
+		"Parasite":  {Title: "Parasite", Year: 2019},
+		"The Thing": {Title: "The Thing", Year: 1982},
+		"Heat":      {Title: "Heat", Year: 1995},
+	}}
+	options.SetOptions(WithMetadataProvider(p))
+
+	tests := []struct {
+		path           string
+		year, fileYear int
+		target         string
+	}{
+		// Festival premieres are a year off wide releases
+		{"/dl/Parasite.2018.1080p.mkv", 2019, 2018, "movies/Parasite (2019)/Parasite.2018.1080p.mkv"},
+		// Other differences may be remakes
+		{"/dl/The.Thing.2011.mkv", 2011, 0, "movies/The Thing (2011)/The.Thing.2011.mkv"},
+		{"/dl/Heat.1995.mkv", 1995, 0, "movies/Heat (1995)/Heat.1995.mkv"},
+	}
+	for _, tt := range tests {
+		l, err := NewLinkable(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lookup(context.Background(), options.metadataProvider(), l)
+		m := l.(*movie)
+		if m.year != tt.year || m.fileYear != tt.fileYear {
+			t.Errorf("lookup() of %s = year %d from %d, want %d from %d", tt.path, m.year, m.fileYear, tt.year, tt.fileYear)
+		}
+		if target := m.Target(); target != tt.target {
+			t.Errorf("Target() of %s = %s, want %s", tt.path, target, tt.target)
+		}
+		if r := scanResult(m); r.FileYear != tt.fileYear {
+			t.Errorf("scanResult() of %s has FileYear %d, want %d", tt.path, r.FileYear, tt.fileYear)
+		}
+	}
+
+	options.SetOptions(WithFileYear(true))
+	l, err := NewLinkable("/dl/Parasite.2018.1080p.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup(context.Background(), options.metadataProvider(), l)
+	if m := l.(*movie); m.year != 2018 || m.fileYear != 0 {
+		t.Errorf("lookup() with WithFileYear = year %d from %d, want 2018 kept", m.year, m.fileYear)
+	}
+}